@@ -0,0 +1,547 @@
+package api
+
+import (
+	"hjyserver/mdb"
+	"hjyserver/mdb/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitAdminActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc) {
+	postAction := make(map[string]gin.HandlerFunc)
+	getAction := make(map[string]gin.HandlerFunc)
+
+	getAction["/admin/queryUsers"] = withPermission(mysql.PermUserRead, adminQueryUsers)
+	getAction["/admin/queryDevices"] = withPermission(mysql.PermDeviceRead, adminQueryDevices)
+	getAction["/admin/queryDeviceUsers"] = withPermission(mysql.PermDeviceRead, adminQueryDeviceUsers)
+	getAction["/admin/queryOtaWhiteList"] = withPermission(mysql.PermOta, queryX1sWhiteList)
+	getAction["/admin/querySecurityEvents"] = withPermission(mysql.PermUserRead, adminQuerySecurityEvents)
+	getAction["/admin/queryOrganizations"] = withPermission(mysql.PermApiKeyManage, adminQueryOrganizations)
+	getAction["/admin/queryApiKeys"] = withPermission(mysql.PermApiKeyManage, adminQueryApiKeys)
+	getAction["/admin/queryApiKeyUsage"] = withPermission(mysql.PermApiKeyManage, adminQueryApiKeyUsage)
+	getAction["/admin/queryWebhooks"] = withPermission(mysql.PermWebhookManage, adminQueryWebhooks)
+	getAction["/admin/queryWebhookDeliveries"] = withPermission(mysql.PermWebhookManage, adminQueryWebhookDeliveries)
+	getAction["/admin/queryNotifyAttempts"] = withPermission(mysql.PermNotifyRead, adminQueryNotifyAttempts)
+	getAction["/admin/queryNotifyTemplates"] = withPermission(mysql.PermNotifyTemplate, adminQueryNotifyTemplates)
+	getAction["/admin/queryAlarms"] = withPermission(mysql.PermAlarmRead, adminQueryAlarms)
+	getAction["/admin/queryAlarmStats"] = withPermission(mysql.PermAlarmRead, adminQueryAlarmStats)
+	getAction["/admin/queryAlarmEscalations"] = withPermission(mysql.PermAlarmRead, adminQueryAlarmEscalations)
+	getAction["/admin/querySmsStats"] = withPermission(mysql.PermNotifyRead, adminQuerySmsStats)
+
+	postAction["/admin/unbindDevice"] = withPermission(mysql.PermDeviceUnbind, adminUnbindDevice)
+	postAction["/admin/revokeUserTokens"] = withPermission(mysql.PermTokenRevoke, adminRevokeUserTokens)
+	postAction["/admin/insertOtaWhiteList"] = withPermission(mysql.PermOta, insertX1sWhiteList)
+	postAction["/admin/deleteOtaWhiteList"] = withPermission(mysql.PermOta, adminDeleteOtaWhiteList)
+	postAction["/admin/setUserRole"] = withPermission(mysql.PermRoleManage, adminSetUserRole)
+	postAction["/admin/createOrganization"] = withPermission(mysql.PermApiKeyManage, adminCreateOrganization)
+	postAction["/admin/createApiKey"] = withPermission(mysql.PermApiKeyManage, adminCreateApiKey)
+	postAction["/admin/updateApiKey"] = withPermission(mysql.PermApiKeyManage, adminUpdateApiKey)
+	postAction["/admin/revokeApiKey"] = withPermission(mysql.PermApiKeyManage, adminRevokeApiKey)
+	postAction["/admin/createWebhook"] = withPermission(mysql.PermWebhookManage, adminCreateWebhook)
+	postAction["/admin/updateWebhook"] = withPermission(mysql.PermWebhookManage, adminUpdateWebhook)
+	postAction["/admin/deleteWebhook"] = withPermission(mysql.PermWebhookManage, adminDeleteWebhook)
+	postAction["/admin/redeliverWebhook"] = withPermission(mysql.PermWebhookManage, adminRedeliverWebhook)
+	postAction["/admin/saveNotifyTemplate"] = withPermission(mysql.PermNotifyTemplate, adminSaveNotifyTemplate)
+	postAction["/admin/deleteNotifyTemplate"] = withPermission(mysql.PermNotifyTemplate, adminDeleteNotifyTemplate)
+	return postAction, getAction
+}
+
+// adminQueryUsers godoc
+//
+//	@Summary	adminQueryUsers
+//	@Schemes
+//	@Description	按账号、手机、邮箱或昵称模糊查询用户, 需要user:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			keyword		query	string	false	"关键字"
+//	@Param			user_id		query	int		false	"用户id"
+//	@Param			pageNo		query	int		false	"页号"
+//	@Param			pageSize	query	int		false	"每页记录数"
+//
+// @Success		200			{array}	mdb.AdminUser
+// @Router			/admin/queryUsers [get]
+func adminQueryUsers(c *gin.Context) {
+	apiPageFunc(c, mdb.AdminQueryUsers)
+}
+
+// adminQueryDevices godoc
+//
+//	@Summary	adminQueryDevices
+//	@Schemes
+//	@Description	按mac或名称模糊查询设备, 需要device:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			keyword		query	string	false	"关键字"
+//	@Param			type		query	string	false	"设备类型"
+//	@Param			pageNo		query	int		false	"页号"
+//	@Param			pageSize	query	int		false	"每页记录数"
+//
+// @Success		200			{array}	mysql.Device
+// @Router			/admin/queryDevices [get]
+func adminQueryDevices(c *gin.Context) {
+	apiPageFunc(c, mdb.AdminQueryDevices)
+}
+
+// adminQueryDeviceUsers godoc
+//
+//	@Summary	adminQueryDeviceUsers
+//	@Schemes
+//	@Description	查询绑定和共享设备的所有用户, 需要device:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			mac		query	string	true	"设备mac"
+//
+// @Success		200			{array}	mysql.UserDeviceDetail
+// @Router			/admin/queryDeviceUsers [get]
+func adminQueryDeviceUsers(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQueryDeviceUsers)
+}
+
+// adminQuerySecurityEvents godoc
+//
+//	@Summary	adminQuerySecurityEvents
+//	@Schemes
+//	@Description	查询登录失败、账号锁定、IP封禁、解锁和重置密码等安全事件, 需要user:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			user_id		query	int		false	"用户id"
+//	@Param			account		query	string	false	"登录账号"
+//	@Param			event_type	query	string	false	"login_fail/account_locked/ip_blocked/account_unlocked/password_reset"
+//	@Param			pageNo		query	int		false	"页号"
+//	@Param			pageSize	query	int		false	"每页记录数"
+//
+// @Success		200			{array}	mysql.SecurityEvent
+// @Router			/admin/querySecurityEvents [get]
+func adminQuerySecurityEvents(c *gin.Context) {
+	apiPageFunc(c, mdb.AdminQuerySecurityEvents)
+}
+
+// adminUnbindDevice godoc
+//
+//	@Summary	adminUnbindDevice
+//	@Schemes
+//	@Description	强制解绑设备, 删除设备和所有用户的关系以及共享、过户记录, 需要device:unbind权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.AdminDeviceReq	true	"设备mac"
+//
+// @Success		200			{string}	string	"unbind device success"
+// @Router			/admin/unbindDevice [post]
+func adminUnbindDevice(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminUnbindDevice)
+}
+
+// adminRevokeUserTokens godoc
+//
+//	@Summary	adminRevokeUserTokens
+//	@Schemes
+//	@Description	撤销用户所有的登录会话, 需要token:revoke权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.AdminUserReq	true	"用户id"
+//
+// @Success		200			{string}	string	"revoke tokens success"
+// @Router			/admin/revokeUserTokens [post]
+func adminRevokeUserTokens(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminRevokeUserTokens)
+}
+
+// adminDeleteOtaWhiteList godoc
+//
+//	@Summary	adminDeleteOtaWhiteList
+//	@Schemes
+//	@Description	从X1s OTA白名单中删除mac, 多个mac用;分隔, 需要ota:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.X1sWhiteListReq	true	"mac"
+//
+// @Success		200			{string}	string	"ok"
+// @Router			/admin/deleteOtaWhiteList [post]
+func adminDeleteOtaWhiteList(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminDeleteOtaWhiteList)
+}
+
+// adminSetUserRole godoc
+//
+//	@Summary	adminSetUserRole
+//	@Schemes
+//	@Description	设置用户角色, 需要role:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.AdminRoleReq	true	"用户id和角色"
+//
+// @Success		200			{object}	mysql.UserRole
+// @Router			/admin/setUserRole [post]
+func adminSetUserRole(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminSetUserRole)
+}
+
+// adminQueryOrganizations godoc
+//
+//	@Summary	adminQueryOrganizations
+//	@Schemes
+//	@Description	查询合作机构, 需要apikey:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//
+// @Success		200			{array}	mysql.Organization
+// @Router			/admin/queryOrganizations [get]
+func adminQueryOrganizations(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQueryOrganizations)
+}
+
+// adminCreateOrganization godoc
+//
+//	@Summary	adminCreateOrganization
+//	@Schemes
+//	@Description	创建合作机构, 需要apikey:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mysql.Organization	true	"机构信息"
+//
+// @Success		200			{object}	mysql.Organization
+// @Router			/admin/createOrganization [post]
+func adminCreateOrganization(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminCreateOrganization)
+}
+
+// adminQueryApiKeys godoc
+//
+//	@Summary	adminQueryApiKeys
+//	@Schemes
+//	@Description	查询api key, 不返回明文key, 需要apikey:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			org_id	query	int		false	"机构id"
+//
+// @Success		200			{array}	mysql.ApiKey
+// @Router			/admin/queryApiKeys [get]
+func adminQueryApiKeys(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQueryApiKeys)
+}
+
+// adminQueryApiKeyUsage godoc
+//
+//	@Summary	adminQueryApiKeyUsage
+//	@Schemes
+//	@Description	查询api key最近几天按接口的调用次数, 需要apikey:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			id		query	int		true	"api key id"
+//	@Param			days	query	int		false	"天数, 缺省7天"
+//
+// @Success		200			{array}	mysql.ApiKeyUsage
+// @Router			/admin/queryApiKeyUsage [get]
+func adminQueryApiKeyUsage(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQueryApiKeyUsage)
+}
+
+// adminCreateApiKey godoc
+//
+//	@Summary	adminCreateApiKey
+//	@Schemes
+//	@Description	为合作机构创建api key, 明文key只在返回中出现一次, 调用时放在X-Api-Key头中,
+//	@Description	只能访问授权范围内的接口和允许列表中的设备, 需要apikey:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.ApiKeyReq	true	"机构id、名称、授权范围、设备和限额"
+//
+// @Success		200			{object}	mdb.ApiKeyResp
+// @Router			/admin/createApiKey [post]
+func adminCreateApiKey(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminCreateApiKey)
+}
+
+// adminUpdateApiKey godoc
+//
+//	@Summary	adminUpdateApiKey
+//	@Schemes
+//	@Description	修改api key的授权范围、设备和限额, 需要apikey:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.ApiKeyReq	true	"key id、授权范围、设备和限额"
+//
+// @Success		200			{object}	mysql.ApiKey
+// @Router			/admin/updateApiKey [post]
+func adminUpdateApiKey(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminUpdateApiKey)
+}
+
+// adminRevokeApiKey godoc
+//
+//	@Summary	adminRevokeApiKey
+//	@Schemes
+//	@Description	撤销api key, 立即失效, 需要apikey:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.ApiKeyReq	true	"key id"
+//
+// @Success		200			{string}	string	"revoke api key success"
+// @Router			/admin/revokeApiKey [post]
+func adminRevokeApiKey(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminRevokeApiKey)
+}
+
+// adminQueryWebhooks godoc
+//
+//	@Summary	adminQueryWebhooks
+//	@Schemes
+//	@Description	查询合作机构的webhook, 不返回签名密钥, 需要webhook:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			org_id	query	int		false	"机构id"
+//
+// @Success		200			{array}	mysql.Webhook
+// @Router			/admin/queryWebhooks [get]
+func adminQueryWebhooks(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQueryWebhooks)
+}
+
+// adminQueryWebhookDeliveries godoc
+//
+//	@Summary	adminQueryWebhookDeliveries
+//	@Schemes
+//	@Description	查询webhook推送记录, status=2为超过重试次数的死信列表, 需要webhook:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			webhook_id	query	int		false	"webhook id"
+//	@Param			status		query	int		false	"0:等待推送 1:成功 2:死信"
+//	@Param			event_type	query	string	false	"事件类型"
+//	@Param			mac			query	string	false	"设备mac"
+//	@Param			pageNo		query	int		false	"页号"
+//	@Param			pageSize	query	int		false	"每页记录数"
+//
+// @Success		200			{array}	mysql.WebhookDelivery
+// @Router			/admin/queryWebhookDeliveries [get]
+func adminQueryWebhookDeliveries(c *gin.Context) {
+	apiPageFunc(c, mdb.AdminQueryWebhookDeliveries)
+}
+
+// adminQueryNotifyAttempts godoc
+//
+//	@Summary	adminQueryNotifyAttempts
+//	@Schemes
+//	@Description	查询用户通知的发送记录, 每个通道的每次发送一条, 需要notify:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			user_id		query	int		false	"用户id"
+//	@Param			event_id	query	string	false	"事件id"
+//	@Param			event_type	query	string	false	"事件类型"
+//	@Param			channel		query	string	false	"通道"
+//	@Param			status		query	int		false	"1:成功 2:失败 3:跳过"
+//	@Param			mac			query	string	false	"设备mac"
+//	@Param			pageNo		query	int		false	"页号"
+//	@Param			pageSize	query	int		false	"每页记录数"
+//
+// @Success		200			{array}	mysql.NotifyAttempt
+// @Router			/admin/queryNotifyAttempts [get]
+func adminQueryNotifyAttempts(c *gin.Context) {
+	apiPageFunc(c, mdb.AdminQueryNotifyAttempts)
+}
+
+// adminCreateWebhook godoc
+//
+//	@Summary	adminCreateWebhook
+//	@Schemes
+//	@Description	为合作机构创建webhook, 签名密钥只在返回中出现一次. 推送时请求头X-Hjy-Signature为
+//	@Description	t=<时间戳>,v1=<HMAC-SHA256(密钥, "时间戳.body")>, 只推送机构api key有权限的设备事件,
+//	@Description	需要webhook:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.WebhookReq	true	"机构id、https地址和订阅的事件"
+//
+// @Success		200			{object}	mdb.WebhookResp
+// @Router			/admin/createWebhook [post]
+func adminCreateWebhook(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminCreateWebhook)
+}
+
+// adminUpdateWebhook godoc
+//
+//	@Summary	adminUpdateWebhook
+//	@Schemes
+//	@Description	修改webhook的地址、订阅的事件和状态, 需要webhook:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.WebhookReq	true	"webhook id、地址、事件和状态"
+//
+// @Success		200			{object}	mysql.Webhook
+// @Router			/admin/updateWebhook [post]
+func adminUpdateWebhook(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminUpdateWebhook)
+}
+
+// adminDeleteWebhook godoc
+//
+//	@Summary	adminDeleteWebhook
+//	@Schemes
+//	@Description	删除webhook, 需要webhook:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.WebhookReq	true	"webhook id"
+//
+// @Success		200			{string}	string	"delete webhook success"
+// @Router			/admin/deleteWebhook [post]
+func adminDeleteWebhook(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminDeleteWebhook)
+}
+
+// adminRedeliverWebhook godoc
+//
+//	@Summary	adminRedeliverWebhook
+//	@Schemes
+//	@Description	手动重新推送一条记录, 包括死信列表中的记录, 需要webhook:manage权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.WebhookReq	true	"推送记录id"
+//
+// @Success		200			{object}	mysql.WebhookDelivery
+// @Router			/admin/redeliverWebhook [post]
+func adminRedeliverWebhook(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminRedeliverWebhook)
+}
+
+// adminQueryNotifyTemplates godoc
+//
+//	@Summary	adminQueryNotifyTemplates
+//	@Schemes
+//	@Description	查询数据库中的通知模板, 同一模板key和语言覆盖模板文件, 需要notify:template权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			event_key	query	string	false	"模板key, 如sleep.alarm.3008"
+//	@Param			locale		query	string	false	"语言"
+//
+// @Success		200			{array}	mysql.NotifyTemplate
+// @Router			/admin/queryNotifyTemplates [get]
+func adminQueryNotifyTemplates(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQueryNotifyTemplates)
+}
+
+// adminSaveNotifyTemplate godoc
+//
+//	@Summary	adminSaveNotifyTemplate
+//	@Schemes
+//	@Description	保存通知模板, 内容为text/template格式, 可以使用{{.NickName}} {{.DeviceName}} {{.Value}} {{.CreateTime}}等事件字段,
+//	@Description	模板key依次查找 事件类型.code.status、事件类型.code、事件类型, 保存后立即生效, 需要notify:template权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mysql.NotifyTemplate	true	"模板key、语言和内容"
+//
+// @Success		200			{object}	mysql.NotifyTemplate
+// @Router			/admin/saveNotifyTemplate [post]
+func adminSaveNotifyTemplate(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminSaveNotifyTemplate)
+}
+
+// adminDeleteNotifyTemplate godoc
+//
+//	@Summary	adminDeleteNotifyTemplate
+//	@Schemes
+//	@Description	删除数据库中的通知模板, 删除后使用模板文件中的同名模板, 需要notify:template权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mysql.NotifyTemplate	true	"模板id"
+//
+// @Success		200			{string}	string	"delete template success"
+// @Router			/admin/deleteNotifyTemplate [post]
+func adminDeleteNotifyTemplate(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminDeleteNotifyTemplate)
+}
+
+// adminQueryAlarms godoc
+//
+//	@Summary	adminQueryAlarms
+//	@Schemes
+//	@Description	按机构、设备、来源和状态查询报警, 机构的设备为有效api key允许列表中的设备, 需要alarm:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			org_id		query	int		false	"机构id"
+//	@Param			mac			query	string	false	"设备mac"
+//	@Param			source		query	string	false	"sleep:睡眠设备 fall:跌倒检测 study:学习设备"
+//	@Param			status		query	int		false	"1:未处理 2:已确认 3:已恢复"
+//	@Param			start_time	query	string	false	"报警时间起"
+//	@Param			end_time	query	string	false	"报警时间止"
+//	@Param			pageNo		query	int		false	"页号"
+//	@Param			pageSize	query	int		false	"每页记录数"
+//
+// @Success		200			{array}	mysql.Alarm
+// @Router			/admin/queryAlarms [get]
+func adminQueryAlarms(c *gin.Context) {
+	apiPageFunc(c, mdb.AdminQueryAlarms)
+}
+
+// adminQueryAlarmStats godoc
+//
+//	@Summary	adminQueryAlarmStats
+//	@Schemes
+//	@Description	按机构或设备统计报警数量和MTTA/MTTR, 单位秒, 第一条为合计, 之后按来源, 需要alarm:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			org_id		query	int		false	"机构id"
+//	@Param			mac			query	string	false	"设备mac"
+//	@Param			start_time	query	string	false	"报警时间起"
+//	@Param			end_time	query	string	false	"报警时间止"
+//
+// @Success		200			{array}	mysql.AlarmStats
+// @Router			/admin/queryAlarmStats [get]
+func adminQueryAlarmStats(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQueryAlarmStats)
+}
+
+// adminQueryAlarmEscalations godoc
+//
+//	@Summary	adminQueryAlarmEscalations
+//	@Schemes
+//	@Description	查询报警的升级状态, step为下一级, status 0:等待执行 1:已完成 2:已取消, 需要alarm:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token		query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			alarm_id	query	int		true	"报警id"
+//
+// @Success		200			{array}	mysql.AlarmEscalation
+// @Router			/admin/queryAlarmEscalations [get]
+func adminQueryAlarmEscalations(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQueryAlarmEscalations)
+}
+
+// adminQuerySmsStats godoc
+//
+//	@Summary	adminQuerySmsStats
+//	@Schemes
+//	@Description	查询每个短信供应商的发送成功、失败和回执送达统计, 从本实例启动开始, 需要notify:read权限
+//	@Tags			admin
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//
+// @Success		200	{array}	sms.ProviderStats
+// @Router			/admin/querySmsStats [get]
+func adminQuerySmsStats(c *gin.Context) {
+	apiCommonFunc(c, mdb.AdminQuerySmsStats)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"hjyserver/mdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitAlarmActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc) {
+	postAction := make(map[string]gin.HandlerFunc)
+	getAction := make(map[string]gin.HandlerFunc)
+
+	getAction["/alarm/queryActiveAlarms"] = queryActiveAlarms
+	getAction["/alarm/queryAlarmHistory"] = queryAlarmHistory
+	getAction["/alarm/queryAlarmStats"] = queryAlarmStats
+
+	postAction["/alarm/ackAlarm"] = ackAlarm
+	postAction["/alarm/resolveAlarm"] = resolveAlarm
+	return postAction, getAction
+}
+
+// queryActiveAlarms godoc
+//
+//	@Summary	queryActiveAlarms
+//	@Schemes
+//	@Description	查询未恢复的报警, 包括未处理和已确认, 按用户的设备或单个设备查询, 合作机构使用api key时必须指定mac
+//	@Tags			alarm
+//	@Produce		json
+//	@Param			token	query	string	false	"token"
+//	@Param			user_id	query	int		false	"用户id, 查询用户拥有或被共享的设备"
+//	@Param			mac		query	string	false	"设备mac"
+//
+//	@Success		200			{array}	mysql.Alarm
+//	@Router			/alarm/queryActiveAlarms [get]
+func queryActiveAlarms(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryActiveAlarms)
+}
+
+// queryAlarmHistory godoc
+//
+//	@Summary	queryAlarmHistory
+//	@Schemes
+//	@Description	分页查询报警历史, 可以按来源、状态和报警时间过滤
+//	@Tags			alarm
+//	@Produce		json
+//	@Param			token		query	string	false	"token"
+//	@Param			user_id		query	int		false	"用户id"
+//	@Param			mac			query	string	false	"设备mac"
+//	@Param			source		query	string	false	"sleep:睡眠设备 fall:跌倒检测 study:学习设备"
+//	@Param			status		query	int		false	"1:未处理 2:已确认 3:已恢复"
+//	@Param			start_time	query	string	false	"报警时间起, 格式2006-01-02 15:04:05"
+//	@Param			end_time	query	string	false	"报警时间止"
+//	@Param			pageNo		query	int		false	"页号"
+//	@Param			pageSize	query	int		false	"每页记录数"
+//
+//	@Success		200			{array}	mysql.Alarm
+//	@Router			/alarm/queryAlarmHistory [get]
+func queryAlarmHistory(c *gin.Context) {
+	apiPageFunc(c, mdb.QueryAlarmHistory)
+}
+
+// queryAlarmStats godoc
+//
+//	@Summary	queryAlarmStats
+//	@Schemes
+//	@Description	统计报警数量、平均确认时间MTTA和平均恢复时间MTTR, 单位秒, 第一条为合计, 之后按来源
+//	@Tags			alarm
+//	@Produce		json
+//	@Param			token		query	string	false	"token"
+//	@Param			user_id		query	int		false	"用户id"
+//	@Param			mac			query	string	false	"设备mac"
+//	@Param			start_time	query	string	false	"报警时间起"
+//	@Param			end_time	query	string	false	"报警时间止"
+//
+//	@Success		200			{array}	mysql.AlarmStats
+//	@Router			/alarm/queryAlarmStats [get]
+func queryAlarmStats(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryAlarmStats)
+}
+
+// ackAlarm godoc
+//
+//	@Summary	ackAlarm
+//	@Schemes
+//	@Description	护理人员确认报警, 记录确认人、时间和备注, 已自动恢复但未确认的报警也可以确认
+//	@Tags			alarm
+//	@Produce		json
+//	@Param			token	query	string			false	"token"
+//	@Param			in		body	mdb.AlarmReq	true	"报警id和备注"
+//
+//	@Success		200			{object}	mysql.Alarm
+//	@Router			/alarm/ackAlarm [post]
+func ackAlarm(c *gin.Context) {
+	apiCommonFunc(c, mdb.AckAlarm)
+}
+
+// resolveAlarm godoc
+//
+//	@Summary	resolveAlarm
+//	@Schemes
+//	@Description	手动恢复报警, 如现场处理完成但设备没有上报恢复事件
+//	@Tags			alarm
+//	@Produce		json
+//	@Param			token	query	string			false	"token"
+//	@Param			in		body	mdb.AlarmReq	true	"报警id和备注"
+//
+//	@Success		200			{object}	mysql.Alarm
+//	@Router			/alarm/resolveAlarm [post]
+func resolveAlarm(c *gin.Context) {
+	apiCommonFunc(c, mdb.ResolveAlarm)
+}
@@ -28,8 +28,6 @@ import (
 
 	mylog "hjyserver/log"
 
-	"github.com/didip/tollbooth"
-	"github.com/didip/tollbooth_gin"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -42,10 +40,12 @@ var svcHttp *http.Server = nil
 // StartWeb function run a webservice at webPort
 func StartWeb() {
 	// 设置限流
-	limt := tollbooth.NewLimiter(100, nil)
-	limt.SetIPLookups([]string{"RemoteAddr", "X-Forwarded-For", "X-Real-IP"}).SetMethods([]string{"GET", "POST"})
-	limt.SetMessage("{ \"code\": 201, \"message\": \"reached max request limit\"}")
+	limit := rateLimitHandler()
 	router := gin.Default()
+	// 登录保护、验证码和限流按客户端IP计数, 只信任配置的代理转发的X-Forwarded-For
+	if err := router.SetTrustedProxies(cfg.This.Svr.TrustedProxies); err != nil {
+		mylog.Log.Errorln("set trusted proxies error:", err)
+	}
 	// 设置路由版本
 	verApi := router.Group("/" + cfg.This.Svr.ApiVersion)
 	// 设置swagger版本信息
@@ -54,96 +54,155 @@ func StartWeb() {
 	initActions()
 
 	for k, v := range getAction {
-		verApi.GET(k, tollbooth_gin.LimitHandler(limt), v)
+		if cfg.This.Svr.ApiVersion == "v1" {
+			verApi.GET(k, limit, v)
+		} else {
+			verApi.GET(k, limit, AuthorizeResource, v)
+		}
 	}
 	for k, v := range postAction {
 		if cfg.This.Svr.ApiVersion == "v1" {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), v)
+			verApi.POST(k, limit, v)
 		} else {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), AuthorizeToken, v)
+			verApi.POST(k, limit, AuthorizeToken, AuthorizeResource, v)
 		}
 	}
 
 	// 初始化用户接口
 	userPosts, userGets := InitUserActions()
 	for k, v := range userGets {
-		verApi.GET(k, tollbooth_gin.LimitHandler(limt), v)
+		if cfg.This.Svr.ApiVersion == "v1" {
+			verApi.GET(k, limit, v)
+		} else {
+			verApi.GET(k, limit, AuthorizeResource, v)
+		}
 	}
 	for k, v := range userPosts {
 		if cfg.This.Svr.ApiVersion == "v1" {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), v)
+			verApi.POST(k, limit, v)
 		} else {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), AuthorizeToken, v)
+			verApi.POST(k, limit, AuthorizeToken, AuthorizeResource, v)
 		}
 	}
 	// 初始化设备接口
 	devicesPost, devicesGets := InitDeviceActions()
 	for k, v := range devicesGets {
-		verApi.GET(k, tollbooth_gin.LimitHandler(limt), v)
+		if cfg.This.Svr.ApiVersion == "v1" {
+			verApi.GET(k, limit, v)
+		} else {
+			verApi.GET(k, limit, AuthorizeResource, v)
+		}
 	}
 	for k, v := range devicesPost {
 		if cfg.This.Svr.ApiVersion == "v1" {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), v)
+			verApi.POST(k, limit, v)
 		} else {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), AuthorizeToken, v)
+			verApi.POST(k, limit, AuthorizeToken, AuthorizeResource, v)
 		}
 	}
 
 	// 初始化微信接口
 	wxPosts, wxGets := wxapi.InitWxActions()
 	for k, v := range wxGets {
-		verApi.GET(k, tollbooth_gin.LimitHandler(limt), v)
+		verApi.GET(k, limit, v)
 	}
 	for k, v := range wxPosts {
-		verApi.POST(k, tollbooth_gin.LimitHandler(limt), v)
+		verApi.POST(k, limit, v)
+	}
+	// 初始化短信回执接口, 由供应商推送, 按供应商的token或签名校验
+	smsPosts, _ := InitSmsActions()
+	for k, v := range smsPosts {
+		verApi.POST(k, limit, v)
 	}
 	// 初始化H03接口
 	h03Ports, h03Gets := InitH03Actions()
 	for k, v := range h03Gets {
-		verApi.GET(k, tollbooth_gin.LimitHandler(limt), v)
+		if cfg.This.Svr.ApiVersion == "v1" {
+			verApi.GET(k, limit, v)
+		} else {
+			verApi.GET(k, limit, AuthorizeResource, v)
+		}
 	}
 	for k, v := range h03Ports {
 		if cfg.This.Svr.ApiVersion == "v1" {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), v)
+			verApi.POST(k, limit, v)
 		} else {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), AuthorizeToken, v)
+			verApi.POST(k, limit, AuthorizeToken, AuthorizeResource, v)
 		}
 	}
 	// 初始化T1接口
 	t1Ports, t1Gets := InitT1Actions()
 	for k, v := range t1Gets {
-		verApi.GET(k, tollbooth_gin.LimitHandler(limt), v)
+		if cfg.This.Svr.ApiVersion == "v1" {
+			verApi.GET(k, limit, v)
+		} else {
+			verApi.GET(k, limit, AuthorizeResource, v)
+		}
 	}
 	for k, v := range t1Ports {
 		if cfg.This.Svr.ApiVersion == "v1" {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), v)
+			verApi.POST(k, limit, v)
 		} else {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), AuthorizeToken, v)
+			verApi.POST(k, limit, AuthorizeToken, AuthorizeResource, v)
 		}
 	}
 	// 初始化X1s接口
 	x1sPorts, x1sGets := InitX1sActions()
 	for k, v := range x1sGets {
-		verApi.GET(k, tollbooth_gin.LimitHandler(limt), v)
+		verApi.GET(k, limit, v)
 	}
 	for k, v := range x1sPorts {
 		if cfg.This.Svr.ApiVersion == "v1" {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), v)
+			verApi.POST(k, limit, v)
 		} else {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), AuthorizeToken, v)
+			verApi.POST(k, limit, AuthorizeToken, v)
 		}
 	}
 	// 初始化setting接口
 	settingPorts, settingGets := InitSettingActions()
 	for k, v := range settingGets {
-		verApi.GET(k, tollbooth_gin.LimitHandler(limt), v)
+		verApi.GET(k, limit, v)
 	}
+	// 修改设置需要banner管理权限
 	for k, v := range settingPorts {
-		if cfg.This.Svr.ApiVersion == "v1" {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), v)
-		} else {
-			verApi.POST(k, tollbooth_gin.LimitHandler(limt), AuthorizeToken, v)
-		}
+		verApi.POST(k, limit, AuthorizeToken, RequirePermission(mysql.PermBanner), v)
+	}
+	// 初始化实时数据推送接口, 长连接与api版本无关始终需要鉴权
+	_, streamGets := InitStreamActions()
+	for k, v := range streamGets {
+		verApi.GET(k, limit, AuthorizeResource, v)
+	}
+	// 初始化报警接口, 与api版本无关始终需要鉴权
+	alarmPosts, alarmGets := InitAlarmActions()
+	for k, v := range alarmGets {
+		verApi.GET(k, limit, AuthorizeResource, v)
+	}
+	for k, v := range alarmPosts {
+		verApi.POST(k, limit, AuthorizeToken, AuthorizeResource, v)
+	}
+	// 初始化紧急联系人接口, 与api版本无关始终需要鉴权
+	contactPosts, contactGets := InitContactActions()
+	for k, v := range contactGets {
+		verApi.GET(k, limit, AuthorizeResource, v)
+	}
+	for k, v := range contactPosts {
+		verApi.POST(k, limit, AuthorizeToken, AuthorizeResource, v)
+	}
+	// 初始化指标规则接口, 与api版本无关始终需要鉴权
+	rulePosts, ruleGets := InitRuleActions()
+	for k, v := range ruleGets {
+		verApi.GET(k, limit, AuthorizeResource, v)
+	}
+	for k, v := range rulePosts {
+		verApi.POST(k, limit, AuthorizeToken, AuthorizeResource, v)
+	}
+	// 初始化管理后台接口, 整个组需要管理后台权限, 与api版本无关始终需要token
+	adminPosts, adminGets := InitAdminActions()
+	for k, v := range adminGets {
+		verApi.GET(k, limit, RequirePermission(mysql.PermAdminConsole), v)
+	}
+	for k, v := range adminPosts {
+		verApi.POST(k, limit, RequirePermission(mysql.PermAdminConsole), v)
 	}
 
 	router.MaxMultipartMemory = 8 << 40
@@ -227,6 +286,9 @@ func initActions() {
 
 	getAction["/notify/queryNotifySettingByType"] = queryNotifySettingByType
 	getAction["/notify/queryAllNotifySetting"] = queryAllNotifySetting
+	getAction["/notify/queryPreference"] = queryNotifyPreference
+	getAction["/notify/inbox"] = queryInbox
+	getAction["/notify/inbox/unreadCount"] = queryInboxUnreadCount
 
 	postAction = make(map[string]gin.HandlerFunc)
 
@@ -239,6 +301,8 @@ func initActions() {
 	// postAction["/notify/beeperSetting"] = beeperSetting
 	// postAction["/notify/lightSetting"] = lightSetting
 	postAction["/notify/notifySetting"] = notifySetting
+	postAction["/notify/updatePreference"] = updateNotifyPreference
+	postAction["/notify/inbox/markRead"] = markInboxRead
 
 	postAction["/upload/picture"] = uploadPicFun
 	postAction["/upload/video"] = uploadVideoFun
@@ -246,19 +310,43 @@ func initActions() {
 	postAction["/upload/file"] = uploadFileFun
 }
 
+/******************************************************************************
+ * function: getPageDaoFromGin
+ * description: 从请求参数中解析分页信息, 没有分页参数时返回nil
+ * pageNo, pageSize: 页号分页
+ * cursor: 游标分页, 第一页传空值, 之后传上一页返回的next_cursor
+ * order: 游标分页排序方向 asc/desc, 缺省按接口的排序
+ * with_total: 0 不统计总记录数
+ * return {*}
+********************************************************************************/
 func getPageDaoFromGin(c *gin.Context) *common.PageDao {
 	pageNo := c.Query("pageNo")
 	pageSize := c.Query("pageSize")
+	cursor, isKeySet := c.GetQuery("cursor")
+	if pageNo == "" && !isKeySet {
+		return nil
+	}
+	size, err := strconv.ParseInt(pageSize, 10, 64)
+	if err != nil || size <= 0 {
+		size = 10
+	}
 	var page *common.PageDao = nil
-	if pageNo != "" {
-		no, err1 := strconv.ParseInt(pageNo, 10, 64)
-		size, err2 := strconv.ParseInt(pageSize, 10, 64)
-		if err1 == nil && err2 == nil {
-			page = common.NewPageDao(no, size)
+	if isKeySet {
+		page = common.NewCursorPageDao(cursor, size)
+		// 游标分页缺省不统计总数
+		page.WithTotal = false
+	} else {
+		no, err := strconv.ParseInt(pageNo, 10, 64)
+		if err != nil || no <= 0 {
+			no = 1
 		}
+		page = common.NewPageDao(no, size)
+	}
+	if order := c.Query("order"); order != "" {
+		page.Order = order
 	}
-	if page == nil {
-		page = common.NewPageDao(1, 10)
+	if withTotal := c.Query("with_total"); withTotal != "" {
+		page.WithTotal = withTotal != "0"
 	}
 	return page
 }
@@ -282,24 +370,12 @@ func AuthorizeToken(c *gin.Context) {
 		return
 	}
 
-	if uri == "/"+cfg.This.Svr.ApiVersion+"/user/userLogin" ||
-		uri == "/"+cfg.This.Svr.ApiVersion+"/user/loginout" ||
-		uri == "/"+cfg.This.Svr.ApiVersion+"/user/userRegister" ||
-		uri == "/"+cfg.This.Svr.ApiVersion+"/wx/wxMiniProgramLogin" ||
-		uri == "/"+cfg.This.Svr.ApiVersion+"/wx/wxPublicSubmit" {
+	if publicRoutes[routePath(c)] {
 		c.Next()
 		return
 	}
-	token := c.Query("token")
-	mylog.Log.Debug("token: ", token)
-	if token == "" {
-		respJSON(c, common.TokenError, "token required")
-		c.Abort()
-		return
-	}
-	if !mysql.VerifyUserToken(token) {
-		respJSON(c, common.TokenError, "token invalid")
-		c.Abort()
+	// 依次使用认证链中的认证方式
+	if _, ok := authenticate(c); !ok {
 		return
 	}
 	c.Next()
@@ -375,12 +451,16 @@ func respJSON(c *gin.Context, status int, msg interface{}) {
 	}
 }
 
-// 返回带页号的response 回应，格式为{code: 200, pageNo: 1, pageSize 20, data: {} }
+// 返回带页号的response 回应，格式为{code: 200, pageNo: 1, pageSize 20, totalPage: 2, totalCount: 30, next_cursor: "", data: {} }
+// page为nil时按普通response返回
 func respJSONWithPage(c *gin.Context, status int, page *common.PageDao, msg interface{}) {
 	if status != http.StatusOK {
 		c.JSON(status, gin.H{"code": status, "message": msg})
+	} else if page == nil {
+		c.JSON(status, gin.H{"code": status, "data": msg})
 	} else {
-		c.JSON(status, gin.H{"code": status, "pageNo": page.PageNo, "pageSize": page.PageSize, "totalPage": page.TotalPages, "data": msg})
+		c.JSON(status, gin.H{"code": status, "pageNo": page.PageNo, "pageSize": page.PageSize, "totalPage": page.TotalPages,
+			"totalCount": page.TotalCount, "next_cursor": page.NextCursor, "data": msg})
 	}
 }
 
@@ -397,7 +477,44 @@ func apiCommonFunc(c *gin.Context, mdbFunc func(c *gin.Context) (int, interface{
 			respJSON(c, status, result)
 		},
 		Catch: func(e exception.Exception) {
-			respJSON(c, http.StatusBadRequest, e.Msg)
+			respJSON(c, exceptionStatus(e), e.Msg)
+		},
+	}.Run()
+}
+
+/******************************************************************************
+ * function: exceptionStatus
+ * description: 异常对应的http状态, 已经是4xx的保持不变, 解析请求失败返回400,
+ * 其他异常是服务内部错误, 返回500
+ * param {exception.Exception} e
+ * return {*}
+********************************************************************************/
+func exceptionStatus(e exception.Exception) int {
+	switch {
+	case e.Code >= http.StatusBadRequest && e.Code < http.StatusInternalServerError:
+		return e.Code
+	case e.Code == common.JsonError || e.Code == common.ParamError || e.Code == http.StatusAccepted:
+		// DecodeFromGin解析请求失败时抛出
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+/******************************************************************************
+ * function: apiPageFunc
+ * description: define a common function for api which support page query
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func apiPageFunc(c *gin.Context, mdbFunc func(c *gin.Context, page *common.PageDao) (int, interface{})) {
+	exception.TryEx{
+		Try: func() {
+			page := getPageDaoFromGin(c)
+			status, result := mdbFunc(c, page)
+			respJSONWithPage(c, status, page, result)
+		},
+		Catch: func(e exception.Exception) {
+			respJSON(c, exceptionStatus(e), e.Msg)
 		},
 	}.Run()
 }
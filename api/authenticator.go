@@ -0,0 +1,198 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// api key放在请求头中
+const apiKeyHeader = "X-Api-Key"
+
+// api key请求的缺省时间窗口, 单位秒
+const apiKeyRateWindow = 60
+
+// 校验通过的api key保存在context中, 限流和认证只查询一次
+const apiKeyContextKey = "auth_api_key"
+
+// Principal 认证通过的调用者, 用户token时ApiKey为nil, api key时UserId为0
+type Principal struct {
+	UserId int64
+	ApiKey *mysql.ApiKey
+}
+
+type Authenticator interface {
+	// Match 请求是否携带了此类凭证
+	Match(c *gin.Context) bool
+	// Authenticate 校验凭证, 失败时返回错误码和说明
+	Authenticate(c *gin.Context) (*Principal, int, string)
+}
+
+// 认证链, 用户token放在最后, 没有其他凭证时使用
+var authenticators = []Authenticator{&apiKeyAuthenticator{}, &userTokenAuthenticator{}}
+
+// RegisterAuthenticator 在认证链前面加入新的认证方式
+func RegisterAuthenticator(a Authenticator) {
+	authenticators = append([]Authenticator{a}, authenticators...)
+}
+
+/******************************************************************************
+ * function: authenticate
+ * description: 依次使用认证链中的认证方式, 结果保存在context中, 失败时返回错误并中止请求
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func authenticate(c *gin.Context) (*Principal, bool) {
+	if v, ok := c.Get(common.AuthPrincipalKey); ok {
+		return v.(*Principal), true
+	}
+	for _, a := range authenticators {
+		if !a.Match(c) {
+			continue
+		}
+		principal, code, msg := a.Authenticate(c)
+		if principal == nil {
+			// 限流等情况认证方式已经写了回应
+			if !c.IsAborted() {
+				respJSON(c, code, msg)
+				c.Abort()
+			}
+			return nil, false
+		}
+		c.Set(common.AuthPrincipalKey, principal)
+		if principal.UserId > 0 {
+			c.Set(common.AuthUserIdKey, principal.UserId)
+		}
+		return principal, true
+	}
+	respJSON(c, common.TokenError, "token required")
+	c.Abort()
+	return nil, false
+}
+
+// userTokenAuthenticator 用户登录后的token
+type userTokenAuthenticator struct{}
+
+func (a *userTokenAuthenticator) Match(c *gin.Context) bool {
+	return mysql.GetRequestToken(c) != ""
+}
+
+func (a *userTokenAuthenticator) Authenticate(c *gin.Context) (*Principal, int, string) {
+	userToken, ok := mysql.ParseUserToken(mysql.GetRequestToken(c))
+	if !ok {
+		return nil, common.TokenError, "token invalid"
+	}
+	return &Principal{UserId: userToken.UserID}, common.Success, ""
+}
+
+// 各接口api key需要的授权范围, 不在表中的接口不能使用api key访问
+var apiKeyRouteScopes = map[string]string{
+	"/device/queryHeartRate":         mysql.ScopeVitalsRead,
+	"/device/statsHeartRateByMinute": mysql.ScopeVitalsRead,
+	"/device/queryX1RealDataJson":    mysql.ScopeVitalsRead,
+	"/device/queryFallCheckStatus":   mysql.ScopeVitalsRead,
+	"/h03/queryH03LatestAttrs":       mysql.ScopeVitalsRead,
+	"/h03/queryH03LatestStudyStatus": mysql.ScopeVitalsRead,
+	"/T1/queryT1LatestAttrs":         mysql.ScopeVitalsRead,
+	"/T1/queryT1LatestStudyStatus":   mysql.ScopeVitalsRead,
+	"/stream/ws":                     mysql.ScopeVitalsRead,
+	"/stream/sse":                    mysql.ScopeVitalsRead,
+
+	"/device/queryX1SleepReportJson":         mysql.ScopeReportsRead,
+	"/device/querySleepReport":               mysql.ScopeReportsRead,
+	"/device/queryDateListInReport":          mysql.ScopeReportsRead,
+	"/h03/queryH03StudyReport":               mysql.ScopeReportsRead,
+	"/h03/queryH03StudyReportByTime":         mysql.ScopeReportsRead,
+	"/h03/queryH03CurrentDayStudyTimeDetail": mysql.ScopeReportsRead,
+	"/h03/queryH03WeekReport":                mysql.ScopeReportsRead,
+	"/T1/queryT1StudyReport":                 mysql.ScopeReportsRead,
+	"/T1/queryT1CurrentDayStudyTimeDetail":   mysql.ScopeReportsRead,
+	"/T1/queryT1WeekReport":                  mysql.ScopeReportsRead,
+
+	"/device/queryAlarmRecord":            mysql.ScopeAlarmsReceive,
+	"/device/queryFallExistRecord":        mysql.ScopeAlarmsReceive,
+	"/h03/queryH03WarningEventStatDaily":  mysql.ScopeAlarmsReceive,
+	"/h03/queryH03WarningEventStatWeekly": mysql.ScopeAlarmsReceive,
+	"/T1/queryT1WarningEventStatDaily":    mysql.ScopeAlarmsReceive,
+	"/T1/queryT1WarningEventStatWeekly":   mysql.ScopeAlarmsReceive,
+	"/alarm/queryActiveAlarms":            mysql.ScopeAlarmsReceive,
+	"/alarm/queryAlarmHistory":            mysql.ScopeAlarmsReceive,
+	"/alarm/queryAlarmStats":              mysql.ScopeAlarmsReceive,
+
+	"/device/askX1RealData":    mysql.ScopeDevicesControl,
+	"/device/askEd713RealData": mysql.ScopeDevicesControl,
+	"/device/sleepX1Switch":    mysql.ScopeDevicesControl,
+	"/h03/askH03Reboot":        mysql.ScopeDevicesControl,
+	"/h03/setH03Param":         mysql.ScopeDevicesControl,
+	"/T1/askT1Reboot":          mysql.ScopeDevicesControl,
+	"/T1/setT1Param":           mysql.ScopeDevicesControl,
+}
+
+// apiKeyAuthenticator 合作机构的api key, 只能访问授权范围内的接口和允许列表中的设备
+type apiKeyAuthenticator struct{}
+
+func (a *apiKeyAuthenticator) Match(c *gin.Context) bool {
+	return c.GetHeader(apiKeyHeader) != ""
+}
+
+// verifiedApiKey 校验请求头中的api key, 校验通过的key保存在context中
+func verifiedApiKey(c *gin.Context) (*mysql.ApiKey, bool) {
+	if v, ok := c.Get(apiKeyContextKey); ok {
+		return v.(*mysql.ApiKey), true
+	}
+	key, ok := mysql.VerifyApiKey(c.GetHeader(apiKeyHeader))
+	if !ok {
+		return nil, false
+	}
+	c.Set(apiKeyContextKey, key)
+	return key, true
+}
+
+func (a *apiKeyAuthenticator) Authenticate(c *gin.Context) (*Principal, int, string) {
+	key, ok := verifiedApiKey(c)
+	if !ok {
+		return nil, common.TokenError, "api key invalid"
+	}
+	route := routePath(c)
+	scope, ok := apiKeyRouteScopes[route]
+	if !ok || !key.HasScope(scope) {
+		mylog.Log.Errorf("api key %d has no scope to %s", key.ID, route)
+		return nil, common.NoPermission, "no permission"
+	}
+	if key.RateLimit > 0 && !allowRequest(c, "apikey", fmt.Sprintf("apikey_%d", key.ID), key.RateLimit, apiKeyRateWindow) {
+		return nil, common.TooFrequent, "reached max request limit"
+	}
+	go mysql.RecordApiKeyUsage(key.ID, route)
+	return &Principal{ApiKey: key}, common.Success, ""
+}
+
+/******************************************************************************
+ * function: checkApiKeyParam
+ * description: api key只能访问允许列表中的设备, 不能访问用户和其他记录
+ * param {*mysql.ApiKey} key
+ * param {resourceParam} p
+ * param {string} value
+ * return {*}
+********************************************************************************/
+func checkApiKeyParam(key *mysql.ApiKey, p resourceParam, value string) bool {
+	if p.Kind == authSkip || value == "" || value == "0" {
+		return true
+	}
+	switch p.Kind {
+	case authDeviceMac, authOwnDeviceMac:
+		return key.AllowMac(value)
+	case authDeviceId, authOwnDeviceId:
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		device := mysql.NewDevice()
+		return device.QueryByID(id) && key.AllowMac(device.Mac)
+	}
+	return false
+}
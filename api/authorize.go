@@ -0,0 +1,528 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 资源参数的校验方式
+const (
+	// 不校验
+	authSkip = iota
+	// 用户id, 必须是调用者本人
+	authSelf
+	// 用户id, 调用者本人或好友
+	authFriend
+	// 用户账号, 必须是调用者本人
+	authAccount
+	// 设备mac, 调用者拥有或被共享
+	authDeviceMac
+	// 设备id, 调用者拥有或被共享
+	authDeviceId
+	// 设备mac, 调用者拥有
+	authOwnDeviceMac
+	// 设备id, 调用者拥有
+	authOwnDeviceId
+	// 表记录id, 记录必须满足owner条件
+	authRow
+)
+
+type resourceParam struct {
+	// query或json body中的参数名
+	Name string
+	Kind int
+	// authRow使用, 记录所在的表
+	Table string
+	// authRow使用, 记录属于调用者的条件, %[1]d为调用者id
+	Owner string
+}
+
+// 不需要token的接口
+var publicRoutes = map[string]bool{
+	"/user/userLogin":          true,
+	"/user/userRegister":       true,
+	"/user/sendSmsCode":        true,
+	"/user/smsLogin":           true,
+	"/user/smsRegister":        true,
+	"/user/resetPasswd":        true,
+	"/user/unlockAccount":      true,
+	"/user/sendEmailCode":      true,
+	"/user/resetPasswdByEmail": true,
+	"/user/refreshToken":       true,
+	"/user/verifyUserToken":    true,
+	"/wx/wxMiniProgramLogin":   true,
+	"/wx/wxPublicSubmit":       true,
+}
+
+// 报警的设备属于调用者, 拥有或被共享
+const alarmOwner = "mac in (select b.mac from " + common.DeviceTbl + " b, " + common.UserDeviceRelationTbl +
+	" c where b.id=c.device_id and c.user_id=%[1]d)"
+
+// 自习室由调用者创建或者调用者是成员
+const roomMemberOwner = "create_id=%[1]d or id in (select room_id from " + common.StudyRoomUserTbl +
+	" where user_id=%[1]d and status=1)"
+
+// 自习室创建人是调用者本人, 或者调用者是该创建人某个自习室的成员
+const roomCreatorOwner = "id=%[1]d or id in (select a.create_id from " + common.StudyRoomTbl + " a, " +
+	common.StudyRoomUserTbl + " b where a.id=b.room_id and a.status=1 and b.status=1 and b.user_id=%[1]d)"
+
+var (
+	roomMemberParam  = resourceParam{Name: "room_id", Kind: authRow, Table: common.StudyRoomTbl, Owner: roomMemberOwner}
+	roomOwnerParam   = resourceParam{Name: "room_id", Kind: authRow, Table: common.StudyRoomTbl, Owner: "create_id=%[1]d"}
+	userDataJobParam = resourceParam{Name: "id", Kind: authRow, Table: common.UserDataJobTbl, Owner: "user_id=%[1]d"}
+)
+
+// 所有接口缺省校验的参数
+var defaultResourceParams = []resourceParam{
+	{Name: "user_id", Kind: authSelf},
+	{Name: "mac", Kind: authDeviceMac},
+	{Name: "device_id", Kind: authDeviceId},
+}
+
+// 各接口额外的或者覆盖缺省的参数校验. 不在publicRoutes中的接口都必须在这里登记,
+// 没有登记的接口一律拒绝; 值为nil的接口只校验缺省参数
+var resourceRules = map[string][]resourceParam{
+	"/notify/queryNotifySettingByType": nil,
+	"/notify/queryAllNotifySetting":    nil,
+	"/notify/notifySetting":            nil,
+	"/notify/queryPreference":          nil,
+	"/notify/updatePreference":         nil,
+	"/notify/inbox":                    nil,
+	"/notify/inbox/unreadCount":        nil,
+	"/notify/inbox/markRead":           nil,
+	"/upload/picture":                  nil,
+	"/upload/video":                    nil,
+	"/upload/voice":                    nil,
+	"/upload/file":                     nil,
+
+	"/device/queryById":               {{Name: "id", Kind: authDeviceId}},
+	"/device/queryByUser":             nil,
+	"/device/queryHeartRate":          nil,
+	"/device/statsHeartRateByMinute":  nil,
+	"/device/queryX1RealDataJson":     nil,
+	"/device/queryX1SleepReportJson":  nil,
+	"/device/querySleepReport":        nil,
+	"/device/queryDateListInReport":   nil,
+	"/device/queryFallCheckStatus":    nil,
+	"/device/queryAlarmRecord":        nil,
+	"/device/queryFallExistRecord":    nil,
+	"/device/queryFallParams":         nil,
+	"/device/insertFallParams":        nil,
+	"/device/queryLampRealData":       nil,
+	"/device/queryLampEvent":          nil,
+	"/device/queryLampControl":        nil,
+	"/device/queryLampReportStatus":   nil,
+	"/device/statsLampFlowData":       nil,
+	"/device/queryShareUsers":         nil,
+	"/device/queryTransferUsers":      nil,
+	"/device/queryDeviceOverview":     nil,
+	"/device/updateDeviceOverview":    nil,
+	"/device/openLampRealData":        nil,
+	"/device/controlLamp":             nil,
+	"/device/askEd713RealData":        nil,
+	"/device/askX1RealData":           nil,
+	"/device/cleanX1Event":            nil,
+	"/device/sleepX1Switch":           nil,
+	"/device/improveDisturbed":        nil,
+	"/device/recoverX1SleepReport":    nil,
+	"/device/queryStudyRoom":          nil,
+	"/device/queryInviteStudyRoom":    nil,
+	"/device/queryRankingByStudyRoom": {roomMemberParam},
+	// 检查mac是否已被绑定, 此时设备还不属于调用者
+	"/device/queryBindByMac": {{Name: "mac", Kind: authSkip}},
+	"/device/insert":         {{Name: "mac", Kind: authSkip}},
+	"/device/update":         {{Name: "id", Kind: authOwnDeviceId}, {Name: "mac", Kind: authOwnDeviceMac}},
+	"/device/share":          {{Name: "from_user_id", Kind: authSelf}, {Name: "device_id", Kind: authOwnDeviceId}},
+	"/device/shareDeviceToPhoneWithMac": {
+		{Name: "from_user_id", Kind: authSelf}, {Name: "mac", Kind: authOwnDeviceMac}},
+	"/device/transferDeviceToPhoneWithMac": {
+		{Name: "from_user_id", Kind: authSelf}, {Name: "mac", Kind: authOwnDeviceMac}},
+	// 确认时设备还没有共享或过户给调用者, 由接口检查是否有待确认的记录
+	"/device/confirmSharedDevice":             {{Name: "device_id", Kind: authSkip}},
+	"/device/confirmTransferDevice":           {{Name: "device_id", Kind: authSkip}},
+	"/device/queryUnconfirmedShareDevices":    {{Name: "mac", Kind: authSkip}},
+	"/device/queryUnconfirmedTransferDevices": {{Name: "mac", Kind: authSkip}},
+	"/device/removeSharedDevice": {{Name: "share_id", Kind: authRow, Table: common.UserShareDeviceTbl,
+		Owner: "from_user_id=%[1]d or to_user_id=%[1]d"}},
+	"/device/modifySharedDeviceRemark": {{Name: "share_id", Kind: authRow, Table: common.UserShareDeviceTbl,
+		Owner: "from_user_id=%[1]d or to_user_id=%[1]d"}},
+	"/device/createStudyRoom":  {{Name: "create_id", Kind: authSelf}},
+	"/device/modifyStudyRoom":  {roomOwnerParam},
+	"/device/releaseStudyRoom": {{Name: "create_id", Kind: authSelf}, roomOwnerParam},
+
+	"/h03/askH03SyncVersion":                 nil,
+	"/h03/askH03Reboot":                      nil,
+	"/h03/setH03Param":                       nil,
+	"/h03/setH03ReportSwitch":                nil,
+	"/h03/queryH03Version":                   nil,
+	"/h03/queryH03LatestAttrs":               nil,
+	"/h03/queryH03LatestStudyStatus":         nil,
+	"/h03/queryH03CurDayFocusStatus":         nil,
+	"/h03/queryH03StudyReport":               nil,
+	"/h03/queryH03StudyReportByTime":         nil,
+	"/h03/queryH03ReportSwitch":              nil,
+	"/h03/queryH03CurrentDayStudyTimeDetail": nil,
+	"/h03/queryH03WeekReport":                nil,
+	"/h03/queryH03WarningEventStatDaily":     nil,
+	"/h03/queryH03WarningEventStatWeekly":    nil,
+
+	"/T1/askT1SyncVersion":                 nil,
+	"/T1/askT1Reboot":                      nil,
+	"/T1/setT1Param":                       nil,
+	"/T1/setT1ReportSwitch":                nil,
+	"/T1/queryT1Version":                   nil,
+	"/T1/queryT1LatestAttrs":               nil,
+	"/T1/queryT1LatestStudyStatus":         nil,
+	"/T1/queryT1CurDayFocusStatus":         nil,
+	"/T1/queryT1StudyReport":               nil,
+	"/T1/queryT1ReportSwitch":              nil,
+	"/T1/queryT1CurrentDayStudyTimeDetail": nil,
+	"/T1/queryT1WeekReport":                nil,
+	"/T1/queryT1WarningEventStatDaily":     nil,
+	"/T1/queryT1WarningEventStatWeekly":    nil,
+
+	// 实时数据的设备由接口按mac逐个校验, 长连接期间定时重新校验
+	"/stream/ws":  nil,
+	"/stream/sse": nil,
+
+	// 报警的设备必须属于调用者
+	"/alarm/queryActiveAlarms": nil,
+	"/alarm/queryAlarmHistory": nil,
+	"/alarm/queryAlarmStats":   nil,
+	"/alarm/ackAlarm":          {{Name: "alarm_id", Kind: authRow, Table: common.AlarmTbl, Owner: alarmOwner}},
+	"/alarm/resolveAlarm":      {{Name: "alarm_id", Kind: authRow, Table: common.AlarmTbl, Owner: alarmOwner}},
+
+	// 紧急联系人必须属于调用者
+	"/contact/queryContacts":  nil,
+	"/contact/addContact":     {{Name: "id", Kind: authSkip}},
+	"/contact/updateContact":  {{Name: "id", Kind: authRow, Table: common.EmergencyContactTbl, Owner: "user_id=%[1]d"}},
+	"/contact/deleteContact":  {{Name: "id", Kind: authRow, Table: common.EmergencyContactTbl, Owner: "user_id=%[1]d"}},
+	"/contact/sendVerifyCode": {{Name: "id", Kind: authRow, Table: common.EmergencyContactTbl, Owner: "user_id=%[1]d"}},
+	"/contact/verifyPhone":    {{Name: "id", Kind: authRow, Table: common.EmergencyContactTbl, Owner: "user_id=%[1]d"}},
+	"/contact/sendEmailCode":  {{Name: "id", Kind: authRow, Table: common.EmergencyContactTbl, Owner: "user_id=%[1]d"}},
+	"/contact/verifyEmail":    {{Name: "id", Kind: authRow, Table: common.EmergencyContactTbl, Owner: "user_id=%[1]d"}},
+
+	// 指标规则必须属于调用者
+	"/rule/queryRules":   nil,
+	"/rule/queryMetrics": nil,
+	"/rule/addRule":      {{Name: "id", Kind: authSkip}},
+	"/rule/updateRule":   {{Name: "id", Kind: authRow, Table: common.MetricRuleTbl, Owner: "user_id=%[1]d"}},
+	"/rule/deleteRule":   {{Name: "id", Kind: authRow, Table: common.MetricRuleTbl, Owner: "user_id=%[1]d"}},
+
+	"/user/queryById": {{Name: "id", Kind: authFriend}},
+	// 只能查到调用者本人, 管理员可以查询所有用户, 由接口检查
+	"/user/queryUserByPhone":    nil,
+	"/user/queryUserByEmail":    nil,
+	"/user/queryUserGroup":      nil,
+	"/user/queryFriendsByUser":  nil,
+	"/user/queryUserOverview":   nil,
+	"/user/updateUserOverview":  nil,
+	"/user/verifyEmail":         nil,
+	"/user/loginout":            {{Name: "id", Kind: authSelf}},
+	"/user/deleteUser":          {{Name: "id", Kind: authSelf}},
+	"/user/online":              {{Name: "id", Kind: authSelf}, {Name: "account", Kind: authAccount}},
+	"/user/offline":             {{Name: "id", Kind: authSelf}, {Name: "account", Kind: authAccount}},
+	"/user/update":              {{Name: "id", Kind: authSelf}, {Name: "account", Kind: authAccount}},
+	"/user/updateNickName":      nil,
+	"/user/updateGender":        nil,
+	"/user/updateHeadPic":       nil,
+	"/user/modifyPhone":         nil,
+	"/user/modifyEmergentPhone": nil,
+	"/user/modifyEmail":         nil,
+	"/user/modifyLocale":        nil,
+	"/user/modifyPasswd":        nil,
+	"/user/insertGroup":         {{Name: "id", Kind: authSkip}},
+	"/user/deleteGroup":         {{Name: "id", Kind: authRow, Table: common.UserGroupTbl, Owner: "user_id=%[1]d"}},
+	"/user/insertUserFriend":    nil,
+	"/user/removeUserFriend":    nil,
+	"/user/modifyUserFriend":    {{Name: "friend_id", Kind: authFriend}},
+	"/user/removeUserDevice":    {{Name: "id", Kind: authSkip}},
+	"/user/querySessions":       nil,
+	"/user/revokeSession":       nil,
+	// 导出和删除任务属于调用者
+	"/user/exportUserData":   {{Name: "id", Kind: authSelf}},
+	"/user/eraseUserData":    {{Name: "id", Kind: authSelf}},
+	"/user/queryUserDataJob": {userDataJobParam},
+	"/user/downloadUserData": {userDataJobParam},
+	// 自习室成员和好友的学习数据
+	"/user/queryLampUserInFriend":   nil,
+	"/user/queryLampUsersByRoom":    {roomMemberParam},
+	"/user/queryStudyRoomUser":      {roomMemberParam, {Name: "create_id", Kind: authRow, Table: common.UserTbl, Owner: roomCreatorOwner}},
+	"/user/queryUserStudyData":      {{Name: "user_id", Kind: authFriend}, roomMemberParam},
+	"/user/queryUserStudyTimeByDay": {{Name: "user_id", Kind: authFriend}, roomMemberParam},
+	"/user/enterStudyRoom":          {roomMemberParam},
+	"/user/leaveStudyRoom":          {roomMemberParam},
+	// user_id为被邀请的好友
+	"/user/addUserToStudyRoom":      {{Name: "create_id", Kind: authSelf}, {Name: "user_id", Kind: authFriend}, roomOwnerParam},
+	"/user/removeUserFromStudyRoom": {{Name: "create_id", Kind: authSelf}, {Name: "user_id", Kind: authFriend}, roomOwnerParam},
+}
+
+/******************************************************************************
+ * function: routePath
+ * description: 去掉版本前缀的路由, 如/device/queryById
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func routePath(c *gin.Context) string {
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	return strings.TrimPrefix(path, "/"+cfg.This.Svr.ApiVersion)
+}
+
+/******************************************************************************
+ * function: resourceParamsFor
+ * description: 取得接口需要校验的参数, 接口规则中的同名参数覆盖缺省规则,
+ * 接口没有登记时返回false
+ * param {string} route
+ * return {*}
+********************************************************************************/
+func resourceParamsFor(route string) ([]resourceParam, bool) {
+	rules, ok := resourceRules[route]
+	if !ok {
+		return nil, false
+	}
+	params := make([]resourceParam, 0, len(defaultResourceParams)+len(rules))
+	for _, d := range defaultResourceParams {
+		overridden := false
+		for _, r := range rules {
+			if r.Name == d.Name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			params = append(params, d)
+		}
+	}
+	return append(params, rules...), true
+}
+
+/******************************************************************************
+ * function: requestResourceValues
+ * description: 取得query和json body中的参数值, 包括嵌套的对象和数组, 同名参数的所有值都要校验.
+ * 读取body后恢复, 不影响接口再次解析
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func requestResourceValues(c *gin.Context) map[string][]string {
+	values := make(map[string][]string)
+	if c.Request.Body != nil && strings.Contains(c.ContentType(), "json") {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			mylog.Log.Errorln(err)
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Set(gin.BodyBytesKey, body)
+		var obj interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if decoder.Decode(&obj) == nil {
+			collectJsonValues("", obj, values)
+		}
+	}
+	for k, v := range c.Request.URL.Query() {
+		values[k] = append(values[k], v...)
+	}
+	return values
+}
+
+// collectJsonValues 按字段名收集json中所有的字符串和数字, 数组中的值归到数组的字段名下
+func collectJsonValues(name string, v interface{}, values map[string][]string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			// json绑定结构体时字段名不区分大小写
+			collectJsonValues(strings.ToLower(k), item, values)
+		}
+	case []interface{}:
+		for _, item := range val {
+			collectJsonValues(name, item, values)
+		}
+	case string:
+		if name != "" {
+			values[name] = append(values[name], val)
+		}
+	case json.Number:
+		if name != "" {
+			values[name] = append(values[name], val.String())
+		}
+	}
+}
+
+/******************************************************************************
+ * function: checkResourceParam
+ * description: 检查一个参数值是否允许调用者访问, 空值和0不校验, 由接口自己处理
+ * param {int64} userId
+ * param {resourceParam} p
+ * param {string} value
+ * return {*}
+********************************************************************************/
+func checkResourceParam(userId int64, p resourceParam, value string) bool {
+	if p.Kind == authSkip || value == "" {
+		return true
+	}
+	switch p.Kind {
+	case authDeviceMac, authOwnDeviceMac:
+		flag, ok := mysql.QueryUserDeviceFlag(userId, 0, value)
+		return ok && (p.Kind == authDeviceMac || flag == common.NormalDeviceFlag)
+	case authAccount:
+		user := mysql.NewUser()
+		return user.QueryByID(userId) && user.Account == value
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+	if id == 0 {
+		return true
+	}
+	switch p.Kind {
+	case authSelf:
+		return id == userId
+	case authFriend:
+		if id == userId {
+			return true
+		}
+		count, _ := mysql.CountTableByFilter(common.FriendsTbl, fmt.Sprintf("user_id=%d and friend_id=%d", userId, id))
+		return count > 0
+	case authDeviceId, authOwnDeviceId:
+		flag, ok := mysql.QueryUserDeviceFlag(userId, id, "")
+		return ok && (p.Kind == authDeviceId || flag == common.NormalDeviceFlag)
+	case authRow:
+		filter := fmt.Sprintf("id=%d and (%s)", id, fmt.Sprintf(p.Owner, userId))
+		count, _ := mysql.CountTableByFilter(p.Table, filter)
+		return count > 0
+	}
+	return false
+}
+
+/******************************************************************************
+ * function: authUserId
+ * description: 取得调用者的用户id, 凭证无效或者不是用户时返回错误并中止请求
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func authUserId(c *gin.Context) (int64, bool) {
+	principal, ok := authenticate(c)
+	if !ok {
+		return 0, false
+	}
+	if principal.UserId == 0 {
+		respJSON(c, common.NoPermission, "no permission")
+		c.Abort()
+		return 0, false
+	}
+	return principal.UserId, true
+}
+
+/******************************************************************************
+ * function: AuthorizeResource
+ * description: 资源级鉴权拦截器, 用于用户和设备相关的接口.
+ * 先由认证链取得调用者, 再检查请求参数中的用户和设备是否属于调用者,
+ * api key检查设备是否在允许列表中. 没有登记规则的接口拒绝访问,
+ * 用户的写请求完成后记录写入, 用于从库的写后读
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AuthorizeResource(c *gin.Context) {
+	route := routePath(c)
+	if publicRoutes[route] {
+		c.Next()
+		return
+	}
+	principal, ok := authenticate(c)
+	if !ok {
+		return
+	}
+	params, ok := resourceParamsFor(route)
+	if !ok {
+		mylog.Log.Errorf("route %s has no resource rule", route)
+		respJSON(c, common.NoPermission, "no permission")
+		c.Abort()
+		return
+	}
+	values := requestResourceValues(c)
+	for _, p := range params {
+		for _, v := range values[p.Name] {
+			if principal.ApiKey != nil {
+				if !checkApiKeyParam(principal.ApiKey, p, v) {
+					mylog.Log.Errorf("api key %d has no permission to %s %s=%s", principal.ApiKey.ID, route, p.Name, v)
+					respJSON(c, common.NoPermission, "no permission")
+					c.Abort()
+					return
+				}
+				continue
+			}
+			if !checkResourceParam(principal.UserId, p, v) {
+				mylog.Log.Errorf("user %d has no permission to %s %s=%s", principal.UserId, route, p.Name, v)
+				respJSON(c, common.NoPermission, "no permission")
+				c.Abort()
+				return
+			}
+		}
+	}
+	c.Next()
+	// 用户的写请求之后, 从库延迟窗口内该用户的报表查询读主库
+	if c.Request.Method != http.MethodGet && principal.UserId > 0 {
+		mysql.MarkUserWrite(principal.UserId)
+	}
+}
+
+/******************************************************************************
+ * function: checkPermission
+ * description: 检查调用者的角色是否有指定的权限, 没有权限时返回错误并中止请求
+ * param {*gin.Context} c
+ * param {string} perm
+ * return {*}
+********************************************************************************/
+func checkPermission(c *gin.Context, perm string) bool {
+	userId, ok := authUserId(c)
+	if !ok {
+		return false
+	}
+	role := mysql.QueryUserRole(userId)
+	if !mysql.RoleHasPermission(role, perm) {
+		mylog.Log.Errorf("user %d with role %s has no permission %s", userId, role, perm)
+		respJSON(c, common.NoPermission, "no permission")
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+/******************************************************************************
+ * function: RequirePermission
+ * description: 角色鉴权拦截器, 用于整个路由组
+ * param {string} perm
+ * return {*}
+********************************************************************************/
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checkPermission(c, perm) {
+			c.Next()
+		}
+	}
+}
+
+// withPermission 为单个接口加上角色鉴权
+func withPermission(perm string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checkPermission(c, perm) {
+			handler(c)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResourceParamsFor(t *testing.T) {
+	kinds := func(route string) map[string]int {
+		m := make(map[string]int)
+		params, _ := resourceParamsFor(route)
+		for _, p := range params {
+			m[p.Name] = p.Kind
+		}
+		return m
+	}
+	got := kinds("/h03/queryH03StudyReport")
+	if len(got) != 3 || got["mac"] != authDeviceMac || got["user_id"] != authSelf {
+		t.Errorf("default params: %v", got)
+	}
+	got = kinds("/device/shareDeviceToPhoneWithMac")
+	if got["mac"] != authOwnDeviceMac || got["from_user_id"] != authSelf || got["user_id"] != authSelf {
+		t.Errorf("share params: %v", got)
+	}
+	got = kinds("/device/confirmSharedDevice")
+	if got["device_id"] != authSkip {
+		t.Errorf("confirm params: %v", got)
+	}
+	if _, ok := resourceParamsFor("/device/unknown"); ok {
+		t.Errorf("unregistered route should have no rule")
+	}
+}
+
+// 使用资源鉴权的接口都必须登记规则, 否则上线后一律被拒绝
+func TestResourceRulesCoverRoutes(t *testing.T) {
+	initActions()
+	groups := []map[string]gin.HandlerFunc{getAction, postAction}
+	for _, init := range []func() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc){
+		InitUserActions, InitDeviceActions, InitH03Actions, InitT1Actions,
+		InitStreamActions, InitAlarmActions, InitContactActions, InitRuleActions,
+	} {
+		posts, gets := init()
+		groups = append(groups, posts, gets)
+	}
+	for _, routes := range groups {
+		for route := range routes {
+			if publicRoutes[route] {
+				continue
+			}
+			if _, ok := resourceRules[route]; !ok {
+				t.Errorf("route %s has no resource rule", route)
+			}
+		}
+	}
+	for _, route := range []string{"/user/loginout", "/user/queryUserDataJob"} {
+		if publicRoutes[route] {
+			t.Errorf("route %s should require a token", route)
+		}
+	}
+}
+
+func TestRequestResourceValues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := `{"User_Id": 12, "mac": "AA:BB", "remark": "x", "list": [1, 2], "items": [{"mac": "EE:FF"}], "room": {"room_id": 7}}`
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v2/device/update?mac=CC:DD", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	values := requestResourceValues(c)
+	if len(values["user_id"]) != 1 || values["user_id"][0] != "12" {
+		t.Errorf("user_id = %v", values["user_id"])
+	}
+	macs := values["mac"]
+	sort.Strings(macs)
+	if len(macs) != 3 || macs[0] != "AA:BB" || macs[1] != "CC:DD" || macs[2] != "EE:FF" {
+		t.Errorf("mac = %v", macs)
+	}
+	if len(values["list"]) != 2 || len(values["room_id"]) != 1 || values["room_id"][0] != "7" {
+		t.Errorf("nested values = %v, %v", values["list"], values["room_id"])
+	}
+	// body必须可以再次读取
+	rest, _ := io.ReadAll(c.Request.Body)
+	if string(rest) != body {
+		t.Errorf("body not restored: %s", rest)
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"hjyserver/mdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitContactActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc) {
+	postAction := make(map[string]gin.HandlerFunc)
+	getAction := make(map[string]gin.HandlerFunc)
+
+	getAction["/contact/queryContacts"] = queryContacts
+
+	postAction["/contact/addContact"] = addContact
+	postAction["/contact/updateContact"] = updateContact
+	postAction["/contact/deleteContact"] = deleteContact
+	postAction["/contact/sendVerifyCode"] = sendContactVerifyCode
+	postAction["/contact/verifyPhone"] = verifyContactPhone
+	postAction["/contact/sendEmailCode"] = sendContactEmailCode
+	postAction["/contact/verifyEmail"] = verifyContactEmail
+	return postAction, getAction
+}
+
+// queryContacts godoc
+//
+//	@Summary	queryContacts
+//	@Schemes
+//	@Description	查询用户的紧急联系人, 主联系人在前
+//	@Tags			contact
+//	@Produce		json
+//	@Param			token	query	string	false	"token"
+//	@Param			user_id	query	int		true	"用户id"
+//
+//	@Success		200			{array}	mysql.EmergencyContact
+//	@Router			/contact/queryContacts [get]
+func queryContacts(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryEmergencyContacts)
+}
+
+// addContact godoc
+//
+//	@Summary	addContact
+//	@Schemes
+//	@Description	添加紧急联系人. channels为逗号分隔的通道sms/wx_official/email, sms和wx_official必须填写手机号, email必须填写邮箱.
+//	@Description	open_id由服务端在手机号验证后从该手机号注册账号绑定的微信取得, 客户端填写的无效.
+//	@Description	alarms为关注的报警, 如sleep.3010,fall,vital, 为空时接收所有报警.
+//	@Description	active_start/active_end为接收时段, 格式15:04, 都为空时全天接收. 手机号和邮箱验证后才发送, 第一个联系人自动成为主联系人
+//	@Tags			contact
+//	@Produce		json
+//	@Param			token	query	string					false	"token"
+//	@Param			in		body	mysql.EmergencyContact	true	"联系人"
+//
+//	@Success		200			{object}	mysql.EmergencyContact
+//	@Router			/contact/addContact [post]
+func addContact(c *gin.Context) {
+	apiCommonFunc(c, mdb.AddEmergencyContact)
+}
+
+// updateContact godoc
+//
+//	@Summary	updateContact
+//	@Schemes
+//	@Description	修改紧急联系人, 修改手机号或邮箱后需要重新验证, 设为主联系人时取消其他联系人的主联系人标记.
+//	@Description	主联系人不能直接取消, 需要把其他联系人设为主联系人
+//	@Tags			contact
+//	@Produce		json
+//	@Param			token	query	string					false	"token"
+//	@Param			in		body	mysql.EmergencyContact	true	"联系人, id必填"
+//
+//	@Success		200			{object}	mysql.EmergencyContact
+//	@Router			/contact/updateContact [post]
+func updateContact(c *gin.Context) {
+	apiCommonFunc(c, mdb.UpdateEmergencyContact)
+}
+
+// deleteContact godoc
+//
+//	@Summary	deleteContact
+//	@Schemes
+//	@Description	删除紧急联系人, 删除主联系人时下一个已验证的联系人成为主联系人
+//	@Tags			contact
+//	@Produce		json
+//	@Param			token	query	string			false	"token"
+//	@Param			in		body	mdb.ContactReq	true	"联系人id"
+//
+//	@Success		200			{string}	string	"delete emergency contact success"
+//	@Router			/contact/deleteContact [post]
+func deleteContact(c *gin.Context) {
+	apiCommonFunc(c, mdb.DeleteEmergencyContact)
+}
+
+// sendContactVerifyCode godoc
+//
+//	@Summary	sendContactVerifyCode
+//	@Schemes
+//	@Description	发送验证码到联系人的手机
+//	@Tags			contact
+//	@Produce		json
+//	@Param			token	query	string			false	"token"
+//	@Param			in		body	mdb.ContactReq	true	"联系人id"
+//
+//	@Success		200			{string}	string	"send sms code success"
+//	@Router			/contact/sendVerifyCode [post]
+func sendContactVerifyCode(c *gin.Context) {
+	apiCommonFunc(c, mdb.SendContactVerifyCode)
+}
+
+// verifyContactPhone godoc
+//
+//	@Summary	verifyContactPhone
+//	@Schemes
+//	@Description	校验联系人手机收到的验证码, 成功后可以发送短信, 手机号注册的账号绑定了微信并关注公众号时可以发送公众号消息
+//	@Tags			contact
+//	@Produce		json
+//	@Param			token	query	string			false	"token"
+//	@Param			in		body	mdb.ContactReq	true	"联系人id和验证码"
+//
+//	@Success		200			{object}	mysql.EmergencyContact
+//	@Router			/contact/verifyPhone [post]
+func verifyContactPhone(c *gin.Context) {
+	apiCommonFunc(c, mdb.VerifyContactPhone)
+}
+
+// sendContactEmailCode godoc
+//
+//	@Summary	sendContactEmailCode
+//	@Schemes
+//	@Description	发送验证码到联系人的邮箱
+//	@Tags			contact
+//	@Produce		json
+//	@Param			token	query	string			false	"token"
+//	@Param			in		body	mdb.ContactReq	true	"联系人id"
+//
+//	@Success		200			{string}	string	"send email code success"
+//	@Router			/contact/sendEmailCode [post]
+func sendContactEmailCode(c *gin.Context) {
+	apiCommonFunc(c, mdb.SendContactEmailCode)
+}
+
+// verifyContactEmail godoc
+//
+//	@Summary	verifyContactEmail
+//	@Schemes
+//	@Description	校验联系人邮箱收到的验证码, 成功后可以发送邮件
+//	@Tags			contact
+//	@Produce		json
+//	@Param			token	query	string			false	"token"
+//	@Param			in		body	mdb.ContactReq	true	"联系人id和验证码"
+//
+//	@Success		200			{object}	mysql.EmergencyContact
+//	@Router			/contact/verifyEmail [post]
+func verifyContactEmail(c *gin.Context) {
+	apiCommonFunc(c, mdb.VerifyContactEmail)
+}
@@ -395,19 +395,16 @@ func confirmTransferDevice(c *gin.Context) {
 // @Param begin_day query string false "begin day, format yyyy-MM-dd"
 // @Param end_day query string false "end day, format yyyy-MM-dd"
 //
+// @Param pageNo query int false "page number, start from 1"
+// @Param pageSize query int false "page size, default 10"
+// @Param cursor query string false "keyset cursor, empty for first page, then next_cursor of last page"
+// @Param order query string false "cursor order, asc or desc, default the order of the api"
+// @Param with_total query int false "0: do not count total records"
+//
 //	@Success		200		{object}	mysql.HeartRate
 //	@Router			/device/queryHeartRate [get]
 func queryHeartRate(c *gin.Context) {
-	exception.TryEx{
-		Try: func() {
-			status, result := mdb.QueryHeartRate(c)
-			respJSON(c, status, result)
-		},
-		Catch: func(e exception.Exception) {
-			respJSON(c, e.Code, e.Msg)
-		},
-	}.Run()
-
+	apiPageFunc(c, mdb.QueryHeartRate)
 }
 
 // statsHeartRateByMinute godoc
@@ -522,18 +519,16 @@ func queryFallCheckStatus(c *gin.Context) {
 // @Param begin_day query string false "begin day, format yyyy-MM-dd"
 // @Param end_day query string false "end day, format yyyy-MM-dd"
 //
+// @Param pageNo query int false "page number, start from 1"
+// @Param pageSize query int false "page size, default 10"
+// @Param cursor query string false "keyset cursor, empty for first page, then next_cursor of last page"
+// @Param order query string false "cursor order, asc or desc, default the order of the api"
+// @Param with_total query int false "0: do not count total records"
+//
 //	@Success		200		{object}	mysql.FallAlarm
 //	@Router			/device/queryAlarmRecord [get]
 func queryAlarmRecord(c *gin.Context) {
-	exception.TryEx{
-		Try: func() {
-			status, result := mdb.QueryAlarmRecord(c)
-			respJSON(c, status, result)
-		},
-		Catch: func(e exception.Exception) {
-			respJSON(c, e.Code, e.Msg)
-		},
-	}.Run()
+	apiPageFunc(c, mdb.QueryAlarmRecord)
 }
 
 /******************************************************************************
@@ -671,18 +666,16 @@ func openLampRealData(c *gin.Context) {
 //	@Param			begin_day	query	string	false	"begin day"
 //	@Param			end_day		query	string	false	"end day"
 //
+// @Param pageNo query int false "page number, start from 1"
+// @Param pageSize query int false "page size, default 10"
+// @Param cursor query string false "keyset cursor, empty for first page, then next_cursor of last page"
+// @Param order query string false "cursor order, asc or desc, default the order of the api"
+// @Param with_total query int false "0: do not count total records"
+//
 //	@Success		200			{object} mysql.RealDataSql
 //	@Router			/device/queryLampRealData [get]
 func queryLampRealData(c *gin.Context) {
-	exception.TryEx{
-		Try: func() {
-			status, result := mdb.QueryLampRealData(c)
-			respJSON(c, status, result)
-		},
-		Catch: func(e exception.Exception) {
-			respJSON(c, http.StatusBadRequest, e.Msg)
-		},
-	}.Run()
+	apiPageFunc(c, mdb.QueryLampRealData)
 }
 
 // queryLampReportStatus godoc
@@ -715,18 +708,16 @@ func queryLampReportStatus(c *gin.Context) {
 //	@Param			begin_day	query	string	false	"begin day"
 //	@Param			end_day		query	string	false	"end day"
 //
+// @Param pageNo query int false "page number, start from 1"
+// @Param pageSize query int false "page size, default 10"
+// @Param cursor query string false "keyset cursor, empty for first page, then next_cursor of last page"
+// @Param order query string false "cursor order, asc or desc, default the order of the api"
+// @Param with_total query int false "0: do not count total records"
+//
 //	@Success		200			{object}	mysql.EventReportSql
 //	@Router			/device/queryLampEvent [get]
 func queryLampEvent(c *gin.Context) {
-	exception.TryEx{
-		Try: func() {
-			status, result := mdb.QueryLampEvent(c)
-			respJSON(c, status, result)
-		},
-		Catch: func(e exception.Exception) {
-			respJSON(c, http.StatusBadRequest, e.Msg)
-		},
-	}.Run()
+	apiPageFunc(c, mdb.QueryLampEvent)
 }
 
 // controlLamp godoc
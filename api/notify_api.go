@@ -56,3 +56,84 @@ func queryNotifySettingByType(c *gin.Context) {
 func queryAllNotifySetting(c *gin.Context) {
 	apiCommonFunc(c, mdb.QueryAllNotifySetting)
 }
+
+// queryNotifyPreference godoc
+//
+//	@Summary	queryNotifyPreference
+//	@Schemes
+//	@Description	查询用户的通知偏好, 没有设置时返回缺省值
+//	@Tags			Notify
+//	@Param			token	query	string	false	"token"
+//	@Param			user_id	query	int		true	"用户id"
+//	@Produce		json
+//	@Success		200	{object} mysql.NotifyPreference
+//	@Router			/notify/queryPreference [get]
+func queryNotifyPreference(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryNotifyPreference)
+}
+
+// updateNotifyPreference godoc
+//
+//	@Summary	updateNotifyPreference
+//	@Schemes
+//	@Description	设置用户的通知偏好. quiet_start/quiet_end为免打扰时段, 格式15:04, 配置的严重报警不受免打扰和每日上限限制.
+//	@Description	dedup_window为同一事件和设备的去重窗口(秒), daily_cap为每个通道每天最多条数, 0使用缺省配置.
+//	@Description	digest为1时被拦截的通知在免打扰结束后合并成一条摘要发送, 为0时丢弃
+//	@Tags			Notify
+//	@Param			token	query	string					false	"token"
+//	@Param			in		body	mysql.NotifyPreference	true	"通知偏好"
+//	@Produce		json
+//	@Success		200	{object} mysql.NotifyPreference
+//	@Router			/notify/updatePreference [post]
+func updateNotifyPreference(c *gin.Context) {
+	apiCommonFunc(c, mdb.UpdateNotifyPreference)
+}
+
+// queryInbox godoc
+//
+//	@Summary	queryInbox
+//	@Schemes
+//	@Description	分页查询用户收到的通知, 最新的在前. status 1:发送成功 2:发送失败 3:被免打扰、去重或每日上限拦截
+//	@Tags			Notify
+//	@Param			token		query	string	false	"token"
+//	@Param			user_id		query	int		true	"用户id"
+//	@Param			is_read		query	int		false	"0:未读 1:已读, 不传时查询全部"
+//	@Param			event_type	query	string	false	"事件类型"
+//	@Param			pageNo		query	int		false	"页号"
+//	@Param			pageSize	query	int		false	"每页记录数"
+//	@Produce		json
+//	@Success		200	{array} mysql.NotifyMessage
+//	@Router			/notify/inbox [get]
+func queryInbox(c *gin.Context) {
+	apiPageFunc(c, mdb.QueryInbox)
+}
+
+// queryInboxUnreadCount godoc
+//
+//	@Summary	queryInboxUnreadCount
+//	@Schemes
+//	@Description	查询用户的未读通知数
+//	@Tags			Notify
+//	@Param			token	query	string	false	"token"
+//	@Param			user_id	query	int		true	"用户id"
+//	@Produce		json
+//	@Success		200	{object} mdb.InboxUnread
+//	@Router			/notify/inbox/unreadCount [get]
+func queryInboxUnreadCount(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryInboxUnreadCount)
+}
+
+// markInboxRead godoc
+//
+//	@Summary	markInboxRead
+//	@Schemes
+//	@Description	把用户的通知标记为已读, ids为空时标记所有未读通知, 返回标记后的未读数
+//	@Tags			Notify
+//	@Param			token	query	string				false	"token"
+//	@Param			in		body	mdb.InboxReadReq	true	"用户id和通知id"
+//	@Produce		json
+//	@Success		200	{object} mdb.InboxUnread
+//	@Router			/notify/inbox/markRead [post]
+func markInboxRead(c *gin.Context) {
+	apiCommonFunc(c, mdb.MarkInboxRead)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/redis"
+
+	"github.com/didip/tollbooth"
+	"github.com/didip/tollbooth_gin"
+	"github.com/gin-gonic/gin"
+)
+
+/******************************************************************************
+ * function: rateLimitHandler
+ * description: 配置启用时使用redis计数的限流, 否则使用进程内按IP的限流
+ * return {*}
+********************************************************************************/
+func rateLimitHandler() gin.HandlerFunc {
+	if cfg.This.RateLimit.Enable {
+		return RateLimit
+	}
+	limt := tollbooth.NewLimiter(100, nil)
+	limt.SetIPLookups([]string{"RemoteAddr", "X-Forwarded-For", "X-Real-IP"}).SetMethods([]string{"GET", "POST"})
+	limt.SetMessage("{ \"code\": 201, \"message\": \"reached max request limit\"}")
+	return tollbooth_gin.LimitHandler(limt)
+}
+
+// rateLimitFor 匹配最长前缀的规则, 没有匹配时使用缺省限额, 缺省规则的前缀为空
+func rateLimitFor(route string) cfg.RateLimitRule {
+	rule := cfg.RateLimitRule{Prefix: "", Limit: cfg.This.RateLimit.Limit, Window: cfg.This.RateLimit.Window}
+	for _, v := range cfg.This.RateLimit.Rules {
+		if v.Prefix != "" && strings.HasPrefix(route, v.Prefix) && len(v.Prefix) > len(rule.Prefix) {
+			rule = v
+		}
+	}
+	if rule.Window <= 0 {
+		rule.Window = 60
+	}
+	return rule
+}
+
+// rateLimitSubject 有效token按用户计数, 同一个学校的自习室共用一个IP也不会互相影响,
+// api key校验通过后才按key计数, 无效的key按IP计数
+func rateLimitSubject(c *gin.Context) string {
+	if c.GetHeader(apiKeyHeader) != "" {
+		if key, ok := verifiedApiKey(c); ok {
+			return fmt.Sprintf("apikey_%d", key.ID)
+		}
+		return "ip_" + c.ClientIP()
+	}
+	if v, ok := c.Get(common.AuthUserIdKey); ok {
+		return fmt.Sprintf("user_%d", v.(int64))
+	}
+	if token := mysql.GetRequestToken(c); token != "" {
+		if userToken, ok := mysql.ParseUserToken(token); ok {
+			c.Set(common.AuthUserIdKey, userToken.UserID)
+			return fmt.Sprintf("user_%d", userToken.UserID)
+		}
+	}
+	return "ip_" + c.ClientIP()
+}
+
+/******************************************************************************
+ * function: RateLimit
+ * description: 按路由前缀规则限流的拦截器
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func RateLimit(c *gin.Context) {
+	rule := rateLimitFor(routePath(c))
+	group := rule.Prefix
+	if group == "" {
+		group = "default"
+	}
+	if !allowRequest(c, group, rateLimitSubject(c), rule.Limit, rule.Window) {
+		return
+	}
+	c.Next()
+}
+
+/******************************************************************************
+ * function: allowRequest
+ * description: 固定窗口计数, 返回RateLimit-Limit/Remaining/Reset头,
+ * 超过限额时返回429和Retry-After并中止请求, redis不可用时不限流
+ * param {*gin.Context} c
+ * param {string} group 计数分组
+ * param {string} subject 计数对象, 用户、IP或api key
+ * param {int} limit 时间窗口内最多请求数, 0不限流
+ * param {int} windowSeconds
+ * return {*}
+********************************************************************************/
+func allowRequest(c *gin.Context, group string, subject string, limit int, windowSeconds int) bool {
+	if limit <= 0 {
+		return true
+	}
+	if windowSeconds <= 0 {
+		windowSeconds = 60
+	}
+	now := time.Now().Unix()
+	window := int64(windowSeconds)
+	start := now - now%window
+	reset := start + window - now
+	key := fmt.Sprintf("rate_limit_%s_%s_%d", group, subject, start)
+	n, err := redis.IncrValueEx(key, windowSeconds)
+	if err != nil {
+		mylog.Log.Errorln("rate limit error:", err)
+		return true
+	}
+	remaining := int64(limit) - n
+	if remaining < 0 {
+		remaining = 0
+	}
+	c.Header("RateLimit-Limit", strconv.Itoa(limit))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	c.Header("RateLimit-Reset", strconv.FormatInt(reset, 10))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit, windowSeconds))
+	if n > int64(limit) {
+		c.Header("Retry-After", strconv.FormatInt(reset, 10))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"code": common.TooFrequent, "message": "reached max request limit"})
+		return false
+	}
+	return true
+}
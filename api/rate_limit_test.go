@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hjyserver/cfg"
+	"hjyserver/mdb/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitFor(t *testing.T) {
+	cfg.This = new(cfg.Cfg)
+	cfg.This.RateLimit = cfg.RateLimitCfg{
+		Enable: true,
+		Limit:  600,
+		Window: 60,
+		Rules: []cfg.RateLimitRule{
+			{Prefix: "/upload/", Limit: 20, Window: 60},
+			{Prefix: "/user/", Limit: 100},
+			{Prefix: "/user/userLogin", Limit: 10, Window: 300},
+		},
+	}
+	cases := []struct {
+		route  string
+		prefix string
+		limit  int
+		window int
+	}{
+		{"/upload/picture", "/upload/", 20, 60},
+		{"/user/userLogin", "/user/userLogin", 10, 300},
+		{"/user/queryById", "/user/", 100, 60},
+		{"/device/queryById", "", 600, 60},
+	}
+	for _, v := range cases {
+		rule := rateLimitFor(v.route)
+		if rule.Prefix != v.prefix || rule.Limit != v.limit || rule.Window != v.window {
+			t.Errorf("rateLimitFor(%s) = %+v", v.route, rule)
+		}
+	}
+}
+
+func TestRateLimitSubjectApiKey(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/v2/device/queryHeartRate", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Request.Header.Set(apiKeyHeader, "not-a-valid-key")
+	if s := rateLimitSubject(c); s != "ip_10.0.0.1" {
+		t.Errorf("unverified api key should use ip bucket, got %s", s)
+	}
+	c.Set(apiKeyContextKey, &mysql.ApiKey{ID: 5})
+	if s := rateLimitSubject(c); s != "apikey_5" {
+		t.Errorf("verified api key should use key bucket, got %s", s)
+	}
+}
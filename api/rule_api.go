@@ -0,0 +1,104 @@
+package api
+
+import (
+	"hjyserver/mdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitRuleActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc) {
+	postAction := make(map[string]gin.HandlerFunc)
+	getAction := make(map[string]gin.HandlerFunc)
+
+	getAction["/rule/queryRules"] = queryRules
+	getAction["/rule/queryMetrics"] = queryRuleMetrics
+
+	postAction["/rule/addRule"] = addRule
+	postAction["/rule/updateRule"] = updateRule
+	postAction["/rule/deleteRule"] = deleteRule
+	return postAction, getAction
+}
+
+// queryRules godoc
+//
+//	@Summary	queryRules
+//	@Schemes
+//	@Description	查询用户定义的指标规则, 可以按设备过滤
+//	@Tags			rule
+//	@Produce		json
+//	@Param			token	query	string	false	"token"
+//	@Param			user_id	query	int		true	"用户id"
+//	@Param			mac		query	string	false	"设备mac"
+//
+//	@Success		200			{array}	mysql.MetricRule
+//	@Router			/rule/queryRules [get]
+func queryRules(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryMetricRules)
+}
+
+// queryRuleMetrics godoc
+//
+//	@Summary	queryRuleMetrics
+//	@Schemes
+//	@Description	查询设备可以定义规则的指标
+//	@Tags			rule
+//	@Produce		json
+//	@Param			token	query	string	false	"token"
+//	@Param			mac		query	string	true	"设备mac"
+//
+//	@Success		200			{object}	mdb.RuleMetricsResp
+//	@Router			/rule/queryMetrics [get]
+func queryRuleMetrics(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryRuleMetrics)
+}
+
+// addRule godoc
+//
+//	@Summary	addRule
+//	@Schemes
+//	@Description	添加指标规则, 设备上报数据时判断, 条件持续sustain分钟后执行动作.
+//	@Description	operator为gt/ge/lt/le/eq/ne/between/outside, between和outside使用value和value2.
+//	@Description	actions为逗号分隔的动作notify/webhook/command, command时填写command和command_params, 只有设备的拥有者可以使用command.
+//	@Description	active_start/active_end为生效时段, 格式15:04, 都为空时全天生效. 条件一直满足时每cooldown分钟触发一次
+//	@Tags			rule
+//	@Produce		json
+//	@Param			token	query	string				false	"token"
+//	@Param			in		body	mysql.MetricRule	true	"规则"
+//
+//	@Success		200			{object}	mysql.MetricRule
+//	@Router			/rule/addRule [post]
+func addRule(c *gin.Context) {
+	apiCommonFunc(c, mdb.AddMetricRule)
+}
+
+// updateRule godoc
+//
+//	@Summary	updateRule
+//	@Schemes
+//	@Description	修改指标规则, 规则的用户和设备不能修改, 只有设备的拥有者可以使用command. 解除共享、移除和过户设备时删除不能再使用设备的用户的规则
+//	@Tags			rule
+//	@Produce		json
+//	@Param			token	query	string				false	"token"
+//	@Param			in		body	mysql.MetricRule	true	"规则, id必填"
+//
+//	@Success		200			{object}	mysql.MetricRule
+//	@Router			/rule/updateRule [post]
+func updateRule(c *gin.Context) {
+	apiCommonFunc(c, mdb.UpdateMetricRule)
+}
+
+// deleteRule godoc
+//
+//	@Summary	deleteRule
+//	@Schemes
+//	@Description	删除指标规则
+//	@Tags			rule
+//	@Produce		json
+//	@Param			token	query	string				false	"token"
+//	@Param			in		body	mdb.MetricRuleReq	true	"规则id"
+//
+//	@Success		200			{string}	string	"delete metric rule success"
+//	@Router			/rule/deleteRule [post]
+func deleteRule(c *gin.Context) {
+	apiCommonFunc(c, mdb.DeleteMetricRule)
+}
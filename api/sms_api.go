@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	mylog "hjyserver/log"
+	"hjyserver/sms"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitSmsActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc) {
+	postAction := make(map[string]gin.HandlerFunc)
+	getAction := make(map[string]gin.HandlerFunc)
+
+	postAction["/sms/report/:provider"] = smsReport
+	return postAction, getAction
+}
+
+// smsReport godoc
+//
+//	@Summary	smsReport
+//	@Schemes
+//	@Description	短信供应商推送的发送回执, 阿里云推送地址需要带配置的token, http供应商按X-Twilio-Signature签名校验.
+//	@Description	返回{"code":0}表示接收成功
+//	@Tags			Sms
+//	@Param			provider	path	string	true	"供应商 aliyun/http/mock"
+//	@Param			token		query	string	false	"阿里云回执的token"
+//	@Accept			json,x-www-form-urlencoded
+//	@Produce		json
+//	@Success		200
+//	@Router			/sms/report/{provider} [post]
+func smsReport(c *gin.Context) {
+	provider := c.Param("provider")
+	n, err := sms.HandleReport(provider, c.Request)
+	if err != nil {
+		mylog.Log.Errorf("sms report of %s error, %v", provider, err)
+		status := http.StatusBadRequest
+		if err == sms.ErrReportSign {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"code": status, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "count": n})
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 一个连接最多订阅的设备数
+const streamMaxMacs = 20
+
+// 心跳间隔, 防止代理因空闲断开连接
+const streamPingInterval = 30 * time.Second
+
+const streamWriteWait = 10 * time.Second
+
+// 重新鉴权的间隔, token过期、会话注销或者取消共享后关闭连接
+const streamReauthInterval = time.Minute
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// app和小程序不带Origin, 鉴权由token完成
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func InitStreamActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc) {
+	getAction := make(map[string]gin.HandlerFunc)
+	getAction["/stream/ws"] = streamWebSocket
+	getAction["/stream/sse"] = streamSse
+	return nil, getAction
+}
+
+// streamMacs 取得要订阅的设备, 检查推送服务是否启动
+func streamMacs(c *gin.Context) ([]string, bool) {
+	if !stream.Running() {
+		respJSON(c, common.NoExist, "stream is disabled")
+		return nil, false
+	}
+	macs := c.QueryArray("mac")
+	if len(macs) == 0 || len(macs) > streamMaxMacs {
+		respJSON(c, common.ParamError, fmt.Sprintf("mac count must be 1 to %d", streamMaxMacs))
+		return nil, false
+	}
+	return macs, true
+}
+
+/******************************************************************************
+ * function: streamAuthorized
+ * description: 长连接定时重新检查token或api key, 以及每个设备的访问权限, 不使用请求上下文中缓存的结果
+ * param {*gin.Context} c
+ * param {[]string} macs
+ * return {*}
+********************************************************************************/
+func streamAuthorized(c *gin.Context, macs []string) bool {
+	p := resourceParam{Name: "mac", Kind: authDeviceMac}
+	if header := c.GetHeader(apiKeyHeader); header != "" {
+		key, ok := mysql.VerifyApiKey(header)
+		if !ok || !key.HasScope(apiKeyRouteScopes[routePath(c)]) {
+			return false
+		}
+		for _, mac := range macs {
+			if !checkApiKeyParam(key, p, mac) {
+				return false
+			}
+		}
+		return true
+	}
+	userToken, ok := mysql.ParseUserToken(mysql.GetRequestToken(c))
+	if !ok {
+		return false
+	}
+	for _, mac := range macs {
+		if !checkResourceParam(userToken.UserID, p, mac) {
+			return false
+		}
+	}
+	return true
+}
+
+// streamWebSocket godoc
+//
+//	@Summary	streamWebSocket
+//	@Schemes
+//	@Description	subscribe real time data of devices by websocket, each message is stream.Message,
+//	@Description	mac can be repeated up to 20 times, the caller must be able to access every device.
+//	@Description	access is checked again every minute, the connection is closed when the token expires,
+//	@Description	the session is revoked or a device is no longer shared, the client should refresh the token and reconnect
+//	@Tags			Stream
+//	@Param			token	query	string		false	"token"
+//	@Param			mac		query	[]string	true	"device mac"	collectionFormat(multi)
+//	@Produce		json
+//	@Success		101	{object}	stream.Message
+//	@Router			/stream/ws [get]
+func streamWebSocket(c *gin.Context) {
+	macs, ok := streamMacs(c)
+	if !ok {
+		return
+	}
+	conn, err := streamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		mylog.Log.Errorln("stream websocket upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+	sub := stream.Subscribe(macs)
+	defer stream.Unsubscribe(sub)
+
+	// 读取客户端消息以处理pong和close, 读取出错表示连接已关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * streamPingInterval))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * streamPingInterval))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	reauth := time.NewTicker(streamReauthInterval)
+	defer reauth.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case msg := <-sub.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				mylog.Log.Debugln("stream websocket write error:", err)
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-reauth.C:
+			if !streamAuthorized(c, macs) {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"),
+					time.Now().Add(streamWriteWait))
+				return
+			}
+		}
+	}
+}
+
+// streamSse godoc
+//
+//	@Summary	streamSse
+//	@Schemes
+//	@Description	subscribe real time data of devices by server-sent events, each event data is stream.Message,
+//	@Description	mac can be repeated up to 20 times, the caller must be able to access every device.
+//	@Description	access is checked again every minute, the connection is closed with a revoked event when the token expires,
+//	@Description	the session is revoked or a device is no longer shared, the client should refresh the token and reconnect
+//	@Tags			Stream
+//	@Param			token	query	string		false	"token"
+//	@Param			mac		query	[]string	true	"device mac"	collectionFormat(multi)
+//	@Produce		text/event-stream
+//	@Success		200	{object}	stream.Message
+//	@Router			/stream/sse [get]
+func streamSse(c *gin.Context) {
+	macs, ok := streamMacs(c)
+	if !ok {
+		return
+	}
+	// 长连接不受http server写超时限制
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		mylog.Log.Errorln("stream sse clear write deadline error:", err)
+	}
+	sub := stream.Subscribe(macs)
+	defer stream.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭nginx缓冲
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	reauth := time.NewTicker(streamReauthInterval)
+	defer reauth.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case msg := <-sub.C:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				mylog.Log.Errorln(err)
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-reauth.C:
+			if !streamAuthorized(c, macs) {
+				fmt.Fprint(c.Writer, "event: revoked\ndata: unauthorized\n\n")
+				c.Writer.Flush()
+				return
+			}
+		}
+	}
+}
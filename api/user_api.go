@@ -11,6 +11,7 @@ import (
 	"hjyserver/exception"
 	"hjyserver/mdb"
 	"net/http"
+	"path/filepath"
 
 	"github.com/gin-gonic/gin"
 )
@@ -38,6 +39,16 @@ func InitUserActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc)
 	// post user tag action
 	postAction["/user/userLogin"] = userLogin
 	postAction["/user/userRegister"] = userRegister
+	// 短信验证码登录、注册和重置密码
+	postAction["/user/sendSmsCode"] = sendSmsCode
+	postAction["/user/smsLogin"] = smsLogin
+	postAction["/user/smsRegister"] = smsRegister
+	postAction["/user/resetPasswd"] = resetPasswd
+	postAction["/user/unlockAccount"] = unlockAccount
+	// 邮箱验证码验证邮箱和重置密码
+	postAction["/user/sendEmailCode"] = sendEmailCode
+	postAction["/user/verifyEmail"] = verifyEmail
+	postAction["/user/resetPasswdByEmail"] = resetPasswdByEmail
 	postAction["/user/loginout"] = loginOut
 	postAction["/user/deleteUser"] = deleteUser
 	postAction["/user/online"] = userOnline
@@ -49,6 +60,7 @@ func InitUserActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc)
 	postAction["/user/modifyPhone"] = modifyPhone
 	postAction["/user/modifyEmergentPhone"] = modifyEmergentPhone
 	postAction["/user/modifyEmail"] = modifyEmail
+	postAction["/user/modifyLocale"] = modifyLocale
 	postAction["/user/modifyPasswd"] = modifyPasswd
 	postAction["/user/insertGroup"] = insertUserGroup
 	postAction["/user/deleteGroup"] = deleteUserGroup
@@ -62,6 +74,17 @@ func InitUserActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc)
 	postAction["/user/leaveStudyRoom"] = leaveStudyRoom
 
 	postAction["/user/updateUserOverview"] = updateUserOverview
+
+	// 用户数据导出和删除
+	getAction["/user/queryUserDataJob"] = queryUserDataJob
+	getAction["/user/downloadUserData"] = downloadUserData
+	postAction["/user/exportUserData"] = exportUserData
+	postAction["/user/eraseUserData"] = eraseUserData
+
+	// 登录会话
+	getAction["/user/querySessions"] = querySessions
+	postAction["/user/refreshToken"] = refreshToken
+	postAction["/user/revokeSession"] = revokeSession
 	return postAction, getAction
 }
 
@@ -91,13 +114,16 @@ func verifyUserToken(c *gin.Context) {
 //
 //	@Summary	userLogin
 //	@Schemes
-//	@Description	login in
+//	@Description	login in, 旧的加密密码登录成功时迁移为哈希, 已标记为需要重置的账号返回-46,
+//	@Description	连续失败时需要等待(-47), 失败5次账号锁定30分钟(-48), 可以用短信验证码解锁
 //	@Tags			user
 //	@Produce		json
 //
 //	@Param			in		body	mdb.LoginReq true	"user info"
+//	@Param			X-Device-Id		header	string	false	"客户端设备id, 同一设备重新登录时撤销旧会话"
+//	@Param			X-Device-Name	header	string	false	"客户端设备名称"
 //
-//	@Success		200			{object}	mysql.User
+//	@Success		200			{object}	mdb.LoginResp
 //	@Router			/user/userLogin [post]
 func userLogin(c *gin.Context) {
 	exception.TryEx{
@@ -111,15 +137,145 @@ func userLogin(c *gin.Context) {
 	}.Run()
 }
 
+// sendSmsCode godoc
+//
+//	@Summary	sendSmsCode
+//	@Schemes
+//	@Description	发送短信验证码, 有效期5分钟, 同一手机号60秒内只能发送一次, 手机号是否注册都返回相同的结果
+//	@Tags			user
+//	@Produce		json
+//
+//	@Param			in		body	mdb.SmsCodeReq true	"手机号和用途"
+//
+//	@Success		200			{string}	string	"send sms code success"
+//	@Router			/user/sendSmsCode [post]
+func sendSmsCode(c *gin.Context) {
+	apiCommonFunc(c, mdb.SendSmsCode)
+}
+
+// smsLogin godoc
+//
+//	@Summary	smsLogin
+//	@Schemes
+//	@Description	手机号验证码登录, 和密码登录一样受账号锁定(-48)和IP封禁(-47)限制
+//	@Tags			user
+//	@Produce		json
+//
+//	@Param			in		body	mdb.SmsLoginReq true	"手机号和验证码"
+//	@Param			X-Device-Id		header	string	false	"客户端设备id, 同一设备重新登录时撤销旧会话"
+//	@Param			X-Device-Name	header	string	false	"客户端设备名称"
+//
+//	@Success		200			{object}	mdb.LoginResp
+//	@Router			/user/smsLogin [post]
+func smsLogin(c *gin.Context) {
+	apiCommonFunc(c, mdb.SmsLogin)
+}
+
+// smsRegister godoc
+//
+//	@Summary	smsRegister
+//	@Schemes
+//	@Description	手机号验证码注册, 使用手机号作为账号, 注册成功后直接登录
+//	@Tags			user
+//	@Produce		json
+//
+//	@Param			in		body	mdb.SmsRegisterReq true	"手机号、验证码、昵称和可选的密码"
+//
+//	@Success		200			{object}	mdb.LoginResp
+//	@Router			/user/smsRegister [post]
+func smsRegister(c *gin.Context) {
+	apiCommonFunc(c, mdb.SmsRegister)
+}
+
+// resetPasswd godoc
+//
+//	@Summary	resetPasswd
+//	@Schemes
+//	@Description	手机号验证码重置密码, 重置后所有登录会话失效
+//	@Tags			user
+//	@Produce		json
+//
+//	@Param			in		body	mdb.ResetPasswdReq true	"手机号、验证码和新密码"
+//
+//	@Success		200			{string}	string	"reset password success"
+//	@Router			/user/resetPasswd [post]
+func resetPasswd(c *gin.Context) {
+	apiCommonFunc(c, mdb.ResetPasswd)
+}
+
+// sendEmailCode godoc
+//
+//	@Summary	sendEmailCode
+//	@Schemes
+//	@Description	发送邮箱验证码, 有效期10分钟, 同一邮箱60秒内只能发送一次
+//	@Tags			user
+//	@Produce		json
+//
+//	@Param			in		body	mdb.EmailCodeReq true	"邮箱和用途"
+//
+//	@Success		200			{string}	string	"send email code success"
+//	@Router			/user/sendEmailCode [post]
+func sendEmailCode(c *gin.Context) {
+	apiCommonFunc(c, mdb.SendEmailCode)
+}
+
+// verifyEmail godoc
+//
+//	@Summary	verifyEmail
+//	@Schemes
+//	@Description	验证用户当前的邮箱, 验证后才会发送邮件通知
+//	@Tags			user
+//	@Produce		json
+//	@Param			token	query	string		false	"token"
+//	@Param			in		body	mdb.VerifyEmailReq true	"用户id和验证码"
+//
+//	@Success		200			{object}	mysql.User
+//	@Router			/user/verifyEmail [post]
+func verifyEmail(c *gin.Context) {
+	apiCommonFunc(c, mdb.VerifyEmail)
+}
+
+// resetPasswdByEmail godoc
+//
+//	@Summary	resetPasswdByEmail
+//	@Schemes
+//	@Description	邮箱验证码重置密码, 重置后所有登录会话失效
+//	@Tags			user
+//	@Produce		json
+//
+//	@Param			in		body	mdb.ResetPasswdByEmailReq true	"邮箱、验证码和新密码"
+//
+//	@Success		200			{string}	string	"reset password success"
+//	@Router			/user/resetPasswdByEmail [post]
+func resetPasswdByEmail(c *gin.Context) {
+	apiCommonFunc(c, mdb.ResetPasswdByEmail)
+}
+
+// unlockAccount godoc
+//
+//	@Summary	unlockAccount
+//	@Schemes
+//	@Description	连续登录失败账号被锁定后, 用purpose=unlock的短信验证码解锁
+//	@Tags			user
+//	@Produce		json
+//
+//	@Param			in		body	mdb.UnlockAccountReq true	"手机号和验证码"
+//
+//	@Success		200			{string}	string	"unlock account success"
+//	@Router			/user/unlockAccount [post]
+func unlockAccount(c *gin.Context) {
+	apiCommonFunc(c, mdb.UnlockAccount)
+}
+
 // userRegister godoc
 //
 //	@Summary	userRegister
 //	@Schemes
-//	@Description	user register
+//	@Description	user register, login_type为0时需要purpose为register的短信验证码, 为1时需要邮箱验证码
 //	@Tags			user
 //	@Produce		json
 //
-//	@Param			in		body	mysql.User true	"user info"
+//	@Param			in		body	mdb.UserRegisterReq true	"user info"
 //
 //	@Success		200			{object}	mysql.User
 //	@Router			/user/userRegister [post]
@@ -233,7 +389,7 @@ func queryUserById(c *gin.Context) {
 //
 //	@Summary	queryUserByPhone
 //	@Schemes
-//	@Description	query user by phone
+//	@Description	query user by phone, 完全匹配手机号, 只返回调用者本人, 管理员可以查询所有用户
 //	@Tags			user
 //	@Produce		json
 //
@@ -259,7 +415,7 @@ func queryUserByPhone(c *gin.Context) {
 //
 //	@Summary	queryUserByEmail
 //	@Schemes
-//	@Description	query user by email
+//	@Description	query user by email, 完全匹配邮箱, 只返回调用者本人, 管理员可以查询所有用户
 //	@Tags			user
 //	@Produce		json
 //
@@ -397,7 +553,7 @@ func updateHeadPic(c *gin.Context) {
 //
 //	@Summary	update
 //	@Schemes
-//	@Description	update user
+//	@Description	update user, email and email_verified are ignored, email is changed by /user/modifyEmail only
 //	@Tags			user
 //	@Produce		json
 //	@Param			token	query	string		false	"token"
@@ -418,7 +574,7 @@ func updateUser(c *gin.Context) {
 //
 //	@Summary	modifyPhone
 //	@Schemes
-//	@Description	modify user phone
+//	@Description	modify user phone, 需要先用purpose=modify_phone给新手机号发送验证码
 //	@Tags			user
 //	@Produce		json
 //	@Param			token	query	string		false	"token"
@@ -434,7 +590,7 @@ func modifyPhone(c *gin.Context) {
 //
 //	@Summary	modifyEmergentPhone
 //	@Schemes
-//	@Description	modify user emergent phone
+//	@Description	modify user emergent phone, 只在没有紧急联系人时用于短信通知, 新的客户端使用/contact接口
 //	@Tags			user
 //	@Produce		json
 //	@Param			token	query	string		false	"token"
@@ -450,7 +606,7 @@ func modifyEmergentPhone(c *gin.Context) {
 //
 //	@Summary	modifyEmail
 //	@Schemes
-//	@Description	modify user email
+//	@Description	modify user email, 需要发送到新邮箱的验证码
 //	@Tags			user
 //	@Produce		json
 //	@Param			token	query	string		false	"token"
@@ -462,11 +618,27 @@ func modifyEmail(c *gin.Context) {
 	apiCommonFunc(c, mdb.ModifyEmail)
 }
 
+// modifyLocale godoc
+//
+//	@Summary	modifyLocale
+//	@Schemes
+//	@Description	modify user locale, 通知按该语言选择模板, 为空时使用缺省语言
+//	@Tags			user
+//	@Produce		json
+//	@Param			token	query	string		false	"token"
+//	@Param			in	body	mdb.NewLocale	 true	"user locale"
+//
+//	@Success		200			{object}	mysql.User
+//	@Router			/user/modifyLocale [post]
+func modifyLocale(c *gin.Context) {
+	apiCommonFunc(c, mdb.ModifyLocale)
+}
+
 // modifyPasswd godoc
 //
 //	@Summary	modifyPasswd
 //	@Schemes
-//	@Description	modify user passwd
+//	@Description	modify user passwd, 需要校验旧密码, 修改后其他登录会话失效
 //	@Tags			user
 //	@Produce		json
 //	@Param			token	query	string		false	"token"
@@ -931,3 +1103,127 @@ func queryUserOverview(c *gin.Context) {
 func updateUserOverview(c *gin.Context) {
 	apiCommonFunc(c, mdb.UpdateUserOverview)
 }
+
+// exportUserData godoc
+//
+//	@Summary	exportUserData
+//	@Schemes
+//	@Description	创建用户数据导出任务, 异步生成包含用户所有数据的zip文件
+//	@Tags			user
+//	@Produce		json
+//	@Param			token	query	string		true	"token"
+//	@Param			in	body	mdb.UserDataJobReq	true	"用户id"
+//
+// @Success		200			{object}	mysql.UserDataJob
+// @Router			/user/exportUserData [post]
+func exportUserData(c *gin.Context) {
+	apiCommonFunc(c, mdb.ExportUserData)
+}
+
+// eraseUserData godoc
+//
+//	@Summary	eraseUserData
+//	@Schemes
+//	@Description	创建用户数据删除任务, 异步删除或匿名化用户的所有数据, 需要提供用户密码, 或者purpose为erase_data的短信/邮箱验证码
+//	@Tags			user
+//	@Produce		json
+//	@Param			token	query	string		true	"token"
+//	@Param			in	body	mdb.UserDataJobReq	true	"用户id和密码或验证码"
+//
+// @Success		200			{object}	mysql.UserDataJob
+// @Router			/user/eraseUserData [post]
+func eraseUserData(c *gin.Context) {
+	apiCommonFunc(c, mdb.EraseUserData)
+}
+
+// queryUserDataJob godoc
+//
+//	@Summary	queryUserDataJob
+//	@Schemes
+//	@Description	查询用户数据导出或删除任务的状态, 导出完成时返回download_key
+//	@Tags			user
+//	@Produce		json
+//	@Param			token	query	string	true	"token"
+//	@Param			id		query	int		true	"任务id"
+//
+// @Success		200			{object}	mysql.UserDataJob
+// @Router			/user/queryUserDataJob [get]
+func queryUserDataJob(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryUserDataJob)
+}
+
+// downloadUserData godoc
+//
+//	@Summary	downloadUserData
+//	@Schemes
+//	@Description	下载用户数据导出文件
+//	@Tags			user
+//	@Produce		application/zip
+//	@Param			token	query	string	true	"token"
+//	@Param			id		query	int		true	"任务id"
+//	@Param			key		query	string	true	"download_key"
+//
+// @Success		200			{file}	file
+// @Router			/user/downloadUserData [get]
+func downloadUserData(c *gin.Context) {
+	exception.TryEx{
+		Try: func() {
+			status, result := mdb.GetUserDataExportFile(c)
+			if status != http.StatusOK {
+				respJSON(c, status, result)
+				return
+			}
+			fileName := result.(string)
+			c.FileAttachment(fileName, filepath.Base(fileName))
+		},
+		Catch: func(e exception.Exception) {
+			respJSON(c, e.Code, e.Msg)
+		},
+	}.Run()
+}
+
+// refreshToken godoc
+//
+//	@Summary	refreshToken
+//	@Schemes
+//	@Description	用refresh token换取新的access token和refresh token, 旧的refresh token失效
+//	@Tags			user
+//	@Produce		json
+//	@Param			in	body	mdb.RefreshTokenReq	true	"refresh token"
+//
+// @Success		200			{object}	mysql.UserTokenPair
+// @Router			/user/refreshToken [post]
+func refreshToken(c *gin.Context) {
+	apiCommonFunc(c, mdb.RefreshUserToken)
+}
+
+// querySessions godoc
+//
+//	@Summary	querySessions
+//	@Schemes
+//	@Description	查询当前用户所有有效的登录会话
+//	@Tags			user
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//
+// @Success		200			{array}	mysql.UserSession
+// @Router			/user/querySessions [get]
+func querySessions(c *gin.Context) {
+	apiCommonFunc(c, mdb.QueryUserSessions)
+}
+
+// revokeSession godoc
+//
+//	@Summary	revokeSession
+//	@Schemes
+//	@Description	撤销当前用户的登录会话, session_id为空时撤销所有会话
+//	@Tags			user
+//	@Produce		json
+//	@Param			token	query	string	false	"token, 也可以使用Authorization: Bearer头"
+//	@Param			in	body	mdb.RevokeSessionReq	true	"会话id"
+//
+// @Success		200			{string}	string	"revoke session success"
+// @Router			/user/revokeSession [post]
+func revokeSession(c *gin.Context) {
+	apiCommonFunc(c, mdb.RevokeUserSession)
+}
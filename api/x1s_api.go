@@ -9,6 +9,7 @@ package api
 
 import (
 	"hjyserver/mdb"
+	"hjyserver/mdb/mysql"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,7 +18,8 @@ func InitX1sActions() (map[string]gin.HandlerFunc, map[string]gin.HandlerFunc) {
 	postAction := make(map[string]gin.HandlerFunc)
 	getAction := make(map[string]gin.HandlerFunc)
 	postAction["/x1s/askX1sSyncVersion"] = askX1sSyncVersion
-	postAction["/x1s/insertX1sWhiteList"] = insertX1sWhiteList
+	// 白名单管理也可以通过/admin/insertOtaWhiteList
+	postAction["/x1s/insertX1sWhiteList"] = withPermission(mysql.PermOta, insertX1sWhiteList)
 
 	getAction["/x1s/queryX1sWhiteList"] = queryX1sWhiteList
 
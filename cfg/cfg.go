@@ -28,17 +28,25 @@ const (
 	StaticVideoPath = "public/video/"
 	StaticVoicePath = "public/voice/"
 	StaticFilePath  = "public/file/"
+	// 用户数据导出文件目录, 不在静态文件目录下, 只能通过下载接口获取
+	UserExportPath = "export/"
 )
 
 type Cfg struct {
-	Svr        SvrCfg      `yaml:"server"`
-	DB         DbCfg       `yaml:"database"`
-	Mq         MqCfg       `yaml:"mq"`
-	Wx         WxCfg       `yaml:"wx"`
-	Redis      RedisCfg    `yaml:"redis"`
-	StaticPath string      `yaml:"staticPath"`
-	Log        LogCfg      `yaml:"log"`
-	AlarmMsg   AlarmMsgCfg `yaml:"alarm_msg"`
+	Svr        SvrCfg       `yaml:"server"`
+	DB         DbCfg        `yaml:"database"`
+	Mq         MqCfg        `yaml:"mq"`
+	Wx         WxCfg        `yaml:"wx"`
+	Redis      RedisCfg     `yaml:"redis"`
+	StaticPath string       `yaml:"staticPath"`
+	Log        LogCfg       `yaml:"log"`
+	Jwt        JwtCfg       `yaml:"jwt"`
+	RateLimit  RateLimitCfg `yaml:"rate_limit"`
+	Webhook    WebhookCfg   `yaml:"webhook"`
+	Notify     NotifyCfg    `yaml:"notify"`
+	Alarm      AlarmCfg     `yaml:"alarm"`
+	Sms        SmsCfg       `yaml:"sms"`
+	Mail       MailCfg      `yaml:"mail"`
 }
 
 type SvrCfg struct {
@@ -57,12 +65,29 @@ type SvrCfg struct {
 	EnableH03   bool   `yaml:"enable_h03"`
 	EnableT1    bool   `yaml:"enable_t1"`
 	EnableWx    bool   `yaml:"enable_wx"`
+	// 启用app实时数据推送(websocket/sse)
+	EnableStream bool `yaml:"enable_stream"`
+	// 始终作为管理员的账号, 用于初始化管理员角色
+	AdminAccounts []string `yaml:"admin_accounts"`
+	// 此日期(2006-01-02)之后仍未迁移到哈希的旧密码被标记为需要重置, 为空不标记
+	PasswordResetAfter string `yaml:"password_reset_after"`
+	// 可信的反向代理地址或网段, 只有来自这些地址的请求才按X-Forwarded-For取客户端IP,
+	// 为空时不信任任何代理, 客户端IP取连接的地址
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 type DbCfg struct {
 	Url      string `yaml:"url"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	Dbname   string `yaml:"dbname"`
+	// 记录表是否按月分区
+	EnablePartition bool `yaml:"enable_partition"`
+	// 分区表保留的月数(不含当月), 0表示不删除过期分区
+	PartitionRetainMonths int `yaml:"partition_retain_months"`
+	// 只读从库的dsn列表, 格式为username:password@tcp(host:port)/dbname, 只有报表和统计查询读从库
+	Replicas []string `yaml:"replicas"`
+	// 允许的从库最大延迟, 单位秒, 超过时从库暂停使用
+	ReplicaMaxLag int `yaml:"replica_max_lag"`
 }
 
 type MqCfg struct {
@@ -106,6 +131,152 @@ type RedisCfg struct {
 	CaFile    string `yaml:"ca_file"`
 }
 
+type JwtCfg struct {
+	// 签名使用的密钥id
+	ActiveKid string `yaml:"active_kid"`
+	// 所有可用于校验的密钥, kid: secret, 轮换时先加入新密钥再切换active_kid,
+	// 旧密钥在access_ttl之后删除. 每个密钥至少32字节, 环境变量HJY_JWT_KEY_<KID>
+	// 和key_files中的文件优先于这里的值, 签名密钥没有配置时服务不启动
+	Keys map[string]string `yaml:"keys"`
+	// 密钥文件, kid: 文件路径, 文件内容为密钥
+	KeyFiles map[string]string `yaml:"key_files"`
+	// access token有效期, 单位秒
+	AccessTtl int `yaml:"access_ttl"`
+	// refresh token有效期, 单位秒
+	RefreshTtl int `yaml:"refresh_ttl"`
+	// 旧的refresh token在轮换后仍可使用的时间, 单位秒, 用于并发刷新, 缺省30秒
+	RefreshReuseGrace int `yaml:"refresh_reuse_grace"`
+	// 旧的AES token的截止时间, 格式2006-01-02 15:04:05, 过了这个时间旧token全部失效,
+	// 为空时只有没有配置jwt密钥才接受旧token
+	LegacyTokenDeadline string `yaml:"legacy_token_deadline"`
+}
+
+type RateLimitRule struct {
+	// 路由前缀, 去掉版本号, 如/upload/、/user/userLogin, 匹配最长的前缀
+	Prefix string `yaml:"prefix"`
+	// 时间窗口内最多请求数
+	Limit int `yaml:"limit"`
+	// 时间窗口, 单位秒
+	Window int `yaml:"window"`
+}
+
+type RateLimitCfg struct {
+	// 缺省启用, 关闭时使用进程内按IP的限流
+	Enable bool `yaml:"enable"`
+	// 没有匹配规则的路由的缺省限额
+	Limit  int `yaml:"limit"`
+	Window int `yaml:"window"`
+	// 按路由前缀的限额, 每个前缀单独计数
+	Rules []RateLimitRule `yaml:"rules"`
+}
+
+type WebhookCfg struct {
+	// 关闭时不产生事件, 也不重试未完成的推送
+	Enable bool `yaml:"enable"`
+	// 最多推送次数, 超过后进入死信列表
+	MaxAttempts int `yaml:"max_attempts"`
+	// 首次重试间隔, 之后每次加倍, 单位秒
+	RetryInterval int `yaml:"retry_interval"`
+	// 请求超时, 单位秒
+	Timeout int `yaml:"timeout"`
+}
+
+type AlarmCfg struct {
+	// 没有恢复事件的报警, 超过该时间没有再次发生时自动恢复, 单位秒
+	AutoResolve int `yaml:"auto_resolve"`
+	// 报警未确认时的升级策略
+	Escalations []EscalationPolicy `yaml:"escalations"`
+}
+
+type EscalationStep struct {
+	// 报警后多少秒执行, 报警已确认或恢复时不再执行
+	After int `yaml:"after"`
+	// 通道链, 与通知路由相同, 每条链按顺序尝试
+	Chains [][]string `yaml:"chains"`
+}
+
+type EscalationPolicy struct {
+	Name string `yaml:"name"`
+	// 适用的报警, 格式为 来源 或 来源.类型, 如fall、sleep.3010
+	Alarms []string         `yaml:"alarms"`
+	Steps  []EscalationStep `yaml:"steps"`
+}
+
+type NotifyRoute struct {
+	// 事件类型, 如sleep.alarm、study.report
+	Event string `yaml:"event"`
+	// 通道链, 每条链按顺序尝试, 有一个成功就停止, 所有链都会执行
+	Chains [][]string `yaml:"chains"`
+}
+
+type NotifyCfg struct {
+	// 覆盖缺省路由, 没有配置的事件使用缺省路由
+	Routes []NotifyRoute `yaml:"routes"`
+	// 模板文件目录, 每个语言一个yml文件, 数据库中的模板覆盖文件中的同名模板
+	TemplatePath string `yaml:"template_path"`
+	// 用户没有设置语言或者没有该语言模板时使用的语言
+	DefaultLocale string `yaml:"default_locale"`
+	// 重新加载模板的间隔, 单位秒
+	TemplateReload int `yaml:"template_reload"`
+	// 同一用户、事件和设备在窗口内只通知一次, 单位秒, 0不去重, 用户可以设置自己的窗口
+	DedupWindow int `yaml:"dedup_window"`
+	// 每个通道每个用户每天最多发送的条数, 没有配置的通道不限制
+	DailyCap map[string]int `yaml:"daily_cap"`
+	// 严重的事件不受免打扰时段和每日上限限制, 格式为 事件类型.编号 或 事件类型
+	Critical []string `yaml:"critical"`
+	// 摘要模式下被拦截的通知合并发送的间隔, 单位秒
+	DigestInterval int `yaml:"digest_interval"`
+}
+
+type AliyunSmsCfg struct {
+	AccessKeyId     string `yaml:"access_key_id"`
+	AccessKeySecret string `yaml:"access_key_secret"`
+	Endpoint        string `yaml:"endpoint"`
+	SignName        string `yaml:"sign_name"`
+	// 按手机号地区的模板编号, key为cn/hk
+	Templates map[string]string `yaml:"templates"`
+	// 验证码短信按手机号地区的模板编号, 模板参数为code, 没有配置的地区使用通知模板
+	CodeTemplates map[string]string `yaml:"code_templates"`
+	// 回执推送地址中的token, 用于校验回执来源
+	CallbackToken string `yaml:"callback_token"`
+}
+
+type HttpSmsCfg struct {
+	// 发送地址, 如https://api.twilio.com/2010-04-01/Accounts/{sid}/Messages.json
+	Url        string `yaml:"url"`
+	AccountSid string `yaml:"account_sid"`
+	AuthToken  string `yaml:"auth_token"`
+	From       string `yaml:"from"`
+	// 回执地址, 为空时不接收回执, 也用于回执的签名校验
+	StatusCallback string `yaml:"status_callback"`
+	Timeout        int    `yaml:"timeout"`
+}
+
+type SmsCfg struct {
+	// 缺省的供应商 aliyun/http/mock
+	Provider string `yaml:"provider"`
+	// 按手机号地区选择的供应商, key为cn/hk, 没有配置时使用缺省的供应商
+	Regions map[string]string `yaml:"regions"`
+	Aliyun  AliyunSmsCfg      `yaml:"aliyun"`
+	Http    HttpSmsCfg        `yaml:"http"`
+}
+
+type MailCfg struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// 发件人地址和名称
+	From     string `yaml:"from"`
+	FromName string `yaml:"from_name"`
+	// 加密方式 none/starttls/ssl, 为空时服务器支持就使用starttls
+	Tls string `yaml:"tls"`
+	// 连接和发送超时, 单位秒
+	Timeout int `yaml:"timeout"`
+	// html邮件模板目录, 每种语言一个子目录
+	TemplatePath string `yaml:"template_path"`
+}
+
 type LogCfg struct {
 	Level      string `yaml:"level"`
 	File       string `yaml:"file"`
@@ -116,48 +287,6 @@ type LogCfg struct {
 	Format     string `yaml:"format"`
 }
 
-type AlarmMsgCfg struct {
-	PullRopeAlarmMsgCN          string `yaml:"pull_rope_alarm_msg_cn"`
-	PullRopeAlarmMsgHK          string `yaml:"pull_rope_alarm_msg_hk"`
-	PullRopeAlarmMsgEN          string `yaml:"pull_rope_alarm_msg_en"`
-	DisarmedPullRopeAlarmMsgCN  string `yaml:"disarmed_pull_rope_alarm_msg_cn"`
-	DisarmedPullRopeAlarmMsgHK  string `yaml:"disarmed_pull_rope_alarm_msg_hk"`
-	DisarmedPullRopeAlarmMsgEN  string `yaml:"disarmed_pull_rope_alarm_msg_en"`
-	ApneaAlarmMsgCN             string `yaml:"apnea_alarm_msg_cn"`
-	ApneaAlarmMsgHK             string `yaml:"apnea_alarm_msg_hk"`
-	ApneaAlarmMsgEN             string `yaml:"apnea_alarm_msg_en"`
-	LeaveBedAlarmMsgCN          string `yaml:"leave_bed_alarm_msg_cn"`
-	LeaveBedAlarmMsgHK          string `yaml:"leave_bed_alarm_msg_hk"`
-	LeaveBedAlarmMsgEN          string `yaml:"leave_bed_alarm_msg_en"`
-	InBedAlarmMsgCN             string `yaml:"in_bed_alarm_msg_cn"`
-	InBedAlarmMsgHK             string `yaml:"in_bed_alarm_msg_hk"`
-	InBedAlarmMsgEN             string `yaml:"in_bed_alarm_msg_en"`
-	BreathingAbnormalAlarmMsgCN string `yaml:"breathing_abnormal_alarm_msg_cn"`
-	BreathingAbnormalAlarmMsgHK string `yaml:"breathing_abnormal_alarm_msg_hk"`
-	BreathingAbnormalAlarmMsgEN string `yaml:"breathing_abnormal_alarm_msg_en"`
-	HeartRateAbnormalAlarmMsgCN string `yaml:"heart_rate_abnormal_alarm_msg_cn"`
-	HeartRateAbnormalAlarmMsgHK string `yaml:"heart_rate_abnormal_alarm_msg_hk"`
-	HeartRateAbnormalAlarmMsgEN string `yaml:"heart_rate_abnormal_alarm_msg_en"`
-	CheckPersonActivityMsgCN    string `yaml:"check_person_activity_msg_cn"`
-	CheckPersonActivityMsgHK    string `yaml:"check_person_activity_msg_hk"`
-	CheckPersonActivityMsgEN    string `yaml:"check_person_activity_msg_en"`
-	CheckPersonNoActivityMsgCN  string `yaml:"check_person_no_activity_msg_cn"`
-	CheckPersonNoActivityMsgHK  string `yaml:"check_person_no_activity_msg_hk"`
-	CheckPersonNoActivityMsgEN  string `yaml:"check_person_no_activity_msg_en"`
-	CheckPersonBreathHighMsgCN  string `yaml:"check_person_breath_high_msg_cn"`
-	CheckPersonBreathHighMsgHK  string `yaml:"check_person_breath_high_msg_hk"`
-	CheckPersonBreathHighMsgEN  string `yaml:"check_person_breath_high_msg_en"`
-	CheckPersonBreathLowMsgCN   string `yaml:"check_person_breath_low_msg_cn"`
-	CheckPersonBreathLowMsgHK   string `yaml:"check_person_breath_low_msg_hk"`
-	CheckPersonBreathLowMsgEN   string `yaml:"check_person_breath_low_msg_en"`
-	CheckPersonHeartHighMsgCN   string `yaml:"check_person_heart_high_msg_cn"`
-	CheckPersonHeartHighMsgHK   string `yaml:"check_person_heart_high_msg_hk"`
-	CheckPersonHeartHighMsgEN   string `yaml:"check_person_heart_high_msg_en"`
-	CheckPersonHeartLowMsgCN    string `yaml:"check_person_heart_low_msg_cn"`
-	CheckPersonHeartLowMsgHK    string `yaml:"check_person_heart_low_msg_hk"`
-	CheckPersonHeartLowMsgEN    string `yaml:"check_person_heart_low_msg_en"`
-}
-
 var This *Cfg = nil
 
 func InitConfig(iniFile string) error {
@@ -174,7 +303,8 @@ func InitConfig(iniFile string) error {
 		fmt.Printf("ReadFile config error,%v", err)
 		return err
 	}
-	This = new(Cfg)
+	// 配置文件中没有rate_limit时也启用限流
+	This = &Cfg{RateLimit: RateLimitCfg{Enable: true, Limit: 600, Window: 60}}
 	err = yaml.Unmarshal(yamlFile, This)
 	if err != nil {
 		fmt.Printf("yaml unmarshal error, %v", err)
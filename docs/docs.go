@@ -486,30 +486,30 @@ const docTemplate = `{
                 }
             }
         },
-        "/device/askEd713RealData": {
+        "/admin/createApiKey": {
             "post": {
-                "description": "ask Ed713 device to send real data",
+                "description": "为合作机构创建api key, 明文key只在返回中出现一次, 调用时放在X-Api-Key头中,\n只能访问授权范围内的接口和允许列表中的设备, 需要apikey:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "ED713 device"
+                    "admin"
                 ],
-                "summary": "askEd713RealData",
+                "summary": "adminCreateApiKey",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "ack Ed713 info",
+                        "description": "机构id、名称、授权范围、设备和限额",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.AskEd713RealDataReq"
+                            "$ref": "#/definitions/mdb.ApiKeyReq"
                         }
                     }
                 ],
@@ -517,36 +517,36 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "$ref": "#/definitions/mdb.ApiKeyResp"
                         }
                     }
                 }
             }
         },
-        "/device/askX1RealData": {
+        "/admin/createOrganization": {
             "post": {
-                "description": "ask X1 device to send real data",
+                "description": "创建合作机构, 需要apikey:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "X1 device"
+                    "admin"
                 ],
-                "summary": "askX1RealData",
+                "summary": "adminCreateOrganization",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "ack X1 info",
+                        "description": "机构信息",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.AskX1RealDataReq"
+                            "$ref": "#/definitions/mysql.Organization"
                         }
                     }
                 ],
@@ -554,36 +554,36 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "$ref": "#/definitions/mysql.Organization"
                         }
                     }
                 }
             }
         },
-        "/device/cleanX1Event": {
+        "/admin/createWebhook": {
             "post": {
-                "description": "clean event from X1 device",
+                "description": "为合作机构创建webhook, 签名密钥只在返回中出现一次. 推送时请求头X-Hjy-Signature为\nt=\u003c时间戳\u003e,v1=\u003cHMAC-SHA256(密钥, \"时间戳.body\")\u003e, 只推送机构api key有权限的设备事件,\n需要webhook:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "X1 device"
+                    "admin"
                 ],
-                "summary": "cleanX1Event",
+                "summary": "adminCreateWebhook",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "clean X1 event",
+                        "description": "机构id、https地址和订阅的事件",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.CleanX1EventReq"
+                            "$ref": "#/definitions/mdb.WebhookReq"
                         }
                     }
                 ],
@@ -591,42 +591,42 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "$ref": "#/definitions/mdb.WebhookResp"
                         }
                     }
                 }
             }
         },
-        "/device/confirmSharedDevice": {
+        "/admin/deleteNotifyTemplate": {
             "post": {
-                "description": "confirm shared device",
+                "description": "删除数据库中的通知模板, 删除后使用模板文件中的同名模板, 需要notify:template权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "confirmSharedDevice",
+                "summary": "adminDeleteNotifyTemplate",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "confirm shared device request",
+                        "description": "模板id",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.ConfirmSharedReq"
+                            "$ref": "#/definitions/mysql.NotifyTemplate"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Confirmed successfully\"}",
+                        "description": "delete template success",
                         "schema": {
                             "type": "string"
                         }
@@ -634,36 +634,36 @@ const docTemplate = `{
                 }
             }
         },
-        "/device/confirmTransferDevice": {
+        "/admin/deleteOtaWhiteList": {
             "post": {
-                "description": "confirmed transfer device to other user",
+                "description": "从X1s OTA白名单中删除mac, 多个mac用;分隔, 需要ota:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "confirmTransferDevice",
+                "summary": "adminDeleteOtaWhiteList",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "confirmed transfer device",
+                        "description": "mac",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.ConfirmTransferReq"
+                            "$ref": "#/definitions/mdb.X1sWhiteListReq"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Confirmed successfully\"}",
+                        "description": "ok",
                         "schema": {
                             "type": "string"
                         }
@@ -671,330 +671,452 @@ const docTemplate = `{
                 }
             }
         },
-        "/device/controlLamp": {
+        "/admin/deleteWebhook": {
             "post": {
-                "description": "control lamp status",
+                "description": "删除webhook, 需要webhook:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "lamp device"
+                    "admin"
                 ],
-                "summary": "controlLamp",
+                "summary": "adminDeleteWebhook",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "control lamp",
+                        "description": "webhook id",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.ControlLampReq"
+                            "$ref": "#/definitions/mdb.WebhookReq"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "delete webhook success",
                         "schema": {
-                            "type": "none"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/device/createStudyRoom": {
-            "post": {
-                "description": "create study room",
+        "/admin/queryAlarmEscalations": {
+            "get": {
+                "description": "查询报警的升级状态, step为下一级, status 0:等待执行 1:已完成 2:已取消, 需要alarm:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "admin"
                 ],
-                "summary": "createStudyRoom",
+                "summary": "adminQueryAlarmEscalations",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "room information",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.CreateStudyRoomReq"
-                        }
+                        "type": "integer",
+                        "description": "报警id",
+                        "name": "alarm_id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.StudyRoom"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.AlarmEscalation"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/improveDisturbed": {
-            "post": {
-                "description": "import x1 device disturbed data",
+        "/admin/queryAlarmStats": {
+            "get": {
+                "description": "按机构或设备统计报警数量和MTTA/MTTR, 单位秒, 第一条为合计, 之后按来源, 需要alarm:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "X1 device"
+                    "admin"
                 ],
-                "summary": "improveDisturbed",
+                "summary": "adminQueryAlarmStats",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "X1 distrube switch",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.ImproveDisturbedReq"
-                        }
+                        "type": "integer",
+                        "description": "机构id",
+                        "name": "org_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备mac",
+                        "name": "mac",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "报警时间起",
+                        "name": "start_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "报警时间止",
+                        "name": "end_time",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.AlarmStats"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/insert": {
-            "post": {
-                "description": "insert user device",
+        "/admin/queryAlarms": {
+            "get": {
+                "description": "按机构、设备、来源和状态查询报警, 机构的设备为有效api key允许列表中的设备, 需要alarm:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "insertDevice",
+                "summary": "adminQueryAlarms",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "user device information",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.NewDeviceReq"
-                        }
+                        "type": "integer",
+                        "description": "机构id",
+                        "name": "org_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备mac",
+                        "name": "mac",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "sleep:睡眠设备 fall:跌倒检测 study:学习设备",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "1:未处理 2:已确认 3:已恢复",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "报警时间起",
+                        "name": "start_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "报警时间止",
+                        "name": "end_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页号",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页记录数",
+                        "name": "pageSize",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserDevice"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.Alarm"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/insertFallParams": {
-            "post": {
-                "description": "query fall check device install params",
+        "/admin/queryApiKeyUsage": {
+            "get": {
+                "description": "查询api key最近几天按接口的调用次数, 需要apikey:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "fall check device"
+                    "admin"
                 ],
-                "summary": "insertFallParams",
+                "summary": "adminQueryApiKeyUsage",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "fall check device params",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mysql.FallParams"
-                        }
+                        "type": "integer",
+                        "description": "api key id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "天数, 缺省7天",
+                        "name": "days",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.FallParams"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.ApiKeyUsage"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/modifySharedDeviceRemark": {
-            "post": {
-                "description": "modify shared device remark",
+        "/admin/queryApiKeys": {
+            "get": {
+                "description": "查询api key, 不返回明文key, 需要apikey:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "modifySharedDeviceRemark",
+                "summary": "adminQueryApiKeys",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "modify share device remark",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.ModifySharedDeviceRemarkReq"
-                        }
+                        "type": "integer",
+                        "description": "机构id",
+                        "name": "org_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserShareDevice"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.ApiKey"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/modifyStudyRoom": {
-            "post": {
-                "description": "修改自习室信息",
+        "/admin/queryDeviceUsers": {
+            "get": {
+                "description": "查询绑定和共享设备的所有用户, 需要device:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "admin"
                 ],
-                "summary": "modifyStudyRoom",
+                "summary": "adminQueryDeviceUsers",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "room information",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.ModifyStudyRoomReq"
-                        }
+                        "type": "string",
+                        "description": "设备mac",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "修改成功\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.UserDeviceDetail"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/openLampRealData": {
-            "post": {
-                "description": "query fall check device install params",
+        "/admin/queryDevices": {
+            "get": {
+                "description": "按mac或名称模糊查询设备, 需要device:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "lamp device"
+                    "admin"
                 ],
-                "summary": "openLampRealData",
+                "summary": "adminQueryDevices",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
                     },
                     {
-                        "description": "lamp real data",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.LampRealDataReq"
-                        }
+                        "type": "string",
+                        "description": "关键字",
+                        "name": "keyword",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备类型",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页号",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页记录数",
+                        "name": "pageSize",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.Device"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryAlarmRecord": {
+        "/admin/queryNotifyAttempts": {
             "get": {
-                "description": "query alarm record report from fall check device",
+                "description": "查询用户通知的发送记录, 每个通道的每次发送一条, 需要notify:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "fall check device"
+                    "admin"
                 ],
-                "summary": "queryAlarmRecord",
+                "summary": "adminQueryNotifyAttempts",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "begin day, format yyyy-MM-dd",
-                        "name": "begin_day",
+                        "type": "integer",
+                        "description": "用户id",
+                        "name": "user_id",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "end day, format yyyy-MM-dd",
-                        "name": "end_day",
+                        "description": "事件id",
+                        "name": "event_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "事件类型",
+                        "name": "event_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "通道",
+                        "name": "channel",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "1:成功 2:失败 3:跳过",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备mac",
+                        "name": "mac",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页号",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页记录数",
+                        "name": "pageSize",
                         "in": "query"
                     }
                 ],
@@ -1002,141 +1124,165 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.FallAlarm"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.NotifyAttempt"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryBindByMac": {
+        "/admin/queryNotifyTemplates": {
             "get": {
-                "description": "query device has bind by mac",
+                "description": "查询数据库中的通知模板, 同一模板key和语言覆盖模板文件, 需要notify:template权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "queryBindByMac",
+                "summary": "adminQueryNotifyTemplates",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "模板key, 如sleep.alarm.3008",
+                        "name": "event_key",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "语言",
+                        "name": "locale",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mdb.DeviceBindResp"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.NotifyTemplate"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryById": {
+        "/admin/queryOrganizations": {
             "get": {
-                "description": "query device infomaion",
+                "description": "查询合作机构, 需要apikey:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "queryById",
+                "summary": "adminQueryOrganizations",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "device id",
-                        "name": "id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.Device"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.Organization"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryByUser": {
+        "/admin/querySecurityEvents": {
             "get": {
-                "description": "query device infomaion by user id",
+                "description": "查询登录失败、账号锁定、IP封禁、解锁和重置密码等安全事件, 需要user:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "queryByUser",
+                "summary": "adminQuerySecurityEvents",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "user id",
+                        "description": "用户id",
                         "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "登录账号",
+                        "name": "account",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "login_fail/account_locked/ip_blocked/account_unlocked/password_reset",
+                        "name": "event_type",
+                        "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "flag",
-                        "name": "flag",
-                        "in": "query",
-                        "required": true
+                        "description": "页号",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页记录数",
+                        "name": "pageSize",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.Device"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.SecurityEvent"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryDateListInReport": {
+        "/admin/querySmsStats": {
             "get": {
-                "description": "查詢报表中含有数据的日期列表",
+                "description": "查询每个短信供应商的发送成功、失败和回执送达统计, 从本实例启动开始, 需要notify:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "queryDateListInReport",
+                "summary": "adminQuerySmsStats",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "begin day, format yyyy-MM-dd",
-                        "name": "begin_day",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "end day, format yyyy-MM-dd",
-                        "name": "end_day",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
                         "in": "query"
                     }
                 ],
@@ -1144,98 +1290,158 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mdb.QueryDateListResp"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sms.ProviderStats"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryDeviceOverview": {
+        "/admin/queryUsers": {
             "get": {
-                "description": "查询设备的概览数据",
+                "description": "按账号、手机、邮箱或昵称模糊查询用户, 需要user:read权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "admin"
                 ],
-                "summary": "queryDeviceOverview",
+                "summary": "adminQueryUsers",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "关键字",
+                        "name": "keyword",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "用户id",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页号",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页记录数",
+                        "name": "pageSize",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.DeviceOverview"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mdb.AdminUser"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryFallCheckStatus": {
+        "/admin/queryWebhookDeliveries": {
             "get": {
-                "description": "query fall check data",
+                "description": "查询webhook推送记录, status=2为超过重试次数的死信列表, 需要webhook:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "fall check device"
+                    "admin"
                 ],
-                "summary": "queryFallCheckStatus",
+                "summary": "adminQueryWebhookDeliveries",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "webhook id",
+                        "name": "webhook_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "0:等待推送 1:成功 2:死信",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "事件类型",
+                        "name": "event_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备mac",
                         "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页号",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页记录数",
+                        "name": "pageSize",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.FallCheck"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.WebhookDelivery"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryFallExistRecord": {
+        "/admin/queryWebhooks": {
             "get": {
-                "description": "query fall check data if has person exist",
+                "description": "查询合作机构的webhook, 不返回签名密钥, 需要webhook:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "fall check device"
+                    "admin"
                 ],
-                "summary": "queryFallExistRecord",
+                "summary": "adminQueryWebhooks",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "begin day, format yyyy-MM-dd",
-                        "name": "begin_day",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "end day, format yyyy-MM-dd",
-                        "name": "end_day",
+                        "type": "integer",
+                        "description": "机构id",
+                        "name": "org_id",
                         "in": "query"
                     }
                 ],
@@ -1243,356 +1449,375 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.FallCheck"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.Webhook"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryFallParams": {
-            "get": {
-                "description": "query fall check device install params",
+        "/admin/redeliverWebhook": {
+            "post": {
+                "description": "手动重新推送一条记录, 包括死信列表中的记录, 需要webhook:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "fall check device"
+                    "admin"
                 ],
-                "summary": "queryFallParams",
+                "summary": "adminRedeliverWebhook",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "device id",
-                        "name": "device_id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "推送记录id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.WebhookReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.FallParams"
+                            "$ref": "#/definitions/mysql.WebhookDelivery"
                         }
                     }
                 }
             }
         },
-        "/device/queryHeartRate": {
-            "get": {
-                "description": "query heart data from heart rate table",
+        "/admin/revokeApiKey": {
+            "post": {
+                "description": "撤销api key, 立即失效, 需要apikey:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "sleep device"
+                    "admin"
                 ],
-                "summary": "queryHeartRate",
+                "summary": "adminRevokeApiKey",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "begin day, format yyyy-MM-dd",
-                        "name": "begin_day",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "end day, format yyyy-MM-dd",
-                        "name": "end_day",
-                        "in": "query"
+                        "description": "key id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ApiKeyReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "revoke api key success",
                         "schema": {
-                            "$ref": "#/definitions/mysql.HeartRate"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/device/queryInviteStudyRoom": {
-            "get": {
-                "description": "query invited study room by create user",
+        "/admin/revokeUserTokens": {
+            "post": {
+                "description": "撤销用户所有的登录会话, 需要token:revoke权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "admin"
                 ],
-                "summary": "queryInviteStudyRoom",
+                "summary": "adminRevokeUserTokens",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "用户id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.AdminUserReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "revoke tokens success",
                         "schema": {
-                            "$ref": "#/definitions/mysql.StudyRoomUserDetail"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/device/queryLampControl": {
-            "get": {
-                "description": "query lamp control data by mac",
+        "/admin/saveNotifyTemplate": {
+            "post": {
+                "description": "保存通知模板, 内容为text/template格式, 可以使用{{.NickName}} {{.DeviceName}} {{.Value}} {{.CreateTime}}等事件字段,\n模板key依次查找 事件类型.code.status、事件类型.code、事件类型, 保存后立即生效, 需要notify:template权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "lamp device"
+                    "admin"
                 ],
-                "summary": "queryLampControl",
+                "summary": "adminSaveNotifyTemplate",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "模板key、语言和内容",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mysql.NotifyTemplate"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.LampControlSql"
+                            "$ref": "#/definitions/mysql.NotifyTemplate"
                         }
                     }
                 }
             }
         },
-        "/device/queryLampEvent": {
-            "get": {
-                "description": "query lamp device real-data by mac and time",
+        "/admin/setUserRole": {
+            "post": {
+                "description": "设置用户角色, 需要role:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "lamp device"
+                    "admin"
                 ],
-                "summary": "queryLampEvent",
+                "summary": "adminSetUserRole",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "begin day",
-                        "name": "begin_day",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "end day",
-                        "name": "end_day",
-                        "in": "query"
+                        "description": "用户id和角色",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.AdminRoleReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.EventReportSql"
+                            "$ref": "#/definitions/mysql.UserRole"
                         }
                     }
                 }
             }
         },
-        "/device/queryLampRealData": {
-            "get": {
-                "description": "query lamp device real-data by mac and time",
+        "/admin/unbindDevice": {
+            "post": {
+                "description": "强制解绑设备, 删除设备和所有用户的关系以及共享、过户记录, 需要device:unbind权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "lamp device"
+                    "admin"
                 ],
-                "summary": "queryLampRealData",
+                "summary": "adminUnbindDevice",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "begin day",
-                        "name": "begin_day",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "end day",
-                        "name": "end_day",
-                        "in": "query"
+                        "description": "设备mac",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.AdminDeviceReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "unbind device success",
                         "schema": {
-                            "$ref": "#/definitions/mysql.RealDataSql"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/device/queryLampReportStatus": {
-            "get": {
-                "description": "query lamp device report by mac and date",
+        "/admin/updateApiKey": {
+            "post": {
+                "description": "修改api key的授权范围、设备和限额, 需要apikey:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "lamp device"
+                    "admin"
                 ],
-                "summary": "queryLampReportStatus",
+                "summary": "adminUpdateApiKey",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "begin day",
-                        "name": "begin_day",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "end day",
-                        "name": "end_day",
-                        "in": "query"
+                        "description": "key id、授权范围、设备和限额",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ApiKeyReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.LampReportStatus"
+                            "$ref": "#/definitions/mysql.ApiKey"
                         }
                     }
                 }
             }
         },
-        "/device/queryRankingByStudyRoom": {
-            "get": {
-                "description": "查询自习室排行数据，查询条件自习室id",
+        "/admin/updateWebhook": {
+            "post": {
+                "description": "修改webhook的地址、订阅的事件和状态, 需要webhook:manage权限",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "admin"
                 ],
-                "summary": "queryRankingByStudyRoom",
+                "summary": "adminUpdateWebhook",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "room id",
-                        "name": "room_id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "webhook id、地址、事件和状态",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.WebhookReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.StudyRoomRanking"
+                            "$ref": "#/definitions/mysql.Webhook"
                         }
                     }
                 }
             }
         },
-        "/device/queryShareUsers": {
-            "get": {
-                "description": "query users to which device shared",
+        "/alarm/ackAlarm": {
+            "post": {
+                "description": "护理人员确认报警, 记录确认人、时间和备注, 已自动恢复但未确认的报警也可以确认",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "alarm"
                 ],
-                "summary": "queryShareUsers",
+                "summary": "ackAlarm",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "login user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "报警id和备注",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.AlarmReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserShareDeviceDetail"
+                            "$ref": "#/definitions/mysql.Alarm"
                         }
                     }
                 }
             }
         },
-        "/device/querySleepReport": {
+        "/alarm/queryActiveAlarms": {
             "get": {
-                "description": "query sleep report data",
+                "description": "查询未恢复的报警, 包括未处理和已确认, 按用户的设备或单个设备查询, 合作机构使用api key时必须指定mac",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "sleep device"
+                    "alarm"
                 ],
-                "summary": "querySleepReport",
+                "summary": "queryActiveAlarms",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "begin day, format yyyy-MM-dd",
-                        "name": "begin_day",
+                        "type": "integer",
+                        "description": "用户id, 查询用户拥有或被共享的设备",
+                        "name": "user_id",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "end day, format yyyy-MM-dd",
-                        "name": "end_day",
+                        "description": "设备mac",
+                        "name": "mac",
                         "in": "query"
                     }
                 ],
@@ -1600,227 +1825,308 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.SleepReport"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.Alarm"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryStudyRoom": {
+        "/alarm/queryAlarmHistory": {
             "get": {
-                "description": "query study room by create user id",
+                "description": "分页查询报警历史, 可以按来源、状态和报警时间过滤",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "alarm"
                 ],
-                "summary": "queryStudyRoom",
+                "summary": "queryAlarmHistory",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "user id in study room",
+                        "description": "用户id",
                         "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备mac",
+                        "name": "mac",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "sleep:睡眠设备 fall:跌倒检测 study:学习设备",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "1:未处理 2:已确认 3:已恢复",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "报警时间起, 格式2006-01-02 15:04:05",
+                        "name": "start_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "报警时间止",
+                        "name": "end_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页号",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页记录数",
+                        "name": "pageSize",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.StudyRoom"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.Alarm"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryTransferUsers": {
+        "/alarm/queryAlarmStats": {
             "get": {
-                "description": "query users to which device transfered",
+                "description": "统计报警数量、平均确认时间MTTA和平均恢复时间MTTR, 单位秒, 第一条为合计, 之后按来源",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "alarm"
                 ],
-                "summary": "queryTransferUsers",
+                "summary": "queryAlarmStats",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "login user id",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "用户id",
                         "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "device mac address",
+                        "description": "设备mac",
                         "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "报警时间起",
+                        "name": "start_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "报警时间止",
+                        "name": "end_time",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserTransferDeviceDetail"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.AlarmStats"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/queryUnconfirmedShareDevices": {
-            "get": {
-                "description": "query unconfirmed share devices",
+        "/alarm/resolveAlarm": {
+            "post": {
+                "description": "手动恢复报警, 如现场处理完成但设备没有上报恢复事件",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "alarm"
                 ],
-                "summary": "queryUnconfirmedShareDevices",
+                "summary": "resolveAlarm",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "login user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "设备mac地址",
-                        "name": "mac",
-                        "in": "query"
+                        "description": "报警id和备注",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.AlarmReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserShareDeviceDetail"
+                            "$ref": "#/definitions/mysql.Alarm"
                         }
                     }
                 }
             }
         },
-        "/device/queryUnconfirmedTransferDevices": {
-            "get": {
-                "description": "query unconfirmed transfered devices",
+        "/contact/addContact": {
+            "post": {
+                "description": "添加紧急联系人. channels为逗号分隔的通道sms/wx_official/email, sms和wx_official必须填写手机号, email必须填写邮箱.\nopen_id由服务端在手机号验证后从该手机号注册账号绑定的微信取得, 客户端填写的无效.\nalarms为关注的报警, 如sleep.3010,fall,vital, 为空时接收所有报警.\nactive_start/active_end为接收时段, 格式15:04, 都为空时全天接收. 手机号和邮箱验证后才发送, 第一个联系人自动成为主联系人",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "contact"
                 ],
-                "summary": "queryUnconfirmedTransferDevices",
+                "summary": "addContact",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "login user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query"
+                        "description": "联系人",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mysql.EmergencyContact"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserTransferDeviceDetail"
+                            "$ref": "#/definitions/mysql.EmergencyContact"
                         }
                     }
                 }
             }
         },
-        "/device/queryX1RealDataJson": {
-            "get": {
-                "description": "query X1 real data in json format",
+        "/contact/deleteContact": {
+            "post": {
+                "description": "删除紧急联系人, 删除主联系人时下一个已验证的联系人成为主联系人",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "X1 device"
+                    "contact"
                 ],
-                "summary": "queryX1RealDataJson",
+                "summary": "deleteContact",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "create date",
-                        "name": "create_date",
-                        "in": "query"
+                        "description": "联系人id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ContactReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "delete emergency contact success",
                         "schema": {
-                            "$ref": "#/definitions/mysql.X1RealDataOrigin"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/device/queryX1SleepReportJson": {
+        "/contact/queryContacts": {
             "get": {
-                "description": "query X1 sleep report in json format",
+                "description": "查询用户的紧急联系人, 主联系人在前",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "X1 device"
+                    "contact"
                 ],
-                "summary": "queryX1SleepReportJson",
+                "summary": "queryContacts",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "create date",
-                        "name": "create_date",
-                        "in": "query"
+                        "type": "integer",
+                        "description": "用户id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.X1DayReportOrigin"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.EmergencyContact"
+                            }
                         }
                     }
                 }
             }
         },
-        "/device/recoverX1SleepReport": {
+        "/contact/sendEmailCode": {
             "post": {
-                "description": "recover x1 device sleep report from json table",
+                "description": "发送验证码到联系人的邮箱",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "X1 device"
+                    "contact"
                 ],
-                "summary": "recoverX1SleepReport",
+                "summary": "sendContactEmailCode",
                 "parameters": [
                     {
                         "type": "string",
@@ -1829,35 +2135,35 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "X1 sleep report",
+                        "description": "联系人id",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.RecoverX1SleepReportReq"
+                            "$ref": "#/definitions/mdb.ContactReq"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "send email code success",
                         "schema": {
-                            "type": "none"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/device/releaseStudyRoom": {
+        "/contact/sendVerifyCode": {
             "post": {
-                "description": "release study room",
+                "description": "发送验证码到联系人的手机",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "contact"
                 ],
-                "summary": "releaseStudyRoom",
+                "summary": "sendContactVerifyCode",
                 "parameters": [
                     {
                         "type": "string",
@@ -1866,18 +2172,18 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "release room",
+                        "description": "联系人id",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.ReleaseStudyRoomReq"
+                            "$ref": "#/definitions/mdb.ContactReq"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "release study room success\"}",
+                        "description": "send sms code success",
                         "schema": {
                             "type": "string"
                         }
@@ -1885,16 +2191,16 @@ const docTemplate = `{
                 }
             }
         },
-        "/device/removeSharedDevice": {
+        "/contact/updateContact": {
             "post": {
-                "description": "delete shared device",
+                "description": "修改紧急联系人, 修改手机号或邮箱后需要重新验证, 设为主联系人时取消其他联系人的主联系人标记.\n主联系人不能直接取消, 需要把其他联系人设为主联系人",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "contact"
                 ],
-                "summary": "removeSharedDevice",
+                "summary": "updateContact",
                 "parameters": [
                     {
                         "type": "string",
@@ -1903,35 +2209,35 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "delete share device",
+                        "description": "联系人, id必填",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.RemoveSharedDeviceReq"
+                            "$ref": "#/definitions/mysql.EmergencyContact"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "delete shared device successfully\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/mysql.EmergencyContact"
                         }
                     }
                 }
             }
         },
-        "/device/share": {
+        "/contact/verifyEmail": {
             "post": {
-                "description": "update user device",
+                "description": "校验联系人邮箱收到的验证码, 成功后可以发送邮件",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "contact"
                 ],
-                "summary": "shareDevice",
+                "summary": "verifyContactEmail",
                 "parameters": [
                     {
                         "type": "string",
@@ -1940,12 +2246,12 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "user device information",
+                        "description": "联系人id和验证码",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.ShareDeviceReq"
+                            "$ref": "#/definitions/mdb.ContactReq"
                         }
                     }
                 ],
@@ -1953,22 +2259,22 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserDevice"
+                            "$ref": "#/definitions/mysql.EmergencyContact"
                         }
                     }
                 }
             }
         },
-        "/device/shareDeviceToPhoneWithMac": {
+        "/contact/verifyPhone": {
             "post": {
-                "description": "share device to other user",
+                "description": "校验联系人手机收到的验证码, 成功后可以发送短信, 手机号注册的账号绑定了微信并关注公众号时可以发送公众号消息",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "contact"
                 ],
-                "summary": "shareDeviceToPhoneWithMac",
+                "summary": "verifyContactPhone",
                 "parameters": [
                     {
                         "type": "string",
@@ -1977,12 +2283,12 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "user device information",
+                        "description": "联系人id和验证码",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.ShareDeviceWithMacReq"
+                            "$ref": "#/definitions/mdb.ContactReq"
                         }
                     }
                 ],
@@ -1990,22 +2296,22 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserShareDevice"
+                            "$ref": "#/definitions/mysql.EmergencyContact"
                         }
                     }
                 }
             }
         },
-        "/device/sleepX1Switch": {
+        "/device/askEd713RealData": {
             "post": {
-                "description": "change sleep switch of X1 device",
+                "description": "ask Ed713 device to send real data",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "X1 device"
+                    "ED713 device"
                 ],
-                "summary": "sleepX1Switch",
+                "summary": "askEd713RealData",
                 "parameters": [
                     {
                         "type": "string",
@@ -2014,12 +2320,12 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "X1 switch",
+                        "description": "ack Ed713 info",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.SleepX1SwitchReq"
+                            "$ref": "#/definitions/mdb.AskEd713RealDataReq"
                         }
                     }
                 ],
@@ -2033,100 +2339,90 @@ const docTemplate = `{
                 }
             }
         },
-        "/device/statsHeartRateByMinute": {
-            "get": {
-                "description": "stats heart data per half of hour from heart rate table",
+        "/device/askX1RealData": {
+            "post": {
+                "description": "ask X1 device to send real data",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "sleep device"
+                    "X1 device"
                 ],
-                "summary": "statsHeartRateByMinute",
+                "summary": "askX1RealData",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "begin day, format yyyy-MM-dd",
-                        "name": "begin_day",
+                        "description": "token",
+                        "name": "token",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "end day, format yyyy-MM-dd",
-                        "name": "end_day",
-                        "in": "query"
+                        "description": "ack X1 info",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.AskX1RealDataReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mdb.StatsHeartRate"
+                            "type": "none"
                         }
                     }
                 }
             }
         },
-        "/device/statsLampFlowData": {
-            "get": {
-                "description": "统计台灯的心流数据，根据日期返回心流的比率数据",
+        "/device/cleanX1Event": {
+            "post": {
+                "description": "clean event from X1 device",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "lamp device"
+                    "X1 device"
                 ],
-                "summary": "statsLampFlowData",
+                "summary": "cleanX1Event",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "start time",
-                        "name": "start_time",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "end time",
-                        "name": "end_time",
-                        "in": "query",
-                        "required": true
+                        "description": "clean X1 event",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.CleanX1EventReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "int"
+                            "type": "none"
                         }
                     }
                 }
             }
         },
-        "/device/transferDeviceToPhoneWithMac": {
+        "/device/confirmSharedDevice": {
             "post": {
-                "description": "transfer device to other user",
+                "description": "confirm shared device",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "device"
                 ],
-                "summary": "transferDeviceToPhoneWithMac",
+                "summary": "confirmSharedDevice",
                 "parameters": [
                     {
                         "type": "string",
@@ -2135,35 +2431,35 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "user device information",
+                        "description": "confirm shared device request",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.TransferDeviceWithMacReq"
+                            "$ref": "#/definitions/mdb.ConfirmSharedReq"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Confirmed successfully\"}",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserDevice"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/device/update": {
+        "/device/confirmTransferDevice": {
             "post": {
-                "description": "update user device",
+                "description": "confirmed transfer device to other user",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "device"
                 ],
-                "summary": "updateDevice",
+                "summary": "confirmTransferDevice",
                 "parameters": [
                     {
                         "type": "string",
@@ -2172,35 +2468,35 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "user device information",
+                        "description": "confirmed transfer device",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.UpdateDeviceReq"
+                            "$ref": "#/definitions/mdb.ConfirmTransferReq"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Confirmed successfully\"}",
                         "schema": {
-                            "$ref": "#/definitions/mysql.Device"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/device/updateDeviceOverview": {
+        "/device/controlLamp": {
             "post": {
-                "description": "更新设备概况",
+                "description": "control lamp status",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "device"
+                    "lamp device"
                 ],
-                "summary": "updateDeviceOverview",
+                "summary": "controlLamp",
                 "parameters": [
                     {
                         "type": "string",
@@ -2209,12 +2505,12 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "概况数据",
+                        "description": "control lamp",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.DeviceOverviewReq"
+                            "$ref": "#/definitions/mdb.ControlLampReq"
                         }
                     }
                 ],
@@ -2222,22 +2518,22 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.DeviceOverview"
+                            "type": "none"
                         }
                     }
                 }
             }
         },
-        "/h03/askH03Reboot": {
+        "/device/createStudyRoom": {
             "post": {
-                "description": "ask H03 device to reboot",
+                "description": "create study room",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "room"
                 ],
-                "summary": "askH03Reboot",
+                "summary": "createStudyRoom",
                 "parameters": [
                     {
                         "type": "string",
@@ -2246,12 +2542,12 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "reboot information",
+                        "description": "room information",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.H03RebootReq"
+                            "$ref": "#/definitions/mdb.CreateStudyRoomReq"
                         }
                     }
                 ],
@@ -2259,22 +2555,22 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "$ref": "#/definitions/mysql.StudyRoom"
                         }
                     }
                 }
             }
         },
-        "/h03/askH03SyncVersion": {
+        "/device/improveDisturbed": {
             "post": {
-                "description": "ask H03 device to sync version",
+                "description": "import x1 device disturbed data",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "X1 device"
                 ],
-                "summary": "askH03SyncVersion",
+                "summary": "improveDisturbed",
                 "parameters": [
                     {
                         "type": "string",
@@ -2283,11 +2579,13 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "X1 distrube switch",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ImproveDisturbedReq"
+                        }
                     }
                 ],
                 "responses": {
@@ -2300,161 +2598,201 @@ const docTemplate = `{
                 }
             }
         },
-        "/h03/queryH03CurDayFocusStatus": {
-            "get": {
-                "description": "查询H03当天的专注状态",
+        "/device/insert": {
+            "post": {
+                "description": "insert user device",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "device"
                 ],
-                "summary": "queryH03CurDayFocusStatus",
+                "summary": "insertDevice",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user device information",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.NewDeviceReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mdb.H03CurDayFocusStatus"
+                            "$ref": "#/definitions/mysql.UserDevice"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03CurrentDayStudyTimeDetail": {
-            "get": {
-                "description": "查询H03当天学习时长的详情数据",
+        "/device/insertFallParams": {
+            "post": {
+                "description": "query fall check device install params",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "fall check device"
                 ],
-                "summary": "queryH03CurrentDayStudyTimeDetail",
+                "summary": "insertFallParams",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "fall check device params",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mysql.FallParams"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mdb.H03CurrentDayStudyTimeDetail"
+                            "$ref": "#/definitions/mysql.FallParams"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03LatestAttrs": {
-            "get": {
-                "description": "查询H03属性",
+        "/device/modifySharedDeviceRemark": {
+            "post": {
+                "description": "modify shared device remark",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "device"
                 ],
-                "summary": "queryH03LatestAttrs",
+                "summary": "modifySharedDeviceRemark",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "modify share device remark",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ModifySharedDeviceRemarkReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.H03AttrData"
+                            "$ref": "#/definitions/mysql.UserShareDevice"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03LatestStudyStatus": {
-            "get": {
-                "description": "查询H03学习状态",
+        "/device/modifyStudyRoom": {
+            "post": {
+                "description": "修改自习室信息",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "room"
                 ],
-                "summary": "queryH03LatestStudyStatus",
+                "summary": "modifyStudyRoom",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "room information",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ModifyStudyRoomReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "修改成功\"}",
                         "schema": {
-                            "$ref": "#/definitions/mysql.H03Event"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03ReportSwitch": {
-            "get": {
-                "description": "根据mac查报告开关设置",
+        "/device/openLampRealData": {
+            "post": {
+                "description": "query fall check device install params",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "lamp device"
                 ],
-                "summary": "queryH03ReportSwitch",
+                "summary": "openLampRealData",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "lamp real data",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.LampRealDataReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.H03ReportSwitchSetting"
+                            "type": "none"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03StudyReport": {
+        "/device/queryAlarmRecord": {
             "get": {
-                "description": "根据日期查询H03学习报告",
+                "description": "query alarm record report from fall check device",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "fall check device"
                 ],
-                "summary": "queryH03StudyReport",
+                "summary": "queryAlarmRecord",
                 "parameters": [
                     {
                         "type": "string",
@@ -2465,40 +2803,75 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "start_day",
-                        "name": "start_day",
-                        "in": "query",
-                        "required": true
+                        "description": "begin day, format yyyy-MM-dd",
+                        "name": "begin_day",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "end_day",
+                        "description": "end day, format yyyy-MM-dd",
                         "name": "end_day",
-                        "in": "query",
-                        "required": true
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number, start from 1",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, default 10",
+                        "name": "pageSize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "keyset cursor, empty for first page, then next_cursor of last page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "cursor order, asc or desc, default the order of the api",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "0: do not count total records",
+                        "name": "with_total",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mdb.H03StudyReportResp"
+                            "$ref": "#/definitions/mysql.FallAlarm"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03Version": {
+        "/device/queryBindByMac": {
             "get": {
-                "description": "查询H03版本",
+                "description": "query device has bind by mac",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "device"
                 ],
-                "summary": "queryH03Version",
+                "summary": "queryBindByMac",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
                     {
                         "type": "string",
                         "description": "device mac address",
@@ -2511,34 +2884,27 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mdb.H03VersionResp"
+                            "$ref": "#/definitions/mdb.DeviceBindResp"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03WarningEventStatDaily": {
+        "/device/queryById": {
             "get": {
-                "description": "根据mac以及日期查询一周七天每天的告警事件统计次数",
+                "description": "query device infomaion",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "device"
                 ],
-                "summary": "queryH03WarningEventStatDaily",
+                "summary": "queryById",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "查询的日期",
-                        "name": "daily_date",
+                        "type": "integer",
+                        "description": "device id",
+                        "name": "id",
                         "in": "query",
                         "required": true
                     }
@@ -2547,34 +2913,34 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.H03WarningEventNotifyDailyStat"
+                            "$ref": "#/definitions/mysql.Device"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03WarningEventStatWeekly": {
+        "/device/queryByUser": {
             "get": {
-                "description": "根据mac以及日期查询一周告警事件统计次数",
+                "description": "query device infomaion by user id",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "device"
                 ],
-                "summary": "queryH03WarningEventStatWeekly",
+                "summary": "queryByUser",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "device mac address",
-                        "name": "mac",
+                        "type": "integer",
+                        "description": "user id",
+                        "name": "user_id",
                         "in": "query",
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "周报日期",
-                        "name": "week_date",
+                        "type": "integer",
+                        "description": "flag",
+                        "name": "flag",
                         "in": "query",
                         "required": true
                     }
@@ -2583,174 +2949,167 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.H03WarningEventNotifyWeekStat"
+                            "$ref": "#/definitions/mysql.Device"
                         }
                     }
                 }
             }
         },
-        "/h03/queryH03WeekReport": {
+        "/device/queryDateListInReport": {
             "get": {
-                "description": "根据mac以及日期查询周报告",
+                "description": "查詢报表中含有数据的日期列表",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "device"
                 ],
-                "summary": "queryH03WeekReport",
+                "summary": "queryDateListInReport",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "device mac address",
+                        "description": "mac address",
                         "name": "mac",
                         "in": "query",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "周报日期",
-                        "name": "week_date",
-                        "in": "query",
-                        "required": true
+                        "description": "begin day, format yyyy-MM-dd",
+                        "name": "begin_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end day, format yyyy-MM-dd",
+                        "name": "end_day",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mdb.H03WeekReportResp"
+                            "$ref": "#/definitions/mdb.QueryDateListResp"
                         }
                     }
                 }
             }
         },
-        "/h03/setH03Param": {
-            "post": {
-                "description": "set H03 control params",
+        "/device/queryDeviceOverview": {
+            "get": {
+                "description": "查询设备的概览数据",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "device"
                 ],
-                "summary": "setH03Param",
+                "summary": "queryDeviceOverview",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "params settting",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.H03SettingReq"
-                        }
+                        "description": "mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "$ref": "#/definitions/mysql.DeviceOverview"
                         }
                     }
                 }
             }
         },
-        "/h03/setH03ReportSwitch": {
-            "post": {
-                "description": "set H03 report setting",
+        "/device/queryFallCheckStatus": {
+            "get": {
+                "description": "query fall check data",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "H03"
+                    "fall check device"
                 ],
-                "summary": "setH03ReportSwitch",
+                "summary": "queryFallCheckStatus",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "params settting",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.H03SwitchSettingReq"
-                        }
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "$ref": "#/definitions/mysql.FallCheck"
                         }
                     }
                 }
             }
         },
-        "/notify/notifySetting": {
-            "post": {
-                "description": "set params for notify",
+        "/device/queryFallExistRecord": {
+            "get": {
+                "description": "query fall check data if has person exist",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Notify"
+                    "fall check device"
                 ],
-                "summary": "notifySetting",
+                "summary": "queryFallExistRecord",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
-                        "name": "token",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "begin day, format yyyy-MM-dd",
+                        "name": "begin_day",
                         "in": "query"
                     },
                     {
-                        "description": "people notify setting",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mysql.NotifySetting"
-                        }
+                        "type": "string",
+                        "description": "end day, format yyyy-MM-dd",
+                        "name": "end_day",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "$ref": "#/definitions/mysql.FallCheck"
                         }
                     }
                 }
             }
         },
-        "/notify/queryAllNotifySetting": {
+        "/device/queryFallParams": {
             "get": {
-                "description": "query params for notify setting",
+                "description": "query fall check device install params",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Notify"
+                    "fall check device"
                 ],
-                "summary": "queryAllNotifySetting",
+                "summary": "queryFallParams",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "mac address",
-                        "name": "mac",
+                        "type": "integer",
+                        "description": "device id",
+                        "name": "device_id",
                         "in": "query",
                         "required": true
                     }
@@ -2759,113 +3118,2243 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.NotifySetting"
+                            "$ref": "#/definitions/mysql.FallParams"
                         }
                     }
                 }
             }
         },
-        "/notify/queryNotifySettingByType": {
+        "/device/queryHeartRate": {
             "get": {
-                "description": "query params for notify setting",
+                "description": "query heart data from heart rate table",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Notify"
+                    "sleep device"
                 ],
-                "summary": "queryNotifySetting",
+                "summary": "queryHeartRate",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "mac address",
+                        "description": "device mac address",
                         "name": "mac",
                         "in": "query",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "begin day, format yyyy-MM-dd",
+                        "name": "begin_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end day, format yyyy-MM-dd",
+                        "name": "end_day",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "notify type",
-                        "name": "type",
-                        "in": "query",
-                        "required": true
+                        "description": "page number, start from 1",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, default 10",
+                        "name": "pageSize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "keyset cursor, empty for first page, then next_cursor of last page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "cursor order, asc or desc, default the order of the api",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "0: do not count total records",
+                        "name": "with_total",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.NotifySetting"
+                            "$ref": "#/definitions/mysql.HeartRate"
                         }
                     }
                 }
             }
         },
-        "/setting/insertBanner": {
-            "post": {
-                "description": "insert banner picture into database",
+        "/device/queryInviteStudyRoom": {
+            "get": {
+                "description": "query invited study room by create user",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "setting"
+                    "room"
                 ],
-                "summary": "insertBanner",
+                "summary": "queryInviteStudyRoom",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "banner settting",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mysql.BannerSetting"
-                        }
+                        "type": "integer",
+                        "description": "user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "none"
+                            "$ref": "#/definitions/mysql.StudyRoomUserDetail"
                         }
                     }
                 }
             }
         },
-        "/setting/queryBanner": {
+        "/device/queryLampControl": {
             "get": {
-                "description": "查询banner图片",
+                "description": "query lamp control data by mac",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "setting"
+                    "lamp device"
+                ],
+                "summary": "queryLampControl",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
                 ],
-                "summary": "queryBanner",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.BannerSetting"
+                            "$ref": "#/definitions/mysql.LampControlSql"
                         }
                     }
                 }
             }
         },
-        "/upload/picture": {
-            "post": {
-                "description": "上传图片接口",
+        "/device/queryLampEvent": {
+            "get": {
+                "description": "query lamp device real-data by mac and time",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "uploader"
+                    "lamp device"
+                ],
+                "summary": "queryLampEvent",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "begin day",
+                        "name": "begin_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end day",
+                        "name": "end_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number, start from 1",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, default 10",
+                        "name": "pageSize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "keyset cursor, empty for first page, then next_cursor of last page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "cursor order, asc or desc, default the order of the api",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "0: do not count total records",
+                        "name": "with_total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.EventReportSql"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryLampRealData": {
+            "get": {
+                "description": "query lamp device real-data by mac and time",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "lamp device"
+                ],
+                "summary": "queryLampRealData",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "begin day",
+                        "name": "begin_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end day",
+                        "name": "end_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number, start from 1",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, default 10",
+                        "name": "pageSize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "keyset cursor, empty for first page, then next_cursor of last page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "cursor order, asc or desc, default the order of the api",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "0: do not count total records",
+                        "name": "with_total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.RealDataSql"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryLampReportStatus": {
+            "get": {
+                "description": "query lamp device report by mac and date",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "lamp device"
+                ],
+                "summary": "queryLampReportStatus",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "begin day",
+                        "name": "begin_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end day",
+                        "name": "end_day",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.LampReportStatus"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryRankingByStudyRoom": {
+            "get": {
+                "description": "查询自习室排行数据，查询条件自习室id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "room"
+                ],
+                "summary": "queryRankingByStudyRoom",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "room id",
+                        "name": "room_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.StudyRoomRanking"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryShareUsers": {
+            "get": {
+                "description": "query users to which device shared",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "queryShareUsers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "login user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserShareDeviceDetail"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/querySleepReport": {
+            "get": {
+                "description": "query sleep report data",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sleep device"
+                ],
+                "summary": "querySleepReport",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "begin day, format yyyy-MM-dd",
+                        "name": "begin_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end day, format yyyy-MM-dd",
+                        "name": "end_day",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.SleepReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryStudyRoom": {
+            "get": {
+                "description": "query study room by create user id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "room"
+                ],
+                "summary": "queryStudyRoom",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user id in study room",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.StudyRoom"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryTransferUsers": {
+            "get": {
+                "description": "query users to which device transfered",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "queryTransferUsers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "login user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserTransferDeviceDetail"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryUnconfirmedShareDevices": {
+            "get": {
+                "description": "query unconfirmed share devices",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "queryUnconfirmedShareDevices",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "login user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备mac地址",
+                        "name": "mac",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserShareDeviceDetail"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryUnconfirmedTransferDevices": {
+            "get": {
+                "description": "query unconfirmed transfered devices",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "queryUnconfirmedTransferDevices",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "login user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserTransferDeviceDetail"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryX1RealDataJson": {
+            "get": {
+                "description": "query X1 real data in json format",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "X1 device"
+                ],
+                "summary": "queryX1RealDataJson",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "create date",
+                        "name": "create_date",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.X1RealDataOrigin"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/queryX1SleepReportJson": {
+            "get": {
+                "description": "query X1 sleep report in json format",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "X1 device"
+                ],
+                "summary": "queryX1SleepReportJson",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "create date",
+                        "name": "create_date",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.X1DayReportOrigin"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/recoverX1SleepReport": {
+            "post": {
+                "description": "recover x1 device sleep report from json table",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "X1 device"
+                ],
+                "summary": "recoverX1SleepReport",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "X1 sleep report",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.RecoverX1SleepReportReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "none"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/releaseStudyRoom": {
+            "post": {
+                "description": "release study room",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "room"
+                ],
+                "summary": "releaseStudyRoom",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "release room",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ReleaseStudyRoomReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "release study room success\"}",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/removeSharedDevice": {
+            "post": {
+                "description": "delete shared device",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "removeSharedDevice",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "delete share device",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.RemoveSharedDeviceReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "delete shared device successfully\"}",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/share": {
+            "post": {
+                "description": "update user device",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "shareDevice",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user device information",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ShareDeviceReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserDevice"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/shareDeviceToPhoneWithMac": {
+            "post": {
+                "description": "share device to other user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "shareDeviceToPhoneWithMac",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user device information",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ShareDeviceWithMacReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserShareDevice"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/sleepX1Switch": {
+            "post": {
+                "description": "change sleep switch of X1 device",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "X1 device"
+                ],
+                "summary": "sleepX1Switch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "X1 switch",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.SleepX1SwitchReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "none"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/statsHeartRateByMinute": {
+            "get": {
+                "description": "stats heart data per half of hour from heart rate table",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sleep device"
+                ],
+                "summary": "statsHeartRateByMinute",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "begin day, format yyyy-MM-dd",
+                        "name": "begin_day",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end day, format yyyy-MM-dd",
+                        "name": "end_day",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.StatsHeartRate"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/statsLampFlowData": {
+            "get": {
+                "description": "统计台灯的心流数据，根据日期返回心流的比率数据",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "lamp device"
+                ],
+                "summary": "statsLampFlowData",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "start time",
+                        "name": "start_time",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "end time",
+                        "name": "end_time",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "int"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/transferDeviceToPhoneWithMac": {
+            "post": {
+                "description": "transfer device to other user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "transferDeviceToPhoneWithMac",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user device information",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.TransferDeviceWithMacReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserDevice"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/update": {
+            "post": {
+                "description": "update user device",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "updateDevice",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user device information",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.UpdateDeviceReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.Device"
+                        }
+                    }
+                }
+            }
+        },
+        "/device/updateDeviceOverview": {
+            "post": {
+                "description": "更新设备概况",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "device"
+                ],
+                "summary": "updateDeviceOverview",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "概况数据",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.DeviceOverviewReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.DeviceOverview"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/askH03Reboot": {
+            "post": {
+                "description": "ask H03 device to reboot",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "askH03Reboot",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "reboot information",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03RebootReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "none"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/askH03SyncVersion": {
+            "post": {
+                "description": "ask H03 device to sync version",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "askH03SyncVersion",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "none"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03CurDayFocusStatus": {
+            "get": {
+                "description": "查询H03当天的专注状态",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03CurDayFocusStatus",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03CurDayFocusStatus"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03CurrentDayStudyTimeDetail": {
+            "get": {
+                "description": "查询H03当天学习时长的详情数据",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03CurrentDayStudyTimeDetail",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03CurrentDayStudyTimeDetail"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03LatestAttrs": {
+            "get": {
+                "description": "查询H03属性",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03LatestAttrs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.H03AttrData"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03LatestStudyStatus": {
+            "get": {
+                "description": "查询H03学习状态",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03LatestStudyStatus",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.H03Event"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03ReportSwitch": {
+            "get": {
+                "description": "根据mac查报告开关设置",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03ReportSwitch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.H03ReportSwitchSetting"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03StudyReport": {
+            "get": {
+                "description": "根据日期查询H03学习报告",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03StudyReport",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "start_day",
+                        "name": "start_day",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "end_day",
+                        "name": "end_day",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03StudyReportResp"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03StudyReportByTime": {
+            "get": {
+                "description": "根据日期查询H03学习报告，根据时间查询",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03StudyReportByTime",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "start_time",
+                        "name": "start_time",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "end_time",
+                        "name": "end_time",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03StudyReportResp"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03Version": {
+            "get": {
+                "description": "查询H03版本",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03Version",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03VersionResp"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03WarningEventStatDaily": {
+            "get": {
+                "description": "根据mac以及日期查询一周七天每天的告警事件统计次数",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03WarningEventStatDaily",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "查询的日期",
+                        "name": "daily_date",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.H03WarningEventNotifyDailyStat"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03WarningEventStatWeekly": {
+            "get": {
+                "description": "根据mac以及日期查询一周告警事件统计次数",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03WarningEventStatWeekly",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "周报日期",
+                        "name": "week_date",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.H03WarningEventNotifyWeekStat"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/queryH03WeekReport": {
+            "get": {
+                "description": "根据mac以及日期查询周报告",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "queryH03WeekReport",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "device mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "周报日期",
+                        "name": "week_date",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03WeekReportResp"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/setH03Param": {
+            "post": {
+                "description": "set H03 control params",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "setH03Param",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "params settting",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03SettingReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "none"
+                        }
+                    }
+                }
+            }
+        },
+        "/h03/setH03ReportSwitch": {
+            "post": {
+                "description": "set H03 report setting",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "H03"
+                ],
+                "summary": "setH03ReportSwitch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "params settting",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.H03SwitchSettingReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "none"
+                        }
+                    }
+                }
+            }
+        },
+        "/notify/inbox": {
+            "get": {
+                "description": "分页查询用户收到的通知, 最新的在前. status 1:发送成功 2:发送失败 3:被免打扰、去重或每日上限拦截",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notify"
+                ],
+                "summary": "queryInbox",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "用户id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "0:未读 1:已读, 不传时查询全部",
+                        "name": "is_read",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "事件类型",
+                        "name": "event_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页号",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页记录数",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.NotifyMessage"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/notify/inbox/markRead": {
+            "post": {
+                "description": "把用户的通知标记为已读, ids为空时标记所有未读通知, 返回标记后的未读数",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notify"
+                ],
+                "summary": "markInboxRead",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "用户id和通知id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.InboxReadReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.InboxUnread"
+                        }
+                    }
+                }
+            }
+        },
+        "/notify/inbox/unreadCount": {
+            "get": {
+                "description": "查询用户的未读通知数",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notify"
+                ],
+                "summary": "queryInboxUnreadCount",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "用户id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.InboxUnread"
+                        }
+                    }
+                }
+            }
+        },
+        "/notify/notifySetting": {
+            "post": {
+                "description": "set params for notify",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notify"
+                ],
+                "summary": "notifySetting",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "people notify setting",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mysql.NotifySetting"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "none"
+                        }
+                    }
+                }
+            }
+        },
+        "/notify/queryAllNotifySetting": {
+            "get": {
+                "description": "query params for notify setting",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notify"
+                ],
+                "summary": "queryAllNotifySetting",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.NotifySetting"
+                        }
+                    }
+                }
+            }
+        },
+        "/notify/queryNotifySettingByType": {
+            "get": {
+                "description": "query params for notify setting",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notify"
+                ],
+                "summary": "queryNotifySetting",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mac address",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "notify type",
+                        "name": "type",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.NotifySetting"
+                        }
+                    }
+                }
+            }
+        },
+        "/notify/queryPreference": {
+            "get": {
+                "description": "查询用户的通知偏好, 没有设置时返回缺省值",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notify"
+                ],
+                "summary": "queryNotifyPreference",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "用户id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.NotifyPreference"
+                        }
+                    }
+                }
+            }
+        },
+        "/notify/updatePreference": {
+            "post": {
+                "description": "设置用户的通知偏好. quiet_start/quiet_end为免打扰时段, 格式15:04, 配置的严重报警不受免打扰和每日上限限制.\ndedup_window为同一事件和设备的去重窗口(秒), daily_cap为每个通道每天最多条数, 0使用缺省配置.\ndigest为1时被拦截的通知在免打扰结束后合并成一条摘要发送, 为0时丢弃",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notify"
+                ],
+                "summary": "updateNotifyPreference",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "通知偏好",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mysql.NotifyPreference"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.NotifyPreference"
+                        }
+                    }
+                }
+            }
+        },
+        "/rule/addRule": {
+            "post": {
+                "description": "添加指标规则, 设备上报数据时判断, 条件持续sustain分钟后执行动作.\noperator为gt/ge/lt/le/eq/ne/between/outside, between和outside使用value和value2.\nactions为逗号分隔的动作notify/webhook/command, command时填写command和command_params, 只有设备的拥有者可以使用command.\nactive_start/active_end为生效时段, 格式15:04, 都为空时全天生效. 条件一直满足时每cooldown分钟触发一次",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rule"
+                ],
+                "summary": "addRule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "规则",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mysql.MetricRule"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.MetricRule"
+                        }
+                    }
+                }
+            }
+        },
+        "/rule/deleteRule": {
+            "post": {
+                "description": "删除指标规则",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rule"
+                ],
+                "summary": "deleteRule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "规则id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.MetricRuleReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "delete metric rule success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rule/queryMetrics": {
+            "get": {
+                "description": "查询设备可以定义规则的指标",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rule"
+                ],
+                "summary": "queryRuleMetrics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备mac",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mdb.RuleMetricsResp"
+                        }
+                    }
+                }
+            }
+        },
+        "/rule/queryRules": {
+            "get": {
+                "description": "查询用户定义的指标规则, 可以按设备过滤",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rule"
+                ],
+                "summary": "queryRules",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "用户id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备mac",
+                        "name": "mac",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.MetricRule"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/rule/updateRule": {
+            "post": {
+                "description": "修改指标规则, 规则的用户和设备不能修改, 只有设备的拥有者可以使用command. 解除共享、移除和过户设备时删除不能再使用设备的用户的规则",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rule"
+                ],
+                "summary": "updateRule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "规则, id必填",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mysql.MetricRule"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.MetricRule"
+                        }
+                    }
+                }
+            }
+        },
+        "/setting/insertBanner": {
+            "post": {
+                "description": "insert banner picture into database",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "setting"
+                ],
+                "summary": "insertBanner",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "banner settting",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mysql.BannerSetting"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "none"
+                        }
+                    }
+                }
+            }
+        },
+        "/setting/queryBanner": {
+            "get": {
+                "description": "查询banner图片",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "setting"
+                ],
+                "summary": "queryBanner",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.BannerSetting"
+                        }
+                    }
+                }
+            }
+        },
+        "/sms/report/{provider}": {
+            "post": {
+                "description": "短信供应商推送的发送回执, 阿里云推送地址需要带配置的token, http供应商按X-Twilio-Signature签名校验.\n返回{\"code\":0}表示接收成功",
+                "consumes": [
+                    "application/json",
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sms"
+                ],
+                "summary": "smsReport",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "供应商 aliyun/http/mock",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "阿里云回执的token",
+                        "name": "token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
+        "/stream/sse": {
+            "get": {
+                "description": "subscribe real time data of devices by server-sent events, each event data is stream.Message,\nmac can be repeated up to 20 times, the caller must be able to access every device.\naccess is checked again every minute, the connection is closed with a revoked event when the token expires,\nthe session is revoked or a device is no longer shared, the client should refresh the token and reconnect",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Stream"
+                ],
+                "summary": "streamSse",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "device mac",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/stream.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream/ws": {
+            "get": {
+                "description": "subscribe real time data of devices by websocket, each message is stream.Message,\nmac can be repeated up to 20 times, the caller must be able to access every device.\naccess is checked again every minute, the connection is closed when the token expires,\nthe session is revoked or a device is no longer shared, the client should refresh the token and reconnect",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stream"
+                ],
+                "summary": "streamWebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "device mac",
+                        "name": "mac",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/stream.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/upload/picture": {
+            "post": {
+                "description": "上传图片接口",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploader"
                 ],
                 "summary": "uploadPicFun",
                 "parameters": [
@@ -2876,41 +5365,407 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "type": "file",
-                        "description": "file to upload",
-                        "name": "file",
-                        "in": "formData",
-                        "required": true
+                        "type": "file",
+                        "description": "file to upload",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/addUserToStudyRoom": {
+            "post": {
+                "description": "add user id to study room",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "room"
+                ],
+                "summary": "addUserToStudyRoom",
+                "parameters": [
+                    {
+                        "description": "add user to study room",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.UserToStudyRoomReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.StudyRoomUser"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/deleteUser": {
+            "post": {
+                "description": "delete user from server",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "deleteUser",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.DeleteUserReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "delete user ok\"\"}",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/downloadUserData": {
+            "get": {
+                "description": "下载用户数据导出文件",
+                "produces": [
+                    "application/zip"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "downloadUserData",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "任务id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "download_key",
+                        "name": "key",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/enterStudyRoom": {
+            "post": {
+                "description": "用户进入已邀请的自习室",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "room"
+                ],
+                "summary": "enterStudyRoom",
+                "parameters": [
+                    {
+                        "description": "study info",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.UserEnterStudyReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserStudyRecord"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/eraseUserData": {
+            "post": {
+                "description": "创建用户数据删除任务, 异步删除或匿名化用户的所有数据, 需要提供用户密码, 或者purpose为erase_data的短信/邮箱验证码",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "eraseUserData",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "用户id和密码或验证码",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.UserDataJobReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserDataJob"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/exportUserData": {
+            "post": {
+                "description": "创建用户数据导出任务, 异步生成包含用户所有数据的zip文件",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "exportUserData",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "用户id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.UserDataJobReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserDataJob"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/insertUserFriend": {
+            "post": {
+                "description": "insert user's friend",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "insertUserFriend",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "friend info",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.InsertUserFriendReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.UserFriend"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/leaveStudyRoom": {
+            "post": {
+                "description": "用户离开已邀请的自习室",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "room"
+                ],
+                "summary": "leaveStudyRoom",
+                "parameters": [
+                    {
+                        "description": "study info",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.UserEnterStudyReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "leave room success\"}",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/loginout": {
+            "post": {
+                "description": "login out from server",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "loginout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.LoginoutReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.User"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/modifyEmail": {
+            "post": {
+                "description": "modify user email, 需要发送到新邮箱的验证码",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "modifyEmail",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user email",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.NewEmail"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/mysql.User"
                         }
                     }
                 }
             }
         },
-        "/user/addUserToStudyRoom": {
+        "/user/modifyEmergentPhone": {
             "post": {
-                "description": "add user id to study room",
+                "description": "modify user emergent phone, 只在没有紧急联系人时用于短信通知, 新的客户端使用/contact接口",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "user"
                 ],
-                "summary": "addUserToStudyRoom",
+                "summary": "modifyEmergentPhone",
                 "parameters": [
                     {
-                        "description": "add user to study room",
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user information",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.UserToStudyRoomReq"
+                            "$ref": "#/definitions/mdb.NewPhone"
                         }
                     }
                 ],
@@ -2918,22 +5773,22 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.StudyRoomUser"
+                            "$ref": "#/definitions/mysql.User"
                         }
                     }
                 }
             }
         },
-        "/user/deleteUser": {
+        "/user/modifyLocale": {
             "post": {
-                "description": "delete user from server",
+                "description": "modify user locale, 通知按该语言选择模板, 为空时使用缺省语言",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "deleteUser",
+                "summary": "modifyLocale",
                 "parameters": [
                     {
                         "type": "string",
@@ -2942,81 +5797,256 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "description": "user id",
+                        "description": "user locale",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.DeleteUserReq"
+                            "$ref": "#/definitions/mdb.NewLocale"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "delete user ok\"\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/mysql.User"
                         }
                     }
                 }
             }
         },
-        "/user/enterStudyRoom": {
+        "/user/modifyPasswd": {
             "post": {
-                "description": "用户进入已邀请的自习室",
+                "description": "modify user passwd, 需要校验旧密码, 修改后其他登录会话失效",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "user"
                 ],
-                "summary": "enterStudyRoom",
+                "summary": "modifyPasswd",
                 "parameters": [
                     {
-                        "description": "study info",
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user new passwd",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.UserEnterStudyReq"
+                            "$ref": "#/definitions/mdb.NewPasswd"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.User"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/modifyPhone": {
+            "post": {
+                "description": "modify user phone, 需要先用purpose=modify_phone给新手机号发送验证码",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "modifyPhone",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user information",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.NewPhone"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.User"
                         }
                     }
+                }
+            }
+        },
+        "/user/modifyUserFriend": {
+            "post": {
+                "description": "modify user's friend",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "modifyUserFriend",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "modify friend request",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ModifyFriendReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "modify user friend ok\"\"}",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/offline": {
+            "post": {
+                "description": "set user offline",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "offline",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user id",
+                        "name": "id",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "integer"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.User"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/online": {
+            "post": {
+                "description": "set user online",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "online",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user id",
+                        "name": "id",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "integer"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/mysql.User"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/queryById": {
+            "get": {
+                "description": "query user by id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "queryById",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserStudyRecord"
+                            "$ref": "#/definitions/mysql.User"
                         }
                     }
                 }
             }
         },
-        "/user/insertUserFriend": {
-            "post": {
-                "description": "insert user's friend",
+        "/user/queryFriendsByUser": {
+            "get": {
+                "description": "query user's friend",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "insertUserFriend",
+                "summary": "queryFriendsByUser",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "friend info",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/api.InsertUserFriendReq"
-                        }
+                        "type": "integer",
+                        "description": "user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -3029,173 +6059,155 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/leaveStudyRoom": {
-            "post": {
-                "description": "用户离开已邀请的自习室",
+        "/user/queryLampUserInFriend": {
+            "get": {
+                "description": "查询好友中绑定灯的好友",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "room"
                 ],
-                "summary": "leaveStudyRoom",
+                "summary": "queryLampUserInFriend",
                 "parameters": [
                     {
-                        "description": "study info",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.UserEnterStudyReq"
-                        }
+                        "type": "integer",
+                        "description": "user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "leave room success\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/mysql.LampUserWithStudyRoom"
                         }
                     }
                 }
             }
         },
-        "/user/loginout": {
-            "post": {
-                "description": "login out from server",
+        "/user/queryLampUsersByRoom": {
+            "get": {
+                "description": "查询拥有灯的用户，条件自习室ID,id=0 时拥有灯控的所有用户",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "room"
                 ],
-                "summary": "loginout",
+                "summary": "queryLampUsersByRoom",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "user id",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.LoginoutReq"
-                        }
+                        "type": "integer",
+                        "description": "room id",
+                        "name": "room_id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "$ref": "#/definitions/mysql.LampUserWithStudyRoom"
                         }
                     }
                 }
             }
         },
-        "/user/modifyEmail": {
-            "post": {
-                "description": "modify user email",
+        "/user/querySessions": {
+            "get": {
+                "description": "查询当前用户所有有效的登录会话",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "modifyEmail",
+                "summary": "querySessions",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
+                        "description": "token, 也可以使用Authorization: Bearer头",
                         "name": "token",
                         "in": "query"
-                    },
-                    {
-                        "description": "user email",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.NewEmail"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/mysql.UserSession"
+                            }
                         }
                     }
                 }
             }
         },
-        "/user/modifyEmergentPhone": {
-            "post": {
-                "description": "modify user emergent phone",
+        "/user/queryStudyRoomUser": {
+            "get": {
+                "description": "query user list from study room",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "room"
                 ],
-                "summary": "modifyEmergentPhone",
+                "summary": "queryStudyRoomUser",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
+                        "type": "integer",
+                        "description": "create user id",
+                        "name": "create_id",
+                        "in": "query",
+                        "required": true
                     },
                     {
-                        "description": "user information",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.NewPhone"
-                        }
+                        "type": "integer",
+                        "description": "room id",
+                        "name": "room_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "flag 0:all 1:study user",
+                        "name": "flag",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "$ref": "#/definitions/mysql.StudyRoomUserDetail"
                         }
                     }
                 }
             }
         },
-        "/user/modifyPasswd": {
-            "post": {
-                "description": "modify user passwd",
+        "/user/queryUserByEmail": {
+            "get": {
+                "description": "query user by email, 完全匹配邮箱, 只返回调用者本人, 管理员可以查询所有用户",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "modifyPasswd",
+                "summary": "queryUserByEmail",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "user new passwd",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.NewPasswd"
-                        }
+                        "description": "user email",
+                        "name": "email",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -3208,31 +6220,23 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/modifyPhone": {
-            "post": {
-                "description": "modify user phone",
+        "/user/queryUserByPhone": {
+            "get": {
+                "description": "query user by phone, 完全匹配手机号, 只返回调用者本人, 管理员可以查询所有用户",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "modifyPhone",
+                "summary": "queryUserByPhone",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "user information",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.NewPhone"
-                        }
+                        "description": "user phone",
+                        "name": "phone",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -3245,132 +6249,150 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/modifyUserFriend": {
-            "post": {
-                "description": "modify user's friend",
+        "/user/queryUserDataJob": {
+            "get": {
+                "description": "查询用户数据导出或删除任务的状态, 导出完成时返回download_key",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "modifyUserFriend",
+                "summary": "queryUserDataJob",
                 "parameters": [
                     {
                         "type": "string",
                         "description": "token",
                         "name": "token",
-                        "in": "query"
+                        "in": "query",
+                        "required": true
                     },
                     {
-                        "description": "modify friend request",
-                        "name": "in",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/mdb.ModifyFriendReq"
-                        }
+                        "type": "integer",
+                        "description": "任务id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "modify user friend ok\"\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/mysql.UserDataJob"
                         }
                     }
                 }
             }
         },
-        "/user/offline": {
-            "post": {
-                "description": "set user offline",
+        "/user/queryUserOverview": {
+            "get": {
+                "description": "查询用户概况数据",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "offline",
+                "summary": "queryUserOverview",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
+                        "type": "integer",
                         "description": "user id",
-                        "name": "id",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "integer"
-                        }
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "$ref": "#/definitions/mdb.UserOverview"
                         }
                     }
                 }
             }
         },
-        "/user/online": {
-            "post": {
-                "description": "set user online",
+        "/user/queryUserStudyData": {
+            "get": {
+                "description": "查询用户自习的数据,包括自习时长，自习天数，平均时长，最长时间, 以及根据日期进行分组统计每天的自习时长",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "room"
                 ],
-                "summary": "online",
+                "summary": "queryUserStudyData",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "room id",
+                        "name": "room_id",
+                        "in": "query",
+                        "required": true
+                    },
                     {
                         "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
+                        "description": "start time",
+                        "name": "start_time",
+                        "in": "query",
+                        "required": true
                     },
                     {
-                        "description": "user id",
-                        "name": "id",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "integer"
-                        }
+                        "type": "string",
+                        "description": "end time",
+                        "name": "end_time",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "$ref": "#/definitions/mdb.UserStudyData"
                         }
                     }
                 }
             }
         },
-        "/user/queryById": {
+        "/user/queryUserStudyTimeByDay": {
             "get": {
-                "description": "query user by id",
+                "description": "查询用户学习时间段，根据指定日期查询",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "room"
                 ],
-                "summary": "queryById",
+                "summary": "queryUserStudyTimeByDay",
                 "parameters": [
                     {
                         "type": "integer",
                         "description": "user id",
-                        "name": "id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "room id",
+                        "name": "room_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "query date",
+                        "name": "query_date",
                         "in": "query",
                         "required": true
                     }
@@ -3379,420 +6401,407 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "$ref": "#/definitions/mysql.UserStudyTime"
                         }
                     }
                 }
             }
         },
-        "/user/queryFriendsByUser": {
-            "get": {
-                "description": "query user's friend",
+        "/user/refreshToken": {
+            "post": {
+                "description": "用refresh token换取新的access token和refresh token, 旧的refresh token失效",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "queryFriendsByUser",
+                "summary": "refreshToken",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "description": "refresh token",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.RefreshTokenReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserFriend"
+                            "$ref": "#/definitions/mysql.UserTokenPair"
                         }
                     }
                 }
             }
         },
-        "/user/queryLampUserInFriend": {
-            "get": {
-                "description": "查询好友中绑定灯的好友",
+        "/user/removeUserDevice": {
+            "post": {
+                "description": "remove user device",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "user"
                 ],
-                "summary": "queryLampUserInFriend",
+                "summary": "removeUserDevice",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "user device",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.RemoveUserDeviceReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "remove user device ok\"}",
                         "schema": {
-                            "$ref": "#/definitions/mysql.LampUserWithStudyRoom"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/user/queryLampUsersByRoom": {
-            "get": {
-                "description": "查询拥有灯的用户，条件自习室ID,id=0 时拥有灯控的所有用户",
+        "/user/removeUserFriend": {
+            "post": {
+                "description": "remove user's friend",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "user"
                 ],
-                "summary": "queryLampUsersByRoom",
+                "summary": "removeUserFriend",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "room id",
-                        "name": "room_id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "remove friend request",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.RemoveFriendReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "remove user friend ok\"\"}",
                         "schema": {
-                            "$ref": "#/definitions/mysql.LampUserWithStudyRoom"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/user/queryStudyRoomUser": {
-            "get": {
-                "description": "query user list from study room",
+        "/user/removeUserFromStudyRoom": {
+            "post": {
+                "description": "remove user id from study room",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "room"
                 ],
-                "summary": "queryStudyRoomUser",
+                "summary": "removeUserFromStudyRoom",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "create user id",
-                        "name": "create_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "room id",
-                        "name": "room_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "flag 0:all 1:study user",
-                        "name": "flag",
-                        "in": "query",
-                        "required": true
+                        "description": "remove user from study room",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.UserToStudyRoomReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.StudyRoomUserDetail"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/user/queryUserByEmail": {
-            "get": {
-                "description": "query user by email",
+        "/user/resetPasswd": {
+            "post": {
+                "description": "手机号验证码重置密码, 重置后所有登录会话失效",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "queryUserByEmail",
+                "summary": "resetPasswd",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "user email",
-                        "name": "email",
-                        "in": "query",
-                        "required": true
+                        "description": "手机号、验证码和新密码",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ResetPasswdReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "reset password success",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/user/queryUserByPhone": {
-            "get": {
-                "description": "query user by phone",
+        "/user/resetPasswdByEmail": {
+            "post": {
+                "description": "邮箱验证码重置密码, 重置后所有登录会话失效",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "queryUserByPhone",
+                "summary": "resetPasswdByEmail",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "user phone",
-                        "name": "phone",
-                        "in": "query",
-                        "required": true
+                        "description": "邮箱、验证码和新密码",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.ResetPasswdByEmailReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "reset password success",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/user/queryUserOverview": {
-            "get": {
-                "description": "查询用户概况数据",
+        "/user/revokeSession": {
+            "post": {
+                "description": "撤销当前用户的登录会话, session_id为空时撤销所有会话",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "queryUserOverview",
+                "summary": "revokeSession",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "token, 也可以使用Authorization: Bearer头",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "会话id",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.RevokeSessionReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "revoke session success",
                         "schema": {
-                            "$ref": "#/definitions/mdb.UserOverview"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/user/queryUserStudyData": {
-            "get": {
-                "description": "查询用户自习的数据,包括自习时长，自习天数，平均时长，最长时间, 以及根据日期进行分组统计每天的自习时长",
+        "/user/sendEmailCode": {
+            "post": {
+                "description": "发送邮箱验证码, 有效期10分钟, 同一邮箱60秒内只能发送一次",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
-                ],
-                "summary": "queryUserStudyData",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "room id",
-                        "name": "room_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "start time",
-                        "name": "start_time",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "end time",
-                        "name": "end_time",
-                        "in": "query",
-                        "required": true
+                    "user"
+                ],
+                "summary": "sendEmailCode",
+                "parameters": [
+                    {
+                        "description": "邮箱和用途",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.EmailCodeReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "send email code success",
                         "schema": {
-                            "$ref": "#/definitions/mdb.UserStudyData"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/user/queryUserStudyTimeByDay": {
-            "get": {
-                "description": "查询用户学习时间段，根据指定日期查询",
+        "/user/sendSmsCode": {
+            "post": {
+                "description": "发送短信验证码, 有效期5分钟, 同一手机号60秒内只能发送一次, 手机号是否注册都返回相同的结果",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "user"
                 ],
-                "summary": "queryUserStudyTimeByDay",
+                "summary": "sendSmsCode",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "user id",
-                        "name": "user_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "room id",
-                        "name": "room_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "query date",
-                        "name": "query_date",
-                        "in": "query",
-                        "required": true
+                        "description": "手机号和用途",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.SmsCodeReq"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "send sms code success",
                         "schema": {
-                            "$ref": "#/definitions/mysql.UserStudyTime"
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/user/removeUserDevice": {
+        "/user/smsLogin": {
             "post": {
-                "description": "remove user device",
+                "description": "手机号验证码登录, 和密码登录一样受账号锁定(-48)和IP封禁(-47)限制",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "removeUserDevice",
+                "summary": "smsLogin",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "user device",
+                        "description": "手机号和验证码",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/api.RemoveUserDeviceReq"
+                            "$ref": "#/definitions/mdb.SmsLoginReq"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "客户端设备id, 同一设备重新登录时撤销旧会话",
+                        "name": "X-Device-Id",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "客户端设备名称",
+                        "name": "X-Device-Name",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "remove user device ok\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/mdb.LoginResp"
                         }
                     }
                 }
             }
         },
-        "/user/removeUserFriend": {
+        "/user/smsRegister": {
             "post": {
-                "description": "remove user's friend",
+                "description": "手机号验证码注册, 使用手机号作为账号, 注册成功后直接登录",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "removeUserFriend",
+                "summary": "smsRegister",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "token",
-                        "name": "token",
-                        "in": "query"
-                    },
-                    {
-                        "description": "remove friend request",
+                        "description": "手机号、验证码、昵称和可选的密码",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.RemoveFriendReq"
+                            "$ref": "#/definitions/mdb.SmsRegisterReq"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "remove user friend ok\"\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/mdb.LoginResp"
                         }
                     }
                 }
             }
         },
-        "/user/removeUserFromStudyRoom": {
+        "/user/unlockAccount": {
             "post": {
-                "description": "remove user id from study room",
+                "description": "连续登录失败账号被锁定后, 用purpose=unlock的短信验证码解锁",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "room"
+                    "user"
                 ],
-                "summary": "removeUserFromStudyRoom",
+                "summary": "unlockAccount",
                 "parameters": [
                     {
-                        "description": "remove user from study room",
+                        "description": "手机号和验证码",
                         "name": "in",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/mdb.UserToStudyRoomReq"
+                            "$ref": "#/definitions/mdb.UnlockAccountReq"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "unlock account success",
                         "schema": {
                             "type": "string"
                         }
@@ -3802,7 +6811,7 @@ const docTemplate = `{
         },
         "/user/update": {
             "post": {
-                "description": "update user",
+                "description": "update user, email and email_verified are ignored, email is changed by /user/modifyEmail only",
                 "produces": [
                     "application/json"
                 ],
@@ -3987,7 +6996,7 @@ const docTemplate = `{
         },
         "/user/userLogin": {
             "post": {
-                "description": "login in",
+                "description": "login in, 旧的加密密码登录成功时迁移为哈希, 已标记为需要重置的账号返回-46,\n连续失败时需要等待(-47), 失败5次账号锁定30分钟(-48), 可以用短信验证码解锁",
                 "produces": [
                     "application/json"
                 ],
@@ -4004,13 +7013,25 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/mdb.LoginReq"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "客户端设备id, 同一设备重新登录时撤销旧会话",
+                        "name": "X-Device-Id",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "客户端设备名称",
+                        "name": "X-Device-Name",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mysql.User"
+                            "$ref": "#/definitions/mdb.LoginResp"
                         }
                     }
                 }
@@ -4018,7 +7039,7 @@ const docTemplate = `{
         },
         "/user/userRegister": {
             "post": {
-                "description": "user register",
+                "description": "user register, login_type为0时需要purpose为register的短信验证码, 为1时需要邮箱验证码",
                 "produces": [
                     "application/json"
                 ],
@@ -4032,10 +7053,47 @@ const docTemplate = `{
                         "name": "in",
                         "in": "body",
                         "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.UserRegisterReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/mysql.User"
                         }
                     }
+                }
+            }
+        },
+        "/user/verifyEmail": {
+            "post": {
+                "description": "验证用户当前的邮箱, 验证后才会发送邮件通知",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "verifyEmail",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "用户id和验证码",
+                        "name": "in",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/mdb.VerifyEmailReq"
+                        }
+                    }
                 ],
                 "responses": {
                     "200": {
@@ -4296,15 +7354,208 @@ const docTemplate = `{
                 }
             }
         },
-        "api.RemoveUserDeviceReq": {
+        "api.RemoveUserDeviceReq": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "description": "required: true\nexample: 1",
+                    "type": "integer"
+                },
+                "user_id": {
+                    "description": "required: true\nexample: 1",
+                    "type": "integer"
+                }
+            }
+        },
+        "mdb.AdminDeviceReq": {
+            "type": "object",
+            "properties": {
+                "mac": {
+                    "description": "required: true",
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.AdminRoleReq": {
+            "type": "object",
+            "properties": {
+                "role": {
+                    "description": "required: true\nuser/caregiver/support/admin",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "required: true",
+                    "type": "integer"
+                }
+            }
+        },
+        "mdb.AdminUser": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "type": "string"
+                },
+                "address": {
+                    "type": "string"
+                },
+                "born_date": {
+                    "type": "string"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "email_verified": {
+                    "description": "邮箱是否已经验证 0:未验证 1:已验证, 只给已验证的邮箱发送通知邮件",
+                    "type": "integer"
+                },
+                "emergent_phone": {
+                    "type": "string"
+                },
+                "face": {
+                    "type": "string"
+                },
+                "gender": {
+                    "description": "0 未知 1 男 2 女",
+                    "type": "integer"
+                },
+                "grade": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "is_login": {
+                    "type": "integer"
+                },
+                "locale": {
+                    "description": "首选语言, 如zh-CN、zh-HK、en, 用于选择通知模板, 为空时使用缺省语言",
+                    "type": "string"
+                },
+                "login_time": {
+                    "type": "string"
+                },
+                "login_type": {
+                    "description": "0:phone 1:email",
+                    "type": "integer"
+                },
+                "nick_name": {
+                    "type": "string"
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "room_num": {
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.AdminUserReq": {
+            "type": "object",
+            "properties": {
+                "user_id": {
+                    "description": "required: true",
+                    "type": "integer"
+                }
+            }
+        },
+        "mdb.AlarmReq": {
+            "type": "object",
+            "properties": {
+                "alarm_id": {
+                    "type": "integer"
+                },
+                "note": {
+                    "description": "确认或恢复的备注",
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.ApiKeyReq": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "更新和撤销时使用",
+                    "type": "integer"
+                },
+                "macs": {
+                    "description": "允许访问的设备mac",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "org_id": {
+                    "description": "创建时使用",
+                    "type": "integer"
+                },
+                "rate_limit": {
+                    "description": "每分钟最多请求数, 0使用缺省限额",
+                    "type": "integer"
+                },
+                "scopes": {
+                    "description": "vitals:read/reports:read/alarms:receive/devices:control",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "mdb.ApiKeyResp": {
             "type": "object",
             "properties": {
-                "device_id": {
-                    "description": "required: true\nexample: 1",
+                "create_time": {
+                    "type": "string"
+                },
+                "id": {
                     "type": "integer"
                 },
-                "user_id": {
-                    "description": "required: true\nexample: 1",
+                "key": {
+                    "description": "明文key, 只在创建时返回一次",
+                    "type": "string"
+                },
+                "key_prefix": {
+                    "description": "明文key的前缀, 用于查找和显示",
+                    "type": "string"
+                },
+                "last_used_time": {
+                    "type": "string"
+                },
+                "macs": {
+                    "description": "允许访问的设备mac, 逗号分隔",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "operator_id": {
+                    "type": "integer"
+                },
+                "org_id": {
+                    "type": "integer"
+                },
+                "rate_limit": {
+                    "description": "每分钟最多请求数, 0使用缺省限额",
+                    "type": "integer"
+                },
+                "revoke_time": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "description": "授权范围, 逗号分隔",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "0:已撤销 1:有效",
                     "type": "integer"
                 }
             }
@@ -4382,6 +7633,19 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.ContactReq": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "短信或邮箱验证码, 验证手机号和邮箱时需要",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "required: true\n联系人id",
+                    "type": "integer"
+                }
+            }
+        },
         "mdb.ControlLampReq": {
             "type": "object",
             "properties": {
@@ -4471,6 +7735,19 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.EmailCodeReq": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "purpose": {
+                    "description": "required: true\nregister/modify_email/verify_email/reset_passwd/erase_data",
+                    "type": "string"
+                }
+            }
+        },
         "mdb.H03CurDayFocusStatus": {
             "type": "object",
             "properties": {
@@ -4865,6 +8142,33 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.InboxReadReq": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "description": "消息id, 为空时标记所有未读消息",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "user_id": {
+                    "description": "required: true",
+                    "type": "integer"
+                }
+            }
+        },
+        "mdb.InboxUnread": {
+            "type": "object",
+            "properties": {
+                "unread": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "mdb.LampRealDataReq": {
             "type": "object",
             "properties": {
@@ -4893,6 +8197,83 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.LoginResp": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "type": "string"
+                },
+                "address": {
+                    "type": "string"
+                },
+                "born_date": {
+                    "type": "string"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "email_verified": {
+                    "description": "邮箱是否已经验证 0:未验证 1:已验证, 只给已验证的邮箱发送通知邮件",
+                    "type": "integer"
+                },
+                "emergent_phone": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "description": "access token有效期, 单位秒",
+                    "type": "integer"
+                },
+                "face": {
+                    "type": "string"
+                },
+                "gender": {
+                    "description": "0 未知 1 男 2 女",
+                    "type": "integer"
+                },
+                "grade": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "is_login": {
+                    "type": "integer"
+                },
+                "locale": {
+                    "description": "首选语言, 如zh-CN、zh-HK、en, 用于选择通知模板, 为空时使用缺省语言",
+                    "type": "string"
+                },
+                "login_time": {
+                    "type": "string"
+                },
+                "login_type": {
+                    "description": "0:phone 1:email",
+                    "type": "integer"
+                },
+                "nick_name": {
+                    "type": "string"
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "room_num": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "token": {
+                    "description": "access token, 放在Authorization: Bearer头或者token参数中",
+                    "type": "string"
+                }
+            }
+        },
         "mdb.LoginoutReq": {
             "type": "object",
             "properties": {
@@ -4902,6 +8283,15 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.MetricRuleReq": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "required: true\n规则id",
+                    "type": "integer"
+                }
+            }
+        },
         "mdb.ModifyFriendReq": {
             "type": "object",
             "properties": {
@@ -4971,6 +8361,10 @@ const docTemplate = `{
         "mdb.NewEmail": {
             "type": "object",
             "properties": {
+                "code": {
+                    "description": "发送到新邮箱的验证码, purpose为modify_email",
+                    "type": "string"
+                },
                 "email": {
                     "type": "string"
                 },
@@ -4979,9 +8373,25 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.NewLocale": {
+            "type": "object",
+            "properties": {
+                "locale": {
+                    "description": "语言, 如zh-CN、zh-HK、en, 为空时使用缺省语言",
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "mdb.NewPasswd": {
             "type": "object",
             "properties": {
+                "old_password": {
+                    "description": "required: true\n旧密码",
+                    "type": "string"
+                },
                 "password": {
                     "type": "string"
                 },
@@ -4993,6 +8403,10 @@ const docTemplate = `{
         "mdb.NewPhone": {
             "type": "object",
             "properties": {
+                "code": {
+                    "description": "发送到新手机号的验证码, purpose为modify_phone",
+                    "type": "string"
+                },
                 "phone": {
                     "type": "string"
                 },
@@ -5041,6 +8455,15 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.RefreshTokenReq": {
+            "type": "object",
+            "properties": {
+                "refresh_token": {
+                    "description": "required: true",
+                    "type": "string"
+                }
+            }
+        },
         "mdb.ReleaseStudyRoomReq": {
             "type": "object",
             "properties": {
@@ -5075,6 +8498,67 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.ResetPasswdByEmailReq": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "email": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "password": {
+                    "description": "required: true",
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.ResetPasswdReq": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "password": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "phone": {
+                    "description": "required: true",
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.RevokeSessionReq": {
+            "type": "object",
+            "properties": {
+                "session_id": {
+                    "description": "为空时撤销当前用户所有会话",
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.RuleMetricsResp": {
+            "type": "object",
+            "properties": {
+                "mac": {
+                    "type": "string"
+                },
+                "metrics": {
+                    "description": "设备支持的指标",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
         "mdb.ShareDeviceReq": {
             "type": "object",
             "properties": {
@@ -5144,6 +8628,52 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.SmsCodeReq": {
+            "type": "object",
+            "properties": {
+                "phone": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "purpose": {
+                    "description": "required: true\nlogin/register/modify_phone/reset_passwd/unlock/erase_data",
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.SmsLoginReq": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "phone": {
+                    "description": "required: true",
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.SmsRegisterReq": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "nick_name": {
+                    "type": "string"
+                },
+                "password": {
+                    "description": "可选, 不设置时只能用验证码登录",
+                    "type": "string"
+                },
+                "phone": {
+                    "description": "required: true",
+                    "type": "string"
+                }
+            }
+        },
         "mdb.StatsHeartRate": {
             "type": "object",
             "properties": {
@@ -5626,6 +9156,19 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.UnlockAccountReq": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "required: true\npurpose为unlock的验证码",
+                    "type": "string"
+                },
+                "phone": {
+                    "description": "required: true",
+                    "type": "string"
+                }
+            }
+        },
         "mdb.UpdateDeviceReq": {
             "type": "object",
             "properties": {
@@ -5649,6 +9192,27 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.UserDataJobReq": {
+            "type": "object",
+            "properties": {
+                "channel": {
+                    "description": "验证码的发送渠道, sms/email, 默认sms",
+                    "type": "string"
+                },
+                "code": {
+                    "description": "删除数据的验证码, purpose为erase_data, 没有设置密码的账号使用验证码",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "required: true\n用户id",
+                    "type": "integer"
+                },
+                "password": {
+                    "description": "用户密码, 删除数据时提供密码或验证码",
+                    "type": "string"
+                }
+            }
+        },
         "mdb.UserEnterStudyReq": {
             "type": "object",
             "properties": {
@@ -5707,6 +9271,61 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.UserRegisterReq": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "address": {
+                    "type": "string"
+                },
+                "born_date": {
+                    "type": "string"
+                },
+                "code": {
+                    "description": "required: true\nlogin_type为0时是purpose为register的短信验证码, 为1时是邮箱验证码",
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "emergent_phone": {
+                    "type": "string"
+                },
+                "face": {
+                    "type": "string"
+                },
+                "gender": {
+                    "description": "0 未知 1 男 2 女",
+                    "type": "integer"
+                },
+                "grade": {
+                    "type": "string"
+                },
+                "locale": {
+                    "type": "string"
+                },
+                "login_type": {
+                    "description": "0:phone 1:email",
+                    "type": "integer"
+                },
+                "nick_name": {
+                    "type": "string"
+                },
+                "password": {
+                    "description": "required: true",
+                    "type": "string"
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "room_num": {
+                    "type": "string"
+                }
+            }
+        },
         "mdb.UserStudyData": {
             "type": "object",
             "properties": {
@@ -5745,6 +9364,19 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.VerifyEmailReq": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "required: true\n发送到用户当前邮箱的验证码, purpose为verify_email",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "required: true",
+                    "type": "integer"
+                }
+            }
+        },
         "mdb.VerifyTokenResp": {
             "type": "object",
             "properties": {
@@ -5757,6 +9389,70 @@ const docTemplate = `{
                 }
             }
         },
+        "mdb.WebhookReq": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "description": "alarm.raised/device.online/device.offline/report.study_ready/report.sleep_ready/fall.detected/alarm.escalated",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "description": "更新、删除和重新推送时使用",
+                    "type": "integer"
+                },
+                "org_id": {
+                    "description": "创建时使用",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "0:停用 1:启用, 只在更新时使用",
+                    "type": "integer"
+                },
+                "url": {
+                    "description": "https地址, 必须解析到公网地址",
+                    "type": "string"
+                }
+            }
+        },
+        "mdb.WebhookResp": {
+            "type": "object",
+            "properties": {
+                "create_time": {
+                    "type": "string"
+                },
+                "events": {
+                    "description": "订阅的事件, 逗号分隔",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "operator_id": {
+                    "type": "integer"
+                },
+                "org_id": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "description": "签名密钥, 只在创建时返回一次",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "0:停用 1:启用",
+                    "type": "integer"
+                },
+                "update_time": {
+                    "type": "string"
+                },
+                "url": {
+                    "description": "接收推送的https地址",
+                    "type": "string"
+                }
+            }
+        },
         "mdb.WeekConcation": {
             "type": "object",
             "properties": {
@@ -5823,33 +9519,212 @@ const docTemplate = `{
                 "encript_data": {
                     "type": "string"
                 },
-                "gender": {
+                "gender": {
+                    "type": "integer"
+                },
+                "iv": {
+                    "type": "string"
+                },
+                "login_code": {
+                    "type": "string"
+                },
+                "nick_name": {
+                    "type": "string"
+                },
+                "phone_code": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "mdbwx.WxMiniUrlReq": {
+            "type": "object",
+            "properties": {
+                "path": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                }
+            }
+        },
+        "mysql.Alarm": {
+            "type": "object",
+            "properties": {
+                "ack_note": {
+                    "type": "string"
+                },
+                "ack_time": {
+                    "type": "string"
+                },
+                "ack_user_id": {
+                    "description": "确认的护理人员id",
+                    "type": "integer"
+                },
+                "code": {
+                    "description": "告警类型或事件编号",
+                    "type": "integer"
+                },
+                "count": {
+                    "description": "未恢复期间发生的次数",
+                    "type": "integer"
+                },
+                "device_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_time": {
+                    "description": "最近一次发生时间",
+                    "type": "string"
+                },
+                "mac": {
+                    "type": "string"
+                },
+                "open_time": {
+                    "type": "string"
+                },
+                "resolve_note": {
+                    "description": "恢复原因或备注",
+                    "type": "string"
+                },
+                "resolve_time": {
+                    "type": "string"
+                },
+                "resolve_user_id": {
+                    "description": "手动恢复的用户id, 自动恢复时为0",
+                    "type": "integer"
+                },
+                "source": {
+                    "description": "sleep:睡眠设备 fall:跌倒检测 study:学习设备",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "1:未处理 2:已确认 3:已恢复",
+                    "type": "integer"
+                }
+            }
+        },
+        "mysql.AlarmEscalation": {
+            "type": "object",
+            "properties": {
+                "alarm_id": {
+                    "type": "integer"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "next_time": {
+                    "type": "string"
+                },
+                "policy": {
+                    "description": "升级策略名称",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "0:等待执行 1:已完成 2:已取消",
+                    "type": "integer"
+                },
+                "step": {
+                    "description": "下一级, 从0开始",
+                    "type": "integer"
+                },
+                "update_time": {
+                    "type": "string"
+                }
+            }
+        },
+        "mysql.AlarmStats": {
+            "type": "object",
+            "properties": {
+                "acked": {
+                    "type": "integer"
+                },
+                "mtta": {
+                    "description": "平均确认时间, 单位秒, 只统计已确认的报警",
+                    "type": "integer"
+                },
+                "mttr": {
+                    "description": "平均恢复时间, 单位秒, 只统计已恢复的报警",
+                    "type": "integer"
+                },
+                "resolved": {
+                    "type": "integer"
+                },
+                "source": {
+                    "description": "报警来源, 为空时是全部来源的合计",
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "mysql.ApiKey": {
+            "type": "object",
+            "properties": {
+                "create_time": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key_prefix": {
+                    "description": "明文key的前缀, 用于查找和显示",
+                    "type": "string"
+                },
+                "last_used_time": {
+                    "type": "string"
+                },
+                "macs": {
+                    "description": "允许访问的设备mac, 逗号分隔",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "operator_id": {
                     "type": "integer"
                 },
-                "iv": {
-                    "type": "string"
+                "org_id": {
+                    "type": "integer"
                 },
-                "login_code": {
-                    "type": "string"
+                "rate_limit": {
+                    "description": "每分钟最多请求数, 0使用缺省限额",
+                    "type": "integer"
                 },
-                "nick_name": {
+                "revoke_time": {
                     "type": "string"
                 },
-                "phone_code": {
+                "scopes": {
+                    "description": "授权范围, 逗号分隔",
                     "type": "string"
                 },
-                "version": {
-                    "type": "string"
+                "status": {
+                    "description": "0:已撤销 1:有效",
+                    "type": "integer"
                 }
             }
         },
-        "mdbwx.WxMiniUrlReq": {
+        "mysql.ApiKeyUsage": {
             "type": "object",
             "properties": {
-                "path": {
+                "count": {
+                    "type": "integer"
+                },
+                "key_id": {
+                    "type": "integer"
+                },
+                "route": {
                     "type": "string"
                 },
-                "query": {
+                "stat_date": {
                     "type": "string"
                 }
             }
@@ -5942,6 +9817,67 @@ const docTemplate = `{
                 }
             }
         },
+        "mysql.EmergencyContact": {
+            "type": "object",
+            "properties": {
+                "active_end": {
+                    "type": "string"
+                },
+                "active_start": {
+                    "description": "接收时段, 格式15:04, 开始晚于结束时跨过零点, 都为空时全天接收",
+                    "type": "string"
+                },
+                "alarms": {
+                    "description": "关注的报警, 逗号分隔, 来源.类型或来源, 如sleep.3010,fall,vital, 为空时接收所有报警",
+                    "type": "string"
+                },
+                "channels": {
+                    "description": "通知通道, 逗号分隔, sms/wx_official/email",
+                    "type": "string"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "email_verified": {
+                    "description": "邮箱是否已经验证 0:未验证 1:已验证",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "is_primary": {
+                    "description": "主联系人, 每个用户最多一个, 报警升级时先通知主联系人",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "open_id": {
+                    "description": "联系人关注公众号的openId, 由服务端通过联系人手机号注册的账号绑定的微信取得, 客户端填写的无效",
+                    "type": "string"
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "phone_verified": {
+                    "description": "手机号是否已经短信验证 0:未验证 1:已验证",
+                    "type": "integer"
+                },
+                "relation": {
+                    "description": "与用户的关系, 如儿子、女儿、护工",
+                    "type": "string"
+                },
+                "update_time": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "mysql.EventReportSql": {
             "type": "object",
             "properties": {
@@ -6408,6 +10344,209 @@ const docTemplate = `{
                 }
             }
         },
+        "mysql.MetricRule": {
+            "type": "object",
+            "properties": {
+                "actions": {
+                    "description": "动作, 逗号分隔, notify/webhook/command",
+                    "type": "string"
+                },
+                "active_end": {
+                    "type": "string"
+                },
+                "active_start": {
+                    "description": "生效时段, 格式15:04, 开始晚于结束时跨过零点, 都为空时全天生效",
+                    "type": "string"
+                },
+                "command": {
+                    "description": "设备命令, X1: sleep_switch/nurse_mode, H03和T1: reboot/setting",
+                    "type": "string"
+                },
+                "command_params": {
+                    "description": "命令参数, json格式",
+                    "type": "string"
+                },
+                "cooldown": {
+                    "description": "条件一直满足时重复触发的间隔, 单位分钟",
+                    "type": "integer"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "description": "0:停用 1:启用",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_trigger_time": {
+                    "description": "最近触发时间, 没有触发过时为空",
+                    "type": "string"
+                },
+                "mac": {
+                    "type": "string"
+                },
+                "metric": {
+                    "description": "heart_rate/respiratory/body_status/concentration/study_time/posture",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "operator": {
+                    "description": "gt/ge/lt/le/eq/ne/between/outside",
+                    "type": "string"
+                },
+                "sustain": {
+                    "description": "条件持续多少分钟后触发, 0为立即触发",
+                    "type": "integer"
+                },
+                "update_time": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "创建规则的用户, 通知发送给该用户",
+                    "type": "integer"
+                },
+                "value": {
+                    "type": "integer"
+                },
+                "value2": {
+                    "description": "between和outside的上限",
+                    "type": "integer"
+                }
+            }
+        },
+        "mysql.NotifyAttempt": {
+            "type": "object",
+            "properties": {
+                "chain": {
+                    "description": "第几条通道链, 从0开始",
+                    "type": "integer"
+                },
+                "channel": {
+                    "type": "string"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "description": "事件id, 同一事件通知多个用户时相同",
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "mac": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "1:成功 2:失败 3:跳过 4:被免打扰、去重或每日上限拦截",
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "mysql.NotifyMessage": {
+            "type": "object",
+            "properties": {
+                "channels": {
+                    "description": "发送成功的通道, 逗号分隔",
+                    "type": "string"
+                },
+                "code": {
+                    "type": "integer"
+                },
+                "content": {
+                    "description": "按用户语言生成的内容",
+                    "type": "string"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "description": "事件id, 与通知发送记录的事件id相同",
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "is_read": {
+                    "description": "0:未读 1:已读",
+                    "type": "integer"
+                },
+                "mac": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "事件的json",
+                    "type": "string"
+                },
+                "read_time": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "1:发送成功 2:发送失败 3:被免打扰、去重或每日上限拦截",
+                    "type": "integer"
+                },
+                "template": {
+                    "description": "使用的模板, 没有模板时为空",
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "mysql.NotifyPreference": {
+            "type": "object",
+            "properties": {
+                "daily_cap": {
+                    "description": "每个通道每天最多发送的条数, 0使用缺省配置, 不限制app和webhook",
+                    "type": "integer"
+                },
+                "dedup_window": {
+                    "description": "去重窗口, 单位秒, 0使用缺省配置",
+                    "type": "integer"
+                },
+                "digest": {
+                    "description": "摘要模式 0:被拦截的通知丢弃 1:被拦截的通知合并成摘要发送",
+                    "type": "integer"
+                },
+                "email": {
+                    "description": "是否接收邮件 0:不接收 1:接收, 邮箱验证后才发送",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "quiet_end": {
+                    "type": "string"
+                },
+                "quiet_start": {
+                    "description": "免打扰时段, 格式15:04, 开始晚于结束时跨过零点, 都为空时不启用",
+                    "type": "string"
+                },
+                "update_time": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "mysql.NotifySetting": {
             "type": "object",
             "properties": {
@@ -6417,27 +10556,80 @@ const docTemplate = `{
                 "id": {
                     "type": "integer"
                 },
-                "interval_time": {
-                    "type": "integer"
-                },
-                "last_notify_time": {
+                "interval_time": {
+                    "type": "integer"
+                },
+                "last_notify_time": {
+                    "type": "string"
+                },
+                "last_status": {
+                    "type": "integer"
+                },
+                "low_value": {
+                    "type": "integer"
+                },
+                "mac": {
+                    "type": "string"
+                },
+                "switch": {
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "通知类型\nrequired: true\nPeopleType         = 1\nBreathType         = 2\nBreathAbnormalType = 3\nHeartRateType      = 4\nNurseModeType      = 5\nBeeperType         = 6\nLightType          = 7\nImproveType = 8",
+                    "type": "integer"
+                }
+            }
+        },
+        "mysql.NotifyTemplate": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "description": "text/template格式的模板内容",
+                    "type": "string"
+                },
+                "event_key": {
+                    "description": "模板key, 如sleep.alarm.3008、vital.notify.1.0",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "locale": {
+                    "description": "语言, 如zh-CN、zh-HK、en",
+                    "type": "string"
+                },
+                "operator_id": {
+                    "type": "integer"
+                },
+                "update_time": {
+                    "type": "string"
+                }
+            }
+        },
+        "mysql.Organization": {
+            "type": "object",
+            "properties": {
+                "contact": {
+                    "type": "string"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
                     "type": "string"
                 },
-                "last_status": {
-                    "type": "integer"
-                },
-                "low_value": {
+                "operator_id": {
+                    "description": "创建机构的管理员id",
                     "type": "integer"
                 },
-                "mac": {
+                "phone": {
                     "type": "string"
                 },
-                "switch": {
-                    "type": "integer"
-                },
-                "type": {
-                    "description": "通知类型\nrequired: true\nPeopleType         = 1\nBreathType         = 2\nBreathAbnormalType = 3\nHeartRateType      = 4\nNurseModeType      = 5\nBeeperType         = 6\nLightType          = 7\nImproveType = 8",
-                    "type": "integer"
+                "remark": {
+                    "type": "string"
                 }
             }
         },
@@ -6511,6 +10703,33 @@ const docTemplate = `{
                 }
             }
         },
+        "mysql.SecurityEvent": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "description": "登录时使用的账号, 账号不存在时user_id为0",
+                    "type": "string"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "mysql.SleepReport": {
             "type": "object",
             "properties": {
@@ -7027,6 +11246,10 @@ const docTemplate = `{
                 "email": {
                     "type": "string"
                 },
+                "email_verified": {
+                    "description": "邮箱是否已经验证 0:未验证 1:已验证, 只给已验证的邮箱发送通知邮件",
+                    "type": "integer"
+                },
                 "emergent_phone": {
                     "type": "string"
                 },
@@ -7046,6 +11269,10 @@ const docTemplate = `{
                 "is_login": {
                     "type": "integer"
                 },
+                "locale": {
+                    "description": "首选语言, 如zh-CN、zh-HK、en, 用于选择通知模板, 为空时使用缺省语言",
+                    "type": "string"
+                },
                 "login_time": {
                     "type": "string"
                 },
@@ -7056,9 +11283,6 @@ const docTemplate = `{
                 "nick_name": {
                     "type": "string"
                 },
-                "password": {
-                    "type": "string"
-                },
                 "phone": {
                     "type": "string"
                 },
@@ -7067,6 +11291,34 @@ const docTemplate = `{
                 }
             }
         },
+        "mysql.UserDataJob": {
+            "type": "object",
+            "properties": {
+                "create_time": {
+                    "type": "string"
+                },
+                "finish_time": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "job_type": {
+                    "description": "1:导出 2:删除",
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "0:等待 1:执行中 2:完成 3:失败 4:导出文件已过期",
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "mysql.UserDevice": {
             "type": "object",
             "properties": {
@@ -7117,6 +11369,42 @@ const docTemplate = `{
                 }
             }
         },
+        "mysql.UserDeviceDetail": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "integer"
+                },
+                "device_name": {
+                    "type": "string"
+                },
+                "device_type": {
+                    "type": "string"
+                },
+                "emergent_phone": {
+                    "type": "string"
+                },
+                "flag": {
+                    "type": "integer"
+                },
+                "mac": {
+                    "type": "string"
+                },
+                "nick_name": {
+                    "type": "string"
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "remark": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "required: true\nuser id",
+                    "type": "integer"
+                }
+            }
+        },
         "mysql.UserFriend": {
             "type": "object",
             "required": [
@@ -7152,6 +11440,67 @@ const docTemplate = `{
                 }
             }
         },
+        "mysql.UserRole": {
+            "type": "object",
+            "properties": {
+                "create_time": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "operator_id": {
+                    "description": "设置角色的管理员id",
+                    "type": "integer"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "update_time": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "mysql.UserSession": {
+            "type": "object",
+            "properties": {
+                "create_time": {
+                    "type": "string"
+                },
+                "device_id": {
+                    "description": "客户端设备id, 同一设备重新登录时撤销旧会话",
+                    "type": "string"
+                },
+                "device_name": {
+                    "type": "string"
+                },
+                "expire_time": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "last_active_time": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "0:有效 1:已撤销",
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "mysql.UserShareDevice": {
             "type": "object",
             "required": [
@@ -7315,6 +11664,25 @@ const docTemplate = `{
                 }
             }
         },
+        "mysql.UserTokenPair": {
+            "type": "object",
+            "properties": {
+                "expires_in": {
+                    "description": "access token有效期, 单位秒",
+                    "type": "integer"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "token": {
+                    "description": "access token, 放在Authorization: Bearer头或者token参数中",
+                    "type": "string"
+                }
+            }
+        },
         "mysql.UserTransferDeviceDetail": {
             "type": "object",
             "properties": {
@@ -7364,6 +11732,85 @@ const docTemplate = `{
                 }
             }
         },
+        "mysql.Webhook": {
+            "type": "object",
+            "properties": {
+                "create_time": {
+                    "type": "string"
+                },
+                "events": {
+                    "description": "订阅的事件, 逗号分隔",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "operator_id": {
+                    "type": "integer"
+                },
+                "org_id": {
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "0:停用 1:启用",
+                    "type": "integer"
+                },
+                "update_time": {
+                    "type": "string"
+                },
+                "url": {
+                    "description": "接收推送的https地址",
+                    "type": "string"
+                }
+            }
+        },
+        "mysql.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "create_time": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "description": "事件id, 重试时不变, 接收方可以用来去重",
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "mac": {
+                    "type": "string"
+                },
+                "next_retry_time": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "推送的json内容",
+                    "type": "string"
+                },
+                "response_code": {
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "0:等待推送 1:成功 2:死信",
+                    "type": "integer"
+                },
+                "update_time": {
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "mysql.X1DayReportOrigin": {
             "type": "object",
             "required": [
@@ -7405,6 +11852,50 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "sms.ProviderStats": {
+            "type": "object",
+            "properties": {
+                "delivered": {
+                    "description": "回执为送达的条数",
+                    "type": "integer"
+                },
+                "failed": {
+                    "description": "发送请求失败的条数",
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_send": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "sent": {
+                    "description": "发送请求成功的条数",
+                    "type": "integer"
+                },
+                "undelivered": {
+                    "description": "回执为未送达的条数",
+                    "type": "integer"
+                }
+            }
+        },
+        "stream.Message": {
+            "type": "object",
+            "properties": {
+                "mac": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "topic": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,192 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/mdb/common"
+)
+
+// define tls mode
+const (
+	TlsNone     = "none"
+	TlsStartTls = "starttls"
+	TlsSsl      = "ssl"
+)
+
+// 缺省的连接和发送超时, 单位秒
+const smtpTimeout = 10
+
+var (
+	ErrNotConfigured = errors.New("mail server not configured")
+	ErrInvalidAddr   = errors.New("email address is invalid")
+)
+
+// Client SMTP客户端, 每次发送建立一个连接
+type Client struct {
+	cfg *cfg.MailCfg
+}
+
+func NewClient(c *cfg.MailCfg) *Client {
+	return &Client{cfg: c}
+}
+
+// Sender 发送邮件的函数
+type Sender func(to string, subject string, html string) error
+
+var sender Sender = sendByCfg
+
+func sendByCfg(to string, subject string, html string) error {
+	if cfg.This == nil || cfg.This.Mail.Host == "" {
+		return ErrNotConfigured
+	}
+	return NewClient(&cfg.This.Mail).Send(to, subject, html)
+}
+
+/******************************************************************************
+ * function: SetSender
+ * description: 替换发送邮件的函数, 返回原来的函数以便恢复
+ * param {Sender} s
+ * return {*}
+********************************************************************************/
+func SetSender(s Sender) Sender {
+	old := sender
+	sender = s
+	return old
+}
+
+// Send 使用配置的服务器发送html邮件
+func Send(to string, subject string, html string) error {
+	return sender(to, subject, html)
+}
+
+// ValidAddress 检查邮箱地址, 只接受不带名称的地址
+func ValidAddress(addr string) bool {
+	a, err := netmail.ParseAddress(addr)
+	return err == nil && a.Address == addr && len(addr) <= 128
+}
+
+// encodeBody html内容按base64编码, 每行76个字符
+func encodeBody(html string) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(html))
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	return b.String()
+}
+
+// buildMessage 生成邮件内容, 主题去掉换行后按utf-8编码, 防止插入邮件头
+func (me *Client) buildMessage(to string, subject string, html string) []byte {
+	subject = strings.NewReplacer("\r", "", "\n", " ").Replace(subject)
+	from := netmail.Address{Name: me.cfg.FromName, Address: me.cfg.From}
+	var b bytes.Buffer
+	b.WriteString("From: " + from.String() + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	domain := me.cfg.From[strings.LastIndex(me.cfg.From, "@")+1:]
+	b.WriteString(fmt.Sprintf("Message-ID: <%s@%s>\r\n", common.GenerateUUID(), domain))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	b.WriteString(encodeBody(html))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+func (me *Client) dial() (net.Conn, error) {
+	timeout := me.cfg.Timeout
+	if timeout <= 0 {
+		timeout = smtpTimeout
+	}
+	dialer := &net.Dialer{Timeout: time.Duration(timeout) * time.Second}
+	addr := net.JoinHostPort(me.cfg.Host, strconv.Itoa(me.cfg.Port))
+	var conn net.Conn
+	var err error
+	if me.cfg.Tls == TlsSsl {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: me.cfg.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Second))
+	return conn, nil
+}
+
+/******************************************************************************
+ * function: Send
+ * description: 发送一封html邮件. tls为空时服务器支持就使用starttls, 为starttls时服务器不支持返回错误,
+ * 有用户名并且服务器支持认证时登录, 明文连接只允许登录本机的服务器
+ * param {string} to
+ * param {string} subject
+ * param {string} html
+ * return {*}
+********************************************************************************/
+func (me *Client) Send(to string, subject string, html string) error {
+	if me.cfg.Host == "" || me.cfg.From == "" {
+		return ErrNotConfigured
+	}
+	if !ValidAddress(to) {
+		return ErrInvalidAddr
+	}
+	conn, err := me.dial()
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, me.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if me.cfg.Tls != TlsSsl && me.cfg.Tls != TlsNone {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: me.cfg.Host}); err != nil {
+				return err
+			}
+		} else if me.cfg.Tls == TlsStartTls {
+			return errors.New("smtp server does not support starttls")
+		}
+	}
+	if me.cfg.Username != "" {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(smtp.PlainAuth("", me.cfg.Username, me.cfg.Password, me.cfg.Host)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.Mail(me.cfg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(me.buildMessage(to, subject, html)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,135 @@
+package email
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+
+	"hjyserver/cfg"
+)
+
+// fakeSmtpServer 只支持发送流程的模拟SMTP服务器, 保存收到的邮件
+type fakeSmtpServer struct {
+	ln   net.Listener
+	rcpt []string
+	data chan string
+}
+
+func newFakeSmtpServer(t *testing.T) *fakeSmtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSmtpServer{ln: ln, data: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (me *fakeSmtpServer) port() int {
+	return me.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (me *fakeSmtpServer) serve() {
+	conn, err := me.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			me.rcpt = append(me.rcpt, strings.TrimSpace(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end with .")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			me.data <- b.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestClientSend(t *testing.T) {
+	server := newFakeSmtpServer(t)
+	defer server.ln.Close()
+	client := NewClient(&cfg.MailCfg{
+		Host:     "127.0.0.1",
+		Port:     server.port(),
+		From:     "noreply@example.com",
+		FromName: "护眠仪",
+		Tls:      TlsNone,
+	})
+	if err := client.Send("bad address", "hi", "<p>hi</p>"); err != ErrInvalidAddr {
+		t.Errorf("invalid address error %v", err)
+	}
+	if err := client.Send("tom@example.com", "睡眠报告\r\nBcc: x@example.com", "<p>评分 80</p>"); err != nil {
+		t.Fatal(err)
+	}
+	data := <-server.data
+	if len(server.rcpt) != 1 || server.rcpt[0] != "<tom@example.com>" {
+		t.Errorf("rcpt %v", server.rcpt)
+	}
+	header, body, _ := strings.Cut(data, "\r\n\r\n")
+	if strings.Contains(header, "\r\nBcc:") || !strings.Contains(header, "Subject: =?UTF-8?b?") ||
+		!strings.Contains(header, "Content-Type: text/html; charset=UTF-8") {
+		t.Errorf("header %s", header)
+	}
+	html, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(strings.TrimSpace(body), "\r\n", ""))
+	if err != nil || string(html) != "<p>评分 80</p>" {
+		t.Errorf("body %s %v", html, err)
+	}
+}
+
+func TestRenderTemplates(t *testing.T) {
+	if err := LoadTemplates("../templates/email"); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"NickName": "<b>Tom</b>", "Code": "123456", "Minutes": 5, "Purpose": "reset_passwd"}
+	subject, body, err := Render("zh-HK", []string{"verify_code"}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "重設密碼驗證碼" || !strings.Contains(body, "123456") || !strings.Contains(body, "&lt;b&gt;Tom") {
+		t.Errorf("subject %s body %s", subject, body)
+	}
+	// 没有的语言使用缺省语言, 没有的模板返回错误
+	if subject, _, _ := Render("fr", []string{"verify_code"}, data); subject != "重置密码验证码" {
+		t.Errorf("default locale subject %s", subject)
+	}
+	if _, _, err := Render("en", []string{"unknown"}, data); err != ErrNoTemplate {
+		t.Errorf("unknown template error %v", err)
+	}
+	for _, locale := range []string{"zh-CN", "zh-HK", "en"} {
+		for _, key := range []string{"notify", "sleep.report", "study.week_report"} {
+			if _, ok := templates.Find(locale, []string{key}); !ok {
+				t.Errorf("template %s/%s missing", locale, key)
+			}
+		}
+	}
+}
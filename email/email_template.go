@@ -0,0 +1,90 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	mylog "hjyserver/log"
+	"hjyserver/notify"
+)
+
+// 没有找到对应的模板
+var ErrNoTemplate = errors.New("no email template")
+
+var templates = notify.NewCatalogue[*template.Template]()
+
+// SetDefaultLocale 设置用户没有设置语言或者没有该语言模板时使用的语言
+func SetDefaultLocale(locale string) {
+	templates.SetDefaultLocale(locale)
+}
+
+/******************************************************************************
+ * function: LoadTemplates
+ * description: 加载目录下所有语言的模板, 替换原来的模板, 语法错误的模板记录日志后忽略
+ * param {string} dir
+ * return {*}
+********************************************************************************/
+func LoadTemplates(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	parsed := make(map[string]map[string]*template.Template)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		locale := entry.Name()
+		files, _ := filepath.Glob(filepath.Join(dir, locale, "*.html"))
+		tpls := make(map[string]*template.Template, len(files))
+		for _, file := range files {
+			key := strings.TrimSuffix(filepath.Base(file), ".html")
+			data, err := os.ReadFile(file)
+			if err != nil {
+				mylog.Log.Errorf("read email template %s error: %v", file, err)
+				continue
+			}
+			tpl, err := template.New(key).Option("missingkey=zero").Parse(string(data))
+			if err != nil {
+				mylog.Log.Errorf("parse email template %s/%s error: %v", locale, key, err)
+				continue
+			}
+			tpls[key] = tpl
+		}
+		parsed[locale] = tpls
+	}
+	templates.Replace(parsed)
+	return nil
+}
+
+/******************************************************************************
+ * function: Render
+ * description: 按顺序查找第一个存在的模板, 生成主题和正文
+ * param {string} locale
+ * param {[]string} keys 模板key, 越具体的越靠前
+ * param {interface{}} data
+ * return {*} 主题, 正文
+********************************************************************************/
+func Render(locale string, keys []string, data interface{}) (string, string, error) {
+	tpl, ok := templates.Find(locale, keys)
+	if !ok {
+		return "", "", ErrNoTemplate
+	}
+	var subject bytes.Buffer
+	if tpl.Lookup("subject") != nil {
+		if err := tpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+			return "", "", err
+		}
+	}
+	var body bytes.Buffer
+	if err := tpl.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	// 主题不是html, 还原转义的字符
+	return html.UnescapeString(strings.TrimSpace(subject.String())), strings.TrimSpace(body.String()), nil
+}
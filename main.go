@@ -9,6 +9,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"hjyserver/api"
 	"hjyserver/cfg"
@@ -17,9 +18,14 @@ import (
 	"hjyserver/mdb/mysql"
 	"hjyserver/mq"
 	"hjyserver/redis"
+	"hjyserver/sms"
+	"hjyserver/stream"
 )
 
 func main() {
+	// 维护窗口执行一次, 把记录表转换为按月分区后退出
+	migratePartitions := flag.Bool("migrate-partitions", false, "convert record tables to monthly partitions and exit")
+	flag.Parse()
 	err := cfg.InitConfig("./cfg/cfg.yml")
 	if err != nil {
 		fmt.Println("initialize config failed, ", err)
@@ -27,11 +33,24 @@ func main() {
 	}
 	mylog.Init()
 	defer mylog.Close()
+	// 没有jwt签名密钥时不启动, 避免使用可以伪造的token
+	if err := mysql.InitJwtKeys(); err != nil {
+		mylog.Log.Error("init jwt keys failed exit! ", err)
+		return
+	}
+	// 短信供应商在数据库和mqtt之前初始化, 启动后的报警可能发送短信
+	sms.Init()
 	if !mdb.Open() {
 		mylog.Log.Error("connect database failed exit!")
 		return
 	}
 	defer mdb.Close()
+	if *migratePartitions {
+		if !mysql.MigratePartitions() {
+			mylog.Log.Error("migrate partitions failed")
+		}
+		return
+	}
 	// init mqtt object
 	if !mq.InitMqtt() {
 		mylog.Log.Error("init mqtt failed exit!")
@@ -44,6 +63,11 @@ func main() {
 		return
 	}
 	defer redis.CloseRedis()
+	// app实时数据推送通过redis在实例间转发
+	if cfg.This.Svr.EnableStream {
+		stream.Start()
+		defer stream.Stop()
+	}
 	//启动web服务
 	api.StartWeb()
 }
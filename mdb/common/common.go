@@ -41,6 +41,24 @@ const (
 	StudyRoomUserTbl      = "study_room_user_tbl"
 	StudyRecordTbl        = "study_record_tbl"
 	NotifySettingTbl      = "notify_setting_tbl"
+	UserDataJobTbl        = "user_data_job_tbl"
+	UserSessionTbl        = "user_session_tbl"
+	UserRoleTbl           = "user_role_tbl"
+	SecurityEventTbl      = "security_event_tbl"
+	OrganizationTbl       = "organization_tbl"
+	ApiKeyTbl             = "api_key_tbl"
+	ApiKeyUsageTbl        = "api_key_usage_tbl"
+	WebhookTbl            = "webhook_tbl"
+	WebhookDeliveryTbl    = "webhook_delivery_tbl"
+	NotifyAttemptTbl      = "notify_attempt_tbl"
+	NotifyTemplateTbl     = "notify_template_tbl"
+	AlarmTbl              = "alarm_tbl"
+	AlarmEscalationTbl    = "alarm_escalation_tbl"
+	EmergencyContactTbl   = "emergency_contact_tbl"
+	NotifyPreferenceTbl   = "notify_preference_tbl"
+	NotifyDigestTbl       = "notify_digest_tbl"
+	NotifyMessageTbl      = "notify_message_tbl"
+	MetricRuleTbl         = "metric_rule_tbl"
 )
 
 // define sleep device notify type
@@ -67,6 +85,12 @@ const (
 	ShareDeviceFlag  = 1
 )
 
+// 鉴权后调用者用户id在gin.Context中的key
+const AuthUserIdKey = "auth_user_id"
+
+// 鉴权后调用者(用户或api key)在gin.Context中的key
+const AuthPrincipalKey = "auth_principal"
+
 // define API response result code
 const (
 	Success        = 200
@@ -95,6 +119,12 @@ const (
 	DeviceOffLine  = -43
 	SameUser       = -44
 	AlreadyBind    = -45
+	// 旧密码未迁移, 需要重置密码
+	PasswdNeedReset = -46
+	// 请求过于频繁
+	TooFrequent = -47
+	// 账号已锁定
+	AccountLocked = -48
 )
 
 // define all MQ topies prefix
@@ -113,6 +143,7 @@ const TRANSFER_DEVICE_CONFIRM string = "hjy-dev/transfer_device/confirm"
 const TRANSFER_CONFIRM_FINISHED string = "hjy-dev/transfer_device/confirm_finished"
 const DEVICE_HEART_BEAT_TOPIC string = "hjy-dev/device/heart_beat"
 const DEVICE_NOTIFY_TOPIC string = "hjy-dev/device/notify"
+const USER_NOTIFY_TOPIC string = "hjy-dev/user/notify"
 
 // const DEVICE_ONLINE_TOPIC string = "device/online"
 
@@ -137,21 +168,6 @@ func DeviceLedTbl(deviceType string) string {
 	return deviceType + "_led_tbl"
 }
 
-type PageDao struct {
-	PageNo     int64
-	PageSize   int64
-	TotalPages int64
-}
-
-// 返回一个缺省的Page信息
-func NewPageDao(pageNo, pageSize int64) *PageDao {
-	return &PageDao{
-		PageNo:     pageNo,
-		PageSize:   pageSize,
-		TotalPages: 0,
-	}
-}
-
 /******************************************************************************
  * function: MakeMD5
  * description: encrypt string with md5
@@ -208,6 +224,15 @@ func StrToDate(tmStr string) (time.Time, error) {
 	return time.ParseInLocation(cfg.DateFmtStr, tmStr, time.Local)
 }
 
+/******************************************************************************
+ * function: EscapeSql
+ * description: 转义拼接到sql字符串中的单引号和反斜杠
+ * return {*}
+********************************************************************************/
+func EscapeSql(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+}
+
 /******************************************************************************
  * function: FixPlusInPhoneString
  * description: fix + in string, replace space to + in string
@@ -276,6 +301,10 @@ func MakeDeviceNotifyTopic(mac string) string {
 	return DEVICE_NOTIFY_TOPIC + "/" + strings.ToLower(mac)
 }
 
+func MakeUserNotifyTopic(userId int64) string {
+	return USER_NOTIFY_TOPIC + "/" + fmt.Sprintf("%d", userId)
+}
+
 // func MakeDeviceOnlineTopic(mac string) string {
 // 	return DEVICE_ONLINE_TOPIC + "/" + strings.ToLower(mac)
 // }
@@ -304,148 +333,6 @@ func IsHKPhone(phone string) bool {
 	return false
 }
 
-/******************************************************************************
- * function:
- * description:
- * param {string} phone
- * param {int} alarm
- * return {*}
-********************************************************************************/
-func GetSleepAlarmDesc(phone string, alarm int) string {
-	if len(phone) <= 4 {
-		return ""
-	}
-
-	switch alarm {
-	case 3001:
-		if IsCNPhone(phone) {
-			return cfg.This.AlarmMsg.LeaveBedAlarmMsgCN
-		} else if IsHKPhone(phone) {
-			return cfg.This.AlarmMsg.LeaveBedAlarmMsgHK
-		} else {
-			return cfg.This.AlarmMsg.LeaveBedAlarmMsgEN
-		}
-	case 3012:
-		if IsCNPhone(phone) {
-			return cfg.This.AlarmMsg.InBedAlarmMsgCN
-		} else if IsHKPhone(phone) {
-			return cfg.This.AlarmMsg.InBedAlarmMsgHK
-		} else {
-			return cfg.This.AlarmMsg.InBedAlarmMsgEN
-		}
-	case 3006:
-		if IsCNPhone(phone) {
-			return cfg.This.AlarmMsg.BreathingAbnormalAlarmMsgCN
-		} else if IsHKPhone(phone) {
-			return cfg.This.AlarmMsg.BreathingAbnormalAlarmMsgHK
-		} else {
-			return cfg.This.AlarmMsg.BreathingAbnormalAlarmMsgEN
-		}
-	case 3007:
-		if IsCNPhone(phone) {
-			return cfg.This.AlarmMsg.HeartRateAbnormalAlarmMsgCN
-		} else if IsHKPhone(phone) {
-			return cfg.This.AlarmMsg.HeartRateAbnormalAlarmMsgHK
-		} else {
-			return cfg.This.AlarmMsg.HeartRateAbnormalAlarmMsgEN
-		}
-	case 3008:
-		if IsCNPhone(phone) {
-			return cfg.This.AlarmMsg.PullRopeAlarmMsgCN
-		} else if IsHKPhone(phone) {
-			return cfg.This.AlarmMsg.PullRopeAlarmMsgHK
-		} else {
-			return cfg.This.AlarmMsg.PullRopeAlarmMsgEN
-		}
-	case 3009:
-		if IsCNPhone(phone) {
-			return cfg.This.AlarmMsg.DisarmedPullRopeAlarmMsgCN
-		} else if IsHKPhone(phone) {
-			return cfg.This.AlarmMsg.DisarmedPullRopeAlarmMsgHK
-		} else {
-			return cfg.This.AlarmMsg.DisarmedPullRopeAlarmMsgEN
-		}
-	case 3010:
-		if IsCNPhone(phone) {
-			return cfg.This.AlarmMsg.ApneaAlarmMsgCN
-		} else if IsHKPhone(phone) {
-			return cfg.This.AlarmMsg.ApneaAlarmMsgHK
-		} else {
-			return cfg.This.AlarmMsg.ApneaAlarmMsgEN
-		}
-	default:
-		return ""
-	}
-}
-
-/******************************************************************************
- * function:
- * description:
- * param {string} phone
- * param {int} status
- * return {*}
-********************************************************************************/
-func GetNotifyStatusDesc(phone string, notifyType int, status int) string {
-	var desc string
-	var isCN bool
-	if len(phone) <= 4 {
-		return ""
-	}
-	if IsCNPhone(phone) {
-		isCN = true
-	} else {
-		isCN = false
-	}
-	switch notifyType {
-	case PeopleType:
-		if status == 0 {
-			if isCN {
-				desc = cfg.This.AlarmMsg.CheckPersonNoActivityMsgCN
-			} else {
-				desc = cfg.This.AlarmMsg.CheckPersonNoActivityMsgHK
-			}
-		} else {
-			if isCN {
-				desc = cfg.This.AlarmMsg.CheckPersonActivityMsgCN
-			} else {
-				desc = cfg.This.AlarmMsg.CheckPersonActivityMsgHK
-			}
-		}
-	case BreathType:
-		if status == 0 {
-			if isCN {
-				desc = cfg.This.AlarmMsg.CheckPersonBreathLowMsgCN
-			} else {
-				desc = cfg.This.AlarmMsg.CheckPersonBreathLowMsgHK
-			}
-		} else {
-			if isCN {
-				desc = cfg.This.AlarmMsg.CheckPersonBreathHighMsgCN
-			} else {
-				desc = cfg.This.AlarmMsg.CheckPersonBreathHighMsgHK
-			}
-		}
-	case HeartRateType:
-		if status == 0 {
-			if isCN {
-				desc = cfg.This.AlarmMsg.CheckPersonHeartLowMsgCN
-			} else {
-				desc = cfg.This.AlarmMsg.CheckPersonHeartLowMsgHK
-			}
-		} else {
-			if isCN {
-				desc = cfg.This.AlarmMsg.CheckPersonHeartHighMsgCN
-			} else {
-				desc = cfg.This.AlarmMsg.CheckPersonHeartHighMsgHK
-			}
-		}
-
-	default:
-		// 其他通知
-	}
-	return desc
-}
-
 func GenerateUUID() string {
 	return uuid.New().String()
 }
@@ -0,0 +1,170 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	jwtAlg = "HS256"
+	// HS256密钥最短长度, 可以用 openssl rand -hex 32 生成
+	JwtMinKeyLen = 32
+	// 环境变量中的密钥, 变量名为前缀加上大写的kid, 如HJY_JWT_KEY_K1
+	JwtKeyEnvPrefix = "HJY_JWT_KEY_"
+)
+
+var (
+	ErrJwtFormat    = errors.New("invalid jwt format")
+	ErrJwtKey       = errors.New("unknown jwt key id")
+	ErrJwtSignature = errors.New("invalid jwt signature")
+	ErrJwtExpired   = errors.New("jwt expired")
+	ErrJwtNoKey     = errors.New("jwt signing key is not configured")
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+/*
+* JwtClaims... access token中的声明
+ */
+type JwtClaims struct {
+	// 用户id
+	Sub int64 `json:"sub"`
+	// 会话id
+	Sid   string `json:"sid"`
+	Phone string `json:"phone,omitempty"`
+	Iat   int64  `json:"iat"`
+	Exp   int64  `json:"exp"`
+}
+
+/******************************************************************************
+ * function: SignJwt
+ * description: 用kid对应的密钥签名, kid写入头部, 校验时按kid选择密钥
+ * param {*JwtClaims} claims
+ * param {string} kid
+ * param {[]byte} key
+ * return {*}
+********************************************************************************/
+func SignJwt(claims *JwtClaims, kid string, key []byte) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: jwtAlg, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + jwtSignature(unsigned, key), nil
+}
+
+/******************************************************************************
+ * function: ParseJwt
+ * description: 校验签名和过期时间, 返回声明
+ * param {string} token
+ * param {func(kid string) ([]byte, bool)} keyFunc 根据kid返回密钥
+ * return {*}
+********************************************************************************/
+func ParseJwt(token string, keyFunc func(kid string) ([]byte, bool)) (*JwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJwtFormat
+	}
+	headerJs, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrJwtFormat
+	}
+	header := jwtHeader{}
+	if err := json.Unmarshal(headerJs, &header); err != nil || header.Alg != jwtAlg {
+		return nil, ErrJwtFormat
+	}
+	key, ok := keyFunc(header.Kid)
+	if !ok {
+		return nil, ErrJwtKey
+	}
+	sign := jwtSignature(parts[0]+"."+parts[1], key)
+	if !hmac.Equal([]byte(sign), []byte(parts[2])) {
+		return nil, ErrJwtSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrJwtFormat
+	}
+	claims := &JwtClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrJwtFormat
+	}
+	if claims.Exp <= time.Now().Unix() {
+		return nil, ErrJwtExpired
+	}
+	return claims, nil
+}
+
+/******************************************************************************
+ * function: LoadJwtKeys
+ * description: 读取所有密钥, 环境变量优先, 其次是密钥文件, 最后是配置文件中的值,
+ * 签名用的密钥不存在或者任一密钥短于JwtMinKeyLen时返回错误
+ * param {string} activeKid 签名使用的kid
+ * param {map[string]string} keys 配置文件中的密钥, kid: secret
+ * param {map[string]string} keyFiles 密钥文件, kid: 文件路径
+ * return {*}
+********************************************************************************/
+func LoadJwtKeys(activeKid string, keys map[string]string, keyFiles map[string]string) (map[string][]byte, error) {
+	kids := make(map[string]bool)
+	for kid := range keys {
+		kids[kid] = true
+	}
+	for kid := range keyFiles {
+		kids[kid] = true
+	}
+	kids[activeKid] = true
+	result := make(map[string][]byte)
+	for kid := range kids {
+		if kid == "" {
+			continue
+		}
+		key := strings.TrimSpace(os.Getenv(JwtKeyEnvPrefix + strings.ToUpper(kid)))
+		if key == "" && keyFiles[kid] != "" {
+			data, err := os.ReadFile(keyFiles[kid])
+			if err != nil {
+				return nil, fmt.Errorf("read jwt key %s: %w", kid, err)
+			}
+			key = strings.TrimSpace(string(data))
+		}
+		if key == "" {
+			key = keys[kid]
+		}
+		if key == "" {
+			continue
+		}
+		if len(key) < JwtMinKeyLen {
+			return nil, fmt.Errorf("jwt key %s is shorter than %d bytes", kid, JwtMinKeyLen)
+		}
+		result[kid] = []byte(key)
+	}
+	if _, ok := result[activeKid]; !ok {
+		return nil, ErrJwtNoKey
+	}
+	return result, nil
+}
+
+// IsJwtToken 判断token是否是JWT格式, 用于兼容旧的AES token
+func IsJwtToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func jwtSignature(unsigned string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func testJwtKeys(kid string) ([]byte, bool) {
+	keys := map[string]string{"k1": "secret-1", "k2": "secret-2"}
+	key, ok := keys[kid]
+	return []byte(key), ok
+}
+
+func TestSignAndParseJwt(t *testing.T) {
+	now := time.Now().Unix()
+	claims := &JwtClaims{Sub: 12, Sid: "abc", Phone: "+85212345678", Iat: now, Exp: now + 60}
+	token, err := SignJwt(claims, "k2", []byte("secret-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsJwtToken(token) {
+		t.Fatalf("expected jwt format: %s", token)
+	}
+	got, err := ParseJwt(token, testJwtKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *claims {
+		t.Errorf("claims mismatch: %+v != %+v", got, claims)
+	}
+}
+
+func TestParseJwtErrors(t *testing.T) {
+	now := time.Now().Unix()
+	valid := &JwtClaims{Sub: 1, Sid: "s", Iat: now, Exp: now + 60}
+	expired := &JwtClaims{Sub: 1, Sid: "s", Iat: now - 120, Exp: now - 60}
+
+	unknownKid, _ := SignJwt(valid, "k9", []byte("secret-9"))
+	wrongKey, _ := SignJwt(valid, "k1", []byte("secret-2"))
+	expiredToken, _ := SignJwt(expired, "k1", []byte("secret-1"))
+	cases := []struct {
+		token string
+		err   error
+	}{
+		{"abc", ErrJwtFormat},
+		{"a.b.c", ErrJwtFormat},
+		{unknownKid, ErrJwtKey},
+		{wrongKey, ErrJwtSignature},
+		{expiredToken, ErrJwtExpired},
+	}
+	for _, v := range cases {
+		if _, err := ParseJwt(v.token, testJwtKeys); err != v.err {
+			t.Errorf("ParseJwt(%q) error = %v, want %v", v.token, err, v.err)
+		}
+	}
+}
+
+func TestLoadJwtKeys(t *testing.T) {
+	long := "0123456789abcdef0123456789abcdef"
+	if _, err := LoadJwtKeys("k1", map[string]string{"k1": ""}, nil); err != ErrJwtNoKey {
+		t.Errorf("empty key error = %v, want %v", err, ErrJwtNoKey)
+	}
+	if _, err := LoadJwtKeys("k1", map[string]string{"k1": "short"}, nil); err == nil {
+		t.Error("short key should be rejected")
+	}
+	t.Setenv(JwtKeyEnvPrefix+"K1", long)
+	keys, err := LoadJwtKeys("k1", map[string]string{"k1": ""}, nil)
+	if err != nil || string(keys["k1"]) != long {
+		t.Errorf("env key = %q, %v", keys["k1"], err)
+	}
+	file := t.TempDir() + "/k2"
+	if err := os.WriteFile(file, []byte(long+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = LoadJwtKeys("k2", nil, map[string]string{"k2": file})
+	if err != nil || string(keys["k2"]) != long {
+		t.Errorf("file key = %q, %v", keys["k2"], err)
+	}
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// define page order
+const (
+	PageOrderAsc  = "asc"
+	PageOrderDesc = "desc"
+)
+
+type PageDao struct {
+	PageNo     int64
+	PageSize   int64
+	TotalPages int64
+	// 总记录数, WithTotal为false时为-1
+	TotalCount int64
+	// 是否统计总记录数, 大表翻页时可关闭以省掉count(*)
+	WithTotal bool
+	// 是否使用游标分页, 游标为空时从第一页开始
+	KeySet bool
+	// 当前页游标, 由上一页返回的NextCursor传入
+	Cursor string
+	// 下一页游标, 为空表示没有更多数据
+	NextCursor string
+	// 游标分页的排序方向, asc或desc, 为空时按调用者的排序
+	Order string
+}
+
+// 返回一个缺省的Page信息
+func NewPageDao(pageNo, pageSize int64) *PageDao {
+	return &PageDao{
+		PageNo:     pageNo,
+		PageSize:   pageSize,
+		TotalPages: 0,
+		TotalCount: 0,
+		WithTotal:  true,
+		KeySet:     false,
+		Order:      "",
+	}
+}
+
+// 返回一个游标分页的Page信息
+func NewCursorPageDao(cursor string, pageSize int64) *PageDao {
+	page := NewPageDao(1, pageSize)
+	page.KeySet = true
+	page.Cursor = cursor
+	return page
+}
+
+/******************************************************************************
+ * function: Offset
+ * description: 根据页号计算记录偏移量, 页号从1开始
+ * return {*}
+********************************************************************************/
+func (me *PageDao) Offset() int64 {
+	if me.PageNo <= 1 {
+		return 0
+	}
+	return (me.PageNo - 1) * me.PageSize
+}
+
+/******************************************************************************
+ * function: IsAsc
+ * description: 游标分页是否按升序排列
+ * return {*}
+********************************************************************************/
+func (me *PageDao) IsAsc() bool {
+	return strings.EqualFold(me.Order, PageOrderAsc)
+}
+
+/******************************************************************************
+ * function: CalcTotalPages
+ * description: 根据总记录数和每页记录数计算总页数
+ * param {int64} totalCount
+ * param {int64} pageSize
+ * return {*}
+********************************************************************************/
+func CalcTotalPages(totalCount int64, pageSize int64) int64 {
+	if totalCount <= 0 || pageSize <= 0 {
+		return 0
+	}
+	return (totalCount + pageSize - 1) / pageSize
+}
+
+/******************************************************************************
+ * function: EncodePageCursor
+ * description: 把最后一条记录的排序字段值和id编码成游标
+ * param {string} value 排序字段的值, 时间或整数
+ * param {int64} id
+ * return {*}
+********************************************************************************/
+func EncodePageCursor(value string, id int64) string {
+	raw := value + "|" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+/******************************************************************************
+ * function: DecodePageCursor
+ * description: 解析游标, 返回排序字段的值和id, 值只能是时间或整数
+ * param {string} cursor
+ * return {*}
+********************************************************************************/
+func DecodePageCursor(cursor string) (string, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, err
+	}
+	items := strings.Split(string(raw), "|")
+	if len(items) != 2 {
+		return "", 0, errors.New("invalid page cursor")
+	}
+	if _, err = StrToTime(items[0]); err != nil {
+		if _, err = strconv.ParseInt(items[0], 10, 64); err != nil {
+			return "", 0, errors.New("invalid page cursor value")
+		}
+	}
+	id, err := strconv.ParseInt(items[1], 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return items[0], id, nil
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestCalcTotalPages(t *testing.T) {
+	cases := []struct {
+		total, size, pages int64
+	}{
+		{0, 10, 0},
+		{1, 10, 1},
+		{10, 10, 1},
+		{11, 10, 2},
+		{95, 10, 10},
+		{5, 0, 0},
+	}
+	for _, v := range cases {
+		if got := CalcTotalPages(v.total, v.size); got != v.pages {
+			t.Errorf("CalcTotalPages(%d, %d) = %d, want %d", v.total, v.size, got, v.pages)
+		}
+	}
+}
+
+func TestPageOffset(t *testing.T) {
+	page := NewPageDao(3, 20)
+	if page.Offset() != 40 {
+		t.Errorf("page 3 offset = %d, want 40", page.Offset())
+	}
+	page.PageNo = 0
+	if page.Offset() != 0 {
+		t.Errorf("page 0 offset = %d, want 0", page.Offset())
+	}
+}
+
+func TestPageCursor(t *testing.T) {
+	cursor := EncodePageCursor("2025-03-01 08:30:00", 12345)
+	tm, id, err := DecodePageCursor(cursor)
+	if err != nil {
+		t.Fatalf("DecodePageCursor error:%v", err)
+	}
+	if tm != "2025-03-01 08:30:00" || id != 12345 {
+		t.Errorf("DecodePageCursor = %s, %d", tm, id)
+	}
+	if _, _, err = DecodePageCursor("not-a-cursor"); err == nil {
+		t.Error("DecodePageCursor should fail on invalid cursor")
+	}
+	// 按id等整数字段排序的游标
+	if v, id, err := DecodePageCursor(EncodePageCursor("98", 98)); err != nil || v != "98" || id != 98 {
+		t.Errorf("DecodePageCursor integer value = %s, %d, %v", v, id, err)
+	}
+	if _, _, err = DecodePageCursor(EncodePageCursor("1 or 1=1", 1)); err == nil {
+		t.Error("DecodePageCursor should fail on invalid time")
+	}
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt的计算强度, 调高后旧的哈希在下次登录时重新计算
+const passwordCost = 12
+
+// 旧密码未在期限内迁移时替换为此标记, 用户必须重置密码
+const PasswordResetRequired = "!reset"
+
+/******************************************************************************
+ * function: HashPassword
+ * description: 计算密码的bcrypt哈希, 结果中包含随机盐和强度
+ * param {string} passwd
+ * return {*}
+********************************************************************************/
+func HashPassword(passwd string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(passwd), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// IsPasswordHash 判断保存的密码是否已经是bcrypt哈希
+func IsPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+/******************************************************************************
+ * function: CheckPassword
+ * description: 校验密码, 兼容旧的AES加密密码
+ * param {string} stored 数据库中保存的密码
+ * param {string} passwd 用户输入的密码
+ * return {*} ok 密码正确, rehash 需要重新计算哈希保存(旧格式或强度不够)
+********************************************************************************/
+func CheckPassword(stored string, passwd string) (ok bool, rehash bool) {
+	if stored == "" || stored == PasswordResetRequired {
+		return false, false
+	}
+	if IsPasswordHash(stored) {
+		if bcrypt.CompareHashAndPassword([]byte(stored), []byte(passwd)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(stored))
+		return true, err != nil || cost < passwordCost
+	}
+	legacy, err := EncryptDataWithDefaultkey(passwd)
+	if err != nil || legacy != stored {
+		return false, false
+	}
+	return true, true
+}
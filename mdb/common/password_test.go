@@ -0,0 +1,39 @@
+package common
+
+import "testing"
+
+func TestHashAndCheckPassword(t *testing.T) {
+	hash, err := HashPassword("abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsPasswordHash(hash) {
+		t.Fatalf("expected bcrypt hash: %s", hash)
+	}
+	if ok, rehash := CheckPassword(hash, "abc123"); !ok || rehash {
+		t.Errorf("check hash: ok=%v rehash=%v", ok, rehash)
+	}
+	if ok, _ := CheckPassword(hash, "abc124"); ok {
+		t.Error("wrong password accepted")
+	}
+	other, _ := HashPassword("abc123")
+	if other == hash {
+		t.Error("hash without salt")
+	}
+}
+
+func TestCheckLegacyPassword(t *testing.T) {
+	legacy, err := EncryptDataWithDefaultkey("abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, rehash := CheckPassword(legacy, "abc123"); !ok || !rehash {
+		t.Errorf("check legacy: ok=%v rehash=%v", ok, rehash)
+	}
+	if ok, _ := CheckPassword(legacy, "abc124"); ok {
+		t.Error("wrong legacy password accepted")
+	}
+	if ok, _ := CheckPassword(PasswordResetRequired, ""); ok {
+		t.Error("reset marker accepted")
+	}
+}
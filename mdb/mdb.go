@@ -8,8 +8,11 @@
 package mdb
 
 import (
+	"database/sql"
 	"hjyserver/cfg"
+	"hjyserver/mdb/common"
 	"hjyserver/mdb/mysql"
+	"hjyserver/stream"
 )
 
 /******************************************************
@@ -20,6 +23,7 @@ import (
 func Open() bool {
 	result := mysql.Open()
 	if result {
+		initNotify()
 		if cfg.This.Svr.EnableH03 {
 			H03MdbInit()
 		}
@@ -29,6 +33,7 @@ func Open() bool {
 		if cfg.This.Svr.EnableX1s {
 			X1sMdbInit()
 		}
+		stream.SetViewerHooks(startRealDataPush, stopRealDataPush)
 	}
 	return result
 }
@@ -45,3 +50,23 @@ func Close() {
 	}
 	mysql.Close()
 }
+
+/******************************************************************************
+ * function: runInTx
+ * description: 在一个事务中执行fn, fn返回common.Success时提交, 否则回滚
+ * mqtt等外部通知需要在runInTx返回成功后再发送
+ * param {func(tx *sql.Tx) (int, interface{})} fn
+ * return {*}
+********************************************************************************/
+func runInTx(fn func(tx *sql.Tx) (int, interface{})) (int, interface{}) {
+	var status int = common.DBError
+	var result interface{} = "begin transaction failed"
+	ok := mysql.ExecWithTx(func(tx *sql.Tx) bool {
+		status, result = fn(tx)
+		return status == common.Success
+	})
+	if !ok && status == common.Success {
+		return common.DBError, "commit transaction failed"
+	}
+	return status, result
+}
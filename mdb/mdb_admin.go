@@ -0,0 +1,775 @@
+package mdb
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/notify"
+	"hjyserver/redis"
+	"hjyserver/sms"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminOperator 取得执行管理操作的用户id, 用于记录操作日志
+func adminOperator(c *gin.Context) int64 {
+	return c.GetInt64(common.AuthUserIdKey)
+}
+
+// swagger:model AdminUser
+type AdminUser struct {
+	mysql.User
+	Role string `json:"role"`
+}
+
+/******************************************************************************
+ * function: AdminQueryUsers
+ * description: 按账号、手机、邮箱或昵称模糊查询用户, 不返回密码
+ * param {*gin.Context} c
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func AdminQueryUsers(c *gin.Context, page *common.PageDao) (int, interface{}) {
+	filter := ""
+	if keyword := c.Query("keyword"); keyword != "" {
+		k := common.EscapeSql(keyword)
+		filter = fmt.Sprintf("account like '%%%s%%' or phone like '%%%s%%' or email like '%%%s%%' or nick_name like '%%%s%%'",
+			k, k, k, k)
+	}
+	if id := c.Query("user_id"); id != "" {
+		userId, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return common.ParamError, "user id error"
+		}
+		filter = fmt.Sprintf("id=%d", userId)
+	}
+	var users []mysql.User
+	mysql.QueryUserByCond(filter, page, "id desc", &users)
+	if len(users) == 0 {
+		return common.NoData, "no user"
+	}
+	results := make([]AdminUser, 0, len(users))
+	for _, v := range users {
+		results = append(results, AdminUser{User: v, Role: mysql.QueryUserRole(v.ID)})
+	}
+	return common.Success, results
+}
+
+/******************************************************************************
+ * function: AdminQueryDevices
+ * description: 按mac或名称模糊查询设备, 可以按类型过滤
+ * param {*gin.Context} c
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func AdminQueryDevices(c *gin.Context, page *common.PageDao) (int, interface{}) {
+	var conds []string
+	if keyword := c.Query("keyword"); keyword != "" {
+		k := common.EscapeSql(keyword)
+		conds = append(conds, fmt.Sprintf("(mac like '%%%s%%' or name like '%%%s%%')", k, k))
+	}
+	if deviceType := c.Query("type"); deviceType != "" {
+		conds = append(conds, fmt.Sprintf("type='%s'", common.EscapeSql(deviceType)))
+	}
+	var devices []mysql.Device
+	mysql.QueryDeviceByCond(strings.Join(conds, " and "), page, "id desc", &devices)
+	if len(devices) == 0 {
+		return common.NoData, "no device"
+	}
+	return common.Success, devices
+}
+
+/******************************************************************************
+ * function: AdminQueryDeviceUsers
+ * description: 查询绑定和共享设备的所有用户
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminQueryDeviceUsers(c *gin.Context) (int, interface{}) {
+	mac := c.Query("mac")
+	if mac == "" {
+		return common.ParamError, "mac required"
+	}
+	var users []mysql.UserDeviceDetail
+	mysql.QueryUserDeviceDetailByMac(common.EscapeSql(mac), &users)
+	if len(users) == 0 {
+		return common.NoData, "device not bound"
+	}
+	return common.Success, users
+}
+
+/******************************************************************************
+ * function: AdminQuerySecurityEvents
+ * description: 查询登录失败、锁定等安全事件, 可以按用户、账号、事件类型过滤
+ * param {*gin.Context} c
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func AdminQuerySecurityEvents(c *gin.Context, page *common.PageDao) (int, interface{}) {
+	var conds []string
+	if id := c.Query("user_id"); id != "" {
+		userId, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return common.ParamError, "user id error"
+		}
+		conds = append(conds, fmt.Sprintf("user_id=%d", userId))
+	}
+	if account := c.Query("account"); account != "" {
+		conds = append(conds, fmt.Sprintf("account='%s'", common.EscapeSql(account)))
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		conds = append(conds, fmt.Sprintf("event_type='%s'", common.EscapeSql(eventType)))
+	}
+	var events []mysql.SecurityEvent
+	mysql.QuerySecurityEventByCond(strings.Join(conds, " and "), page, "id desc", &events)
+	if len(events) == 0 {
+		return common.NoData, "no security event"
+	}
+	return common.Success, events
+}
+
+// swagger:model AdminDeviceReq
+type AdminDeviceReq struct {
+	// required: true
+	Mac string `json:"mac"`
+}
+
+/******************************************************************************
+ * function: AdminUnbindDevice
+ * description: 强制解绑设备, 删除设备和所有用户的关系以及共享、过户记录
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminUnbindDevice(c *gin.Context) (int, interface{}) {
+	req := &AdminDeviceReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.Mac == "" {
+		return common.ParamError, "mac required"
+	}
+	var devices []mysql.Device
+	mysql.QueryDeviceByCond(fmt.Sprintf("mac='%s'", common.EscapeSql(req.Mac)), nil, nil, &devices)
+	if len(devices) == 0 {
+		return common.NoExist, "device not exist"
+	}
+	device := &devices[0]
+	status, result := runInTx(func(tx *sql.Tx) (int, interface{}) {
+		if !mysql.DeleteDaoByFilterTx(tx, common.UserDeviceRelationTbl, fmt.Sprintf("device_id=%d", device.ID)) ||
+			!mysql.DeleteUserShareDeviceByUserIdTx(tx, 0, 0, device.ID) ||
+			!mysql.DeleteUserTransferDeviceByUserIdTx(tx, 0, 0, device.ID) {
+			return common.DBError, "unbind device failed"
+		}
+		return common.Success, "unbind device success"
+	})
+	if status != common.Success {
+		return status, result
+	}
+	mysql.RemoveDeviceOverviewByMac(device.Mac)
+	mysql.UnsubscribeDeviceTopic(device.Mac)
+	mylog.Log.Infof("admin %d unbind device %s", adminOperator(c), device.Mac)
+	return status, result
+}
+
+// swagger:model AdminUserReq
+type AdminUserReq struct {
+	// required: true
+	UserId int64 `json:"user_id"`
+}
+
+/******************************************************************************
+ * function: AdminRevokeUserTokens
+ * description: 撤销用户所有的会话和旧格式token, 用户需要重新登录
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminRevokeUserTokens(c *gin.Context) (int, interface{}) {
+	req := &AdminUserReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.UserId <= 0 {
+		return common.ParamError, "user id required"
+	}
+	if !mysql.RevokeUserSession(req.UserId, "") {
+		return common.DBError, "revoke session failed"
+	}
+	redis.SetValueEx(fmt.Sprintf("%s_%d", common.UserTbl, req.UserId), "", 1)
+	mylog.Log.Infof("admin %d revoke tokens of user %d", adminOperator(c), req.UserId)
+	return common.Success, "revoke tokens success"
+}
+
+/******************************************************************************
+ * function: AdminDeleteOtaWhiteList
+ * description: 从X1s OTA白名单中删除mac, 多个mac用;分隔
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminDeleteOtaWhiteList(c *gin.Context) (int, interface{}) {
+	req := &X1sWhiteListReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.Mac == "" {
+		return common.ParamError, "mac required"
+	}
+	tblName := mysql.NewX1sOtaWhiteList().TableName()
+	for _, mac := range strings.Split(req.Mac, ";") {
+		if !mysql.DeleteDaoByFilter(tblName, fmt.Sprintf("mac='%s'", common.EscapeSql(mac))) {
+			return common.DBError, "delete white list failed"
+		}
+	}
+	mylog.Log.Infof("admin %d delete ota white list %s", adminOperator(c), req.Mac)
+	return common.Success, "ok"
+}
+
+// swagger:model AdminRoleReq
+type AdminRoleReq struct {
+	// required: true
+	UserId int64 `json:"user_id"`
+	// required: true
+	// user/caregiver/support/admin
+	Role string `json:"role"`
+}
+
+/******************************************************************************
+ * function: AdminSetUserRole
+ * description: 设置用户的角色
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminSetUserRole(c *gin.Context) (int, interface{}) {
+	req := &AdminRoleReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.UserId <= 0 {
+		return common.ParamError, "user id required"
+	}
+	if !mysql.IsValidRole(req.Role) {
+		return common.ParamError, "role error"
+	}
+	if !mysql.NewUser().QueryByID(req.UserId) {
+		return common.NoExist, "user not exist"
+	}
+	role, ok := mysql.SetUserRole(req.UserId, req.Role, adminOperator(c))
+	if !ok {
+		return common.DBError, "set role failed"
+	}
+	mylog.Log.Infof("admin %d set user %d role to %s", adminOperator(c), req.UserId, req.Role)
+	return common.Success, role
+}
+
+/******************************************************************************
+ * function: AdminCreateOrganization
+ * description: 创建合作机构
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminCreateOrganization(c *gin.Context) (int, interface{}) {
+	org := mysql.NewOrganization()
+	if err := c.ShouldBindJSON(org); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if org.Name == "" {
+		return common.ParamError, "name required"
+	}
+	org.ID = 0
+	org.Name = common.EscapeSql(org.Name)
+	org.Contact = common.EscapeSql(org.Contact)
+	org.Phone = common.EscapeSql(org.Phone)
+	org.Remark = common.EscapeSql(org.Remark)
+	org.OperatorId = adminOperator(c)
+	org.CreateTime = common.GetNowTime()
+	if !org.Insert() {
+		return common.DBError, "create organization failed"
+	}
+	mylog.Log.Infof("admin %d create organization %d", adminOperator(c), org.ID)
+	return common.Success, org
+}
+
+func AdminQueryOrganizations(c *gin.Context) (int, interface{}) {
+	var orgs []mysql.Organization
+	mysql.QueryOrganizationByCond(nil, "id desc", &orgs)
+	if len(orgs) == 0 {
+		return common.NoData, "no organization"
+	}
+	return common.Success, orgs
+}
+
+// swagger:model ApiKeyReq
+type ApiKeyReq struct {
+	// 更新和撤销时使用
+	ID int64 `json:"id"`
+	// 创建时使用
+	OrgId int64  `json:"org_id"`
+	Name  string `json:"name"`
+	// vitals:read/reports:read/alarms:receive/devices:control
+	Scopes []string `json:"scopes"`
+	// 允许访问的设备mac
+	Macs []string `json:"macs"`
+	// 每分钟最多请求数, 0使用缺省限额
+	RateLimit int `json:"rate_limit"`
+}
+
+// swagger:model ApiKeyResp
+type ApiKeyResp struct {
+	mysql.ApiKey
+	// 明文key, 只在创建时返回一次
+	Key string `json:"key"`
+}
+
+// setApiKeyGrants 检查并设置key的授权范围、设备和限额
+func setApiKeyGrants(key *mysql.ApiKey, req *ApiKeyReq) (int, string) {
+	for _, v := range req.Scopes {
+		if !mysql.IsValidScope(v) {
+			return common.ParamError, "scope error: " + v
+		}
+	}
+	macs := make([]string, 0, len(req.Macs))
+	for _, v := range req.Macs {
+		if v = strings.TrimSpace(v); v != "" {
+			macs = append(macs, common.EscapeSql(strings.ToUpper(v)))
+		}
+	}
+	if req.RateLimit < 0 {
+		return common.ParamError, "rate limit error"
+	}
+	key.Scopes = strings.Join(req.Scopes, ",")
+	key.Macs = strings.Join(macs, ",")
+	key.RateLimit = req.RateLimit
+	return common.Success, ""
+}
+
+/******************************************************************************
+ * function: AdminCreateApiKey
+ * description: 为合作机构创建api key, 明文key只在这里返回一次
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminCreateApiKey(c *gin.Context) (int, interface{}) {
+	req := &ApiKeyReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if !mysql.NewOrganization().QueryByID(req.OrgId) {
+		return common.NoExist, "organization not exist"
+	}
+	key := mysql.NewApiKey()
+	key.OrgId = req.OrgId
+	key.Name = common.EscapeSql(req.Name)
+	key.OperatorId = adminOperator(c)
+	if status, msg := setApiKeyGrants(key, req); status != common.Success {
+		return status, msg
+	}
+	plain, ok := mysql.CreateApiKey(key)
+	if !ok {
+		return common.DBError, "create api key failed"
+	}
+	mylog.Log.Infof("admin %d create api key %d for organization %d", adminOperator(c), key.ID, key.OrgId)
+	return common.Success, ApiKeyResp{ApiKey: *key, Key: plain}
+}
+
+/******************************************************************************
+ * function: AdminUpdateApiKey
+ * description: 修改api key的授权范围、设备和限额
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminUpdateApiKey(c *gin.Context) (int, interface{}) {
+	req := &ApiKeyReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	key := mysql.NewApiKey()
+	if !key.QueryByID(req.ID) || key.Status != mysql.ApiKeyActive {
+		return common.NoExist, "api key not exist"
+	}
+	if status, msg := setApiKeyGrants(key, req); status != common.Success {
+		return status, msg
+	}
+	if !key.Update() {
+		return common.DBError, "update api key failed"
+	}
+	mylog.Log.Infof("admin %d update api key %d", adminOperator(c), key.ID)
+	return common.Success, key
+}
+
+/******************************************************************************
+ * function: AdminRevokeApiKey
+ * description: 撤销api key, 立即失效
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminRevokeApiKey(c *gin.Context) (int, interface{}) {
+	req := &ApiKeyReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.ID <= 0 {
+		return common.ParamError, "id required"
+	}
+	if !mysql.RevokeApiKey(req.ID) {
+		return common.DBError, "revoke api key failed"
+	}
+	mylog.Log.Infof("admin %d revoke api key %d", adminOperator(c), req.ID)
+	return common.Success, "revoke api key success"
+}
+
+func AdminQueryApiKeys(c *gin.Context) (int, interface{}) {
+	filter := ""
+	if id := c.Query("org_id"); id != "" {
+		orgId, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return common.ParamError, "org id error"
+		}
+		filter = fmt.Sprintf("org_id=%d", orgId)
+	}
+	var keys []mysql.ApiKey
+	mysql.QueryApiKeyByCond(filter, "id desc", &keys)
+	if len(keys) == 0 {
+		return common.NoData, "no api key"
+	}
+	return common.Success, keys
+}
+
+/******************************************************************************
+ * function: AdminQueryApiKeyUsage
+ * description: 查询api key最近几天按接口的调用次数
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminQueryApiKeyUsage(c *gin.Context) (int, interface{}) {
+	id, err := strconv.ParseInt(c.Query("id"), 10, 64)
+	if err != nil {
+		return common.ParamError, "id error"
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days <= 0 {
+		return common.ParamError, "days error"
+	}
+	from := time.Now().AddDate(0, 0, 1-days).Format(cfg.DateFmtStr)
+	usage := mysql.QueryApiKeyUsage(id, from)
+	if len(usage) == 0 {
+		return common.NoData, "no usage"
+	}
+	return common.Success, usage
+}
+
+// swagger:model WebhookReq
+type WebhookReq struct {
+	// 更新、删除和重新推送时使用
+	ID int64 `json:"id"`
+	// 创建时使用
+	OrgId int64 `json:"org_id"`
+	// https地址, 必须解析到公网地址
+	Url string `json:"url"`
+	// alarm.raised/device.online/device.offline/report.study_ready/report.sleep_ready/fall.detected/alarm.escalated
+	Events []string `json:"events"`
+	// 0:停用 1:启用, 只在更新时使用
+	Status int `json:"status"`
+}
+
+// swagger:model WebhookResp
+type WebhookResp struct {
+	mysql.Webhook
+	// 签名密钥, 只在创建时返回一次
+	Secret string `json:"secret"`
+}
+
+// setWebhookTarget 检查并设置推送地址和订阅的事件
+func setWebhookTarget(hook *mysql.Webhook, req *WebhookReq) (int, string) {
+	if !mysql.IsValidWebhookUrl(req.Url) {
+		return common.ParamError, "url must be https and resolve to public addresses"
+	}
+	if len(req.Events) == 0 {
+		return common.ParamError, "events required"
+	}
+	for _, v := range req.Events {
+		if !mysql.IsValidWebhookEvent(v) {
+			return common.ParamError, "event error: " + v
+		}
+	}
+	hook.Url = common.EscapeSql(req.Url)
+	hook.Events = strings.Join(req.Events, ",")
+	return common.Success, ""
+}
+
+/******************************************************************************
+ * function: AdminCreateWebhook
+ * description: 为合作机构创建webhook, 签名密钥只在这里返回一次
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminCreateWebhook(c *gin.Context) (int, interface{}) {
+	req := &WebhookReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if !mysql.NewOrganization().QueryByID(req.OrgId) {
+		return common.NoExist, "organization not exist"
+	}
+	hook := mysql.NewWebhook()
+	hook.OrgId = req.OrgId
+	hook.OperatorId = adminOperator(c)
+	if status, msg := setWebhookTarget(hook, req); status != common.Success {
+		return status, msg
+	}
+	secret, ok := mysql.CreateWebhook(hook)
+	if !ok {
+		return common.DBError, "create webhook failed"
+	}
+	mylog.Log.Infof("admin %d create webhook %d for organization %d", adminOperator(c), hook.ID, hook.OrgId)
+	return common.Success, WebhookResp{Webhook: *hook, Secret: secret}
+}
+
+/******************************************************************************
+ * function: AdminUpdateWebhook
+ * description: 修改webhook的地址、订阅的事件和状态
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminUpdateWebhook(c *gin.Context) (int, interface{}) {
+	req := &WebhookReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	hook := mysql.NewWebhook()
+	if !hook.QueryByID(req.ID) {
+		return common.NoExist, "webhook not exist"
+	}
+	if req.Status != mysql.WebhookDisabled && req.Status != mysql.WebhookEnabled {
+		return common.ParamError, "status error"
+	}
+	if status, msg := setWebhookTarget(hook, req); status != common.Success {
+		return status, msg
+	}
+	hook.Status = req.Status
+	hook.UpdateTime = common.GetNowTime()
+	if !hook.Update() {
+		return common.DBError, "update webhook failed"
+	}
+	mylog.Log.Infof("admin %d update webhook %d", adminOperator(c), hook.ID)
+	return common.Success, hook
+}
+
+/******************************************************************************
+ * function: AdminDeleteWebhook
+ * description: 删除webhook, 未完成的推送在重试时进入死信列表
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminDeleteWebhook(c *gin.Context) (int, interface{}) {
+	req := &WebhookReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	hook := mysql.NewWebhook()
+	if !hook.QueryByID(req.ID) {
+		return common.NoExist, "webhook not exist"
+	}
+	if !hook.Delete() {
+		return common.DBError, "delete webhook failed"
+	}
+	mylog.Log.Infof("admin %d delete webhook %d", adminOperator(c), req.ID)
+	return common.Success, "delete webhook success"
+}
+
+func AdminQueryWebhooks(c *gin.Context) (int, interface{}) {
+	filter := ""
+	if id := c.Query("org_id"); id != "" {
+		orgId, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return common.ParamError, "org id error"
+		}
+		filter = fmt.Sprintf("org_id=%d", orgId)
+	}
+	var hooks []mysql.Webhook
+	mysql.QueryWebhookByCond(filter, "id desc", &hooks)
+	if len(hooks) == 0 {
+		return common.NoData, "no webhook"
+	}
+	return common.Success, hooks
+}
+
+/******************************************************************************
+ * function: AdminQueryWebhookDeliveries
+ * description: 查询推送记录, status=2时为死信列表
+ * param {*gin.Context} c
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func AdminQueryWebhookDeliveries(c *gin.Context, page *common.PageDao) (int, interface{}) {
+	var conds []string
+	if v := c.Query("webhook_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return common.ParamError, "webhook id error"
+		}
+		conds = append(conds, fmt.Sprintf("webhook_id=%d", id))
+	}
+	if v := c.Query("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return common.ParamError, "status error"
+		}
+		conds = append(conds, fmt.Sprintf("status=%d", status))
+	}
+	if v := c.Query("event_type"); v != "" {
+		conds = append(conds, fmt.Sprintf("event_type='%s'", common.EscapeSql(v)))
+	}
+	if v := c.Query("mac"); v != "" {
+		conds = append(conds, fmt.Sprintf("mac='%s'", common.EscapeSql(v)))
+	}
+	var deliveries []mysql.WebhookDelivery
+	mysql.QueryWebhookDeliveryByCond(strings.Join(conds, " and "), page, "id desc", &deliveries)
+	if len(deliveries) == 0 {
+		return common.NoData, "no delivery"
+	}
+	return common.Success, deliveries
+}
+
+/******************************************************************************
+ * function: AdminQueryNotifyAttempts
+ * description: 查询用户通知的发送记录
+ * param {*gin.Context} c
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func AdminQueryNotifyAttempts(c *gin.Context, page *common.PageDao) (int, interface{}) {
+	var conds []string
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return common.ParamError, "user id error"
+		}
+		conds = append(conds, fmt.Sprintf("user_id=%d", id))
+	}
+	if v := c.Query("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return common.ParamError, "status error"
+		}
+		conds = append(conds, fmt.Sprintf("status=%d", status))
+	}
+	for _, k := range []string{"event_id", "event_type", "channel", "mac"} {
+		if v := c.Query(k); v != "" {
+			conds = append(conds, fmt.Sprintf("%s='%s'", k, common.EscapeSql(v)))
+		}
+	}
+	var attempts []mysql.NotifyAttempt
+	mysql.QueryNotifyAttemptByCond(strings.Join(conds, " and "), page, "id desc", &attempts)
+	if len(attempts) == 0 {
+		return common.NoData, "no attempt"
+	}
+	return common.Success, attempts
+}
+
+/******************************************************************************
+ * function: AdminQueryNotifyTemplates
+ * description: 查询数据库中的通知模板, 不包括模板文件中的模板
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminQueryNotifyTemplates(c *gin.Context) (int, interface{}) {
+	var conds []string
+	for _, k := range []string{"event_key", "locale"} {
+		if v := c.Query(k); v != "" {
+			conds = append(conds, fmt.Sprintf("%s='%s'", k, common.EscapeSql(v)))
+		}
+	}
+	var templates []mysql.NotifyTemplate
+	mysql.QueryNotifyTemplateByCond(strings.Join(conds, " and "), nil, "event_key, locale", &templates)
+	if len(templates) == 0 {
+		return common.NoData, "no template"
+	}
+	return common.Success, templates
+}
+
+/******************************************************************************
+ * function: AdminSaveNotifyTemplate
+ * description: 保存通知模板, 同一模板key和语言已经存在时修改, 保存后立即重新加载模板
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminSaveNotifyTemplate(c *gin.Context) (int, interface{}) {
+	tpl := mysql.NewNotifyTemplate()
+	if err := c.ShouldBindJSON(tpl); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if tpl.EventKey == "" || tpl.Content == "" {
+		return common.ParamError, "event key and content required"
+	}
+	if !localeRegexp.MatchString(tpl.Locale) {
+		return common.ParamError, "locale format error"
+	}
+	if _, err := notify.ParseTemplate(tpl.EventKey, tpl.Content); err != nil {
+		return common.ParamError, "template error: " + err.Error()
+	}
+	tpl.OperatorId = adminOperator(c)
+	if !mysql.SaveNotifyTemplate(tpl) {
+		return common.DBError, "save template failed"
+	}
+	reloadNotifyTemplates()
+	mylog.Log.Infof("admin %d save notify template %s/%s", adminOperator(c), tpl.Locale, tpl.EventKey)
+	return common.Success, tpl
+}
+
+/******************************************************************************
+ * function: AdminDeleteNotifyTemplate
+ * description: 删除数据库中的通知模板, 删除后使用模板文件中的同名模板
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminDeleteNotifyTemplate(c *gin.Context) (int, interface{}) {
+	req := mysql.NewNotifyTemplate()
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	tpl := mysql.NewNotifyTemplate()
+	if !tpl.QueryByID(req.ID) {
+		return common.NoExist, "template not exist"
+	}
+	if !tpl.Delete() {
+		return common.DBError, "delete template failed"
+	}
+	reloadNotifyTemplates()
+	mylog.Log.Infof("admin %d delete notify template %s/%s", adminOperator(c), tpl.Locale, tpl.EventKey)
+	return common.Success, "delete template success"
+}
+
+/******************************************************************************
+ * function: AdminRedeliverWebhook
+ * description: 手动重新推送一条记录, 包括死信列表中的记录
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminRedeliverWebhook(c *gin.Context) (int, interface{}) {
+	req := &WebhookReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	delivery, ok := mysql.RedeliverWebhook(req.ID)
+	if !ok {
+		return common.NoExist, "delivery or webhook not exist"
+	}
+	mylog.Log.Infof("admin %d redeliver webhook delivery %d", adminOperator(c), req.ID)
+	return common.Success, delivery
+}
+
+/******************************************************************************
+ * function: AdminQuerySmsStats
+ * description: 查询每个短信供应商的发送和送达统计, 从本实例启动开始
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminQuerySmsStats(c *gin.Context) (int, interface{}) {
+	return common.Success, sms.Stats()
+}
@@ -0,0 +1,274 @@
+package mdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 备注最大长度
+const alarmNoteMaxLen = 255
+
+// swagger:model AlarmReq
+type AlarmReq struct {
+	AlarmId int64 `json:"alarm_id"`
+	// 确认或恢复的备注
+	Note string `json:"note"`
+}
+
+// alarmTimeFilter 报警时间范围, 参数为空时不限制
+func alarmTimeFilter(c *gin.Context) ([]string, bool) {
+	var conds []string
+	if v := c.Query("start_time"); v != "" {
+		if _, err := time.Parse(cfg.TmFmtStr, v); err != nil {
+			return nil, false
+		}
+		conds = append(conds, fmt.Sprintf("open_time>='%s'", v))
+	}
+	if v := c.Query("end_time"); v != "" {
+		if _, err := time.Parse(cfg.TmFmtStr, v); err != nil {
+			return nil, false
+		}
+		conds = append(conds, fmt.Sprintf("open_time<'%s'", v))
+	}
+	return conds, true
+}
+
+/******************************************************************************
+ * function: alarmFilter
+ * description: 按用户或设备查询报警的条件, 至少需要user_id或mac之一, 权限由鉴权中间件检查
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func alarmFilter(c *gin.Context) ([]string, int, string) {
+	var conds []string
+	if v := c.Query("user_id"); v != "" {
+		userId, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, common.ParamError, "user id error"
+		}
+		conds = append(conds, mysql.AlarmUserFilter(userId))
+	}
+	if v := c.Query("mac"); v != "" {
+		conds = append(conds, fmt.Sprintf("mac='%s'", common.EscapeSql(v)))
+	}
+	if len(conds) == 0 {
+		return nil, common.ParamError, "user id or mac required"
+	}
+	timeConds, ok := alarmTimeFilter(c)
+	if !ok {
+		return nil, common.ParamError, "time format error"
+	}
+	return append(conds, timeConds...), common.Success, ""
+}
+
+// alarmStatusFilter 报警来源和状态条件
+func alarmStatusFilter(c *gin.Context) ([]string, bool) {
+	var conds []string
+	if v := c.Query("source"); v != "" {
+		conds = append(conds, fmt.Sprintf("source='%s'", common.EscapeSql(v)))
+	}
+	if v := c.Query("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, false
+		}
+		conds = append(conds, fmt.Sprintf("status=%d", status))
+	}
+	return conds, true
+}
+
+/******************************************************************************
+ * function: QueryActiveAlarms
+ * description: 查询未恢复的报警, 包括未处理和已确认
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryActiveAlarms(c *gin.Context) (int, interface{}) {
+	conds, status, msg := alarmFilter(c)
+	if status != common.Success {
+		return status, msg
+	}
+	conds = append(conds, fmt.Sprintf("status in (%d,%d)", mysql.AlarmOpen, mysql.AlarmAcknowledged))
+	var alarms []mysql.Alarm
+	mysql.QueryAlarmByCond(strings.Join(conds, " and "), nil, "open_time desc", &alarms)
+	if len(alarms) == 0 {
+		return common.NoData, "no active alarm"
+	}
+	return common.Success, alarms
+}
+
+/******************************************************************************
+ * function: QueryAlarmHistory
+ * description: 分页查询报警历史, 可以按来源、状态和报警时间过滤
+ * param {*gin.Context} c
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func QueryAlarmHistory(c *gin.Context, page *common.PageDao) (int, interface{}) {
+	conds, status, msg := alarmFilter(c)
+	if status != common.Success {
+		return status, msg
+	}
+	statusConds, ok := alarmStatusFilter(c)
+	if !ok {
+		return common.ParamError, "status error"
+	}
+	conds = append(conds, statusConds...)
+	var alarms []mysql.Alarm
+	mysql.QueryAlarmByCond(strings.Join(conds, " and "), page, "open_time desc", &alarms)
+	if len(alarms) == 0 {
+		return common.NoData, "no alarm"
+	}
+	return common.Success, alarms
+}
+
+/******************************************************************************
+ * function: QueryAlarmStats
+ * description: 统计报警数量、平均确认时间MTTA和平均恢复时间MTTR, 第一条为合计, 之后按来源
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryAlarmStats(c *gin.Context) (int, interface{}) {
+	conds, status, msg := alarmFilter(c)
+	if status != common.Success {
+		return status, msg
+	}
+	return common.Success, mysql.StatAlarms(strings.Join(conds, " and "), replicaFor(c))
+}
+
+// decodeAlarmReq 解析确认和恢复的请求
+func decodeAlarmReq(c *gin.Context) (*AlarmReq, int, string) {
+	req := &AlarmReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return nil, common.JsonError, "json format error"
+	}
+	if req.AlarmId == 0 {
+		return nil, common.ParamError, "alarm id required"
+	}
+	if r := []rune(req.Note); len(r) > alarmNoteMaxLen {
+		req.Note = string(r[:alarmNoteMaxLen])
+	}
+	return req, common.Success, ""
+}
+
+/******************************************************************************
+ * function: AckAlarm
+ * description: 护理人员确认报警, 确认人为调用者
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AckAlarm(c *gin.Context) (int, interface{}) {
+	req, status, msg := decodeAlarmReq(c)
+	if status != common.Success {
+		return status, msg
+	}
+	alarm, status, msg := mysql.AckAlarm(req.AlarmId, c.GetInt64(common.AuthUserIdKey), req.Note)
+	if status != common.Success {
+		return status, msg
+	}
+	return common.Success, alarm
+}
+
+/******************************************************************************
+ * function: ResolveAlarm
+ * description: 手动恢复报警
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func ResolveAlarm(c *gin.Context) (int, interface{}) {
+	req, status, msg := decodeAlarmReq(c)
+	if status != common.Success {
+		return status, msg
+	}
+	alarm, status, msg := mysql.ResolveAlarm(req.AlarmId, c.GetInt64(common.AuthUserIdKey), req.Note)
+	if status != common.Success {
+		return status, msg
+	}
+	return common.Success, alarm
+}
+
+// adminAlarmFilter 管理后台按机构或设备查询报警的条件
+func adminAlarmFilter(c *gin.Context) ([]string, int, string) {
+	var conds []string
+	if v := c.Query("org_id"); v != "" {
+		orgId, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, common.ParamError, "org id error"
+		}
+		conds = append(conds, mysql.AlarmOrgFilter(orgId))
+	}
+	if v := c.Query("mac"); v != "" {
+		conds = append(conds, fmt.Sprintf("mac='%s'", common.EscapeSql(v)))
+	}
+	timeConds, ok := alarmTimeFilter(c)
+	if !ok {
+		return nil, common.ParamError, "time format error"
+	}
+	return append(conds, timeConds...), common.Success, ""
+}
+
+/******************************************************************************
+ * function: AdminQueryAlarms
+ * description: 管理后台按机构、设备、来源和状态查询报警
+ * param {*gin.Context} c
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func AdminQueryAlarms(c *gin.Context, page *common.PageDao) (int, interface{}) {
+	conds, status, msg := adminAlarmFilter(c)
+	if status != common.Success {
+		return status, msg
+	}
+	statusConds, ok := alarmStatusFilter(c)
+	if !ok {
+		return common.ParamError, "status error"
+	}
+	conds = append(conds, statusConds...)
+	var alarms []mysql.Alarm
+	mysql.QueryAlarmByCond(strings.Join(conds, " and "), page, "open_time desc", &alarms)
+	if len(alarms) == 0 {
+		return common.NoData, "no alarm"
+	}
+	return common.Success, alarms
+}
+
+/******************************************************************************
+ * function: AdminQueryAlarmEscalations
+ * description: 查询报警的升级状态
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminQueryAlarmEscalations(c *gin.Context) (int, interface{}) {
+	alarmId, err := strconv.ParseInt(c.Query("alarm_id"), 10, 64)
+	if err != nil {
+		return common.ParamError, "alarm id error"
+	}
+	var escalations []mysql.AlarmEscalation
+	mysql.QueryAlarmEscalationByCond(fmt.Sprintf("alarm_id=%d", alarmId), "id", -1, &escalations)
+	if len(escalations) == 0 {
+		return common.NoData, "no escalation"
+	}
+	return common.Success, escalations
+}
+
+/******************************************************************************
+ * function: AdminQueryAlarmStats
+ * description: 管理后台按机构或设备统计MTTA/MTTR
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AdminQueryAlarmStats(c *gin.Context) (int, interface{}) {
+	conds, status, msg := adminAlarmFilter(c)
+	if status != common.Success {
+		return status, msg
+	}
+	return common.Success, mysql.StatAlarms(strings.Join(conds, " and "), replicaFor(c))
+}
@@ -8,6 +8,7 @@
 package mdb
 
 import (
+	"database/sql"
 	"fmt"
 	"hjyserver/cfg"
 	"hjyserver/mdb/common"
@@ -67,17 +68,17 @@ func InsertDevice(c *gin.Context) (int, interface{}) {
 	if len(gList) == 0 {
 		ok = body.Insert()
 	} else {
+		// 设备已被其他用户绑定时不能修改设备信息
+		filter = fmt.Sprintf("device_id=%d and flag=%d", gList[0].ID, common.NormalDeviceFlag)
+		var rList []mysql.UserDeviceRelation
+		mysql.QueryUserDeviceRelationByCond(filter, nil, nil, &rList)
+		if len(rList) > 0 {
+			return common.HasExist, "device already exist and not been insert"
+		}
 		body.ID = gList[0].ID
 		ok = body.Update()
 	}
 	if ok {
-		// 添加用户和设备的关联关系
-		filter = fmt.Sprintf("device_id=%d and flag=%d", body.ID, common.NormalDeviceFlag)
-		var gList []mysql.UserDeviceRelation
-		mysql.QueryUserDeviceRelationByCond(filter, nil, nil, &gList)
-		if len(gList) > 0 {
-			return common.HasExist, "device already exist and not been insert"
-		}
 		// subscribe topic
 		if body.Type == mysql.LampType {
 			if cfg.This.Svr.EnableHl77 {
@@ -385,45 +386,53 @@ func SaveConfirmShareDevice(userDevice *mysql.UserDevice, userShare *mysql.UserS
 	// 检查是否已经共享相同的设备, 没有则添加, 有则更新
 	var userShareList []mysql.UserShareDevice
 	mysql.QueryUserShareDevice(userShare.FromUserId, userShare.ToUserId, userShare.DeviceId, -1, &userShareList)
-	if len(userShareList) == 0 {
-		if !userShare.Insert() {
-			return common.DBError, "insert error"
-		}
-	} else {
+	if len(userShareList) > 0 {
 		userShare.ID = userShareList[0].ID
-		if !userShare.Update() {
-			return common.DBError, "update error"
-		}
 	}
-
 	userDevice.UserId = userShare.ToUserId
 	userDevice.Flag = common.ShareDeviceFlag
-	// 如果用户已经确认了共享设备，则添加设备和用户的关系
-	if userShare.Confirm == common.DeviceConfirmFlag {
-		// 添加用户和设备的关联关系
-		userDeviceRelation := mysql.NewUserDeviceRelation()
-		userDeviceRelation.UserId = userShare.ToUserId
-		userDeviceRelation.DeviceId = userShare.DeviceId
-		userDeviceRelation.Flag = common.ShareDeviceFlag // share device is 1
-		// check if the relation exist
-		filter := fmt.Sprintf("user_id=%d and device_id=%d", userDeviceRelation.UserId, userDeviceRelation.DeviceId)
-		var gList []mysql.UserDeviceRelation
-		mysql.QueryUserDeviceRelationByCond(filter, nil, nil, &gList)
-		if len(gList) > 0 {
-			userDeviceRelation = &gList[0]
-			// 如果已经存在用户和设备关系记录，并且用户和设备关系不是分享关系，则不再添加，返回错误
-			if userDeviceRelation.Flag == common.NormalDeviceFlag {
-				userShare.Delete()
-				return common.AlreadyBind, "device has binded the user, not allow shared"
+	// 添加用户和设备的关联关系
+	userDeviceRelation := mysql.NewUserDeviceRelation()
+	userDeviceRelation.UserId = userShare.ToUserId
+	userDeviceRelation.DeviceId = userShare.DeviceId
+	userDeviceRelation.Flag = common.ShareDeviceFlag // share device is 1
+	// 在事务中检查用户和设备的关系, 避免检查后关系被并发修改
+	binded := false
+	status, result := runInTx(func(tx *sql.Tx) (int, interface{}) {
+		flag, exist, ok := mysql.QueryUserDeviceFlagTx(tx, userDeviceRelation.UserId, userDeviceRelation.DeviceId)
+		if !ok {
+			return common.DBError, "query device relation error"
+		}
+		// 如果已经存在用户和设备关系记录，并且用户和设备关系不是分享关系，则不再添加，删除共享记录
+		if userShare.Confirm == common.DeviceConfirmFlag && exist && flag == common.NormalDeviceFlag {
+			binded = true
+			if userShare.ID > 0 && !userShare.DeleteTx(tx) {
+				return common.DBError, "delete error"
 			}
-		} else {
-			if !userDeviceRelation.Insert() {
+			return common.Success, nil
+		}
+		if userShare.ID == 0 {
+			if !userShare.InsertTx(tx) {
+				return common.DBError, "insert error"
+			}
+		} else if !userShare.UpdateTx(tx) {
+			return common.DBError, "update error"
+		}
+		// 如果用户已经确认了共享设备，则添加设备和用户的关系
+		if userShare.Confirm == common.DeviceConfirmFlag && !exist {
+			if !userDeviceRelation.InsertTx(tx) {
 				return common.DBError, "insert error"
 			}
 		}
+		return common.Success, userDevice
+	})
+	if status == common.Success && binded {
+		return common.AlreadyBind, "device has binded the user, not allow shared"
+	}
+	if status == common.Success && userShare.Confirm == common.DeviceConfirmFlag {
 		mq.PublishData(common.MakeShareDeviceNotifyTopic(userDevice.UserId), userDevice)
 	}
-	return common.Success, userDevice
+	return status, result
 }
 
 /******************************************************************************
@@ -517,41 +526,50 @@ func ConfirmSharedDevice(c *gin.Context) (int, interface{}) {
 	userShareDevice := &userShareDevices[0]
 	if req.Confirm {
 		userShareDevice.Confirm = common.DeviceConfirmFlag
-		if userShareDevice.Update() {
-			// 添加用户和设备的关联关系
-			userDeviceRelation := mysql.NewUserDeviceRelation()
-			userDeviceRelation.UserId = userShareDevice.ToUserId
-			userDeviceRelation.DeviceId = userShareDevice.DeviceId
-			userDeviceRelation.Flag = common.ShareDeviceFlag // share device is 1
-			// check if the relation exist
-			filter := fmt.Sprintf("user_id=%d and device_id=%d", userDeviceRelation.UserId, userDeviceRelation.DeviceId)
-			var gList []mysql.UserDeviceRelation
-			mysql.QueryUserDeviceRelationByCond(filter, nil, nil, &gList)
-			if len(gList) > 0 {
-				userDeviceRelation = &gList[0]
-				if userDeviceRelation.Flag == common.NormalDeviceFlag {
-					userShareDevice.Delete()
-					return common.NoPermission, "device has binded the user, not allow shared"
-				}
-			} else {
-				if !userDeviceRelation.Insert() {
-					return common.DBError, "insert error"
+		// 添加用户和设备的关联关系
+		userDeviceRelation := mysql.NewUserDeviceRelation()
+		userDeviceRelation.UserId = userShareDevice.ToUserId
+		userDeviceRelation.DeviceId = userShareDevice.DeviceId
+		userDeviceRelation.Flag = common.ShareDeviceFlag // share device is 1
+		// 在事务中检查用户和设备的关系, 已经是自己的设备时删除共享记录
+		binded := false
+		status, result := runInTx(func(tx *sql.Tx) (int, interface{}) {
+			flag, exist, ok := mysql.QueryUserDeviceFlagTx(tx, userDeviceRelation.UserId, userDeviceRelation.DeviceId)
+			if !ok {
+				return common.DBError, "query device relation error"
+			}
+			if exist && flag == common.NormalDeviceFlag {
+				binded = true
+				if !userShareDevice.DeleteTx(tx) {
+					return common.DBError, "delete failed!"
 				}
+				return common.Success, nil
+			}
+			if !userShareDevice.UpdateTx(tx) {
+				return common.DBError, "update failed!"
+			}
+			if !exist && !userDeviceRelation.InsertTx(tx) {
+				return common.DBError, "insert error"
 			}
 			return common.Success, "Confirmed successfully"
+		})
+		if status == common.Success && binded {
+			return common.NoPermission, "device has binded the user, not allow shared"
 		}
-	} else {
-		// 如果用户拒绝则删除共享表中的记录
-		userShareDevice.Delete()
-		// 如果已经存在用户和设备关系记录，也一起删除
-		var userDeviceRelation = mysql.NewUserDeviceRelation()
-		userDeviceRelation.UserId = userShareDevice.ToUserId
-		userDeviceRelation.DeviceId = userShareDevice.DeviceId
-		userDeviceRelation.Flag = common.ShareDeviceFlag
-		userDeviceRelation.DeleteWithUser()
-		return common.Success, "Unconfirmed successfully"
+		return status, result
 	}
-	return common.DBError, "update failed!"
+	// 如果用户拒绝则删除共享表中的记录
+	// 如果已经存在用户和设备关系记录，也一起删除
+	var userDeviceRelation = mysql.NewUserDeviceRelation()
+	userDeviceRelation.UserId = userShareDevice.ToUserId
+	userDeviceRelation.DeviceId = userShareDevice.DeviceId
+	userDeviceRelation.Flag = common.ShareDeviceFlag
+	return runInTx(func(tx *sql.Tx) (int, interface{}) {
+		if !userShareDevice.DeleteTx(tx) || !userDeviceRelation.DeleteWithUserTx(tx) {
+			return common.DBError, "delete failed!"
+		}
+		return common.Success, "Unconfirmed successfully"
+	})
 }
 
 /******************************************************************************
@@ -580,17 +598,22 @@ func RemoveSharedDevice(c *gin.Context) (int, interface{}) {
 	if !userShareDevice.QueryByID(req.ShareId) {
 		return common.NoData, "share device not exist"
 	}
-	// 先删除用户和设备关系表
+	// 同时删除用户和设备关系表和共享记录
 	var userDeviceRelation = mysql.NewUserDeviceRelation()
 	userDeviceRelation.UserId = userShareDevice.ToUserId
 	userDeviceRelation.DeviceId = userShareDevice.DeviceId
 	userDeviceRelation.Flag = common.ShareDeviceFlag
-	userDeviceRelation.DeleteWithUser()
-	if userShareDevice.Delete() {
-		mq.PublishData(common.MakeShareDeviceRemoveNotifyTopic(userShareDevice.ToUserId), userShareDevice)
+	status, result := runInTx(func(tx *sql.Tx) (int, interface{}) {
+		if !userDeviceRelation.DeleteWithUserTx(tx) || !userShareDevice.DeleteTx(tx) ||
+			!mysql.DeleteUnboundMetricRulesTx(tx, userShareDevice.DeviceId) {
+			return common.DBError, "remove shared device failed"
+		}
 		return common.Success, "remove shared device success"
+	})
+	if status == common.Success {
+		mq.PublishData(common.MakeShareDeviceRemoveNotifyTopic(userShareDevice.ToUserId), userShareDevice)
 	}
-	return common.DBError, "remove shared device failed"
+	return status, result
 }
 
 /******************************************************************************
@@ -648,16 +671,32 @@ func RemoveUserDevice(c *gin.Context) (int, interface{}) {
 		return common.NoData, res
 	}
 	userDeviceRelation = &userDeviceList[0]
-	userDeviceRelation.DeleteWithUser()
-	// 如果是原始设备，则删除相关的所有共享设备
-	if userDeviceRelation.Flag == common.NormalDeviceFlag {
-		// 删除此User已共享给其他用户的记录
-		mysql.DeleteUserShareDeviceByUserId(userDeviceRelation.UserId, 0, userDeviceRelation.DeviceId)
-		// 删除所有和此设备相关的已过户用户的记录
-		mysql.DeleteUserTransferDeviceByUserId(0, 0, userDeviceRelation.DeviceId)
-	} else {
-		// 删除共享给UserId的记录
-		mysql.DeleteUserShareDeviceByUserId(0, userDeviceRelation.UserId, userDeviceRelation.DeviceId)
+	status, result := runInTx(func(tx *sql.Tx) (int, interface{}) {
+		if !userDeviceRelation.DeleteWithUserTx(tx) {
+			return common.DBError, "remove device relation failed"
+		}
+		// 如果是原始设备，则删除相关的所有共享设备
+		if userDeviceRelation.Flag == common.NormalDeviceFlag {
+			// 删除此User已共享给其他用户的记录
+			// 删除所有和此设备相关的已过户用户的记录
+			if !mysql.DeleteUserShareDeviceByUserIdTx(tx, userDeviceRelation.UserId, 0, userDeviceRelation.DeviceId) ||
+				!mysql.DeleteUserTransferDeviceByUserIdTx(tx, 0, 0, userDeviceRelation.DeviceId) {
+				return common.DBError, "remove shared device failed"
+			}
+		} else {
+			// 删除共享给UserId的记录
+			if !mysql.DeleteUserShareDeviceByUserIdTx(tx, 0, userDeviceRelation.UserId, userDeviceRelation.DeviceId) {
+				return common.DBError, "remove shared device failed"
+			}
+		}
+		// 删除不能再使用设备的用户定义的规则
+		if !mysql.DeleteUnboundMetricRulesTx(tx, userDeviceRelation.DeviceId) {
+			return common.DBError, "remove metric rules failed"
+		}
+		return common.Success, "remove device ok"
+	})
+	if status != common.Success {
+		return status, result
 	}
 	// 设置设备概况数据为不可见
 	var device = mysql.NewDevice()
@@ -809,43 +848,61 @@ func SaveUserTransferDevice(userDevice *mysql.UserDevice, userTransfer *mysql.Us
 		userTransfer.DeviceId,
 		-1,
 		&userTransferList)
-	if len(userTransferList) == 0 {
-		if !userTransfer.Insert() {
-			return common.DBError, "insert error"
-		}
-	} else {
-		userTransfer.ID = userTransferList[0].ID
-		if !userTransfer.Update() {
-			return common.DBError, "update error"
+	return runInTx(func(tx *sql.Tx) (int, interface{}) {
+		if len(userTransferList) == 0 {
+			if !userTransfer.InsertTx(tx) {
+				return common.DBError, "insert error"
+			}
+		} else {
+			userTransfer.ID = userTransferList[0].ID
+			if !userTransfer.UpdateTx(tx) {
+				return common.DBError, "update error"
+			}
 		}
-	}
-
-	// 如果用户已经确认了过户设备，则添加设备和用户的关系
-	if userTransfer.Confirm == common.DeviceConfirmFlag {
-		status, result := SaveConfirmedTransferDevice(userTransfer)
-		if status != common.Success {
-			return status, result
+		// 如果用户已经确认了过户设备，则添加设备和用户的关系
+		if userTransfer.Confirm == common.DeviceConfirmFlag {
+			status, result := saveConfirmedTransferDeviceTx(tx, userTransfer)
+			if status != common.Success {
+				return status, result
+			}
 		}
-	}
-	return common.Success, userDevice
+		return common.Success, userDevice
+	})
 }
 
+/******************************************************************************
+ * function: SaveConfirmedTransferDevice
+ * description: 保存已确认的过户设备, 删除原用户关系和共享记录并绑定新用户, 在一个事务中完成
+ * param {*mysql.UserTransferDevice} userTransfer
+ * return {*}
+********************************************************************************/
 func SaveConfirmedTransferDevice(userTransfer *mysql.UserTransferDevice) (int, interface{}) {
+	return runInTx(func(tx *sql.Tx) (int, interface{}) {
+		return saveConfirmedTransferDeviceTx(tx, userTransfer)
+	})
+}
+
+func saveConfirmedTransferDeviceTx(tx *sql.Tx, userTransfer *mysql.UserTransferDevice) (int, interface{}) {
 	// 添加用户和设备的关联关系
 	userDeviceRelation := mysql.NewUserDeviceRelation()
 	userDeviceRelation.UserId = userTransfer.ToUserId
 	userDeviceRelation.DeviceId = userTransfer.DeviceId
 	userDeviceRelation.Flag = common.NormalDeviceFlag // normal device is 0, transfer device flag = 0
-	// check if the relation exist
+	// 在事务中检查关系, 过户时原用户必须仍然拥有设备
+	fromFlag, fromExist, ok := mysql.QueryUserDeviceFlagTx(tx, userTransfer.FromUserId, userTransfer.DeviceId)
+	if !ok {
+		return common.DBError, "query device relation error"
+	}
+	if !fromExist || fromFlag != common.NormalDeviceFlag {
+		return common.NoPermission, "device not owned by the user, not allow transfer"
+	}
 	// 如果设备已经绑定到用户并且是主动绑定的NormalDeviceFlag，则不允许过户
 	// 如果是共享设备，还可以继续过户
-	filter := fmt.Sprintf("user_id=%d and device_id=%d and flag=%d",
-		userDeviceRelation.UserId,
-		userDeviceRelation.DeviceId,
-		common.NormalDeviceFlag)
-	var gList []mysql.UserDeviceRelation
-	mysql.QueryUserDeviceRelationByCond(filter, nil, nil, &gList)
-	if len(gList) > 0 {
+	flag, exist, ok := mysql.QueryUserDeviceFlagTx(tx, userDeviceRelation.UserId, userDeviceRelation.DeviceId)
+	if !ok {
+		return common.DBError, "query device relation error"
+	}
+	if exist && flag == common.NormalDeviceFlag {
 		return common.AlreadyBind, "device has binded to the user, not allow transfer"
 	} else {
 		// 删除原来用户的设备关系，以及原来设备分享的关系
@@ -853,13 +910,21 @@ func SaveConfirmedTransferDevice(userTransfer *mysql.UserTransferDevice) (int, i
 		orgUserDeviceRelation.UserId = userTransfer.FromUserId
 		orgUserDeviceRelation.DeviceId = userTransfer.DeviceId
 		orgUserDeviceRelation.Flag = common.NormalDeviceFlag
-		orgUserDeviceRelation.DeleteWithUser()
+		if !orgUserDeviceRelation.DeleteWithUserTx(tx) {
+			return common.DBError, "delete error"
+		}
 		// 删除原来设备的共享用户
-		mysql.DeleteUserShareDeviceByUserId(userTransfer.FromUserId, 0, userTransfer.DeviceId)
+		if !mysql.DeleteUserShareDeviceByUserIdTx(tx, userTransfer.FromUserId, 0, userTransfer.DeviceId) {
+			return common.DBError, "delete error"
+		}
 		// 保存新的用户和设备关系
-		if !userDeviceRelation.Insert() {
+		if !userDeviceRelation.InsertTx(tx) {
 			return common.DBError, "insert error"
 		}
+		// 原用户定义的规则随过户删除, 新用户需要重新定义
+		if !mysql.DeleteUnboundMetricRulesTx(tx, userTransfer.DeviceId) {
+			return common.DBError, "delete error"
+		}
 	}
 	return common.Success, userDeviceRelation
 }
@@ -899,31 +964,39 @@ func ConfirmTransferedDevice(c *gin.Context) (int, interface{}) {
 	}
 	if req.Confirm {
 		userTransferDevice.Confirm = common.DeviceConfirmFlag
-		if userTransferDevice.Update() {
-			status, result := SaveConfirmedTransferDevice(userTransferDevice)
-			if status != common.Success {
-				return status, result
+		status, result := runInTx(func(tx *sql.Tx) (int, interface{}) {
+			if !userTransferDevice.UpdateTx(tx) {
+				return common.DBError, "update failed!"
 			}
-			// 向对方from_user发送确认过户设备请求结果
-			confirmFinished.Result = 1 // 1:确认
-			mq.PublishData(common.MakeTransferConfirmedFinishedTopic(userTransferDevice.FromUserId), confirmFinished)
-			return common.Success, "Confirmed successfully"
+			return saveConfirmedTransferDeviceTx(tx, userTransferDevice)
+		})
+		if status != common.Success {
+			return status, result
 		}
-	} else {
-		// 如果用户拒绝则删除过户表中的记录
-		userTransferDevice.Delete()
-		// 如果已经存在用户和设备关系记录，也一起删除
-		var userDeviceRelation = mysql.NewUserDeviceRelation()
-		userDeviceRelation.UserId = userTransferDevice.ToUserId
-		userDeviceRelation.DeviceId = userTransferDevice.DeviceId
-		userDeviceRelation.Flag = common.NormalDeviceFlag
-		userDeviceRelation.DeleteWithUser()
 		// 向对方from_user发送确认过户设备请求结果
-		confirmFinished.Result = 0 // 0:拒绝
+		confirmFinished.Result = 1 // 1:确认
 		mq.PublishData(common.MakeTransferConfirmedFinishedTopic(userTransferDevice.FromUserId), confirmFinished)
+		return common.Success, "Confirmed successfully"
+	}
+	// 如果用户拒绝则删除过户表中的记录
+	// 如果已经存在用户和设备关系记录，也一起删除
+	var userDeviceRelation = mysql.NewUserDeviceRelation()
+	userDeviceRelation.UserId = userTransferDevice.ToUserId
+	userDeviceRelation.DeviceId = userTransferDevice.DeviceId
+	userDeviceRelation.Flag = common.NormalDeviceFlag
+	status, result := runInTx(func(tx *sql.Tx) (int, interface{}) {
+		if !userTransferDevice.DeleteTx(tx) || !userDeviceRelation.DeleteWithUserTx(tx) {
+			return common.DBError, "delete failed!"
+		}
 		return common.Success, "Unconfirmed successfully"
+	})
+	if status != common.Success {
+		return status, result
 	}
-	return common.DBError, "update failed!"
+	// 向对方from_user发送确认过户设备请求结果
+	confirmFinished.Result = 0 // 0:拒绝
+	mq.PublishData(common.MakeTransferConfirmedFinishedTopic(userTransferDevice.FromUserId), confirmFinished)
+	return status, result
 }
 
 /******************************************************************************
@@ -65,7 +65,7 @@ func QueryFallExistRecord(c *gin.Context) (int, interface{}) {
  * description: query alarm record by device mac and date
  * return {*}
 ********************************************************************************/
-func QueryAlarmRecord(c *gin.Context) (int, interface{}) {
+func QueryAlarmRecord(c *gin.Context, page *common.PageDao) (int, interface{}) {
 	mac := c.Query("mac")
 	if mac == "" {
 		return http.StatusBadRequest, "device mac required"
@@ -80,8 +80,8 @@ func QueryAlarmRecord(c *gin.Context) (int, interface{}) {
 		endDay = common.GetNowDate()
 	}
 	var gList []mysql.FallAlarm
-	filter := fmt.Sprintf("mac='%s' and date(create_time) >= date('%s') and date(create_time) <= date('%s')", mac, beginDay, endDay)
-	mysql.QueryFallAlarmByCond(filter, nil, "create_time desc", &gList)
+	filter := fmt.Sprintf("mac='%s' and create_time >= '%s' and create_time < date_add('%s', interval 1 day)", mac, beginDay, endDay)
+	mysql.QueryFallAlarmByCond(filter, page, "create_time desc", &gList)
 	return http.StatusOK, gList
 }
 
@@ -14,7 +14,7 @@ import (
 	"hjyserver/mdb/common"
 	"hjyserver/mdb/mysql"
 	"hjyserver/mq"
-	wxtools "hjyserver/wx/tools"
+	"hjyserver/notify"
 	"math"
 	"time"
 
@@ -26,7 +26,6 @@ const tag = "mdb_device_h03"
 var dayReportTimer *time.Timer = nil
 
 func H03MdbInit() {
-	mysql.H03ReportNotify = &H03ReportNotifyProc{}
 	dayReportTimer = time.NewTimer(10 * time.Minute)
 	go func() {
 		for {
@@ -103,12 +102,21 @@ func checkDayReportTimer() {
 				// 推送MQ
 				topic := mysql.MakeStudyDayReportTopic(mac)
 				mq.PublishData(topic, pushObj)
-				//向所有关联用户推送微信报告卡片
+				//向所有关联用户推送报告通知
+				eventId := common.GenerateUUID()
 				for _, userDevice := range userDevices {
-					status, _ := wxtools.SendDayReportMsgToOfficalAccount(userDevice.UserId, userDevice.NickName, mac, reportResp.AvgScore, startTime, endTime)
-					if status != common.Success {
-						wxtools.SendReportMsgToMiniProgram(userDevice.UserId, userDevice.NickName, "日报告", mac, reportResp.AvgScore, startTime, endTime)
-					}
+					notify.Notify(userDevice.UserId, &notify.Event{
+						ID:         eventId,
+						Type:       notify.EventStudyDayReport,
+						Mac:        mac,
+						DeviceType: mysql.H03Type,
+						NickName:   userDevice.NickName,
+						DeviceName: userDevice.DeviceName,
+						Title:      "日报告",
+						Score:      reportResp.AvgScore,
+						StartTime:  startTime,
+						EndTime:    endTime,
+					})
 				}
 				// 更新最新时间
 				nowTm := common.GetNowTime()
@@ -119,46 +127,6 @@ func checkDayReportTimer() {
 	}
 }
 
-/******************************************************************************
- * description: 定义回调函数，用来处理mysql包的H03的报告通知
- * return {*}
-********************************************************************************/
-type H03ReportNotifyProc struct {
-}
-
-func (me *H03ReportNotifyProc) NotifyEveryReportToOfficalAccount(userId int64, nickName string, mac string, startTime string, endTime string) (int, string) {
-	return wxtools.SendEveryReportMsgToOfficalAccount(userId, nickName, mac, startTime, endTime)
-}
-func (me *H03ReportNotifyProc) NotifyToMiniProgram(userId int64, nickName string, title string, mac string, score int, startTime string, endTime string) (int, string) {
-	return wxtools.SendReportMsgToMiniProgram(userId, nickName, title, mac, score, startTime, endTime)
-}
-
-// 用户H03 告警事件通知
-func (me *H03ReportNotifyProc) NotifyWarningEventToOfficalAccount(userId int64, nickName string, mac string, tm string, event int) (int, string) {
-	var msg string
-	switch event {
-	case 1:
-		msg = "使用人已落座"
-	case 2:
-		msg = "专注度长时间过低"
-	case 3:
-		msg = "专注度长时间过高"
-	case 4:
-		msg = "学习时长超时，建议休息"
-	case 5:
-		msg = "检测到使用者反复离开"
-	case 6:
-		msg = "长时间未正坐，请注意坐姿"
-	}
-	return func(userId int64, nickName string, mac string, tm string, event int, msg string) (int, string) {
-		if event == 1 {
-			return wxtools.SendH03DeviceOnlineMsgToOfficalAccount(userId, nickName, mac, msg, tm)
-		} else {
-			return wxtools.SendH03DeviceStatusWarningMsgToOfficalAccount(userId, nickName, mac, msg, tm)
-		}
-	}(userId, nickName, mac, tm, event, msg)
-}
-
 func AskH03SyncVersion(c *gin.Context) (int, interface{}) {
 	mac := c.Query("mac")
 	if mac == "" {
@@ -852,7 +820,7 @@ func QueryH03WeekReport(c *gin.Context) (int, interface{}) {
 	}
 	// 查询周报告
 	var reportList []mysql.H03WeekReport
-	mysql.QueryH03WeekReportByMac(mac, weekDate, &reportList)
+	mysql.QueryH03WeekReportByMac(mac, weekDate, &reportList, replicaFor(c))
 	if len(reportList) == 0 {
 		return common.NoData, "no data"
 	}
@@ -862,7 +830,7 @@ func QueryH03WeekReport(c *gin.Context) (int, interface{}) {
 	}
 	// 查询日报表
 	var dailyReportList []mysql.H03DailyReport
-	mysql.QueryH03DailyReportByWeek(weekReport.Mac, weekReport.ReportYear, weekReport.ReportWeek, &dailyReportList)
+	mysql.QueryH03DailyReportByWeek(weekReport.Mac, weekReport.ReportYear, weekReport.ReportWeek, &dailyReportList, replicaFor(c))
 	for _, dailyReport := range dailyReportList {
 		totalConcentrationNums := dailyReport.LowConcentrationNum + dailyReport.MidConcentrationNum + dailyReport.HighConcentrationNum
 		lightConcentration := (float32)(dailyReport.LowConcentrationNum) / (float32)(totalConcentrationNums)
@@ -11,9 +11,9 @@ import (
 	"fmt"
 	"hjyserver/cfg"
 	mylog "hjyserver/log"
-	"hjyserver/mdb/common"
 	"hjyserver/mdb/mysql"
 	"hjyserver/mq"
+	"hjyserver/notify"
 	"hjyserver/redis"
 	"testing"
 )
@@ -61,12 +61,18 @@ func TestSubscribeMessage(t *testing.T) {
 	startTime := "2021-08-01 00:00:00"
 	endTime := "2021-08-01 23:59:59"
 
-	notifyProc := &H03ReportNotifyProc{}
-	status, msg := notifyProc.NotifyEveryReportToOfficalAccount(userId, nickName, mac, startTime, endTime)
-	if status != common.Success {
-		status, msg = notifyProc.NotifyToMiniProgram(userId, nickName, reportType, mac, score, startTime, endTime)
-	}
-	fmt.Println("status:", status, "msg:", msg)
+	initNotify()
+	delivered := notify.Notify(userId, &notify.Event{
+		Type:       notify.EventStudyReport,
+		Mac:        mac,
+		DeviceType: mysql.H03Type,
+		NickName:   nickName,
+		Title:      reportType,
+		Score:      score,
+		StartTime:  startTime,
+		EndTime:    endTime,
+	})
+	fmt.Println("delivered:", delivered)
 }
 
 func TestCalculateBeatUsers(t *testing.T) {
@@ -76,7 +76,7 @@ import (
  * description: if not day condition then query the latest record from database
  * return {*}
 ********************************************************************************/
-func QueryHeartRate(c *gin.Context) (int, interface{}) {
+func QueryHeartRate(c *gin.Context, page *common.PageDao) (int, interface{}) {
 	mac := c.Query("mac")
 	if mac == "" {
 		return http.StatusBadRequest, "device mac required"
@@ -91,9 +91,9 @@ func QueryHeartRate(c *gin.Context) (int, interface{}) {
 	device := devices[0]
 	switch device.Type {
 	case mysql.HeatRateType:
-		return queryHeartRateTypeData(mac, beginDay, endDay)
+		return queryHeartRateTypeData(mac, beginDay, endDay, page)
 	case mysql.Ed713Type:
-		return queryEd713TypeData(mac, beginDay, endDay)
+		return queryEd713TypeData(mac, beginDay, endDay, page)
 	}
 	return http.StatusAccepted, "not support device type"
 }
@@ -144,9 +144,9 @@ func StatsHeartRateByMinute(c *gin.Context) (int, interface{}) {
 	var result interface{}
 	switch device.Type {
 	case mysql.HeatRateType:
-		status, result = queryHeartRateTypeData(mac, beginDay, endDay)
+		status, result = queryHeartRateTypeData(mac, beginDay, endDay, nil)
 	case mysql.Ed713Type:
-		status, result = queryEd713TypeData(mac, beginDay, endDay)
+		status, result = queryEd713TypeData(mac, beginDay, endDay, nil)
 	case mysql.LampType:
 		status, result = queryHl77TypeData(mac, beginDay, endDay)
 	case mysql.X1Type:
@@ -282,10 +282,10 @@ func statsHeartRateByMinute(gList []mysql.HeartRate) (int, interface{}) {
 	return http.StatusOK, stats
 }
 
-func queryHeartRateTypeData(mac string, beginDay string, endDay string) (int, interface{}) {
+func queryHeartRateTypeData(mac string, beginDay string, endDay string, page *common.PageDao) (int, interface{}) {
 	var filter string
 	var limit int
-	if beginDay == "" && endDay == "" {
+	if beginDay == "" && endDay == "" && page == nil {
 		filter = fmt.Sprintf("mac='%s' and person_num > 0 and heart_rate > 0", mac)
 		limit = 1
 	} else {
@@ -296,18 +296,18 @@ func queryHeartRateTypeData(mac string, beginDay string, endDay string) (int, in
 		if endDay == "" {
 			endDay = common.GetNowDate()
 		}
-		filter = fmt.Sprintf("mac='%s' and date(create_time) >= date('%s') and date(create_time) <= date('%s') and person_num > 0 and heart_rate > 0", mac, beginDay, endDay)
+		filter = fmt.Sprintf("mac='%s' and create_time >= '%s' and create_time < date_add('%s', interval 1 day) and person_num > 0 and heart_rate > 0", mac, beginDay, endDay)
 		limit = -1
 	}
 	var gList []mysql.HeartRate
-	mysql.QueryHeartRateByCond(filter, nil, "create_time", limit, &gList)
+	mysql.QueryHeartRateByCond(filter, page, "create_time", limit, &gList)
 	return http.StatusOK, gList
 }
 
-func queryEd713TypeData(mac string, beginDay string, endDay string) (int, interface{}) {
+func queryEd713TypeData(mac string, beginDay string, endDay string, page *common.PageDao) (int, interface{}) {
 	var filter string
 	var limit int
-	if beginDay == "" && endDay == "" {
+	if beginDay == "" && endDay == "" && page == nil {
 		filter = fmt.Sprintf("mac='%s' and heart_rate > 0", mac)
 		limit = 1
 	} else {
@@ -318,11 +318,11 @@ func queryEd713TypeData(mac string, beginDay string, endDay string) (int, interf
 		if endDay == "" {
 			endDay = common.GetNowDate()
 		}
-		filter = fmt.Sprintf("mac='%s' and date(create_time) >= date('%s') and date(create_time) <= date('%s') and heart_rate > 0", mac, beginDay, endDay)
+		filter = fmt.Sprintf("mac='%s' and create_time >= '%s' and create_time < date_add('%s', interval 1 day) and heart_rate > 0", mac, beginDay, endDay)
 		limit = -1
 	}
 	var gList []mysql.HeartRate
-	mysql.QueryEd713RealDataToHeartRateByCond(filter, nil, "create_time", limit, &gList)
+	mysql.QueryEd713RealDataToHeartRateByCond(filter, page, "create_time", limit, &gList)
 	return http.StatusOK, gList
 }
 
@@ -408,9 +408,9 @@ func QuerySleepReport(c *gin.Context) (int, interface{}) {
 	case mysql.HeatRateType:
 		return queryHeartRateTypeSleepReport(mac, beginDay, endDay)
 	case mysql.Ed713Type:
-		return queryEd713TypeSleepReport(mac, beginDay, endDay)
+		return queryEd713TypeSleepReport(mac, beginDay, endDay, replicaFor(c))
 	case mysql.X1Type:
-		return queryX1TypeSleepReport(mac, beginDay, endDay)
+		return queryX1TypeSleepReport(mac, beginDay, endDay, replicaFor(c))
 	}
 	return http.StatusAccepted, "not support device type"
 
@@ -606,9 +606,9 @@ func queryHeartRateTypeSleepReport(mac string, beginDay string, endDay string) (
  * return {*}
 ********************************************************************************/
 
-func queryEd713TypeSleepReport(mac string, beginDay string, endDay string) (int, interface{}) {
+func queryEd713TypeSleepReport(mac string, beginDay string, endDay string, opt mysql.ReadOption) (int, interface{}) {
 	var dayReport []mysql.Ed713DayReportSql
-	mysql.QueryEd713DayReportByMacAndTime(mac, beginDay, endDay, &dayReport)
+	mysql.QueryEd713DayReportByMacAndTime(mac, beginDay, endDay, &dayReport, opt)
 	if len(dayReport) == 0 {
 		return http.StatusAccepted, "not find any data in the condition"
 	}
@@ -805,9 +805,9 @@ func handleEd713OrX1Report(deviceType string, dayReport interface{}) (int, inter
 }
 
 // 暂时用的是这个函数
-func queryX1TypeSleepReport(mac string, beginDay string, endDay string) (int, interface{}) {
+func queryX1TypeSleepReport(mac string, beginDay string, endDay string, opt mysql.ReadOption) (int, interface{}) {
 	var dayReport []mysql.X1DayReportSql
-	mysql.QueryX1DayReportByMacAndTime(mac, beginDay, endDay, &dayReport)
+	mysql.QueryX1DayReportByMacAndTime(mac, beginDay, endDay, &dayReport, opt)
 	if len(dayReport) == 0 {
 		return http.StatusAccepted, "not find any data in the condition"
 	}
@@ -1231,11 +1231,11 @@ func QueryDateListInReport(c *gin.Context) (int, interface{}) {
 	ok := false
 	switch device.Type {
 	case mysql.HeatRateType:
-		ok = mysql.QueryHeartDateListInReport(mac, beginDay, endDay, &resp.Days)
+		ok = mysql.QueryHeartDateListInReport(mac, beginDay, endDay, &resp.Days, replicaFor(c))
 	case mysql.Ed713Type:
-		ok = mysql.QueryEd713DateListInReport(mac, beginDay, endDay, &resp.Days)
+		ok = mysql.QueryEd713DateListInReport(mac, beginDay, endDay, &resp.Days, replicaFor(c))
 	case mysql.X1Type:
-		ok = mysql.QueryX1DateListInReport(mac, beginDay, endDay, &resp.Days)
+		ok = mysql.QueryX1DateListInReport(mac, beginDay, endDay, &resp.Days, replicaFor(c))
 	case mysql.H03Type:
 		ok = mysql.QueryH03DateListInReport(mac, beginDay, endDay, &resp.Days)
 	}
@@ -51,7 +51,7 @@ func OpenLampRealData(c *gin.Context) (int, interface{}) {
  * param {*gin.Context} c
  * return {*}
 ********************************************************************************/
-func QueryLampRealData(c *gin.Context) (int, interface{}) {
+func QueryLampRealData(c *gin.Context, page *common.PageDao) (int, interface{}) {
 	mac := c.Query("mac")
 	if mac == "" {
 		return http.StatusBadRequest, "device mac required"
@@ -60,7 +60,7 @@ func QueryLampRealData(c *gin.Context) (int, interface{}) {
 	endDay := c.Query("end_day")
 	var filter string
 	var limit int
-	if beginDay == "" && endDay == "" {
+	if beginDay == "" && endDay == "" && page == nil {
 		filter = fmt.Sprintf("mac='%s' and respiratory > 0", mac)
 		limit = 1
 	} else {
@@ -71,11 +71,11 @@ func QueryLampRealData(c *gin.Context) (int, interface{}) {
 		if endDay == "" {
 			endDay = common.GetNowDate()
 		}
-		filter = fmt.Sprintf("mac='%s' and create_time >= '%s' and create_time <= '%s' and respiratory > 0", mac, beginDay, endDay)
+		filter = fmt.Sprintf("mac='%s' and create_time >= '%s' and create_time < date_add('%s', interval 1 day) and respiratory > 0", mac, beginDay, endDay)
 		limit = -1
 	}
 	var gList []mysql.RealDataSql
-	mysql.QueryLampRealDataByCond(filter, nil, "create_time desc", limit, &gList)
+	mysql.QueryLampRealDataByCond(filter, page, "create_time desc", limit, &gList)
 	return http.StatusOK, gList
 }
 
@@ -109,7 +109,7 @@ func QueryLampReportStatus(c *gin.Context) (int, interface{}) {
  * description:
  * return {*}
 ********************************************************************************/
-func QueryLampEvent(c *gin.Context) (int, interface{}) {
+func QueryLampEvent(c *gin.Context, page *common.PageDao) (int, interface{}) {
 	mac := c.Query("mac")
 	if mac == "" {
 		return http.StatusBadRequest, "device mac required"
@@ -118,7 +118,7 @@ func QueryLampEvent(c *gin.Context) (int, interface{}) {
 	endDay := c.Query("end_day")
 	var filter string
 	var limit int
-	if beginDay == "" && endDay == "" {
+	if beginDay == "" && endDay == "" && page == nil {
 		filter = fmt.Sprintf("mac='%s'", mac)
 		limit = 1
 	} else {
@@ -129,11 +129,11 @@ func QueryLampEvent(c *gin.Context) (int, interface{}) {
 		if endDay == "" {
 			endDay = common.GetNowDate()
 		}
-		filter = fmt.Sprintf("mac='%s' and date(create_time) >= date('%s') and date(create_time) <= date('%s')", mac, beginDay, endDay)
+		filter = fmt.Sprintf("mac='%s' and create_time >= '%s' and create_time < date_add('%s', interval 1 day)", mac, beginDay, endDay)
 		limit = -1
 	}
 	var gList []mysql.EventReportSql
-	mysql.QueryLampEventByCond(filter, nil, "create_time desc", limit, &gList)
+	mysql.QueryLampEventByCond(filter, page, "create_time desc", limit, &gList)
 	return http.StatusOK, gList
 }
 
@@ -308,11 +308,12 @@ func ReleaseStudyRoom(c *gin.Context) (int, interface{}) {
 ********************************************************************************/
 func QueryStudyRoom(c *gin.Context) (int, interface{}) {
 	userId := c.Query("user_id")
-	if userId == "" {
-		userId = "0"
+	idInt, _ := strconv.ParseInt(userId, 10, 64)
+	// 用户id为0时会查到所有的自习室
+	if idInt <= 0 {
+		return common.ParamError, "user id required"
 	}
 	var objs []mysql.StudyRoom
-	idInt, _ := strconv.ParseInt(userId, 10, 64)
 	if !mysql.QueryStudyRoomByUser(idInt, &objs) {
 		return common.RecordNotFound, "not found any record"
 	}
@@ -347,7 +348,7 @@ func QueryRankingByStudyRoom(c *gin.Context) (int, interface{}) {
 	}
 	var gList []mysql.StudyRoomRanking
 	idInt, _ := strconv.ParseInt(roomId, 10, 64)
-	mysql.QueryRankingByStudyRoom(idInt, &gList)
+	mysql.QueryRankingByStudyRoom(idInt, &gList, replicaFor(c))
 	return http.StatusOK, gList
 }
 
@@ -367,7 +368,7 @@ func StatsLampFlowData(c *gin.Context) (int, interface{}) {
 	if startTime == "" || endTime == "" {
 		return http.StatusBadRequest, "start time and end time required"
 	}
-	flowData := mysql.StatsLampFlowDataByTime(mac, startTime, endTime)
+	flowData := mysql.StatsLampFlowDataByTime(mac, startTime, endTime, replicaFor(c))
 	type FlowData struct {
 		Flow int `json:"flow"`
 	}
@@ -14,7 +14,7 @@ import (
 	"hjyserver/mdb/common"
 	"hjyserver/mdb/mysql"
 	"hjyserver/mq"
-	wxtools "hjyserver/wx/tools"
+	"hjyserver/notify"
 	"strconv"
 	"time"
 
@@ -26,7 +26,6 @@ const t1Tag = "mdb_device_t1"
 var t1DayReportTimer *time.Timer = nil
 
 func T1MdbInit() {
-	mysql.T1ReportNotify = &T1ReportNotifyProc{}
 	t1DayReportTimer = time.NewTimer(10 * time.Minute)
 	go func() {
 		for {
@@ -103,12 +102,21 @@ func checkT1DayReportTimer() {
 				// 推送MQ
 				topic := mysql.MakeT1ServerDayReportTopic(mac)
 				mq.PublishData(topic, pushObj)
-				//向所有关联用户推送微信报告卡片
+				//向所有关联用户推送报告通知
+				eventId := common.GenerateUUID()
 				for _, userDevice := range userDevices {
-					status, _ := wxtools.SendDayReportMsgToOfficalAccount(userDevice.UserId, userDevice.NickName, mac, reportResp.AvgScore, startTime, endTime)
-					if status != common.Success {
-						wxtools.SendReportMsgToMiniProgram(userDevice.UserId, userDevice.NickName, "日报告", mac, reportResp.AvgScore, startTime, endTime)
-					}
+					notify.Notify(userDevice.UserId, &notify.Event{
+						ID:         eventId,
+						Type:       notify.EventStudyDayReport,
+						Mac:        mac,
+						DeviceType: mysql.T1Type,
+						NickName:   userDevice.NickName,
+						DeviceName: userDevice.DeviceName,
+						Title:      "日报告",
+						Score:      reportResp.AvgScore,
+						StartTime:  startTime,
+						EndTime:    endTime,
+					})
 				}
 				// 更新最新时间
 				nowTm := common.GetNowTime()
@@ -119,46 +127,6 @@ func checkT1DayReportTimer() {
 	}
 }
 
-/******************************************************************************
- * description: 定义回调函数，用来处理mysql包的T1的报告通知
- * return {*}
-********************************************************************************/
-type T1ReportNotifyProc struct {
-}
-
-func (me *T1ReportNotifyProc) NotifyEveryReportToOfficalAccount(userId int64, nickName string, mac string, startTime string, endTime string) (int, string) {
-	return wxtools.SendEveryReportMsgToOfficalAccount(userId, nickName, mac, startTime, endTime)
-}
-func (me *T1ReportNotifyProc) NotifyToMiniProgram(userId int64, nickName string, title string, mac string, score int, startTime string, endTime string) (int, string) {
-	return wxtools.SendReportMsgToMiniProgram(userId, nickName, title, mac, score, startTime, endTime)
-}
-
-// 用户T1 告警事件通知
-func (me *T1ReportNotifyProc) NotifyWarningEventToOfficalAccount(userId int64, nickName string, mac string, tm string, event int) (int, string) {
-	var msg string
-	switch event {
-	case 1:
-		msg = "使用人已落座"
-	case 2:
-		msg = "专注度长时间过低"
-	case 3:
-		msg = "专注度长时间过高"
-	case 4:
-		msg = "学习时长超时，建议休息"
-	case 5:
-		msg = "检测到使用者反复离开"
-	case 6:
-		msg = "长时间未正坐，请注意坐姿"
-	}
-	return func(userId int64, nickName string, mac string, tm string, event int, msg string) (int, string) {
-		if event == 1 {
-			return wxtools.SendT1DeviceOnlineMsgToOfficalAccount(userId, nickName, mac, msg, tm)
-		} else {
-			return wxtools.SendT1DeviceStatusWarningMsgToOfficalAccount(userId, nickName, mac, msg, tm)
-		}
-	}(userId, nickName, mac, tm, event, msg)
-}
-
 func AskT1SyncVersion(c *gin.Context) (int, interface{}) {
 	mac := c.Query("mac")
 	if mac == "" {
@@ -774,7 +742,7 @@ func QueryT1WeekReport(c *gin.Context) (int, interface{}) {
 	}
 	// 查询周报告
 	var reportList []mysql.T1WeekReport
-	mysql.QueryT1WeekReportByMac(mac, weekDate, &reportList)
+	mysql.QueryT1WeekReportByMac(mac, weekDate, &reportList, replicaFor(c))
 	if len(reportList) == 0 {
 		return common.NoData, "no data"
 	}
@@ -784,7 +752,7 @@ func QueryT1WeekReport(c *gin.Context) (int, interface{}) {
 	}
 	// 查询日报表
 	var dailyReportList []mysql.T1DailyReport
-	mysql.QueryT1DailyReportByWeek(weekReport.Mac, weekReport.ReportYear, weekReport.ReportWeek, &dailyReportList)
+	mysql.QueryT1DailyReportByWeek(weekReport.Mac, weekReport.ReportYear, weekReport.ReportWeek, &dailyReportList, replicaFor(c))
 	for _, dailyReport := range dailyReportList {
 		totalConcentrationNums := dailyReport.LowConcentrationNum + dailyReport.MidConcentrationNum + dailyReport.HighConcentrationNum
 		lightConcentration := (float32)(dailyReport.LowConcentrationNum) / (float32)(totalConcentrationNums)
@@ -0,0 +1,236 @@
+package mdb
+
+import (
+	"fmt"
+	"strings"
+
+	"hjyserver/email"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/redis"
+
+	"github.com/gin-gonic/gin"
+)
+
+// define email code purpose
+const (
+	// 注册前验证邮箱
+	EmailCodeRegister = "register"
+	// 修改邮箱, 发送到新邮箱
+	EmailCodeModifyEmail = "modify_email"
+	// 验证已保存但未验证的邮箱
+	EmailCodeVerify   = "verify_email"
+	EmailCodeResetPwd = "reset_passwd"
+	// 验证紧急联系人的邮箱, 只能通过联系人接口发送
+	EmailCodeContact = "contact"
+	// 删除用户数据, 只发送到已验证的邮箱
+	EmailCodeEraseData = "erase_data"
+)
+
+// swagger:model EmailCodeReq
+type EmailCodeReq struct {
+	// required: true
+	Email string `json:"email"`
+	// required: true
+	// register/modify_email/verify_email/reset_passwd/erase_data
+	Purpose string `json:"purpose"`
+}
+
+// normalizeEmail 去掉空格并转为小写
+func normalizeEmail(addr string) (string, bool) {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	return addr, email.ValidAddress(addr)
+}
+
+// queryUserByEmail 按邮箱查询用户, 返回找到的用户数. 建立唯一索引前已经重复的邮箱不能确定属于哪个用户,
+// 多于一个时不返回用户
+func queryUserByEmail(addr string) (*mysql.User, int) {
+	var users []mysql.User
+	mysql.QueryUserByCond(fmt.Sprintf("email = '%s'", common.EscapeSql(addr)), nil, nil, &users)
+	if len(users) != 1 {
+		return nil, len(users)
+	}
+	return &users[0], 1
+}
+
+/******************************************************************************
+ * function: SendEmailCode
+ * description: 发送邮箱验证码, 验证邮箱和重置密码要求邮箱已注册, 注册和修改邮箱要求未注册
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func SendEmailCode(c *gin.Context) (int, interface{}) {
+	req := &EmailCodeReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	addr, ok := normalizeEmail(req.Email)
+	if !ok {
+		return common.ParamError, "email is invalid"
+	}
+	user, count := queryUserByEmail(addr)
+	switch req.Purpose {
+	case EmailCodeVerify, EmailCodeResetPwd:
+		if count == 0 {
+			return common.NoExist, "email is not registered"
+		}
+		if count > 1 {
+			return common.RepeatData, "email is used by several accounts"
+		}
+	case EmailCodeEraseData:
+		if count != 1 || user.EmailVerified == 0 {
+			return common.NoExist, "email is not verified"
+		}
+	case EmailCodeRegister, EmailCodeModifyEmail:
+		if count > 0 {
+			return common.EmailHasReg, "email has registered"
+		}
+		user = nil
+	default:
+		return common.ParamError, "purpose error"
+	}
+	return sendEmailCode(c.ClientIP(), user, addr, req.Purpose)
+}
+
+// emailCodeData 验证码邮件模板的数据
+type emailCodeData struct {
+	NickName string
+	Code     string
+	Minutes  int
+	Purpose  string
+}
+
+/******************************************************************************
+ * function: sendEmailCode
+ * description: 检查发送频率, 生成验证码保存哈希后发送, 邮件使用用户的语言
+ * param {string} ip 请求的IP, 为空时不限制IP
+ * param {*mysql.User} user 邮箱所属的用户, 注册和修改邮箱时为nil
+ * param {string} addr
+ * param {string} purpose
+ * return {*}
+********************************************************************************/
+func sendEmailCode(ip string, user *mysql.User, addr string, purpose string) (int, interface{}) {
+	if status, msg := emailCodeChannel.limit(addr, ip); status != common.Success {
+		return status, msg
+	}
+	code, status, msg := emailCodeChannel.issue(addr, purpose)
+	if status != common.Success {
+		return status, msg
+	}
+	data := &emailCodeData{
+		Code:    code,
+		Minutes: emailCodeChannel.ttl / 60,
+		Purpose: purpose,
+	}
+	locale := ""
+	if user != nil {
+		data.NickName = user.NickName
+		locale = user.Locale
+	}
+	subject, body, err := email.Render(locale, []string{"verify_code"}, data)
+	if err != nil {
+		mylog.Log.Errorln("render email code error:", err)
+		return common.CodeError, "make email code failed"
+	}
+	if err := email.Send(addr, subject, body); err != nil {
+		mylog.Log.Errorln("send email code to", addr, "error:", err)
+		return common.ParamError, "send email code failed"
+	}
+	return common.Success, "send email code success"
+}
+
+// swagger:model VerifyEmailReq
+type VerifyEmailReq struct {
+	// required: true
+	UserId int64 `json:"user_id"`
+	// required: true
+	// 发送到用户当前邮箱的验证码, purpose为verify_email
+	Code string `json:"code"`
+}
+
+/******************************************************************************
+ * function: VerifyEmail
+ * description: 验证用户当前的邮箱, 验证后才会向该邮箱发送通知
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func VerifyEmail(c *gin.Context) (int, interface{}) {
+	req := &VerifyEmailReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.UserId == 0 {
+		return common.ParamError, "user id required"
+	}
+	user := mysql.NewUser()
+	if !user.QueryByID(req.UserId) {
+		return common.NoExist, "user not exist"
+	}
+	if user.Email == "" {
+		return common.ParamError, "user has no email"
+	}
+	if status, msg := emailCodeChannel.check(strings.ToLower(user.Email), EmailCodeVerify, req.Code); status != common.Success {
+		return status, msg
+	}
+	user.EmailVerified = 1
+	if !user.Update() {
+		return common.DBError, "verify email failed"
+	}
+	return common.Success, user
+}
+
+// swagger:model ResetPasswdByEmailReq
+type ResetPasswdByEmailReq struct {
+	// required: true
+	Email string `json:"email"`
+	// required: true
+	Code string `json:"code"`
+	// required: true
+	Password string `json:"password"`
+}
+
+/******************************************************************************
+ * function: ResetPasswdByEmail
+ * description: 邮箱验证码重置密码, 同时撤销用户所有的登录会话并解除锁定,
+ * 能收到验证码说明邮箱属于该用户, 同时把邮箱标记为已验证
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func ResetPasswdByEmail(c *gin.Context) (int, interface{}) {
+	req := &ResetPasswdByEmailReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.Password == "" {
+		return common.ParamError, "password required"
+	}
+	addr, ok := normalizeEmail(req.Email)
+	if !ok {
+		return common.ParamError, "email is invalid"
+	}
+	if status, msg := emailCodeChannel.check(addr, EmailCodeResetPwd, req.Code); status != common.Success {
+		return status, msg
+	}
+	user, count := queryUserByEmail(addr)
+	if count == 0 {
+		return common.NoExist, "email is not registered"
+	}
+	if count > 1 {
+		return common.RepeatData, "email is used by several accounts"
+	}
+	hash, err := common.HashPassword(req.Password)
+	if err != nil {
+		return common.ParamError, "password format error"
+	}
+	user.Password = hash
+	user.EmailVerified = 1
+	if !user.Update() {
+		return common.DBError, "reset password failed"
+	}
+	mysql.RevokeUserSession(user.ID, "")
+	redis.SetValueEx(fmt.Sprintf("%s_%d", common.UserTbl, user.ID), "", 1)
+	resetLoginFailures(user.Account)
+	mysql.InsertSecurityEvent(user.ID, user.Account, mysql.SecurityPasswordReset, c.ClientIP(), "")
+	return common.Success, "reset password success"
+}
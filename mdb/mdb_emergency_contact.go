@@ -0,0 +1,364 @@
+package mdb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/notify"
+	wxtools "hjyserver/wx/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每个用户最多的紧急联系人数
+const maxEmergencyContacts = 10
+
+// 关注的报警, 来源.类型或来源, 逗号分隔
+var contactAlarmsRegexp = regexp.MustCompile(`^[a-z]+(\.\d+)?(,[a-z]+(\.\d+)?)*$`)
+
+// swagger:model ContactReq
+type ContactReq struct {
+	// required: true
+	// 联系人id
+	Id int64 `json:"id"`
+	// 短信或邮箱验证码, 验证手机号和邮箱时需要
+	Code string `json:"code"`
+}
+
+// contactVerifyPurpose 验证码按联系人区分, 不同用户添加同一号码时互不影响
+func contactVerifyPurpose(contactId int64) string {
+	return fmt.Sprintf("%s_%d", SmsCodeContact, contactId)
+}
+
+// contactEmailPurpose 邮箱验证码按联系人区分
+func contactEmailPurpose(contactId int64) string {
+	return fmt.Sprintf("%s_%d", EmailCodeContact, contactId)
+}
+
+/******************************************************************************
+ * function: bindContactWx
+ * description: 联系人的手机号验证后, 通过该手机号注册的账号绑定的微信取得关注公众号的openId,
+ * 手机号没有验证、没有注册或者没有关注公众号时清空
+ * param {*mysql.EmergencyContact} contact
+ * return {*}
+********************************************************************************/
+func bindContactWx(contact *mysql.EmergencyContact) {
+	contact.OpenId = ""
+	if contact.Phone == "" || contact.PhoneVerified != 1 {
+		return
+	}
+	user, ok := queryUserByPhone(contact.Phone)
+	if !ok {
+		return
+	}
+	if openId, ok := wxtools.QueryOfficalAccountOpenId(user.ID); ok {
+		contact.OpenId = openId
+	}
+}
+
+/******************************************************************************
+ * function: checkEmergencyContact
+ * description: 检查联系人的内容, 整理通道和报警列表, 使用的通道必须有对应的地址
+ * param {*mysql.EmergencyContact} contact
+ * return {*}
+********************************************************************************/
+func checkEmergencyContact(contact *mysql.EmergencyContact) (int, string) {
+	contact.Name = strings.TrimSpace(contact.Name)
+	contact.Relation = strings.TrimSpace(contact.Relation)
+	if len([]rune(contact.Name)) > 64 || len([]rune(contact.Relation)) > 32 {
+		return common.ParamError, "name or relation too long"
+	}
+	if contact.Phone != "" {
+		phone, ok := normalizePhone(contact.Phone)
+		if !ok {
+			return common.PhoneError, "phone is invalid"
+		}
+		contact.Phone = phone
+	}
+	if contact.Email != "" {
+		addr, ok := normalizeEmail(contact.Email)
+		if !ok || len(addr) > 128 {
+			return common.ParamError, "email is invalid"
+		}
+		contact.Email = addr
+	}
+	channels := make([]string, 0)
+	for _, v := range strings.Split(contact.Channels, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if _, ok := contactSenders[v]; !ok {
+			return common.ParamError, "channel not supported: " + v
+		}
+		// 公众号通过手机号注册的账号绑定的微信发送
+		if ((v == notify.ChannelSms || v == notify.ChannelWxOfficial) && contact.Phone == "") ||
+			(v == notify.ChannelEmail && contact.Email == "") {
+			return common.ParamError, "channel address required: " + v
+		}
+		channels = append(channels, v)
+	}
+	if len(channels) == 0 {
+		return common.ParamError, "channels required"
+	}
+	contact.Channels = strings.Join(channels, ",")
+	contact.Alarms = strings.ReplaceAll(contact.Alarms, " ", "")
+	if contact.Alarms != "" && (len(contact.Alarms) > 255 || !contactAlarmsRegexp.MatchString(contact.Alarms)) {
+		return common.ParamError, "alarms format error"
+	}
+	for _, v := range []string{contact.ActiveStart, contact.ActiveEnd} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse(mysql.ContactHourFmt, v); err != nil {
+			return common.ParamError, "active time format error"
+		}
+	}
+	if contact.IsPrimary != 0 {
+		contact.IsPrimary = 1
+	}
+	return common.Success, ""
+}
+
+/******************************************************************************
+ * function: QueryEmergencyContacts
+ * description: 查询用户的紧急联系人, 主联系人在前
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryEmergencyContacts(c *gin.Context) (int, interface{}) {
+	userId, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userId == 0 {
+		return common.ParamError, "user id required"
+	}
+	var contacts []mysql.EmergencyContact
+	mysql.QueryUserContacts(userId, &contacts)
+	if len(contacts) == 0 {
+		return common.NoData, "no emergency contact"
+	}
+	return common.Success, contacts
+}
+
+/******************************************************************************
+ * function: AddEmergencyContact
+ * description: 添加紧急联系人, 手机号和邮箱需要验证后才发送, 第一个联系人自动成为主联系人
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AddEmergencyContact(c *gin.Context) (int, interface{}) {
+	contact := mysql.NewEmergencyContact()
+	if err := c.ShouldBindJSON(contact); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if contact.UserId == 0 {
+		return common.ParamError, "user id required"
+	}
+	if status, msg := checkEmergencyContact(contact); status != common.Success {
+		return status, msg
+	}
+	var contacts []mysql.EmergencyContact
+	mysql.QueryUserContacts(contact.UserId, &contacts)
+	if len(contacts) >= maxEmergencyContacts {
+		return common.ParamError, "too many emergency contacts"
+	}
+	if len(contacts) == 0 {
+		contact.IsPrimary = 1
+	}
+	contact.ID = 0
+	contact.PhoneVerified = 0
+	contact.EmailVerified = 0
+	contact.OpenId = ""
+	contact.CreateTime = common.GetNowTime()
+	contact.UpdateTime = contact.CreateTime
+	if !contact.Insert() {
+		return common.DBError, "add emergency contact failed"
+	}
+	if contact.IsPrimary == 1 {
+		mysql.ClearPrimaryContact(contact.UserId, contact.ID)
+	}
+	return common.Success, contact
+}
+
+/******************************************************************************
+ * function: UpdateEmergencyContact
+ * description: 修改紧急联系人, 修改手机号或邮箱后需要重新验证. 不能直接取消主联系人,
+ * 需要把其他联系人设为主联系人, 保证报警升级时有主联系人
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func UpdateEmergencyContact(c *gin.Context) (int, interface{}) {
+	req := mysql.NewEmergencyContact()
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	contact := mysql.NewEmergencyContact()
+	if req.ID == 0 || !contact.QueryByID(req.ID) {
+		return common.NoExist, "emergency contact not exist"
+	}
+	if status, msg := checkEmergencyContact(req); status != common.Success {
+		return status, msg
+	}
+	if contact.IsPrimary == 1 && req.IsPrimary == 0 {
+		return common.ParamError, "set another contact as primary instead"
+	}
+	if req.Phone != contact.Phone {
+		contact.PhoneVerified = 0
+	}
+	if req.Email != contact.Email {
+		contact.EmailVerified = 0
+	}
+	contact.Name = req.Name
+	contact.Relation = req.Relation
+	contact.Phone = req.Phone
+	bindContactWx(contact)
+	contact.Email = req.Email
+	contact.Channels = req.Channels
+	contact.Alarms = req.Alarms
+	contact.ActiveStart = req.ActiveStart
+	contact.ActiveEnd = req.ActiveEnd
+	contact.IsPrimary = req.IsPrimary
+	contact.UpdateTime = common.GetNowTime()
+	if !contact.Update() {
+		return common.DBError, "update emergency contact failed"
+	}
+	if contact.IsPrimary == 1 {
+		mysql.ClearPrimaryContact(contact.UserId, contact.ID)
+	}
+	return common.Success, contact
+}
+
+/******************************************************************************
+ * function: DeleteEmergencyContact
+ * description: 删除紧急联系人, 删除主联系人时把下一个已验证的联系人设为主联系人
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func DeleteEmergencyContact(c *gin.Context) (int, interface{}) {
+	req := &ContactReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	contact := mysql.NewEmergencyContact()
+	if req.Id == 0 || !contact.QueryByID(req.Id) {
+		return common.NoExist, "emergency contact not exist"
+	}
+	if !contact.Delete() {
+		return common.DBError, "delete emergency contact failed"
+	}
+	if contact.IsPrimary == 1 {
+		mysql.PromotePrimaryContact(contact.UserId)
+	}
+	return common.Success, "delete emergency contact success"
+}
+
+/******************************************************************************
+ * function: SendContactVerifyCode
+ * description: 发送验证码到联系人的手机, 发送频率限制与登录验证码相同
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func SendContactVerifyCode(c *gin.Context) (int, interface{}) {
+	req := &ContactReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	contact := mysql.NewEmergencyContact()
+	if req.Id == 0 || !contact.QueryByID(req.Id) {
+		return common.NoExist, "emergency contact not exist"
+	}
+	if contact.Phone == "" {
+		return common.PhoneError, "contact has no phone"
+	}
+	if contact.PhoneVerified == 1 {
+		return common.Success, "phone has verified"
+	}
+	return sendSmsCode(c, contact.Phone, contactVerifyPurpose(contact.ID), true)
+}
+
+/******************************************************************************
+ * function: VerifyContactPhone
+ * description: 校验联系人手机收到的验证码, 成功后可以发送短信, 并绑定手机号注册账号的微信
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func VerifyContactPhone(c *gin.Context) (int, interface{}) {
+	req := &ContactReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	contact := mysql.NewEmergencyContact()
+	if req.Id == 0 || !contact.QueryByID(req.Id) {
+		return common.NoExist, "emergency contact not exist"
+	}
+	if contact.Phone == "" {
+		return common.PhoneError, "contact has no phone"
+	}
+	if status, msg := smsCodeChannel.check(contact.Phone, contactVerifyPurpose(contact.ID), req.Code); status != common.Success {
+		return status, msg
+	}
+	contact.PhoneVerified = 1
+	bindContactWx(contact)
+	contact.UpdateTime = common.GetNowTime()
+	if !contact.Update() {
+		return common.DBError, "verify contact phone failed"
+	}
+	return common.Success, contact
+}
+
+/******************************************************************************
+ * function: SendContactEmailCode
+ * description: 发送验证码到联系人的邮箱, 发送频率限制与用户邮箱验证码相同
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func SendContactEmailCode(c *gin.Context) (int, interface{}) {
+	req := &ContactReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	contact := mysql.NewEmergencyContact()
+	if req.Id == 0 || !contact.QueryByID(req.Id) {
+		return common.NoExist, "emergency contact not exist"
+	}
+	if contact.Email == "" {
+		return common.ParamError, "contact has no email"
+	}
+	if contact.EmailVerified == 1 {
+		return common.Success, "email has verified"
+	}
+	return sendEmailCode(c.ClientIP(), nil, contact.Email, contactEmailPurpose(contact.ID))
+}
+
+/******************************************************************************
+ * function: VerifyContactEmail
+ * description: 校验联系人邮箱收到的验证码, 成功后可以发送邮件
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func VerifyContactEmail(c *gin.Context) (int, interface{}) {
+	req := &ContactReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	contact := mysql.NewEmergencyContact()
+	if req.Id == 0 || !contact.QueryByID(req.Id) {
+		return common.NoExist, "emergency contact not exist"
+	}
+	if contact.Email == "" {
+		return common.ParamError, "contact has no email"
+	}
+	if status, msg := emailCodeChannel.check(contact.Email, contactEmailPurpose(contact.ID), req.Code); status != common.Success {
+		return status, msg
+	}
+	contact.EmailVerified = 1
+	contact.UpdateTime = common.GetNowTime()
+	if !contact.Update() {
+		return common.DBError, "verify contact email failed"
+	}
+	return common.Success, contact
+}
@@ -0,0 +1,193 @@
+package mdb
+
+import (
+	"fmt"
+	"time"
+
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/notify"
+	"hjyserver/redis"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 统计登录失败次数的时间窗口
+	loginFailWindow = 900
+	// 账号连续失败超过此次数后每次失败都要等待, 等待时间逐次加倍
+	loginDelayAfter = 2
+	// 最长等待时间
+	loginMaxDelay = 60
+	// 账号连续失败此次数后锁定
+	loginLockThreshold = 5
+	// 账号锁定时间
+	loginLockSeconds = 1800
+	// 同一IP在时间窗口内失败此次数后封禁
+	loginIpBlockThreshold = 30
+	// IP封禁时间
+	loginIpBlockSeconds = 900
+)
+
+func loginFailKey(account string) string {
+	return "login_fail_" + account
+}
+
+func loginDelayKey(account string) string {
+	return "login_delay_" + account
+}
+
+func loginLockKey(account string) string {
+	return "login_lock_" + account
+}
+
+func loginIpFailKey(ip string) string {
+	return "login_ip_fail_" + ip
+}
+
+func loginIpBlockKey(ip string) string {
+	return "login_ip_block_" + ip
+}
+
+// loginDelay 第n次失败后需要等待的秒数
+func loginDelay(n int64) int {
+	if n <= loginDelayAfter {
+		return 0
+	}
+	shift := n - loginDelayAfter - 1
+	if shift >= 6 {
+		return loginMaxDelay
+	}
+	delay := 1 << shift
+	if delay > loginMaxDelay {
+		delay = loginMaxDelay
+	}
+	return delay
+}
+
+// retryAfter key剩余的秒数, 至少1秒
+func retryAfter(key string) int {
+	ttl, err := redis.TtlValue(key)
+	if err != nil || ttl < time.Second {
+		return 1
+	}
+	return int(ttl / time.Second)
+}
+
+/******************************************************************************
+ * function: checkLoginAllowed
+ * description: 检查IP是否被封禁, 账号是否被锁定或者还在等待间隔内
+ * param {*gin.Context} c
+ * param {string} account
+ * return {*}
+********************************************************************************/
+func checkLoginAllowed(c *gin.Context, account string) (int, string) {
+	if v, _ := redis.GetValue(loginIpBlockKey(c.ClientIP())); v != "" {
+		return common.TooFrequent, fmt.Sprintf("too many failed logins, retry after %d seconds",
+			retryAfter(loginIpBlockKey(c.ClientIP())))
+	}
+	if v, _ := redis.GetValue(loginLockKey(account)); v != "" {
+		return common.AccountLocked, fmt.Sprintf("account is locked, retry after %d seconds or unlock with sms code",
+			retryAfter(loginLockKey(account)))
+	}
+	if v, _ := redis.GetValue(loginDelayKey(account)); v != "" {
+		return common.TooFrequent, fmt.Sprintf("retry after %d seconds", retryAfter(loginDelayKey(account)))
+	}
+	return common.Success, ""
+}
+
+/******************************************************************************
+ * function: loginFailed
+ * description: 记录一次登录失败, 达到限制时锁定账号或者封禁IP
+ * param {*gin.Context} c
+ * param {string} account
+ * param {*mysql.User} user 账号不存在时为nil
+ * return {*}
+********************************************************************************/
+func loginFailed(c *gin.Context, account string, user *mysql.User) {
+	ip := c.ClientIP()
+	var userId int64
+	if user != nil {
+		userId = user.ID
+	}
+	mysql.InsertSecurityEvent(userId, account, mysql.SecurityLoginFail, ip, "")
+	if n, err := redis.IncrValueEx(loginIpFailKey(ip), loginFailWindow); err == nil && n >= loginIpBlockThreshold {
+		redis.SetValueEx(loginIpBlockKey(ip), "1", loginIpBlockSeconds)
+		redis.DelValue(loginIpFailKey(ip))
+		mysql.InsertSecurityEvent(0, account, mysql.SecurityIpBlocked, ip, fmt.Sprintf("%d failed logins", n))
+		mylog.Log.Warnln("block login from ip", ip)
+	}
+	n, err := redis.IncrValueEx(loginFailKey(account), loginFailWindow)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return
+	}
+	if n >= loginLockThreshold {
+		redis.SetValueEx(loginLockKey(account), "1", loginLockSeconds)
+		redis.DelValue(loginFailKey(account))
+		redis.DelValue(loginDelayKey(account))
+		mysql.InsertSecurityEvent(userId, account, mysql.SecurityAccountLocked, ip, fmt.Sprintf("%d failed logins", n))
+		mylog.Log.Warnln("lock account", account)
+		if user != nil {
+			go notifyAccountLocked(*user)
+		}
+		return
+	}
+	if delay := loginDelay(n); delay > 0 {
+		redis.SetValueEx(loginDelayKey(account), "1", delay)
+	}
+}
+
+// resetLoginFailures 登录成功或者解锁后清除失败记录
+func resetLoginFailures(account string) {
+	redis.DelValue(loginFailKey(account))
+	redis.DelValue(loginDelayKey(account))
+	redis.DelValue(loginLockKey(account))
+}
+
+// notifyAccountLocked 通知用户账号被锁定, 内容使用用户语言的account_locked模板
+func notifyAccountLocked(user mysql.User) {
+	notify.Notify(user.ID, &notify.Event{
+		Type:     notify.EventAccountLocked,
+		NickName: user.NickName,
+		Title:    user.Account,
+		Value:    loginLockSeconds / 60,
+	})
+}
+
+// swagger:model UnlockAccountReq
+type UnlockAccountReq struct {
+	// required: true
+	Phone string `json:"phone"`
+	// required: true
+	// purpose为unlock的验证码
+	Code string `json:"code"`
+}
+
+/******************************************************************************
+ * function: UnlockAccount
+ * description: 用短信验证码解锁被锁定的账号
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func UnlockAccount(c *gin.Context) (int, interface{}) {
+	req := &UnlockAccountReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	phone, ok := normalizePhone(req.Phone)
+	if !ok {
+		return common.PhoneError, "phone is invalid"
+	}
+	if status, msg := smsCodeChannel.check(phone, SmsCodeUnlock, req.Code); status != common.Success {
+		return status, msg
+	}
+	user, ok := queryUserByPhone(phone)
+	if !ok {
+		return common.NoExist, "phone is not registered"
+	}
+	resetLoginFailures(user.Account)
+	mysql.InsertSecurityEvent(user.ID, user.Account, mysql.SecurityAccountUnlocked, c.ClientIP(), "")
+	return common.Success, "unlock account success"
+}
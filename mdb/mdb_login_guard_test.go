@@ -0,0 +1,12 @@
+package mdb
+
+import "testing"
+
+func TestLoginDelay(t *testing.T) {
+	cases := map[int64]int{1: 0, 2: 0, 3: 1, 4: 2, 5: 4, 8: 32, 9: 60, 100: 60}
+	for n, want := range cases {
+		if got := loginDelay(n); got != want {
+			t.Errorf("loginDelay(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
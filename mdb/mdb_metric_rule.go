@@ -0,0 +1,280 @@
+package mdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 每个用户每台设备最多的规则数
+	maxMetricRules = 20
+	// 持续时间和重复触发间隔的上限, 单位分钟
+	maxRuleMinutes = 1440
+)
+
+// swagger:model MetricRuleReq
+type MetricRuleReq struct {
+	// required: true
+	// 规则id
+	Id int64 `json:"id"`
+}
+
+// swagger:model RuleMetricsResp
+type RuleMetricsResp struct {
+	Mac  string `json:"mac"`
+	Type string `json:"type"`
+	// 设备支持的指标
+	Metrics []string `json:"metrics"`
+}
+
+// queryRuleDevice 查询规则的设备
+func queryRuleDevice(mac string) (*mysql.Device, bool) {
+	if mac == "" {
+		return nil, false
+	}
+	var devices []mysql.Device
+	mysql.QueryDeviceByCond(fmt.Sprintf("mac='%s'", common.EscapeSql(mac)), nil, nil, &devices)
+	if len(devices) == 0 {
+		return nil, false
+	}
+	return &devices[0], true
+}
+
+/******************************************************************************
+ * function: checkMetricRule
+ * description: 检查规则的内容, 整理动作列表, 指标和命令必须是设备支持的
+ * param {*mysql.MetricRule} rule
+ * param {string} deviceType
+ * return {*}
+********************************************************************************/
+func checkMetricRule(rule *mysql.MetricRule, deviceType string) (int, string) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if len([]rune(rule.Name)) > 64 {
+		return common.ParamError, "name too long"
+	}
+	if rule.Name == "" {
+		rule.Name = rule.Metric
+	}
+	if !mysql.DeviceSupportsMetric(deviceType, rule.Metric) {
+		return common.ParamError, "metric not supported by device: " + rule.Metric
+	}
+	if !mysql.IsRuleOperator(rule.Operator) {
+		return common.ParamError, "operator error"
+	}
+	if (rule.Operator == mysql.RuleOpBetween || rule.Operator == mysql.RuleOpOutside) && rule.Value > rule.Value2 {
+		return common.ParamError, "value must not be greater than value2"
+	}
+	if rule.Sustain < 0 || rule.Sustain > maxRuleMinutes {
+		return common.ParamError, "sustain out of range"
+	}
+	if rule.Cooldown == 0 {
+		rule.Cooldown = mysql.RuleDefaultCooldown
+	}
+	if rule.Cooldown < 0 || rule.Cooldown > maxRuleMinutes {
+		return common.ParamError, "cooldown out of range"
+	}
+	for _, v := range []string{rule.ActiveStart, rule.ActiveEnd} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse(mysql.ContactHourFmt, v); err != nil {
+			return common.ParamError, "active time format error"
+		}
+	}
+	actions := make([]string, 0)
+	for _, v := range strings.Split(rule.Actions, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !mysql.IsRuleAction(v) {
+			return common.ParamError, "action not supported: " + v
+		}
+		actions = append(actions, v)
+	}
+	if len(actions) == 0 {
+		return common.ParamError, "actions required"
+	}
+	rule.Actions = strings.Join(actions, ",")
+	if len(rule.CommandParams) > 512 {
+		return common.ParamError, "command params too long"
+	}
+	if rule.HasAction(mysql.RuleActionCommand) {
+		if _, err := mysql.ParseRuleCommand(deviceType, rule.Command, rule.CommandParams); err != nil {
+			return common.ParamError, "command error: " + err.Error()
+		}
+	} else {
+		rule.Command = ""
+		rule.CommandParams = ""
+	}
+	if rule.Enabled != 0 {
+		rule.Enabled = 1
+	}
+	return common.Success, ""
+}
+
+/******************************************************************************
+ * function: QueryMetricRules
+ * description: 查询用户定义的规则, 可以按设备过滤
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryMetricRules(c *gin.Context) (int, interface{}) {
+	userId, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userId == 0 {
+		return common.ParamError, "user id required"
+	}
+	filter := fmt.Sprintf("user_id=%d", userId)
+	if mac := c.Query("mac"); mac != "" {
+		filter += fmt.Sprintf(" and mac='%s'", common.EscapeSql(mac))
+	}
+	var rules []mysql.MetricRule
+	mysql.QueryMetricRuleByCond(filter, "id", &rules)
+	if len(rules) == 0 {
+		return common.NoData, "no metric rule"
+	}
+	return common.Success, rules
+}
+
+/******************************************************************************
+ * function: QueryRuleMetrics
+ * description: 查询设备可以定义规则的指标
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryRuleMetrics(c *gin.Context) (int, interface{}) {
+	device, ok := queryRuleDevice(c.Query("mac"))
+	if !ok {
+		return common.NoExist, "device not exist"
+	}
+	metrics := mysql.RuleMetricsOf(device.Type)
+	if len(metrics) == 0 {
+		return common.NoData, "device does not support metric rule"
+	}
+	return common.Success, &RuleMetricsResp{
+		Mac:     device.Mac,
+		Type:    device.Type,
+		Metrics: metrics,
+	}
+}
+
+/******************************************************************************
+ * function: AddMetricRule
+ * description: 添加规则, 用户必须拥有设备或者设备共享给了用户, 控制设备的命令动作只有设备的拥有者可以使用
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func AddMetricRule(c *gin.Context) (int, interface{}) {
+	rule := mysql.NewMetricRule()
+	if err := c.ShouldBindJSON(rule); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if rule.UserId == 0 {
+		return common.ParamError, "user id required"
+	}
+	device, ok := queryRuleDevice(rule.Mac)
+	if !ok {
+		return common.NoExist, "device not exist"
+	}
+	flag, ok := mysql.QueryUserDeviceFlag(rule.UserId, device.ID, "")
+	if !ok {
+		return common.NoExist, "device not bound to user"
+	}
+	if status, msg := checkMetricRule(rule, device.Type); status != common.Success {
+		return status, msg
+	}
+	if rule.HasAction(mysql.RuleActionCommand) && flag != common.NormalDeviceFlag {
+		return common.NoPermission, "only device owner can use command action"
+	}
+	var rules []mysql.MetricRule
+	mysql.QueryMetricRuleByCond(fmt.Sprintf("user_id=%d and mac='%s'", rule.UserId, common.EscapeSql(device.Mac)), nil, &rules)
+	if len(rules) >= maxMetricRules {
+		return common.ParamError, "too many metric rules"
+	}
+	rule.ID = 0
+	rule.Mac = device.Mac
+	rule.LastTriggerTime = nil
+	rule.CreateTime = common.GetNowTime()
+	rule.UpdateTime = rule.CreateTime
+	if !rule.Insert() {
+		return common.DBError, "add metric rule failed"
+	}
+	return common.Success, rule
+}
+
+/******************************************************************************
+ * function: UpdateMetricRule
+ * description: 修改规则, 规则的用户和设备不能修改, 命令动作只有设备的拥有者可以使用
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func UpdateMetricRule(c *gin.Context) (int, interface{}) {
+	req := mysql.NewMetricRule()
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	rule := mysql.NewMetricRule()
+	if req.ID == 0 || !rule.QueryByID(req.ID) {
+		return common.NoExist, "metric rule not exist"
+	}
+	device, ok := queryRuleDevice(rule.Mac)
+	if !ok {
+		return common.NoExist, "device not exist"
+	}
+	flag, ok := mysql.QueryUserDeviceFlag(rule.UserId, device.ID, "")
+	if !ok {
+		return common.NoExist, "device not bound to user"
+	}
+	if status, msg := checkMetricRule(req, device.Type); status != common.Success {
+		return status, msg
+	}
+	if req.HasAction(mysql.RuleActionCommand) && flag != common.NormalDeviceFlag {
+		return common.NoPermission, "only device owner can use command action"
+	}
+	rule.Name = req.Name
+	rule.Metric = req.Metric
+	rule.Operator = req.Operator
+	rule.Value = req.Value
+	rule.Value2 = req.Value2
+	rule.Sustain = req.Sustain
+	rule.ActiveStart = req.ActiveStart
+	rule.ActiveEnd = req.ActiveEnd
+	rule.Actions = req.Actions
+	rule.Command = req.Command
+	rule.CommandParams = req.CommandParams
+	rule.Cooldown = req.Cooldown
+	rule.Enabled = req.Enabled
+	rule.UpdateTime = common.GetNowTime()
+	if !rule.Update() {
+		return common.DBError, "update metric rule failed"
+	}
+	return common.Success, rule
+}
+
+/******************************************************************************
+ * function: DeleteMetricRule
+ * description: 删除规则
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func DeleteMetricRule(c *gin.Context) (int, interface{}) {
+	req := &MetricRuleReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	rule := mysql.NewMetricRule()
+	if req.Id == 0 || !rule.QueryByID(req.Id) {
+		return common.NoExist, "metric rule not exist"
+	}
+	if !rule.Delete() {
+		return common.DBError, "delete metric rule failed"
+	}
+	return common.Success, "delete metric rule success"
+}
@@ -0,0 +1,402 @@
+package mdb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/mq"
+	"hjyserver/notify"
+	"hjyserver/redis"
+	"hjyserver/sms"
+	wxtools "hjyserver/wx/tools"
+)
+
+// 同一事件通知多个用户时webhook只推送一次, 记录已推送的事件id
+const notifyWebhookTtl = 3600
+
+// 缺省的模板重新加载间隔, 单位秒
+const notifyTemplateReload = 60
+
+// initNotify 注册通知通道, 加载配置的路由和模板
+func initNotify() {
+	notify.Register(&wxOfficialChannel{})
+	notify.Register(&wxMiniChannel{})
+	notify.Register(&smsChannel{})
+	notify.Register(&contactsChannel{})
+	notify.Register(&mqttChannel{})
+	notify.Register(&emailChannel{})
+	notify.Register(&webhookChannel{})
+	routes := make([]notify.Route, 0, len(cfg.This.Notify.Routes))
+	for _, r := range cfg.This.Notify.Routes {
+		routes = append(routes, notify.Route{Event: r.Event, Chains: r.Chains})
+	}
+	notify.SetRoutes(routes)
+	notify.SetRecorder(mysql.SaveNotifyAttempt)
+	notify.SetPolicy(&notifyPolicy{})
+	notify.SetInbox(saveNotifyMessage)
+	notify.SetDefaultLocale(cfg.This.Notify.DefaultLocale)
+	reloadNotifyTemplates()
+	reloadEmailTemplates()
+	interval := cfg.This.Notify.TemplateReload
+	if interval <= 0 {
+		interval = notifyTemplateReload
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			reloadNotifyTemplates()
+			reloadEmailTemplates()
+		}
+	}()
+	go func() {
+		for {
+			time.Sleep(1 * time.Minute)
+			flushNotifyDigests()
+		}
+	}()
+	go func() {
+		for {
+			time.Sleep(10 * time.Minute)
+			checkStudyWeekReport()
+		}
+	}()
+}
+
+/******************************************************************************
+ * function: reloadNotifyTemplates
+ * description: 重新加载模板文件和数据库中的模板, 数据库中的模板覆盖文件中同一语言的同名模板,
+ * 定时执行, 管理后台修改模板后也立即执行
+ * return {*}
+********************************************************************************/
+func reloadNotifyTemplates() {
+	texts := make(map[string]map[string]string)
+	if dir := cfg.This.Notify.TemplatePath; dir != "" {
+		files, err := notify.LoadTemplateDir(dir)
+		if err != nil {
+			// 文件读取失败时保留当前模板, 避免通知内容为空
+			mylog.Log.Errorln("load notify template files error:", err)
+			return
+		}
+		texts = files
+	}
+	for locale, items := range mysql.LoadNotifyTemplates() {
+		if _, ok := texts[locale]; !ok {
+			texts[locale] = make(map[string]string)
+		}
+		for key, text := range items {
+			texts[locale][key] = text
+		}
+	}
+	notify.SetTemplates(texts)
+}
+
+// wxResult 把微信接口的返回转换为通道的错误, 找不到用户的openid时按没有绑定处理
+func wxResult(status int, msg string) error {
+	switch status {
+	case common.Success:
+		return nil
+	case common.NoData:
+		return notify.ErrNoRecipient
+	}
+	return fmt.Errorf("status: %d, %s", status, msg)
+}
+
+// renderForUser 按用户的语言生成通知内容, 没有模板或者内容为空时返回ErrNoTemplate
+func renderForUser(user *mysql.User, event *notify.Event) (string, error) {
+	msg, err := notify.Render(user.Locale, event)
+	if err != nil {
+		return "", err
+	}
+	if msg == "" {
+		return "", notify.ErrNoTemplate
+	}
+	return msg, nil
+}
+
+// wxOfficialChannel 公众号模板消息
+type wxOfficialChannel struct {
+}
+
+func (me *wxOfficialChannel) Name() string {
+	return notify.ChannelWxOfficial
+}
+func (me *wxOfficialChannel) Send(userId int64, event *notify.Event) error {
+	switch event.Type {
+	case notify.EventStudyReport:
+		return wxResult(wxtools.SendEveryReportMsgToOfficalAccount(userId, event.NickName, event.Mac, event.StartTime, event.EndTime))
+	case notify.EventStudyDayReport:
+		return wxResult(wxtools.SendDayReportMsgToOfficalAccount(userId, event.NickName, event.Mac, event.Score, event.StartTime, event.EndTime))
+	case notify.EventAccountLocked:
+		if !cfg.This.Svr.EnableWx {
+			return notify.ErrUnsupported
+		}
+		user := mysql.NewUser()
+		if !user.QueryByID(userId) {
+			return notify.ErrNoRecipient
+		}
+		msg, err := renderForUser(user, event)
+		if err != nil {
+			return err
+		}
+		return wxResult(wxtools.SendCustomerTextMsgToUser(userId, msg))
+	case notify.EventStudyWarning, notify.EventDigest, notify.EventRuleAlert:
+		user := mysql.NewUser()
+		if !user.QueryByID(userId) {
+			return notify.ErrNoRecipient
+		}
+		msg, err := renderForUser(user, event)
+		if err != nil {
+			return err
+		}
+		switch {
+		case event.Type == notify.EventDigest:
+			return wxResult(wxtools.SendH03DeviceStatusWarningMsgToOfficalAccount(userId, user.NickName, "", msg, event.CreateTime))
+		case event.Type == notify.EventRuleAlert && event.DeviceType == mysql.T1Type:
+			return wxResult(wxtools.SendT1DeviceStatusWarningMsgToOfficalAccount(userId, event.NickName, event.Mac, msg, event.CreateTime))
+		case event.Type == notify.EventRuleAlert:
+			// 规则的code为规则id, 不能按上线消息发送
+			return wxResult(wxtools.SendH03DeviceStatusWarningMsgToOfficalAccount(userId, event.NickName, event.Mac, msg, event.CreateTime))
+		case event.DeviceType == mysql.T1Type && event.Code == 1:
+			return wxResult(wxtools.SendT1DeviceOnlineMsgToOfficalAccount(userId, event.NickName, event.Mac, msg, event.CreateTime))
+		case event.DeviceType == mysql.T1Type:
+			return wxResult(wxtools.SendT1DeviceStatusWarningMsgToOfficalAccount(userId, event.NickName, event.Mac, msg, event.CreateTime))
+		case event.Code == 1:
+			return wxResult(wxtools.SendH03DeviceOnlineMsgToOfficalAccount(userId, event.NickName, event.Mac, msg, event.CreateTime))
+		default:
+			return wxResult(wxtools.SendH03DeviceStatusWarningMsgToOfficalAccount(userId, event.NickName, event.Mac, msg, event.CreateTime))
+		}
+	}
+	return notify.ErrUnsupported
+}
+
+// wxMiniChannel 小程序订阅消息
+type wxMiniChannel struct {
+}
+
+func (me *wxMiniChannel) Name() string {
+	return notify.ChannelWxMini
+}
+func (me *wxMiniChannel) Send(userId int64, event *notify.Event) error {
+	switch event.Type {
+	case notify.EventStudyReport, notify.EventStudyDayReport:
+		return wxResult(wxtools.SendReportMsgToMiniProgram(userId, event.NickName, event.Title, event.Mac, event.Score, event.StartTime, event.EndTime))
+	}
+	return notify.ErrUnsupported
+}
+
+/******************************************************************************
+ * function: contactAlarmKey
+ * description: 通知紧急联系人的报警, 返回 来源.类型 用于匹配联系人关注的报警, 其他事件返回false
+ * param {*notify.Event} event
+ * return {*}
+********************************************************************************/
+func contactAlarmKey(event *notify.Event) (string, bool) {
+	switch event.Type {
+	case notify.EventSleepAlarm:
+		// 离床和在床不通知
+		if event.Code == 3001 || event.Code == 3012 {
+			return "", false
+		}
+		return fmt.Sprintf("%s.%d", mysql.AlarmSourceSleep, event.Code), true
+	case notify.EventVitalNotify:
+		return fmt.Sprintf("vital.%d", event.Code), true
+	case notify.EventAlarmEscalation:
+		return fmt.Sprintf("%s.%d", event.Title, event.Code), true
+	case notify.EventRuleAlert:
+		return fmt.Sprintf("rule.%d", event.Code), true
+	}
+	return "", false
+}
+
+// contactSender 通过一个通道通知联系人, 联系人没有该通道的地址时返回ErrNoRecipient
+type contactSender func(contact *mysql.EmergencyContact, nickName string, msg string, event *notify.Event) error
+
+// 联系人可以使用的通道
+var contactSenders = map[string]contactSender{
+	notify.ChannelSms:        sendContactSms,
+	notify.ChannelWxOfficial: sendContactWx,
+	notify.ChannelEmail:      sendContactEmail,
+}
+
+// sendContactSms 短信只发送到已验证的手机号
+func sendContactSms(contact *mysql.EmergencyContact, nickName string, msg string, event *notify.Event) error {
+	if contact.Phone == "" || contact.PhoneVerified != 1 {
+		return notify.ErrNoRecipient
+	}
+	return sms.SendSms(contact.Phone, nickName, msg)
+}
+
+// sendContactWx 公众号模板消息发送到联系人的openId
+func sendContactWx(contact *mysql.EmergencyContact, nickName string, msg string, event *notify.Event) error {
+	if contact.OpenId == "" {
+		return notify.ErrNoRecipient
+	}
+	return wxResult(wxtools.SendDeviceStatusWarningMsgToOpenId(contact.OpenId, nickName, msg, event.CreateTime))
+}
+
+// eventNickName 通知内容中的称呼, 事件没有时使用用户昵称
+func eventNickName(user *mysql.User, event *notify.Event) string {
+	if event.NickName != "" {
+		return event.NickName
+	}
+	return user.NickName
+}
+
+// smsChannel 短信, 发送到用户的主联系人, 用户还没有紧急联系人时发送到原来的紧急联系电话.
+// 账号安全的通知发送到用户本人的手机
+type smsChannel struct {
+}
+
+func (me *smsChannel) Name() string {
+	return notify.ChannelSms
+}
+func (me *smsChannel) Send(userId int64, event *notify.Event) error {
+	if event.Type == notify.EventAccountLocked {
+		user := mysql.NewUser()
+		if !user.QueryByID(userId) || user.Phone == "" {
+			return notify.ErrNoRecipient
+		}
+		desc, err := renderForUser(user, event)
+		if err != nil {
+			return err
+		}
+		return sms.SendSms(user.Phone, user.NickName, desc)
+	}
+	key, ok := contactAlarmKey(event)
+	if !ok {
+		return notify.ErrUnsupported
+	}
+	user := mysql.NewUser()
+	if !user.QueryByID(userId) {
+		return notify.ErrNoRecipient
+	}
+	var contacts []mysql.EmergencyContact
+	mysql.QueryUserContacts(userId, &contacts)
+	phone := user.EmergentPhone
+	if len(contacts) > 0 {
+		// 主联系人排在第一个
+		primary := &contacts[0]
+		if primary.IsPrimary != 1 || primary.PhoneVerified != 1 || !primary.HasChannel(notify.ChannelSms) ||
+			!primary.MatchAlarm(key) || !primary.ActiveAt(time.Now()) {
+			return notify.ErrNoRecipient
+		}
+		phone = primary.Phone
+	}
+	if phone == "" {
+		return notify.ErrNoRecipient
+	}
+	desc, err := renderForUser(user, event)
+	if err != nil {
+		return err
+	}
+	return sms.SendSms(phone, eventNickName(user, event), desc)
+}
+
+// contactsChannel 通知用户所有关注该报警、在接收时段内的紧急联系人, 每个联系人使用自己的通道
+type contactsChannel struct {
+}
+
+func (me *contactsChannel) Name() string {
+	return notify.ChannelContacts
+}
+func (me *contactsChannel) Send(userId int64, event *notify.Event) error {
+	key, ok := contactAlarmKey(event)
+	if !ok {
+		return notify.ErrUnsupported
+	}
+	user := mysql.NewUser()
+	if !user.QueryByID(userId) {
+		return notify.ErrNoRecipient
+	}
+	var contacts []mysql.EmergencyContact
+	mysql.QueryUserContacts(userId, &contacts)
+	if len(contacts) == 0 {
+		return notify.ErrNoRecipient
+	}
+	msg, err := renderForUser(user, event)
+	if err != nil {
+		return err
+	}
+	nickName := eventNickName(user, event)
+	now := time.Now()
+	delivered := false
+	result := notify.ErrNoRecipient
+	for i := range contacts {
+		contact := &contacts[i]
+		if !contact.MatchAlarm(key) || !contact.ActiveAt(now) {
+			continue
+		}
+		for _, name := range strings.Split(contact.Channels, ",") {
+			sender, ok := contactSenders[name]
+			if !ok {
+				continue
+			}
+			if err := sender(contact, nickName, msg, event); err != nil {
+				if err != notify.ErrNoRecipient {
+					mylog.Log.Errorf("notify contact %d of user %d by %s failed: %v", contact.ID, userId, name, err)
+					result = err
+				}
+				continue
+			}
+			delivered = true
+		}
+	}
+	if delivered {
+		return nil
+	}
+	return result
+}
+
+// mqttChannel 发布到用户的通知主题
+type mqttChannel struct {
+}
+
+func (me *mqttChannel) Name() string {
+	return notify.ChannelMqtt
+}
+func (me *mqttChannel) Send(userId int64, event *notify.Event) error {
+	mq.PublishData(common.MakeUserNotifyTopic(userId), event)
+	return nil
+}
+
+// 通知事件对应的webhook事件
+var notifyWebhookEvents = map[string]string{
+	notify.EventSleepAlarm:      mysql.WebhookAlarmRaised,
+	notify.EventVitalNotify:     mysql.WebhookAlarmRaised,
+	notify.EventStudyReport:     mysql.WebhookStudyReportReady,
+	notify.EventStudyDayReport:  mysql.WebhookStudyReportReady,
+	notify.EventAlarmEscalation: mysql.WebhookAlarmEscalated,
+}
+
+// webhookChannel 推送给订阅了设备事件的合作机构, 与用户无关, 同一事件只推送一次
+type webhookChannel struct {
+}
+
+func (me *webhookChannel) Name() string {
+	return notify.ChannelWebhook
+}
+func (me *webhookChannel) Send(userId int64, event *notify.Event) error {
+	webhookEvent, ok := notifyWebhookEvents[event.Type]
+	if !ok || event.Mac == "" {
+		return notify.ErrUnsupported
+	}
+	n, err := redis.IncrValueEx("notify_webhook_"+event.ID, notifyWebhookTtl)
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		return nil
+	}
+	var data interface{} = event
+	if event.Data != nil {
+		data = event.Data
+	}
+	mysql.EmitWebhookEvent(webhookEvent, event.Mac, data)
+	return nil
+}
@@ -0,0 +1,160 @@
+package mdb
+
+import (
+	"fmt"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/email"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/notify"
+	"hjyserver/redis"
+)
+
+// 周一该时间之后发送上周的周报告
+const studyWeekReportHour = 9
+
+// 领取周报告发送任务的有效期, 多个实例只有一个发送
+const studyWeekReportClaimTtl = 7 * 24 * 3600
+
+// reloadEmailTemplates 重新加载邮件模板, 目录读取失败时保留当前模板
+func reloadEmailTemplates() {
+	email.SetDefaultLocale(cfg.This.Notify.DefaultLocale)
+	dir := cfg.This.Mail.TemplatePath
+	if dir == "" {
+		return
+	}
+	if err := email.LoadTemplates(dir); err != nil {
+		mylog.Log.Errorln("load email template files error:", err)
+	}
+}
+
+// emailEventData 通知邮件模板的数据, Text是按通知模板生成的内容
+type emailEventData struct {
+	*notify.Event
+	NickName string
+	Text     string
+}
+
+// emailTemplateKeys 邮件模板的查找顺序, 与通知模板一致, 最后使用通用模板
+func emailTemplateKeys(event *notify.Event, text string) []string {
+	keys := []string{
+		fmt.Sprintf("%s.%d.%d", event.Type, event.Code, event.Status),
+		fmt.Sprintf("%s.%d", event.Type, event.Code),
+		event.Type,
+	}
+	// 通用模板只显示通知内容, 没有内容时不使用
+	if text != "" {
+		keys = append(keys, "notify")
+	}
+	return keys
+}
+
+// sendEventEmail 生成事件的邮件并发送, 没有配置邮件服务器时按不支持处理
+func sendEventEmail(addr string, locale string, nickName string, text string, event *notify.Event) error {
+	subject, body, err := email.Render(locale, emailTemplateKeys(event, text), &emailEventData{
+		Event:    event,
+		NickName: nickName,
+		Text:     text,
+	})
+	if err == email.ErrNoTemplate {
+		return notify.ErrNoTemplate
+	}
+	if err != nil {
+		return err
+	}
+	err = email.Send(addr, subject, body)
+	if err == email.ErrNotConfigured {
+		return notify.ErrUnsupported
+	}
+	return err
+}
+
+// emailChannel 发送到用户已验证的邮箱, 用户可以在通知偏好中关闭
+type emailChannel struct {
+}
+
+func (me *emailChannel) Name() string {
+	return notify.ChannelEmail
+}
+func (me *emailChannel) Send(userId int64, event *notify.Event) error {
+	user := mysql.NewUser()
+	if !user.QueryByID(userId) {
+		return notify.ErrNoRecipient
+	}
+	if user.Email == "" || user.EmailVerified != 1 {
+		return notify.ErrNoRecipient
+	}
+	if mysql.QueryNotifyPreference(userId).Email != 1 {
+		return notify.ErrNoRecipient
+	}
+	// 报告有专门的邮件模板, 没有通知模板时内容为空
+	text, _ := notify.Render(user.Locale, event)
+	return sendEventEmail(user.Email, user.Locale, eventNickName(user, event), text, event)
+}
+
+// sendContactEmail 邮件使用通用模板发送到联系人已验证的邮箱
+func sendContactEmail(contact *mysql.EmergencyContact, nickName string, msg string, event *notify.Event) error {
+	if contact.Email == "" || contact.EmailVerified != 1 {
+		return notify.ErrNoRecipient
+	}
+	return sendEventEmail(contact.Email, "", nickName, msg, event)
+}
+
+/******************************************************************************
+ * function: checkStudyWeekReport
+ * description: 周一上午通知上周有周报告的设备的所有用户, 每周只发送一次
+ * return {*}
+********************************************************************************/
+func checkStudyWeekReport() {
+	now := time.Now()
+	if now.Weekday() != time.Monday || now.Hour() < studyWeekReportHour {
+		return
+	}
+	y, w := now.AddDate(0, 0, -7).ISOWeek()
+	n, err := redis.IncrValueEx(fmt.Sprintf("study_week_report_%d_%d", y, w), studyWeekReportClaimTtl)
+	if err != nil || n > 1 {
+		return
+	}
+	// 上周一到上周日
+	start := now.AddDate(0, 0, -7).Format(cfg.DateFmtStr)
+	end := now.AddDate(0, 0, -1).Format(cfg.DateFmtStr)
+	var h03Reports []mysql.H03WeekReport
+	mysql.QueryH03WeekReportsByWeek(y, w, &h03Reports)
+	for i := range h03Reports {
+		report := &h03Reports[i]
+		notifyStudyWeekReport(report.Mac, mysql.H03Type, report.AvgStudyEvaluation, start, end, report)
+	}
+	var t1Reports []mysql.T1WeekReport
+	mysql.QueryT1WeekReportsByWeek(y, w, &t1Reports)
+	for i := range t1Reports {
+		report := &t1Reports[i]
+		notifyStudyWeekReport(report.Mac, mysql.T1Type, report.AvgStudyEvaluation, start, end, report)
+	}
+	mylog.Log.Infof("study week report %d-%d notified, h03: %d, t1: %d", y, w, len(h03Reports), len(t1Reports))
+}
+
+// notifyStudyWeekReport 向设备的所有用户发送周报告通知
+func notifyStudyWeekReport(mac string, deviceType string, score float32, start string, end string, report interface{}) {
+	var userDevices []mysql.UserDeviceDetail
+	mysql.QueryUserDeviceDetailByMac(mac, &userDevices)
+	eventId := common.GenerateUUID()
+	for _, userDevice := range userDevices {
+		notify.Notify(userDevice.UserId, &notify.Event{
+			ID:         eventId,
+			Type:       notify.EventStudyWeekReport,
+			Mac:        mac,
+			DeviceType: deviceType,
+			NickName:   userDevice.NickName,
+			DeviceName: userDevice.DeviceName,
+			Title:      "周报告",
+			Score:      int(score),
+			StartTime:  start,
+			EndTime:    end,
+			CreateTime: common.GetNowTime(),
+			Data:       report,
+		})
+	}
+}
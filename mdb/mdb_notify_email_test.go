@@ -0,0 +1,53 @@
+package mdb
+
+import (
+	"strings"
+	"testing"
+
+	"hjyserver/email"
+	"hjyserver/mdb/mysql"
+	"hjyserver/notify"
+)
+
+func TestSendEventEmail(t *testing.T) {
+	if err := email.LoadTemplates("../templates/email"); err != nil {
+		t.Fatal(err)
+	}
+	var to, subject, body string
+	old := email.SetSender(func(addr string, s string, html string) error {
+		to, subject, body = addr, s, html
+		return nil
+	})
+	defer email.SetSender(old)
+
+	event := &notify.Event{
+		Type:      notify.EventSleepReport,
+		Score:     86,
+		StartTime: "2025-04-18 23:10:00",
+		EndTime:   "2025-04-19 07:05:00",
+		Data:      &mysql.SleepReportNotify{GoBedTime: "2025-04-18 22:50:00", BaseHeartRate: 62},
+	}
+	if err := sendEventEmail("a@example.com", "en", "Tom", "", event); err != nil {
+		t.Fatal(err)
+	}
+	if to != "a@example.com" || !strings.Contains(subject, "Tom") {
+		t.Errorf("to = %s, subject = %s", to, subject)
+	}
+	for _, v := range []string{"86", "2025-04-18 22:50:00", "62"} {
+		if !strings.Contains(body, v) {
+			t.Errorf("body does not contain %s", v)
+		}
+	}
+
+	// 没有专门的模板时使用通用模板, 没有通知内容时不发送
+	event = &notify.Event{Type: notify.EventVitalNotify, Code: 1}
+	if err := sendEventEmail("a@example.com", "en", "Tom", "", event); err != notify.ErrNoTemplate {
+		t.Errorf("err = %v, want ErrNoTemplate", err)
+	}
+	if err := sendEventEmail("a@example.com", "en", "Tom", "heart rate too high", event); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "heart rate too high") {
+		t.Errorf("body does not contain the notify text")
+	}
+}
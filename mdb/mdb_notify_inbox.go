@@ -0,0 +1,137 @@
+package mdb
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每次最多标记的消息数
+const maxInboxMarkIds = 200
+
+// swagger:model InboxReadReq
+type InboxReadReq struct {
+	// required: true
+	UserId int64 `json:"user_id"`
+	// 消息id, 为空时标记所有未读消息
+	Ids []int64 `json:"ids"`
+}
+
+// swagger:model InboxUnread
+type InboxUnread struct {
+	UserId int64 `json:"user_id"`
+	Unread int64 `json:"unread"`
+}
+
+/******************************************************************************
+ * function: saveNotifyMessage
+ * description: 把通知结果保存到用户的收件箱, 内容按用户的语言生成
+ * param {*notify.Message} m
+ * return {*}
+********************************************************************************/
+func saveNotifyMessage(m *notify.Message) {
+	event := m.Event
+	message := mysql.NewNotifyMessage()
+	message.UserId = m.UserId
+	message.EventId = event.ID
+	message.EventType = event.Type
+	message.Mac = event.Mac
+	message.Code = event.Code
+	message.Channels = strings.Join(m.Channels, ",")
+	message.Status = m.Status
+	if event.CreateTime != "" {
+		message.CreateTime = event.CreateTime
+	}
+	locale := ""
+	user := mysql.NewUser()
+	if user.QueryByID(m.UserId) {
+		locale = user.Locale
+	}
+	// 没有模板的事件只保存事件内容, app按事件类型显示
+	message.Template, message.Content, _ = notify.RenderTemplate(locale, event)
+	if payload, err := json.Marshal(event); err == nil {
+		message.Payload = string(payload)
+	}
+	if !message.Insert() {
+		mylog.Log.Errorf("save notify message of event %s for user %d failed", event.ID, m.UserId)
+	}
+}
+
+/******************************************************************************
+ * function: QueryInbox
+ * description: 分页查询用户的消息, 最新的在前, is_read可以过滤已读或未读, event_type按事件类型过滤
+ * param {*gin.Context} c
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func QueryInbox(c *gin.Context, page *common.PageDao) (int, interface{}) {
+	userId, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userId == 0 {
+		return common.ParamError, "user id required"
+	}
+	conds := []string{"user_id=" + strconv.FormatInt(userId, 10)}
+	if v := c.Query("is_read"); v != "" {
+		isRead, err := strconv.Atoi(v)
+		if err != nil || (isRead != 0 && isRead != 1) {
+			return common.ParamError, "is_read error"
+		}
+		conds = append(conds, "is_read="+v)
+	}
+	if v := c.Query("event_type"); v != "" {
+		conds = append(conds, "event_type='"+common.EscapeSql(v)+"'")
+	}
+	var messages []mysql.NotifyMessage
+	mysql.QueryNotifyMessageByCond(strings.Join(conds, " and "), page, "id desc", &messages)
+	if len(messages) == 0 {
+		return common.NoData, "no message"
+	}
+	return common.Success, messages
+}
+
+/******************************************************************************
+ * function: QueryInboxUnreadCount
+ * description: 查询用户的未读消息数
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryInboxUnreadCount(c *gin.Context) (int, interface{}) {
+	userId, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userId == 0 {
+		return common.ParamError, "user id required"
+	}
+	return common.Success, &InboxUnread{
+		UserId: userId,
+		Unread: mysql.CountUnreadNotifyMessages(userId),
+	}
+}
+
+/******************************************************************************
+ * function: MarkInboxRead
+ * description: 把用户的消息标记为已读, ids为空时标记所有未读消息, 返回标记后的未读数
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func MarkInboxRead(c *gin.Context) (int, interface{}) {
+	req := &InboxReadReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.UserId == 0 {
+		return common.ParamError, "user id required"
+	}
+	if len(req.Ids) > maxInboxMarkIds {
+		return common.ParamError, "too many ids"
+	}
+	mysql.MarkNotifyMessagesRead(req.UserId, req.Ids)
+	return common.Success, &InboxUnread{
+		UserId: req.UserId,
+		Unread: mysql.CountUnreadNotifyMessages(req.UserId),
+	}
+}
@@ -0,0 +1,233 @@
+package mdb
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/notify"
+	"hjyserver/redis"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 缺省的摘要发送间隔, 单位秒
+const notifyDigestInterval = 3600
+
+// 用户的每日上限不限制的通道, app和合作机构的推送不打扰用户
+var uncappedChannels = map[string]bool{
+	notify.ChannelMqtt:    true,
+	notify.ChannelWebhook: true,
+}
+
+// DigestItem 摘要中每种事件的条数
+type DigestItem struct {
+	EventType string `json:"event_type"`
+	Count     int    `json:"count"`
+}
+
+// isCriticalEvent 配置的严重事件, 匹配 事件类型.编号 或 事件类型
+func isCriticalEvent(event *notify.Event) bool {
+	key := fmt.Sprintf("%s.%d", event.Type, event.Code)
+	for _, v := range cfg.This.Notify.Critical {
+		if v == key || v == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyPolicy 实现notify.Policy
+type notifyPolicy struct {
+}
+
+func (me *notifyPolicy) Admit(userId int64, event *notify.Event) (int, string) {
+	// 严重的事件每次都要送达, 不去重也不受免打扰限制
+	if event.Type == notify.EventDigest || isCriticalEvent(event) {
+		return notify.DecisionSend, ""
+	}
+	pref := mysql.QueryNotifyPreference(userId)
+	decision := notify.DecisionDrop
+	if pref.Digest == 1 {
+		decision = notify.DecisionDefer
+	}
+	window := pref.DedupWindow
+	if window <= 0 {
+		window = cfg.This.Notify.DedupWindow
+	}
+	if window > 0 {
+		key := fmt.Sprintf("notify_dedup_%d_%s_%s_%d", userId, event.Type, event.Mac, event.Code)
+		if n, err := redis.IncrValueEx(key, window); err == nil && n > 1 {
+			return decision, "duplicate"
+		}
+	}
+	if pref.QuietAt(time.Now()) {
+		return decision, "quiet hours"
+	}
+	return notify.DecisionSend, ""
+}
+
+// dailyCap 通道的每日上限, 用户设置的上限优先, 0不限制
+func dailyCap(userId int64, channel string) int {
+	if uncappedChannels[channel] {
+		return 0
+	}
+	if pref := mysql.QueryNotifyPreference(userId); pref.DailyCap > 0 {
+		return pref.DailyCap
+	}
+	return cfg.This.Notify.DailyCap[channel]
+}
+
+func dailyCapKey(userId int64, channel string) string {
+	return fmt.Sprintf("notify_cap_%s_%d_%s", channel, userId, time.Now().Format("20060102"))
+}
+
+func (me *notifyPolicy) Allow(userId int64, event *notify.Event, channel string) bool {
+	if isCriticalEvent(event) {
+		return true
+	}
+	limit := dailyCap(userId, channel)
+	if limit <= 0 {
+		return true
+	}
+	v, _ := redis.GetValue(dailyCapKey(userId, channel))
+	n, _ := strconv.Atoi(v)
+	return n < limit
+}
+
+func (me *notifyPolicy) Sent(userId int64, event *notify.Event, channel string) {
+	if uncappedChannels[channel] {
+		return
+	}
+	// 严重的事件不受限制, 但也计入当天的条数
+	redis.IncrValueEx(dailyCapKey(userId, channel), 24*3600)
+}
+
+func (me *notifyPolicy) Defer(userId int64, event *notify.Event, reason string) {
+	digest := mysql.NewNotifyDigest()
+	digest.UserId = userId
+	digest.EventId = event.ID
+	digest.EventType = event.Type
+	digest.Mac = event.Mac
+	digest.Code = event.Code
+	digest.Reason = reason
+	digest.CreateTime = event.CreateTime
+	digest.Insert()
+}
+
+/******************************************************************************
+ * function: flushNotifyDigests
+ * description: 发送等待中的摘要, 用户不在免打扰时段, 并且最早的一条已经超过摘要间隔时发送,
+ * 免打扰结束后夜间拦截的通知会立即合并发送
+ * return {*}
+********************************************************************************/
+func flushNotifyDigests() {
+	interval := cfg.This.Notify.DigestInterval
+	if interval <= 0 {
+		interval = notifyDigestInterval
+	}
+	now := time.Now()
+	for _, pending := range mysql.QueryPendingDigests() {
+		firstTime, err := time.ParseInLocation(cfg.TmFmtStr, pending.FirstTime, time.Local)
+		if err != nil || now.Sub(firstTime) < time.Duration(interval)*time.Second {
+			continue
+		}
+		if mysql.QueryNotifyPreference(pending.UserId).QuietAt(now) {
+			continue
+		}
+		var digests []mysql.NotifyDigest
+		mysql.QueryNotifyDigestByCond(fmt.Sprintf("user_id=%d and status=%d and id<=%d",
+			pending.UserId, mysql.DigestPending, pending.MaxId), "id", &digests)
+		if mysql.ClaimNotifyDigests(pending.UserId, pending.MaxId) == 0 {
+			continue
+		}
+		counts := make(map[string]int)
+		items := make([]DigestItem, 0)
+		for _, v := range digests {
+			if _, ok := counts[v.EventType]; !ok {
+				items = append(items, DigestItem{EventType: v.EventType})
+			}
+			counts[v.EventType]++
+		}
+		for i := range items {
+			items[i].Count = counts[items[i].EventType]
+		}
+		notify.Notify(pending.UserId, &notify.Event{
+			Type:      notify.EventDigest,
+			Value:     len(digests),
+			StartTime: pending.FirstTime,
+			EndTime:   now.Format(cfg.TmFmtStr),
+			Data:      items,
+		})
+		mylog.Log.Infof("notify digest of %d events sent to user %d", len(digests), pending.UserId)
+	}
+}
+
+/******************************************************************************
+ * function: QueryNotifyPreference
+ * description: 查询用户的通知偏好, 没有设置时返回缺省值
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryNotifyPreference(c *gin.Context) (int, interface{}) {
+	userId, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userId == 0 {
+		return common.ParamError, "user id required"
+	}
+	return common.Success, mysql.QueryNotifyPreference(userId)
+}
+
+/******************************************************************************
+ * function: UpdateNotifyPreference
+ * description: 设置用户的免打扰时段、去重窗口、每日上限、摘要模式和是否接收邮件
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func UpdateNotifyPreference(c *gin.Context) (int, interface{}) {
+	req := mysql.NewNotifyPreference()
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.UserId == 0 {
+		return common.ParamError, "user id required"
+	}
+	for _, v := range []string{req.QuietStart, req.QuietEnd} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse(mysql.ContactHourFmt, v); err != nil {
+			return common.ParamError, "quiet time format error"
+		}
+	}
+	if req.DedupWindow < 0 || req.DailyCap < 0 {
+		return common.ParamError, "dedup window or daily cap error"
+	}
+	if req.Digest != 0 {
+		req.Digest = 1
+	}
+	if req.Email != 0 {
+		req.Email = 1
+	}
+	pref := mysql.QueryNotifyPreference(req.UserId)
+	pref.QuietStart = req.QuietStart
+	pref.QuietEnd = req.QuietEnd
+	pref.DedupWindow = req.DedupWindow
+	pref.DailyCap = req.DailyCap
+	pref.Digest = req.Digest
+	pref.Email = req.Email
+	pref.UpdateTime = common.GetNowTime()
+	var ok bool
+	if pref.ID == 0 {
+		ok = pref.Insert()
+	} else {
+		ok = pref.Update()
+	}
+	if !ok {
+		return common.DBError, "update notify preference failed"
+	}
+	return common.Success, pref
+}
@@ -0,0 +1,102 @@
+package mdb
+
+import (
+	"fmt"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+/******************************************************************************
+ * function: requestUserToken
+ * description: 解析请求中的token, 支持Authorization: Bearer头和token参数
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func requestUserToken(c *gin.Context) (*mysql.UserToken, bool) {
+	token := mysql.GetRequestToken(c)
+	if token == "" {
+		return nil, false
+	}
+	return mysql.ParseUserToken(token)
+}
+
+// replicaFor 报表和统计查询的读库选项, 调用者刚写过数据时读主库
+func replicaFor(c *gin.Context) mysql.ReadOption {
+	return mysql.ReadReplicaFor(c.GetInt64(common.AuthUserIdKey))
+}
+
+// swagger:model RefreshTokenReq
+type RefreshTokenReq struct {
+	// required: true
+	RefreshToken string `json:"refresh_token"`
+}
+
+/******************************************************************************
+ * function: RefreshUserToken
+ * description: 用refresh token换取新的token, refresh token轮换后只在很短的宽限时间内可以再次使用
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func RefreshUserToken(c *gin.Context) (int, interface{}) {
+	req := &RefreshTokenReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.RefreshToken == "" {
+		return common.ParamError, "refresh_token required"
+	}
+	tokens, status := mysql.RefreshUserSession(req.RefreshToken)
+	if status != common.Success {
+		return status, "refresh token invalid"
+	}
+	return common.Success, tokens
+}
+
+/******************************************************************************
+ * function: QueryUserSessions
+ * description: 查询当前用户所有有效的会话
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryUserSessions(c *gin.Context) (int, interface{}) {
+	userToken, ok := requestUserToken(c)
+	if !ok {
+		return common.TokenError, "token invalid"
+	}
+	var sessions []mysql.UserSession
+	filter := fmt.Sprintf("user_id=%d and status=%d", userToken.UserID, mysql.SessionActive)
+	mysql.QueryUserSessionByCond(filter, "last_active_time desc", &sessions)
+	if len(sessions) == 0 {
+		return common.NoData, "no session"
+	}
+	return common.Success, sessions
+}
+
+// swagger:model RevokeSessionReq
+type RevokeSessionReq struct {
+	// 为空时撤销当前用户所有会话
+	SessionId string `json:"session_id"`
+}
+
+/******************************************************************************
+ * function: RevokeUserSession
+ * description: 撤销当前用户的一个或全部会话, 被撤销会话的token立即失效
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func RevokeUserSession(c *gin.Context) (int, interface{}) {
+	req := &RevokeSessionReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	userToken, ok := requestUserToken(c)
+	if !ok {
+		return common.TokenError, "token invalid"
+	}
+	if !mysql.RevokeUserSession(userToken.UserID, req.SessionId) {
+		return common.NoExist, "session not exist"
+	}
+	return common.Success, "revoke session success"
+}
@@ -0,0 +1,242 @@
+package mdb
+
+import (
+	"fmt"
+
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/redis"
+	"hjyserver/sms"
+
+	"github.com/gin-gonic/gin"
+)
+
+// define sms code purpose
+const (
+	SmsCodeLogin       = "login"
+	SmsCodeRegister    = "register"
+	SmsCodeModifyPhone = "modify_phone"
+	SmsCodeResetPasswd = "reset_passwd"
+	// 解锁连续登录失败被锁定的账号
+	SmsCodeUnlock = "unlock"
+	// 验证紧急联系人的手机号, 由联系人接口发送
+	SmsCodeContact = "contact"
+	// 删除用户数据
+	SmsCodeEraseData = "erase_data"
+)
+
+// swagger:model SmsCodeReq
+type SmsCodeReq struct {
+	// required: true
+	Phone string `json:"phone"`
+	// required: true
+	// login/register/modify_phone/reset_passwd/unlock/erase_data
+	Purpose string `json:"purpose"`
+}
+
+// normalizePhone 去掉空格, 只支持大陆和香港手机号
+func normalizePhone(phone string) (string, bool) {
+	if phone == "" {
+		return "", false
+	}
+	phone = common.FixPlusInPhoneString(phone)
+	return phone, common.IsCNPhone(phone) || common.IsHKPhone(phone)
+}
+
+func queryUserByPhone(phone string) (*mysql.User, bool) {
+	var users []mysql.User
+	mysql.QueryUserByCond(fmt.Sprintf("phone = '%s'", common.EscapeSql(phone)), nil, nil, &users)
+	if len(users) == 0 {
+		return nil, false
+	}
+	return &users[0], true
+}
+
+/******************************************************************************
+ * function: SendSmsCode
+ * description: 发送短信验证码, 登录、重置密码和解锁要求手机号已注册, 注册和修改手机号要求未注册.
+ * 不满足条件时不发送, 但返回和发送成功相同的结果, 避免通过该接口判断手机号是否注册
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func SendSmsCode(c *gin.Context) (int, interface{}) {
+	req := &SmsCodeReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	phone, ok := normalizePhone(req.Phone)
+	if !ok {
+		return common.PhoneError, "phone is invalid"
+	}
+	_, registered := queryUserByPhone(phone)
+	var deliver bool
+	switch req.Purpose {
+	case SmsCodeLogin, SmsCodeResetPasswd, SmsCodeUnlock, SmsCodeEraseData:
+		deliver = registered
+	case SmsCodeRegister, SmsCodeModifyPhone:
+		deliver = !registered
+	default:
+		return common.ParamError, "purpose error"
+	}
+	return sendSmsCode(c, phone, req.Purpose, deliver)
+}
+
+// sendSmsCode 检查发送频率, 生成验证码保存哈希后发送, deliver为false时只计入频率限制, 不发送
+func sendSmsCode(c *gin.Context, phone string, purpose string, deliver bool) (int, interface{}) {
+	if status, msg := smsCodeChannel.limit(phone, c.ClientIP()); status != common.Success {
+		return status, msg
+	}
+	if !deliver {
+		smsCodeChannel.hold(phone)
+		return common.Success, "send sms code success"
+	}
+	code, status, msg := smsCodeChannel.issue(phone, purpose)
+	if status != common.Success {
+		return status, msg
+	}
+	if err := sms.SendVerifyCode(phone, code); err != nil {
+		mylog.Log.Errorln("send sms code to", phone, "error:", err)
+		return common.PhoneError, "send sms code failed"
+	}
+	return common.Success, "send sms code success"
+}
+
+// swagger:model SmsLoginReq
+type SmsLoginReq struct {
+	// required: true
+	Phone string `json:"phone"`
+	// required: true
+	Code string `json:"code"`
+}
+
+/******************************************************************************
+ * function: SmsLogin
+ * description: 手机号和验证码登录, 和密码登录一样检查账号锁定和IP封禁, 验证码错误按登录失败计数
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func SmsLogin(c *gin.Context) (int, interface{}) {
+	req := &SmsLoginReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	phone, ok := normalizePhone(req.Phone)
+	if !ok {
+		return common.PhoneError, "phone is invalid"
+	}
+	user, registered := queryUserByPhone(phone)
+	account := phone
+	if registered {
+		account = user.Account
+	}
+	if status, msg := checkLoginAllowed(c, account); status != common.Success {
+		return status, msg
+	}
+	if status, msg := smsCodeChannel.check(phone, SmsCodeLogin, req.Code); status != common.Success {
+		loginFailed(c, account, user)
+		return status, msg
+	}
+	if !registered {
+		return common.NoExist, "phone is not registered"
+	}
+	return loginSuccess(c, user)
+}
+
+// swagger:model SmsRegisterReq
+type SmsRegisterReq struct {
+	// required: true
+	Phone string `json:"phone"`
+	// required: true
+	Code     string `json:"code"`
+	NickName string `json:"nick_name"`
+	// 可选, 不设置时只能用验证码登录
+	Password string `json:"password"`
+}
+
+/******************************************************************************
+ * function: SmsRegister
+ * description: 手机号和验证码注册, 使用手机号作为账号, 注册成功后直接登录
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func SmsRegister(c *gin.Context) (int, interface{}) {
+	req := &SmsRegisterReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	phone, ok := normalizePhone(req.Phone)
+	if !ok {
+		return common.PhoneError, "phone is invalid"
+	}
+	if status, msg := smsCodeChannel.check(phone, SmsCodeRegister, req.Code); status != common.Success {
+		return status, msg
+	}
+	user := mysql.NewUser()
+	user.Account = phone
+	user.Phone = phone
+	user.NickName = req.NickName
+	user.LoginType = 0
+	if req.Password != "" {
+		hash, err := common.HashPassword(req.Password)
+		if err != nil {
+			return common.ParamError, "password format error"
+		}
+		user.Password = hash
+	}
+	status, result := mysql.RegisterWithUserObj(user)
+	if status != common.Success {
+		return status, result
+	}
+	return loginSuccess(c, user)
+}
+
+// swagger:model ResetPasswdReq
+type ResetPasswdReq struct {
+	// required: true
+	Phone string `json:"phone"`
+	// required: true
+	Code string `json:"code"`
+	// required: true
+	Password string `json:"password"`
+}
+
+/******************************************************************************
+ * function: ResetPasswd
+ * description: 验证码重置密码, 同时撤销用户所有的登录会话并解除锁定
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func ResetPasswd(c *gin.Context) (int, interface{}) {
+	req := &ResetPasswdReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.Password == "" {
+		return common.ParamError, "password required"
+	}
+	phone, ok := normalizePhone(req.Phone)
+	if !ok {
+		return common.PhoneError, "phone is invalid"
+	}
+	if status, msg := smsCodeChannel.check(phone, SmsCodeResetPasswd, req.Code); status != common.Success {
+		return status, msg
+	}
+	user, ok := queryUserByPhone(phone)
+	if !ok {
+		return common.NoExist, "phone is not registered"
+	}
+	hash, err := common.HashPassword(req.Password)
+	if err != nil {
+		return common.ParamError, "password format error"
+	}
+	user.Password = hash
+	if !user.Update() {
+		return common.DBError, "reset password failed"
+	}
+	mysql.RevokeUserSession(user.ID, "")
+	redis.SetValueEx(fmt.Sprintf("%s_%d", common.UserTbl, user.ID), "", 1)
+	resetLoginFailures(user.Account)
+	mysql.InsertSecurityEvent(user.ID, user.Account, mysql.SecurityPasswordReset, c.ClientIP(), "")
+	return common.Success, "reset password success"
+}
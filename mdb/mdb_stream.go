@@ -0,0 +1,51 @@
+package mdb
+
+import (
+	"fmt"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+)
+
+// 观看时实时数据的推送频率, 单位秒
+const streamRealDataFreq = 1
+
+// askRealDataPush 按设备类型请求设备开始或停止保持推送实时数据
+func askRealDataPush(mac string, keepPush int) {
+	var devices []mysql.Device
+	mysql.QueryDeviceByCond(fmt.Sprintf("mac='%s'", common.EscapeSql(mac)), nil, nil, &devices)
+	if len(devices) == 0 {
+		return
+	}
+	device := devices[0]
+	switch device.Type {
+	case mysql.X1Type:
+		if cfg.This.Svr.EnableX1 {
+			mysql.AskX1RealData(device.Mac, streamRealDataFreq, keepPush)
+		}
+	case mysql.Ed713Type:
+		if cfg.This.Svr.EnableEd713 {
+			mysql.AskEd713RealData(device.Mac, streamRealDataFreq, keepPush)
+		}
+	case mysql.LampType:
+		if cfg.This.Svr.EnableHl77 {
+			mysql.AskHl77RealData(device.Mac, streamRealDataFreq, keepPush)
+		}
+	default:
+		// 其他设备主动上报, 不需要请求
+		return
+	}
+	mylog.Log.Infoln("stream ask real data, mac:", device.Mac, "keep_push:", keepPush)
+}
+
+// startRealDataPush 第一个观看者订阅设备时调用
+func startRealDataPush(mac string) {
+	askRealDataPush(mac, 1)
+}
+
+// stopRealDataPush 最后一个观看者离开时调用
+func stopRealDataPush(mac string) {
+	askRealDataPush(mac, 0)
+}
@@ -15,14 +15,19 @@
 package mdb
 
 import (
+	"database/sql"
 	"fmt"
 	"hjyserver/cfg"
+	mylog "hjyserver/log"
 	"hjyserver/mdb/common"
 	"hjyserver/mdb/mysql"
 	"hjyserver/mq"
+	"hjyserver/redis"
 	mysqlwx "hjyserver/wx/mdb/mysql"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -35,7 +40,7 @@ type VerifyTokenResp struct {
 }
 
 func VerifyUserToken(c *gin.Context) (int, interface{}) {
-	token := c.Query("token")
+	token := mysql.GetRequestToken(c)
 	if token == "" {
 		return common.ParamError, "token required"
 	}
@@ -63,6 +68,12 @@ type LoginReq struct {
 	LoginType int `json:"login_type" mysql:"login_type"` // 0:phone 1:email
 }
 
+// swagger:model LoginResp
+type LoginResp struct {
+	mysql.User
+	mysql.UserTokenPair
+}
+
 /******************************************************************************
  * function: UserLogin
  * description: user login
@@ -81,7 +92,13 @@ func UserLogin(c *gin.Context) (int, interface{}) {
 		return common.ParamError, "password required"
 	}
 
-	filter := fmt.Sprintf("account = '%s'", me.Account)
+	if me.Account != "guest" {
+		if status, msg := checkLoginAllowed(c, me.Account); status != common.Success {
+			return status, msg
+		}
+	}
+
+	filter := fmt.Sprintf("account = '%s'", common.EscapeSql(me.Account))
 	var gList []mysql.User
 	mysql.QueryUserByCond(filter, nil, nil, &gList)
 	if len(gList) > 0 {
@@ -89,27 +106,140 @@ func UserLogin(c *gin.Context) (int, interface{}) {
 		if obj.Account == "guest" {
 			return http.StatusOK, obj
 		}
-		passwd, _ := common.EncryptDataWithDefaultkey(me.Passwd)
-		if passwd == obj.Password {
-			obj.IsLogin = 1
-			obj.LoginTime = common.GetNowTime()
-			obj.Update()
-			return http.StatusOK, obj
+		if obj.Password == common.PasswordResetRequired {
+			return common.PasswdNeedReset, "password must be reset"
+		}
+		if ok, rehash := common.CheckPassword(obj.Password, me.Passwd); ok {
+			// 旧的加密密码或强度不够的哈希, 登录成功时迁移
+			if rehash {
+				if hash, err := common.HashPassword(me.Passwd); err == nil {
+					obj.Password = hash
+				} else {
+					mylog.Log.Errorln("rehash password error:", err)
+				}
+			}
+			return loginSuccess(c, &obj)
 		}
+		loginFailed(c, me.Account, &obj)
 		return common.PasswdError, "password error!"
 	}
+	loginFailed(c, me.Account, nil)
 	return common.NoExist, "account is not exist!"
 }
 
+// loginSuccess 密码或验证码校验通过后更新登录状态并签发token
+func loginSuccess(c *gin.Context, obj *mysql.User) (int, interface{}) {
+	resetLoginFailures(obj.Account)
+	obj.IsLogin = 1
+	obj.LoginTime = common.GetNowTime()
+	obj.Update()
+	tokens, ok := mysql.IssueUserToken(c, obj)
+	if !ok {
+		return common.DBError, "create token failed"
+	}
+	return http.StatusOK, LoginResp{User: *obj, UserTokenPair: *tokens}
+}
+
+// swagger:model UserRegisterReq
+type UserRegisterReq struct {
+	// required: true
+	Account string `json:"account"`
+	// required: true
+	Password string `json:"password"`
+	NickName string `json:"nick_name"`
+	// 0 未知 1 男 2 女
+	Gender int `json:"gender"`
+	// 0:phone 1:email
+	LoginType     int    `json:"login_type"`
+	Phone         string `json:"phone"`
+	Email         string `json:"email"`
+	EmergentPhone string `json:"emergent_phone"`
+	Face          string `json:"face"`
+	BornDate      string `json:"born_date"`
+	Grade         string `json:"grade"`
+	Address       string `json:"address"`
+	RoomNum       string `json:"room_num"`
+	Locale        string `json:"locale"`
+	// required: true
+	// login_type为0时是purpose为register的短信验证码, 为1时是邮箱验证码
+	Code string `json:"code"`
+}
+
+// ToUser 注册请求转换为用户记录, 密码在注册前计算哈希
+func (me *UserRegisterReq) ToUser() *mysql.User {
+	user := mysql.NewUser()
+	user.Account = me.Account
+	user.Password = me.Password
+	user.NickName = me.NickName
+	user.Gender = me.Gender
+	user.LoginType = me.LoginType
+	user.Phone = me.Phone
+	user.Email = me.Email
+	user.EmergentPhone = me.EmergentPhone
+	user.Face = me.Face
+	user.BornDate = me.BornDate
+	user.Grade = me.Grade
+	user.Address = me.Address
+	user.RoomNum = me.RoomNum
+	user.Locale = me.Locale
+	return user
+}
+
 /******************************************************************************
  * function: UserRegister
- * description: register a new user
+ * description: register a new user, 需要手机号或邮箱的注册验证码, 使用手机号注册并填写了邮箱时
+ * 向邮箱发送验证码, 通过verifyEmail验证
  * return {*}
 ********************************************************************************/
 func UserRegister(c *gin.Context) (int, interface{}) {
-	me := mysql.NewUser()
-	me.DecodeFromGin(c)
-	return mysql.RegisterWithUserObj(me)
+	req := &UserRegisterReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if req.Password == "" {
+		return common.ParamError, "password required"
+	}
+	if req.LoginType == 0 && req.Phone == "" {
+		return common.ParamError, "phone is empty!"
+	}
+	if req.LoginType == 1 && req.Email == "" {
+		return common.ParamError, "email is empty!"
+	}
+	me := req.ToUser()
+	if req.LoginType == 1 {
+		addr, ok := normalizeEmail(req.Email)
+		if !ok {
+			return common.ParamError, "email is invalid"
+		}
+		if status, msg := emailCodeChannel.check(addr, EmailCodeRegister, req.Code); status != common.Success {
+			return status, msg
+		}
+		me.Email = addr
+		me.EmailVerified = 1
+	} else {
+		phone, ok := normalizePhone(req.Phone)
+		if !ok {
+			return common.PhoneError, "phone is invalid"
+		}
+		if status, msg := smsCodeChannel.check(phone, SmsCodeRegister, req.Code); status != common.Success {
+			return status, msg
+		}
+		me.Phone = phone
+	}
+	hash, err := common.HashPassword(req.Password)
+	if err != nil {
+		return common.ParamError, "password format error"
+	}
+	me.Password = hash
+	status, result := mysql.RegisterWithUserObj(me)
+	if status == http.StatusOK && me.Email != "" && me.EmailVerified == 0 {
+		if addr, ok := normalizeEmail(me.Email); ok {
+			if code, msg := sendEmailCode(c.ClientIP(), me, addr, EmailCodeVerify); code != common.Success {
+				mylog.Log.Errorln("send verify email to", addr, "failed:", msg)
+			}
+		}
+	}
+	return status, result
 }
 
 /******************************************************************************
@@ -129,6 +259,10 @@ func LoginOut(c *gin.Context) (int, interface{}) {
 	if err := c.ShouldBindJSON(req); err != nil {
 		return http.StatusBadRequest, "json format error"
 	}
+	// 撤销当前token对应的会话
+	if userToken, ok := requestUserToken(c); ok && userToken.SessionId != "" {
+		mysql.RevokeUserSession(userToken.UserID, userToken.SessionId)
+	}
 	me := mysql.NewUser()
 	me.ID = req.ID
 	if me.ID != 0 {
@@ -161,25 +295,50 @@ func DeleteUser(c *gin.Context) (int, interface{}) {
 	if err := c.ShouldBindJSON(req); err != nil {
 		return common.JsonError, "json format error"
 	}
+	if req.ID <= 0 {
+		return common.ParamError, "user id required"
+	}
 	me := mysql.NewUser()
 	me.ID = req.ID
-	if me.Delete() {
-		mysql.DeleteDeviceRelationByUserId(me.ID)
-		mysql.DeleteUserRelationByUserId(me.ID, 0)
-		// 删除用户分享过的记录
-		mysql.DeleteUserShareDeviceByUserId(me.ID, 0, 0)
-		// 删除用户被分享过的记录
-		mysql.DeleteUserShareDeviceByUserId(0, me.ID, 0)
-		// 删除此用户过户出去的记录
-		mysql.DeleteUserTransferDeviceByUserId(me.ID, 0, 0)
-		// 删除此用户过户进来的记录
-		mysql.DeleteUserTransferDeviceByUserId(0, me.ID, 0)
-		if cfg.This.Svr.EnableWx {
-			mysqlwx.DeleteMiniProgramByUserId(me.ID)
+	// 用户及其关联记录在一个事务中删除, 任何一步失败都回滚
+	return runInTx(func(tx *sql.Tx) (int, interface{}) {
+		// 检查和删除在同一事务中, 锁定用户和设备关系, 避免并发的共享和过户
+		exist, ok := mysql.LockUserTx(tx, me.ID)
+		if !ok {
+			return common.DBError, "delete failed!"
+		}
+		if !exist {
+			return common.NoExist, "user not exist"
+		}
+		deviceIds, ok := mysql.QueryOwnDeviceIdsTx(tx, me.ID)
+		if !ok {
+			return common.DBError, "delete failed!"
+		}
+		// 用户创建的设备, 同时删除其他用户和该设备的共享关系以及过户记录
+		for _, deviceId := range deviceIds {
+			if !mysql.DeleteDeviceRelationByDeviceIdTx(tx, deviceId) ||
+				!mysql.DeleteUserTransferDeviceByUserIdTx(tx, 0, 0, deviceId) {
+				return common.DBError, "delete failed!"
+			}
+		}
+		if !me.DeleteTx(tx) ||
+			!mysql.DeleteDeviceRelationByUserIdTx(tx, me.ID) ||
+			!mysql.DeleteUserRelationByUserIdTx(tx, me.ID, 0) ||
+			// 删除用户分享过的记录
+			!mysql.DeleteUserShareDeviceByUserIdTx(tx, me.ID, 0, 0) ||
+			// 删除用户被分享过的记录
+			!mysql.DeleteUserShareDeviceByUserIdTx(tx, 0, me.ID, 0) ||
+			// 删除此用户过户出去的记录
+			!mysql.DeleteUserTransferDeviceByUserIdTx(tx, me.ID, 0, 0) ||
+			// 删除此用户过户进来的记录
+			!mysql.DeleteUserTransferDeviceByUserIdTx(tx, 0, me.ID, 0) {
+			return common.DBError, "delete failed!"
+		}
+		if cfg.This.Svr.EnableWx && !mysqlwx.DeleteMiniProgramByUserIdTx(tx, me.ID) {
+			return common.DBError, "delete failed!"
 		}
 		return common.Success, "delete user success!"
-	}
-	return common.DBError, "delete failed!"
+	})
 }
 
 /******************************************************************************
@@ -340,6 +499,10 @@ func UpdateUser(c *gin.Context) (int, interface{}) {
 			if obj.Account != me.Account {
 				return common.NoPermission, "account can not be modified"
 			}
+			// 邮箱和验证状态只能通过ModifyEmail用验证码修改, 密码只能通过修改或重置密码接口修改
+			me.Email = obj.Email
+			me.EmailVerified = obj.EmailVerified
+			me.Password = obj.Password
 		}
 		me.Update()
 		return common.Success, me
@@ -357,6 +520,8 @@ func UpdateUser(c *gin.Context) (int, interface{}) {
 type NewPhone struct {
 	UserId int64  `json:"user_id"`
 	Phone  string `json:"phone"`
+	// 发送到新手机号的验证码, purpose为modify_phone
+	Code string `json:"code"`
 }
 
 func ModifyPhone(c *gin.Context) (int, interface{}) {
@@ -376,6 +541,9 @@ func ModifyPhone(c *gin.Context) (int, interface{}) {
 	if len(gList) > 0 {
 		return http.StatusBadRequest, "new phone has registered"
 	}
+	if status, msg := smsCodeChannel.check(newPhone.Phone, SmsCodeModifyPhone, newPhone.Code); status != common.Success {
+		return status, msg
+	}
 
 	me := mysql.NewUser()
 	me.SetID(newPhone.UserId)
@@ -421,6 +589,8 @@ func ModifyEmergentPhone(c *gin.Context) (int, interface{}) {
 type NewEmail struct {
 	UserId int64  `json:"user_id"`
 	Email  string `json:"email"`
+	// 发送到新邮箱的验证码, purpose为modify_email
+	Code string `json:"code"`
 }
 
 func ModifyEmail(c *gin.Context) (int, interface{}) {
@@ -434,53 +604,130 @@ func ModifyEmail(c *gin.Context) (int, interface{}) {
 	if newEmail.UserId == 0 || newEmail.Email == "" {
 		return common.ParamError, "user id and email required"
 	}
-	var gList []mysql.User
-	mysql.QueryUserByCond(fmt.Sprintf("email = '%s'", newEmail.Email), nil, nil, &gList)
-	if len(gList) > 0 {
+	addr, ok := normalizeEmail(newEmail.Email)
+	if !ok {
+		return common.ParamError, "email is invalid"
+	}
+	if _, count := queryUserByEmail(addr); count > 0 {
 		return common.RepeatData, "new email has registered"
 	}
+	if status, msg := emailCodeChannel.check(addr, EmailCodeModifyEmail, newEmail.Code); status != common.Success {
+		return status, msg
+	}
 
 	me := mysql.NewUser()
 	me.SetID(newEmail.UserId)
 	if me.ID != 0 {
 		me.QueryByID(me.ID)
-		me.Email = newEmail.Email
+		me.Email = addr
+		me.EmailVerified = 1
 		me.Update()
 		return common.Success, me
 	}
 	return common.DBError, "update failed!"
 }
 
+// swagger:model NewLocale
+type NewLocale struct {
+	UserId int64 `json:"user_id"`
+	// 语言, 如zh-CN、zh-HK、en, 为空时使用缺省语言
+	Locale string `json:"locale"`
+}
+
+// 语言标签, 如en、zh-CN、zh_HK
+var localeRegexp = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})?$`)
+
+/******************************************************************************
+ * function: ModifyLocale
+ * description: 修改用户的首选语言, 通知按该语言选择模板
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func ModifyLocale(c *gin.Context) (int, interface{}) {
+	var newLocale = &NewLocale{
+		UserId: 0,
+		Locale: "",
+	}
+	if err := c.ShouldBindJSON(newLocale); err != nil {
+		return common.ParamError, "json format error"
+	}
+	if newLocale.UserId == 0 {
+		return common.ParamError, "user id required"
+	}
+	if newLocale.Locale != "" && !localeRegexp.MatchString(newLocale.Locale) {
+		return common.ParamError, "locale format error"
+	}
+	me := mysql.NewUser()
+	if !me.QueryByID(newLocale.UserId) {
+		return common.NoExist, "user record not exist"
+	}
+	me.Locale = newLocale.Locale
+	if !me.Update() {
+		return common.DBError, "update locale failed"
+	}
+	return common.Success, me
+}
+
 // swagger:model NewPasswd
 type NewPasswd struct {
-	UserId int64  `json:"user_id"`
-	Passwd string `json:"password"`
+	UserId int64 `json:"user_id"`
+	// required: true
+	// 旧密码
+	OldPasswd string `json:"old_password"`
+	Passwd    string `json:"password"`
 }
 
 /******************************************************************************
- * function:
- * description:
+ * function: ModifyPasswd
+ * description: 校验旧密码后修改密码, 旧密码错误按登录失败计数,
+ * 修改后撤销当前会话之外的所有登录会话
  * param {*gin.Context} c
  * return {*}
 ********************************************************************************/
 func ModifyPasswd(c *gin.Context) (int, interface{}) {
 	var newPasswd = &NewPasswd{
-		UserId: 0,
-		Passwd: "",
+		UserId:    0,
+		OldPasswd: "",
+		Passwd:    "",
 	}
 	if err := c.ShouldBindJSON(newPasswd); err != nil {
 		return common.ParamError, "json format error"
 	}
-	if newPasswd.UserId == 0 || newPasswd.Passwd == "" {
-		return common.ParamError, "user id and passwd required"
+	if newPasswd.UserId == 0 || newPasswd.OldPasswd == "" || newPasswd.Passwd == "" {
+		return common.ParamError, "user id, old passwd and passwd required"
 	}
 	me := mysql.NewUser()
 	me.ID = newPasswd.UserId
 	if !me.QueryByID(newPasswd.UserId) {
 		return common.NoExist, "user record not exist"
 	}
-	me.Password, _ = common.EncryptDataWithDefaultkey(newPasswd.Passwd)
-	me.Update()
+	if status, msg := checkLoginAllowed(c, me.Account); status != common.Success {
+		return status, msg
+	}
+	if me.Password == common.PasswordResetRequired {
+		return common.PasswdNeedReset, "password must be reset"
+	}
+	if ok, _ := common.CheckPassword(me.Password, newPasswd.OldPasswd); !ok {
+		loginFailed(c, me.Account, me)
+		return common.PasswdError, "old password error"
+	}
+	hash, err := common.HashPassword(newPasswd.Passwd)
+	if err != nil {
+		return common.ParamError, "password format error"
+	}
+	me.Password = hash
+	if !me.Update() {
+		return common.DBError, "update password failed"
+	}
+	// 保留当前会话, 其他设备需要重新登录, 旧格式的token全部失效
+	var sessionId string
+	if userToken, ok := requestUserToken(c); ok {
+		sessionId = userToken.SessionId
+	}
+	mysql.RevokeOtherUserSessions(me.ID, sessionId)
+	redis.SetValueEx(fmt.Sprintf("%s_%d", common.UserTbl, me.ID), "", 1)
+	resetLoginFailures(me.Account)
+	mysql.InsertSecurityEvent(me.ID, me.Account, mysql.SecurityPasswordChanged, c.ClientIP(), "")
 	return http.StatusOK, me
 }
 
@@ -537,8 +784,26 @@ func QueryUserById(c *gin.Context) (int, interface{}) {
 	return http.StatusAccepted, "query failed"
 }
 
+// lookupAllowed 按手机号或邮箱查询时只返回调用者本人, 有用户查询权限的管理员可以查到所有用户
+func lookupAllowed(c *gin.Context, users []mysql.User) []mysql.User {
+	userId := c.GetInt64(common.AuthUserIdKey)
+	if userId == 0 {
+		return nil
+	}
+	if mysql.RoleHasPermission(mysql.QueryUserRole(userId), mysql.PermUserRead) {
+		return users
+	}
+	var results []mysql.User
+	for _, v := range users {
+		if v.ID == userId {
+			results = append(results, v)
+		}
+	}
+	return results
+}
+
 /**
- * @description: query user by phone
+ * @description: query user by phone, 完全匹配手机号
  * @return {*}
  */
 func QueryUserByPhone(c *gin.Context) (int, interface{}) {
@@ -548,7 +813,8 @@ func QueryUserByPhone(c *gin.Context) (int, interface{}) {
 	}
 	phone = common.FixPlusInPhoneString(phone)
 	var gList []mysql.User
-	mysql.QueryUserByCond(fmt.Sprintf("phone like '%%%s%%'", phone), nil, nil, &gList)
+	mysql.QueryUserByCond(fmt.Sprintf("phone = '%s'", common.EscapeSql(phone)), nil, nil, &gList)
+	gList = lookupAllowed(c, gList)
 	if len(gList) == 0 {
 		return common.NoExist, "user is not exist"
 	}
@@ -562,12 +828,13 @@ func QueryUserByPhone(c *gin.Context) (int, interface{}) {
  * return {*}
 ********************************************************************************/
 func QueryUserByEmail(c *gin.Context) (int, interface{}) {
-	email := c.Query("email")
+	email := strings.ToLower(strings.TrimSpace(c.Query("email")))
 	if email == "" {
 		return common.ParamError, "email required"
 	}
 	var gList []mysql.User
-	mysql.QueryUserByCond(fmt.Sprintf("email like '%%%s%%'", email), nil, nil, &gList)
+	mysql.QueryUserByCond(fmt.Sprintf("lower(email) = '%s'", common.EscapeSql(email)), nil, nil, &gList)
+	gList = lookupAllowed(c, gList)
 	if len(gList) == 0 {
 		return common.NoExist, "user is not exist"
 	}
@@ -874,6 +1141,10 @@ func QueryStudyRoomUser(c *gin.Context) (int, interface{}) {
 	if err != nil {
 		createIdInt = 0
 	}
+	// 都为0时会查到所有自习室的成员
+	if roomIdInt <= 0 && createIdInt <= 0 {
+		return common.ParamError, "room id or create id required"
+	}
 	if roomIdInt > 0 {
 		var filter string
 		if createId == "" || createId == "0" {
@@ -919,8 +1190,8 @@ func QueryUserStudyData(c *gin.Context) (int, interface{}) {
 	var userData = &UserStudyData{}
 	userId1, _ := strconv.ParseInt(userId, 10, 64)
 	roomId1, _ := strconv.ParseInt(roomId, 10, 64)
-	mysql.QueryUserStudyRoomData(userId1, roomId1, startTime, endTime, &userData.TotalData)
-	mysql.QueryUserStudyDataByDay(userId1, roomId1, startTime, endTime, &userData.DayData)
+	mysql.QueryUserStudyRoomData(userId1, roomId1, startTime, endTime, &userData.TotalData, replicaFor(c))
+	mysql.QueryUserStudyDataByDay(userId1, roomId1, startTime, endTime, &userData.DayData, replicaFor(c))
 	return http.StatusOK, userData
 }
 
@@ -943,7 +1214,7 @@ func QueryUserStudyTimeByDay(c *gin.Context) (int, interface{}) {
 	var gList []mysql.UserStudyTime
 	userId1, _ := strconv.ParseInt(userId, 10, 64)
 	roomId1, _ := strconv.ParseInt(roomId, 10, 64)
-	mysql.QueryUserStudyTimeByDate(userId1, roomId1, startDate, startDate, &gList)
+	mysql.QueryUserStudyTimeByDate(userId1, roomId1, startDate, startDate, &gList, replicaFor(c))
 	return http.StatusOK, gList
 }
 
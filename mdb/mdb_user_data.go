@@ -0,0 +1,472 @@
+package mdb
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"hjyserver/cfg"
+	"hjyserver/gopool"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"hjyserver/redis"
+	mysqlwx "hjyserver/wx/mdb/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 导出时不输出的敏感字段
+var userDataMaskedFields = []string{"password", "session_key"}
+
+type userDataTable struct {
+	tblName string
+	filter  string
+}
+
+// swagger:model UserDataJobReq
+type UserDataJobReq struct {
+	// required: true
+	// 用户id
+	ID int64 `json:"id"`
+	// 用户密码, 删除数据时提供密码或验证码
+	Password string `json:"password"`
+	// 删除数据的验证码, purpose为erase_data, 没有设置密码的账号使用验证码
+	Code string `json:"code"`
+	// 验证码的发送渠道, sms/email, 默认sms
+	Channel string `json:"channel"`
+}
+
+/******************************************************************************
+ * function: queryUserOwnedDevices
+ * description: 查询用户自己绑定的设备(不含共享设备), 设备数据随用户一起导出和删除
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func queryUserOwnedDevices(userId int64) []mysql.Device {
+	var relations []mysql.UserDeviceRelation
+	filter := fmt.Sprintf("user_id=%d and flag=%d", userId, common.NormalDeviceFlag)
+	mysql.QueryUserDeviceRelationByCond(filter, nil, nil, &relations)
+	var devices []mysql.Device
+	for _, v := range relations {
+		device := mysql.NewDevice()
+		if device.QueryByID(v.DeviceId) {
+			devices = append(devices, *device)
+		}
+	}
+	return devices
+}
+
+/******************************************************************************
+ * function: userDataTables
+ * description: 返回和用户相关的所有表及条件, 顺序即删除顺序, user_tbl放在最后
+ * param {int64} userId
+ * param {[]mysql.Device} devices 用户自己绑定的设备
+ * return {*}
+********************************************************************************/
+func userDataTables(userId int64, devices []mysql.Device) []userDataTable {
+	var tables []userDataTable
+	// 用户定义的规则, 以及其他看护人为用户设备定义的规则
+	ruleFilter := fmt.Sprintf("user_id=%d", userId)
+	if len(devices) > 0 {
+		var ids, macs []string
+		for _, v := range devices {
+			ids = append(ids, strconv.FormatInt(v.ID, 10))
+			macs = append(macs, "'"+v.Mac+"'")
+		}
+		macFilter := "mac in (" + strings.Join(macs, ",") + ")"
+		ruleFilter = fmt.Sprintf("(%s or %s)", ruleFilter, macFilter)
+		// 报警的升级记录通过alarm_id关联, 要在报警记录之前删除
+		tables = append(tables, userDataTable{common.AlarmEscalationTbl, fmt.Sprintf(
+			"alarm_id in (select id from %s where %s)", common.AlarmTbl, macFilter)})
+		for _, tbl := range []string{
+			common.DeviceOverviewTbl,
+			common.NotifySettingTbl,
+			common.DeviceRecordTbl(mysql.HeatRateType),
+			common.DeviceRecordTbl(mysql.X1Type),
+			common.DeviceDayReportTbl(mysql.X1Type),
+			common.DeviceDayReportJsonTbl(mysql.X1Type),
+			common.DeviceEventTbl(mysql.X1Type),
+			common.DeviceLedTbl(mysql.X1Type),
+			common.DeviceRecordTbl(mysql.Ed713Type),
+			common.DeviceDayReportTbl(mysql.Ed713Type),
+			common.DeviceEventTbl(mysql.Ed713Type),
+			common.FallAlarmTbl,
+			common.LampRealDataTbl,
+			common.LampEventTbl,
+			common.LampReportTbl,
+			common.LampControlTbl,
+			mysql.H03ErrorCode{}.TableName(),
+			mysql.H03AttrData{}.TableName(),
+			mysql.H03Event{}.TableName(),
+			mysql.H03StudyReportOrgJson{}.TableName(),
+			mysql.H03StudyReport{}.TableName(),
+			mysql.H03ReportSwitchSetting{}.TableName(),
+			mysql.H03WarningEventNotifyDailyStat{}.TableName(),
+			mysql.H03WarningEventNotifyWeekStat{}.TableName(),
+			mysql.H03WeekReport{}.TableName(),
+			mysql.H03DailyReport{}.TableName(),
+			mysql.T1ErrorCode{}.TableName(),
+			mysql.T1AttrData{}.TableName(),
+			mysql.T1Event{}.TableName(),
+			mysql.T1StudyReportOrgJson{}.TableName(),
+			mysql.T1StudyReport{}.TableName(),
+			mysql.T1ReportSwitchSetting{}.TableName(),
+			mysql.T1WarningEventNotifyDailyStat{}.TableName(),
+			mysql.T1WarningEventNotifyWeekStat{}.TableName(),
+			mysql.T1WeekReport{}.TableName(),
+			mysql.T1DailyReport{}.TableName(),
+			common.AlarmTbl,
+		} {
+			tables = append(tables, userDataTable{tbl, macFilter})
+		}
+		// 设备共享或过户给其他用户的记录也一起删除
+		deviceFilter := "device_id in (" + strings.Join(ids, ",") + ")"
+		tables = append(tables,
+			userDataTable{common.UserShareDeviceTbl, deviceFilter},
+			userDataTable{common.UserTransferDeviceTbl, deviceFilter},
+			userDataTable{common.UserDeviceRelationTbl, deviceFilter},
+		)
+	}
+	tables = append(tables,
+		userDataTable{common.UserDeviceRelationTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.UserShareDeviceTbl, fmt.Sprintf("from_user_id=%d or to_user_id=%d", userId, userId)},
+		userDataTable{common.UserTransferDeviceTbl, fmt.Sprintf("from_user_id=%d or to_user_id=%d", userId, userId)},
+		userDataTable{common.UserGroupTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.FriendsTbl, fmt.Sprintf("user_id=%d or friend_id=%d", userId, userId)},
+		userDataTable{common.StudyRoomUserTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.StudyRecordTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.UserSessionTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.UserRoleTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.SecurityEventTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.EmergencyContactTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.NotifyPreferenceTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.NotifyDigestTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.NotifyMessageTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.NotifyAttemptTbl, fmt.Sprintf("user_id=%d", userId)},
+		userDataTable{common.MetricRuleTbl, ruleFilter},
+	)
+	if cfg.This.Svr.EnableWx {
+		// 公众号关注记录通过union_id和小程序用户关联, 要在小程序记录之前删除
+		tables = append(tables,
+			userDataTable{mysqlwx.WxOfficalAccount{}.TableName(), fmt.Sprintf(
+				"from_union_id<>'' and from_union_id in (select union_id from %s where user_id=%d)",
+				mysqlwx.WxMiniProgram{}.TableName(), userId)},
+			userDataTable{mysqlwx.WxMiniProgram{}.TableName(), fmt.Sprintf("user_id=%d", userId)},
+		)
+	}
+	tables = append(tables, userDataTable{common.UserTbl, fmt.Sprintf("id=%d", userId)})
+	return tables
+}
+
+// 用户创建的自习室还有其他成员, 不删除, 只去掉创建人
+func userAnonymiseTables(userId int64) []userDataTable {
+	return []userDataTable{
+		{common.StudyRoomTbl, fmt.Sprintf("create_id=%d", userId)},
+	}
+}
+
+/******************************************************************************
+ * function: tokenUserId
+ * description: 从请求的token中取得用户id
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func tokenUserId(c *gin.Context) (int64, bool) {
+	userToken, ok := requestUserToken(c)
+	if !ok {
+		return 0, false
+	}
+	return userToken.UserID, true
+}
+
+/******************************************************************************
+ * function: ExportUserData
+ * description: 创建用户数据导出任务, 已有未完成的导出任务时直接返回该任务
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func ExportUserData(c *gin.Context) (int, interface{}) {
+	req := &UserDataJobReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if uid, ok := tokenUserId(c); !ok || uid != req.ID {
+		return common.NoPermission, "no permission to export the user data"
+	}
+	return createUserDataJob(req.ID, mysql.UserDataExportJob)
+}
+
+/******************************************************************************
+ * function: EraseUserData
+ * description: 创建用户数据删除任务, 需要校验用户密码或者发送到用户手机/已验证邮箱的验证码
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func EraseUserData(c *gin.Context) (int, interface{}) {
+	req := &UserDataJobReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return common.JsonError, "json format error"
+	}
+	if uid, ok := tokenUserId(c); !ok || uid != req.ID {
+		return common.NoPermission, "no permission to erase the user data"
+	}
+	user := mysql.NewUser()
+	if !user.QueryByID(req.ID) {
+		return common.NoExist, "user not exist"
+	}
+	if req.Code != "" {
+		if status, msg := checkEraseCode(user, req.Channel, req.Code); status != common.Success {
+			return status, msg
+		}
+	} else if ok, _ := common.CheckPassword(user.Password, req.Password); req.Password == "" || !ok {
+		return common.PasswdError, "password error!"
+	}
+	return createUserDataJob(req.ID, mysql.UserDataEraseJob)
+}
+
+// checkEraseCode 校验删除数据的验证码, 短信验证码发到用户的手机, 邮箱验证码只发到已验证的邮箱
+func checkEraseCode(user *mysql.User, channel string, code string) (int, string) {
+	switch channel {
+	case "", "sms":
+		if user.Phone == "" {
+			return common.PhoneError, "phone is not bound"
+		}
+		return smsCodeChannel.check(user.Phone, SmsCodeEraseData, code)
+	case "email":
+		if user.Email == "" || user.EmailVerified == 0 {
+			return common.ParamError, "email is not verified"
+		}
+		return emailCodeChannel.check(user.Email, EmailCodeEraseData, code)
+	}
+	return common.ParamError, "channel error"
+}
+
+func createUserDataJob(userId int64, jobType int) (int, interface{}) {
+	var jobs []mysql.UserDataJob
+	filter := fmt.Sprintf("user_id=%d and job_type=%d and status in (%d,%d)",
+		userId, jobType, mysql.UserDataJobPending, mysql.UserDataJobRunning)
+	mysql.QueryUserDataJobByCond(filter, nil, &jobs)
+	if len(jobs) > 0 {
+		return common.Success, jobs[0]
+	}
+	job := mysql.NewUserDataJob()
+	job.UserId = userId
+	job.JobType = jobType
+	if !job.Insert() {
+		return common.DBError, "create job failed"
+	}
+	mysql.GetTaskPool().Put(&gopool.Task{
+		Params: []interface{}{job},
+		Do: func(params ...interface{}) {
+			runUserDataJob(params[0].(*mysql.UserDataJob))
+		},
+	})
+	return common.Success, job
+}
+
+/******************************************************************************
+ * function: QueryUserDataJob
+ * description: 查询导出或删除任务的状态, 只能查询自己的任务
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func QueryUserDataJob(c *gin.Context) (int, interface{}) {
+	id, err := strconv.ParseInt(c.Query("id"), 10, 64)
+	if err != nil {
+		return common.ParamError, "job id required"
+	}
+	job := mysql.NewUserDataJob()
+	if !job.QueryByID(id) {
+		return common.NoExist, "job not exist"
+	}
+	// 任务id是连续的, 必须校验任务属于token对应的用户
+	if uid, ok := tokenUserId(c); !ok || uid != job.UserId {
+		return common.NoPermission, "no permission to query the job"
+	}
+	if job.JobType == mysql.UserDataExportJob && job.Status == mysql.UserDataJobFinished {
+		return common.Success, gin.H{"job": job, "download_key": job.DownloadKey}
+	}
+	return common.Success, gin.H{"job": job}
+}
+
+/******************************************************************************
+ * function: GetUserDataExportFile
+ * description: 校验下载码, 返回导出文件路径
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func GetUserDataExportFile(c *gin.Context) (int, interface{}) {
+	id, err := strconv.ParseInt(c.Query("id"), 10, 64)
+	if err != nil {
+		return common.ParamError, "job id required"
+	}
+	job := mysql.NewUserDataJob()
+	if !job.QueryByID(id) || job.JobType != mysql.UserDataExportJob {
+		return common.NoExist, "job not exist"
+	}
+	if uid, ok := tokenUserId(c); !ok || uid != job.UserId ||
+		job.DownloadKey == "" || c.Query("key") != job.DownloadKey {
+		return common.NoPermission, "no permission to download the file"
+	}
+	if job.Status != mysql.UserDataJobFinished {
+		return common.NoData, "export file not ready"
+	}
+	return common.Success, job.FileName
+}
+
+func runUserDataJob(job *mysql.UserDataJob) {
+	job.Status = mysql.UserDataJobRunning
+	job.Update()
+	var ok bool
+	var msg string
+	if job.JobType == mysql.UserDataExportJob {
+		ok, msg = exportUserDataToZip(job)
+	} else {
+		ok, msg = eraseUserData(job.UserId)
+	}
+	job.Status = mysql.UserDataJobFinished
+	if !ok {
+		job.Status = mysql.UserDataJobFailed
+	}
+	job.Message = msg
+	job.FinishTime = common.GetNowTime()
+	job.Update()
+}
+
+/******************************************************************************
+ * function: exportUserDataToZip
+ * description: 每个表导出一个json文件, 加上manifest.json, 打包为zip
+ * param {*mysql.UserDataJob} job
+ * return {*}
+********************************************************************************/
+func exportUserDataToZip(job *mysql.UserDataJob) (bool, string) {
+	if err := os.MkdirAll(cfg.UserExportPath, 0700); err != nil {
+		mylog.Log.Errorln(err)
+		return false, "create export path failed"
+	}
+	fileName := filepath.Join(cfg.UserExportPath, fmt.Sprintf("user_%d_%d.zip", job.UserId, job.ID))
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false, "create export file failed"
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	tables := userDataTables(job.UserId, queryUserOwnedDevices(job.UserId))
+	tables = append(tables, userAnonymiseTables(job.UserId)...)
+	manifest := map[string]interface{}{
+		"user_id":     job.UserId,
+		"create_time": common.GetNowTime(),
+	}
+	counts := map[string]int{}
+	datas := map[string][]map[string]interface{}{}
+	for _, v := range tables {
+		rows, ok := mysql.QueryTableAsMaps(v.tblName, v.filter)
+		if !ok {
+			return false, "query " + v.tblName + " failed"
+		}
+		for _, row := range rows {
+			for _, field := range userDataMaskedFields {
+				delete(row, field)
+			}
+		}
+		// 同一个表可能按不同条件查询多次, 合并到一个文件
+		datas[v.tblName] = append(datas[v.tblName], rows...)
+	}
+	for tbl, rows := range datas {
+		counts[tbl] = len(rows)
+		if !writeZipJson(zw, tbl+".json", rows) {
+			return false, "write " + tbl + " failed"
+		}
+	}
+	manifest["tables"] = counts
+	if !writeZipJson(zw, "manifest.json", manifest) {
+		return false, "write manifest failed"
+	}
+	if err := zw.Close(); err != nil {
+		mylog.Log.Errorln(err)
+		return false, "close export file failed"
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		mylog.Log.Errorln(err)
+		return false, "create download key failed"
+	}
+	job.FileName = fileName
+	job.DownloadKey = hex.EncodeToString(key)
+	return true, fmt.Sprintf("exported %d tables", len(counts))
+}
+
+func writeZipJson(zw *zip.Writer, name string, v interface{}) bool {
+	w, err := zw.Create(name)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	return true
+}
+
+/******************************************************************************
+ * function: eraseUserData
+ * description: 在一个事务中删除或匿名化用户相关的所有记录, 提交后逐表校验没有残留
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func eraseUserData(userId int64) (bool, string) {
+	devices := queryUserOwnedDevices(userId)
+	tables := userDataTables(userId, devices)
+	anonymise := userAnonymiseTables(userId)
+	// 会话记录删除前先撤销, 使已签发的access token立即失效
+	mysql.RevokeUserSession(userId, "")
+	status, result := runInTx(func(tx *sql.Tx) (int, interface{}) {
+		for _, v := range tables {
+			stmt := fmt.Sprintf("delete from %s where %s", v.tblName, v.filter)
+			if !mysql.ExecByFilterTx(tx, v.tblName, stmt) {
+				return common.DBError, "erase " + v.tblName + " failed"
+			}
+		}
+		for _, v := range anonymise {
+			stmt := fmt.Sprintf("update %s set create_id=0 where %s", v.tblName, v.filter)
+			if !mysql.ExecByFilterTx(tx, v.tblName, stmt) {
+				return common.DBError, "anonymise " + v.tblName + " failed"
+			}
+		}
+		return common.Success, "ok"
+	})
+	if status != common.Success {
+		return false, fmt.Sprint(result)
+	}
+	for _, v := range devices {
+		mysql.UnsubscribeDeviceTopic(v.Mac)
+	}
+	// 使用户的token失效
+	redis.SetValueEx(fmt.Sprintf("%s_%d", common.UserTbl, userId), "", 1)
+	// 校验所有表都没有残留记录
+	var remains []string
+	for _, v := range append(tables, anonymise...) {
+		count, ok := mysql.CountTableByFilter(v.tblName, v.filter)
+		if !ok || count > 0 {
+			remains = append(remains, v.tblName)
+		}
+	}
+	if len(remains) > 0 {
+		mylog.Log.Errorln("erase user", userId, "data remains in", remains)
+		return false, "data remains in " + strings.Join(remains, ",")
+	}
+	mylog.Log.Infoln("erase user", userId, "data finished")
+	return true, fmt.Sprintf("erased %d tables, verified", len(tables)+len(anonymise))
+}
@@ -0,0 +1,58 @@
+package mdb
+
+import (
+	"hjyserver/cfg"
+	"hjyserver/mdb/common"
+	"hjyserver/mdb/mysql"
+	"strings"
+	"testing"
+)
+
+func TestUserDataTables(t *testing.T) {
+	cfg.This = new(cfg.Cfg)
+	cfg.This.Svr.EnableWx = true
+	devices := []mysql.Device{{ID: 3, Mac: "AABBCC"}}
+	tables := userDataTables(7, devices)
+	last := tables[len(tables)-1]
+	if last.tblName != common.UserTbl || last.filter != "id=7" {
+		t.Errorf("user_tbl should be erased last, got %v", last)
+	}
+	var hasMac, hasShare, hasAttempt, hasAlarm, hasEscalation bool
+	for _, v := range tables {
+		if v.tblName == common.AlarmEscalationTbl {
+			if hasAlarm {
+				t.Error("alarm escalation should be erased before alarm")
+			}
+			hasEscalation = true
+		}
+		if v.tblName == common.AlarmTbl && v.filter == "mac in ('AABBCC')" {
+			hasAlarm = true
+		}
+		if v.tblName == common.NotifyAttemptTbl && v.filter == "user_id=7" {
+			hasAttempt = true
+		}
+		if v.tblName == common.LampRealDataTbl && v.filter == "mac in ('AABBCC')" {
+			hasMac = true
+		}
+		if v.tblName == common.UserShareDeviceTbl && v.filter == "device_id in (3)" {
+			hasShare = true
+		}
+		if strings.TrimSpace(v.filter) == "" {
+			t.Errorf("table %s has empty filter", v.tblName)
+		}
+	}
+	if !hasMac || !hasShare {
+		t.Errorf("device tables missing, mac:%v share:%v", hasMac, hasShare)
+	}
+	if !hasAttempt || !hasAlarm || !hasEscalation {
+		t.Errorf("notify tables missing, attempt:%v alarm:%v escalation:%v", hasAttempt, hasAlarm, hasEscalation)
+	}
+	for _, v := range tables {
+		if v.tblName == common.MetricRuleTbl && v.filter != "(user_id=7 or mac in ('AABBCC'))" {
+			t.Errorf("metric rule filter error: %s", v.filter)
+		}
+	}
+	if len(userDataTables(7, nil)) >= len(tables) {
+		t.Error("device tables should be skipped when user has no device")
+	}
+}
@@ -0,0 +1,29 @@
+package mdb
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"hjyserver/mdb/mysql"
+)
+
+func TestUserJsonHidesPassword(t *testing.T) {
+	user := mysql.NewUser()
+	user.Account = "13800000000"
+	user.Password = "$2a$12$hash"
+	js, err := json.Marshal(LoginResp{User: *user, UserTokenPair: mysql.UserTokenPair{Token: "t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), "password") || strings.Contains(string(js), "$2a$") {
+		t.Errorf("login response contains the password: %s", js)
+	}
+	req := &UserRegisterReq{}
+	if err := json.Unmarshal([]byte(`{"account":"a","password":"p","id":9}`), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.ToUser(); got.Password != "p" || got.ID != 0 {
+		t.Errorf("ToUser() = id %d password %q", got.ID, got.Password)
+	}
+}
@@ -0,0 +1,147 @@
+package mdb
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/redis"
+)
+
+// codeChannel 验证码的发送通道, 短信和邮件共用生成、保存、频率限制和校验,
+// 验证码只保存哈希到redis, 有效期内限制校验次数, 按地址和IP限制发送频率
+type codeChannel struct {
+	// redis key的前缀, 也用于返回的信息
+	name string
+	// 验证码有效期, 单位秒
+	ttl int
+	// 有效期内最多校验次数, 超过后验证码作废
+	maxAttempts int64
+	// 同一地址发送间隔, 单位秒
+	sendInterval int
+	// 同一地址每天最多发送次数
+	dailyLimit int64
+	// 同一IP每小时最多发送次数
+	ipHourlyLimit int64
+}
+
+var smsCodeChannel = &codeChannel{
+	name:          "sms_code",
+	ttl:           300,
+	maxAttempts:   5,
+	sendInterval:  60,
+	dailyLimit:    10,
+	ipHourlyLimit: 30,
+}
+
+// 邮件送达比短信慢, 有效期长一些
+var emailCodeChannel = &codeChannel{
+	name:          "email_code",
+	ttl:           600,
+	maxAttempts:   5,
+	sendInterval:  60,
+	dailyLimit:    10,
+	ipHourlyLimit: 30,
+}
+
+func (me *codeChannel) label() string {
+	return strings.ReplaceAll(me.name, "_", " ")
+}
+
+func (me *codeChannel) hash(addr string, purpose string, code string) string {
+	sum := sha256.Sum256([]byte(purpose + ":" + addr + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (me *codeChannel) key(addr string, purpose string) string {
+	return fmt.Sprintf("%s_%s_%s", me.name, purpose, addr)
+}
+
+func (me *codeChannel) failKey(addr string, purpose string) string {
+	return fmt.Sprintf("%s_fail_%s_%s", me.name, purpose, addr)
+}
+
+func (me *codeChannel) intervalKey(addr string) string {
+	return fmt.Sprintf("%s_interval_%s", me.name, addr)
+}
+
+/******************************************************************************
+ * function: limit
+ * description: 检查发送间隔, 并计入地址每天和IP每小时的发送次数
+ * param {string} addr 手机号或邮箱
+ * param {string} ip 请求的IP, 为空时不限制IP
+ * return {*}
+********************************************************************************/
+func (me *codeChannel) limit(addr string, ip string) (int, string) {
+	if v, _ := redis.GetValue(me.intervalKey(addr)); v != "" {
+		return common.TooFrequent, fmt.Sprintf("send %s too frequently", me.label())
+	}
+	if n, err := redis.IncrValueEx(fmt.Sprintf("%s_daily_%s", me.name, addr), 24*3600); err != nil || n > me.dailyLimit {
+		return common.TooFrequent, fmt.Sprintf("send %s too many times today", me.label())
+	}
+	if ip != "" {
+		if n, err := redis.IncrValueEx(fmt.Sprintf("%s_ip_%s", me.name, ip), 3600); err != nil || n > me.ipHourlyLimit {
+			return common.TooFrequent, fmt.Sprintf("send %s too many times", me.label())
+		}
+	}
+	return common.Success, ""
+}
+
+// hold 开始发送间隔, 不发送验证码时也调用, 保持和发送时相同的限制
+func (me *codeChannel) hold(addr string) {
+	redis.SetValueEx(me.intervalKey(addr), "1", me.sendInterval)
+}
+
+/******************************************************************************
+ * function: issue
+ * description: 生成6位验证码, 保存哈希并开始发送间隔, 原来的失败次数清零
+ * param {string} addr
+ * param {string} purpose
+ * return {string} 验证码, 由调用者发送
+********************************************************************************/
+func (me *codeChannel) issue(addr string, purpose string) (string, int, string) {
+	num, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return "", common.CodeError, fmt.Sprintf("make %s failed", me.label())
+	}
+	code := fmt.Sprintf("%06d", num.Int64())
+	if err := redis.SetValueEx(me.key(addr, purpose), me.hash(addr, purpose, code), me.ttl); err != nil {
+		mylog.Log.Errorln(err)
+		return "", common.DBError, fmt.Sprintf("save %s failed", me.label())
+	}
+	redis.DelValue(me.failKey(addr, purpose))
+	me.hold(addr)
+	return code, common.Success, ""
+}
+
+/******************************************************************************
+ * function: check
+ * description: 校验验证码, 成功后验证码作废, 失败次数超过限制时验证码也作废
+ * param {string} addr
+ * param {string} purpose
+ * param {string} code
+ * return {*}
+********************************************************************************/
+func (me *codeChannel) check(addr string, purpose string, code string) (int, string) {
+	key := me.key(addr, purpose)
+	stored, _ := redis.GetValue(key)
+	if stored == "" || code == "" {
+		return common.CodeError, fmt.Sprintf("%s is expired", me.label())
+	}
+	if stored != me.hash(addr, purpose, code) {
+		n, _ := redis.IncrValueEx(me.failKey(addr, purpose), me.ttl)
+		if n >= me.maxAttempts {
+			redis.DelValue(key)
+		}
+		return common.CodeError, fmt.Sprintf("%s error", me.label())
+	}
+	redis.DelValue(key)
+	redis.DelValue(me.failKey(addr, purpose))
+	return common.Success, ""
+}
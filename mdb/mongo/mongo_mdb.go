@@ -75,9 +75,9 @@ func QueryPage(table string, page *common.PageDao, filter interface{}, sort inte
 	if err != nil {
 		mylog.Log.Errorln(err)
 	}
-	totalPages = int64(float32(totalCount)/float32(page.PageSize) + float32(0.5))
+	totalPages = common.CalcTotalPages(totalCount, page.PageSize)
 	//}
-	opt.SetSort(sort).SetSkip(int64((page.PageNo - 1) * page.PageSize)).SetLimit(int64(page.PageSize))
+	opt.SetSort(sort).SetSkip(page.Offset()).SetLimit(int64(page.PageSize))
 	cur, err := tbl.Find(context.TODO(), filter, opt)
 	if err != nil {
 		mylog.Log.Errorln(err)
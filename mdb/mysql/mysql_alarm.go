@@ -0,0 +1,526 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/redis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define alarm source
+const (
+	// 睡眠设备的告警事件, code为HeartEvent的类型
+	AlarmSourceSleep = "sleep"
+	// 跌倒检测的报警, code为报警事件
+	AlarmSourceFall = "fall"
+	// H03/T1学习设备的告警事件, code为事件编号
+	AlarmSourceStudy = "study"
+)
+
+// define alarm status
+const (
+	AlarmOpen         = 1
+	AlarmAcknowledged = 2
+	AlarmResolved     = 3
+)
+
+// 缺省的自动恢复时间, 单位秒
+const alarmAutoResolve = 600
+
+// 恢复事件, 收到时恢复对应的报警, 本身不产生报警. 如回到床上恢复离床报警
+var alarmClearEvents = map[string]map[int][]int{
+	AlarmSourceSleep: {
+		// 在床恢复离床
+		3012: {3001},
+		// 解除紧急拉绳
+		3009: {3008},
+	},
+}
+
+// 不产生报警的事件, 如学习设备的使用人落座
+var alarmIgnoreEvents = map[string]map[int]bool{
+	AlarmSourceStudy: {1: true},
+}
+
+// 同一设备的报警事件由各服务实例处理, 用redis锁串行处理, 避免重复打开
+const (
+	alarmLockPrefix = "alarm_lock_"
+	// 锁的过期时间, 单位秒, 持有锁的实例异常退出后自动释放
+	alarmLockSeconds = 10
+	// 等待锁的最长时间
+	alarmLockWait = 3 * time.Second
+)
+
+// swagger:model Alarm
+type Alarm struct {
+	ID         int64  `json:"id" mysql:"id"`
+	Mac        string `json:"mac" mysql:"mac"`
+	DeviceType string `json:"device_type" mysql:"device_type"`
+	// sleep:睡眠设备 fall:跌倒检测 study:学习设备
+	Source string `json:"source" mysql:"source"`
+	// 告警类型或事件编号
+	Code int `json:"code" mysql:"code"`
+	// 1:未处理 2:已确认 3:已恢复
+	Status int `json:"status" mysql:"status"`
+	// 未恢复期间发生的次数
+	Count    int    `json:"count" mysql:"count"`
+	OpenTime string `json:"open_time" mysql:"open_time"`
+	// 最近一次发生时间
+	LastTime string `json:"last_time" mysql:"last_time"`
+	// 确认的护理人员id
+	AckUserId int64   `json:"ack_user_id" mysql:"ack_user_id"`
+	AckTime   *string `json:"ack_time" mysql:"ack_time"`
+	AckNote   string  `json:"ack_note" mysql:"ack_note"`
+	// 手动恢复的用户id, 自动恢复时为0
+	ResolveUserId int64   `json:"resolve_user_id" mysql:"resolve_user_id"`
+	ResolveTime   *string `json:"resolve_time" mysql:"resolve_time"`
+	// 恢复原因或备注
+	ResolveNote string `json:"resolve_note" mysql:"resolve_note"`
+}
+
+func NewAlarm() *Alarm {
+	return &Alarm{
+		ID:            0,
+		Mac:           "",
+		DeviceType:    "",
+		Source:        "",
+		Code:          0,
+		Status:        AlarmOpen,
+		Count:         1,
+		OpenTime:      common.GetNowTime(),
+		LastTime:      common.GetNowTime(),
+		AckUserId:     0,
+		AckTime:       nil,
+		AckNote:       "",
+		ResolveUserId: 0,
+		ResolveTime:   nil,
+		ResolveNote:   "",
+	}
+}
+
+func (me *Alarm) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *Alarm) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.Mac, &me.DeviceType, &me.Source, &me.Code, &me.Status, &me.Count,
+		&me.OpenTime, &me.LastTime, &me.AckUserId, &me.AckTime, &me.AckNote,
+		&me.ResolveUserId, &me.ResolveTime, &me.ResolveNote)
+	return err
+}
+func (me *Alarm) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.Mac, &me.DeviceType, &me.Source, &me.Code, &me.Status, &me.Count,
+		&me.OpenTime, &me.LastTime, &me.AckUserId, &me.AckTime, &me.AckNote,
+		&me.ResolveUserId, &me.ResolveTime, &me.ResolveNote)
+	return err
+}
+func (me *Alarm) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.AlarmTbl, me.ID, me)
+}
+func (me *Alarm) Insert() bool {
+	tblName := common.AlarmTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			mac varchar(32) not null comment '设备mac',
+			device_type varchar(32) default '' comment '设备类型',
+			source varchar(16) not null comment '报警来源',
+			code int not null default 0 comment '告警类型或事件编号',
+			status int not null default 1 comment '1:未处理 2:已确认 3:已恢复',
+			count int not null default 1 comment '发生次数',
+			open_time datetime comment '报警时间',
+			last_time datetime comment '最近发生时间',
+			ack_user_id bigint default 0 comment '确认人id',
+			ack_time datetime default null comment '确认时间',
+			ack_note varchar(255) default '' comment '确认备注',
+			resolve_user_id bigint default 0 comment '手动恢复的用户id',
+			resolve_time datetime default null comment '恢复时间',
+			resolve_note varchar(255) default '' comment '恢复原因或备注',
+			PRIMARY KEY (id),
+			INDEX idx_mac_status (mac, status),
+			INDEX idx_status_last (status, last_time),
+			INDEX idx_open_time (open_time)
+		)`
+		CreateTable(sql)
+	}
+	// 备注由用户输入, 需要转义后才能拼接到sql中
+	obj := *me
+	obj.AckNote = common.EscapeSql(me.AckNote)
+	obj.ResolveNote = common.EscapeSql(me.ResolveNote)
+	if !InsertDao(tblName, &obj) {
+		return false
+	}
+	me.ID = obj.ID
+	return true
+}
+func (me *Alarm) Update() bool {
+	obj := *me
+	obj.AckNote = common.EscapeSql(me.AckNote)
+	obj.ResolveNote = common.EscapeSql(me.ResolveNote)
+	return UpdateDaoByID(common.AlarmTbl, me.ID, &obj)
+}
+func (me *Alarm) Delete() bool {
+	return DeleteDaoByID(common.AlarmTbl, me.ID)
+}
+func (me *Alarm) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryAlarmByCond(filter interface{}, page *common.PageDao, sort interface{}, results *[]Alarm) bool {
+	backFunc := func(rows *sql.Rows) {
+		obj := NewAlarm()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}
+	if page == nil {
+		return QueryDao(common.AlarmTbl, filter, sort, -1, backFunc, ReadPrimary)
+	}
+	return QueryPage(common.AlarmTbl, page, filter, sort, backFunc)
+}
+
+/******************************************************************************
+ * function: lockAlarmMac
+ * description: 取得设备报警的redis锁, 锁被其他实例持有时等待, 超时或者redis出错时返回false
+ * param {string} mac
+ * return {string} 锁的持有者标识, 释放时使用
+ * return {bool}
+********************************************************************************/
+func lockAlarmMac(mac string) (string, bool) {
+	owner, err := randomHex(8)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return "", false
+	}
+	key := alarmLockPrefix + strings.ToLower(mac)
+	deadline := time.Now().Add(alarmLockWait)
+	for {
+		ok, err := redis.SetValueNx(key, owner, alarmLockSeconds)
+		if err != nil {
+			mylog.Log.Errorln("lock alarm error:", err)
+			return "", false
+		}
+		if ok {
+			return owner, true
+		}
+		if time.Now().After(deadline) {
+			mylog.Log.Errorf("wait alarm lock of %s timeout", mac)
+			return "", false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// unlockAlarmMac 释放自己持有的锁, 锁已过期被其他实例取得时不释放
+func unlockAlarmMac(mac string, owner string) {
+	key := alarmLockPrefix + strings.ToLower(mac)
+	if v, _ := redis.GetValue(key); v == owner {
+		redis.DelValue(key)
+	}
+}
+
+/******************************************************************************
+ * function: raiseAlarm
+ * description: 设备事件产生报警. 恢复事件恢复对应的报警; 同一设备同一类型的报警未恢复时
+ * 只累加次数和最近发生时间, 否则打开新的报警. 多个服务实例用设备的redis锁串行处理,
+ * 取不到锁时仍然处理, 宁可重复打开报警也不丢失报警
+ * param {string} mac
+ * param {string} deviceType
+ * param {string} source
+ * param {int} code
+ * param {string} tm 事件时间
+ * return {*Alarm} 打开或累加的报警, 恢复事件和不产生报警的事件返回nil
+ * return {bool} 是否新打开的报警
+********************************************************************************/
+func raiseAlarm(mac string, deviceType string, source string, code int, tm string) (*Alarm, bool) {
+	if alarmIgnoreEvents[source][code] {
+		return nil, false
+	}
+	if owner, ok := lockAlarmMac(mac); ok {
+		defer unlockAlarmMac(mac, owner)
+	}
+	if codes, ok := alarmClearEvents[source][code]; ok {
+		resolveAlarmsByEvent(mac, source, codes, code, tm)
+		return nil, false
+	}
+	var alarms []Alarm
+	filter := fmt.Sprintf("mac='%s' and source='%s' and code=%d and status in (%d,%d)",
+		mac, source, code, AlarmOpen, AlarmAcknowledged)
+	QueryAlarmByCond(filter, nil, "id desc", &alarms)
+	// 只累加次数, 不覆盖同时发生的确认和恢复, 报警已经恢复时打开新的报警
+	if len(alarms) > 0 && countAlarm(alarms[0].ID, tm) {
+		alarm := &alarms[0]
+		alarm.Count++
+		alarm.LastTime = tm
+		return alarm, false
+	}
+	alarm := NewAlarm()
+	alarm.Mac = mac
+	alarm.DeviceType = deviceType
+	alarm.Source = source
+	alarm.Code = code
+	alarm.OpenTime = tm
+	alarm.LastTime = tm
+	if !alarm.Insert() {
+		return nil, false
+	}
+	mylog.Log.Infof("alarm %d opened, mac: %s, source: %s, code: %d", alarm.ID, mac, source, code)
+	startEscalation(alarm)
+	return alarm, true
+}
+
+// countAlarm 未恢复的报警累加次数和最近发生时间, 报警已经恢复时返回false
+func countAlarm(id int64, tm string) bool {
+	result, err := mDb.Exec(fmt.Sprintf("update %s set count=count+1, last_time=? where id=? and status in (%d,%d)",
+		common.AlarmTbl, AlarmOpen, AlarmAcknowledged), tm, id)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	count, _ := result.RowsAffected()
+	return count > 0
+}
+
+// resolveAlarmsByEvent 收到恢复事件时恢复设备未恢复的报警
+func resolveAlarmsByEvent(mac string, source string, codes []int, event int, tm string) {
+	codeList := make([]string, 0, len(codes))
+	for _, v := range codes {
+		codeList = append(codeList, fmt.Sprintf("%d", v))
+	}
+	var alarms []Alarm
+	filter := fmt.Sprintf("mac='%s' and source='%s' and code in (%s) and status in (%d,%d)",
+		mac, source, strings.Join(codeList, ","), AlarmOpen, AlarmAcknowledged)
+	QueryAlarmByCond(filter, nil, nil, &alarms)
+	for _, alarm := range alarms {
+		if !resolveOpenAlarm(alarm.ID, 0, tm, fmt.Sprintf("cleared by event %d", event)) {
+			continue
+		}
+		cancelEscalations(alarm.ID)
+		mylog.Log.Infof("alarm %d resolved by event %d", alarm.ID, event)
+	}
+}
+
+// resolveOpenAlarm 恢复未恢复的报警, 已经被其他请求恢复时返回false
+func resolveOpenAlarm(id int64, userId int64, tm string, note string) bool {
+	result, err := mDb.Exec(fmt.Sprintf("update %s set status=%d, resolve_user_id=?, resolve_time=?, resolve_note=? where id=? and status<>%d",
+		common.AlarmTbl, AlarmResolved, AlarmResolved), userId, tm, note, id)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	count, _ := result.RowsAffected()
+	return count > 0
+}
+
+/******************************************************************************
+ * function: autoResolveAlarms
+ * description: 没有恢复事件的报警, 超过自动恢复时间没有再次发生时自动恢复.
+ * 离床、紧急拉绳等有恢复事件的报警等待恢复事件. 未完成的升级在到期时发现报警已恢复后取消
+ * return {*}
+********************************************************************************/
+func autoResolveAlarms() {
+	if !CheckTableExist(common.AlarmTbl) {
+		return
+	}
+	seconds := cfg.This.Alarm.AutoResolve
+	if seconds <= 0 {
+		seconds = alarmAutoResolve
+	}
+	now := common.GetNowTime()
+	before := time.Now().Add(-time.Duration(seconds) * time.Second).Format(cfg.TmFmtStr)
+	conds := []string{fmt.Sprintf("status in (%d,%d) and last_time<'%s'", AlarmOpen, AlarmAcknowledged, before)}
+	for source, events := range alarmClearEvents {
+		var codes []string
+		for _, v := range events {
+			for _, code := range v {
+				codes = append(codes, fmt.Sprintf("%d", code))
+			}
+		}
+		conds = append(conds, fmt.Sprintf("not (source='%s' and code in (%s))", source, strings.Join(codes, ",")))
+	}
+	sqlStr := fmt.Sprintf("update %s set status=%d, resolve_time='%s', resolve_note='timeout' where %s",
+		common.AlarmTbl, AlarmResolved, now, strings.Join(conds, " and "))
+	result, err := mDb.Exec(sqlStr)
+	if err != nil {
+		mylog.Log.Errorln("auto resolve alarms error:", err)
+		return
+	}
+	if count, _ := result.RowsAffected(); count > 0 {
+		mylog.Log.Infof("%d alarms resolved by timeout", count)
+	}
+}
+
+/******************************************************************************
+ * function: AckAlarm
+ * description: 护理人员确认报警, 已经自动恢复但没有确认的报警也可以确认, 用于记录处理人.
+ * 按确认时间为空条件更新, 多人同时确认时只有一人成功
+ * param {int64} id
+ * param {int64} userId 确认人
+ * param {string} note
+ * return {*}
+********************************************************************************/
+func AckAlarm(id int64, userId int64, note string) (*Alarm, int, string) {
+	alarm := NewAlarm()
+	if !alarm.QueryByID(id) {
+		return nil, common.NoExist, "alarm not exist"
+	}
+	if alarm.AckTime != nil {
+		return nil, common.RepeatData, "alarm already acknowledged"
+	}
+	now := common.GetNowTime()
+	result, err := mDb.Exec(fmt.Sprintf("update %s set ack_user_id=?, ack_time=?, ack_note=?, status=if(status=%d,%d,status) where id=? and ack_time is null",
+		common.AlarmTbl, AlarmOpen, AlarmAcknowledged), userId, now, note, id)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, common.DBError, "acknowledge alarm failed"
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return nil, common.RepeatData, "alarm already acknowledged"
+	}
+	alarm.QueryByID(id)
+	cancelEscalations(id)
+	mylog.Log.Infof("alarm %d acknowledged by user %d", id, userId)
+	return alarm, common.Success, ""
+}
+
+/******************************************************************************
+ * function: ResolveAlarm
+ * description: 手动恢复报警, 如现场处理完成但设备没有上报恢复事件, 按未恢复条件更新
+ * param {int64} id
+ * param {int64} userId
+ * param {string} note
+ * return {*}
+********************************************************************************/
+func ResolveAlarm(id int64, userId int64, note string) (*Alarm, int, string) {
+	alarm := NewAlarm()
+	if !alarm.QueryByID(id) {
+		return nil, common.NoExist, "alarm not exist"
+	}
+	if alarm.Status == AlarmResolved {
+		return nil, common.RepeatData, "alarm already resolved"
+	}
+	if !resolveOpenAlarm(id, userId, common.GetNowTime(), note) {
+		return nil, common.RepeatData, "alarm already resolved"
+	}
+	alarm.QueryByID(id)
+	cancelEscalations(id)
+	mylog.Log.Infof("alarm %d resolved by user %d", id, userId)
+	return alarm, common.Success, ""
+}
+
+/******************************************************************************
+ * function: AlarmUserFilter
+ * description: 用户拥有或被共享的设备的报警
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func AlarmUserFilter(userId int64) string {
+	return fmt.Sprintf("mac in (select b.mac from %s b, %s c where b.id=c.device_id and c.user_id=%d)",
+		common.DeviceTbl, common.UserDeviceRelationTbl, userId)
+}
+
+/******************************************************************************
+ * function: AlarmOrgFilter
+ * description: 机构的设备的报警, 机构的设备为有效api key允许列表中的设备
+ * param {int64} orgId
+ * return {*}
+********************************************************************************/
+func AlarmOrgFilter(orgId int64) string {
+	var keys []ApiKey
+	QueryApiKeyByCond(fmt.Sprintf("org_id=%d and status=%d", orgId, ApiKeyActive), nil, &keys)
+	macs := make(map[string]bool)
+	for _, key := range keys {
+		for _, v := range strings.Split(key.Macs, ",") {
+			if v != "" {
+				macs[fmt.Sprintf("'%s'", common.EscapeSql(strings.ToLower(v)))] = true
+			}
+		}
+	}
+	if len(macs) == 0 {
+		return "1=0"
+	}
+	list := make([]string, 0, len(macs))
+	for v := range macs {
+		list = append(list, v)
+	}
+	return fmt.Sprintf("lower(mac) in (%s)", strings.Join(list, ","))
+}
+
+// swagger:model AlarmStats
+type AlarmStats struct {
+	// 报警来源, 为空时是全部来源的合计
+	Source   string `json:"source"`
+	Total    int    `json:"total"`
+	Acked    int    `json:"acked"`
+	Resolved int    `json:"resolved"`
+	// 平均确认时间, 单位秒, 只统计已确认的报警
+	Mtta int `json:"mtta"`
+	// 平均恢复时间, 单位秒, 只统计已恢复的报警
+	Mttr int `json:"mttr"`
+}
+
+/******************************************************************************
+ * function: StatAlarms
+ * description: 按来源统计报警数量和平均确认、恢复时间, 第一条为合计
+ * param {string} filter
+ * return {*}
+********************************************************************************/
+func StatAlarms(filter string, opts ...ReadOption) []AlarmStats {
+	total := AlarmStats{}
+	results := []AlarmStats{}
+	if !CheckTableExist(common.AlarmTbl) {
+		return append([]AlarmStats{total}, results...)
+	}
+	sqlStr := "select source, count(*), count(ack_time), count(resolve_time), " +
+		"avg(timestampdiff(second, open_time, ack_time)), avg(timestampdiff(second, open_time, resolve_time)) from " +
+		common.AlarmTbl
+	if filter != "" {
+		sqlStr += " where " + filter
+	}
+	sqlStr += " group by source order by source"
+	mylog.Log.Debugln(sqlStr)
+	rows, err := readDBFor(opts).Query(sqlStr)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return append([]AlarmStats{total}, results...)
+	}
+	defer rows.Close()
+	var ackSum, resolveSum float64
+	for rows.Next() {
+		var obj AlarmStats
+		var mtta, mttr sql.NullFloat64
+		if err := rows.Scan(&obj.Source, &obj.Total, &obj.Acked, &obj.Resolved, &mtta, &mttr); err != nil {
+			mylog.Log.Errorln(err)
+			continue
+		}
+		obj.Mtta = int(mtta.Float64)
+		obj.Mttr = int(mttr.Float64)
+		total.Total += obj.Total
+		total.Acked += obj.Acked
+		total.Resolved += obj.Resolved
+		ackSum += mtta.Float64 * float64(obj.Acked)
+		resolveSum += mttr.Float64 * float64(obj.Resolved)
+		results = append(results, obj)
+	}
+	if total.Acked > 0 {
+		total.Mtta = int(ackSum / float64(total.Acked))
+	}
+	if total.Resolved > 0 {
+		total.Mttr = int(resolveSum / float64(total.Resolved))
+	}
+	return append([]AlarmStats{total}, results...)
+}
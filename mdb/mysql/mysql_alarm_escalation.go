@@ -0,0 +1,308 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/exception"
+	"hjyserver/gopool"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/notify"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define escalation status
+const (
+	EscalationPending   = 0
+	EscalationFinished  = 1
+	EscalationCancelled = 2
+)
+
+// 执行中的升级先占用一段时间, 避免多个服务实例重复执行
+const escalationLease = 2 * time.Minute
+
+// swagger:model AlarmEscalation
+type AlarmEscalation struct {
+	ID      int64 `json:"id" mysql:"id"`
+	AlarmId int64 `json:"alarm_id" mysql:"alarm_id"`
+	// 升级策略名称
+	Policy string `json:"policy" mysql:"policy"`
+	// 下一级, 从0开始
+	Step int `json:"step" mysql:"step"`
+	// 0:等待执行 1:已完成 2:已取消
+	Status     int    `json:"status" mysql:"status"`
+	NextTime   string `json:"next_time" mysql:"next_time"`
+	CreateTime string `json:"create_time" mysql:"create_time"`
+	UpdateTime string `json:"update_time" mysql:"update_time"`
+}
+
+func NewAlarmEscalation() *AlarmEscalation {
+	return &AlarmEscalation{
+		ID:         0,
+		AlarmId:    0,
+		Policy:     "",
+		Step:       0,
+		Status:     EscalationPending,
+		NextTime:   common.GetNowTime(),
+		CreateTime: common.GetNowTime(),
+		UpdateTime: common.GetNowTime(),
+	}
+}
+
+func (me *AlarmEscalation) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *AlarmEscalation) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.AlarmId, &me.Policy, &me.Step, &me.Status, &me.NextTime, &me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *AlarmEscalation) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.AlarmId, &me.Policy, &me.Step, &me.Status, &me.NextTime, &me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *AlarmEscalation) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.AlarmEscalationTbl, me.ID, me)
+}
+func (me *AlarmEscalation) Insert() bool {
+	tblName := common.AlarmEscalationTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			alarm_id bigint not null comment '报警id',
+			policy varchar(64) not null comment '升级策略',
+			step int not null default 0 comment '下一级',
+			status int not null default 0 comment '0:等待执行 1:已完成 2:已取消',
+			next_time datetime comment '下一级执行时间',
+			create_time datetime comment '创建时间',
+			update_time datetime comment '更新时间',
+			PRIMARY KEY (id),
+			INDEX idx_alarm_id (alarm_id),
+			INDEX idx_status_next (status, next_time)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *AlarmEscalation) Update() bool {
+	return UpdateDaoByID(common.AlarmEscalationTbl, me.ID, me)
+}
+func (me *AlarmEscalation) Delete() bool {
+	return DeleteDaoByID(common.AlarmEscalationTbl, me.ID)
+}
+func (me *AlarmEscalation) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryAlarmEscalationByCond(filter interface{}, sort interface{}, limited int, results *[]AlarmEscalation) bool {
+	return QueryDao(common.AlarmEscalationTbl, filter, sort, limited, func(rows *sql.Rows) {
+		obj := NewAlarmEscalation()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, ReadPrimary)
+}
+
+// escalationPolicy 按名称查找配置的升级策略
+func escalationPolicy(name string) *cfg.EscalationPolicy {
+	for i := range cfg.This.Alarm.Escalations {
+		if cfg.This.Alarm.Escalations[i].Name == name {
+			return &cfg.This.Alarm.Escalations[i]
+		}
+	}
+	return nil
+}
+
+// escalationPolicyFor 报警适用的升级策略, 按配置顺序匹配 来源.类型 或 来源
+func escalationPolicyFor(alarm *Alarm) *cfg.EscalationPolicy {
+	key := fmt.Sprintf("%s.%d", alarm.Source, alarm.Code)
+	for i := range cfg.This.Alarm.Escalations {
+		policy := &cfg.This.Alarm.Escalations[i]
+		for _, v := range policy.Alarms {
+			if (v == key || v == alarm.Source) && len(policy.Steps) > 0 {
+				return policy
+			}
+		}
+	}
+	return nil
+}
+
+// stepTime 升级策略中某一级的执行时间, 从报警时间开始计算
+func stepTime(alarm *Alarm, step cfg.EscalationStep) time.Time {
+	openTime, err := time.ParseInLocation(cfg.TmFmtStr, alarm.OpenTime, time.Local)
+	if err != nil {
+		openTime = time.Now()
+	}
+	return openTime.Add(time.Duration(step.After) * time.Second)
+}
+
+/******************************************************************************
+ * function: startEscalation
+ * description: 新打开的报警有适用的升级策略时保存升级状态, 到期的第一级立即执行
+ * param {*Alarm} alarm
+ * return {*}
+********************************************************************************/
+func startEscalation(alarm *Alarm) {
+	policy := escalationPolicyFor(alarm)
+	if policy == nil {
+		return
+	}
+	escalation := NewAlarmEscalation()
+	escalation.AlarmId = alarm.ID
+	escalation.Policy = policy.Name
+	escalation.NextTime = stepTime(alarm, policy.Steps[0]).Format(cfg.TmFmtStr)
+	if !escalation.Insert() {
+		return
+	}
+	mylog.Log.Infof("alarm %d escalation started by policy %s", alarm.ID, policy.Name)
+	if policy.Steps[0].After <= 0 {
+		GetTaskPool().Put(&gopool.Task{
+			Params: []interface{}{escalation.ID},
+			Do: func(params ...interface{}) {
+				id := params[0].(int64)
+				if claimEscalation(id) {
+					obj := NewAlarmEscalation()
+					if obj.QueryByID(id) {
+						processEscalation(obj)
+					}
+				}
+			},
+		})
+	}
+}
+
+/******************************************************************************
+ * function: cancelEscalations
+ * description: 报警确认或恢复时取消未完成的升级
+ * param {int64} alarmId
+ * return {*}
+********************************************************************************/
+func cancelEscalations(alarmId int64) {
+	if !CheckTableExist(common.AlarmEscalationTbl) {
+		return
+	}
+	sql := fmt.Sprintf("update %s set status=?, update_time=? where alarm_id=? and status=?", common.AlarmEscalationTbl)
+	if _, err := mDb.Exec(sql, EscalationCancelled, common.GetNowTime(), alarmId, EscalationPending); err != nil {
+		mylog.Log.Errorln(err)
+	}
+}
+
+// claimEscalation 把到期的升级占用一段时间, 多个服务实例时只有一个能执行
+func claimEscalation(id int64) bool {
+	now := time.Now()
+	sql := fmt.Sprintf("update %s set next_time=? where id=? and status=? and next_time<=?", common.AlarmEscalationTbl)
+	result, err := mDb.Exec(sql, now.Add(escalationLease).Format(cfg.TmFmtStr), id, EscalationPending, now.Format(cfg.TmFmtStr))
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	n, err := result.RowsAffected()
+	return err == nil && n == 1
+}
+
+/******************************************************************************
+ * function: advanceEscalation
+ * description: 按执行前的级别和等待执行状态条件更新升级, 升级已经被取消或者被其他实例推进时不更新
+ * param {*AlarmEscalation} escalation 执行前的升级
+ * param {int} step 下一级
+ * param {int} status
+ * param {string} nextTime
+ * return {*} 是否更新成功
+********************************************************************************/
+func advanceEscalation(escalation *AlarmEscalation, step int, status int, nextTime string) bool {
+	sql := fmt.Sprintf("update %s set step=?, status=?, next_time=?, update_time=? where id=? and step=? and status=?",
+		common.AlarmEscalationTbl)
+	result, err := mDb.Exec(sql, step, status, nextTime, common.GetNowTime(), escalation.ID, escalation.Step, EscalationPending)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n != 1 {
+		mylog.Log.Infof("escalation %d changed by others, skip update", escalation.ID)
+		return false
+	}
+	return true
+}
+
+/******************************************************************************
+ * function: processEscalation
+ * description: 执行升级的当前一级, 通知设备的所有用户, 然后安排下一级.
+ * 报警已经确认或恢复、策略已经删除时取消
+ * param {*AlarmEscalation} escalation
+ * return {*}
+********************************************************************************/
+func processEscalation(escalation *AlarmEscalation) {
+	alarm := NewAlarm()
+	policy := escalationPolicy(escalation.Policy)
+	if !alarm.QueryByID(escalation.AlarmId) || alarm.Status != AlarmOpen || policy == nil {
+		advanceEscalation(escalation, escalation.Step, EscalationCancelled, escalation.NextTime)
+		return
+	}
+	if escalation.Step >= len(policy.Steps) {
+		advanceEscalation(escalation, escalation.Step, EscalationFinished, escalation.NextTime)
+		return
+	}
+	step := policy.Steps[escalation.Step]
+	var userDevices []UserDeviceDetail
+	QueryUserDeviceDetailByMac(alarm.Mac, &userDevices)
+	for _, userDevice := range userDevices {
+		notify.NotifyVia(userDevice.UserId, &notify.Event{
+			// 同一级通知多个用户时相同, webhook只推送一次
+			ID:         fmt.Sprintf("alarm_%d_%d", alarm.ID, escalation.Step),
+			Type:       notify.EventAlarmEscalation,
+			AlarmId:    alarm.ID,
+			Mac:        alarm.Mac,
+			DeviceType: alarm.DeviceType,
+			NickName:   userDevice.NickName,
+			DeviceName: userDevice.DeviceName,
+			Title:      alarm.Source,
+			Code:       alarm.Code,
+			Status:     escalation.Step + 1,
+			CreateTime: alarm.OpenTime,
+			Data:       alarm,
+		}, step.Chains)
+	}
+	mylog.Log.Infof("alarm %d escalated to step %d of policy %s", alarm.ID, escalation.Step+1, policy.Name)
+	nextStep := escalation.Step + 1
+	if nextStep >= len(policy.Steps) {
+		advanceEscalation(escalation, nextStep, EscalationFinished, escalation.NextTime)
+		return
+	}
+	next := stepTime(alarm, policy.Steps[nextStep])
+	if next.Before(time.Now()) {
+		next = time.Now()
+	}
+	advanceEscalation(escalation, nextStep, EscalationPending, next.Format(cfg.TmFmtStr))
+}
+
+/******************************************************************************
+ * function: RunAlarmEscalations
+ * description: 定时执行到期的升级
+ * return {*}
+********************************************************************************/
+func RunAlarmEscalations() {
+	if !CheckTableExist(common.AlarmEscalationTbl) {
+		return
+	}
+	var escalations []AlarmEscalation
+	QueryAlarmEscalationByCond(fmt.Sprintf("status=%d and next_time<='%s'", EscalationPending, common.GetNowTime()),
+		"next_time", 100, &escalations)
+	for i := range escalations {
+		escalation := &escalations[i]
+		if !claimEscalation(escalation.ID) {
+			continue
+		}
+		processEscalation(escalation)
+	}
+}
@@ -0,0 +1,399 @@
+package mysql
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define api key scope
+const (
+	// 读取实时生命体征
+	ScopeVitalsRead = "vitals:read"
+	// 读取睡眠和学习报告
+	ScopeReportsRead = "reports:read"
+	// 读取和接收报警
+	ScopeAlarmsReceive = "alarms:receive"
+	// 控制设备
+	ScopeDevicesControl = "devices:control"
+)
+
+var apiKeyScopes = []string{ScopeVitalsRead, ScopeReportsRead, ScopeAlarmsReceive, ScopeDevicesControl}
+
+// define api key status
+const (
+	ApiKeyRevoked = 0
+	ApiKeyActive  = 1
+)
+
+// api key格式为 hjy_<prefix>_<secret>, prefix用于查找记录
+const apiKeyHead = "hjy_"
+
+// swagger:model Organization
+type Organization struct {
+	ID      int64  `json:"id" mysql:"id"`
+	Name    string `json:"name" mysql:"name"`
+	Contact string `json:"contact" mysql:"contact"`
+	Phone   string `json:"phone" mysql:"phone"`
+	Remark  string `json:"remark" mysql:"remark"`
+	// 创建机构的管理员id
+	OperatorId int64  `json:"operator_id" mysql:"operator_id"`
+	CreateTime string `json:"create_time" mysql:"create_time"`
+}
+
+func NewOrganization() *Organization {
+	return &Organization{
+		ID:         0,
+		Name:       "",
+		Contact:    "",
+		Phone:      "",
+		Remark:     "",
+		OperatorId: 0,
+		CreateTime: common.GetNowTime(),
+	}
+}
+
+func (me *Organization) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *Organization) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.Name, &me.Contact, &me.Phone, &me.Remark, &me.OperatorId, &me.CreateTime)
+	return err
+}
+func (me *Organization) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.Name, &me.Contact, &me.Phone, &me.Remark, &me.OperatorId, &me.CreateTime)
+	return err
+}
+func (me *Organization) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.OrganizationTbl, me.ID, me)
+}
+func (me *Organization) Insert() bool {
+	tblName := common.OrganizationTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id MEDIUMINT NOT NULL AUTO_INCREMENT,
+			name varchar(128) not null comment '机构名称',
+			contact varchar(64) default '' comment '联系人',
+			phone varchar(32) default '' comment '联系电话',
+			remark varchar(255) default '' comment '备注',
+			operator_id bigint default 0 comment '创建机构的管理员id',
+			create_time datetime comment '创建时间',
+			PRIMARY KEY (id)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *Organization) Update() bool {
+	return UpdateDaoByID(common.OrganizationTbl, me.ID, me)
+}
+func (me *Organization) Delete() bool {
+	return DeleteDaoByID(common.OrganizationTbl, me.ID)
+}
+func (me *Organization) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryOrganizationByCond(filter interface{}, sort interface{}, results *[]Organization) bool {
+	return QueryDao(common.OrganizationTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewOrganization()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	})
+}
+
+// swagger:model ApiKey
+type ApiKey struct {
+	ID    int64  `json:"id" mysql:"id"`
+	OrgId int64  `json:"org_id" mysql:"org_id"`
+	Name  string `json:"name" mysql:"name"`
+	// 明文key的前缀, 用于查找和显示
+	KeyPrefix string `json:"key_prefix" mysql:"key_prefix"`
+	// 明文key的sha256, 不对外返回
+	KeyHash string `json:"-" mysql:"key_hash"`
+	// 授权范围, 逗号分隔
+	Scopes string `json:"scopes" mysql:"scopes"`
+	// 允许访问的设备mac, 逗号分隔
+	Macs string `json:"macs" mysql:"macs"`
+	// 每分钟最多请求数, 0使用缺省限额
+	RateLimit int `json:"rate_limit" mysql:"rate_limit"`
+	// 0:已撤销 1:有效
+	Status       int    `json:"status" mysql:"status"`
+	OperatorId   int64  `json:"operator_id" mysql:"operator_id"`
+	CreateTime   string `json:"create_time" mysql:"create_time"`
+	LastUsedTime string `json:"last_used_time" mysql:"last_used_time"`
+	RevokeTime   string `json:"revoke_time" mysql:"revoke_time"`
+}
+
+func NewApiKey() *ApiKey {
+	return &ApiKey{
+		ID:           0,
+		OrgId:        0,
+		Name:         "",
+		KeyPrefix:    "",
+		KeyHash:      "",
+		Scopes:       "",
+		Macs:         "",
+		RateLimit:    0,
+		Status:       ApiKeyActive,
+		OperatorId:   0,
+		CreateTime:   common.GetNowTime(),
+		LastUsedTime: common.GetNowTime(),
+		RevokeTime:   common.GetNowTime(),
+	}
+}
+
+func (me *ApiKey) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *ApiKey) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.OrgId, &me.Name, &me.KeyPrefix, &me.KeyHash, &me.Scopes, &me.Macs,
+		&me.RateLimit, &me.Status, &me.OperatorId, &me.CreateTime, &me.LastUsedTime, &me.RevokeTime)
+	return err
+}
+func (me *ApiKey) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.OrgId, &me.Name, &me.KeyPrefix, &me.KeyHash, &me.Scopes, &me.Macs,
+		&me.RateLimit, &me.Status, &me.OperatorId, &me.CreateTime, &me.LastUsedTime, &me.RevokeTime)
+	return err
+}
+func (me *ApiKey) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.ApiKeyTbl, me.ID, me)
+}
+func (me *ApiKey) Insert() bool {
+	tblName := common.ApiKeyTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id MEDIUMINT NOT NULL AUTO_INCREMENT,
+			org_id bigint not null comment '机构id',
+			name varchar(128) default '' comment '名称',
+			key_prefix varchar(16) not null comment 'key前缀',
+			key_hash varchar(64) not null comment 'key的sha256',
+			scopes varchar(255) default '' comment '授权范围',
+			macs text comment '允许访问的设备mac',
+			rate_limit int default 0 comment '每分钟最多请求数',
+			status int not null default 1 comment '0:已撤销 1:有效',
+			operator_id bigint default 0 comment '创建key的管理员id',
+			create_time datetime comment '创建时间',
+			last_used_time datetime comment '最近使用时间',
+			revoke_time datetime comment '撤销时间',
+			PRIMARY KEY (id),
+			UNIQUE KEY uk_key_prefix (key_prefix),
+			KEY idx_org_id (org_id)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *ApiKey) Update() bool {
+	return UpdateDaoByID(common.ApiKeyTbl, me.ID, me)
+}
+func (me *ApiKey) Delete() bool {
+	return DeleteDaoByID(common.ApiKeyTbl, me.ID)
+}
+func (me *ApiKey) SetID(id int64) {
+	me.ID = id
+}
+
+// HasScope 检查key是否有指定的授权范围
+func (me *ApiKey) HasScope(scope string) bool {
+	for _, v := range strings.Split(me.Scopes, ",") {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowMac 检查设备是否在key的允许列表中
+func (me *ApiKey) AllowMac(mac string) bool {
+	for _, v := range strings.Split(me.Macs, ",") {
+		if v != "" && strings.EqualFold(v, mac) {
+			return true
+		}
+	}
+	return false
+}
+
+func QueryApiKeyByCond(filter interface{}, sort interface{}, results *[]ApiKey) bool {
+	return QueryDao(common.ApiKeyTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewApiKey()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, ReadPrimary)
+}
+
+// IsValidScope 检查授权范围是否有效
+func IsValidScope(scope string) bool {
+	for _, v := range apiKeyScopes {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseApiKeyPrefix 取得明文key中的前缀, 格式不对时返回false
+func ParseApiKeyPrefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, apiKeyHead) {
+		return "", false
+	}
+	parts := strings.SplitN(key[len(apiKeyHead):], "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+/******************************************************************************
+ * function: CreateApiKey
+ * description: 为机构创建api key, 返回的明文key只有这一次
+ * param {*ApiKey} me 已经设置机构、名称、授权范围、设备和限额
+ * return {*} 明文key
+********************************************************************************/
+func CreateApiKey(me *ApiKey) (string, bool) {
+	prefix, err := randomHex(4)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return "", false
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return "", false
+	}
+	key := apiKeyHead + prefix + "_" + secret
+	me.KeyPrefix = prefix
+	me.KeyHash = hashApiKey(key)
+	me.Status = ApiKeyActive
+	me.CreateTime = common.GetNowTime()
+	me.LastUsedTime = me.CreateTime
+	me.RevokeTime = me.CreateTime
+	if !me.Insert() {
+		return "", false
+	}
+	return key, true
+}
+
+/******************************************************************************
+ * function: VerifyApiKey
+ * description: 校验明文key, 返回有效的key记录
+ * param {string} key
+ * return {*}
+********************************************************************************/
+func VerifyApiKey(key string) (*ApiKey, bool) {
+	prefix, ok := ParseApiKeyPrefix(key)
+	if !ok {
+		return nil, false
+	}
+	var keys []ApiKey
+	QueryApiKeyByCond(fmt.Sprintf("key_prefix='%s' and status=%d", common.EscapeSql(prefix), ApiKeyActive), nil, &keys)
+	if len(keys) == 0 {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(keys[0].KeyHash), []byte(hashApiKey(key))) != 1 {
+		return nil, false
+	}
+	return &keys[0], true
+}
+
+// RevokeApiKey 撤销api key, 撤销后立即失效
+func RevokeApiKey(id int64) bool {
+	me := NewApiKey()
+	if !me.QueryByID(id) {
+		return false
+	}
+	me.Status = ApiKeyRevoked
+	me.RevokeTime = common.GetNowTime()
+	return me.Update()
+}
+
+// swagger:model ApiKeyUsage
+type ApiKeyUsage struct {
+	KeyId    int64  `json:"key_id"`
+	StatDate string `json:"stat_date"`
+	Route    string `json:"route"`
+	Count    int64  `json:"count"`
+}
+
+/******************************************************************************
+ * function: RecordApiKeyUsage
+ * description: 按天和接口统计key的调用次数, 同时更新最近使用时间
+ * param {int64} keyId
+ * param {string} route
+ * return {*}
+********************************************************************************/
+func RecordApiKeyUsage(keyId int64, route string) {
+	tblName := common.ApiKeyUsageTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			key_id bigint not null comment 'api key id',
+			stat_date date not null comment '统计日期',
+			route varchar(128) not null comment '接口',
+			count bigint not null default 0 comment '调用次数',
+			PRIMARY KEY (key_id, stat_date, route)
+		)`
+		CreateTable(sql)
+	}
+	now := time.Now()
+	sql := fmt.Sprintf("insert into %s (key_id, stat_date, route, count) values (?, ?, ?, 1) "+
+		"on duplicate key update count=count+1", tblName)
+	if _, err := mDb.Exec(sql, keyId, now.Format(cfg.DateFmtStr), route); err != nil {
+		mylog.Log.Errorln("record api key usage error:", err)
+	}
+	sql = fmt.Sprintf("update %s set last_used_time=? where id=?", common.ApiKeyTbl)
+	if _, err := mDb.Exec(sql, now.Format(cfg.TmFmtStr), keyId); err != nil {
+		mylog.Log.Errorln("update api key last used time error:", err)
+	}
+}
+
+/******************************************************************************
+ * function: QueryApiKeyUsage
+ * description: 查询key从指定日期开始的调用统计
+ * param {int64} keyId
+ * param {string} fromDate
+ * return {*}
+********************************************************************************/
+func QueryApiKeyUsage(keyId int64, fromDate string) []ApiKeyUsage {
+	results := make([]ApiKeyUsage, 0)
+	QueryDao(common.ApiKeyUsageTbl, fmt.Sprintf("key_id=%d and stat_date>='%s'", keyId, common.EscapeSql(fromDate)),
+		"stat_date desc, route", -1, func(rows *sql.Rows) {
+			var obj ApiKeyUsage
+			if err := rows.Scan(&obj.KeyId, &obj.StatDate, &obj.Route, &obj.Count); err != nil {
+				mylog.Log.Errorln(err)
+				return
+			}
+			results = append(results, obj)
+		})
+	return results
+}
@@ -229,9 +229,15 @@ func handleRealDataMqttMsg(mac string, payload []byte) {
 	if heartObj.ActiveStatus == 3 && heartObj.PersonStatus == 3 {
 		heartObj.StagesStatus = 3
 	}
+	// 每次上报都按用户的规则判断, 不受去重影响
+	EvaluateMetricRules(mac, Ed713Type, map[string]int{
+		RuleMetricHeartRate:   realDataSql.HeartRate,
+		RuleMetricRespiratory: realDataSql.RespiratoryRate,
+		RuleMetricBodyStatus:  realDataSql.BodyStatus,
+	})
 	if CheckDiffBetweenTwoSleepDeviceRecords(Ed713Type, mac, heartObj) {
 		// mq.PublishData("ed713/realdata/test", heartObj)
-		mq.PublishData(common.MakeHeartRateTopic(mac), heartObj)
+		publishDeviceData(mac, common.MakeHeartRateTopic(mac), heartObj)
 		taskPool.Put(&gopool.Task{
 			Params: []interface{}{realDataSql},
 			Do: func(params ...interface{}) {
@@ -487,6 +493,17 @@ func handleDayReportMqttMsg(mac string, payload []byte) {
 				}
 				dayReportSql.Insert()
 			}
+			EmitWebhookEvent(WebhookSleepReportReady, mac, &WebhookSleepReport{
+				SleepStartTime: dayReportSql.SleepStartTime,
+				SleepEndTime:   dayReportSql.SleepEndTime,
+				Evaluation:     dayReportSql.Evaluation,
+			})
+			notifySleepReport(mac, dayReportSql.SleepStartTime, dayReportSql.SleepEndTime, dayReportSql.Evaluation, &SleepReportNotify{
+				GoBedTime:       dayReportSql.GoBedTime,
+				LeaveBedTime:    dayReportSql.LeaveBedTime,
+				BaseRespiratory: dayReportSql.BaseRespiratory,
+				BaseHeartRate:   dayReportSql.BaseHeartRate,
+			})
 		},
 		Catch: func(e exception.Exception) {
 			mylog.Log.Errorln("handleDayReportMqttMsg catch exception, err:", e.Error())
@@ -660,7 +677,7 @@ func (me *Ed713DayReportSql) Delete() bool {
  * param {*[]Ed713DayReportSql} results
  * return {*}
 ********************************************************************************/
-func QueryEd713DayReportByMacAndTime(mac string, startTime, endTime string, results *[]Ed713DayReportSql) bool {
+func QueryEd713DayReportByMacAndTime(mac string, startTime, endTime string, results *[]Ed713DayReportSql, opts ...ReadOption) bool {
 	filter := fmt.Sprintf("mac='%s' and date(sleep_end_time)>=date('%s') and date(sleep_end_time)<=date('%s') and sleep_periodization > 0", mac, startTime, endTime)
 	backFunc := func(rows *sql.Rows) {
 		obj := NewEd713DayReportSql()
@@ -671,13 +688,13 @@ func QueryEd713DayReportByMacAndTime(mac string, startTime, endTime string, resu
 			*results = append(*results, *obj)
 		}
 	}
-	return QueryDao(NewEd713DayReportSql().myTable(), filter, "periodization_time", -1, backFunc)
+	return QueryDao(NewEd713DayReportSql().myTable(), filter, "periodization_time", -1, backFunc, opts...)
 }
-func QueryEd713DateListInReport(mac, startTime, endTime string, results *[]string) bool {
+func QueryEd713DateListInReport(mac, startTime, endTime string, results *[]string, opts ...ReadOption) bool {
 	filter := fmt.Sprintf("mac='%s' and date(sleep_end_time)>=date('%s') and date(sleep_end_time)<=date('%s') and sleep_periodization > 0", mac, startTime, endTime)
 	sql := "select distinct date(sleep_end_time) from " + NewEd713DayReportSql().myTable() + " where " + filter
 	sql += " order by date(sleep_end_time)"
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -733,13 +750,25 @@ func handlerEventMqttMsg(mac string, payload []byte) {
 	heartEvent.HeartRate = eventJson.HeartRate
 	heartEvent.RespiratoryRate = eventJson.RepiratoryRate
 	heartEvent.CreateTime = eventSql.CreateTime
+	EmitWebhookEvent(WebhookAlarmRaised, mac, &WebhookAlarm{
+		Type:            heartEvent.Type,
+		Status:          1,
+		HeartRate:       heartEvent.HeartRate,
+		RespiratoryRate: heartEvent.RespiratoryRate,
+		CreateTime:      heartEvent.CreateTime,
+	})
+	raiseAlarm(mac, Ed713Type, AlarmSourceSleep, heartEvent.Type, heartEvent.CreateTime)
 	var userDevices []UserDeviceDetail
 	QueryUserDeviceDetailByMac(mac, &userDevices)
 	if len(userDevices) > 0 {
 		heartEvent.UserDeviceDetail = userDevices[0]
-		mq.PublishData(common.MakeHeartEventTopic(mac), heartEvent)
-		// send sms
-		SendSleepAlarmSms(heartEvent)
+		publishDeviceData(mac, common.MakeHeartEventTopic(mac), heartEvent)
+		// 通知用户
+		eventId := common.GenerateUUID()
+		for _, userDevice := range userDevices {
+			heartEvent.UserDeviceDetail = userDevice
+			notifySleepAlarm(eventId, heartEvent)
+		}
 	}
 }
 
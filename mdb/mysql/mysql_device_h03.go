@@ -16,6 +16,7 @@ import (
 	mylog "hjyserver/log"
 	"hjyserver/mdb/common"
 	"hjyserver/mq"
+	"hjyserver/notify"
 	"hjyserver/redis"
 	"math"
 	"strconv"
@@ -667,7 +668,20 @@ func handleH03Attr(mqttMsg *H03MqttMsg) {
 	// } else {
 	// 	attrData.Insert()
 	// }
-	mq.PublishData(MakeStudyAttrTopic(attrData.Mac), attrData)
+	publishDeviceData(attrData.Mac, MakeStudyAttrTopic(attrData.Mac), attrData)
+	// 按用户的规则判断本次上报的指标
+	metrics := make(map[string]int)
+	for key := range mapData {
+		switch key {
+		case "respiratory":
+			metrics[RuleMetricRespiratory] = attrData.Respiratory
+		case "heart_rate":
+			metrics[RuleMetricHeartRate] = attrData.HeartRate
+		case "study_time":
+			metrics[RuleMetricStudyTime] = attrData.LowStudyTime + attrData.MidStudyTime + attrData.DeepStudyTime
+		}
+	}
+	EvaluateMetricRules(attrData.Mac, H03Type, metrics)
 
 	// 数据库操作因为会出现性能延迟，所以采用队列处理
 	// 队列处理
@@ -853,7 +867,7 @@ func QueryH03AttrDataByMac(mac string, limited int, results *[]H03AttrData) bool
  * return {*}
 ********************************************************************************/
 func QueryH03AttrDataByMacAndDay(mac string, startDay string, endDay string, results *[]H03AttrData) bool {
-	filter := fmt.Sprintf("mac='%s' and date(create_time)>='%s' and date(create_time)<='%s'", mac, startDay, endDay)
+	filter := fmt.Sprintf("mac='%s' and %s", mac, dayRangeFilter("create_time", startDay, endDay))
 	QueryDao(NewH03AttrData().TableName(), filter, "create_time desc", -1, func(rows *sql.Rows) {
 		obj := NewH03AttrData()
 		err := obj.DecodeFromRows(rows)
@@ -957,7 +971,18 @@ func handleH03Event(mqttMsg *H03MqttMsg) {
 	// 先更新到redis中,在没有MQ通知之前不更新到数据库，避免数据库压力，提高MQ通知的效率
 	redis.SaveValueToHash(hashKey, hashFiled, nil, eventData)
 	// 通知event事件
-	mq.PublishData(MakeStudyEventTopic(eventData.Mac), eventData)
+	publishDeviceData(eventData.Mac, MakeStudyEventTopic(eventData.Mac), eventData)
+	// 按用户的规则判断本次上报的指标
+	metrics := make(map[string]int)
+	for key := range dataMap {
+		switch key {
+		case "body_status":
+			metrics[RuleMetricBodyStatus] = eventData.BodyStatus
+		case "flow_state":
+			metrics[RuleMetricConcentration] = eventData.FlowState
+		}
+	}
+	EvaluateMetricRules(eventData.Mac, H03Type, metrics)
 	// 数据库处理因为会出现性能延迟，所以采用队列处理
 	// 队列处理
 	GetTaskPool().Put(&gopool.Task{
@@ -975,6 +1000,7 @@ func handleH03Event(mqttMsg *H03MqttMsg) {
 	})
 	// 向微信通知告警事件
 	if eventData.WarningEvent > 0 {
+		raiseAlarm(eventData.Mac, H03Type, AlarmSourceStudy, eventData.WarningEvent, eventData.CreateTime)
 		switchSettings := make([]H03ReportSwitchSetting, 0)
 		QueryH03ReportSwitchSetting(eventData.Mac, &switchSettings)
 		if len(switchSettings) == 0 {
@@ -1014,20 +1040,23 @@ func handleH03Event(mqttMsg *H03MqttMsg) {
 					StatH03WarningEventNotifyWeekly(obj.Mac, obj.WarningEvent, obj.CreateTime)
 				},
 			})
-			// 通知公众号
+			// 按路由通知用户
+			eventId := common.GenerateUUID()
 			for _, userDevice := range userDevices {
-				if H03ReportNotify != nil {
-					status, _ := H03ReportNotify.NotifyWarningEventToOfficalAccount(
-						userDevice.UserId,
-						userDevice.NickName,
-						eventData.Mac,
-						eventData.CreateTime,
-						eventData.WarningEvent)
-					if status == common.Success {
-						mylog.Log.Debugf("notify warning event to offical account success, mac: %s, event: %d", eventData.Mac, eventData.WarningEvent)
-					} else {
-						mylog.Log.Errorf("notify warning event to offical account failed, mac: %s, event: %d", eventData.Mac, eventData.WarningEvent)
-					}
+				delivered := notify.Notify(userDevice.UserId, &notify.Event{
+					ID:         eventId,
+					Type:       notify.EventStudyWarning,
+					Mac:        eventData.Mac,
+					DeviceType: H03Type,
+					NickName:   userDevice.NickName,
+					DeviceName: userDevice.DeviceName,
+					Code:       eventData.WarningEvent,
+					CreateTime: eventData.CreateTime,
+				})
+				if delivered {
+					mylog.Log.Debugf("notify warning event success, mac: %s, event: %d", eventData.Mac, eventData.WarningEvent)
+				} else {
+					mylog.Log.Errorf("notify warning event failed, mac: %s, event: %d", eventData.Mac, eventData.WarningEvent)
 				}
 			}
 		}
@@ -1141,7 +1170,7 @@ func (me *H03Event) DecodeFromGin(c *gin.Context) {
 ********************************************************************************/
 func QueryH03CurrentDayEventByMac(mac string, results *[]H03Event) bool {
 	curDay := common.GetNowDate()
-	filter := fmt.Sprintf("mac='%s' and date(create_time)=date('%s')", mac, curDay)
+	filter := fmt.Sprintf("mac='%s' and %s", mac, dayRangeFilter("create_time", curDay, curDay))
 	QueryDao(NewH03Event().TableName(), filter, "create_time", -1, func(rows *sql.Rows) {
 		obj := NewH03Event()
 		err := obj.DecodeFromRows(rows)
@@ -1267,6 +1296,11 @@ func handleH03Report(mqttMsg *H03MqttMsg) {
 				obj.Update()
 			} else {
 				obj.Insert()
+				EmitWebhookEvent(WebhookStudyReportReady, obj.Mac, &WebhookStudyReport{
+					StartTime:  obj.StartTime,
+					EndTime:    obj.EndTime,
+					Evaluation: obj.Evaluation,
+				})
 				if len(obj.EndTime) >= 10 && obj.EndTime[:10] < common.GetNowDate() {
 					return
 				}
@@ -1285,18 +1319,25 @@ func handleH03Report(mqttMsg *H03MqttMsg) {
 				if len(userDevices) == 0 {
 					return
 				}
-				// 把报告通知给用户，通过公众号和小程序，优先公众号
+				// 把报告通知给用户，按路由通过公众号或小程序
+				eventId := common.GenerateUUID()
 				for _, userDevice := range userDevices {
-					if H03ReportNotify != nil {
-						status, _ := H03ReportNotify.NotifyEveryReportToOfficalAccount(userDevice.UserId, userDevice.NickName, obj.Mac, obj.StartTime, obj.EndTime)
-						if status != common.Success {
-							status, _ = H03ReportNotify.NotifyToMiniProgram(userDevice.UserId, userDevice.NickName, "次报告", obj.Mac, obj.Evaluation, obj.StartTime, obj.EndTime)
-						}
-						if status == common.Success {
-							nowTm := common.GetNowTime()
-							switchSetting.EveryReportLatestTime = &nowTm
-							switchSetting.Update()
-						}
+					delivered := notify.Notify(userDevice.UserId, &notify.Event{
+						ID:         eventId,
+						Type:       notify.EventStudyReport,
+						Mac:        obj.Mac,
+						DeviceType: H03Type,
+						NickName:   userDevice.NickName,
+						DeviceName: userDevice.DeviceName,
+						Title:      "次报告",
+						Score:      obj.Evaluation,
+						StartTime:  obj.StartTime,
+						EndTime:    obj.EndTime,
+					})
+					if delivered {
+						nowTm := common.GetNowTime()
+						switchSetting.EveryReportLatestTime = &nowTm
+						switchSetting.Update()
 					}
 				}
 			}
@@ -1315,17 +1356,6 @@ func handleH03Report(mqttMsg *H03MqttMsg) {
 	})
 }
 
-/******************************************************************************
- * description: 定义一个回调函数，用于通知学习报告
-********************************************************************************/
-var H03ReportNotify H03ReportNotifyCallback = nil
-
-type H03ReportNotifyCallback interface {
-	NotifyEveryReportToOfficalAccount(userId int64, nickName string, mac string, startTime string, endTime string) (int, string)
-	NotifyToMiniProgram(userId int64, nickName string, reportType string, mac string, evaluation int, startTime string, endTime string) (int, string)
-	NotifyWarningEventToOfficalAccount(userId int64, nickName string, mac string, tm string, event int) (int, string)
-}
-
 /******************************************************************************
  * function:
  * description: 定义学习报告原始数据结构，用于查询对比
@@ -2533,7 +2563,7 @@ func (me *H03WeekReport) DecodeFromGin(c *gin.Context) {
  * param {*[]H03WeekReport} results
  * return {*}
 ********************************************************************************/
-func QueryH03WeekReportByMac(mac string, currDate string, results *[]H03WeekReport) bool {
+func QueryH03WeekReportByMac(mac string, currDate string, results *[]H03WeekReport, opts ...ReadOption) bool {
 	t, err := common.StrToDate(currDate)
 	if err != nil {
 		t, err = common.StrToTime(currDate)
@@ -2544,15 +2574,37 @@ func QueryH03WeekReportByMac(mac string, currDate string, results *[]H03WeekRepo
 	}
 	y, w := t.ISOWeek()
 	// 查询年份和周数相同的记录
-	return QueryH03WeekReportByMacAndWeek(mac, y, w, results)
+	return QueryH03WeekReportByMacAndWeek(mac, y, w, results, opts...)
 }
-func QueryH03WeekReportByMacAndWeek(mac string, y, w int, results *[]H03WeekReport) bool {
+func QueryH03WeekReportByMacAndWeek(mac string, y, w int, results *[]H03WeekReport, opts ...ReadOption) bool {
 	filter := fmt.Sprintf(
 		"mac='%s' and report_year=%d and report_week=%d",
 		mac,
 		y,
 		w,
 	)
+	QueryDao(NewH03WeekReport().TableName(), filter, nil, -1, func(rows *sql.Rows) {
+		obj := NewH03WeekReport()
+		err := obj.DecodeFromRows(rows)
+		if err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, opts...)
+	return true
+}
+
+/******************************************************************************
+ * function: QueryH03WeekReportsByWeek
+ * description: 查询所有设备某一周的周报
+ * param {int} y 年份
+ * param {int} w 周数
+ * param {*[]H03WeekReport} results
+ * return {*}
+********************************************************************************/
+func QueryH03WeekReportsByWeek(y, w int, results *[]H03WeekReport) bool {
+	filter := fmt.Sprintf("report_year=%d and report_week=%d", y, w)
 	QueryDao(NewH03WeekReport().TableName(), filter, nil, -1, func(rows *sql.Rows) {
 		obj := NewH03WeekReport()
 		err := obj.DecodeFromRows(rows)
@@ -2933,7 +2985,7 @@ func QueryH03DailyReportByDate(mac string, dailyDate *string, results *[]H03Dail
  * param {*[]H03DailyReport} results
  * return {*}
 ********************************************************************************/
-func QueryH03DailyReportByWeek(mac string, year, week int, results *[]H03DailyReport) bool {
+func QueryH03DailyReportByWeek(mac string, year, week int, results *[]H03DailyReport, opts ...ReadOption) bool {
 	filter := fmt.Sprintf("mac='%s' and report_year=%d and report_week=%d", mac, year, week)
 	QueryDao(NewH03DailyReport().TableName(), filter, "daily_date", -1, func(rows *sql.Rows) {
 		obj := NewH03DailyReport()
@@ -2943,6 +2995,6 @@ func QueryH03DailyReportByWeek(mac string, year, week int, results *[]H03DailyRe
 		} else {
 			*results = append(*results, *obj)
 		}
-	})
+	}, opts...)
 	return true
 }
@@ -234,10 +234,10 @@ func (me *HeartRate) SetID(id int64) {
 	me.ID = id
 }
 
-func QueryHeartDateListInReport(mac string, startTime string, endTime string, results *[]string) bool {
-	var filter string = fmt.Sprintf("mac='%s' and date(create_time)>=date('%s') and date(create_time)<=date('%s')", mac, startTime, endTime)
+func QueryHeartDateListInReport(mac string, startTime string, endTime string, results *[]string, opts ...ReadOption) bool {
+	var filter string = fmt.Sprintf("mac='%s' and %s", mac, dayRangeFilter("create_time", startTime, endTime))
 	sql := fmt.Sprintf("select distinct date(create_time) from %s where %s order by date(create_time)", common.DeviceRecordTbl(HeatRateType), filter)
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -624,7 +624,7 @@ func BringLampUserToStudyRoom(mac string, createTm string) {
 						Status:   1,
 						DateTime: obj.EnterTime,
 					}
-					mq.PublishData(common.MakeHl77UserEnterRoomTopicByMac(mac), userStatus)
+					publishDeviceData(mac, common.MakeHl77UserEnterRoomTopicByMac(mac), userStatus)
 				}
 			}
 		}
@@ -664,7 +664,7 @@ func TakeLampUserFromStudyRoom(mac string) {
 						Status:   0,
 						DateTime: result.LeaveTime,
 					}
-					mq.PublishData(common.MakeHl77UserEnterRoomTopicByMac(mac), userStatus)
+					publishDeviceData(mac, common.MakeHl77UserEnterRoomTopicByMac(mac), userStatus)
 				}
 			}
 		}
@@ -775,7 +775,7 @@ func handleRealDataSetRsp(lampMqttMsg *LampMqttMsg) {
 
 	if CheckDiffBetweenTwoLampDeviceRecords(LampType, lampMqttMsg.Mac, realDataSql) {
 		//publish RealDataSql to APP
-		mq.PublishData(common.MakeHl77RealDataTopic(lampMqttMsg.Mac), realDataSql)
+		publishDeviceData(lampMqttMsg.Mac, common.MakeHl77RealDataTopic(lampMqttMsg.Mac), realDataSql)
 		// send a read mq message to lamp control status
 		readLampControlStatus(lampMqttMsg.Mac)
 		// save to database
@@ -1498,7 +1498,7 @@ func handleControlLampRsp(lampMqttMsg *LampMqttMsg) {
 		obj.CreateTime = common.GetNowTime()
 		obj.Insert()
 	}
-	mq.PublishData(common.MakeHl77ControlStatusTopic(lampMqttMsg.Mac), lampControlRsp)
+	publishDeviceData(lampMqttMsg.Mac, common.MakeHl77ControlStatusTopic(lampMqttMsg.Mac), lampControlRsp)
 }
 
 /******************************************************************************
@@ -2185,7 +2185,7 @@ func (me *StudyRoomRanking) DecodeFromRows(rows *sql.Rows) error {
  * param {int64} roomId
  * return {*}
 ********************************************************************************/
-func QueryRankingByStudyRoom(roomId int64, results *[]StudyRoomRanking) bool {
+func QueryRankingByStudyRoom(roomId int64, results *[]StudyRoomRanking, opts ...ReadOption) bool {
 	res := false
 	backFunc := func(rows *sql.Rows) {
 		obj := &StudyRoomRanking{}
@@ -2210,7 +2210,7 @@ func QueryRankingByStudyRoom(roomId int64, results *[]StudyRoomRanking) bool {
 			common.UserTbl + " c on a.user_id=c.id order by a.total_days desc, a.total_seconds desc"
 	}
 
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -2249,7 +2249,7 @@ func (me *UserStudyRoomData) DecodeFromRows(rows *sql.Rows) error {
 	)
 	return err
 }
-func QueryUserStudyRoomData(userId int64, roomId int64, startTm string, endTm string, results *[]UserStudyRoomData) bool {
+func QueryUserStudyRoomData(userId int64, roomId int64, startTm string, endTm string, results *[]UserStudyRoomData, opts ...ReadOption) bool {
 	backFunc := func(rows *sql.Rows) {
 		obj := &UserStudyRoomData{}
 		err := obj.DecodeFromRows(rows)
@@ -2281,7 +2281,7 @@ func QueryUserStudyRoomData(userId int64, roomId int64, startTm string, endTm st
 			" and b.room_id=" + strconv.FormatInt(roomId, 10)
 	}
 
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -2299,7 +2299,7 @@ type UserStudyDataByDay struct {
 	EnterDay   string `json:"enter_day" mysql:"enter_day"`
 }
 
-func QueryUserStudyDataByDay(userId int64, roomId int64, startTm string, endTm string, result *[]UserStudyDataByDay) bool {
+func QueryUserStudyDataByDay(userId int64, roomId int64, startTm string, endTm string, result *[]UserStudyDataByDay, opts ...ReadOption) bool {
 	var sql string
 	if roomId > 0 {
 		sql = "select sum(timestampdiff(second, enter_time, leave_time)) as day_seconds, date(enter_time) as enter_day " +
@@ -2310,7 +2310,7 @@ func QueryUserStudyDataByDay(userId int64, roomId int64, startTm string, endTm s
 			" from " + common.StudyRecordTbl + " where date(enter_time)>=date('" + startTm + "') and date(leave_time)<=date('" + endTm + "') " +
 			" and user_id=" + strconv.FormatInt(userId, 10) + " group by date(enter_time)"
 	}
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -2335,14 +2335,15 @@ func QueryUserStudyDataByDay(userId int64, roomId int64, startTm string, endTm s
  * param {string} endTm
  * return {*}
 ********************************************************************************/
-func StatsLampFlowDataByTime(mac string, startDay string, endDay string) int {
+func StatsLampFlowDataByTime(mac string, startDay string, endDay string, opts ...ReadOption) int {
+	dayFilter := dayRangeFilter("create_time", startDay, endDay)
 	sql := "select (case b.total_count when 0 then 0 else convert(100*a.flow_count / b.total_count, signed) end) as flow_data from " +
 		" (SELECT count(*) as flow_count FROM " + common.LampRealDataTbl + " where mac like '" + mac + "'" +
-		" and flow_state=2 and date(create_time) >=date('" + startDay + "') and date(create_time)<=date('" + endDay + "')) a," +
+		" and flow_state=2 and " + dayFilter + ") a," +
 		" (SELECT count(*) as total_count FROM " + common.LampRealDataTbl + " where mac like '" + mac + "'" +
-		" and flow_state>0 and date(create_time) >=date('" + startDay + "') and date(create_time)<=date('" + endDay + "')) b"
+		" and flow_state>0 and " + dayFilter + ") b"
 	var flowData int = 0
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return flowData
@@ -2367,7 +2368,7 @@ type UserStudyTime struct {
 	LeaveTime string `json:"leave_time" mysql:"leave_time"`
 }
 
-func QueryUserStudyTimeByDate(userId int64, roomId int64, startTm string, endTm string, results *[]UserStudyTime) bool {
+func QueryUserStudyTimeByDate(userId int64, roomId int64, startTm string, endTm string, results *[]UserStudyTime, opts ...ReadOption) bool {
 	backFunc := func(rows *sql.Rows) {
 		obj := &UserStudyTime{}
 		err := rows.Scan(&obj.UserId, &obj.EnterTime, &obj.LeaveTime)
@@ -2389,7 +2390,7 @@ func QueryUserStudyTimeByDate(userId int64, roomId int64, startTm string, endTm
 			" and room_id=" + strconv.FormatInt(roomId, 10) +
 			" and date(enter_time)>=date('" + startTm + "') and date(leave_time)<=date('" + endTm + "') and status=0"
 	}
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
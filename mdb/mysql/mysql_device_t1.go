@@ -16,6 +16,7 @@ import (
 	mylog "hjyserver/log"
 	"hjyserver/mdb/common"
 	"hjyserver/mq"
+	"hjyserver/notify"
 	"hjyserver/redis"
 	"math"
 	"strconv"
@@ -705,7 +706,22 @@ func handleT1Attr(mqttMsg *T1MqttMsg) {
 	// } else {
 	// 	attrData.Insert()
 	// }
-	mq.PublishData(MakeT1ServerAttrTopic(attrData.Mac), attrData)
+	publishDeviceData(attrData.Mac, MakeT1ServerAttrTopic(attrData.Mac), attrData)
+	// 按用户的规则判断本次上报的指标
+	metrics := make(map[string]int)
+	for key := range mapData {
+		switch key {
+		case "respiratory":
+			metrics[RuleMetricRespiratory] = attrData.Respiratory
+		case "heart_rate":
+			metrics[RuleMetricHeartRate] = attrData.HeartRate
+		case "flow_state":
+			metrics[RuleMetricConcentration] = attrData.FlowState
+		case "study_time":
+			metrics[RuleMetricStudyTime] = attrData.LowStudyTime + attrData.MidStudyTime + attrData.DeepStudyTime
+		}
+	}
+	EvaluateMetricRules(attrData.Mac, T1Type, metrics)
 
 	// 数据库频繁操作因为会出现性能延迟，所以采用队列处理
 	// 队列处理
@@ -922,7 +938,7 @@ func QueryT1AttrDataByMac(mac string, limited int, results *[]T1AttrData) bool {
  * return {*}
 ********************************************************************************/
 func QueryT1AttrDataByMacAndDay(mac string, startDay string, endDay string, results *[]T1AttrData) bool {
-	filter := fmt.Sprintf("mac='%s' and date(create_time)>='%s' and date(create_time)<='%s'", mac, startDay, endDay)
+	filter := fmt.Sprintf("mac='%s' and %s", mac, dayRangeFilter("create_time", startDay, endDay))
 	QueryDao(NewT1AttrData().TableName(), filter, "create_time desc", -1, func(rows *sql.Rows) {
 		obj := NewT1AttrData()
 		err := obj.DecodeFromRows(rows)
@@ -1004,7 +1020,18 @@ func handleT1Event(mqttMsg *T1MqttMsg) {
 	// 先更新到redis中,在没有MQ通知之前不更新到数据库，避免数据库压力，提高MQ通知的效率
 	redis.SaveValueToHash(hashKey, hashFiled, nil, eventData)
 	// 通知event事件
-	mq.PublishData(MakeT1ServerEventTopic(eventData.Mac), eventData)
+	publishDeviceData(eventData.Mac, MakeT1ServerEventTopic(eventData.Mac), eventData)
+	// 按用户的规则判断本次上报的指标
+	metrics := make(map[string]int)
+	for key := range dataMap {
+		switch key {
+		case "body_status":
+			metrics[RuleMetricBodyStatus] = eventData.BodyStatus
+		case "posture_state":
+			metrics[RuleMetricPosture] = eventData.PostureState
+		}
+	}
+	EvaluateMetricRules(eventData.Mac, T1Type, metrics)
 	// 数据库处理因为会出现性能延迟，所以采用队列处理
 	// 队列处理
 	GetTaskPool().Put(&gopool.Task{
@@ -1022,6 +1049,7 @@ func handleT1Event(mqttMsg *T1MqttMsg) {
 	})
 	// 向微信通知告警事件
 	if eventData.WarningEvent > 0 {
+		raiseAlarm(eventData.Mac, T1Type, AlarmSourceStudy, eventData.WarningEvent, eventData.CreateTime)
 		switchSettings := make([]T1ReportSwitchSetting, 0)
 		QueryT1ReportSwitchSetting(eventData.Mac, &switchSettings)
 		if len(switchSettings) == 0 {
@@ -1061,20 +1089,23 @@ func handleT1Event(mqttMsg *T1MqttMsg) {
 					StatT1WarningEventNotifyWeekly(obj.Mac, obj.WarningEvent, obj.CreateTime)
 				},
 			})
-			// 通知公众号
+			// 按路由通知用户
+			eventId := common.GenerateUUID()
 			for _, userDevice := range userDevices {
-				if T1ReportNotify != nil {
-					status, _ := T1ReportNotify.NotifyWarningEventToOfficalAccount(
-						userDevice.UserId,
-						userDevice.NickName,
-						eventData.Mac,
-						eventData.CreateTime,
-						eventData.WarningEvent)
-					if status == common.Success {
-						mylog.Log.Debugf("notify warning event to offical account success, mac: %s, event: %d", eventData.Mac, eventData.WarningEvent)
-					} else {
-						mylog.Log.Errorf("notify warning event to offical account failed, mac: %s, event: %d", eventData.Mac, eventData.WarningEvent)
-					}
+				delivered := notify.Notify(userDevice.UserId, &notify.Event{
+					ID:         eventId,
+					Type:       notify.EventStudyWarning,
+					Mac:        eventData.Mac,
+					DeviceType: T1Type,
+					NickName:   userDevice.NickName,
+					DeviceName: userDevice.DeviceName,
+					Code:       eventData.WarningEvent,
+					CreateTime: eventData.CreateTime,
+				})
+				if delivered {
+					mylog.Log.Debugf("notify warning event success, mac: %s, event: %d", eventData.Mac, eventData.WarningEvent)
+				} else {
+					mylog.Log.Errorf("notify warning event failed, mac: %s, event: %d", eventData.Mac, eventData.WarningEvent)
 				}
 			}
 		}
@@ -1181,7 +1212,7 @@ func (me *T1Event) DecodeFromGin(c *gin.Context) {
 ********************************************************************************/
 func QueryT1CurrentDayEventByMac(mac string, results *[]T1Event) bool {
 	curDay := common.GetNowDate()
-	filter := fmt.Sprintf("mac='%s' and date(create_time)=date('%s')", mac, curDay)
+	filter := fmt.Sprintf("mac='%s' and %s", mac, dayRangeFilter("create_time", curDay, curDay))
 	QueryDao(NewT1Event().TableName(), filter, "create_time", -1, func(rows *sql.Rows) {
 		obj := NewT1Event()
 		err := obj.DecodeFromRows(rows)
@@ -1307,6 +1338,11 @@ func handleT1Report(mqttMsg *T1MqttMsg) {
 				obj.Update()
 			} else {
 				obj.Insert()
+				EmitWebhookEvent(WebhookStudyReportReady, obj.Mac, &WebhookStudyReport{
+					StartTime:  obj.StartTime,
+					EndTime:    obj.EndTime,
+					Evaluation: obj.Evaluation,
+				})
 				if len(obj.EndTime) >= 10 && obj.EndTime[:10] < common.GetNowDate() {
 					return
 				}
@@ -1325,18 +1361,25 @@ func handleT1Report(mqttMsg *T1MqttMsg) {
 				if len(userDevices) == 0 {
 					return
 				}
-				// 把报告通知给用户，通过公众号和小程序，优先公众号
+				// 把报告通知给用户，按路由通过公众号或小程序
+				eventId := common.GenerateUUID()
 				for _, userDevice := range userDevices {
-					if T1ReportNotify != nil {
-						status, _ := T1ReportNotify.NotifyEveryReportToOfficalAccount(userDevice.UserId, userDevice.NickName, obj.Mac, obj.StartTime, obj.EndTime)
-						if status != common.Success {
-							status, _ = T1ReportNotify.NotifyToMiniProgram(userDevice.UserId, userDevice.NickName, "次报告", obj.Mac, obj.Evaluation, obj.StartTime, obj.EndTime)
-						}
-						if status == common.Success {
-							nowTm := common.GetNowTime()
-							switchSetting.EveryReportLatestTime = &nowTm
-							switchSetting.Update()
-						}
+					delivered := notify.Notify(userDevice.UserId, &notify.Event{
+						ID:         eventId,
+						Type:       notify.EventStudyReport,
+						Mac:        obj.Mac,
+						DeviceType: T1Type,
+						NickName:   userDevice.NickName,
+						DeviceName: userDevice.DeviceName,
+						Title:      "次报告",
+						Score:      obj.Evaluation,
+						StartTime:  obj.StartTime,
+						EndTime:    obj.EndTime,
+					})
+					if delivered {
+						nowTm := common.GetNowTime()
+						switchSetting.EveryReportLatestTime = &nowTm
+						switchSetting.Update()
 					}
 				}
 			}
@@ -1355,17 +1398,6 @@ func handleT1Report(mqttMsg *T1MqttMsg) {
 	})
 }
 
-/******************************************************************************
- * description: 定义一个回调函数，用于通知学习报告
-********************************************************************************/
-var T1ReportNotify T1ReportNotifyCallback = nil
-
-type T1ReportNotifyCallback interface {
-	NotifyEveryReportToOfficalAccount(userId int64, nickName string, mac string, startTime string, endTime string) (int, string)
-	NotifyToMiniProgram(userId int64, nickName string, reportType string, mac string, evaluation int, startTime string, endTime string) (int, string)
-	NotifyWarningEventToOfficalAccount(userId int64, nickName string, mac string, tm string, event int) (int, string)
-}
-
 /******************************************************************************
  * function:
  * description: 定义学习报告原始数据结构，用于查询对比
@@ -2585,7 +2617,7 @@ func (me *T1WeekReport) DecodeFromGin(c *gin.Context) {
  * param {*[]T1WeekReport} results
  * return {*}
 ********************************************************************************/
-func QueryT1WeekReportByMac(mac string, currDate string, results *[]T1WeekReport) bool {
+func QueryT1WeekReportByMac(mac string, currDate string, results *[]T1WeekReport, opts ...ReadOption) bool {
 	t, err := common.StrToDate(currDate)
 	if err != nil {
 		t, err = common.StrToTime(currDate)
@@ -2596,15 +2628,37 @@ func QueryT1WeekReportByMac(mac string, currDate string, results *[]T1WeekReport
 	}
 	y, w := t.ISOWeek()
 	// 查询年份和周数相同的记录
-	return QueryT1WeekReportByMacAndWeek(mac, y, w, results)
+	return QueryT1WeekReportByMacAndWeek(mac, y, w, results, opts...)
 }
-func QueryT1WeekReportByMacAndWeek(mac string, y, w int, results *[]T1WeekReport) bool {
+func QueryT1WeekReportByMacAndWeek(mac string, y, w int, results *[]T1WeekReport, opts ...ReadOption) bool {
 	filter := fmt.Sprintf(
 		"mac='%s' and report_year=%d and report_week=%d",
 		mac,
 		y,
 		w,
 	)
+	QueryDao(NewT1WeekReport().TableName(), filter, nil, -1, func(rows *sql.Rows) {
+		obj := NewT1WeekReport()
+		err := obj.DecodeFromRows(rows)
+		if err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, opts...)
+	return true
+}
+
+/******************************************************************************
+ * function: QueryT1WeekReportsByWeek
+ * description: 查询所有设备某一周的周报
+ * param {int} y 年份
+ * param {int} w 周数
+ * param {*[]T1WeekReport} results
+ * return {*}
+********************************************************************************/
+func QueryT1WeekReportsByWeek(y, w int, results *[]T1WeekReport) bool {
+	filter := fmt.Sprintf("report_year=%d and report_week=%d", y, w)
 	QueryDao(NewT1WeekReport().TableName(), filter, nil, -1, func(rows *sql.Rows) {
 		obj := NewT1WeekReport()
 		err := obj.DecodeFromRows(rows)
@@ -2985,7 +3039,7 @@ func QueryT1DailyReportByDate(mac string, dailyDate *string, results *[]T1DailyR
  * param {*[]T1DailyReport} results
  * return {*}
 ********************************************************************************/
-func QueryT1DailyReportByWeek(mac string, year, week int, results *[]T1DailyReport) bool {
+func QueryT1DailyReportByWeek(mac string, year, week int, results *[]T1DailyReport, opts ...ReadOption) bool {
 	filter := fmt.Sprintf("mac='%s' and report_year=%d and report_week=%d", mac, year, week)
 	QueryDao(NewT1DailyReport().TableName(), filter, "daily_date", -1, func(rows *sql.Rows) {
 		obj := NewT1DailyReport()
@@ -2995,6 +3049,6 @@ func QueryT1DailyReportByWeek(mac string, year, week int, results *[]T1DailyRepo
 		} else {
 			*results = append(*results, *obj)
 		}
-	})
+	}, opts...)
 	return true
 }
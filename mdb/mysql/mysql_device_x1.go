@@ -10,6 +10,7 @@ import (
 	mylog "hjyserver/log"
 	"hjyserver/mdb/common"
 	"hjyserver/mq"
+	"hjyserver/stream"
 	"net/http"
 	"strings"
 	"time"
@@ -341,9 +342,15 @@ func handleX1RealDataMqttMsg(mac string, payload []byte) {
 	if heartObj.ActiveStatus == 3 && heartObj.PersonStatus == 3 {
 		heartObj.StagesStatus = 3
 	}
+	// 每次上报都按用户的规则判断, 不受去重影响
+	EvaluateMetricRules(mac, X1Type, map[string]int{
+		RuleMetricHeartRate:   realDataSql.HeartRate,
+		RuleMetricRespiratory: realDataSql.RespiratoryRate,
+		RuleMetricBodyStatus:  realDataSql.BodyStatus,
+	})
 	if CheckDiffBetweenTwoSleepDeviceRecords(X1Type, mac, heartObj) {
 		// mq.PublishData("x1/realdata/test", heartObj)
-		mq.PublishData(common.MakeHeartRateTopic(mac), heartObj)
+		publishDeviceData(mac, common.MakeHeartRateTopic(mac), heartObj)
 		taskPool.Put(&gopool.Task{
 			Params: []interface{}{realDataSql},
 			Do: func(params ...interface{}) {
@@ -634,6 +641,20 @@ func handleX1DayReportMqttMsg(mac string, payload []byte, saveJson bool) {
 				}
 				dayReportSql.Insert()
 			}
+			// 重新解析保存的报告时不再产生事件
+			if saveJson {
+				EmitWebhookEvent(WebhookSleepReportReady, mac, &WebhookSleepReport{
+					SleepStartTime: dayReportSql.SleepStartTime,
+					SleepEndTime:   dayReportSql.SleepEndTime,
+					Evaluation:     dayReportSql.Evaluation,
+				})
+				notifySleepReport(mac, dayReportSql.SleepStartTime, dayReportSql.SleepEndTime, dayReportSql.Evaluation, &SleepReportNotify{
+					GoBedTime:       dayReportSql.GoBedTime,
+					LeaveBedTime:    dayReportSql.LeaveBedTime,
+					BaseRespiratory: dayReportSql.BaseRespiratory,
+					BaseHeartRate:   dayReportSql.BaseHeartRate,
+				})
+			}
 		},
 		Catch: func(e exception.Exception) {
 			mylog.Log.Errorln("handleDayReportMqttMsg catch exception, err:", e.Error())
@@ -658,7 +679,7 @@ func RecoverX1DayReport(mac string, reportDate string) (int, string) {
 		mac := v.Mac
 		jsonVal := v.Value
 		reportSql := NewX1DayReportSql()
-		filter := fmt.Sprintf("mac='%s' and date(create_time)=date('%s')", mac, reportDate)
+		filter := fmt.Sprintf("mac='%s' and %s", mac, dayRangeFilter("create_time", reportDate, reportDate))
 		DeleteDaoByFilter(reportSql.myTable(), filter)
 		handleX1DayReportMqttMsg(mac, []byte(jsonVal), false)
 	}
@@ -730,9 +751,9 @@ func (me *X1DayReportOrigin) SetID(id int64) {
 	me.ID = id
 }
 func QueryX1DayReportJson(mac string, create_date string, result *[]X1DayReportOrigin) bool {
-	filter := fmt.Sprintf("mac='%s' and date(create_time)=date('%s')", mac, create_date)
+	filter := fmt.Sprintf("mac='%s' and %s", mac, dayRangeFilter("create_time", create_date, create_date))
 	if mac == "" {
-		filter = fmt.Sprintf("date(create_time)=date('%s')", create_date)
+		filter = dayRangeFilter("create_time", create_date, create_date)
 	}
 	return QueryDao(common.DeviceDayReportJsonTbl(X1Type), filter, nil, 0, func(rows *sql.Rows) {
 		obj := NewX1DayReportOrigin()
@@ -802,7 +823,7 @@ func (me *X1RealDataOrigin) SetID(id int64) {
 }
 
 func QueryX1RealDataJson(mac string, create_date string, result *[]X1RealDataOrigin) bool {
-	filter := fmt.Sprintf("mac='%s' and date(create_time)=date('%s')", mac, create_date)
+	filter := fmt.Sprintf("mac='%s' and %s", mac, dayRangeFilter("create_time", create_date, create_date))
 	return QueryDao(common.DeviceRecordJsonTbl(X1Type), filter, nil, 0, func(rows *sql.Rows) {
 		obj := NewX1RealDataOrigin()
 		err := obj.DecodeFromRows(rows)
@@ -971,7 +992,7 @@ func (me *X1DayReportSql) Delete() bool {
 	return DeleteDaoByID(me.myTable(), me.ID)
 }
 
-func QueryX1DayReportByMacAndTime(mac string, startTime, endTime string, results *[]X1DayReportSql) bool {
+func QueryX1DayReportByMacAndTime(mac string, startTime, endTime string, results *[]X1DayReportSql, opts ...ReadOption) bool {
 	filter := fmt.Sprintf("mac='%s' and date(sleep_end_time)>=date('%s') and date(sleep_end_time)<=date('%s') and sleep_periodization > 0", mac, startTime, endTime)
 	backFunc := func(rows *sql.Rows) {
 		obj := NewX1DayReportSql()
@@ -982,7 +1003,7 @@ func QueryX1DayReportByMacAndTime(mac string, startTime, endTime string, results
 			*results = append(*results, *obj)
 		}
 	}
-	return QueryDao(NewX1DayReportSql().myTable(), filter, "periodization_time", -1, backFunc)
+	return QueryDao(NewX1DayReportSql().myTable(), filter, "periodization_time", -1, backFunc, opts...)
 }
 
 /******************************************************************************
@@ -994,11 +1015,11 @@ func QueryX1DayReportByMacAndTime(mac string, startTime, endTime string, results
  * param {*[]string} results
  * return {*}
 ********************************************************************************/
-func QueryX1DateListInReport(mac, startTime, endTime string, results *[]string) bool {
+func QueryX1DateListInReport(mac, startTime, endTime string, results *[]string, opts ...ReadOption) bool {
 	filter := fmt.Sprintf("mac='%s' and date(sleep_end_time)>=date('%s') and date(sleep_end_time)<=date('%s') and sleep_periodization > 0", mac, startTime, endTime)
 	sql := "select distinct date(sleep_end_time) from " + NewX1DayReportSql().myTable() + " where " + filter
 	sql += " order by date(sleep_end_time)"
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -1054,15 +1075,27 @@ func handlerX1EventMqttMsg(mac string, payload []byte) {
 	heartEvent.HeartRate = eventJson.HeartRate
 	heartEvent.RespiratoryRate = eventJson.RepiratoryRate
 	heartEvent.CreateTime = eventSql.CreateTime
+	EmitWebhookEvent(WebhookAlarmRaised, mac, &WebhookAlarm{
+		Type:            heartEvent.Type,
+		Status:          1,
+		HeartRate:       heartEvent.HeartRate,
+		RespiratoryRate: heartEvent.RespiratoryRate,
+		CreateTime:      heartEvent.CreateTime,
+	})
+	raiseAlarm(mac, X1Type, AlarmSourceSleep, heartEvent.Type, heartEvent.CreateTime)
 	var userDevices []UserDeviceDetail
 	QueryUserDeviceDetailByMac(mac, &userDevices)
 	if len(userDevices) > 0 {
+		eventId := common.GenerateUUID()
 		for _, userDevice := range userDevices {
 			heartEvent.UserDeviceDetail = userDevice
 			mq.PublishData(common.MakeHeartEventTopic(mac), heartEvent)
-			// send sms
-			SendSleepAlarmSms(heartEvent)
+			// 通知用户
+			notifySleepAlarm(eventId, heartEvent)
 		}
+		// app连接按设备订阅, 只推送一次
+		heartEvent.UserDeviceDetail = userDevices[0]
+		stream.Publish(mac, common.MakeHeartEventTopic(mac), heartEvent)
 	}
 }
 
@@ -0,0 +1,300 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// 接收时段和免打扰时段的格式
+const ContactHourFmt = "15:04"
+
+// swagger:model EmergencyContact
+type EmergencyContact struct {
+	ID     int64  `json:"id" mysql:"id"`
+	UserId int64  `json:"user_id" mysql:"user_id"`
+	Name   string `json:"name" mysql:"name"`
+	// 与用户的关系, 如儿子、女儿、护工
+	Relation string `json:"relation" mysql:"relation"`
+	Phone    string `json:"phone" mysql:"phone"`
+	// 手机号是否已经短信验证 0:未验证 1:已验证
+	PhoneVerified int `json:"phone_verified" mysql:"phone_verified"`
+	// 联系人关注公众号的openId, 由服务端通过联系人手机号注册的账号绑定的微信取得, 客户端填写的无效
+	OpenId string `json:"open_id" mysql:"open_id"`
+	Email  string `json:"email" mysql:"email"`
+	// 邮箱是否已经验证 0:未验证 1:已验证
+	EmailVerified int `json:"email_verified" mysql:"email_verified"`
+	// 通知通道, 逗号分隔, sms/wx_official/email
+	Channels string `json:"channels" mysql:"channels"`
+	// 关注的报警, 逗号分隔, 来源.类型或来源, 如sleep.3010,fall,vital, 为空时接收所有报警
+	Alarms string `json:"alarms" mysql:"alarms"`
+	// 接收时段, 格式15:04, 开始晚于结束时跨过零点, 都为空时全天接收
+	ActiveStart string `json:"active_start" mysql:"active_start"`
+	ActiveEnd   string `json:"active_end" mysql:"active_end"`
+	// 主联系人, 每个用户最多一个, 报警升级时先通知主联系人
+	IsPrimary  int    `json:"is_primary" mysql:"is_primary"`
+	CreateTime string `json:"create_time" mysql:"create_time"`
+	UpdateTime string `json:"update_time" mysql:"update_time"`
+}
+
+func NewEmergencyContact() *EmergencyContact {
+	return &EmergencyContact{
+		ID:            0,
+		UserId:        0,
+		Name:          "",
+		Relation:      "",
+		Phone:         "",
+		PhoneVerified: 0,
+		OpenId:        "",
+		Email:         "",
+		EmailVerified: 0,
+		Channels:      "",
+		Alarms:        "",
+		ActiveStart:   "",
+		ActiveEnd:     "",
+		IsPrimary:     0,
+		CreateTime:    common.GetNowTime(),
+		UpdateTime:    common.GetNowTime(),
+	}
+}
+
+func (me *EmergencyContact) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *EmergencyContact) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.UserId, &me.Name, &me.Relation, &me.Phone, &me.PhoneVerified, &me.OpenId, &me.Email,
+		&me.EmailVerified, &me.Channels, &me.Alarms, &me.ActiveStart, &me.ActiveEnd, &me.IsPrimary, &me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *EmergencyContact) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.UserId, &me.Name, &me.Relation, &me.Phone, &me.PhoneVerified, &me.OpenId, &me.Email,
+		&me.EmailVerified, &me.Channels, &me.Alarms, &me.ActiveStart, &me.ActiveEnd, &me.IsPrimary, &me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *EmergencyContact) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.EmergencyContactTbl, me.ID, me)
+}
+
+// createEmergencyContactTable 新增联系人和迁移紧急联系电话时创建表
+func createEmergencyContactTable() {
+	sql := `create table ` + common.EmergencyContactTbl + ` (
+		id bigint NOT NULL AUTO_INCREMENT,
+		user_id bigint not null comment '用户id',
+		name varchar(64) default '' comment '联系人姓名',
+		relation varchar(32) default '' comment '与用户的关系',
+		phone varchar(32) default '' comment '手机号',
+		phone_verified int not null default 0 comment '0:未验证 1:已验证',
+		open_id varchar(64) default '' comment '公众号openId',
+		email varchar(128) default '' comment '邮箱',
+		email_verified int not null default 0 comment '0:未验证 1:已验证',
+		channels varchar(64) default '' comment '通知通道',
+		alarms varchar(255) default '' comment '关注的报警',
+		active_start varchar(8) default '' comment '接收时段开始',
+		active_end varchar(8) default '' comment '接收时段结束',
+		is_primary int not null default 0 comment '是否主联系人',
+		create_time datetime comment '创建时间',
+		update_time datetime comment '更新时间',
+		PRIMARY KEY (id),
+		INDEX idx_user_id (user_id)
+	)`
+	CreateTable(sql)
+}
+
+func (me *EmergencyContact) Insert() bool {
+	tblName := common.EmergencyContactTbl
+	if !CheckTableExist(tblName) {
+		createEmergencyContactTable()
+	}
+	// 姓名和关系由用户输入, 需要转义后才能拼接到sql中
+	obj := *me
+	obj.Name = common.EscapeSql(me.Name)
+	obj.Relation = common.EscapeSql(me.Relation)
+	obj.Email = common.EscapeSql(me.Email)
+	if !InsertDao(tblName, &obj) {
+		return false
+	}
+	me.ID = obj.ID
+	return true
+}
+func (me *EmergencyContact) Update() bool {
+	obj := *me
+	obj.Name = common.EscapeSql(me.Name)
+	obj.Relation = common.EscapeSql(me.Relation)
+	obj.Email = common.EscapeSql(me.Email)
+	return UpdateDaoByID(common.EmergencyContactTbl, me.ID, &obj)
+}
+func (me *EmergencyContact) Delete() bool {
+	return DeleteDaoByID(common.EmergencyContactTbl, me.ID)
+}
+func (me *EmergencyContact) SetID(id int64) {
+	me.ID = id
+}
+
+// HasChannel 检查联系人是否使用指定的通道
+func (me *EmergencyContact) HasChannel(name string) bool {
+	for _, v := range strings.Split(me.Channels, ",") {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+/******************************************************************************
+ * function: MatchAlarm
+ * description: 检查联系人是否关注该报警, 配置项等于 来源.类型 或 来源 时匹配
+ * param {string} key 来源.类型, 如sleep.3010
+ * return {*}
+********************************************************************************/
+func (me *EmergencyContact) MatchAlarm(key string) bool {
+	if me.Alarms == "" {
+		return true
+	}
+	source, _, _ := strings.Cut(key, ".")
+	for _, v := range strings.Split(me.Alarms, ",") {
+		if v == key || v == source {
+			return true
+		}
+	}
+	return false
+}
+
+/******************************************************************************
+ * function: ActiveAt
+ * description: 检查指定时间是否在联系人的接收时段内
+ * param {time.Time} t
+ * return {*}
+********************************************************************************/
+func (me *EmergencyContact) ActiveAt(t time.Time) bool {
+	if me.ActiveStart == "" && me.ActiveEnd == "" {
+		return true
+	}
+	return inDayPeriod(t, me.ActiveStart, me.ActiveEnd)
+}
+
+// inDayPeriod 检查时间是否在每天的时段内, 开始为空从零点开始, 结束为空到当天结束
+func inDayPeriod(t time.Time, start string, end string) bool {
+	now := t.Format(ContactHourFmt)
+	if start == "" {
+		start = "00:00"
+	}
+	if end == "" {
+		end = "24:00"
+	}
+	if start <= end {
+		return now >= start && now < end
+	}
+	// 跨过零点, 如22:00到07:00
+	return now >= start || now < end
+}
+
+func QueryEmergencyContactByCond(filter interface{}, sort interface{}, results *[]EmergencyContact) bool {
+	return QueryDao(common.EmergencyContactTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewEmergencyContact()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, ReadPrimary)
+}
+
+// QueryUserContacts 查询用户的紧急联系人, 主联系人在前
+func QueryUserContacts(userId int64, results *[]EmergencyContact) bool {
+	return QueryEmergencyContactByCond(fmt.Sprintf("user_id=%d", userId), "is_primary desc, id", results)
+}
+
+/******************************************************************************
+ * function: PromotePrimaryContact
+ * description: 用户没有主联系人时, 把最早添加的已验证联系人设为主联系人, 都没有验证时使用最早添加的联系人
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func PromotePrimaryContact(userId int64) {
+	var contacts []EmergencyContact
+	QueryEmergencyContactByCond(fmt.Sprintf("user_id=%d", userId),
+		"is_primary desc, (phone_verified=1 or email_verified=1) desc, id", &contacts)
+	if len(contacts) == 0 || contacts[0].IsPrimary == 1 {
+		return
+	}
+	sql := fmt.Sprintf("update %s set is_primary=1, update_time=? where id=?", common.EmergencyContactTbl)
+	if _, err := mDb.Exec(sql, common.GetNowTime(), contacts[0].ID); err != nil {
+		mylog.Log.Errorln(err)
+		return
+	}
+	mylog.Log.Infof("contact %d promoted to primary contact of user %d", contacts[0].ID, userId)
+}
+
+// ClearPrimaryContact 取消用户其他联系人的主联系人标记
+func ClearPrimaryContact(userId int64, exceptId int64) {
+	if !CheckTableExist(common.EmergencyContactTbl) {
+		return
+	}
+	sql := fmt.Sprintf("update %s set is_primary=0, update_time=? where user_id=? and id<>? and is_primary=1",
+		common.EmergencyContactTbl)
+	if _, err := mDb.Exec(sql, common.GetNowTime(), userId, exceptId); err != nil {
+		mylog.Log.Errorln(err)
+	}
+}
+
+/******************************************************************************
+ * function: migrateEmergentPhoneContacts
+ * description: 第一次创建联系人表时, 把用户原来的紧急联系电话迁移为主联系人,
+ * 原来的号码已经在使用, 按已验证处理, 只接收短信
+ * return {*}
+********************************************************************************/
+func migrateEmergentPhoneContacts() {
+	if CheckTableExist(common.EmergencyContactTbl) || !CheckTableExist(common.UserTbl) {
+		return
+	}
+	createEmergencyContactTable()
+	now := common.GetNowTime()
+	sql := fmt.Sprintf("insert into %s (user_id, name, relation, phone, phone_verified, open_id, email, channels, alarms, "+
+		"active_start, active_end, is_primary, create_time, update_time) "+
+		"select id, '', '', emergent_phone, 1, '', '', 'sms', '', '', '', 1, ?, ? from %s where emergent_phone<>''",
+		common.EmergencyContactTbl, common.UserTbl)
+	result, err := mDb.Exec(sql, now, now)
+	if err != nil {
+		mylog.Log.Errorln("migrate emergent phone error:", err)
+		return
+	}
+	n, _ := result.RowsAffected()
+	mylog.Log.Infof("%d emergent phones migrated to %s", n, common.EmergencyContactTbl)
+}
+
+/******************************************************************************
+ * function: migrateContactEmailVerifiedColumn
+ * description: 联系人表增加邮箱是否已验证的字段, 原有的邮箱按未验证处理. 原来由客户端填写的openId
+ * 不能确认属于联系人, 同时清空, 联系人验证手机号后从绑定的微信重新取得
+ * return {*}
+********************************************************************************/
+func migrateContactEmailVerifiedColumn() {
+	if !CheckTableExist(common.EmergencyContactTbl) {
+		return
+	}
+	if tableHasColumn(common.EmergencyContactTbl, "email_verified") {
+		return
+	}
+	sqlStr := fmt.Sprintf("alter table %s add column email_verified int not null default 0 comment '0:未验证 1:已验证' after email",
+		common.EmergencyContactTbl)
+	if _, err := mDb.Exec(sqlStr); err != nil {
+		mylog.Log.Errorln("add email_verified column error:", err)
+		return
+	}
+	if _, err := mDb.Exec(fmt.Sprintf("update %s set open_id=''", common.EmergencyContactTbl)); err != nil {
+		mylog.Log.Errorln("clear contact open id error:", err)
+	}
+	mylog.Log.Infoln("email_verified column added to", common.EmergencyContactTbl)
+}
@@ -0,0 +1,52 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContactActiveAt(t *testing.T) {
+	at := func(hm string) time.Time {
+		v, _ := time.Parse(ContactHourFmt, hm)
+		return v
+	}
+	cases := []struct {
+		start string
+		end   string
+		now   string
+		want  bool
+	}{
+		{"", "", "03:00", true},
+		{"08:00", "20:00", "12:30", true},
+		{"08:00", "20:00", "20:00", false},
+		{"22:00", "07:00", "23:15", true},
+		{"22:00", "07:00", "06:59", true},
+		{"22:00", "07:00", "12:00", false},
+		{"18:00", "", "23:59", true},
+		{"", "09:00", "10:00", false},
+	}
+	for _, v := range cases {
+		contact := &EmergencyContact{ActiveStart: v.start, ActiveEnd: v.end}
+		if got := contact.ActiveAt(at(v.now)); got != v.want {
+			t.Errorf("ActiveAt(%s-%s, %s) = %v, want %v", v.start, v.end, v.now, got, v.want)
+		}
+	}
+}
+
+func TestContactMatchAlarm(t *testing.T) {
+	contact := &EmergencyContact{Alarms: "sleep.3010,fall"}
+	cases := map[string]bool{
+		"sleep.3010": true,
+		"sleep.3008": false,
+		"fall.0":     true,
+		"vital.1":    false,
+	}
+	for key, want := range cases {
+		if got := contact.MatchAlarm(key); got != want {
+			t.Errorf("MatchAlarm(%s) = %v, want %v", key, got, want)
+		}
+	}
+	if !(&EmergencyContact{}).MatchAlarm("vital.1") {
+		t.Error("contact without alarms should match all alarms")
+	}
+}
@@ -15,8 +15,10 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"hjyserver/cfg"
@@ -24,8 +26,9 @@ import (
 	mylog "hjyserver/log"
 	"hjyserver/mdb/common"
 	"hjyserver/mq"
+	"hjyserver/notify"
 	"hjyserver/redis"
-	"hjyserver/sms"
+	"hjyserver/stream"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
@@ -113,14 +116,29 @@ func Open() bool {
 	mDb.SetConnMaxIdleTime(time.Second * 30) // 每个连接最大空闲时间
 	mDb.SetMaxIdleConns(500)                 // 最大空闲连接数
 	mDb.SetMaxOpenConns(1024)                // 连接池最大连接数
+	// open read replicas
+	openReplicas()
 	// init task pool
 	taskPool, _ = gopool.InitPool(128)
 	// subscribe device topic
 	subscribeDeviceTopic()
+	// extend password column for hashed passwords
+	migrateUserPasswordColumn()
+	migrateUserLocaleColumn()
+	migrateUserEmailVerifiedColumn()
+	migrateUserEmailUniqueIndex()
+	migrateNotifyPreferenceEmailColumn()
+	migrateWebhookIdColumn()
+	// move emergent phones to emergency contacts
+	migrateEmergentPhoneContacts()
+	migrateContactEmailVerifiedColumn()
+	// create monthly partitions for record tables
+	go MaintainPartitions()
 	// open a goroutine to check whether device is online
 	checkOnlineTimeout := make(chan struct{}, 1)
 	checkDataTimeout := make(chan struct{}, 1)
-	cleanupOldRealData := make(chan struct{}, 1)
+	dailyTimeout := make(chan struct{}, 1)
+	checkReplica := make(chan struct{}, 1)
 	go func() {
 		for {
 			time.Sleep(1 * time.Minute)
@@ -136,9 +154,17 @@ func Open() bool {
 	go func() {
 		for {
 			time.Sleep(24 * time.Hour)
-			cleanupOldRealData <- struct{}{}
+			dailyTimeout <- struct{}{}
 		}
 	}()
+	if len(mReplicas) > 0 {
+		go func() {
+			for {
+				time.Sleep(10 * time.Second)
+				checkReplica <- struct{}{}
+			}
+		}()
+	}
 
 	go func() {
 		for {
@@ -153,12 +179,39 @@ func Open() bool {
 				if cfg.This.Svr.EnableHl77 {
 					checkNoRealDataLamp()
 				}
-			case <-cleanupOldRealData:
+			case <-dailyTimeout:
+				MaintainPartitions()
 				cleanupOldRealDataTbl()
+				cleanupExpiredUserDataExports()
+				flagLegacyPasswordsForReset()
+			case <-checkReplica:
+				checkReplicaLag()
 			}
 		}
 	}()
 
+	if cfg.This.Webhook.Enable {
+		go func() {
+			for {
+				time.Sleep(30 * time.Second)
+				RetryWebhookDeliveries()
+			}
+		}()
+	}
+	go func() {
+		for {
+			time.Sleep(30 * time.Second)
+			checkFallAlarmEvents()
+			autoResolveAlarms()
+		}
+	}()
+	go func() {
+		for {
+			time.Sleep(10 * time.Second)
+			RunAlarmEscalations()
+		}
+	}()
+
 	if cfg.This.Svr.EnableX1 {
 		go func() {
 			for {
@@ -178,6 +231,7 @@ func Open() bool {
 func Close() {
 	quit <- true
 	taskPool.Close()
+	closeReplicas()
 	err := mDb.Close()
 	if err != nil {
 		mylog.Log.Errorln(err)
@@ -191,6 +245,47 @@ func GetDB() *sql.DB {
 	return mDb
 }
 
+/*
+* DbExecutor... *sql.DB和*sql.Tx共同的执行接口, DAO函数可以在事务内外复用
+ */
+type DbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+/******************************************************************************
+ * function: ExecWithTx
+ * description: 在一个事务中执行fn, fn返回false或者panic时回滚, 否则提交
+ * 注意: 建表等DDL语句会隐式提交事务, 不要在fn中执行
+ * param {func(tx *sql.Tx) bool} fn
+ * return {*}
+********************************************************************************/
+func ExecWithTx(fn func(tx *sql.Tx) bool) (result bool) {
+	tx, err := mDb.Begin()
+	if err != nil {
+		mylog.Log.Errorln("begin transaction error:", err)
+		return false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if !fn(tx) {
+		if err := tx.Rollback(); err != nil {
+			mylog.Log.Errorln("rollback transaction error:", err)
+		}
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		mylog.Log.Errorln("commit transaction error:", err)
+		return false
+	}
+	return true
+}
+
 /******************************************************************************
  * function: checkDeviceOnline
  * description: check device online, if device is offline, set online=0
@@ -220,10 +315,17 @@ func checkDeviceOnline() {
 		v.Online = 0
 		v.Update()
 		status := HeartBeatMsg{Mac: v.Mac, Online: 0, Rssi: v.Rssi}
-		mq.PublishData(common.MakeDeviceHeartBeatTopic(v.Mac), status)
+		publishDeviceData(v.Mac, common.MakeDeviceHeartBeatTopic(v.Mac), status)
+		EmitWebhookEvent(WebhookDeviceOffline, v.Mac, status)
 	}
 }
 
+// publishDeviceData 发布设备数据到mqtt, 同时推送给订阅了设备的app连接
+func publishDeviceData(mac string, topic string, payload interface{}) {
+	mq.PublishData(topic, payload)
+	stream.Publish(mac, topic, payload)
+}
+
 /**
  * @description:设置设备在线状态
  * @param {string} mac
@@ -240,6 +342,14 @@ func SetDeviceOnline(mac string, online int, rssi int) {
 			var gList = []Device{}
 			QueryDeviceByCond(fmt.Sprintf("mac='%s'", obj.Mac), nil, nil, &gList)
 			if len(gList) > 0 {
+				// 只在状态变化时产生事件
+				if gList[0].Online != obj.Online {
+					if obj.Online == 1 {
+						EmitWebhookEvent(WebhookDeviceOnline, obj.Mac, *obj)
+					} else {
+						EmitWebhookEvent(WebhookDeviceOffline, obj.Mac, *obj)
+					}
+				}
 				gList[0].Online = obj.Online
 				if rssi != 0 {
 					gList[0].Rssi = obj.Rssi
@@ -249,7 +359,7 @@ func SetDeviceOnline(mac string, online int, rssi int) {
 			}
 		},
 	})
-	mq.PublishData(common.MakeDeviceHeartBeatTopic(mac), status)
+	publishDeviceData(mac, common.MakeDeviceHeartBeatTopic(mac), status)
 }
 
 /******************************************************************************
@@ -360,46 +470,39 @@ func askAllRealData() {
 
 /******************************************************************************
  * function: cleanupOldRealDataTbl
- * description: clean up expired real data exceed 24 hours
+ * description: clean up expired real data exceed 30 days,
+ * partitioned tables are expired by MaintainPartitions
  * return {*}
 ********************************************************************************/
 func cleanupOldRealDataTbl() {
-	// cleanup lamp table
 	var tmDiff = time.Now().Add(-24 * 30 * time.Hour).Format(cfg.TmFmtStr)
-	sql := "delete from " + common.LampRealDataTbl + " where create_time<?"
-	_, err := mDb.Exec(sql, tmDiff)
-	if err != nil {
-		mylog.Log.Errorln(err)
-	}
-	// cleanup x1 table
-	sql = "delete from " + common.DeviceRecordTbl(X1Type) + " where create_time<?"
-	_, err = mDb.Exec(sql, tmDiff)
-	if err != nil {
-		mylog.Log.Errorln(err)
-	}
-	// cleanup ed713 table
-	sql = "delete from " + common.DeviceRecordTbl(Ed713Type) + " where create_time<?"
-	_, err = mDb.Exec(sql, tmDiff)
-	if err != nil {
-		mylog.Log.Errorln(err)
-	}
-	// cleanup x1 json table
-	sql = "delete from " + common.DeviceDayReportJsonTbl(X1Type) + " where create_time<?"
-	_, err = mDb.Exec(sql, tmDiff)
-	if err != nil {
-		mylog.Log.Errorln(err)
-	}
-	// cleanup h03 attr old data
-	sql = "delete from " + H03AttrData{}.TableName() + " where create_time<?"
-	_, err = mDb.Exec(sql, tmDiff)
-	if err != nil {
-		mylog.Log.Errorln(err)
-	}
-	// clean h03 event old data
-	sql = "delete from " + H03Event{}.TableName() + " where create_time<?"
-	_, err = mDb.Exec(sql, tmDiff)
-	if err != nil {
-		mylog.Log.Errorln(err)
+	tables := []string{
+		// cleanup lamp table
+		common.LampRealDataTbl,
+		// cleanup x1 table
+		common.DeviceRecordTbl(X1Type),
+		// cleanup ed713 table
+		common.DeviceRecordTbl(Ed713Type),
+		// cleanup x1 json table
+		common.DeviceDayReportJsonTbl(X1Type),
+		// cleanup h03 attr old data
+		H03AttrData{}.TableName(),
+		// clean h03 event old data
+		H03Event{}.TableName(),
+		// cleanup webhook delivery log
+		common.WebhookDeliveryTbl,
+		// cleanup notify attempt log
+		common.NotifyAttemptTbl,
+	}
+	for _, tbl := range tables {
+		if IsPartitionedTable(tbl) {
+			continue
+		}
+		sql := "delete from " + tbl + " where create_time<?"
+		_, err := mDb.Exec(sql, tmDiff)
+		if err != nil {
+			mylog.Log.Errorln(err)
+		}
 	}
 }
 
@@ -530,43 +633,243 @@ func UnsubscribeDeviceTopic(mac string) {
 
 /********************************************************************
 * 分页查询功能
-* 通过limit, skip 实现简单分页
-* pageNo==1时返回总页数
+* 通过limit, offset 实现页号分页, page.KeySet为true时使用游标分页
+* page.WithTotal为true时统计总记录数和总页数
+* 缺省从主库读取, opts传ReadReplica时可以从从库读取
 ********************************************************************/
-func QueryPage(table string, page *common.PageDao, filter interface{}, sort interface{}, cb func(*sql.Rows)) bool {
-	// 先获取总记录数，计算总页数
-	totalPages := int64(0)
-	totalCount := int64(0)
-	countSql := fmt.Sprintf("select count(*) from %s", table)
+func QueryPage(table string, page *common.PageDao, filter interface{}, sort interface{}, cb func(*sql.Rows), opts ...ReadOption) bool {
+	db := readDBFor(opts)
+	if page.PageSize <= 0 {
+		page.PageSize = 10
+	}
+	if page.KeySet {
+		column, order, ok := cursorSortKey(table, sort, page)
+		if !ok {
+			return false
+		}
+		return queryPageByCursor(db, table, page, filter, column, order, cb)
+	}
+	var where string
 	if filter != nil && len(filter.(string)) > 0 {
-		countSql += " where " + filter.(string)
+		where = " where " + filter.(string)
+	}
+	if page.PageNo <= 0 {
+		page.PageNo = 1
+	}
+	// 先获取总记录数，计算总页数
+	if page.WithTotal {
+		if !queryPageTotal(db, table, where, page) {
+			return false
+		}
+		if page.TotalPages > 0 && page.PageNo > page.TotalPages {
+			page.PageNo = page.TotalPages
+		}
+	} else {
+		page.TotalCount = -1
+		page.TotalPages = -1
 	}
-	row := mDb.QueryRow(countSql)
-	err := row.Scan(&totalCount)
+	// 根据页数查询数据
+	sql := "select * from " + table + where
+	if sort != nil && len(sort.(string)) > 0 {
+		sql += " order by " + sort.(string)
+	}
+	sql += fmt.Sprintf(" limit %d offset %d", page.PageSize, page.Offset())
+	mylog.Log.Debugln(sql)
+	rows, err := db.Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
 	}
-	if page.PageSize <= 0 {
-		page.PageSize = 10
+	defer rows.Close()
+	for rows.Next() {
+		cb(rows)
 	}
-	totalPages = int64(float32(totalCount)/float32(page.PageSize) + float32(0.9))
-	page.TotalPages = totalPages
-	// 根据页数查询数据
-	if page.PageNo <= 0 {
-		page.PageNo = 1
-	} else if page.PageNo > totalPages {
-		page.PageNo = totalPages
+	return true
+}
+
+/******************************************************************************
+ * function: queryPageTotal
+ * description: 统计总记录数和总页数
+ * param {*sql.DB} db
+ * param {string} table
+ * param {string} where
+ * param {*common.PageDao} page
+ * return {*}
+********************************************************************************/
+func queryPageTotal(db *sql.DB, table string, where string, page *common.PageDao) bool {
+	countSql := "select count(*) from " + table + where
+	row := db.QueryRow(countSql)
+	err := row.Scan(&page.TotalCount)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
 	}
-	sql := "select * from " + table
-	if filter != nil && len(filter.(string)) > 0 {
-		sql += " where " + filter.(string)
+	page.TotalPages = common.CalcTotalPages(page.TotalCount, page.PageSize)
+	return true
+}
+
+// 表的字段是否存在, key为 表名.字段名
+var tableColumns sync.Map
+
+// tableHasColumn 查询表是否有该字段, 启动时的迁移也用它判断是否需要增加字段.
+// 只缓存存在的字段, 迁移增加字段后不需要清除缓存
+func tableHasColumn(table string, column string) bool {
+	key := table + "." + column
+	if _, ok := tableColumns.Load(key); ok {
+		return true
+	}
+	var count int
+	row := mDb.QueryRow("select count(*) from information_schema.columns "+
+		"where table_schema=database() and table_name=? and column_name=?", table, column)
+	if err := row.Scan(&count); err != nil {
+		mylog.Log.Errorln("query column error:", err)
+		return false
+	}
+	if count > 0 {
+		tableColumns.Store(key, true)
 	}
+	return count > 0
+}
+
+/******************************************************************************
+ * function: cursorSortKey
+ * description: 游标分页的排序字段和方向, 使用调用者排序的第一个字段, 调用者没有排序时使用create_time.
+ * 请求指定了page.Order时按请求的方向, 否则按调用者排序的方向, 缺省降序. 字段不存在时拒绝游标分页
+ * param {string} table
+ * param {interface{}} sort
+ * param {*common.PageDao} page
+ * return {*} 字段, 排序方向, 是否可以使用游标分页
+********************************************************************************/
+func cursorSortKey(table string, sort interface{}, page *common.PageDao) (string, string, bool) {
+	column := "create_time"
+	order := common.PageOrderDesc
 	if sort != nil && len(sort.(string)) > 0 {
-		sql += " order by " + sort.(string)
+		first, _, _ := strings.Cut(sort.(string), ",")
+		items := strings.Fields(first)
+		if len(items) == 0 || len(items) > 2 || !cursorColumnRegexp.MatchString(items[0]) {
+			mylog.Log.Errorln("cursor page not supported by sort:", sort)
+			return "", "", false
+		}
+		column = items[0]
+		if len(items) == 2 {
+			if !strings.EqualFold(items[1], common.PageOrderAsc) && !strings.EqualFold(items[1], common.PageOrderDesc) {
+				mylog.Log.Errorln("cursor page not supported by sort:", sort)
+				return "", "", false
+			}
+			order = strings.ToLower(items[1])
+		}
 	}
-	sql += fmt.Sprintf(" limit %d offset %d", page.PageSize, page.PageNo-1)
-	rows, err := mDb.Query(sql)
+	if page.Order != "" {
+		order = common.PageOrderDesc
+		if page.IsAsc() {
+			order = common.PageOrderAsc
+		}
+	}
+	if !tableHasColumn(table, column) {
+		mylog.Log.Errorf("cursor page not supported, table %s has no column %s", table, column)
+		return "", "", false
+	}
+	return column, order, true
+}
+
+// 游标分页的排序字段只能是普通字段名
+var cursorColumnRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+/******************************************************************************
+ * function: queryPageByCursor
+ * description: 按(排序字段, id)实现游标分页, 排序字段为id时只按id
+ * 先按索引取出本页的id和下一页游标, 再按id取整行数据, 避免大offset扫描
+ * param {*sql.DB} db
+ * param {string} table
+ * param {*common.PageDao} page
+ * param {interface{}} filter
+ * param {string} column 排序字段
+ * param {string} order 排序方向
+ * param {func(*sql.Rows)} cb
+ * return {*}
+********************************************************************************/
+func queryPageByCursor(db *sql.DB, table string, page *common.PageDao, filter interface{}, column string, order string,
+	cb func(*sql.Rows)) bool {
+	cmp := "<"
+	if order == common.PageOrderAsc {
+		cmp = ">"
+	}
+	var conds []string
+	var args []interface{}
+	if filter != nil && len(filter.(string)) > 0 {
+		conds = append(conds, "("+filter.(string)+")")
+	}
+	if page.WithTotal {
+		var where string
+		if len(conds) > 0 {
+			where = " where " + conds[0]
+		}
+		if !queryPageTotal(db, table, where, page) {
+			return false
+		}
+	} else {
+		page.TotalCount = -1
+		page.TotalPages = -1
+	}
+	if page.Cursor != "" {
+		value, id, err := common.DecodePageCursor(page.Cursor)
+		if err != nil {
+			mylog.Log.Errorln(err)
+			return false
+		}
+		if column == "id" {
+			conds = append(conds, fmt.Sprintf("id %s ?", cmp))
+			args = append(args, id)
+		} else {
+			conds = append(conds, fmt.Sprintf("(%[1]s %[2]s ? or (%[1]s = ? and id %[2]s ?))", column, cmp))
+			args = append(args, value, value, id)
+		}
+	}
+	orderBy := fmt.Sprintf(" order by %s %s, id %s", column, order, order)
+	if column == "id" {
+		orderBy = fmt.Sprintf(" order by id %s", order)
+	}
+	keySql := fmt.Sprintf("select id, %s from %s", column, table)
+	if len(conds) > 0 {
+		keySql += " where " + strings.Join(conds, " and ")
+	}
+	// 多取一条用来判断是否还有下一页
+	keySql += orderBy + fmt.Sprintf(" limit %d", page.PageSize+1)
+	mylog.Log.Debugln(keySql)
+	keyRows, err := db.Query(keySql, args...)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	var ids []string
+	var lastValue string
+	var lastId int64
+	hasMore := false
+	for keyRows.Next() {
+		var id int64
+		var value sql.NullString
+		if err := keyRows.Scan(&id, &value); err != nil {
+			mylog.Log.Errorln(err)
+			continue
+		}
+		if int64(len(ids)) >= page.PageSize {
+			hasMore = true
+			break
+		}
+		ids = append(ids, strconv.FormatInt(id, 10))
+		lastValue = value.String
+		lastId = id
+	}
+	keyRows.Close()
+	page.NextCursor = ""
+	if hasMore {
+		page.NextCursor = common.EncodePageCursor(lastValue, lastId)
+	}
+	if len(ids) == 0 {
+		return true
+	}
+	sql := "select * from " + table + " where id in (" + strings.Join(ids, ",") + ")" + orderBy
+	rows, err := db.Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -580,9 +883,9 @@ func QueryPage(table string, page *common.PageDao, filter interface{}, sort inte
 
 /*
  * func Query, support method for any query
- *
+ * 缺省从主库读取, opts传ReadReplica时可以从从库读取
  */
-func QueryDao(table string, filter interface{}, sort interface{}, limited int, cb func(*sql.Rows)) bool {
+func QueryDao(table string, filter interface{}, sort interface{}, limited int, cb func(*sql.Rows), opts ...ReadOption) bool {
 	if !CheckTableExist(table) {
 		return false
 	}
@@ -597,7 +900,7 @@ func QueryDao(table string, filter interface{}, sort interface{}, limited int, c
 		sql += " limit " + strconv.FormatInt(int64(limited), 10)
 	}
 	mylog.Log.Debugln(sql)
-	rows, err := mDb.Query(sql)
+	rows, err := readDBFor(opts).Query(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -793,6 +1096,22 @@ func CreateTableWithStruct(tblName string, obj interface{}) bool {
 * insert...
  */
 func InsertDao(tblName string, obj Dao) bool {
+	return insertDao(mDb, tblName, obj)
+}
+
+/******************************************************************************
+ * function: InsertDaoTx
+ * description: 在事务中插入记录
+ * param {*sql.Tx} tx
+ * param {string} tblName
+ * param {Dao} obj
+ * return {*}
+********************************************************************************/
+func InsertDaoTx(tx *sql.Tx, tblName string, obj Dao) bool {
+	return insertDao(tx, tblName, obj)
+}
+
+func insertDao(db DbExecutor, tblName string, obj Dao) bool {
 	sql := fmt.Sprintf("insert into %s ", tblName)
 	u := reflect.TypeOf(obj)
 	vf := reflect.ValueOf(obj)
@@ -865,7 +1184,7 @@ func InsertDao(tblName string, obj Dao) bool {
 		}
 	}
 	sql += fmt.Sprintf(" (%s) values (%s)", fields, values)
-	result, err := mDb.Exec(sql)
+	result, err := db.Exec(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		mylog.Log.Errorln(sql)
@@ -884,6 +1203,23 @@ func InsertDao(tblName string, obj Dao) bool {
 * updateDaoById...
  */
 func UpdateDaoByID(tblName string, id int64, obj Dao) bool {
+	return updateDaoByID(mDb, tblName, id, obj)
+}
+
+/******************************************************************************
+ * function: UpdateDaoByIDTx
+ * description: 在事务中根据id更新记录
+ * param {*sql.Tx} tx
+ * param {string} tblName
+ * param {int64} id
+ * param {Dao} obj
+ * return {*}
+********************************************************************************/
+func UpdateDaoByIDTx(tx *sql.Tx, tblName string, id int64, obj Dao) bool {
+	return updateDaoByID(tx, tblName, id, obj)
+}
+
+func updateDaoByID(db DbExecutor, tblName string, id int64, obj Dao) bool {
 	sql := fmt.Sprintf("update %s ", tblName)
 	u := reflect.TypeOf(obj)
 	vf := reflect.ValueOf(obj)
@@ -953,7 +1289,7 @@ func UpdateDaoByID(tblName string, id int64, obj Dao) bool {
 		}
 	}
 	sql += fmt.Sprintf(" set %s where id=%d", setsql, id)
-	result, err := mDb.Exec(sql)
+	result, err := db.Exec(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -971,8 +1307,24 @@ func UpdateDaoByID(tblName string, id int64, obj Dao) bool {
 * deleteDaoByID...
  */
 func DeleteDaoByID(tblName string, id int64) bool {
+	return deleteDaoByID(mDb, tblName, id)
+}
+
+/******************************************************************************
+ * function: DeleteDaoByIDTx
+ * description: 在事务中根据id删除记录
+ * param {*sql.Tx} tx
+ * param {string} tblName
+ * param {int64} id
+ * return {*}
+********************************************************************************/
+func DeleteDaoByIDTx(tx *sql.Tx, tblName string, id int64) bool {
+	return deleteDaoByID(tx, tblName, id)
+}
+
+func deleteDaoByID(db DbExecutor, tblName string, id int64) bool {
 	sql := fmt.Sprintf("delete from %s where id=%d", tblName, id)
-	result, err := mDb.Exec(sql)
+	result, err := db.Exec(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -992,8 +1344,28 @@ func DeleteDaoByID(tblName string, id int64) bool {
  * return {*}
 ********************************************************************************/
 func DeleteDaoByFilter(tblName string, filter string) bool {
+	return deleteDaoByFilter(mDb, tblName, filter)
+}
+
+/******************************************************************************
+ * function: DeleteDaoByFilterTx
+ * description: 在事务中根据条件删除记录
+ * param {*sql.Tx} tx
+ * param {string} tblName
+ * param {string} filter
+ * return {*}
+********************************************************************************/
+func DeleteDaoByFilterTx(tx *sql.Tx, tblName string, filter string) bool {
+	return deleteDaoByFilter(tx, tblName, filter)
+}
+
+func deleteDaoByFilter(db DbExecutor, tblName string, filter string) bool {
+	if len(strings.TrimSpace(filter)) == 0 {
+		mylog.Log.Errorln("delete from", tblName, "without filter is not allowed")
+		return false
+	}
 	sql := fmt.Sprintf("delete from %s where %s", tblName, filter)
-	result, err := mDb.Exec(sql)
+	result, err := db.Exec(sql)
 	if err != nil {
 		mylog.Log.Errorln(err)
 		return false
@@ -1008,50 +1380,93 @@ func DeleteDaoByFilter(tblName string, filter string) bool {
 }
 
 /******************************************************************************
- * function: SendSleepAlarmSms
- * description: send alarm sms to user
- * param {*UserDeviceAlarm} userAlarm
+ * function: notifySleepAlarm
+ * description: 按路由把睡眠设备的告警事件通知给用户
+ * param {string} eventId 同一事件通知多个用户时相同
+ * param {*HeartEvent} userEvent
  * return {*}
 ********************************************************************************/
-func SendSleepAlarmSms(userEvent *HeartEvent) {
-	if userEvent == nil || userEvent.EmergentPhone == "" {
-		return
-	}
-	alarmDesc := common.GetSleepAlarmDesc(userEvent.EmergentPhone, userEvent.Type)
-	if len(alarmDesc) == 0 {
-		return
-	}
-	if userEvent.Type == 3001 || userEvent.Type == 3012 {
-		return
-	}
-	err := sms.SendSms(userEvent.EmergentPhone, userEvent.NickName, alarmDesc)
-	if err != nil {
-		mylog.Log.Errorln(err)
-	}
+func notifySleepAlarm(eventId string, userEvent *HeartEvent) {
+	data := *userEvent
+	notify.Notify(userEvent.UserId, &notify.Event{
+		ID:         eventId,
+		Type:       notify.EventSleepAlarm,
+		Mac:        userEvent.Mac,
+		DeviceType: userEvent.DeviceType,
+		NickName:   userEvent.NickName,
+		DeviceName: userEvent.DeviceName,
+		Code:       userEvent.Type,
+		CreateTime: userEvent.CreateTime,
+		Data:       &data,
+	})
 }
 
 /******************************************************************************
- * function: SendSleepNotifySms
- * description: send notify sms to user
+ * function: notifyVitalStatus
+ * description: 按路由把有人、呼吸、心率提醒通知给设备的所有用户
  * param {string} mac
  * param {int} notifyType
  * param {int} status
+ * param {int} value 提醒时的呼吸或心率
+ * param {string} tm
  * return {*}
 ********************************************************************************/
-func SendSleepNotifySms(mac string, notifyType int, status int) {
+func notifyVitalStatus(mac string, notifyType int, status int, value int, tm string) {
 	var userDevices []UserDeviceDetail
 	QueryUserDeviceDetailByMac(mac, &userDevices)
-	if len(userDevices) > 0 {
-		phone := userDevices[0].EmergentPhone
-		nickName := userDevices[0].NickName
-		desc := common.GetNotifyStatusDesc(phone, notifyType, status)
-		if len(desc) == 0 {
-			return
-		}
-		err := sms.SendSms(phone, nickName, desc)
-		if err != nil {
-			mylog.Log.Errorln(err)
-		}
+	eventId := common.GenerateUUID()
+	for _, userDevice := range userDevices {
+		notify.Notify(userDevice.UserId, &notify.Event{
+			ID:         eventId,
+			Type:       notify.EventVitalNotify,
+			Mac:        mac,
+			DeviceType: userDevice.DeviceType,
+			NickName:   userDevice.NickName,
+			DeviceName: userDevice.DeviceName,
+			Code:       notifyType,
+			Status:     status,
+			Value:      value,
+			CreateTime: tm,
+		})
+	}
+}
+
+// SleepReportNotify 睡眠报告通知携带的数据，供邮件模板使用
+type SleepReportNotify struct {
+	GoBedTime       string `json:"go_bed_time"`
+	LeaveBedTime    string `json:"leave_bed_time"`
+	BaseRespiratory int    `json:"base_respiratory"`
+	BaseHeartRate   int    `json:"base_heart_rate"`
+}
+
+/******************************************************************************
+ * function: notifySleepReport
+ * description: 睡眠报告生成后通知设备的所有用户
+ * param {string} mac
+ * param {string} startTime 睡眠开始时间
+ * param {string} endTime 睡眠结束时间
+ * param {int} evaluation 睡眠评分
+ * param {*SleepReportNotify} data
+ * return {*}
+********************************************************************************/
+func notifySleepReport(mac string, startTime string, endTime string, evaluation int, data *SleepReportNotify) {
+	var userDevices []UserDeviceDetail
+	QueryUserDeviceDetailByMac(mac, &userDevices)
+	eventId := common.GenerateUUID()
+	for _, userDevice := range userDevices {
+		notify.Notify(userDevice.UserId, &notify.Event{
+			ID:         eventId,
+			Type:       notify.EventSleepReport,
+			Mac:        mac,
+			DeviceType: userDevice.DeviceType,
+			NickName:   userDevice.NickName,
+			DeviceName: userDevice.DeviceName,
+			Score:      evaluation,
+			StartTime:  startTime,
+			EndTime:    endTime,
+			CreateTime: common.GetNowTime(),
+			Data:       data,
+		})
 	}
 }
 
@@ -1106,13 +1521,16 @@ func CheckDiffBetweenTwoLampDeviceRecords(deviceType string, mac string, obj *Re
 
 /******************************************************************************
  * function: GetUserToken
- * description: 创建用户的token，创建后保存到redis，并设置过期时间为3个月
+ * description: 创建用户的旧格式token，创建后保存到redis，并设置过期时间为3个月,
+ * 没有配置jwt密钥时使用
  * param {*User} user
  * return {*}
 ********************************************************************************/
 type UserToken struct {
 	UserID int64  `json:"user_id"`
 	Phone  string `json:"phone"`
+	// JWT会话id, 旧的AES token为空
+	SessionId string `json:"session_id,omitempty"`
 }
 
 func GetUserToken(user *User) (string, error) {
@@ -1143,26 +1561,70 @@ func GetUserToken(user *User) (string, error) {
  * return {*}
 ********************************************************************************/
 func VerifyUserToken(token string) bool {
+	_, ok := ParseUserToken(token)
+	return ok
+}
+
+/******************************************************************************
+ * function: ParseUserToken
+ * description: 解析并校验token, 成功时返回token中的用户信息,
+ * 旧的AES token只在legacy_token_deadline之前接受
+ * param {string} token
+ * return {*}
+********************************************************************************/
+func ParseUserToken(token string) (*UserToken, bool) {
+	if common.IsJwtToken(token) {
+		claims, err := common.ParseJwt(token, jwtKey)
+		if err != nil {
+			mylog.Log.Errorln(err)
+			return nil, false
+		}
+		if isSessionRevoked(claims.Sid) {
+			mylog.Log.Errorln("session revoked", claims.Sid)
+			return nil, false
+		}
+		return &UserToken{UserID: claims.Sub, Phone: claims.Phone, SessionId: claims.Sid}, true
+	}
+	if !legacyTokenAllowed() {
+		mylog.Log.Errorln("legacy token is no longer accepted")
+		return nil, false
+	}
 	js, err := common.DecryptDataNoCBCWithDefaultkey(token)
 	if err != nil {
 		mylog.Log.Errorln(err)
-		return false
+		return nil, false
 	}
 	userToken := &UserToken{}
 	err = json.Unmarshal([]byte(js), userToken)
 	if err != nil {
 		mylog.Log.Errorln(err)
-		return false
+		return nil, false
 	}
 	tokenKey := fmt.Sprintf("%s_%d", common.UserTbl, userToken.UserID)
 	tokenInRedis, err := redis.GetValue(tokenKey)
 	if err != nil || tokenInRedis == "" {
 		mylog.Log.Errorln("token not found in redis")
-		return false
+		return nil, false
 	}
 	if tokenInRedis != token {
 		mylog.Log.Errorln("token not match")
-		return false
+		return nil, false
 	}
-	return true
+	return userToken, true
+}
+
+/******************************************************************************
+ * function: IssueUserToken
+ * description: 登录成功后为当前设备创建会话并返回access token和refresh token,
+ * 没有jwt签名密钥时不签发. 设备信息取自X-Device-Id和X-Device-Name请求头
+ * param {*gin.Context} c
+ * param {*User} user
+ * return {*}
+********************************************************************************/
+func IssueUserToken(c *gin.Context, user *User) (*UserTokenPair, bool) {
+	deviceName := c.GetHeader("X-Device-Name")
+	if deviceName == "" {
+		deviceName = c.Request.UserAgent()
+	}
+	return CreateUserSession(user, c.GetHeader("X-Device-Id"), deviceName, c.ClientIP())
 }
@@ -0,0 +1,600 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/exception"
+	"hjyserver/gopool"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/notify"
+	"hjyserver/redis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define rule metric
+const (
+	// 心率, 睡眠设备和学习设备
+	RuleMetricHeartRate = "heart_rate"
+	// 呼吸, 睡眠设备和学习设备
+	RuleMetricRespiratory = "respiratory"
+	// 有人无人状态, 睡眠设备和学习设备
+	RuleMetricBodyStatus = "body_status"
+	// 学习设备的专注状态, 0:离开 1-3:浅 4-6:中 7-9:深 10:异常
+	RuleMetricConcentration = "concentration"
+	// 当天的学习时长, 单位分钟
+	RuleMetricStudyTime = "study_time"
+	// T1的坐姿状态
+	RuleMetricPosture = "posture"
+)
+
+// 各类设备上报的指标
+var ruleDeviceMetrics = map[string][]string{
+	X1Type:    {RuleMetricHeartRate, RuleMetricRespiratory, RuleMetricBodyStatus},
+	Ed713Type: {RuleMetricHeartRate, RuleMetricRespiratory, RuleMetricBodyStatus},
+	H03Type:   {RuleMetricHeartRate, RuleMetricRespiratory, RuleMetricBodyStatus, RuleMetricConcentration, RuleMetricStudyTime},
+	T1Type: {RuleMetricHeartRate, RuleMetricRespiratory, RuleMetricBodyStatus, RuleMetricConcentration, RuleMetricStudyTime,
+		RuleMetricPosture},
+}
+
+// define rule operator
+const (
+	RuleOpGt = "gt"
+	RuleOpGe = "ge"
+	RuleOpLt = "lt"
+	RuleOpLe = "le"
+	RuleOpEq = "eq"
+	RuleOpNe = "ne"
+	// 在value和value2之间, 包括两端
+	RuleOpBetween = "between"
+	// 小于value或者大于value2
+	RuleOpOutside = "outside"
+)
+
+// define rule action
+const (
+	RuleActionNotify  = "notify"
+	RuleActionWebhook = "webhook"
+	RuleActionCommand = "command"
+)
+
+// define rule command
+const (
+	// H03和T1重启
+	RuleCommandReboot = "reboot"
+	// H03和T1的设置, 参数为H03Setting或T1Setting
+	RuleCommandSetting = "setting"
+	// X1的睡眠灯开关, 参数为{"switch":0/1}
+	RuleCommandSleepSwitch = "sleep_switch"
+	// X1的护理模式开关, 参数为{"switch":0/1}
+	RuleCommandNurseMode = "nurse_mode"
+)
+
+const (
+	// 缺省的重复触发间隔, 单位分钟
+	RuleDefaultCooldown = 30
+	// 超过该时间没有数据时持续状态失效, 重新开始计算, 单位秒
+	ruleSustainGap = 300
+	// 规则缓存的有效期, 其他服务实例修改的规则在有效期后生效
+	ruleCacheTtl = time.Minute
+)
+
+var ErrRuleCommand = errors.New("command not supported by device")
+
+// swagger:model MetricRule
+type MetricRule struct {
+	ID int64 `json:"id" mysql:"id"`
+	// 创建规则的用户, 通知发送给该用户
+	UserId int64  `json:"user_id" mysql:"user_id"`
+	Mac    string `json:"mac" mysql:"mac"`
+	Name   string `json:"name" mysql:"name"`
+	// heart_rate/respiratory/body_status/concentration/study_time/posture
+	Metric string `json:"metric" mysql:"metric"`
+	// gt/ge/lt/le/eq/ne/between/outside
+	Operator string `json:"operator" mysql:"operator"`
+	Value    int    `json:"value" mysql:"value"`
+	// between和outside的上限
+	Value2 int `json:"value2" mysql:"value2"`
+	// 条件持续多少分钟后触发, 0为立即触发
+	Sustain int `json:"sustain" mysql:"sustain"`
+	// 生效时段, 格式15:04, 开始晚于结束时跨过零点, 都为空时全天生效
+	ActiveStart string `json:"active_start" mysql:"active_start"`
+	ActiveEnd   string `json:"active_end" mysql:"active_end"`
+	// 动作, 逗号分隔, notify/webhook/command
+	Actions string `json:"actions" mysql:"actions"`
+	// 设备命令, X1: sleep_switch/nurse_mode, H03和T1: reboot/setting
+	Command string `json:"command" mysql:"command"`
+	// 命令参数, json格式
+	CommandParams string `json:"command_params" mysql:"command_params"`
+	// 条件一直满足时重复触发的间隔, 单位分钟
+	Cooldown int `json:"cooldown" mysql:"cooldown"`
+	// 0:停用 1:启用
+	Enabled int `json:"enabled" mysql:"enabled"`
+	// 最近触发时间, 没有触发过时为空
+	LastTriggerTime *string `json:"last_trigger_time" mysql:"last_trigger_time" isnull:"true"`
+	CreateTime      string  `json:"create_time" mysql:"create_time"`
+	UpdateTime      string  `json:"update_time" mysql:"update_time"`
+}
+
+func NewMetricRule() *MetricRule {
+	return &MetricRule{
+		ID:              0,
+		UserId:          0,
+		Mac:             "",
+		Name:            "",
+		Metric:          "",
+		Operator:        "",
+		Value:           0,
+		Value2:          0,
+		Sustain:         0,
+		ActiveStart:     "",
+		ActiveEnd:       "",
+		Actions:         RuleActionNotify,
+		Command:         "",
+		CommandParams:   "",
+		Cooldown:        RuleDefaultCooldown,
+		Enabled:         1,
+		LastTriggerTime: nil,
+		CreateTime:      common.GetNowTime(),
+		UpdateTime:      common.GetNowTime(),
+	}
+}
+
+func (me *MetricRule) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *MetricRule) DecodeFromRows(rows *sql.Rows) error {
+	var lastTriggerTime sql.NullString
+	err := rows.Scan(&me.ID, &me.UserId, &me.Mac, &me.Name, &me.Metric, &me.Operator, &me.Value, &me.Value2, &me.Sustain,
+		&me.ActiveStart, &me.ActiveEnd, &me.Actions, &me.Command, &me.CommandParams, &me.Cooldown, &me.Enabled,
+		&lastTriggerTime, &me.CreateTime, &me.UpdateTime)
+	if lastTriggerTime.Valid {
+		me.LastTriggerTime = &lastTriggerTime.String
+	}
+	return err
+}
+func (me *MetricRule) DecodeFromRow(row *sql.Row) error {
+	var lastTriggerTime sql.NullString
+	err := row.Scan(&me.ID, &me.UserId, &me.Mac, &me.Name, &me.Metric, &me.Operator, &me.Value, &me.Value2, &me.Sustain,
+		&me.ActiveStart, &me.ActiveEnd, &me.Actions, &me.Command, &me.CommandParams, &me.Cooldown, &me.Enabled,
+		&lastTriggerTime, &me.CreateTime, &me.UpdateTime)
+	if lastTriggerTime.Valid {
+		me.LastTriggerTime = &lastTriggerTime.String
+	}
+	return err
+}
+func (me *MetricRule) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.MetricRuleTbl, me.ID, me)
+}
+func (me *MetricRule) Insert() bool {
+	tblName := common.MetricRuleTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			user_id bigint not null comment '用户id',
+			mac varchar(32) not null comment 'mac地址',
+			name varchar(64) default '' comment '规则名称',
+			metric varchar(32) not null comment '指标',
+			operator varchar(16) not null comment '比较方式',
+			value int not null default 0 comment '阈值',
+			value2 int not null default 0 comment '区间上限',
+			sustain int not null default 0 comment '持续分钟数',
+			active_start varchar(8) default '' comment '生效时段开始',
+			active_end varchar(8) default '' comment '生效时段结束',
+			actions varchar(64) not null comment '动作',
+			command varchar(32) default '' comment '设备命令',
+			command_params varchar(512) default '' comment '命令参数',
+			cooldown int not null default 30 comment '重复触发间隔分钟数',
+			enabled int not null default 1 comment '0:停用 1:启用',
+			last_trigger_time datetime comment '最近触发时间',
+			create_time datetime comment '创建时间',
+			update_time datetime comment '更新时间',
+			PRIMARY KEY (id),
+			INDEX idx_mac (mac),
+			INDEX idx_user_id (user_id)
+		)`
+		CreateTable(sql)
+	}
+	// 名称和命令参数由用户输入, 需要转义后才能拼接到sql中
+	obj := *me
+	obj.Name = common.EscapeSql(me.Name)
+	obj.CommandParams = common.EscapeSql(me.CommandParams)
+	if !InsertDao(tblName, &obj) {
+		return false
+	}
+	me.ID = obj.ID
+	invalidateMetricRules(me.Mac)
+	return true
+}
+func (me *MetricRule) Update() bool {
+	obj := *me
+	obj.Name = common.EscapeSql(me.Name)
+	obj.CommandParams = common.EscapeSql(me.CommandParams)
+	if !UpdateDaoByID(common.MetricRuleTbl, me.ID, &obj) {
+		return false
+	}
+	invalidateMetricRules(me.Mac)
+	return true
+}
+func (me *MetricRule) Delete() bool {
+	if !DeleteDaoByID(common.MetricRuleTbl, me.ID) {
+		return false
+	}
+	invalidateMetricRules(me.Mac)
+	return true
+}
+func (me *MetricRule) SetID(id int64) {
+	me.ID = id
+}
+
+// Match 检查指标的值是否满足规则的条件
+func (me *MetricRule) Match(v int) bool {
+	switch me.Operator {
+	case RuleOpGt:
+		return v > me.Value
+	case RuleOpGe:
+		return v >= me.Value
+	case RuleOpLt:
+		return v < me.Value
+	case RuleOpLe:
+		return v <= me.Value
+	case RuleOpEq:
+		return v == me.Value
+	case RuleOpNe:
+		return v != me.Value
+	case RuleOpBetween:
+		return v >= me.Value && v <= me.Value2
+	case RuleOpOutside:
+		return v < me.Value || v > me.Value2
+	}
+	return false
+}
+
+// ActiveAt 检查指定时间是否在规则的生效时段内
+func (me *MetricRule) ActiveAt(t time.Time) bool {
+	if me.ActiveStart == "" && me.ActiveEnd == "" {
+		return true
+	}
+	return inDayPeriod(t, me.ActiveStart, me.ActiveEnd)
+}
+
+// HasAction 检查规则是否包含指定的动作
+func (me *MetricRule) HasAction(action string) bool {
+	for _, v := range strings.Split(me.Actions, ",") {
+		if v == action {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRuleOperator 检查比较方式是否支持
+func IsRuleOperator(op string) bool {
+	switch op {
+	case RuleOpGt, RuleOpGe, RuleOpLt, RuleOpLe, RuleOpEq, RuleOpNe, RuleOpBetween, RuleOpOutside:
+		return true
+	}
+	return false
+}
+
+// IsRuleAction 检查动作是否支持
+func IsRuleAction(action string) bool {
+	switch action {
+	case RuleActionNotify, RuleActionWebhook, RuleActionCommand:
+		return true
+	}
+	return false
+}
+
+// DeviceSupportsMetric 检查设备类型是否上报该指标
+func DeviceSupportsMetric(deviceType string, metric string) bool {
+	for _, v := range ruleDeviceMetrics[deviceType] {
+		if v == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleMetricsOf 设备类型上报的指标
+func RuleMetricsOf(deviceType string) []string {
+	return ruleDeviceMetrics[deviceType]
+}
+
+/******************************************************************************
+ * function: ParseRuleCommand
+ * description: 解析设备命令和参数, 返回发送命令的函数, 保存规则时用于检查命令
+ * param {string} deviceType
+ * param {string} name 命令名称
+ * param {string} params json格式的参数
+ * return {*}
+********************************************************************************/
+func ParseRuleCommand(deviceType string, name string, params string) (func(mac string), error) {
+	type switchParams struct {
+		Switch int `json:"switch"`
+	}
+	decode := func(v interface{}) error {
+		if params == "" {
+			return nil
+		}
+		return json.Unmarshal([]byte(params), v)
+	}
+	switch {
+	case deviceType == X1Type && (name == RuleCommandSleepSwitch || name == RuleCommandNurseMode):
+		p := &switchParams{}
+		if err := decode(p); err != nil {
+			return nil, err
+		}
+		if p.Switch != 0 && p.Switch != 1 {
+			return nil, errors.New("switch must be 0 or 1")
+		}
+		if name == RuleCommandSleepSwitch {
+			return func(mac string) { SleepX1Switch(mac, p.Switch) }, nil
+		}
+		return func(mac string) { NurseModeX1Switch(mac, p.Switch) }, nil
+	case deviceType == H03Type && name == RuleCommandReboot:
+		return func(mac string) { H03RebootRequest(mac, 0) }, nil
+	case deviceType == H03Type && name == RuleCommandSetting:
+		setting := &H03Setting{}
+		if err := decode(setting); err != nil {
+			return nil, err
+		}
+		return func(mac string) { H03SettingRequest(mac, setting) }, nil
+	case deviceType == T1Type && name == RuleCommandReboot:
+		return func(mac string) { T1RebootRequest(mac, 0) }, nil
+	case deviceType == T1Type && name == RuleCommandSetting:
+		setting := &T1Setting{}
+		if err := decode(setting); err != nil {
+			return nil, err
+		}
+		return func(mac string) { T1SettingRequest(mac, setting) }, nil
+	}
+	return nil, ErrRuleCommand
+}
+
+func QueryMetricRuleByCond(filter interface{}, sort interface{}, results *[]MetricRule) bool {
+	if !CheckTableExist(common.MetricRuleTbl) {
+		return false
+	}
+	return QueryDao(common.MetricRuleTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewMetricRule()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, ReadPrimary)
+}
+
+/******************************************************************************
+ * function: DeleteUnboundMetricRulesTx
+ * description: 删除已经不能使用设备的用户为该设备定义的规则, 在解除共享、移除设备和过户的事务中,
+ * 修改用户和设备关系之后执行
+ * param {*sql.Tx} tx
+ * param {int64} deviceId
+ * return {*}
+********************************************************************************/
+func DeleteUnboundMetricRulesTx(tx *sql.Tx, deviceId int64) bool {
+	if !CheckTableExist(common.MetricRuleTbl) {
+		return true
+	}
+	var mac string
+	err := tx.QueryRow(fmt.Sprintf("select mac from %s where id=?", common.DeviceTbl), deviceId).Scan(&mac)
+	if err == sql.ErrNoRows {
+		return true
+	} else if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	sqlStr := fmt.Sprintf("delete from %s where mac=? and user_id not in (select user_id from %s where device_id=?)",
+		common.MetricRuleTbl, common.UserDeviceRelationTbl)
+	result, err := tx.Exec(sqlStr, mac, deviceId)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	invalidateMetricRules(mac)
+	if n, _ := result.RowsAffected(); n > 0 {
+		mylog.Log.Infof("%d metric rules of %s deleted, users no longer bound", n, mac)
+	}
+	return true
+}
+
+// updateRuleTriggerTime 只更新触发时间, 不覆盖同时修改的规则内容
+func updateRuleTriggerTime(id int64, tm string) {
+	sqlStr := fmt.Sprintf("update %s set last_trigger_time=? where id=?", common.MetricRuleTbl)
+	if _, err := mDb.Exec(sqlStr, tm, id); err != nil {
+		mylog.Log.Errorln(err)
+	}
+}
+
+// 每个设备启用的规则, 数据上报时不查询数据库
+type ruleCacheItem struct {
+	rules    []MetricRule
+	loadTime time.Time
+}
+
+var ruleCache = struct {
+	sync.RWMutex
+	items map[string]*ruleCacheItem
+}{items: make(map[string]*ruleCacheItem)}
+
+// invalidateMetricRules 规则修改后清除设备的缓存
+func invalidateMetricRules(mac string) {
+	ruleCache.Lock()
+	defer ruleCache.Unlock()
+	delete(ruleCache.items, strings.ToLower(mac))
+}
+
+// enabledMetricRules 取得设备启用的规则, 缓存过期后重新查询
+func enabledMetricRules(mac string) []MetricRule {
+	key := strings.ToLower(mac)
+	ruleCache.RLock()
+	item, ok := ruleCache.items[key]
+	ruleCache.RUnlock()
+	if ok && time.Since(item.loadTime) < ruleCacheTtl {
+		return item.rules
+	}
+	rules := make([]MetricRule, 0)
+	QueryMetricRuleByCond(fmt.Sprintf("mac='%s' and enabled=1", common.EscapeSql(mac)), "id", &rules)
+	ruleCache.Lock()
+	ruleCache.items[key] = &ruleCacheItem{rules: rules, loadTime: time.Now()}
+	ruleCache.Unlock()
+	return rules
+}
+
+// RuleTrigger 规则触发时通知和webhook携带的数据
+type RuleTrigger struct {
+	RuleId   int64  `json:"rule_id"`
+	Name     string `json:"name"`
+	Metric   string `json:"metric"`
+	Operator string `json:"operator"`
+	Value    int    `json:"value"`
+	Value2   int    `json:"value2"`
+	Sustain  int    `json:"sustain"`
+	// 指标的当前值
+	Current int `json:"current"`
+	// 条件开始满足的时间
+	Since      string `json:"since"`
+	CreateTime string `json:"create_time"`
+}
+
+/******************************************************************************
+ * function: EvaluateMetricRules
+ * description: 设备上报数据时按设备启用的规则判断, 只包含本次上报的指标, 在任务队列中执行
+ * param {string} mac
+ * param {string} deviceType
+ * param {map[string]int} metrics 指标和值
+ * return {*}
+********************************************************************************/
+func EvaluateMetricRules(mac string, deviceType string, metrics map[string]int) {
+	if len(metrics) == 0 {
+		return
+	}
+	GetTaskPool().Put(&gopool.Task{
+		Params: []interface{}{mac, deviceType, metrics, time.Now()},
+		Do: func(params ...interface{}) {
+			mac := params[0].(string)
+			deviceType := params[1].(string)
+			metrics := params[2].(map[string]int)
+			now := params[3].(time.Time)
+			rules := enabledMetricRules(mac)
+			for i := range rules {
+				if v, ok := metrics[rules[i].Metric]; ok {
+					evaluateMetricRule(&rules[i], deviceType, v, now)
+				}
+			}
+		},
+	})
+}
+
+func ruleSinceKey(id int64) string {
+	return fmt.Sprintf("metric_rule_since_%d", id)
+}
+
+/******************************************************************************
+ * function: evaluateMetricRule
+ * description: 条件满足时记录开始时间, 持续到规定时间后触发, 条件不满足或者超过
+ * ruleSustainGap没有数据时重新计算. 多个服务实例在重复触发间隔内只有一个触发
+ * param {*MetricRule} rule
+ * param {string} deviceType
+ * param {int} value
+ * param {time.Time} now
+ * return {*}
+********************************************************************************/
+func evaluateMetricRule(rule *MetricRule, deviceType string, value int, now time.Time) {
+	sinceKey := ruleSinceKey(rule.ID)
+	if !rule.ActiveAt(now) || !rule.Match(value) {
+		redis.DelValue(sinceKey)
+		return
+	}
+	since := now
+	if v, _ := redis.GetValue(sinceKey); v != "" {
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			since = time.Unix(sec, 0)
+		}
+	}
+	redis.SetValueEx(sinceKey, strconv.FormatInt(since.Unix(), 10), ruleSustainGap)
+	if now.Sub(since) < time.Duration(rule.Sustain)*time.Minute {
+		return
+	}
+	cooldown := rule.Cooldown
+	if cooldown <= 0 {
+		cooldown = RuleDefaultCooldown
+	}
+	n, err := redis.IncrValueEx(fmt.Sprintf("metric_rule_fire_%d", rule.ID), cooldown*60)
+	if err != nil || n > 1 {
+		return
+	}
+	fireMetricRule(rule, deviceType, &RuleTrigger{
+		RuleId:     rule.ID,
+		Name:       rule.Name,
+		Metric:     rule.Metric,
+		Operator:   rule.Operator,
+		Value:      rule.Value,
+		Value2:     rule.Value2,
+		Sustain:    rule.Sustain,
+		Current:    value,
+		Since:      since.Format(cfg.TmFmtStr),
+		CreateTime: now.Format(cfg.TmFmtStr),
+	})
+}
+
+// fireMetricRule 执行规则的动作
+func fireMetricRule(rule *MetricRule, deviceType string, trigger *RuleTrigger) {
+	mylog.Log.Infof("metric rule %d of %s triggered, %s=%d", rule.ID, rule.Mac, rule.Metric, trigger.Current)
+	updateRuleTriggerTime(rule.ID, trigger.CreateTime)
+	if rule.HasAction(RuleActionNotify) {
+		notifyRuleOwner(rule, deviceType, trigger)
+	}
+	if rule.HasAction(RuleActionWebhook) {
+		EmitWebhookEvent(WebhookRuleTriggered, rule.Mac, trigger)
+	}
+	if rule.HasAction(RuleActionCommand) {
+		send, err := ParseRuleCommand(deviceType, rule.Command, rule.CommandParams)
+		if err != nil {
+			mylog.Log.Errorf("metric rule %d command %s error: %v", rule.ID, rule.Command, err)
+		} else {
+			send(rule.Mac)
+		}
+	}
+}
+
+// notifyRuleOwner 通知创建规则的用户, 用户已经不能使用该设备时不通知
+func notifyRuleOwner(rule *MetricRule, deviceType string, trigger *RuleTrigger) {
+	var userDevices []UserDeviceDetail
+	QueryUserDeviceDetailByMac(rule.Mac, &userDevices)
+	for _, userDevice := range userDevices {
+		if userDevice.UserId != rule.UserId {
+			continue
+		}
+		notify.Notify(rule.UserId, &notify.Event{
+			Type:       notify.EventRuleAlert,
+			Mac:        rule.Mac,
+			DeviceType: deviceType,
+			NickName:   userDevice.NickName,
+			DeviceName: userDevice.DeviceName,
+			Title:      rule.Name,
+			Code:       int(rule.ID),
+			Value:      trigger.Current,
+			StartTime:  trigger.Since,
+			CreateTime: trigger.CreateTime,
+			Data:       trigger,
+		})
+		return
+	}
+}
@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestMetricRuleMatch(t *testing.T) {
+	cases := []struct {
+		op     string
+		value  int
+		value2 int
+		v      int
+		want   bool
+	}{
+		{RuleOpGt, 100, 0, 101, true},
+		{RuleOpGt, 100, 0, 100, false},
+		{RuleOpGe, 100, 0, 100, true},
+		{RuleOpLt, 50, 0, 49, true},
+		{RuleOpLe, 50, 0, 51, false},
+		{RuleOpEq, 0, 0, 0, true},
+		{RuleOpNe, 0, 0, 0, false},
+		{RuleOpBetween, 1, 3, 3, true},
+		{RuleOpBetween, 1, 3, 4, false},
+		{RuleOpOutside, 50, 120, 49, true},
+		{RuleOpOutside, 50, 120, 120, false},
+		{"unknown", 0, 0, 0, false},
+	}
+	for _, v := range cases {
+		rule := &MetricRule{Operator: v.op, Value: v.value, Value2: v.value2}
+		if got := rule.Match(v.v); got != v.want {
+			t.Errorf("Match(%s %d %d, %d) = %v, want %v", v.op, v.value, v.value2, v.v, got, v.want)
+		}
+	}
+}
+
+func TestParseRuleCommand(t *testing.T) {
+	cases := []struct {
+		deviceType string
+		name       string
+		params     string
+		ok         bool
+	}{
+		{X1Type, RuleCommandSleepSwitch, `{"switch":1}`, true},
+		{X1Type, RuleCommandNurseMode, "", true},
+		{X1Type, RuleCommandNurseMode, `{"switch":2}`, false},
+		{X1Type, RuleCommandReboot, "", false},
+		{H03Type, RuleCommandReboot, "", true},
+		{H03Type, RuleCommandSetting, `{"mac":"x"`, false},
+		{T1Type, RuleCommandSetting, "{}", true},
+		{Ed713Type, RuleCommandSleepSwitch, "", false},
+	}
+	for _, v := range cases {
+		fn, err := ParseRuleCommand(v.deviceType, v.name, v.params)
+		if (err == nil && fn != nil) != v.ok {
+			t.Errorf("ParseRuleCommand(%s, %s, %s) error = %v, want ok %v", v.deviceType, v.name, v.params, err, v.ok)
+		}
+	}
+	if DeviceSupportsMetric(X1Type, RuleMetricPosture) || !DeviceSupportsMetric(T1Type, RuleMetricPosture) {
+		t.Errorf("posture should only be supported by T1")
+	}
+}
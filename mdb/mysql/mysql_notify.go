@@ -13,7 +13,6 @@ import (
 	"hjyserver/exception"
 	mylog "hjyserver/log"
 	"hjyserver/mdb/common"
-	"hjyserver/mq"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -347,8 +346,22 @@ func checkNotifyAndPublish(notifyObj NotifySetting, personStatus int, breath int
 		// 其他通知
 	}
 	if needNotify {
-		mq.PublishData(common.MakeDeviceNotifyTopic(notifyObj.Mac), notifyStatus)
-		//send sms
-		SendSleepNotifySms(notifyObj.Mac, notifyStatus.Type, notifyStatus.Status)
+		publishDeviceData(notifyObj.Mac, common.MakeDeviceNotifyTopic(notifyObj.Mac), notifyStatus)
+		EmitWebhookEvent(WebhookAlarmRaised, notifyObj.Mac, &WebhookAlarm{
+			Type:            notifyStatus.Type,
+			Status:          notifyStatus.Status,
+			HeartRate:       heartRate,
+			RespiratoryRate: breath,
+			CreateTime:      notifyObj.LastNotifyTime,
+		})
+		// 通知用户
+		value := 0
+		switch notifyStatus.Type {
+		case common.BreathType:
+			value = breath
+		case common.HeartRateType:
+			value = heartRate
+		}
+		notifyVitalStatus(notifyObj.Mac, notifyStatus.Type, notifyStatus.Status, value, notifyObj.LastNotifyTime)
 	}
 }
@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"database/sql"
+
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/notify"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// swagger:model NotifyAttempt
+type NotifyAttempt struct {
+	ID     int64 `json:"id" mysql:"id"`
+	UserId int64 `json:"user_id" mysql:"user_id"`
+	// 事件id, 同一事件通知多个用户时相同
+	EventId   string `json:"event_id" mysql:"event_id"`
+	EventType string `json:"event_type" mysql:"event_type"`
+	Mac       string `json:"mac" mysql:"mac"`
+	Channel   string `json:"channel" mysql:"channel"`
+	// 第几条通道链, 从0开始
+	Chain int `json:"chain" mysql:"chain_index"`
+	// 1:成功 2:失败 3:跳过 4:被免打扰、去重或每日上限拦截
+	Status     int    `json:"status" mysql:"status"`
+	Error      string `json:"error" mysql:"error"`
+	CreateTime string `json:"create_time" mysql:"create_time"`
+}
+
+func NewNotifyAttempt() *NotifyAttempt {
+	return &NotifyAttempt{
+		ID:         0,
+		UserId:     0,
+		EventId:    "",
+		EventType:  "",
+		Mac:        "",
+		Channel:    "",
+		Chain:      0,
+		Status:     notify.AttemptSuccess,
+		Error:      "",
+		CreateTime: common.GetNowTime(),
+	}
+}
+
+func (me *NotifyAttempt) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *NotifyAttempt) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.UserId, &me.EventId, &me.EventType, &me.Mac, &me.Channel, &me.Chain,
+		&me.Status, &me.Error, &me.CreateTime)
+	return err
+}
+func (me *NotifyAttempt) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.UserId, &me.EventId, &me.EventType, &me.Mac, &me.Channel, &me.Chain,
+		&me.Status, &me.Error, &me.CreateTime)
+	return err
+}
+func (me *NotifyAttempt) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.NotifyAttemptTbl, me.ID, me)
+}
+func (me *NotifyAttempt) Insert() bool {
+	tblName := common.NotifyAttemptTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			user_id bigint not null comment '用户id',
+			event_id varchar(64) not null comment '事件id',
+			event_type varchar(32) not null comment '事件类型',
+			mac varchar(32) default '' comment '设备mac',
+			channel varchar(32) not null comment '通道',
+			chain_index int not null default 0 comment '第几条通道链',
+			status int not null default 0 comment '1:成功 2:失败 3:跳过 4:拦截',
+			error varchar(255) default '' comment '错误信息',
+			create_time datetime comment '创建时间',
+			PRIMARY KEY (id),
+			INDEX idx_user_id (user_id, create_time),
+			INDEX idx_event_id (event_id),
+			INDEX idx_create_time (create_time)
+		)`
+		CreateTable(sql)
+	}
+	// 错误信息来自第三方接口, 需要转义后才能拼接到sql中
+	obj := *me
+	obj.Error = common.EscapeSql(me.Error)
+	if !InsertDao(tblName, &obj) {
+		return false
+	}
+	me.ID = obj.ID
+	return true
+}
+func (me *NotifyAttempt) Update() bool {
+	obj := *me
+	obj.Error = common.EscapeSql(me.Error)
+	return UpdateDaoByID(common.NotifyAttemptTbl, me.ID, &obj)
+}
+func (me *NotifyAttempt) Delete() bool {
+	return DeleteDaoByID(common.NotifyAttemptTbl, me.ID)
+}
+func (me *NotifyAttempt) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryNotifyAttemptByCond(filter interface{}, page *common.PageDao, sort interface{}, results *[]NotifyAttempt) bool {
+	backFunc := func(rows *sql.Rows) {
+		obj := NewNotifyAttempt()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}
+	if page == nil {
+		return QueryDao(common.NotifyAttemptTbl, filter, sort, -1, backFunc)
+	}
+	return QueryPage(common.NotifyAttemptTbl, page, filter, sort, backFunc)
+}
+
+/******************************************************************************
+ * function: SaveNotifyAttempt
+ * description: 保存通知的发送结果, 作为notify的记录函数
+ * param {*notify.Attempt} a
+ * return {*}
+********************************************************************************/
+func SaveNotifyAttempt(a *notify.Attempt) {
+	obj := NewNotifyAttempt()
+	obj.UserId = a.UserId
+	obj.EventId = a.EventId
+	obj.EventType = a.EventType
+	obj.Mac = a.Mac
+	obj.Channel = a.Channel
+	obj.Chain = a.Chain
+	obj.Status = a.Status
+	obj.Error = a.Error
+	// 错误信息可能很长, 只保存前面部分
+	if r := []rune(obj.Error); len(r) > 255 {
+		obj.Error = string(r[:255])
+	}
+	obj.Insert()
+}
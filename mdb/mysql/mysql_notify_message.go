@@ -0,0 +1,187 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/notify"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// swagger:model NotifyMessage
+type NotifyMessage struct {
+	ID     int64 `json:"id" mysql:"id"`
+	UserId int64 `json:"user_id" mysql:"user_id"`
+	// 事件id, 与通知发送记录的事件id相同
+	EventId   string `json:"event_id" mysql:"event_id"`
+	EventType string `json:"event_type" mysql:"event_type"`
+	Mac       string `json:"mac" mysql:"mac"`
+	Code      int    `json:"code" mysql:"code"`
+	// 使用的模板, 没有模板时为空
+	Template string `json:"template" mysql:"template_key"`
+	// 按用户语言生成的内容
+	Content string `json:"content" mysql:"content"`
+	// 事件的json
+	Payload string `json:"payload" mysql:"payload"`
+	// 发送成功的通道, 逗号分隔
+	Channels string `json:"channels" mysql:"channels"`
+	// 1:发送成功 2:发送失败 3:被免打扰、去重或每日上限拦截
+	Status int `json:"status" mysql:"status"`
+	// 0:未读 1:已读
+	IsRead     int     `json:"is_read" mysql:"is_read"`
+	ReadTime   *string `json:"read_time" mysql:"read_time"`
+	CreateTime string  `json:"create_time" mysql:"create_time"`
+}
+
+func NewNotifyMessage() *NotifyMessage {
+	return &NotifyMessage{
+		ID:         0,
+		UserId:     0,
+		EventId:    "",
+		EventType:  "",
+		Mac:        "",
+		Code:       0,
+		Template:   "",
+		Content:    "",
+		Payload:    "",
+		Channels:   "",
+		Status:     notify.MessageDelivered,
+		IsRead:     0,
+		ReadTime:   nil,
+		CreateTime: common.GetNowTime(),
+	}
+}
+
+func (me *NotifyMessage) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *NotifyMessage) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.UserId, &me.EventId, &me.EventType, &me.Mac, &me.Code, &me.Template, &me.Content,
+		&me.Payload, &me.Channels, &me.Status, &me.IsRead, &me.ReadTime, &me.CreateTime)
+	return err
+}
+func (me *NotifyMessage) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.UserId, &me.EventId, &me.EventType, &me.Mac, &me.Code, &me.Template, &me.Content,
+		&me.Payload, &me.Channels, &me.Status, &me.IsRead, &me.ReadTime, &me.CreateTime)
+	return err
+}
+func (me *NotifyMessage) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.NotifyMessageTbl, me.ID, me)
+}
+func (me *NotifyMessage) Insert() bool {
+	tblName := common.NotifyMessageTbl
+	if !CheckTableExist(tblName) {
+		sqlStr := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			user_id bigint not null comment '用户id',
+			event_id varchar(64) not null comment '事件id',
+			event_type varchar(32) not null comment '事件类型',
+			mac varchar(32) default '' comment '设备mac',
+			code int not null default 0 comment '事件编号',
+			template_key varchar(64) default '' comment '使用的模板',
+			content varchar(1024) default '' comment '通知内容',
+			payload text comment '事件json',
+			channels varchar(128) default '' comment '发送成功的通道',
+			status int not null default 1 comment '1:成功 2:失败 3:被拦截',
+			is_read int not null default 0 comment '0:未读 1:已读',
+			read_time datetime comment '阅读时间',
+			create_time datetime comment '创建时间',
+			PRIMARY KEY (id),
+			INDEX idx_user_read (user_id, is_read),
+			INDEX idx_user_id (user_id, id)
+		)`
+		CreateTable(sqlStr)
+	}
+	// 内容和事件中有用户输入的昵称、备注, 需要转义后才能拼接到sql中
+	obj := *me
+	obj.Content = common.EscapeSql(me.Content)
+	obj.Payload = common.EscapeSql(me.Payload)
+	if !InsertDao(tblName, &obj) {
+		return false
+	}
+	me.ID = obj.ID
+	return true
+}
+func (me *NotifyMessage) Update() bool {
+	obj := *me
+	obj.Content = common.EscapeSql(me.Content)
+	obj.Payload = common.EscapeSql(me.Payload)
+	return UpdateDaoByID(common.NotifyMessageTbl, me.ID, &obj)
+}
+func (me *NotifyMessage) Delete() bool {
+	return DeleteDaoByID(common.NotifyMessageTbl, me.ID)
+}
+func (me *NotifyMessage) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryNotifyMessageByCond(filter interface{}, page *common.PageDao, sort interface{}, results *[]NotifyMessage) bool {
+	if !CheckTableExist(common.NotifyMessageTbl) {
+		return false
+	}
+	backFunc := func(rows *sql.Rows) {
+		obj := NewNotifyMessage()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}
+	if page == nil {
+		return QueryDao(common.NotifyMessageTbl, filter, sort, -1, backFunc, ReadPrimary)
+	}
+	return QueryPage(common.NotifyMessageTbl, page, filter, sort, backFunc)
+}
+
+// CountUnreadNotifyMessages 统计用户的未读消息数
+func CountUnreadNotifyMessages(userId int64) int64 {
+	if !CheckTableExist(common.NotifyMessageTbl) {
+		return 0
+	}
+	var count int64
+	sqlStr := fmt.Sprintf("select count(*) from %s where user_id=? and is_read=0", common.NotifyMessageTbl)
+	if err := mDb.QueryRow(sqlStr, userId).Scan(&count); err != nil {
+		mylog.Log.Errorln(err)
+	}
+	return count
+}
+
+/******************************************************************************
+ * function: MarkNotifyMessagesRead
+ * description: 把用户的消息标记为已读, ids为空时标记所有未读消息
+ * param {int64} userId
+ * param {[]int64} ids
+ * return {*} 标记的条数
+********************************************************************************/
+func MarkNotifyMessagesRead(userId int64, ids []int64) int64 {
+	if !CheckTableExist(common.NotifyMessageTbl) {
+		return 0
+	}
+	sqlStr := fmt.Sprintf("update %s set is_read=1, read_time=? where user_id=? and is_read=0", common.NotifyMessageTbl)
+	args := []interface{}{common.GetNowTime(), userId}
+	if len(ids) > 0 {
+		marks := make([]string, 0, len(ids))
+		for _, id := range ids {
+			marks = append(marks, "?")
+			args = append(args, id)
+		}
+		sqlStr += " and id in (" + strings.Join(marks, ",") + ")"
+	}
+	result, err := mDb.Exec(sqlStr, args...)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return 0
+	}
+	n, _ := result.RowsAffected()
+	return n
+}
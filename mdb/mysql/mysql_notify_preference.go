@@ -0,0 +1,274 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// swagger:model NotifyPreference
+type NotifyPreference struct {
+	ID     int64 `json:"id" mysql:"id"`
+	UserId int64 `json:"user_id" mysql:"user_id"`
+	// 免打扰时段, 格式15:04, 开始晚于结束时跨过零点, 都为空时不启用
+	QuietStart string `json:"quiet_start" mysql:"quiet_start"`
+	QuietEnd   string `json:"quiet_end" mysql:"quiet_end"`
+	// 去重窗口, 单位秒, 0使用缺省配置
+	DedupWindow int `json:"dedup_window" mysql:"dedup_window"`
+	// 每个通道每天最多发送的条数, 0使用缺省配置, 不限制app和webhook
+	DailyCap int `json:"daily_cap" mysql:"daily_cap"`
+	// 摘要模式 0:被拦截的通知丢弃 1:被拦截的通知合并成摘要发送
+	Digest int `json:"digest" mysql:"digest"`
+	// 是否接收邮件 0:不接收 1:接收, 邮箱验证后才发送
+	Email      int    `json:"email" mysql:"email"`
+	UpdateTime string `json:"update_time" mysql:"update_time"`
+}
+
+func NewNotifyPreference() *NotifyPreference {
+	return &NotifyPreference{
+		ID:          0,
+		UserId:      0,
+		QuietStart:  "",
+		QuietEnd:    "",
+		DedupWindow: 0,
+		DailyCap:    0,
+		Digest:      0,
+		Email:       1,
+		UpdateTime:  common.GetNowTime(),
+	}
+}
+
+func (me *NotifyPreference) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *NotifyPreference) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.UserId, &me.QuietStart, &me.QuietEnd, &me.DedupWindow, &me.DailyCap, &me.Digest, &me.Email, &me.UpdateTime)
+	return err
+}
+func (me *NotifyPreference) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.UserId, &me.QuietStart, &me.QuietEnd, &me.DedupWindow, &me.DailyCap, &me.Digest, &me.Email, &me.UpdateTime)
+	return err
+}
+func (me *NotifyPreference) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.NotifyPreferenceTbl, me.ID, me)
+}
+func (me *NotifyPreference) Insert() bool {
+	tblName := common.NotifyPreferenceTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			user_id bigint not null comment '用户id',
+			quiet_start varchar(8) default '' comment '免打扰开始',
+			quiet_end varchar(8) default '' comment '免打扰结束',
+			dedup_window int not null default 0 comment '去重窗口, 秒',
+			daily_cap int not null default 0 comment '每个通道每天最多发送条数',
+			digest int not null default 0 comment '0:丢弃 1:合并成摘要',
+			email int not null default 1 comment '0:不接收邮件 1:接收邮件',
+			update_time datetime comment '更新时间',
+			PRIMARY KEY (id),
+			UNIQUE INDEX idx_user_id (user_id)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *NotifyPreference) Update() bool {
+	return UpdateDaoByID(common.NotifyPreferenceTbl, me.ID, me)
+}
+func (me *NotifyPreference) Delete() bool {
+	return DeleteDaoByID(common.NotifyPreferenceTbl, me.ID)
+}
+func (me *NotifyPreference) SetID(id int64) {
+	me.ID = id
+}
+
+// QuietAt 检查指定时间是否在免打扰时段内
+func (me *NotifyPreference) QuietAt(t time.Time) bool {
+	if me.QuietStart == "" && me.QuietEnd == "" {
+		return false
+	}
+	return inDayPeriod(t, me.QuietStart, me.QuietEnd)
+}
+
+// QueryNotifyPreference 查询用户的通知偏好, 没有设置时返回缺省值, id为0
+func QueryNotifyPreference(userId int64) *NotifyPreference {
+	obj := NewNotifyPreference()
+	obj.UserId = userId
+	if !CheckTableExist(common.NotifyPreferenceTbl) {
+		return obj
+	}
+	QueryDao(common.NotifyPreferenceTbl, fmt.Sprintf("user_id=%d", userId), nil, 1, func(rows *sql.Rows) {
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		}
+	})
+	return obj
+}
+
+// migrateNotifyPreferenceEmailColumn 通知偏好表增加是否接收邮件的字段, 缺省接收
+func migrateNotifyPreferenceEmailColumn() {
+	if !CheckTableExist(common.NotifyPreferenceTbl) {
+		return
+	}
+	if tableHasColumn(common.NotifyPreferenceTbl, "email") {
+		return
+	}
+	sqlStr := fmt.Sprintf("alter table %s add column email int not null default 1 comment '0:不接收邮件 1:接收邮件' after digest",
+		common.NotifyPreferenceTbl)
+	if _, err := mDb.Exec(sqlStr); err != nil {
+		mylog.Log.Errorln("add email column error:", err)
+		return
+	}
+	mylog.Log.Infoln("email column added to", common.NotifyPreferenceTbl)
+}
+
+// define digest status
+const (
+	DigestPending = 0
+	DigestSent    = 1
+)
+
+// swagger:model NotifyDigest
+type NotifyDigest struct {
+	ID        int64  `json:"id" mysql:"id"`
+	UserId    int64  `json:"user_id" mysql:"user_id"`
+	EventId   string `json:"event_id" mysql:"event_id"`
+	EventType string `json:"event_type" mysql:"event_type"`
+	Mac       string `json:"mac" mysql:"mac"`
+	Code      int    `json:"code" mysql:"code"`
+	// 被拦截的原因
+	Reason string `json:"reason" mysql:"reason"`
+	// 0:等待发送 1:已合并发送
+	Status     int    `json:"status" mysql:"status"`
+	CreateTime string `json:"create_time" mysql:"create_time"`
+}
+
+func NewNotifyDigest() *NotifyDigest {
+	return &NotifyDigest{
+		ID:         0,
+		UserId:     0,
+		EventId:    "",
+		EventType:  "",
+		Mac:        "",
+		Code:       0,
+		Reason:     "",
+		Status:     DigestPending,
+		CreateTime: common.GetNowTime(),
+	}
+}
+
+func (me *NotifyDigest) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *NotifyDigest) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.UserId, &me.EventId, &me.EventType, &me.Mac, &me.Code, &me.Reason, &me.Status, &me.CreateTime)
+	return err
+}
+func (me *NotifyDigest) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.UserId, &me.EventId, &me.EventType, &me.Mac, &me.Code, &me.Reason, &me.Status, &me.CreateTime)
+	return err
+}
+func (me *NotifyDigest) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.NotifyDigestTbl, me.ID, me)
+}
+func (me *NotifyDigest) Insert() bool {
+	tblName := common.NotifyDigestTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			user_id bigint not null comment '用户id',
+			event_id varchar(64) not null comment '事件id',
+			event_type varchar(32) not null comment '事件类型',
+			mac varchar(32) default '' comment '设备mac',
+			code int not null default 0 comment '事件编号',
+			reason varchar(64) default '' comment '拦截原因',
+			status int not null default 0 comment '0:等待发送 1:已合并发送',
+			create_time datetime comment '创建时间',
+			PRIMARY KEY (id),
+			INDEX idx_status_user (status, user_id)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *NotifyDigest) Update() bool {
+	return UpdateDaoByID(common.NotifyDigestTbl, me.ID, me)
+}
+func (me *NotifyDigest) Delete() bool {
+	return DeleteDaoByID(common.NotifyDigestTbl, me.ID)
+}
+func (me *NotifyDigest) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryNotifyDigestByCond(filter interface{}, sort interface{}, results *[]NotifyDigest) bool {
+	return QueryDao(common.NotifyDigestTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewNotifyDigest()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, ReadPrimary)
+}
+
+// PendingDigest 用户等待发送的摘要
+type PendingDigest struct {
+	UserId int64
+	Count  int
+	// 最早被拦截的时间
+	FirstTime string
+	MaxId     int64
+}
+
+// QueryPendingDigests 按用户统计等待发送的摘要
+func QueryPendingDigests() []PendingDigest {
+	results := make([]PendingDigest, 0)
+	if !CheckTableExist(common.NotifyDigestTbl) {
+		return results
+	}
+	sqlStr := fmt.Sprintf("select user_id, count(*), min(create_time), max(id) from %s where status=? group by user_id",
+		common.NotifyDigestTbl)
+	rows, err := mDb.Query(sqlStr, DigestPending)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return results
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v PendingDigest
+		if err := rows.Scan(&v.UserId, &v.Count, &v.FirstTime, &v.MaxId); err != nil {
+			mylog.Log.Errorln(err)
+			continue
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+// ClaimNotifyDigests 把用户等待发送的摘要标记为已发送, 多个服务实例时只有一个能标记成功
+func ClaimNotifyDigests(userId int64, maxId int64) int64 {
+	sqlStr := fmt.Sprintf("update %s set status=? where user_id=? and status=? and id<=?", common.NotifyDigestTbl)
+	result, err := mDb.Exec(sqlStr, DigestSent, userId, DigestPending, maxId)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return 0
+	}
+	n, _ := result.RowsAffected()
+	return n
+}
@@ -0,0 +1,24 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotifyPreferenceQuietAt(t *testing.T) {
+	at := func(hm string) time.Time {
+		v, _ := time.Parse(ContactHourFmt, hm)
+		return v
+	}
+	pref := NewNotifyPreference()
+	if pref.QuietAt(at("23:00")) {
+		t.Error("quiet hours should be disabled by default")
+	}
+	pref.QuietStart, pref.QuietEnd = "21:30", "07:00"
+	cases := map[string]bool{"21:29": false, "21:30": true, "02:00": true, "07:00": false, "16:00": false}
+	for now, want := range cases {
+		if got := pref.QuietAt(at(now)); got != want {
+			t.Errorf("QuietAt(%s) = %v, want %v", now, got, want)
+		}
+	}
+}
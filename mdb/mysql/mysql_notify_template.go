@@ -0,0 +1,142 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// swagger:model NotifyTemplate
+type NotifyTemplate struct {
+	ID int64 `json:"id" mysql:"id"`
+	// 模板key, 如sleep.alarm.3008、vital.notify.1.0
+	EventKey string `json:"event_key" mysql:"event_key"`
+	// 语言, 如zh-CN、zh-HK、en
+	Locale string `json:"locale" mysql:"locale"`
+	// text/template格式的模板内容
+	Content    string `json:"content" mysql:"content"`
+	OperatorId int64  `json:"operator_id" mysql:"operator_id"`
+	UpdateTime string `json:"update_time" mysql:"update_time"`
+}
+
+func NewNotifyTemplate() *NotifyTemplate {
+	return &NotifyTemplate{
+		ID:         0,
+		EventKey:   "",
+		Locale:     "",
+		Content:    "",
+		OperatorId: 0,
+		UpdateTime: common.GetNowTime(),
+	}
+}
+
+func (me *NotifyTemplate) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *NotifyTemplate) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.EventKey, &me.Locale, &me.Content, &me.OperatorId, &me.UpdateTime)
+	return err
+}
+func (me *NotifyTemplate) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.EventKey, &me.Locale, &me.Content, &me.OperatorId, &me.UpdateTime)
+	return err
+}
+func (me *NotifyTemplate) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.NotifyTemplateTbl, me.ID, me)
+}
+func (me *NotifyTemplate) Insert() bool {
+	tblName := common.NotifyTemplateTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			event_key varchar(64) not null comment '模板key',
+			locale varchar(16) not null comment '语言',
+			content text comment '模板内容',
+			operator_id bigint default 0 comment '修改的管理员id',
+			update_time datetime comment '修改时间',
+			PRIMARY KEY (id),
+			UNIQUE INDEX idx_key_locale (event_key, locale)
+		)`
+		CreateTable(sql)
+	}
+	// 模板内容由管理员输入, 需要转义后才能拼接到sql中
+	obj := *me
+	obj.Content = common.EscapeSql(me.Content)
+	if !InsertDao(tblName, &obj) {
+		return false
+	}
+	me.ID = obj.ID
+	return true
+}
+func (me *NotifyTemplate) Update() bool {
+	obj := *me
+	obj.Content = common.EscapeSql(me.Content)
+	return UpdateDaoByID(common.NotifyTemplateTbl, me.ID, &obj)
+}
+func (me *NotifyTemplate) Delete() bool {
+	return DeleteDaoByID(common.NotifyTemplateTbl, me.ID)
+}
+func (me *NotifyTemplate) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryNotifyTemplateByCond(filter interface{}, page *common.PageDao, sort interface{}, results *[]NotifyTemplate) bool {
+	backFunc := func(rows *sql.Rows) {
+		obj := NewNotifyTemplate()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}
+	if page == nil {
+		return QueryDao(common.NotifyTemplateTbl, filter, sort, -1, backFunc)
+	}
+	return QueryPage(common.NotifyTemplateTbl, page, filter, sort, backFunc)
+}
+
+/******************************************************************************
+ * function: SaveNotifyTemplate
+ * description: 保存模板, 同一模板key和语言已经存在时修改内容
+ * param {*NotifyTemplate} tpl
+ * return {*}
+********************************************************************************/
+func SaveNotifyTemplate(tpl *NotifyTemplate) bool {
+	var list []NotifyTemplate
+	filter := fmt.Sprintf("event_key='%s' and locale='%s'", common.EscapeSql(tpl.EventKey), common.EscapeSql(tpl.Locale))
+	QueryNotifyTemplateByCond(filter, nil, nil, &list)
+	tpl.UpdateTime = common.GetNowTime()
+	if len(list) == 0 {
+		return tpl.Insert()
+	}
+	tpl.ID = list[0].ID
+	return tpl.Update()
+}
+
+/******************************************************************************
+ * function: LoadNotifyTemplates
+ * description: 读取全部模板, 用于覆盖模板文件
+ * return {map[string]map[string]string} 语言: 模板key: 模板内容
+********************************************************************************/
+func LoadNotifyTemplates() map[string]map[string]string {
+	texts := make(map[string]map[string]string)
+	var list []NotifyTemplate
+	QueryNotifyTemplateByCond("", nil, nil, &list)
+	for _, v := range list {
+		if _, ok := texts[v.Locale]; !ok {
+			texts[v.Locale] = make(map[string]string)
+		}
+		texts[v.Locale][v.EventKey] = v.Content
+	}
+	return texts
+}
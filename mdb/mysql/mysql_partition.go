@@ -0,0 +1,382 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+)
+
+const (
+	// 分区名前缀, 分区名格式为p202503
+	partitionPrefix = "p"
+	// 兜底分区, 存放超出已建分区范围的数据
+	partitionMax = "pmax"
+	// 提前创建的月份数
+	partitionAheadMonths = 2
+)
+
+/*
+* PartitionTable... 需要按月分区的表
+ */
+type PartitionTable struct {
+	TblName string
+	// 分区字段, 必须是date或datetime类型, 并且会加入主键
+	Column string
+	// 是否按配置的保留月数删除过期分区
+	Expire bool
+}
+
+/******************************************************************************
+ * function: partitionTables
+ * description: 返回所有需要按月分区的记录表
+ * return {*}
+********************************************************************************/
+func partitionTables() []PartitionTable {
+	return []PartitionTable{
+		{TblName: common.LampRealDataTbl, Column: "create_time", Expire: true},
+		{TblName: common.DeviceRecordTbl(X1Type), Column: "create_time", Expire: true},
+		{TblName: common.DeviceRecordTbl(Ed713Type), Column: "create_time", Expire: true},
+		{TblName: common.DeviceRecordTbl(HeatRateType), Column: "create_time", Expire: false},
+		{TblName: H03AttrData{}.TableName(), Column: "create_time", Expire: true},
+		{TblName: H03Event{}.TableName(), Column: "create_time", Expire: true},
+		{TblName: T1AttrData{}.TableName(), Column: "create_time", Expire: false},
+		{TblName: T1Event{}.TableName(), Column: "create_time", Expire: false},
+		{TblName: H03StudyReport{}.TableName(), Column: "create_time", Expire: false},
+		{TblName: H03WeekReport{}.TableName(), Column: "create_time", Expire: false},
+		{TblName: H03DailyReport{}.TableName(), Column: "daily_date", Expire: false},
+		{TblName: T1StudyReport{}.TableName(), Column: "create_time", Expire: false},
+		{TblName: T1WeekReport{}.TableName(), Column: "create_time", Expire: false},
+		{TblName: T1DailyReport{}.TableName(), Column: "daily_date", Expire: false},
+	}
+}
+
+/******************************************************************************
+ * function: MaintainPartitions
+ * description: 已分区的表补齐缺少的月份分区并删除过期分区, 未分区的表跳过,
+ * 需要用MigratePartitions转换, 启动和定时任务中不做耗时的表转换
+ * return {*}
+********************************************************************************/
+func MaintainPartitions() {
+	if !cfg.This.DB.EnablePartition {
+		return
+	}
+	now := time.Now()
+	for _, v := range partitionTables() {
+		if !CheckTableExist(v.TblName) {
+			continue
+		}
+		names, ok := queryPartitionNames(v.TblName)
+		if !ok {
+			continue
+		}
+		if len(names) == 0 {
+			mylog.Log.Warnln("table", v.TblName, "is not partitioned, start with -migrate-partitions to convert it")
+			continue
+		}
+		addFuturePartitions(v.TblName, names, now)
+		if v.Expire && cfg.This.DB.PartitionRetainMonths > 0 {
+			dropExpiredPartitions(v.TblName, names, now, cfg.This.DB.PartitionRetainMonths)
+		}
+	}
+}
+
+/******************************************************************************
+ * function: MigratePartitions
+ * description: 把未分区的记录表转换为按月分区, 转换会锁表重建, 大表耗时较长,
+ * 只在维护窗口用 -migrate-partitions 启动参数执行一次, 执行完成后退出
+ * return {*} 所有表是否转换成功
+********************************************************************************/
+func MigratePartitions() bool {
+	if !cfg.This.DB.EnablePartition {
+		mylog.Log.Errorln("partition is not enabled in config")
+		return false
+	}
+	now := time.Now()
+	result := true
+	for _, v := range partitionTables() {
+		if !CheckTableExist(v.TblName) {
+			continue
+		}
+		names, ok := queryPartitionNames(v.TblName)
+		if !ok {
+			result = false
+			continue
+		}
+		if len(names) > 0 {
+			continue
+		}
+		mylog.Log.Infoln("start partition table", v.TblName)
+		if !migrateToPartition(v, now) {
+			result = false
+		}
+	}
+	return result
+}
+
+/******************************************************************************
+ * function: IsPartitionedTable
+ * description: 表是否已经按月分区, 已分区的表不再需要逐行删除过期数据
+ * param {string} tblName
+ * return {*}
+********************************************************************************/
+func IsPartitionedTable(tblName string) bool {
+	if !cfg.This.DB.EnablePartition {
+		return false
+	}
+	names, ok := queryPartitionNames(tblName)
+	return ok && len(names) > 0
+}
+
+func queryPartitionNames(tblName string) ([]string, bool) {
+	sql := "select partition_name from information_schema.partitions " +
+		"where table_schema=database() and table_name=? and partition_name is not null " +
+		"order by partition_ordinal_position"
+	rows, err := mDb.Query(sql, tblName)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			mylog.Log.Errorln(err)
+			return nil, false
+		}
+		names = append(names, name)
+	}
+	return names, true
+}
+
+/******************************************************************************
+ * function: migrateToPartition
+ * description: 把普通表转换为按月分区表
+ * 1. 分区字段不是date/datetime时转换为datetime
+ * 2. 分区字段加入主键, MySQL要求分区字段包含在所有唯一键中
+ * 3. 从最早记录的月份开始建分区, 直到当前月之后partitionAheadMonths个月
+ * param {PartitionTable} tbl
+ * param {time.Time} now
+ * return {*}
+********************************************************************************/
+func migrateToPartition(tbl PartitionTable, now time.Time) bool {
+	var dataType string
+	row := mDb.QueryRow("select data_type from information_schema.columns "+
+		"where table_schema=database() and table_name=? and column_name=?", tbl.TblName, tbl.Column)
+	if err := row.Scan(&dataType); err != nil {
+		mylog.Log.Errorln("partition table", tbl.TblName, "column", tbl.Column, "error:", err)
+		return false
+	}
+	if !strings.EqualFold(dataType, "date") && !strings.EqualFold(dataType, "datetime") {
+		sql := fmt.Sprintf("alter table %s modify column %s datetime not null", tbl.TblName, tbl.Column)
+		if _, err := mDb.Exec(sql); err != nil {
+			mylog.Log.Errorln("partition table", tbl.TblName, "convert column error:", err)
+			return false
+		}
+	}
+	// 唯一键不包含分区字段时无法分区
+	var cnt int
+	row = mDb.QueryRow("select count(distinct index_name) from information_schema.statistics "+
+		"where table_schema=database() and table_name=? and non_unique=0 and index_name<>'PRIMARY' "+
+		"and index_name not in (select index_name from information_schema.statistics "+
+		"where table_schema=database() and table_name=? and column_name=?)",
+		tbl.TblName, tbl.TblName, tbl.Column)
+	if err := row.Scan(&cnt); err != nil || cnt > 0 {
+		mylog.Log.Errorln("partition table", tbl.TblName, "has unique key without", tbl.Column, err)
+		return false
+	}
+	keys, ok := queryPrimaryKeys(tbl.TblName)
+	if !ok {
+		return false
+	}
+	if !containsColumn(keys, tbl.Column) {
+		keys = append(keys, tbl.Column)
+		sql := fmt.Sprintf("alter table %s drop primary key, add primary key(%s)", tbl.TblName, strings.Join(keys, ","))
+		if _, err := mDb.Exec(sql); err != nil {
+			mylog.Log.Errorln("partition table", tbl.TblName, "modify primary key error:", err)
+			return false
+		}
+	}
+	from := monthStart(now)
+	var minTime *string
+	row = mDb.QueryRow(fmt.Sprintf("select date_format(min(%s), '%%Y-%%m-%%d') from %s", tbl.Column, tbl.TblName))
+	if err := row.Scan(&minTime); err == nil && minTime != nil {
+		if t, err := time.ParseInLocation(cfg.DateFmtStr, *minTime, time.Local); err == nil && t.Before(from) {
+			from = monthStart(t)
+		}
+	}
+	sql := fmt.Sprintf("alter table %s partition by range columns(%s) (%s)",
+		tbl.TblName, tbl.Column, makePartitionDefs(from, monthStart(now).AddDate(0, partitionAheadMonths, 0)))
+	if _, err := mDb.Exec(sql); err != nil {
+		mylog.Log.Errorln("partition table", tbl.TblName, "error:", err)
+		return false
+	}
+	mylog.Log.Infoln("partition table", tbl.TblName, "by month from", partitionName(from))
+	return true
+}
+
+func queryPrimaryKeys(tblName string) ([]string, bool) {
+	rows, err := mDb.Query("select column_name from information_schema.statistics "+
+		"where table_schema=database() and table_name=? and index_name='PRIMARY' order by seq_in_index", tblName)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			mylog.Log.Errorln(err)
+			return nil, false
+		}
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+/******************************************************************************
+ * function: addFuturePartitions
+ * description: 从pmax中拆分出最新分区之后到当前月+partitionAheadMonths的所有分区,
+ * 维护任务中断过时补齐中间缺少的月份
+ * param {string} tblName
+ * param {[]string} names 已有分区名
+ * param {time.Time} now
+ * return {*}
+********************************************************************************/
+func addFuturePartitions(tblName string, names []string, now time.Time) {
+	from, to, ok := missingPartitionRange(names, now)
+	if !ok {
+		return
+	}
+	sql := fmt.Sprintf("alter table %s reorganize partition %s into (%s)", tblName, partitionMax, makePartitionDefs(from, to))
+	if _, err := mDb.Exec(sql); err != nil {
+		mylog.Log.Errorln("add partition for", tblName, "error:", err)
+	}
+}
+
+/******************************************************************************
+ * function: dropExpiredPartitions
+ * description: 删除早于保留期的分区, 保留当月和之前retainMonths个月
+ * param {string} tblName
+ * param {[]string} names
+ * param {time.Time} now
+ * param {int} retainMonths
+ * return {*}
+********************************************************************************/
+func dropExpiredPartitions(tblName string, names []string, now time.Time, retainMonths int) {
+	expired := expiredPartitions(names, now, retainMonths)
+	if len(expired) == 0 {
+		return
+	}
+	sql := fmt.Sprintf("alter table %s drop partition %s", tblName, strings.Join(expired, ","))
+	if _, err := mDb.Exec(sql); err != nil {
+		mylog.Log.Errorln("drop partition for", tblName, "error:", err)
+		return
+	}
+	mylog.Log.Infoln("drop partition for", tblName, expired)
+}
+
+// missingPartitionRange 需要新建的分区月份范围, 从最新分区的下一个月开始, 没有月份分区时从当月开始
+func missingPartitionRange(names []string, now time.Time) (time.Time, time.Time, bool) {
+	var last time.Time
+	for _, v := range names {
+		if t, ok := parsePartitionMonth(v); ok && t.After(last) {
+			last = t
+		}
+	}
+	from := monthStart(now)
+	if !last.IsZero() {
+		from = last.AddDate(0, 1, 0)
+	}
+	to := monthStart(now).AddDate(0, partitionAheadMonths, 0)
+	return from, to, !from.After(to)
+}
+
+func expiredPartitions(names []string, now time.Time, retainMonths int) []string {
+	cutoff := monthStart(now).AddDate(0, -retainMonths, 0)
+	var expired []string
+	for _, v := range names {
+		if t, ok := parsePartitionMonth(v); ok && t.Before(cutoff) {
+			expired = append(expired, v)
+		}
+	}
+	return expired
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func partitionName(t time.Time) string {
+	return partitionPrefix + t.Format("200601")
+}
+
+func parsePartitionMonth(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, partitionPrefix) || name == partitionMax {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("200601", strings.TrimPrefix(name, partitionPrefix), time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+/******************************************************************************
+ * function: makePartitionDefs
+ * description: 生成from到to(包含)每个月的分区定义, 最后加上pmax分区
+ * param {time.Time} from
+ * param {time.Time} to
+ * return {*}
+********************************************************************************/
+func makePartitionDefs(from time.Time, to time.Time) string {
+	var defs []string
+	for t := monthStart(from); !t.After(to); t = t.AddDate(0, 1, 0) {
+		defs = append(defs, fmt.Sprintf("partition %s values less than ('%s')",
+			partitionName(t), t.AddDate(0, 1, 0).Format(cfg.DateFmtStr)))
+	}
+	defs = append(defs, fmt.Sprintf("partition %s values less than (maxvalue)", partitionMax))
+	return strings.Join(defs, ",")
+}
+
+func containsColumn(cols []string, col string) bool {
+	for _, v := range cols {
+		if strings.EqualFold(v, col) {
+			return true
+		}
+	}
+	return false
+}
+
+/******************************************************************************
+ * function: dayRangeFilter
+ * description: 按天查询的条件, 写成 column>=开始日期 and column<结束日期的下一天,
+ * 不能用date(column)比较, 否则分区表不能裁剪分区, 索引也用不上
+ * param {string} column
+ * param {string} startDay 日期或时间, 只取日期部分
+ * param {string} endDay 日期或时间, 只取日期部分, 包含这一天
+ * return {*} 日期格式错误时返回不匹配任何记录的条件
+********************************************************************************/
+func dayRangeFilter(column string, startDay string, endDay string) string {
+	start, ok1 := parseDay(startDay)
+	end, ok2 := parseDay(endDay)
+	if !ok1 || !ok2 {
+		return "1=0"
+	}
+	return fmt.Sprintf("%s>='%s' and %s<'%s'", column, start.Format(cfg.DateFmtStr),
+		column, end.AddDate(0, 0, 1).Format(cfg.DateFmtStr))
+}
+
+func parseDay(day string) (time.Time, bool) {
+	day = strings.TrimSpace(day)
+	if len(day) > len(cfg.DateFmtStr) {
+		day = day[:len(cfg.DateFmtStr)]
+	}
+	t, err := time.ParseInLocation(cfg.DateFmtStr, day, time.Local)
+	return t, err == nil
+}
@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMakePartitionDefs(t *testing.T) {
+	from := time.Date(2024, 11, 20, 8, 0, 0, 0, time.Local)
+	to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	want := "partition p202411 values less than ('2024-12-01')," +
+		"partition p202412 values less than ('2025-01-01')," +
+		"partition p202501 values less than ('2025-02-01')," +
+		"partition pmax values less than (maxvalue)"
+	if got := makePartitionDefs(from, to); got != want {
+		t.Errorf("makePartitionDefs = %s", got)
+	}
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	names := []string{"p202412", "p202501", "p202502", "p202503", "pmax"}
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.Local)
+	got := expiredPartitions(names, now, 1)
+	if !reflect.DeepEqual(got, []string{"p202412", "p202501"}) {
+		t.Errorf("expiredPartitions = %v", got)
+	}
+	if _, ok := parsePartitionMonth("pmax"); ok {
+		t.Error("pmax should not be parsed as month partition")
+	}
+}
+
+func TestMissingPartitionRange(t *testing.T) {
+	now := time.Date(2025, 7, 3, 10, 0, 0, 0, time.Local)
+	// 维护中断了几个月, 从最新分区的下一个月补齐
+	from, to, ok := missingPartitionRange([]string{"p202502", "p202503", "pmax"}, now)
+	if !ok || partitionName(from) != "p202504" || partitionName(to) != "p202509" {
+		t.Errorf("missingPartitionRange = %s, %s, %v", partitionName(from), partitionName(to), ok)
+	}
+	if _, _, ok = missingPartitionRange([]string{"p202508", "p202509", "pmax"}, now); ok {
+		t.Error("no partition should be added")
+	}
+	from, _, ok = missingPartitionRange([]string{"pmax"}, now)
+	if !ok || partitionName(from) != "p202507" {
+		t.Errorf("missingPartitionRange without month partition = %s, %v", partitionName(from), ok)
+	}
+}
+
+func TestDayRangeFilter(t *testing.T) {
+	cases := []struct {
+		start string
+		end   string
+		want  string
+	}{
+		{"2025-02-27", "2025-02-28", "create_time>='2025-02-27' and create_time<'2025-03-01'"},
+		{"2024-12-31 08:00:00", "2024-12-31 20:00:00", "create_time>='2024-12-31' and create_time<'2025-01-01'"},
+		// 只使用日期部分, 其余内容不会拼进sql
+		{"2025-01-01' or '1'='1", "2025-01-02", "create_time>='2025-01-01' and create_time<'2025-01-03'"},
+		{"2025/01/01", "2025-01-02", "1=0"},
+	}
+	for _, c := range cases {
+		if got := dayRangeFilter("create_time", c.start, c.end); got != c.want {
+			t.Errorf("dayRangeFilter(%q, %q) = %s", c.start, c.end, got)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/redis"
+)
+
+// 缺省允许的从库延迟, 单位秒
+const defaultReplicaMaxLag = 5
+
+/*
+* ReadOption... 单次查询的读库选项
+ */
+type ReadOption int
+
+const (
+	// ReadPrimary 强制从主库读取, 用于写后立即读(read your writes)的场景, 和缺省行为一致
+	ReadPrimary ReadOption = iota + 1
+	// ReadReplica 允许从从库读取, 只用于可以容忍延迟的报表和统计查询,
+	// 用户请求中的查询使用ReadReplicaFor, 用户刚写过数据时读主库
+	ReadReplica
+)
+
+type replicaDB struct {
+	db *sql.DB
+	// 从库是否可用, 延迟超过阈值或者复制中断时不可用
+	healthy atomic.Bool
+	// 最近一次检测到的延迟, 单位秒
+	lag atomic.Int64
+}
+
+var mReplicas []*replicaDB
+var replicaNext atomic.Uint64
+
+/******************************************************************************
+ * function: openReplicas
+ * description: 连接配置的只读从库, 连接失败的从库忽略, 所有读都会回落到主库
+ * return {*}
+********************************************************************************/
+func openReplicas() {
+	for _, dsn := range cfg.This.DB.Replicas {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			mylog.Log.Errorln("open mysql replica error:", err)
+			continue
+		}
+		db.SetConnMaxLifetime(time.Second * 30)
+		db.SetConnMaxIdleTime(time.Second * 30)
+		db.SetMaxIdleConns(100)
+		db.SetMaxOpenConns(256)
+		replica := &replicaDB{db: db}
+		mReplicas = append(mReplicas, replica)
+	}
+	checkReplicaLag()
+}
+
+func closeReplicas() {
+	for _, v := range mReplicas {
+		if err := v.db.Close(); err != nil {
+			mylog.Log.Errorln(err)
+		}
+	}
+	mReplicas = nil
+}
+
+func replicaMaxLag() int64 {
+	if cfg.This.DB.ReplicaMaxLag > 0 {
+		return int64(cfg.This.DB.ReplicaMaxLag)
+	}
+	return defaultReplicaMaxLag
+}
+
+/******************************************************************************
+ * function: checkReplicaLag
+ * description: 检测每个从库的复制延迟, 超过阈值或复制中断的从库暂停使用
+ * return {*}
+********************************************************************************/
+func checkReplicaLag() {
+	for _, v := range mReplicas {
+		lag, err := queryReplicaLag(v.db)
+		if err != nil {
+			if v.healthy.Load() {
+				mylog.Log.Errorln("mysql replica unavailable:", err)
+			}
+			v.healthy.Store(false)
+			continue
+		}
+		v.lag.Store(lag)
+		v.healthy.Store(lag <= replicaMaxLag())
+	}
+}
+
+/******************************************************************************
+ * function: queryReplicaLag
+ * description: 读取Seconds_Behind_Source(8.0.22以后)或Seconds_Behind_Master,
+ * 为NULL表示复制线程没有运行, 没有复制状态时认为是无延迟的只读节点
+ * param {*sql.DB} db
+ * return {*}
+********************************************************************************/
+func queryReplicaLag(db *sql.DB) (int64, error) {
+	rows, err := db.Query("show replica status")
+	if err != nil {
+		rows, err = db.Query("show slave status")
+		if err != nil {
+			return 0, err
+		}
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	values := make([]sql.RawBytes, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, col := range cols {
+		if !strings.EqualFold(col, "Seconds_Behind_Source") && !strings.EqualFold(col, "Seconds_Behind_Master") {
+			continue
+		}
+		if values[i] == nil {
+			return 0, errReplicationStopped
+		}
+		return strconv.ParseInt(string(values[i]), 10, 64)
+	}
+	return 0, nil
+}
+
+var errReplicationStopped = errors.New("replication is not running")
+
+// pickReplica 轮询返回一个延迟在阈值内的从库, 没有可用从库时返回主库
+func pickReplica() *sql.DB {
+	n := len(mReplicas)
+	if n == 0 {
+		return mDb
+	}
+	start := replicaNext.Add(1)
+	for i := 0; i < n; i++ {
+		v := mReplicas[(start+uint64(i))%uint64(n)]
+		if v.healthy.Load() {
+			return v.db
+		}
+	}
+	return mDb
+}
+
+/******************************************************************************
+ * function: readDBFor
+ * description: 选择查询的连接, 缺省走主库, 只有指定ReadReplica时才走延迟在阈值内的从库,
+ * 同时指定ReadPrimary时以ReadPrimary为准. 所有从库读取都要经过这里
+ * param {[]ReadOption} opts
+ * return {*}
+********************************************************************************/
+func readDBFor(opts []ReadOption) *sql.DB {
+	if len(mReplicas) == 0 {
+		return mDb
+	}
+	replica := false
+	for _, v := range opts {
+		if v == ReadPrimary {
+			return mDb
+		}
+		if v == ReadReplica {
+			replica = true
+		}
+	}
+	if !replica {
+		return mDb
+	}
+	return pickReplica()
+}
+
+func userWriteKey(userId int64) string {
+	return fmt.Sprintf("db_write_%d", userId)
+}
+
+/******************************************************************************
+ * function: MarkUserWrite
+ * description: 记录用户刚写过数据, 保存在redis中, 所有服务实例都能看到,
+ * 从库延迟窗口内该用户的查询走主库
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func MarkUserWrite(userId int64) {
+	if len(mReplicas) == 0 || userId <= 0 {
+		return
+	}
+	if err := redis.SetValueEx(userWriteKey(userId), "1", int(replicaMaxLag()+1)); err != nil {
+		mylog.Log.Errorln("mark user write error:", err)
+	}
+}
+
+/******************************************************************************
+ * function: ReadReplicaFor
+ * description: 用户请求中的报表和统计查询使用的读库选项, 用户在从库延迟窗口内写过数据时
+ * 返回ReadPrimary, 保证能读到自己刚写的数据
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func ReadReplicaFor(userId int64) ReadOption {
+	if len(mReplicas) == 0 || userId <= 0 {
+		return ReadReplica
+	}
+	if v, _ := redis.GetValue(userWriteKey(userId)); v != "" {
+		return ReadPrimary
+	}
+	return ReadReplica
+}
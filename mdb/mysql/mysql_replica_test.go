@@ -0,0 +1,36 @@
+package mysql
+
+import (
+	"database/sql"
+	"hjyserver/cfg"
+	"testing"
+)
+
+func TestReadDBFor(t *testing.T) {
+	cfg.This = new(cfg.Cfg)
+	// sql.Open不会真正连接数据库
+	primary, _ := sql.Open("mysql", "u:p@tcp(127.0.0.1:3306)/primary")
+	replica, _ := sql.Open("mysql", "u:p@tcp(127.0.0.1:3307)/replica")
+	mDb = primary
+	r := &replicaDB{db: replica}
+	r.healthy.Store(true)
+	mReplicas = []*replicaDB{r}
+	defer func() {
+		mDb = nil
+		mReplicas = nil
+	}()
+
+	if readDBFor(nil) != primary {
+		t.Error("read should go to primary by default")
+	}
+	if readDBFor([]ReadOption{ReadReplica}) != replica {
+		t.Error("ReadReplica should go to replica")
+	}
+	if readDBFor([]ReadOption{ReadReplica, ReadPrimary}) != primary {
+		t.Error("ReadPrimary should go to primary")
+	}
+	r.healthy.Store(false)
+	if readDBFor([]ReadOption{ReadReplica}) != primary {
+		t.Error("unhealthy replica should fall back to primary")
+	}
+}
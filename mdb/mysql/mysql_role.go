@@ -0,0 +1,215 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"hjyserver/cfg"
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define user role
+const (
+	// 普通用户
+	RoleUser = "user"
+	// 看护人员
+	RoleCaregiver = "caregiver"
+	// 客服
+	RoleSupport = "support"
+	// 管理员
+	RoleAdmin = "admin"
+)
+
+// define permission
+const (
+	// 进入管理后台
+	PermAdminConsole = "admin:console"
+	// 查询用户
+	PermUserRead = "user:read"
+	// 查询设备
+	PermDeviceRead = "device:read"
+	// 强制解绑设备
+	PermDeviceUnbind = "device:unbind"
+	// 撤销用户token
+	PermTokenRevoke = "token:revoke"
+	// OTA白名单管理
+	PermOta = "ota:manage"
+	// banner管理
+	PermBanner = "banner:manage"
+	// 设置用户角色
+	PermRoleManage = "role:manage"
+	// 合作机构和api key管理
+	PermApiKeyManage = "apikey:manage"
+	// 管理合作机构的webhook和推送记录
+	PermWebhookManage = "webhook:manage"
+	// 查询用户通知的发送记录
+	PermNotifyRead = "notify:read"
+	// 维护通知模板
+	PermNotifyTemplate = "notify:template"
+	// 查询机构的报警和统计
+	PermAlarmRead = "alarm:read"
+)
+
+var rolePermissions = map[string][]string{
+	RoleUser:      {},
+	RoleCaregiver: {},
+	RoleSupport: {
+		PermAdminConsole, PermUserRead, PermDeviceRead, PermDeviceUnbind, PermTokenRevoke, PermNotifyRead,
+		PermAlarmRead,
+	},
+	RoleAdmin: {
+		PermAdminConsole, PermUserRead, PermDeviceRead, PermDeviceUnbind, PermTokenRevoke,
+		PermOta, PermBanner, PermRoleManage, PermApiKeyManage, PermWebhookManage, PermNotifyRead,
+		PermNotifyTemplate, PermAlarmRead,
+	},
+}
+
+// swagger:model UserRole
+type UserRole struct {
+	ID     int64  `json:"id" mysql:"id"`
+	UserId int64  `json:"user_id" mysql:"user_id"`
+	Role   string `json:"role" mysql:"role"`
+	// 设置角色的管理员id
+	OperatorId int64  `json:"operator_id" mysql:"operator_id"`
+	CreateTime string `json:"create_time" mysql:"create_time"`
+	UpdateTime string `json:"update_time" mysql:"update_time"`
+}
+
+func NewUserRole() *UserRole {
+	return &UserRole{
+		ID:         0,
+		UserId:     0,
+		Role:       RoleUser,
+		OperatorId: 0,
+		CreateTime: common.GetNowTime(),
+		UpdateTime: common.GetNowTime(),
+	}
+}
+
+func (me *UserRole) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *UserRole) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.UserId, &me.Role, &me.OperatorId, &me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *UserRole) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.UserId, &me.Role, &me.OperatorId, &me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *UserRole) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.UserRoleTbl, me.ID, me)
+}
+func (me *UserRole) Insert() bool {
+	tblName := common.UserRoleTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id MEDIUMINT NOT NULL AUTO_INCREMENT,
+			user_id bigint not null comment '用户id',
+			role varchar(32) not null comment '角色 user/caregiver/support/admin',
+			operator_id bigint default 0 comment '设置角色的管理员id',
+			create_time datetime comment '创建时间',
+			update_time datetime comment '更新时间',
+			PRIMARY KEY (id),
+			UNIQUE KEY uk_user_id (user_id)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *UserRole) Update() bool {
+	return UpdateDaoByID(common.UserRoleTbl, me.ID, me)
+}
+func (me *UserRole) Delete() bool {
+	return DeleteDaoByID(common.UserRoleTbl, me.ID)
+}
+func (me *UserRole) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryUserRoleByCond(filter interface{}, sort interface{}, results *[]UserRole) bool {
+	return QueryDao(common.UserRoleTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewUserRole()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, ReadPrimary)
+}
+
+// IsValidRole 检查角色名是否有效
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleHasPermission 检查角色是否有指定权限
+func RoleHasPermission(role string, perm string) bool {
+	for _, v := range rolePermissions[role] {
+		if v == perm {
+			return true
+		}
+	}
+	return false
+}
+
+/******************************************************************************
+ * function: QueryUserRole
+ * description: 查询用户的角色, 配置文件admin_accounts中的账号始终为管理员,
+ * 没有角色记录时为普通用户
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func QueryUserRole(userId int64) string {
+	if len(cfg.This.Svr.AdminAccounts) > 0 {
+		user := NewUser()
+		if user.QueryByID(userId) {
+			for _, v := range cfg.This.Svr.AdminAccounts {
+				if v == user.Account {
+					return RoleAdmin
+				}
+			}
+		}
+	}
+	var roles []UserRole
+	QueryUserRoleByCond(fmt.Sprintf("user_id=%d", userId), nil, &roles)
+	if len(roles) == 0 {
+		return RoleUser
+	}
+	return roles[0].Role
+}
+
+/******************************************************************************
+ * function: SetUserRole
+ * description: 设置用户的角色, 没有记录时新建
+ * param {int64} userId
+ * param {string} role
+ * param {int64} operatorId
+ * return {*}
+********************************************************************************/
+func SetUserRole(userId int64, role string, operatorId int64) (*UserRole, bool) {
+	var roles []UserRole
+	QueryUserRoleByCond(fmt.Sprintf("user_id=%d", userId), nil, &roles)
+	if len(roles) == 0 {
+		obj := NewUserRole()
+		obj.UserId = userId
+		obj.Role = role
+		obj.OperatorId = operatorId
+		return obj, obj.Insert()
+	}
+	obj := &roles[0]
+	obj.Role = role
+	obj.OperatorId = operatorId
+	obj.UpdateTime = common.GetNowTime()
+	return obj, obj.Update()
+}
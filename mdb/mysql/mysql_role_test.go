@@ -0,0 +1,27 @@
+package mysql
+
+import "testing"
+
+func TestRoleHasPermission(t *testing.T) {
+	cases := []struct {
+		role string
+		perm string
+		want bool
+	}{
+		{RoleUser, PermAdminConsole, false},
+		{RoleCaregiver, PermUserRead, false},
+		{RoleSupport, PermDeviceUnbind, true},
+		{RoleSupport, PermOta, false},
+		{RoleSupport, PermRoleManage, false},
+		{RoleAdmin, PermRoleManage, true},
+		{"unknown", PermUserRead, false},
+	}
+	for _, v := range cases {
+		if got := RoleHasPermission(v.role, v.perm); got != v.want {
+			t.Errorf("RoleHasPermission(%s, %s) = %v, want %v", v.role, v.perm, got, v.want)
+		}
+	}
+	if IsValidRole("root") || !IsValidRole(RoleCaregiver) {
+		t.Errorf("IsValidRole error")
+	}
+}
@@ -0,0 +1,138 @@
+package mysql
+
+import (
+	"database/sql"
+
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define security event type
+const (
+	// 密码错误
+	SecurityLoginFail = "login_fail"
+	// 连续登录失败, 账号被临时锁定
+	SecurityAccountLocked = "account_locked"
+	// 同一IP登录失败次数过多, IP被临时封禁
+	SecurityIpBlocked = "ip_blocked"
+	// 短信验证码解锁
+	SecurityAccountUnlocked = "account_unlocked"
+	// 短信验证码重置密码
+	SecurityPasswordReset = "password_reset"
+	// 用户校验旧密码后修改密码
+	SecurityPasswordChanged = "password_changed"
+)
+
+// swagger:model SecurityEvent
+type SecurityEvent struct {
+	ID     int64 `json:"id" mysql:"id"`
+	UserId int64 `json:"user_id" mysql:"user_id"`
+	// 登录时使用的账号, 账号不存在时user_id为0
+	Account    string `json:"account" mysql:"account"`
+	EventType  string `json:"event_type" mysql:"event_type"`
+	Ip         string `json:"ip" mysql:"ip"`
+	Detail     string `json:"detail" mysql:"detail"`
+	CreateTime string `json:"create_time" mysql:"create_time"`
+}
+
+func NewSecurityEvent() *SecurityEvent {
+	return &SecurityEvent{
+		ID:         0,
+		UserId:     0,
+		Account:    "",
+		EventType:  "",
+		Ip:         "",
+		Detail:     "",
+		CreateTime: common.GetNowTime(),
+	}
+}
+
+func (me *SecurityEvent) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *SecurityEvent) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.UserId, &me.Account, &me.EventType, &me.Ip, &me.Detail, &me.CreateTime)
+	return err
+}
+func (me *SecurityEvent) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.UserId, &me.Account, &me.EventType, &me.Ip, &me.Detail, &me.CreateTime)
+	return err
+}
+func (me *SecurityEvent) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.SecurityEventTbl, me.ID, me)
+}
+func (me *SecurityEvent) Insert() bool {
+	tblName := common.SecurityEventTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			user_id bigint default 0 comment '用户id',
+			account varchar(64) default '' comment '登录账号',
+			event_type varchar(32) not null comment '事件类型',
+			ip varchar(64) default '' comment '客户端IP',
+			detail varchar(255) default '' comment '说明',
+			create_time datetime comment '创建时间',
+			PRIMARY KEY (id),
+			INDEX idx_user_id (user_id, create_time),
+			INDEX idx_create_time (create_time)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *SecurityEvent) Update() bool {
+	return UpdateDaoByID(common.SecurityEventTbl, me.ID, me)
+}
+func (me *SecurityEvent) Delete() bool {
+	return DeleteDaoByID(common.SecurityEventTbl, me.ID)
+}
+func (me *SecurityEvent) SetID(id int64) {
+	me.ID = id
+}
+
+func QuerySecurityEventByCond(filter interface{}, page *common.PageDao, sort interface{}, results *[]SecurityEvent) bool {
+	backFunc := func(rows *sql.Rows) {
+		obj := NewSecurityEvent()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}
+	if page == nil {
+		return QueryDao(common.SecurityEventTbl, filter, sort, -1, backFunc)
+	}
+	return QueryPage(common.SecurityEventTbl, page, filter, sort, backFunc)
+}
+
+/******************************************************************************
+ * function: InsertSecurityEvent
+ * description: 记录一条安全事件
+ * param {int64} userId
+ * param {string} account
+ * param {string} eventType
+ * param {string} ip
+ * param {string} detail
+ * return {*}
+********************************************************************************/
+func InsertSecurityEvent(userId int64, account string, eventType string, ip string, detail string) bool {
+	obj := NewSecurityEvent()
+	obj.UserId = userId
+	obj.Account = account
+	obj.EventType = eventType
+	obj.Ip = ip
+	obj.Detail = detail
+	if !obj.Insert() {
+		mylog.Log.Errorln("insert security event failed:", eventType, account)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,503 @@
+package mysql
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/redis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define user session status
+const (
+	SessionActive  = 0
+	SessionRevoked = 1
+)
+
+const (
+	defaultAccessTtl  = 15 * 60
+	defaultRefreshTtl = 30 * 24 * 3600
+	// 旧的refresh token在轮换后仍可使用的时间, 单位秒
+	defaultRefreshReuseGrace = 30
+	// 会话被撤销后, 在access token有效期内拒绝该会话的token
+	sessionRevokedKeyPrefix = "user_session_revoked_"
+	// 轮换后的token按旧refresh token的hash缓存, 并发刷新时返回同一组token
+	refreshGraceKeyPrefix = "user_session_refresh_grace_"
+)
+
+// swagger:model UserSession
+type UserSession struct {
+	ID        int64  `json:"id" mysql:"id"`
+	SessionId string `json:"session_id" mysql:"session_id"`
+	UserId    int64  `json:"user_id" mysql:"user_id"`
+	// 客户端设备id, 同一设备重新登录时撤销旧会话
+	DeviceId   string `json:"device_id" mysql:"device_id"`
+	DeviceName string `json:"device_name" mysql:"device_name"`
+	Ip         string `json:"ip" mysql:"ip"`
+	// refresh token的sha256, 不对外返回
+	RefreshHash string `json:"-" mysql:"refresh_hash"`
+	// 0:有效 1:已撤销
+	Status         int    `json:"status" mysql:"status"`
+	CreateTime     string `json:"create_time" mysql:"create_time"`
+	LastActiveTime string `json:"last_active_time" mysql:"last_active_time"`
+	ExpireTime     string `json:"expire_time" mysql:"expire_time"`
+}
+
+// swagger:model UserTokenPair
+type UserTokenPair struct {
+	// access token, 放在Authorization: Bearer头或者token参数中
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// access token有效期, 单位秒
+	ExpiresIn int    `json:"expires_in"`
+	SessionId string `json:"session_id"`
+}
+
+func NewUserSession() *UserSession {
+	return &UserSession{
+		ID:             0,
+		SessionId:      "",
+		UserId:         0,
+		DeviceId:       "",
+		DeviceName:     "",
+		Ip:             "",
+		RefreshHash:    "",
+		Status:         SessionActive,
+		CreateTime:     common.GetNowTime(),
+		LastActiveTime: common.GetNowTime(),
+		ExpireTime:     common.GetNowTime(),
+	}
+}
+
+func (me *UserSession) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *UserSession) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.SessionId, &me.UserId, &me.DeviceId, &me.DeviceName, &me.Ip,
+		&me.RefreshHash, &me.Status, &me.CreateTime, &me.LastActiveTime, &me.ExpireTime)
+	return err
+}
+func (me *UserSession) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.SessionId, &me.UserId, &me.DeviceId, &me.DeviceName, &me.Ip,
+		&me.RefreshHash, &me.Status, &me.CreateTime, &me.LastActiveTime, &me.ExpireTime)
+	return err
+}
+func (me *UserSession) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.UserSessionTbl, me.ID, me)
+}
+func (me *UserSession) Insert() bool {
+	tblName := common.UserSessionTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id MEDIUMINT NOT NULL AUTO_INCREMENT,
+			session_id varchar(32) not null comment '会话id',
+			user_id bigint not null comment '用户id',
+			device_id varchar(128) default '' comment '客户端设备id',
+			device_name varchar(255) default '' comment '客户端设备名称',
+			ip varchar(64) default '' comment '登录ip',
+			refresh_hash varchar(64) not null comment 'refresh token的sha256',
+			status int not null default 0 comment '0:有效 1:已撤销',
+			create_time datetime comment '创建时间',
+			last_active_time datetime comment '最近刷新时间',
+			expire_time datetime comment 'refresh token过期时间',
+			PRIMARY KEY (id),
+			UNIQUE KEY uk_session_id (session_id),
+			KEY idx_user_id (user_id)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *UserSession) Update() bool {
+	return UpdateDaoByID(common.UserSessionTbl, me.ID, me)
+}
+func (me *UserSession) Delete() bool {
+	return DeleteDaoByID(common.UserSessionTbl, me.ID)
+}
+func (me *UserSession) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryUserSessionByCond(filter interface{}, sort interface{}, results *[]UserSession) bool {
+	return QueryDao(common.UserSessionTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewUserSession()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, ReadPrimary)
+}
+
+// 启动时由InitJwtKeys读取的密钥, kid: secret
+var jwtKeys map[string][]byte
+
+/******************************************************************************
+ * function: InitJwtKeys
+ * description: 启动时读取jwt密钥, 没有配置签名密钥或者密钥太短时返回错误, 服务不启动
+ * return {*}
+********************************************************************************/
+func InitJwtKeys() error {
+	keys, err := common.LoadJwtKeys(cfg.This.Jwt.ActiveKid, cfg.This.Jwt.Keys, cfg.This.Jwt.KeyFiles)
+	if err != nil {
+		return err
+	}
+	jwtKeys = keys
+	return nil
+}
+
+func jwtEnabled() bool {
+	_, ok := jwtKeys[cfg.This.Jwt.ActiveKid]
+	return ok
+}
+
+func accessTtl() int {
+	if cfg.This.Jwt.AccessTtl > 0 {
+		return cfg.This.Jwt.AccessTtl
+	}
+	return defaultAccessTtl
+}
+
+func refreshTtl() int {
+	if cfg.This.Jwt.RefreshTtl > 0 {
+		return cfg.This.Jwt.RefreshTtl
+	}
+	return defaultRefreshTtl
+}
+
+func refreshReuseGrace() int {
+	if cfg.This.Jwt.RefreshReuseGrace > 0 {
+		return cfg.This.Jwt.RefreshReuseGrace
+	}
+	return defaultRefreshReuseGrace
+}
+
+/******************************************************************************
+ * function: legacyTokenAllowed
+ * description: 是否还接受旧的AES token, 过了legacy_token_deadline之后一律拒绝,
+ * 没有配置截止时间时只有没有配置jwt密钥才接受
+ * return {*}
+********************************************************************************/
+func legacyTokenAllowed() bool {
+	deadline := cfg.This.Jwt.LegacyTokenDeadline
+	if deadline == "" {
+		return !jwtEnabled()
+	}
+	t, err := common.StrToTime(deadline)
+	if err != nil {
+		mylog.Log.Errorln("legacy_token_deadline format error:", err)
+		return false
+	}
+	return time.Now().Before(t)
+}
+
+func jwtKey(kid string) ([]byte, bool) {
+	key, ok := jwtKeys[kid]
+	return key, ok
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+/******************************************************************************
+ * function: signAccessToken
+ * description: 为会话签发access token
+ * param {*UserSession} session
+ * param {string} phone
+ * return {*}
+********************************************************************************/
+func signAccessToken(session *UserSession, phone string) (string, error) {
+	now := time.Now().Unix()
+	claims := &common.JwtClaims{
+		Sub:   session.UserId,
+		Sid:   session.SessionId,
+		Phone: phone,
+		Iat:   now,
+		Exp:   now + int64(accessTtl()),
+	}
+	kid := cfg.This.Jwt.ActiveKid
+	key, ok := jwtKeys[kid]
+	if !ok {
+		return "", common.ErrJwtNoKey
+	}
+	return common.SignJwt(claims, kid, key)
+}
+
+// issueRefreshToken 生成新的refresh token, 只保存hash, 格式为sid.secret
+func issueRefreshToken(session *UserSession) (string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	session.RefreshHash = hashRefreshSecret(secret)
+	session.LastActiveTime = common.GetNowTime()
+	session.ExpireTime = time.Now().Add(time.Duration(refreshTtl()) * time.Second).Format(cfg.TmFmtStr)
+	return session.SessionId + "." + secret, nil
+}
+
+/******************************************************************************
+ * function: CreateUserSession
+ * description: 登录成功后创建会话, 同一用户同一设备id的旧会话会被撤销
+ * param {*User} user
+ * param {string} deviceId
+ * param {string} deviceName
+ * param {string} ip
+ * return {*}
+********************************************************************************/
+func CreateUserSession(user *User, deviceId string, deviceName string, ip string) (*UserTokenPair, bool) {
+	if !jwtEnabled() {
+		mylog.Log.Errorln("jwt active key is not configured")
+		return nil, false
+	}
+	if deviceId != "" {
+		var olds []UserSession
+		filter := fmt.Sprintf("user_id=%d and device_id='%s' and status=%d", user.ID, common.EscapeSql(deviceId), SessionActive)
+		QueryUserSessionByCond(filter, nil, &olds)
+		for i := range olds {
+			revokeSession(&olds[i])
+		}
+	}
+	sid, err := randomHex(16)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	session := NewUserSession()
+	session.SessionId = sid
+	session.UserId = user.ID
+	session.DeviceId = deviceId
+	session.DeviceName = deviceName
+	session.Ip = ip
+	refreshToken, err := issueRefreshToken(session)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	if !session.Insert() {
+		return nil, false
+	}
+	token, err := signAccessToken(session, user.Phone)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	return &UserTokenPair{Token: token, RefreshToken: refreshToken, ExpiresIn: accessTtl(), SessionId: sid}, true
+}
+
+/******************************************************************************
+ * function: RefreshUserSession
+ * description: 用refresh token换取新的access token和refresh token,
+ * 旧的refresh token在refresh_reuse_grace秒内再次使用时返回同一组token(并发刷新),
+ * 超过宽限时间再次使用时认为已泄露, 撤销整个会话
+ * param {string} refreshToken
+ * return {*}
+********************************************************************************/
+func RefreshUserSession(refreshToken string) (*UserTokenPair, int) {
+	if !jwtEnabled() {
+		return nil, common.TokenError
+	}
+	items := strings.Split(refreshToken, ".")
+	if len(items) != 2 || items[0] == "" || items[1] == "" {
+		return nil, common.TokenError
+	}
+	var sessions []UserSession
+	QueryUserSessionByCond(fmt.Sprintf("session_id='%s'", common.EscapeSql(items[0])), nil, &sessions)
+	if len(sessions) == 0 {
+		return nil, common.TokenError
+	}
+	session := &sessions[0]
+	if session.Status != SessionActive {
+		return nil, common.TokenError
+	}
+	if expire, err := common.StrToTime(session.ExpireTime); err != nil || expire.Before(time.Now()) {
+		revokeSession(session)
+		return nil, common.TokenError
+	}
+	oldHash := hashRefreshSecret(items[1])
+	if oldHash != session.RefreshHash {
+		if tokens, ok := queryRefreshGrace(oldHash); ok {
+			return tokens, common.Success
+		}
+		// refresh token被重复使用, 可能已泄露
+		mylog.Log.Errorln("refresh token reused, revoke session", session.SessionId)
+		revokeSession(session)
+		return nil, common.TokenError
+	}
+	user := NewUser()
+	if !user.QueryByID(session.UserId) {
+		return nil, common.NoExist
+	}
+	newRefresh, err := issueRefreshToken(session)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, common.DBError
+	}
+	token, err := signAccessToken(session, user.Phone)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, common.DBError
+	}
+	tokens := &UserTokenPair{Token: token, RefreshToken: newRefresh, ExpiresIn: accessTtl(), SessionId: session.SessionId}
+	rotated, ok := rotateRefreshHash(session, oldHash)
+	if !ok {
+		return nil, common.DBError
+	}
+	if !rotated {
+		// 并发的刷新请求已经轮换了refresh token, 等待它缓存的结果
+		for i := 0; i < 10; i++ {
+			if cached, ok := queryRefreshGrace(oldHash); ok {
+				return cached, common.Success
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil, common.TokenError
+	}
+	if js, err := json.Marshal(tokens); err == nil {
+		if err := redis.SetValueEx(refreshGraceKeyPrefix+oldHash, string(js), refreshReuseGrace()); err != nil {
+			mylog.Log.Errorln(err)
+		}
+	}
+	return tokens, common.Success
+}
+
+/******************************************************************************
+ * function: rotateRefreshHash
+ * description: 只有refresh_hash仍然是oldHash时才更新, 并发刷新时只有一个请求成功
+ * param {*UserSession} session
+ * param {string} oldHash
+ * return {*} 是否更新了, 是否执行成功
+********************************************************************************/
+func rotateRefreshHash(session *UserSession, oldHash string) (bool, bool) {
+	result, err := mDb.Exec("update "+common.UserSessionTbl+
+		" set refresh_hash=?, last_active_time=?, expire_time=? where id=? and status=? and refresh_hash=?",
+		session.RefreshHash, session.LastActiveTime, session.ExpireTime, session.ID, SessionActive, oldHash)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false, false
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, true
+}
+
+// queryRefreshGrace 查询宽限时间内旧refresh token轮换出的token
+func queryRefreshGrace(oldHash string) (*UserTokenPair, bool) {
+	js, _ := redis.GetValue(refreshGraceKeyPrefix + oldHash)
+	if js == "" {
+		return nil, false
+	}
+	tokens := &UserTokenPair{}
+	if err := json.Unmarshal([]byte(js), tokens); err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	return tokens, true
+}
+
+/******************************************************************************
+ * function: RevokeUserSession
+ * description: 撤销用户的一个会话, sessionId为空时撤销用户所有会话
+ * param {int64} userId
+ * param {string} sessionId
+ * return {*}
+********************************************************************************/
+func RevokeUserSession(userId int64, sessionId string) bool {
+	filter := fmt.Sprintf("user_id=%d and status=%d", userId, SessionActive)
+	if sessionId != "" {
+		filter += fmt.Sprintf(" and session_id='%s'", common.EscapeSql(sessionId))
+	}
+	var sessions []UserSession
+	if !QueryUserSessionByCond(filter, nil, &sessions) && CheckTableExist(common.UserSessionTbl) {
+		return false
+	}
+	if sessionId != "" && len(sessions) == 0 {
+		return false
+	}
+	for i := range sessions {
+		if !revokeSession(&sessions[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+/******************************************************************************
+ * function: RevokeOtherUserSessions
+ * description: 撤销用户除keepSessionId之外的所有会话, 修改密码后使用
+ * param {int64} userId
+ * param {string} keepSessionId
+ * return {*}
+********************************************************************************/
+func RevokeOtherUserSessions(userId int64, keepSessionId string) bool {
+	filter := fmt.Sprintf("user_id=%d and status=%d", userId, SessionActive)
+	if keepSessionId != "" {
+		filter += fmt.Sprintf(" and session_id<>'%s'", common.EscapeSql(keepSessionId))
+	}
+	var sessions []UserSession
+	if !QueryUserSessionByCond(filter, nil, &sessions) && CheckTableExist(common.UserSessionTbl) {
+		return false
+	}
+	for i := range sessions {
+		if !revokeSession(&sessions[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func revokeSession(session *UserSession) bool {
+	session.Status = SessionRevoked
+	session.RefreshHash = ""
+	if !session.Update() {
+		return false
+	}
+	err := redis.SetValueEx(sessionRevokedKeyPrefix+session.SessionId, "1", accessTtl())
+	if err != nil {
+		mylog.Log.Errorln(err)
+	}
+	return true
+}
+
+func isSessionRevoked(sessionId string) bool {
+	val, _ := redis.GetValue(sessionRevokedKeyPrefix + sessionId)
+	return val != ""
+}
+
+/******************************************************************************
+ * function: GetRequestToken
+ * description: 从Authorization: Bearer头或者token参数中取得token
+ * param {*gin.Context} c
+ * return {*}
+********************************************************************************/
+func GetRequestToken(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return c.Query("token")
+}
@@ -0,0 +1,28 @@
+package mysql
+
+import (
+	"hjyserver/cfg"
+	"testing"
+	"time"
+)
+
+func TestLegacyTokenAllowed(t *testing.T) {
+	cfg.This = new(cfg.Cfg)
+	if !legacyTokenAllowed() {
+		t.Error("legacy token should be allowed without jwt key")
+	}
+	cfg.This.Jwt.ActiveKid = "k1"
+	jwtKeys = map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}
+	defer func() { jwtKeys = nil }()
+	if legacyTokenAllowed() {
+		t.Error("legacy token should be rejected with jwt key and no deadline")
+	}
+	cfg.This.Jwt.LegacyTokenDeadline = time.Now().Add(time.Hour).Format(cfg.TmFmtStr)
+	if !legacyTokenAllowed() {
+		t.Error("legacy token should be allowed before deadline")
+	}
+	cfg.This.Jwt.LegacyTokenDeadline = time.Now().Add(-time.Hour).Format(cfg.TmFmtStr)
+	if legacyTokenAllowed() {
+		t.Error("legacy token should be rejected after deadline")
+	}
+}
@@ -34,7 +34,7 @@ import (
 type User struct {
 	ID            int64  `json:"id" mysql:"id" binding:"omitempty"`
 	Account       string `json:"account" mysql:"account"`
-	Password      string `json:"password" mysql:"password" `
+	Password      string `json:"-" mysql:"password"` // bcrypt哈希, 不对外返回, 输入使用单独的请求结构
 	NickName      string `json:"nick_name" mysql:"nick_name"`
 	Gender        int    `json:"gender" mysql:"gender"`         // 0 未知 1 男 2 女
 	LoginType     int    `json:"login_type" mysql:"login_type"` // 0:phone 1:email
@@ -49,6 +49,10 @@ type User struct {
 	IsLogin       int    `json:"is_login" mysql:"is_login"`
 	LoginTime     string `json:"login_time" mysql:"login_time"`
 	CreateTime    string `json:"create_time" mysql:"create_time"`
+	// 首选语言, 如zh-CN、zh-HK、en, 用于选择通知模板, 为空时使用缺省语言
+	Locale string `json:"locale" mysql:"locale"`
+	// 邮箱是否已经验证 0:未验证 1:已验证, 只给已验证的邮箱发送通知邮件
+	EmailVerified int `json:"email_verified" mysql:"email_verified"`
 }
 
 func NewUser() *User {
@@ -72,6 +76,8 @@ func NewUser() *User {
 		IsLogin:       1,
 		LoginTime:     loginTm,
 		CreateTime:    createTm,
+		Locale:        "",
+		EmailVerified: 0,
 	}
 }
 
@@ -119,6 +125,8 @@ func (me *User) DecodeFromRows(rows *sql.Rows) error {
 	var emergentPhone sql.NullString
 	var bornDate sql.NullString
 	var grade sql.NullString
+	var locale sql.NullString
+	var emailVerified sql.NullInt64
 	err := rows.Scan(
 		&me.ID,
 		&me.Account,
@@ -136,7 +144,9 @@ func (me *User) DecodeFromRows(rows *sql.Rows) error {
 		&me.RoomNum,
 		&me.IsLogin,
 		&me.LoginTime,
-		&me.CreateTime)
+		&me.CreateTime,
+		&locale,
+		&emailVerified)
 	if emergentPhone.Valid {
 		me.EmergentPhone = emergentPhone.String
 	}
@@ -146,12 +156,20 @@ func (me *User) DecodeFromRows(rows *sql.Rows) error {
 	if grade.Valid {
 		me.Grade = grade.String
 	}
+	if locale.Valid {
+		me.Locale = locale.String
+	}
+	if emailVerified.Valid {
+		me.EmailVerified = int(emailVerified.Int64)
+	}
 	return err
 }
 func (me *User) DecodeFromRow(row *sql.Row) error {
 	var emergentPhone sql.NullString
 	var bornDate sql.NullString
 	var grade sql.NullString
+	var locale sql.NullString
+	var emailVerified sql.NullInt64
 	err := row.Scan(
 		&me.ID,
 		&me.Account,
@@ -169,7 +187,9 @@ func (me *User) DecodeFromRow(row *sql.Row) error {
 		&me.RoomNum,
 		&me.IsLogin,
 		&me.LoginTime,
-		&me.CreateTime)
+		&me.CreateTime,
+		&locale,
+		&emailVerified)
 	if emergentPhone.Valid {
 		me.EmergentPhone = emergentPhone.String
 	}
@@ -179,6 +199,12 @@ func (me *User) DecodeFromRow(row *sql.Row) error {
 	if grade.Valid {
 		me.Grade = grade.String
 	}
+	if locale.Valid {
+		me.Locale = locale.String
+	}
+	if emailVerified.Valid {
+		me.EmailVerified = int(emailVerified.Int64)
+	}
 	return err
 }
 
@@ -213,12 +239,12 @@ func (me *User) Insert() bool {
 		sql := `create table ` + tblName + ` (
             id MEDIUMINT NOT NULL AUTO_INCREMENT,
             account char(32) NOT NULL COMMENT '账号',
-			password char(32) NOT NULL COMMENT '密码',
+			password varchar(128) NOT NULL COMMENT '密码哈希',
             nick_name varchar(32) NOT NULL COMMENT '昵称',
 			gender int default 0 comment '性别 0:未知 1:男 2:女',
 			login_type int NOT NULL COMMENT '登录类型 0:phone 1:email',
             phone varchar(32) comment '手机号',
-			email varchar(32) comment '邮箱',
+			email varchar(128) comment '邮箱',
 			emergent_phone varchar(32) comment '紧急联系电话',
             face varchar(255) comment '头像',
 			born_date varchar(32) comment '出生日期',
@@ -228,7 +254,10 @@ func (me *User) Insert() bool {
 			is_login int default 0 comment '是否登录',
 			login_time datetime comment '登录时间',
             create_time datetime comment '创建时间',
-            PRIMARY KEY (id, phone, create_time)
+			locale varchar(16) default '' comment '首选语言',
+			email_verified int default 0 comment '邮箱是否已验证',
+            PRIMARY KEY (id, phone, create_time),
+			UNIQUE KEY uk_email ((nullif(lower(email), '')))
         )`
 		CreateTable(sql)
 	}
@@ -249,6 +278,32 @@ func (me *User) Delete() bool {
 	return DeleteDaoByID(common.UserTbl, me.ID)
 }
 
+/*
+DeleteTx() 在事务中删除用户
+*/
+func (me *User) DeleteTx(tx *sql.Tx) bool {
+	return DeleteDaoByIDTx(tx, common.UserTbl, me.ID)
+}
+
+/******************************************************************************
+ * function: LockUserTx
+ * description: 在事务中锁定用户记录, 用户不存在时返回false
+ * param {*sql.Tx} tx
+ * param {int64} userId
+ * return {*} 用户是否存在, 查询是否成功
+********************************************************************************/
+func LockUserTx(tx *sql.Tx, userId int64) (bool, bool) {
+	var id int64
+	err := tx.QueryRow("select id from "+common.UserTbl+" where id=? for update", userId).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, true
+	} else if err != nil {
+		mylog.Log.Errorln(err)
+		return false, false
+	}
+	return true, true
+}
+
 /*
 设置ID
 */
@@ -510,6 +565,27 @@ func DeleteUserRelationByUserId(userId int64, friendId int64) bool {
 	return DeleteDaoByFilter(common.FriendsTbl, filter)
 }
 
+/******************************************************************************
+ * function: DeleteUserRelationByUserIdTx
+ * description: 在事务中删除用户的好友关系, friendId为0时删除用户所有好友
+ * param {*sql.Tx} tx
+ * param {int64} userId
+ * param {int64} friendId
+ * return {*}
+********************************************************************************/
+func DeleteUserRelationByUserIdTx(tx *sql.Tx, userId int64, friendId int64) bool {
+	if !CheckTableExist(common.FriendsTbl) {
+		return true
+	}
+	var filter string
+	if friendId == 0 {
+		filter = fmt.Sprintf("user_id=%d", userId)
+	} else {
+		filter = fmt.Sprintf("user_id=%d and friend_id=%d", userId, friendId)
+	}
+	return DeleteDaoByFilterTx(tx, common.FriendsTbl, filter)
+}
+
 /*
 ********************************************************************************
 
@@ -689,6 +765,17 @@ func (me *UserDeviceRelation) Delete() bool {
 	return DeleteDaoByID(common.UserDeviceRelationTbl, me.ID)
 }
 
+/*
+InsertTx() 在事务中插入用户和设备关系, 表不存在时先在事务外建表
+*/
+func (me *UserDeviceRelation) InsertTx(tx *sql.Tx) bool {
+	tblName := common.UserDeviceRelationTbl
+	if !CheckTableExist(tblName) {
+		CreateTableWithStruct(tblName, me)
+	}
+	return InsertDaoTx(tx, tblName, me)
+}
+
 /*
 设置ID
 */
@@ -702,20 +789,33 @@ func (me *UserDeviceRelation) SetID(id int64) {
  * return {*}
 ********************************************************************************/
 func (me *UserDeviceRelation) DeleteWithUser() bool {
+	return me.deleteWithUser(mDb)
+}
+
+/******************************************************************************
+ * function: DeleteWithUserTx
+ * description: 在事务中删除用户和设备的关系
+ * param {*sql.Tx} tx
+ * return {*}
+********************************************************************************/
+func (me *UserDeviceRelation) DeleteWithUserTx(tx *sql.Tx) bool {
+	return me.deleteWithUser(tx)
+}
+
+func (me *UserDeviceRelation) deleteWithUser(db DbExecutor) bool {
 	filter := fmt.Sprintf("user_id=%d and device_id=%d", me.UserId, me.DeviceId)
-	var vList []UserDeviceRelation
-	QueryUserDeviceRelationByCond(filter, nil, nil, &vList)
-	if len(vList) == 0 {
+	row := db.QueryRow("select id, flag from " + common.UserDeviceRelationTbl + " where " + filter + " limit 1")
+	err := row.Scan(&me.ID, &me.Flag)
+	if err == sql.ErrNoRows {
 		return true
+	} else if err != nil {
+		mylog.Log.Errorln(err)
+		return false
 	}
-	me.ID = vList[0].ID
-	me.Flag = vList[0].Flag
 	if me.Flag == common.NormalDeviceFlag {
 		filter = fmt.Sprintf("device_id=%d", me.DeviceId)
-	} else {
-		filter = fmt.Sprintf("user_id=%d and device_id=%d", me.UserId, me.DeviceId)
 	}
-	return DeleteDaoByFilter(common.UserDeviceRelationTbl, filter)
+	return deleteDaoByFilter(db, common.UserDeviceRelationTbl, filter)
 }
 
 func DeleteDeviceRelationByUserId(userId int64) bool {
@@ -723,6 +823,122 @@ func DeleteDeviceRelationByUserId(userId int64) bool {
 	return DeleteDaoByFilter(common.UserDeviceRelationTbl, filter)
 }
 
+/******************************************************************************
+ * function: DeleteDeviceRelationByUserIdTx
+ * description: 在事务中删除用户所有的设备关系
+ * param {*sql.Tx} tx
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func DeleteDeviceRelationByUserIdTx(tx *sql.Tx, userId int64) bool {
+	if !CheckTableExist(common.UserDeviceRelationTbl) {
+		return true
+	}
+	filter := fmt.Sprintf("user_id=%d", userId)
+	return DeleteDaoByFilterTx(tx, common.UserDeviceRelationTbl, filter)
+}
+
+/******************************************************************************
+ * function: QueryOwnDeviceIdsTx
+ * description: 在事务中查询并锁定用户自己创建的设备关系, 返回设备id
+ * param {*sql.Tx} tx
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func QueryOwnDeviceIdsTx(tx *sql.Tx, userId int64) ([]int64, bool) {
+	if !CheckTableExist(common.UserDeviceRelationTbl) {
+		return nil, true
+	}
+	rows, err := tx.Query("select device_id from "+common.UserDeviceRelationTbl+" where user_id=? and flag=? for update",
+		userId, common.NormalDeviceFlag)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			mylog.Log.Errorln(err)
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+/******************************************************************************
+ * function: QueryUserDeviceFlagTx
+ * description: 在事务中查询并锁定用户和设备的关系, 同时存在自己创建和共享的关系时返回自己创建
+ * param {*sql.Tx} tx
+ * param {int64} userId
+ * param {int64} deviceId
+ * return {*} flag, 关系是否存在, 查询是否成功
+********************************************************************************/
+func QueryUserDeviceFlagTx(tx *sql.Tx, userId int64, deviceId int64) (int, bool, bool) {
+	if !CheckTableExist(common.UserDeviceRelationTbl) {
+		return 0, false, true
+	}
+	var flag int
+	err := tx.QueryRow("select flag from "+common.UserDeviceRelationTbl+
+		" where user_id=? and device_id=? order by flag limit 1 for update", userId, deviceId).Scan(&flag)
+	if err == sql.ErrNoRows {
+		return 0, false, true
+	} else if err != nil {
+		mylog.Log.Errorln(err)
+		return 0, false, false
+	}
+	return flag, true, true
+}
+
+/******************************************************************************
+ * function: DeleteDeviceRelationByDeviceIdTx
+ * description: 在事务中删除设备和所有用户的关系, 用于删除设备的创建者
+ * param {*sql.Tx} tx
+ * param {int64} deviceId
+ * return {*}
+********************************************************************************/
+func DeleteDeviceRelationByDeviceIdTx(tx *sql.Tx, deviceId int64) bool {
+	if !CheckTableExist(common.UserDeviceRelationTbl) {
+		return true
+	}
+	filter := fmt.Sprintf("device_id=%d", deviceId)
+	return DeleteDaoByFilterTx(tx, common.UserDeviceRelationTbl, filter)
+}
+
+/******************************************************************************
+ * function: QueryUserDeviceFlag
+ * description: 查询用户和设备的关系, 设备用id或mac指定, 用于接口鉴权
+ * 同时存在自己创建和共享的关系时返回自己创建
+ * param {int64} userId
+ * param {int64} deviceId 为0时按mac查询
+ * param {string} mac
+ * return {*} flag 0:自己创建 1:共享, 没有关系时返回false
+********************************************************************************/
+func QueryUserDeviceFlag(userId int64, deviceId int64, mac string) (int, bool) {
+	sqlStr := "select a.flag from " + common.UserDeviceRelationTbl + " a join " + common.DeviceTbl +
+		" b on a.device_id=b.id where a.user_id=?"
+	args := []interface{}{userId}
+	if deviceId > 0 {
+		sqlStr += " and b.id=?"
+		args = append(args, deviceId)
+	} else {
+		sqlStr += " and b.mac=?"
+		args = append(args, mac)
+	}
+	sqlStr += " order by a.flag limit 1"
+	var flag int
+	err := mDb.QueryRow(sqlStr, args...).Scan(&flag)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			mylog.Log.Errorln(err)
+		}
+		return 0, false
+	}
+	return flag, true
+}
+
 /*
 ********************************************************************************
 
@@ -852,7 +1068,8 @@ func QueryUserDeviceDetailByMac(mac string, results *[]UserDeviceDetail) bool {
 
 /******************************************************************************
  * function: RegisterWithUserObj
- * description: 注册一个用户，参数为User对象
+ * description: 注册一个用户，参数为User对象, 密码需要调用者用common.HashPassword计算哈希,
+ * 为空时该账号不能用密码登录
  * param {*mysql.User} me
  * return {*}
 ********************************************************************************/
@@ -869,27 +1086,29 @@ func RegisterWithUserObj(me *User) (int, interface{}) {
 	if me.Phone != "" {
 		me.Phone = common.FixPlusInPhoneString(me.Phone)
 	}
-	filter := fmt.Sprintf("account = '%s'", me.Account)
+	filter := fmt.Sprintf("account = '%s'", common.EscapeSql(me.Account))
 	var gList []User
 	QueryUserByCond(filter, nil, nil, &gList)
 	if len(gList) > 0 {
 		return common.AccountHasReg, "account has registered"
 	}
 	if me.Phone != "" {
-		filter = fmt.Sprintf("phone = '%s'", me.Phone)
+		filter = fmt.Sprintf("phone = '%s'", common.EscapeSql(me.Phone))
 		QueryUserByCond(filter, nil, nil, &gList)
 		if len(gList) > 0 {
 			return common.PhoneHasReg, "phone has registered"
 		}
 	}
 	if me.Email != "" {
-		filter = fmt.Sprintf("email = '%s'", me.Email)
+		filter = fmt.Sprintf("email = '%s'", common.EscapeSql(me.Email))
 		QueryUserByCond(filter, nil, nil, &gList)
 		if len(gList) > 0 {
 			return common.EmailHasReg, "email has registered"
 		}
 	}
-	me.Password, _ = common.EncryptDataWithDefaultkey(me.Password)
+	if me.Password != "" && !common.IsPasswordHash(me.Password) {
+		return common.ParamError, "password must be hashed"
+	}
 	me.IsLogin = 1
 	me.LoginTime = common.GetNowTime()
 	me.CreateTime = common.GetNowTime()
@@ -983,6 +1202,30 @@ func (me *UserShareDevice) Delete() bool {
 	return DeleteDaoByID(me.MyTableName(), me.ID)
 }
 
+/*
+InsertTx() 在事务中插入共享记录
+*/
+func (me *UserShareDevice) InsertTx(tx *sql.Tx) bool {
+	if !CheckTableExist(me.MyTableName()) {
+		CreateTableWithStruct(me.MyTableName(), me)
+	}
+	return InsertDaoTx(tx, me.MyTableName(), me)
+}
+
+/*
+UpdateTx() 在事务中更新共享记录
+*/
+func (me *UserShareDevice) UpdateTx(tx *sql.Tx) bool {
+	return UpdateDaoByIDTx(tx, me.MyTableName(), me.ID, me)
+}
+
+/*
+DeleteTx() 在事务中删除共享记录
+*/
+func (me *UserShareDevice) DeleteTx(tx *sql.Tx) bool {
+	return DeleteDaoByIDTx(tx, me.MyTableName(), me.ID)
+}
+
 /*
 设置ID
 */
@@ -991,17 +1234,47 @@ func (me *UserShareDevice) SetID(id int64) {
 }
 
 func DeleteUserShareDeviceByUserId(fromUserId int64, toUserId int64, deviceId int64) bool {
-	filter := ""
-	if fromUserId != 0 {
-		filter += " from_user_id=" + fmt.Sprintf("%d", fromUserId)
+	filter := makeShareDeviceFilter(fromUserId, toUserId, deviceId)
+	return DeleteDaoByFilter(common.UserShareDeviceTbl, filter)
+}
+
+/******************************************************************************
+ * function: DeleteUserShareDeviceByUserIdTx
+ * description: 在事务中根据用户id删除设备共享记录
+ * param {*sql.Tx} tx
+ * param {int64} fromUserId
+ * param {int64} toUserId
+ * param {int64} deviceId
+ * return {*}
+********************************************************************************/
+func DeleteUserShareDeviceByUserIdTx(tx *sql.Tx, fromUserId int64, toUserId int64, deviceId int64) bool {
+	if !CheckTableExist(common.UserShareDeviceTbl) {
+		return true
 	}
-	if toUserId != 0 {
-		filter += " and to_user_id=" + fmt.Sprintf("%d", toUserId)
+	filter := makeShareDeviceFilter(fromUserId, toUserId, deviceId)
+	return DeleteDaoByFilterTx(tx, common.UserShareDeviceTbl, filter)
+}
+
+/******************************************************************************
+ * function: makeShareDeviceFilter
+ * description: 生成共享和过户表的删除条件, 参数为0时忽略此条件
+ * param {int64} fromUserId
+ * param {int64} toUserId
+ * param {int64} deviceId
+ * return {*}
+********************************************************************************/
+func makeShareDeviceFilter(fromUserId int64, toUserId int64, deviceId int64) string {
+	var conds []string
+	if fromUserId > 0 {
+		conds = append(conds, fmt.Sprintf("from_user_id=%d", fromUserId))
 	}
-	if deviceId != 0 {
-		filter += " and device_id=" + fmt.Sprintf("%d", deviceId)
+	if toUserId > 0 {
+		conds = append(conds, fmt.Sprintf("to_user_id=%d", toUserId))
 	}
-	return DeleteDaoByFilter(common.UserShareDeviceTbl, filter)
+	if deviceId > 0 {
+		conds = append(conds, fmt.Sprintf("device_id=%d", deviceId))
+	}
+	return strings.Join(conds, " and ")
 }
 
 /******************************************************************************
@@ -1242,6 +1515,30 @@ func (me *UserTransferDevice) Delete() bool {
 	return DeleteDaoByID(me.MyTableName(), me.ID)
 }
 
+/*
+InsertTx() 在事务中插入过户记录
+*/
+func (me *UserTransferDevice) InsertTx(tx *sql.Tx) bool {
+	if !CheckTableExist(me.MyTableName()) {
+		CreateTableWithStruct(me.MyTableName(), me)
+	}
+	return InsertDaoTx(tx, me.MyTableName(), me)
+}
+
+/*
+UpdateTx() 在事务中更新过户记录
+*/
+func (me *UserTransferDevice) UpdateTx(tx *sql.Tx) bool {
+	return UpdateDaoByIDTx(tx, me.MyTableName(), me.ID, me)
+}
+
+/*
+DeleteTx() 在事务中删除过户记录
+*/
+func (me *UserTransferDevice) DeleteTx(tx *sql.Tx) bool {
+	return DeleteDaoByIDTx(tx, me.MyTableName(), me.ID)
+}
+
 /*
 设置ID
 */
@@ -1258,19 +1555,27 @@ func (me *UserTransferDevice) SetID(id int64) {
  * return {*}
 ********************************************************************************/
 func DeleteUserTransferDeviceByUserId(fromUserId int64, toUserId int64, deviceId int64) bool {
-	filter := ""
-	if fromUserId > 0 {
-		filter += " from_user_id=" + fmt.Sprintf("%d", fromUserId)
-	}
-	if toUserId > 0 {
-		filter += " and to_user_id=" + fmt.Sprintf("%d", toUserId)
-	}
-	if deviceId > 0 {
-		filter += " and device_id=" + fmt.Sprintf("%d", deviceId)
-	}
+	filter := makeShareDeviceFilter(fromUserId, toUserId, deviceId)
 	return DeleteDaoByFilter(common.UserTransferDeviceTbl, filter)
 }
 
+/******************************************************************************
+ * function: DeleteUserTransferDeviceByUserIdTx
+ * description: 在事务中根据用户id删除设备过户记录
+ * param {*sql.Tx} tx
+ * param {int64} fromUserId
+ * param {int64} toUserId
+ * param {int64} deviceId
+ * return {*}
+********************************************************************************/
+func DeleteUserTransferDeviceByUserIdTx(tx *sql.Tx, fromUserId int64, toUserId int64, deviceId int64) bool {
+	if !CheckTableExist(common.UserTransferDeviceTbl) {
+		return true
+	}
+	filter := makeShareDeviceFilter(fromUserId, toUserId, deviceId)
+	return DeleteDaoByFilterTx(tx, common.UserTransferDeviceTbl, filter)
+}
+
 /******************************************************************************
  * function:
  * description:
@@ -1407,3 +1712,162 @@ func QueryUserTransferDeviceDetail(fromUserId int64, toUserId int64, deviceId in
 	}
 	return true
 }
+
+/******************************************************************************
+ * function: migrateUserPasswordColumn
+ * description: 旧表的password为char(32), 放不下bcrypt哈希, 启动时扩大为varchar(128)
+ * return {*}
+********************************************************************************/
+func migrateUserPasswordColumn() {
+	if !CheckTableExist(common.UserTbl) {
+		return
+	}
+	var length int
+	row := mDb.QueryRow("select character_maximum_length from information_schema.columns "+
+		"where table_schema=database() and table_name=? and column_name='password'", common.UserTbl)
+	if err := row.Scan(&length); err != nil {
+		mylog.Log.Errorln("query password column error:", err)
+		return
+	}
+	if length >= 128 {
+		return
+	}
+	sql := fmt.Sprintf("alter table %s modify column password varchar(128) NOT NULL COMMENT '密码哈希'", common.UserTbl)
+	if _, err := mDb.Exec(sql); err != nil {
+		mylog.Log.Errorln("modify password column error:", err)
+		return
+	}
+	mylog.Log.Infoln("password column of", common.UserTbl, "extended to varchar(128)")
+}
+
+/******************************************************************************
+ * function: migrateUserLocaleColumn
+ * description: 旧表没有locale字段, 启动时增加, 并按紧急联系电话的号段设置语言,
+ * 与原来按号段选择短信内容的语言一致
+ * return {*}
+********************************************************************************/
+func migrateUserLocaleColumn() {
+	if !CheckTableExist(common.UserTbl) {
+		return
+	}
+	if tableHasColumn(common.UserTbl, "locale") {
+		return
+	}
+	sql := fmt.Sprintf("alter table %s add column locale varchar(16) default '' comment '首选语言'", common.UserTbl)
+	if _, err := mDb.Exec(sql); err != nil {
+		mylog.Log.Errorln("add locale column error:", err)
+		return
+	}
+	updates := []string{
+		"update %s set locale='zh-HK' where emergent_phone like '+852%%' or (length(emergent_phone)=8 and left(emergent_phone, 1) in ('2','3','5','6','8','9'))",
+		"update %s set locale='zh-CN' where locale='' and (emergent_phone like '+86%%' or (length(emergent_phone)=11 and left(emergent_phone, 1)='1'))",
+		"update %s set locale='en' where locale='' and length(emergent_phone)>4",
+	}
+	for _, update := range updates {
+		if _, err := mDb.Exec(fmt.Sprintf(update, common.UserTbl)); err != nil {
+			mylog.Log.Errorln("init user locale error:", err)
+		}
+	}
+	mylog.Log.Infoln("locale column added to", common.UserTbl)
+}
+
+/******************************************************************************
+ * function: flagLegacyPasswordsForReset
+ * description: 超过配置的迁移期限后, 仍然是旧的可逆加密的密码替换为重置标记,
+ * 这些用户需要重置密码后才能登录
+ * return {*}
+********************************************************************************/
+func flagLegacyPasswordsForReset() {
+	if cfg.This.Svr.PasswordResetAfter == "" || !CheckTableExist(common.UserTbl) {
+		return
+	}
+	deadline, err := time.ParseInLocation(cfg.DateFmtStr, cfg.This.Svr.PasswordResetAfter, time.Local)
+	if err != nil {
+		mylog.Log.Errorln("password_reset_after format error:", err)
+		return
+	}
+	if time.Now().Before(deadline) {
+		return
+	}
+	sql := fmt.Sprintf("update %s set password=? where account<>'guest' and password<>? "+
+		"and password not like '$2a$%%' and password not like '$2b$%%' and password not like '$2y$%%'", common.UserTbl)
+	result, err := mDb.Exec(sql, common.PasswordResetRequired, common.PasswordResetRequired)
+	if err != nil {
+		mylog.Log.Errorln("flag legacy passwords error:", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		mylog.Log.Infof("%d legacy passwords flagged for reset", n)
+	}
+}
+
+/******************************************************************************
+ * function: migrateUserEmailVerifiedColumn
+ * description: 用户表增加邮箱是否已验证的字段, 原有的邮箱按未验证处理, 验证后才发送通知邮件,
+ * 同时把邮箱的长度扩大到128
+ * return {*}
+********************************************************************************/
+func migrateUserEmailVerifiedColumn() {
+	if !CheckTableExist(common.UserTbl) {
+		return
+	}
+	if tableHasColumn(common.UserTbl, "email_verified") {
+		return
+	}
+	sqlStr := fmt.Sprintf("alter table %s modify column email varchar(128) comment '邮箱', "+
+		"add column email_verified int default 0 comment '邮箱是否已验证'", common.UserTbl)
+	if _, err := mDb.Exec(sqlStr); err != nil {
+		mylog.Log.Errorln("add email_verified column error:", err)
+		return
+	}
+	mylog.Log.Infoln("email_verified column added to", common.UserTbl)
+}
+
+/******************************************************************************
+ * function: migrateUserEmailUniqueIndex
+ * description: 用户表的邮箱增加唯一索引, 空邮箱不受限制. 已验证的邮箱同时出现在未验证的用户上时,
+ * 清空未验证用户的邮箱; 仍有重复时不建立索引, 记录日志由人工处理, 下次启动时再检查
+ * return {*}
+********************************************************************************/
+func migrateUserEmailUniqueIndex() {
+	if !CheckTableExist(common.UserTbl) {
+		return
+	}
+	var count int
+	row := mDb.QueryRow("select count(*) from information_schema.statistics "+
+		"where table_schema=database() and table_name=? and index_name='uk_email'", common.UserTbl)
+	if err := row.Scan(&count); err != nil {
+		mylog.Log.Errorln("query email index error:", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	sqlStr := fmt.Sprintf("update %[1]s a join (select lower(email) email from %[1]s where email_verified=1 and email<>'' "+
+		"group by lower(email) having count(*)=1) b on lower(a.email)=b.email set a.email='' where a.email_verified=0",
+		common.UserTbl)
+	result, err := mDb.Exec(sqlStr)
+	if err != nil {
+		mylog.Log.Errorln("clear duplicate emails error:", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		mylog.Log.Infof("%d unverified duplicate emails cleared", n)
+	}
+	row = mDb.QueryRow(fmt.Sprintf("select count(*) from (select lower(email) from %s where email<>'' "+
+		"group by lower(email) having count(*)>1) t", common.UserTbl))
+	if err := row.Scan(&count); err != nil {
+		mylog.Log.Errorln("query duplicate emails error:", err)
+		return
+	}
+	if count > 0 {
+		mylog.Log.Errorf("%d emails are used by several users, unique index of email not created", count)
+		return
+	}
+	sqlStr = fmt.Sprintf("alter table %s add unique index uk_email ((nullif(lower(email), '')))", common.UserTbl)
+	if _, err := mDb.Exec(sqlStr); err != nil {
+		mylog.Log.Errorln("add email unique index error:", err)
+		return
+	}
+	mylog.Log.Infoln("unique index of email added to", common.UserTbl)
+}
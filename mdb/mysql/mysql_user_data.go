@@ -0,0 +1,237 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/exception"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define user data job type
+const (
+	UserDataExportJob = 1
+	UserDataEraseJob  = 2
+)
+
+// define user data job status
+const (
+	UserDataJobPending  = 0
+	UserDataJobRunning  = 1
+	UserDataJobFinished = 2
+	UserDataJobFailed   = 3
+	UserDataJobExpired  = 4
+)
+
+// 导出文件保留天数
+const userDataExportKeepDays = 7
+
+// swagger:model UserDataJob
+type UserDataJob struct {
+	ID     int64 `json:"id" mysql:"id"`
+	UserId int64 `json:"user_id" mysql:"user_id"`
+	// 1:导出 2:删除
+	JobType int `json:"job_type" mysql:"job_type"`
+	// 0:等待 1:执行中 2:完成 3:失败 4:导出文件已过期
+	Status int `json:"status" mysql:"status"`
+	// 导出文件路径, 不对外返回
+	FileName string `json:"-" mysql:"file_name"`
+	// 下载导出文件的校验码, 不对外返回
+	DownloadKey string `json:"-" mysql:"download_key"`
+	Message     string `json:"message" mysql:"message"`
+	CreateTime  string `json:"create_time" mysql:"create_time"`
+	FinishTime  string `json:"finish_time" mysql:"finish_time"`
+}
+
+func NewUserDataJob() *UserDataJob {
+	return &UserDataJob{
+		ID:          0,
+		UserId:      0,
+		JobType:     UserDataExportJob,
+		Status:      UserDataJobPending,
+		FileName:    "",
+		DownloadKey: "",
+		Message:     "",
+		CreateTime:  common.GetNowTime(),
+		FinishTime:  common.GetNowTime(),
+	}
+}
+
+func (me *UserDataJob) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *UserDataJob) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.UserId, &me.JobType, &me.Status, &me.FileName, &me.DownloadKey, &me.Message, &me.CreateTime, &me.FinishTime)
+	return err
+}
+func (me *UserDataJob) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.UserId, &me.JobType, &me.Status, &me.FileName, &me.DownloadKey, &me.Message, &me.CreateTime, &me.FinishTime)
+	return err
+}
+func (me *UserDataJob) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.UserDataJobTbl, me.ID, me)
+}
+func (me *UserDataJob) Insert() bool {
+	tblName := common.UserDataJobTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id MEDIUMINT NOT NULL AUTO_INCREMENT,
+			user_id bigint not null comment '用户id',
+			job_type int not null comment '任务类型 1:导出 2:删除',
+			status int not null default 0 comment '任务状态',
+			file_name varchar(255) default '' comment '导出文件',
+			download_key varchar(64) default '' comment '下载校验码',
+			message varchar(1024) default '' comment '任务结果信息',
+			create_time datetime comment '创建时间',
+			finish_time datetime comment '完成时间',
+			PRIMARY KEY (id),
+			KEY idx_user_id (user_id)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *UserDataJob) Update() bool {
+	return UpdateDaoByID(common.UserDataJobTbl, me.ID, me)
+}
+func (me *UserDataJob) Delete() bool {
+	return DeleteDaoByID(common.UserDataJobTbl, me.ID)
+}
+func (me *UserDataJob) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryUserDataJobByCond(filter interface{}, sort interface{}, results *[]UserDataJob) bool {
+	return QueryDao(common.UserDataJobTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewUserDataJob()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}, ReadPrimary)
+}
+
+/******************************************************************************
+ * function: QueryTableAsMaps
+ * description: 按条件查询表的所有字段, 每条记录转换为字段名到值的map, 用于数据导出
+ * 表不存在时返回空结果
+ * param {string} table
+ * param {string} filter
+ * return {*}
+********************************************************************************/
+func QueryTableAsMaps(table string, filter string) ([]map[string]interface{}, bool) {
+	var results []map[string]interface{}
+	if !CheckTableExist(table) {
+		return results, true
+	}
+	rows, err := mDb.Query("select * from " + table + " where " + filter)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return nil, false
+	}
+	for rows.Next() {
+		values := make([]sql.RawBytes, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			mylog.Log.Errorln(err)
+			return nil, false
+		}
+		obj := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			if values[i] == nil {
+				obj[col] = nil
+			} else {
+				obj[col] = string(values[i])
+			}
+		}
+		results = append(results, obj)
+	}
+	return results, true
+}
+
+/******************************************************************************
+ * function: CountTableByFilter
+ * description: 按条件统计表的记录数, 表不存在时返回0, 用于校验数据是否删除干净
+ * param {string} table
+ * param {string} filter
+ * return {*}
+********************************************************************************/
+func CountTableByFilter(table string, filter string) (int64, bool) {
+	if !CheckTableExist(table) {
+		return 0, true
+	}
+	var count int64
+	row := mDb.QueryRow("select count(*) from " + table + " where " + filter)
+	if err := row.Scan(&count); err != nil {
+		mylog.Log.Errorln(err)
+		return 0, false
+	}
+	return count, true
+}
+
+/******************************************************************************
+ * function: ExecByFilterTx
+ * description: 在事务中执行update/delete语句, 表不存在时直接返回成功
+ * param {*sql.Tx} tx
+ * param {string} table
+ * param {string} stmt 完整的sql语句
+ * return {*}
+********************************************************************************/
+func ExecByFilterTx(tx *sql.Tx, table string, stmt string) bool {
+	if !CheckTableExist(table) {
+		return true
+	}
+	if _, err := tx.Exec(stmt); err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	return true
+}
+
+/******************************************************************************
+ * function: cleanupExpiredUserDataExports
+ * description: 删除超过保留天数的导出文件, 任务状态置为已过期
+ * return {*}
+********************************************************************************/
+func cleanupExpiredUserDataExports() {
+	if !CheckTableExist(common.UserDataJobTbl) {
+		return
+	}
+	tm := time.Now().AddDate(0, 0, -userDataExportKeepDays).Format(cfg.TmFmtStr)
+	filter := fmt.Sprintf("job_type=%d and status=%d and finish_time<'%s'", UserDataExportJob, UserDataJobFinished, tm)
+	var jobs []UserDataJob
+	QueryUserDataJobByCond(filter, nil, &jobs)
+	for _, v := range jobs {
+		if v.FileName != "" {
+			if err := os.Remove(v.FileName); err != nil && !os.IsNotExist(err) {
+				mylog.Log.Errorln(err)
+				continue
+			}
+		}
+		v.Status = UserDataJobExpired
+		v.FileName = ""
+		v.DownloadKey = ""
+		v.Update()
+	}
+}
@@ -0,0 +1,788 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"hjyserver/cfg"
+	"hjyserver/exception"
+	"hjyserver/gopool"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/redis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// define webhook event type
+const (
+	// 设备报警, 包括睡眠报警和人员、呼吸、心率通知
+	WebhookAlarmRaised = "alarm.raised"
+	// 设备上线
+	WebhookDeviceOnline = "device.online"
+	// 设备离线
+	WebhookDeviceOffline = "device.offline"
+	// 学习报告生成
+	WebhookStudyReportReady = "report.study_ready"
+	// 睡眠报告生成
+	WebhookSleepReportReady = "report.sleep_ready"
+	// 跌倒报警
+	WebhookFallDetected = "fall.detected"
+	// 报警未确认, 按升级策略推送
+	WebhookAlarmEscalated = "alarm.escalated"
+	// 用户定义的指标规则触发
+	WebhookRuleTriggered = "rule.triggered"
+)
+
+// 各事件需要机构的api key有对应的授权范围, 并且设备在允许列表中
+var webhookEventScopes = map[string]string{
+	WebhookAlarmRaised:      ScopeAlarmsReceive,
+	WebhookDeviceOnline:     ScopeAlarmsReceive,
+	WebhookDeviceOffline:    ScopeAlarmsReceive,
+	WebhookStudyReportReady: ScopeReportsRead,
+	WebhookSleepReportReady: ScopeReportsRead,
+	WebhookFallDetected:     ScopeAlarmsReceive,
+	WebhookAlarmEscalated:   ScopeAlarmsReceive,
+	WebhookRuleTriggered:    ScopeAlarmsReceive,
+}
+
+// define webhook status
+const (
+	WebhookDisabled = 0
+	WebhookEnabled  = 1
+)
+
+// define webhook delivery status
+const (
+	// 等待推送或者等待重试
+	DeliveryPending = 0
+	DeliverySuccess = 1
+	// 超过最多推送次数, 进入死信列表
+	DeliveryDead = 2
+)
+
+// 推送请求头
+const (
+	WebhookEventHeader     = "X-Hjy-Event"
+	WebhookDeliveryHeader  = "X-Hjy-Delivery"
+	WebhookSignatureHeader = "X-Hjy-Signature"
+)
+
+// 最长重试间隔
+const webhookMaxBackoff = 6 * time.Hour
+
+// 推送中的记录先占用一段时间, 避免被重试任务重复推送
+const webhookLease = 5 * time.Minute
+
+// swagger:model Webhook
+type Webhook struct {
+	ID    int64 `json:"id" mysql:"id"`
+	OrgId int64 `json:"org_id" mysql:"org_id"`
+	// 接收推送的https地址
+	Url string `json:"url" mysql:"url"`
+	// 签名密钥, 只在创建时返回一次
+	Secret string `json:"-" mysql:"secret"`
+	// 订阅的事件, 逗号分隔
+	Events string `json:"events" mysql:"events"`
+	// 0:停用 1:启用
+	Status     int    `json:"status" mysql:"status"`
+	OperatorId int64  `json:"operator_id" mysql:"operator_id"`
+	CreateTime string `json:"create_time" mysql:"create_time"`
+	UpdateTime string `json:"update_time" mysql:"update_time"`
+}
+
+func NewWebhook() *Webhook {
+	return &Webhook{
+		ID:         0,
+		OrgId:      0,
+		Url:        "",
+		Secret:     "",
+		Events:     "",
+		Status:     WebhookEnabled,
+		OperatorId: 0,
+		CreateTime: common.GetNowTime(),
+		UpdateTime: common.GetNowTime(),
+	}
+}
+
+func (me *Webhook) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *Webhook) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.OrgId, &me.Url, &me.Secret, &me.Events, &me.Status, &me.OperatorId,
+		&me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *Webhook) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.OrgId, &me.Url, &me.Secret, &me.Events, &me.Status, &me.OperatorId,
+		&me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *Webhook) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.WebhookTbl, me.ID, me)
+}
+func (me *Webhook) Insert() bool {
+	tblName := common.WebhookTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			org_id bigint not null comment '机构id',
+			url varchar(512) not null comment '推送地址',
+			secret varchar(64) not null comment '签名密钥',
+			events varchar(255) default '' comment '订阅的事件',
+			status int not null default 1 comment '0:停用 1:启用',
+			operator_id bigint default 0 comment '创建webhook的管理员id',
+			create_time datetime comment '创建时间',
+			update_time datetime comment '更新时间',
+			PRIMARY KEY (id),
+			KEY idx_org_id (org_id)
+		)`
+		CreateTable(sql)
+	}
+	return InsertDao(tblName, me)
+}
+func (me *Webhook) Update() bool {
+	return UpdateDaoByID(common.WebhookTbl, me.ID, me)
+}
+func (me *Webhook) Delete() bool {
+	return DeleteDaoByID(common.WebhookTbl, me.ID)
+}
+func (me *Webhook) SetID(id int64) {
+	me.ID = id
+}
+
+/******************************************************************************
+ * function: migrateWebhookIdColumn
+ * description: 旧表的id是MEDIUMINT, 和webhook_delivery_tbl的webhook_id不一致, 启动时改为bigint
+ * return {*}
+********************************************************************************/
+func migrateWebhookIdColumn() {
+	if !CheckTableExist(common.WebhookTbl) {
+		return
+	}
+	var dataType string
+	row := mDb.QueryRow("select data_type from information_schema.columns "+
+		"where table_schema=database() and table_name=? and column_name='id'", common.WebhookTbl)
+	if err := row.Scan(&dataType); err != nil {
+		mylog.Log.Errorln("query webhook id column error:", err)
+		return
+	}
+	if strings.EqualFold(dataType, "bigint") {
+		return
+	}
+	sql := fmt.Sprintf("alter table %s modify column id bigint NOT NULL AUTO_INCREMENT", common.WebhookTbl)
+	if _, err := mDb.Exec(sql); err != nil {
+		mylog.Log.Errorln("modify webhook id column error:", err)
+		return
+	}
+	mylog.Log.Infoln("id column of", common.WebhookTbl, "changed to bigint")
+}
+
+// Subscribed 检查webhook是否订阅了事件
+func (me *Webhook) Subscribed(event string) bool {
+	for _, v := range strings.Split(me.Events, ",") {
+		if v == event {
+			return true
+		}
+	}
+	return false
+}
+
+func QueryWebhookByCond(filter interface{}, sort interface{}, results *[]Webhook) bool {
+	return QueryDao(common.WebhookTbl, filter, sort, -1, func(rows *sql.Rows) {
+		obj := NewWebhook()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	})
+}
+
+// IsValidWebhookEvent 检查事件类型是否支持
+func IsValidWebhookEvent(event string) bool {
+	_, ok := webhookEventScopes[event]
+	return ok
+}
+
+// 推送地址解析到内网地址时拒绝推送
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// 运营商级NAT地址段, net.IP.IsPrivate不包含
+var _, carrierNatNet, _ = net.ParseCIDR("100.64.0.0/10")
+
+// isPublicIp 排除回环、内网、链路本地、组播和未指定地址
+func isPublicIp(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !carrierNatNet.Contains(ip)
+}
+
+/******************************************************************************
+ * function: IsValidWebhookUrl
+ * description: 只允许推送到https地址, 域名解析出的所有地址都必须是公网地址
+ * param {string} rawUrl
+ * return {*}
+********************************************************************************/
+func IsValidWebhookUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return false
+	}
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !isPublicIp(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialControl 连接前检查实际连接的地址, 防止推送时域名被解析到内网地址
+func webhookDialControl(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublicIp(net.ParseIP(host)) {
+		return errWebhookAddress
+	}
+	return nil
+}
+
+// webhookClient 推送使用的http客户端, 不使用代理, 只连接公网地址
+func webhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: webhookDialControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
+
+/******************************************************************************
+ * function: CreateWebhook
+ * description: 生成签名密钥并保存webhook
+ * param {*Webhook} me
+ * return {*} 签名密钥, 是否成功
+********************************************************************************/
+func CreateWebhook(me *Webhook) (string, bool) {
+	secret, err := randomHex(24)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return "", false
+	}
+	me.Secret = "whsec_" + secret
+	me.Status = WebhookEnabled
+	me.CreateTime = common.GetNowTime()
+	me.UpdateTime = me.CreateTime
+	if !me.Insert() {
+		return "", false
+	}
+	return me.Secret, true
+}
+
+// swagger:model WebhookDelivery
+type WebhookDelivery struct {
+	ID        int64 `json:"id" mysql:"id"`
+	WebhookId int64 `json:"webhook_id" mysql:"webhook_id"`
+	// 事件id, 重试时不变, 接收方可以用来去重
+	EventId   string `json:"event_id" mysql:"event_id"`
+	EventType string `json:"event_type" mysql:"event_type"`
+	Mac       string `json:"mac" mysql:"mac"`
+	// 推送的json内容
+	Payload string `json:"payload" mysql:"payload"`
+	// 0:等待推送 1:成功 2:死信
+	Status        int    `json:"status" mysql:"status"`
+	Attempts      int    `json:"attempts" mysql:"attempts"`
+	ResponseCode  int    `json:"response_code" mysql:"response_code"`
+	LastError     string `json:"last_error" mysql:"last_error"`
+	NextRetryTime string `json:"next_retry_time" mysql:"next_retry_time"`
+	CreateTime    string `json:"create_time" mysql:"create_time"`
+	UpdateTime    string `json:"update_time" mysql:"update_time"`
+}
+
+func NewWebhookDelivery() *WebhookDelivery {
+	return &WebhookDelivery{
+		ID:            0,
+		WebhookId:     0,
+		EventId:       "",
+		EventType:     "",
+		Mac:           "",
+		Payload:       "",
+		Status:        DeliveryPending,
+		Attempts:      0,
+		ResponseCode:  0,
+		LastError:     "",
+		NextRetryTime: common.GetNowTime(),
+		CreateTime:    common.GetNowTime(),
+		UpdateTime:    common.GetNowTime(),
+	}
+}
+
+func (me *WebhookDelivery) DecodeFromGin(c *gin.Context) {
+	err := c.ShouldBindBodyWith(me, binding.JSON)
+	if err != nil {
+		exception.Throw(common.ParamError, err.Error())
+	}
+}
+func (me *WebhookDelivery) DecodeFromRows(rows *sql.Rows) error {
+	err := rows.Scan(&me.ID, &me.WebhookId, &me.EventId, &me.EventType, &me.Mac, &me.Payload, &me.Status,
+		&me.Attempts, &me.ResponseCode, &me.LastError, &me.NextRetryTime, &me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *WebhookDelivery) DecodeFromRow(row *sql.Row) error {
+	err := row.Scan(&me.ID, &me.WebhookId, &me.EventId, &me.EventType, &me.Mac, &me.Payload, &me.Status,
+		&me.Attempts, &me.ResponseCode, &me.LastError, &me.NextRetryTime, &me.CreateTime, &me.UpdateTime)
+	return err
+}
+func (me *WebhookDelivery) QueryByID(id int64) bool {
+	me.SetID(id)
+	return QueryDaoByID(common.WebhookDeliveryTbl, me.ID, me)
+}
+func (me *WebhookDelivery) Insert() bool {
+	tblName := common.WebhookDeliveryTbl
+	if !CheckTableExist(tblName) {
+		sql := `create table ` + tblName + ` (
+			id bigint NOT NULL AUTO_INCREMENT,
+			webhook_id bigint not null comment 'webhook id',
+			event_id varchar(64) not null comment '事件id',
+			event_type varchar(32) not null comment '事件类型',
+			mac varchar(32) default '' comment '设备mac',
+			payload text comment '推送内容',
+			status int not null default 0 comment '0:等待推送 1:成功 2:死信',
+			attempts int not null default 0 comment '已推送次数',
+			response_code int default 0 comment '最近一次http状态码',
+			last_error varchar(255) default '' comment '最近一次错误',
+			next_retry_time datetime comment '下次推送时间',
+			create_time datetime comment '创建时间',
+			update_time datetime comment '更新时间',
+			PRIMARY KEY (id),
+			INDEX idx_webhook_id (webhook_id, create_time),
+			INDEX idx_status (status, next_retry_time),
+			INDEX idx_create_time (create_time)
+		)`
+		CreateTable(sql)
+	}
+	// payload是json, 需要转义后才能拼接到sql中
+	obj := *me
+	obj.Payload = common.EscapeSql(me.Payload)
+	obj.LastError = common.EscapeSql(me.LastError)
+	if !InsertDao(tblName, &obj) {
+		return false
+	}
+	me.ID = obj.ID
+	return true
+}
+func (me *WebhookDelivery) Update() bool {
+	obj := *me
+	obj.Payload = common.EscapeSql(me.Payload)
+	obj.LastError = common.EscapeSql(me.LastError)
+	return UpdateDaoByID(common.WebhookDeliveryTbl, me.ID, &obj)
+}
+func (me *WebhookDelivery) Delete() bool {
+	return DeleteDaoByID(common.WebhookDeliveryTbl, me.ID)
+}
+func (me *WebhookDelivery) SetID(id int64) {
+	me.ID = id
+}
+
+func QueryWebhookDeliveryByCond(filter interface{}, page *common.PageDao, sort interface{}, results *[]WebhookDelivery) bool {
+	backFunc := func(rows *sql.Rows) {
+		obj := NewWebhookDelivery()
+		if err := obj.DecodeFromRows(rows); err != nil {
+			mylog.Log.Errorln(err)
+		} else {
+			*results = append(*results, *obj)
+		}
+	}
+	if page == nil {
+		return QueryDao(common.WebhookDeliveryTbl, filter, sort, -1, backFunc)
+	}
+	return QueryPage(common.WebhookDeliveryTbl, page, filter, sort, backFunc)
+}
+
+// WebhookEvent 推送给机构的内容
+type WebhookEvent struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Mac        string      `json:"mac"`
+	CreateTime string      `json:"create_time"`
+	Data       interface{} `json:"data"`
+}
+
+// WebhookAlarm 报警事件的数据, 不包含用户信息
+type WebhookAlarm struct {
+	Type            int    `json:"type"`
+	Status          int    `json:"status"`
+	HeartRate       int    `json:"heart_rate"`
+	RespiratoryRate int    `json:"respiratory_rate"`
+	CreateTime      string `json:"create_time"`
+}
+
+// WebhookSleepReport 睡眠报告生成事件的数据, 完整报告通过api key拉取
+type WebhookSleepReport struct {
+	SleepStartTime string `json:"sleep_start_time"`
+	SleepEndTime   string `json:"sleep_end_time"`
+	Evaluation     int    `json:"evaluation"`
+}
+
+// WebhookStudyReport 学习报告生成事件的数据, 完整报告通过api key拉取
+type WebhookStudyReport struct {
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+	Evaluation int    `json:"evaluation"`
+}
+
+/******************************************************************************
+ * function: SignWebhookPayload
+ * description: 计算推送内容的签名, 签名内容为"时间戳.body", 接收方用同样的方法校验,
+ * 并检查时间戳防止重放
+ * param {string} secret
+ * param {int64} timestamp
+ * param {[]byte} body
+ * return {*} 请求头X-Hjy-Signature的值, 格式为 t=<时间戳>,v1=<hex>
+********************************************************************************/
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// webhookBackoff 第n次推送失败后的重试间隔
+func webhookBackoff(attempts int) time.Duration {
+	base := time.Duration(cfg.This.Webhook.RetryInterval) * time.Second
+	if base <= 0 {
+		base = 30 * time.Second
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return delay
+}
+
+func webhookMaxAttempts() int {
+	if cfg.This.Webhook.MaxAttempts > 0 {
+		return cfg.This.Webhook.MaxAttempts
+	}
+	return 8
+}
+
+// webhookOrgAllowMac 机构有效的api key中有事件需要的授权范围并且允许访问设备
+func webhookOrgAllowMac(orgId int64, event string, mac string) bool {
+	var keys []ApiKey
+	QueryApiKeyByCond(fmt.Sprintf("org_id=%d and status=%d", orgId, ApiKeyActive), nil, &keys)
+	for _, key := range keys {
+		if key.HasScope(webhookEventScopes[event]) && key.AllowMac(mac) {
+			return true
+		}
+	}
+	return false
+}
+
+/******************************************************************************
+ * function: EmitWebhookEvent
+ * description: 产生设备事件, 推送给订阅了事件并且有设备权限的机构, 在任务队列中执行
+ * param {string} event
+ * param {string} mac
+ * param {interface{}} data
+ * return {*}
+********************************************************************************/
+func EmitWebhookEvent(event string, mac string, data interface{}) {
+	if cfg.This == nil || !cfg.This.Webhook.Enable || !IsValidWebhookEvent(event) {
+		return
+	}
+	webhookEvent := &WebhookEvent{
+		ID:         common.GenerateUUID(),
+		Type:       event,
+		Mac:        mac,
+		CreateTime: common.GetNowTime(),
+		Data:       data,
+	}
+	GetTaskPool().Put(&gopool.Task{
+		Params: []interface{}{webhookEvent},
+		Do: func(params ...interface{}) {
+			dispatchWebhookEvent(params[0].(*WebhookEvent))
+		},
+	})
+}
+
+func dispatchWebhookEvent(event *WebhookEvent) {
+	var hooks []Webhook
+	QueryWebhookByCond(fmt.Sprintf("status=%d and find_in_set('%s', events)", WebhookEnabled, event.Type), nil, &hooks)
+	if len(hooks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return
+	}
+	for i := range hooks {
+		hook := &hooks[i]
+		if !webhookOrgAllowMac(hook.OrgId, event.Type, event.Mac) {
+			continue
+		}
+		delivery := NewWebhookDelivery()
+		delivery.WebhookId = hook.ID
+		delivery.EventId = event.ID
+		delivery.EventType = event.Type
+		delivery.Mac = event.Mac
+		delivery.Payload = string(payload)
+		delivery.CreateTime = event.CreateTime
+		delivery.UpdateTime = event.CreateTime
+		// 首次推送前占用, 重试任务不会同时推送
+		delivery.NextRetryTime = time.Now().Add(webhookLease).Format(cfg.TmFmtStr)
+		if !delivery.Insert() {
+			continue
+		}
+		deliverWebhook(hook, delivery)
+	}
+}
+
+/******************************************************************************
+ * function: deliverWebhook
+ * description: 推送一次并记录结果, 2xx为成功, 失败后计算下次重试时间或者进入死信列表
+ * param {*Webhook} hook
+ * param {*WebhookDelivery} delivery
+ * return {*}
+********************************************************************************/
+func deliverWebhook(hook *Webhook, delivery *WebhookDelivery) bool {
+	body := []byte(delivery.Payload)
+	code, err := postWebhook(hook, delivery, body)
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.UpdateTime = common.GetNowTime()
+	if err == nil {
+		delivery.Status = DeliverySuccess
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		if len(delivery.LastError) > 255 {
+			delivery.LastError = delivery.LastError[:255]
+		}
+		if delivery.Attempts >= webhookMaxAttempts() {
+			delivery.Status = DeliveryDead
+			mylog.Log.Warnf("webhook %d delivery %d dead after %d attempts: %v", hook.ID, delivery.ID, delivery.Attempts, err)
+		} else {
+			delivery.Status = DeliveryPending
+			delivery.NextRetryTime = time.Now().Add(webhookBackoff(delivery.Attempts)).Format(cfg.TmFmtStr)
+		}
+	}
+	delivery.Update()
+	return err == nil
+}
+
+func postWebhook(hook *Webhook, delivery *WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.EventId)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(hook.Secret, time.Now().Unix(), body))
+	timeout := cfg.This.Webhook.Timeout
+	if timeout <= 0 {
+		timeout = 10
+	}
+	client := webhookClient(time.Duration(timeout) * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("http status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// claimWebhookDelivery 把到期的记录占用一段时间, 多个服务实例时只有一个能推送
+func claimWebhookDelivery(id int64) bool {
+	now := time.Now()
+	sql := fmt.Sprintf("update %s set next_retry_time=? where id=? and status=? and next_retry_time<=?", common.WebhookDeliveryTbl)
+	result, err := mDb.Exec(sql, now.Add(webhookLease).Format(cfg.TmFmtStr), id, DeliveryPending, now.Format(cfg.TmFmtStr))
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return false
+	}
+	n, err := result.RowsAffected()
+	return err == nil && n == 1
+}
+
+/******************************************************************************
+ * function: RetryWebhookDeliveries
+ * description: 重新推送到期的记录, webhook已停用或删除的直接进入死信列表
+ * return {*}
+********************************************************************************/
+func RetryWebhookDeliveries() {
+	var deliveries []WebhookDelivery
+	QueryDao(common.WebhookDeliveryTbl, fmt.Sprintf("status=%d and next_retry_time<='%s'", DeliveryPending, common.GetNowTime()),
+		"next_retry_time", 100, func(rows *sql.Rows) {
+			obj := NewWebhookDelivery()
+			if err := obj.DecodeFromRows(rows); err != nil {
+				mylog.Log.Errorln(err)
+			} else {
+				deliveries = append(deliveries, *obj)
+			}
+		})
+	hooks := make(map[int64]*Webhook)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		if !claimWebhookDelivery(delivery.ID) {
+			continue
+		}
+		hook, ok := hooks[delivery.WebhookId]
+		if !ok {
+			hook = NewWebhook()
+			if !hook.QueryByID(delivery.WebhookId) {
+				hook = nil
+			}
+			hooks[delivery.WebhookId] = hook
+		}
+		if hook == nil || hook.Status != WebhookEnabled {
+			delivery.Status = DeliveryDead
+			delivery.LastError = "webhook disabled"
+			delivery.UpdateTime = common.GetNowTime()
+			delivery.Update()
+			continue
+		}
+		deliverWebhook(hook, delivery)
+	}
+}
+
+/******************************************************************************
+ * function: RedeliverWebhook
+ * description: 手动重新推送, 重置推送次数后立即推送一次, 失败后继续按退避重试
+ * param {int64} id delivery id
+ * return {*}
+********************************************************************************/
+func RedeliverWebhook(id int64) (*WebhookDelivery, bool) {
+	delivery := NewWebhookDelivery()
+	if !delivery.QueryByID(id) {
+		return nil, false
+	}
+	hook := NewWebhook()
+	if !hook.QueryByID(delivery.WebhookId) || hook.Status != WebhookEnabled {
+		return nil, false
+	}
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextRetryTime = time.Now().Add(webhookLease).Format(cfg.TmFmtStr)
+	delivery.UpdateTime = common.GetNowTime()
+	if !delivery.Update() {
+		return nil, false
+	}
+	deliverWebhook(hook, delivery)
+	return delivery, true
+}
+
+// 已经检查过的最大跌倒报警记录id
+const webhookFallAlarmIdKey = "webhook_fall_alarm_id"
+
+// 检查跌倒报警的租约, 多个服务实例时同一时间只有一个检查
+const (
+	fallAlarmLeaseKey     = "webhook_fall_alarm_lease"
+	fallAlarmLeaseSeconds = 5 * 60
+)
+
+// claimFallAlarmCheck 取得检查跌倒报警的租约, 返回租约的值, 释放时核对
+func claimFallAlarmCheck() (string, bool) {
+	owner, err := randomHex(8)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return "", false
+	}
+	ok, err := redis.SetValueNx(fallAlarmLeaseKey, owner, fallAlarmLeaseSeconds)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return "", false
+	}
+	return owner, ok
+}
+
+// releaseFallAlarmCheck 释放自己持有的租约, 租约已过期被其他实例取得时不释放
+func releaseFallAlarmCheck(owner string) {
+	if v, _ := redis.GetValue(fallAlarmLeaseKey); v == owner {
+		redis.DelValue(fallAlarmLeaseKey)
+	}
+}
+
+/******************************************************************************
+ * function: checkFallAlarmEvents
+ * description: 跌倒报警由跌倒检测服务写入数据库, 定时检查新记录产生跌倒报警和事件,
+ * 取得租约的服务实例才检查, 避免多个实例重复产生报警和推送
+ * return {*}
+********************************************************************************/
+func checkFallAlarmEvents() {
+	owner, ok := claimFallAlarmCheck()
+	if !ok {
+		return
+	}
+	defer releaseFallAlarmCheck(owner)
+	v, _ := redis.GetValue(webhookFallAlarmIdKey)
+	lastId, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		// 第一次运行时从最新的记录开始, 不推送历史报警
+		var maxId sql.NullInt64
+		row := mDb.QueryRow("select max(id) from " + common.FallAlarmTbl)
+		if row.Scan(&maxId) == nil {
+			redis.SetValueEx(webhookFallAlarmIdKey, strconv.FormatInt(maxId.Int64, 10), 30*24*3600)
+		}
+		return
+	}
+	var alarms []FallAlarm
+	QueryFallAlarmByCond(fmt.Sprintf("id>%d", lastId), nil, "id", &alarms)
+	for _, alarm := range alarms {
+		raiseAlarm(alarm.Mac, FallCheckType, AlarmSourceFall, alarm.AlarmEvent, alarm.DateTime)
+		EmitWebhookEvent(WebhookFallDetected, alarm.Mac, &WebhookAlarm{
+			Type:       alarm.AlarmEvent,
+			Status:     1,
+			CreateTime: alarm.DateTime,
+		})
+		lastId = alarm.ID
+	}
+	if len(alarms) > 0 {
+		redis.SetValueEx(webhookFallAlarmIdKey, strconv.FormatInt(lastId, 10), 30*24*3600)
+	}
+}
@@ -0,0 +1,68 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"hjyserver/cfg"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	got := SignWebhookPayload("whsec_test", 1700000000, []byte(`{"id":"1"}`))
+	want := "t=1700000000,v1=11bf4466ea17c3df3fd743af0b435368e16b7a05eb8eced85e8c4670767bdec5"
+	if got != want {
+		t.Errorf("SignWebhookPayload = %s, want %s", got, want)
+	}
+	if got == SignWebhookPayload("whsec_other", 1700000000, []byte(`{"id":"1"}`)) {
+		t.Error("SignWebhookPayload ignores secret")
+	}
+	if got == SignWebhookPayload("whsec_test", 1700000001, []byte(`{"id":"1"}`)) {
+		t.Error("SignWebhookPayload ignores timestamp")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	if cfg.This == nil {
+		cfg.This = new(cfg.Cfg)
+	}
+	cfg.This.Webhook.RetryInterval = 30
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, 60 * time.Second},
+		{4, 240 * time.Second},
+		{20, webhookMaxBackoff},
+	}
+	for _, v := range cases {
+		if got := webhookBackoff(v.attempts); got != v.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", v.attempts, got, v.want)
+		}
+	}
+}
+
+func TestIsValidWebhookUrl(t *testing.T) {
+	cases := map[string]bool{
+		"https://93.184.215.14/hook":   true,
+		"http://example.com/hook":      false,
+		"https://":                     false,
+		"ftp://example.com":            false,
+		"https://127.0.0.1/hook":       false,
+		"https://10.1.2.3:8443/hook":   false,
+		"https://169.254.169.254/hook": false,
+		"https://[::1]/hook":           false,
+		"https://100.64.0.1/hook":      false,
+	}
+	for u, want := range cases {
+		if got := IsValidWebhookUrl(u); got != want {
+			t.Errorf("IsValidWebhookUrl(%s) = %v, want %v", u, got, want)
+		}
+	}
+	if webhookDialControl("tcp", "192.168.1.10:443", nil) != errWebhookAddress {
+		t.Error("dial to private address should be rejected")
+	}
+	if webhookDialControl("tcp", "93.184.215.14:443", nil) != nil {
+		t.Error("dial to public address should be allowed")
+	}
+}
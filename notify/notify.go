@@ -0,0 +1,419 @@
+package notify
+
+import (
+	"errors"
+	"sync"
+
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+)
+
+// define notify event type
+const (
+	// 睡眠设备上报的告警事件, code为告警类型
+	EventSleepAlarm = "sleep.alarm"
+	// 用户设置的有人、呼吸、心率提醒, code为提醒类型, status为提醒状态
+	EventVitalNotify = "vital.notify"
+	// 学习设备每次的学习报告
+	EventStudyReport = "study.report"
+	// 学习设备的日报告
+	EventStudyDayReport = "study.day_report"
+	// 学习设备的周报告, 每周一发送上一周的报告, data为周报告
+	EventStudyWeekReport = "study.week_report"
+	// 学习设备的告警事件, code为事件编号
+	EventStudyWarning = "study.warning"
+	// 睡眠设备的日报告, score为睡眠评分
+	EventSleepReport = "sleep.report"
+	// 报警未确认时的升级通知, code为报警类型, status为第几级, title为报警来源
+	EventAlarmEscalation = "alarm.escalation"
+	// 用户定义的指标规则触发, code为规则id, title为规则名称, value为指标的当前值
+	EventRuleAlert = "rule.alert"
+	// 免打扰或去重拦截的通知合并成的摘要, value为条数
+	EventDigest = "notify.digest"
+	// 账号连续登录失败被锁定, 发送给用户本人, title为账号, value为锁定的分钟数
+	EventAccountLocked = "account_locked"
+)
+
+// define channel name
+const (
+	// 公众号模板消息
+	ChannelWxOfficial = "wx_official"
+	// 小程序订阅消息
+	ChannelWxMini = "wx_mini"
+	// 短信, 发送到用户的主联系人, 没有联系人时发送到紧急联系电话
+	ChannelSms = "sms"
+	// 用户的所有紧急联系人, 按每个联系人的通道、关注的报警和接收时段发送
+	ChannelContacts = "contacts"
+	// mqtt, 发布到用户的通知主题
+	ChannelMqtt = "mqtt"
+	// 邮件
+	ChannelEmail = "email"
+	// 合作机构的webhook
+	ChannelWebhook = "webhook"
+)
+
+// define attempt status
+const (
+	AttemptSuccess = 1
+	AttemptFailed  = 2
+	// 通道没有注册、不支持该事件、没有模板或者用户没有绑定该通道
+	AttemptSkipped = 3
+	// 被免打扰时段、去重或每日上限拦截
+	AttemptSuppressed = 4
+)
+
+// define message status
+const (
+	// 至少一个通道发送成功
+	MessageDelivered = 1
+	// 所有通道都失败或跳过
+	MessageFailed = 2
+	// 被免打扰、去重或每日上限拦截
+	MessageSuppressed = 3
+)
+
+// define policy decision
+const (
+	// 立即发送
+	DecisionSend = iota
+	// 不发送
+	DecisionDrop
+	// 不立即发送, 放入摘要
+	DecisionDefer
+)
+
+// 通道不支持该事件, 按跳过处理, 继续尝试下一个通道
+var ErrUnsupported = errors.New("event not supported by channel")
+
+// 用户没有绑定该通道, 如没有关注公众号、没有设置紧急联系人
+var ErrNoRecipient = errors.New("no recipient for user")
+
+var errNotRegistered = errors.New("channel not registered")
+
+// 通道当天发送次数已经到上限
+var ErrDailyCap = errors.New("daily cap reached")
+
+// Event 通知事件, 由事件来源填写, 各个通道取需要的字段
+type Event struct {
+	// 为空时自动生成, 同一事件通知多个用户时相同
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// 对应的报警id, 用于确认报警
+	AlarmId    int64  `json:"alarm_id,omitempty"`
+	Mac        string `json:"mac"`
+	DeviceType string `json:"device_type"`
+	// 用户昵称
+	NickName string `json:"nick_name"`
+	// 设备名称
+	DeviceName string `json:"device_name,omitempty"`
+	// 报告标题, 如次报告、日报告
+	Title string `json:"title,omitempty"`
+	// 告警类型、提醒类型或事件编号
+	Code   int `json:"code,omitempty"`
+	Status int `json:"status,omitempty"`
+	// 事件的数值, 如提醒时的心率、呼吸
+	Value int `json:"value,omitempty"`
+	// 报告评分
+	Score     int    `json:"score,omitempty"`
+	StartTime string `json:"start_time,omitempty"`
+	EndTime   string `json:"end_time,omitempty"`
+	// 事件发生时间
+	CreateTime string `json:"create_time"`
+	// 事件的原始数据, mqtt和webhook直接推送
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Channel 通知通道
+type Channel interface {
+	Name() string
+	// Send 发送给用户, 不支持的事件返回ErrUnsupported, 用户没有绑定时返回ErrNoRecipient
+	Send(userId int64, event *Event) error
+}
+
+// Policy 发送策略, 由上层根据用户设置实现
+type Policy interface {
+	// Admit 按路由通知前检查事件, 返回DecisionSend/DecisionDrop/DecisionDefer和原因
+	Admit(userId int64, event *Event) (int, string)
+	// Allow 检查通道当天的发送次数是否已经到上限
+	Allow(userId int64, event *Event, channel string) bool
+	// Sent 通道发送成功后计数
+	Sent(userId int64, event *Event, channel string)
+	// Defer 保存被拦截的事件, 之后合并成摘要发送
+	Defer(userId int64, event *Event, reason string)
+}
+
+// Attempt 一次发送的结果
+type Attempt struct {
+	UserId    int64
+	EventId   string
+	EventType string
+	Mac       string
+	Channel   string
+	// 第几条通道链, 从0开始
+	Chain  int
+	Status int
+	Error  string
+}
+
+// Message 一个用户的一个事件的通知结果, 保存到收件箱
+type Message struct {
+	UserId int64
+	Event  *Event
+	Status int
+	// 发送成功的通道
+	Channels []string
+}
+
+// Route 事件类型的路由, 每条链是按顺序尝试的通道名
+type Route struct {
+	Event  string
+	Chains [][]string
+}
+
+// 缺省路由, 配置文件中同一事件的路由覆盖缺省路由
+var defaultRoutes = map[string][][]string{
+	EventSleepAlarm:      {{ChannelMqtt}, {ChannelContacts, ChannelSms}},
+	EventVitalNotify:     {{ChannelMqtt}, {ChannelContacts, ChannelSms}},
+	EventStudyReport:     {{ChannelWxOfficial, ChannelWxMini}},
+	EventStudyDayReport:  {{ChannelWxOfficial, ChannelWxMini}},
+	EventStudyWeekReport: {{ChannelEmail}},
+	EventStudyWarning:    {{ChannelWxOfficial}},
+	EventSleepReport:     {{ChannelMqtt}, {ChannelEmail}},
+	EventRuleAlert:       {{ChannelMqtt}, {ChannelWxOfficial, ChannelContacts, ChannelSms}},
+	EventDigest:          {{ChannelMqtt}, {ChannelWxOfficial, ChannelEmail}},
+	EventAccountLocked:   {{ChannelSms}, {ChannelWxOfficial}},
+}
+
+type dispatcher struct {
+	mu       sync.RWMutex
+	channels map[string]Channel
+	routes   map[string][][]string
+	recorder func(a *Attempt)
+	policy   Policy
+	inbox    func(m *Message)
+}
+
+var notifier = newDispatcher()
+
+func newDispatcher() *dispatcher {
+	d := &dispatcher{
+		channels: make(map[string]Channel),
+		routes:   make(map[string][][]string),
+	}
+	for k, v := range defaultRoutes {
+		d.routes[k] = v
+	}
+	return d
+}
+
+// Register 注册通道, 同名通道覆盖
+func Register(ch Channel) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.channels[ch.Name()] = ch
+}
+
+// SetRoutes 设置事件路由, 没有设置的事件使用缺省路由
+func SetRoutes(routes []Route) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	for _, r := range routes {
+		if r.Event == "" {
+			continue
+		}
+		notifier.routes[r.Event] = r.Chains
+	}
+}
+
+// SetRecorder 设置发送结果的记录函数
+func SetRecorder(f func(a *Attempt)) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.recorder = f
+}
+
+// SetPolicy 设置发送策略, 没有设置时全部发送
+func SetPolicy(p Policy) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.policy = p
+}
+
+// SetInbox 设置收件箱函数, 摘要不保存到收件箱, 其中的通知被拦截时已经保存
+func SetInbox(f func(m *Message)) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.inbox = f
+}
+
+/******************************************************************************
+ * function: Notify
+ * description: 按事件类型的路由通知用户, 先由发送策略检查免打扰和去重,
+ * 同步发送, 需要异步时由调用者放到队列中
+ * param {int64} userId
+ * param {*Event} event
+ * return {bool} 至少一条通道链发送成功
+********************************************************************************/
+func Notify(userId int64, event *Event) bool {
+	return notifier.notify(userId, event)
+}
+
+/******************************************************************************
+ * function: NotifyVia
+ * description: 不使用事件路由, 按指定的通道链通知用户, 如报警升级时每一级配置的通道.
+ * 不检查免打扰和去重, 只检查每个通道的每日上限
+ * param {int64} userId
+ * param {*Event} event
+ * param {[][]string} chains
+ * return {bool} 至少一条通道链发送成功
+********************************************************************************/
+func NotifyVia(userId int64, event *Event, chains [][]string) bool {
+	return notifier.run(userId, event, chains)
+}
+
+func (d *dispatcher) notify(userId int64, event *Event) bool {
+	d.mu.RLock()
+	chains, ok := d.routes[event.Type]
+	d.mu.RUnlock()
+	if !ok || len(chains) == 0 {
+		mylog.Log.Errorln("no notify route for event:", event.Type)
+		return false
+	}
+	if policy := d.getPolicy(); policy != nil {
+		decision, reason := policy.Admit(userId, event)
+		if decision != DecisionSend {
+			d.suppress(userId, event, "", 0, reason)
+			if decision == DecisionDefer {
+				policy.Defer(userId, event, reason)
+			}
+			d.save(&Message{UserId: userId, Event: event, Status: MessageSuppressed})
+			return false
+		}
+	}
+	return d.run(userId, event, chains)
+}
+
+func (d *dispatcher) run(userId int64, event *Event, chains [][]string) bool {
+	if event.ID == "" {
+		event.ID = common.GenerateUUID()
+	}
+	if event.CreateTime == "" {
+		event.CreateTime = common.GetNowTime()
+	}
+	policy := d.getPolicy()
+	delivered := false
+	capped := false
+	var sent []string
+	for i, chain := range chains {
+		for _, name := range chain {
+			if policy != nil && !policy.Allow(userId, event, name) {
+				// 到上限的通道跳过, 继续尝试链中的下一个通道
+				capped = true
+				d.suppress(userId, event, name, i, ErrDailyCap.Error())
+				continue
+			}
+			err := d.send(name, userId, event)
+			status := AttemptSuccess
+			if err != nil {
+				status = AttemptFailed
+				if err == ErrUnsupported || err == ErrNoRecipient || err == ErrNoTemplate || err == errNotRegistered {
+					status = AttemptSkipped
+				}
+			}
+			d.record(&Attempt{
+				UserId:    userId,
+				EventId:   event.ID,
+				EventType: event.Type,
+				Mac:       event.Mac,
+				Channel:   name,
+				Chain:     i,
+				Status:    status,
+				Error:     errString(err),
+			})
+			if err == nil {
+				if policy != nil {
+					policy.Sent(userId, event, name)
+				}
+				delivered = true
+				sent = append(sent, name)
+				break
+			}
+			if status == AttemptFailed {
+				mylog.Log.Errorf("notify %s to user %d by %s failed: %v", event.Type, userId, name, err)
+			}
+		}
+	}
+	message := &Message{UserId: userId, Event: event, Status: MessageDelivered, Channels: sent}
+	if !delivered {
+		message.Status = MessageFailed
+		if capped {
+			message.Status = MessageSuppressed
+			if event.Type != EventDigest {
+				policy.Defer(userId, event, ErrDailyCap.Error())
+			}
+		}
+	}
+	d.save(message)
+	return delivered
+}
+
+func (d *dispatcher) save(m *Message) {
+	d.mu.RLock()
+	inbox := d.inbox
+	d.mu.RUnlock()
+	if inbox != nil && m.Event.Type != EventDigest {
+		inbox(m)
+	}
+}
+
+func (d *dispatcher) getPolicy() Policy {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.policy
+}
+
+// suppress 记录被发送策略拦截的事件, 按路由拦截时通道为空
+func (d *dispatcher) suppress(userId int64, event *Event, channel string, chain int, reason string) {
+	if event.ID == "" {
+		event.ID = common.GenerateUUID()
+	}
+	if event.CreateTime == "" {
+		event.CreateTime = common.GetNowTime()
+	}
+	d.record(&Attempt{
+		UserId:    userId,
+		EventId:   event.ID,
+		EventType: event.Type,
+		Mac:       event.Mac,
+		Channel:   channel,
+		Chain:     chain,
+		Status:    AttemptSuppressed,
+		Error:     reason,
+	})
+}
+
+func (d *dispatcher) send(name string, userId int64, event *Event) error {
+	d.mu.RLock()
+	ch, ok := d.channels[name]
+	d.mu.RUnlock()
+	if !ok {
+		return errNotRegistered
+	}
+	return ch.Send(userId, event)
+}
+
+func (d *dispatcher) record(a *Attempt) {
+	d.mu.RLock()
+	recorder := d.recorder
+	d.mu.RUnlock()
+	if recorder != nil {
+		recorder(a)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+)
+
+type fakeChannel struct {
+	name  string
+	err   error
+	count int
+}
+
+func (me *fakeChannel) Name() string {
+	return me.name
+}
+func (me *fakeChannel) Send(userId int64, event *Event) error {
+	me.count++
+	return me.err
+}
+
+func TestNotifyFallbackChains(t *testing.T) {
+	d := newDispatcher()
+	official := &fakeChannel{name: ChannelWxOfficial, err: ErrNoRecipient}
+	mini := &fakeChannel{name: ChannelWxMini}
+	sms := &fakeChannel{name: ChannelSms, err: errors.New("send failed")}
+	for _, ch := range []*fakeChannel{official, mini, sms} {
+		d.channels[ch.name] = ch
+	}
+	d.routes["test"] = [][]string{{ChannelWxOfficial, ChannelWxMini, ChannelSms}, {ChannelSms}, {ChannelEmail}}
+	var attempts []*Attempt
+	d.recorder = func(a *Attempt) { attempts = append(attempts, a) }
+
+	event := &Event{Type: "test", Mac: "aa"}
+	if !d.notify(1, event) {
+		t.Fatal("notify should be delivered")
+	}
+	if event.ID == "" {
+		t.Error("event id not generated")
+	}
+	// 第一条链在小程序成功后停止, 第二条链仍然执行
+	if official.count != 1 || mini.count != 1 || sms.count != 1 {
+		t.Errorf("send count official=%d mini=%d sms=%d", official.count, mini.count, sms.count)
+	}
+	want := []struct {
+		channel string
+		chain   int
+		status  int
+	}{
+		{ChannelWxOfficial, 0, AttemptSkipped},
+		{ChannelWxMini, 0, AttemptSuccess},
+		{ChannelSms, 1, AttemptFailed},
+		{ChannelEmail, 2, AttemptSkipped},
+	}
+	if len(attempts) != len(want) {
+		t.Fatalf("attempts = %d, want %d", len(attempts), len(want))
+	}
+	for i, w := range want {
+		a := attempts[i]
+		if a.Channel != w.channel || a.Chain != w.chain || a.Status != w.status || a.EventId != event.ID || a.UserId != 1 {
+			t.Errorf("attempt %d = %+v, want %+v", i, a, w)
+		}
+	}
+}
+
+func TestNotifyRoutes(t *testing.T) {
+	d := newDispatcher()
+	if d.notify(1, &Event{Type: "unknown"}) {
+		t.Error("event without route should not be delivered")
+	}
+	mqtt := &fakeChannel{name: ChannelMqtt}
+	d.channels[ChannelMqtt] = mqtt
+	if !d.notify(1, &Event{Type: EventSleepAlarm}) || mqtt.count != 1 {
+		t.Error("default route of sleep alarm should use mqtt")
+	}
+}
+
+func TestNotifyVia(t *testing.T) {
+	d := newDispatcher()
+	sms := &fakeChannel{name: ChannelSms}
+	webhook := &fakeChannel{name: ChannelWebhook}
+	d.channels[ChannelSms] = sms
+	d.channels[ChannelWebhook] = webhook
+	// 不使用路由, 只发送指定的通道
+	if !d.run(1, &Event{Type: EventAlarmEscalation}, [][]string{{ChannelSms}}) {
+		t.Fatal("notify via sms should be delivered")
+	}
+	if sms.count != 1 || webhook.count != 0 {
+		t.Errorf("send count sms=%d webhook=%d", sms.count, webhook.count)
+	}
+}
+
+type fakePolicy struct {
+	decision int
+	capped   map[string]bool
+	sent     []string
+	deferred []string
+}
+
+func (me *fakePolicy) Admit(userId int64, event *Event) (int, string) {
+	return me.decision, "quiet hours"
+}
+func (me *fakePolicy) Allow(userId int64, event *Event, channel string) bool {
+	return !me.capped[channel]
+}
+func (me *fakePolicy) Sent(userId int64, event *Event, channel string) {
+	me.sent = append(me.sent, channel)
+}
+func (me *fakePolicy) Defer(userId int64, event *Event, reason string) {
+	me.deferred = append(me.deferred, reason)
+}
+
+func TestNotifyPolicy(t *testing.T) {
+	d := newDispatcher()
+	official := &fakeChannel{name: ChannelWxOfficial}
+	sms := &fakeChannel{name: ChannelSms}
+	d.channels[ChannelWxOfficial] = official
+	d.channels[ChannelSms] = sms
+	d.routes["test"] = [][]string{{ChannelWxOfficial, ChannelSms}}
+	var attempts []*Attempt
+	d.recorder = func(a *Attempt) { attempts = append(attempts, a) }
+
+	// 免打扰时段放入摘要, 不发送
+	policy := &fakePolicy{decision: DecisionDefer}
+	d.policy = policy
+	if d.notify(1, &Event{Type: "test"}) || official.count != 0 {
+		t.Fatal("deferred event should not be sent")
+	}
+	if len(policy.deferred) != 1 || len(attempts) != 1 || attempts[0].Status != AttemptSuppressed {
+		t.Fatalf("deferred %v, attempts %d", policy.deferred, len(attempts))
+	}
+
+	// 公众号到上限时使用下一个通道
+	policy = &fakePolicy{decision: DecisionSend, capped: map[string]bool{ChannelWxOfficial: true}}
+	d.policy = policy
+	attempts = nil
+	if !d.notify(1, &Event{Type: "test"}) {
+		t.Fatal("event should be sent by sms")
+	}
+	if official.count != 0 || sms.count != 1 || len(policy.sent) != 1 || policy.sent[0] != ChannelSms {
+		t.Errorf("official=%d sms=%d sent=%v", official.count, sms.count, policy.sent)
+	}
+	if len(attempts) != 2 || attempts[0].Status != AttemptSuppressed || attempts[1].Status != AttemptSuccess {
+		t.Errorf("attempts %d", len(attempts))
+	}
+
+	// 所有通道都到上限时放入摘要
+	policy = &fakePolicy{decision: DecisionSend, capped: map[string]bool{ChannelWxOfficial: true, ChannelSms: true}}
+	d.policy = policy
+	if d.notify(1, &Event{Type: "test"}) || len(policy.deferred) != 1 || policy.deferred[0] != ErrDailyCap.Error() {
+		t.Errorf("capped event should be deferred, %v", policy.deferred)
+	}
+}
+
+func TestNotifyInbox(t *testing.T) {
+	d := newDispatcher()
+	official := &fakeChannel{name: ChannelWxOfficial, err: errors.New("send failed")}
+	mqtt := &fakeChannel{name: ChannelMqtt}
+	d.channels[ChannelWxOfficial] = official
+	d.channels[ChannelMqtt] = mqtt
+	d.routes["test"] = [][]string{{ChannelMqtt}, {ChannelWxOfficial}}
+	d.routes[EventDigest] = [][]string{{ChannelMqtt}}
+	var messages []*Message
+	d.inbox = func(m *Message) { messages = append(messages, m) }
+
+	d.notify(1, &Event{Type: "test"})
+	if len(messages) != 1 || messages[0].Status != MessageDelivered || len(messages[0].Channels) != 1 ||
+		messages[0].Channels[0] != ChannelMqtt {
+		t.Fatalf("delivered message %+v", messages)
+	}
+
+	// 被拦截的通知也保存到收件箱
+	d.policy = &fakePolicy{decision: DecisionDrop}
+	d.notify(1, &Event{Type: "test"})
+	if len(messages) != 2 || messages[1].Status != MessageSuppressed {
+		t.Fatalf("suppressed message %+v", messages)
+	}
+
+	// 摘要不保存
+	d.policy = nil
+	d.notify(1, &Event{Type: EventDigest})
+	if len(messages) != 2 {
+		t.Errorf("digest should not be saved, %d", len(messages))
+	}
+}
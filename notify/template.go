@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	mylog "hjyserver/log"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 没有找到事件对应的模板
+var ErrNoTemplate = errors.New("no template for event")
+
+// Catalogue 按语言和key保存的模板, 查找时语言依次尝试用户语言、语言前缀、缺省语言,
+// 通知和邮件的模板共用, T为text/template或html/template的模板
+type Catalogue[T any] struct {
+	mu            sync.RWMutex
+	templates     map[string]map[string]T
+	defaultLocale string
+}
+
+// NewCatalogue 创建空的模板目录, 缺省语言为zh-CN
+func NewCatalogue[T any]() *Catalogue[T] {
+	return &Catalogue[T]{
+		templates:     make(map[string]map[string]T),
+		defaultLocale: "zh-CN",
+	}
+}
+
+// SetDefaultLocale 设置用户没有设置语言或者没有该语言模板时使用的语言
+func (me *Catalogue[T]) SetDefaultLocale(locale string) {
+	if locale == "" {
+		return
+	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.defaultLocale = locale
+}
+
+// Replace 替换全部模板, 语言: 模板key: 模板
+func (me *Catalogue[T]) Replace(templates map[string]map[string]T) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.templates = templates
+}
+
+// candidateLocales 依次尝试的语言
+func (me *Catalogue[T]) candidateLocales(locale string) []string {
+	var locales []string
+	if locale != "" {
+		locales = append(locales, locale)
+		if i := strings.IndexAny(locale, "-_"); i > 0 {
+			locales = append(locales, locale[:i])
+		}
+	}
+	return append(locales, me.defaultLocale)
+}
+
+/******************************************************************************
+ * function: Find
+ * description: 按语言的顺序查找第一个存在的模板, 同一语言中key越靠前越优先
+ * param {string} locale
+ * param {[]string} keys 模板key, 越具体的越靠前
+ * return {*}
+********************************************************************************/
+func (me *Catalogue[T]) Find(locale string, keys []string) (T, bool) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	for _, l := range me.candidateLocales(locale) {
+		tpls, ok := me.templates[l]
+		if !ok {
+			continue
+		}
+		for _, key := range keys {
+			if tpl, ok := tpls[key]; ok {
+				return tpl, true
+			}
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+var templates = NewCatalogue[*template.Template]()
+
+// SetDefaultLocale 设置用户没有设置语言或者没有该语言模板时使用的语言
+func SetDefaultLocale(locale string) {
+	templates.SetDefaultLocale(locale)
+}
+
+// ParseTemplate 检查模板语法
+func ParseTemplate(key string, text string) (*template.Template, error) {
+	return template.New(key).Option("missingkey=zero").Parse(text)
+}
+
+/******************************************************************************
+ * function: SetTemplates
+ * description: 替换全部模板, 语法错误的模板记录日志后忽略, 不影响其他模板
+ * param {map[string]map[string]string} texts 语言: 模板key: 模板内容
+ * return {*}
+********************************************************************************/
+func SetTemplates(texts map[string]map[string]string) {
+	parsed := make(map[string]map[string]*template.Template, len(texts))
+	for locale, items := range texts {
+		tpls := make(map[string]*template.Template, len(items))
+		for key, text := range items {
+			tpl, err := ParseTemplate(key, text)
+			if err != nil {
+				mylog.Log.Errorf("parse notify template %s/%s error: %v", locale, key, err)
+				continue
+			}
+			tpls[key] = tpl
+		}
+		parsed[locale] = tpls
+	}
+	templates.Replace(parsed)
+}
+
+/******************************************************************************
+ * function: LoadTemplateDir
+ * description: 读取目录下的模板文件, 每个语言一个yml文件, 文件名为语言, 如zh-CN.yml,
+ * 内容为 模板key: 模板内容
+ * param {string} dir
+ * return {*}
+********************************************************************************/
+func LoadTemplateDir(dir string) (map[string]map[string]string, error) {
+	texts := make(map[string]map[string]string)
+	files, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		return texts, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return texts, err
+		}
+		items := make(map[string]string)
+		if err := yaml.Unmarshal(data, &items); err != nil {
+			return texts, fmt.Errorf("%s: %v", file, err)
+		}
+		locale := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		texts[locale] = items
+	}
+	return texts, nil
+}
+
+// templateKeys 事件的模板key, 从具体到一般
+func templateKeys(event *Event) []string {
+	if event.Code == 0 {
+		return []string{event.Type}
+	}
+	return []string{
+		fmt.Sprintf("%s.%d.%d", event.Type, event.Code, event.Status),
+		fmt.Sprintf("%s.%d", event.Type, event.Code),
+		event.Type,
+	}
+}
+
+/******************************************************************************
+ * function: Render
+ * description: 按用户语言生成事件的通知内容, 模板中可以使用事件的字段,
+ * 如{{.NickName}} {{.DeviceName}} {{.Value}} {{.CreateTime}}
+ * param {string} locale 用户语言, 为空时使用缺省语言
+ * param {*Event} event
+ * return {*}
+********************************************************************************/
+func Render(locale string, event *Event) (string, error) {
+	_, text, err := RenderTemplate(locale, event)
+	return text, err
+}
+
+// RenderTemplate 与Render相同, 同时返回使用的模板key
+func RenderTemplate(locale string, event *Event) (string, string, error) {
+	tpl, ok := templates.Find(locale, templateKeys(event))
+	if !ok {
+		return "", "", ErrNoTemplate
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, event); err != nil {
+		return tpl.Name(), "", err
+	}
+	return tpl.Name(), strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"testing"
+)
+
+func TestRenderFallback(t *testing.T) {
+	SetDefaultLocale("zh-CN")
+	SetTemplates(map[string]map[string]string{
+		"zh-CN": {
+			"vital.notify.4":   "心率异常 {{.Value}}",
+			"vital.notify.4.1": "{{.NickName}} 心率过高 {{.Value}}",
+			"sleep.alarm":      "告警 {{.Code}}",
+		},
+		"en": {
+			"vital.notify.4": "Heart rate {{.Value}} on {{.DeviceName}}",
+			"bad":            "{{.Value",
+		},
+	})
+	cases := []struct {
+		locale string
+		event  Event
+		want   string
+	}{
+		{"zh-CN", Event{Type: EventVitalNotify, Code: 4, Status: 1, Value: 120, NickName: "张三"}, "张三 心率过高 120"},
+		{"zh-CN", Event{Type: EventVitalNotify, Code: 4, Status: 0, Value: 40}, "心率异常 40"},
+		// 语言前缀
+		{"en-US", Event{Type: EventVitalNotify, Code: 4, Value: 40, DeviceName: "bed"}, "Heart rate 40 on bed"},
+		// 没有该语言的模板使用缺省语言
+		{"fr", Event{Type: EventSleepAlarm, Code: 3008}, "告警 3008"},
+		{"", Event{Type: EventSleepAlarm, Code: 3010}, "告警 3010"},
+	}
+	for _, c := range cases {
+		got, err := Render(c.locale, &c.event)
+		if err != nil || got != c.want {
+			t.Errorf("Render(%s, %+v) = %q, %v, want %q", c.locale, c.event, got, err, c.want)
+		}
+	}
+	if _, err := Render("en", &Event{Type: EventStudyWarning, Code: 1}); err != ErrNoTemplate {
+		t.Errorf("missing template error = %v", err)
+	}
+}
+
+func TestLoadTemplateDir(t *testing.T) {
+	texts, err := LoadTemplateDir("../templates/notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, locale := range []string{"zh-CN", "zh-HK", "en"} {
+		items, ok := texts[locale]
+		if !ok {
+			t.Fatalf("locale %s not loaded", locale)
+		}
+		for key, text := range items {
+			if _, err := ParseTemplate(key, text); err != nil {
+				t.Errorf("%s %s: %v", locale, key, err)
+			}
+		}
+		if _, ok := items[EventAccountLocked]; !ok {
+			t.Errorf("locale %s has no %s template", locale, EventAccountLocked)
+		}
+	}
+	SetTemplates(texts)
+	got, err := Render("en", &Event{Type: EventAccountLocked, Title: "13800000000", Value: 30})
+	if err != nil || got != "Your account 13800000000 has been locked for 30 minutes after repeated failed logins, please change your password if this was not you" {
+		t.Errorf("Render(account_locked) = %q, %v", got, err)
+	}
+}
@@ -161,7 +161,76 @@ func SetValueEx(key string, value string, exSeconds int) error {
 	return rdb.Set(key, value, tm).Err()
 }
 
+// SetValueNx key不存在时才设置, 返回是否设置成功, 用于多个服务实例间的租约
+func SetValueNx(key string, value string, exSeconds int) (bool, error) {
+	return rdb.SetNX(key, value, time.Duration(exSeconds)*time.Second).Result()
+}
+
 func GetValue(key string) (string, error) {
 	result := rdb.Get(key)
 	return result.Val(), result.Err()
 }
+
+// incrExScript 计数加1和设置过期时间在一个脚本中执行, 不会留下没有过期时间的计数,
+// 已经没有过期时间的计数也会补上
+var incrExScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 or redis.call("TTL", KEYS[1]) == -1 then
+	redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return n`)
+
+/******************************************************************************
+ * function: IncrValueEx
+ * description: 计数加1, 第一次计数时设置过期时间, 用于限流和失败次数统计
+ * param {string} key
+ * param {int} exSeconds
+ * return {*} 加1后的计数
+********************************************************************************/
+func IncrValueEx(key string, exSeconds int) (int64, error) {
+	return incrExScript.Run(rdb, []string{key}, exSeconds).Int64()
+}
+
+// IncrHashValue hash中的计数字段加n, 用于多个服务实例共同的统计
+func IncrHashValue(key string, field string, n int64) error {
+	return rdb.HIncrBy(key, field, n).Err()
+}
+
+// SetHashValue 设置hash中的字段, 值不做json编码
+func SetHashValue(key string, field string, value string) error {
+	return rdb.HSet(key, field, value).Err()
+}
+
+// GetHashValues 取得hash中所有的字段
+func GetHashValues(key string) (map[string]string, error) {
+	return rdb.HGetAll(key).Result()
+}
+
+func DelValue(key string) error {
+	return rdb.Del(key).Err()
+}
+
+// TtlValue 取得key剩余的过期时间
+func TtlValue(key string) (time.Duration, error) {
+	return rdb.TTL(key).Result()
+}
+
+// DecrValue 计数减1, 返回减后的值
+func DecrValue(key string) (int64, error) {
+	return rdb.Decr(key).Result()
+}
+
+// ExpireValue 重新设置key的过期时间
+func ExpireValue(key string, exSeconds int) error {
+	return rdb.Expire(key, time.Duration(exSeconds)*time.Second).Err()
+}
+
+// Publish 发布消息到频道, 所有订阅了频道的服务实例都会收到
+func Publish(channel string, message string) error {
+	return rdb.Publish(channel, message).Err()
+}
+
+// NewPubSub 创建订阅连接, 之后再按需订阅和退订频道
+func NewPubSub() *redis.PubSub {
+	return rdb.Subscribe()
+}
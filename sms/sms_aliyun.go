@@ -0,0 +1,113 @@
+package sms
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"hjyserver/cfg"
+
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	dysmsapi20170525 "github.com/alibabacloud-go/dysmsapi-20170525/v3/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+const aliyunEndpoint = "dysmsapi.aliyuncs.com"
+
+type aliyunProvider struct {
+	cfg    *cfg.AliyunSmsCfg
+	client *dysmsapi20170525.Client
+	err    error
+}
+
+// aliyunReport 阿里云推送的回执
+type aliyunReport struct {
+	PhoneNumber string `json:"phone_number"`
+	Success     bool   `json:"success"`
+	ErrCode     string `json:"err_code"`
+	BizId       string `json:"biz_id"`
+}
+
+/**
+ * 使用AK&SK初始化账号Client
+ * @return Client
+ */
+func newAliyunProvider(c *cfg.AliyunSmsCfg) *aliyunProvider {
+	config := &openapi.Config{
+		AccessKeyId:     tea.String(c.AccessKeyId),
+		AccessKeySecret: tea.String(c.AccessKeySecret),
+	}
+	// Endpoint 请参考 https://api.aliyun.com/product/Dysmsapi
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = aliyunEndpoint
+	}
+	config.Endpoint = tea.String(endpoint)
+	p := &aliyunProvider{cfg: c}
+	p.client, p.err = dysmsapi20170525.NewClient(config)
+	return p
+}
+
+func (me *aliyunProvider) Name() string {
+	return ProviderAliyun
+}
+
+func (me *aliyunProvider) Send(msg *Message) (bizId string, err error) {
+	if me.err != nil {
+		return "", me.err
+	}
+	if me.cfg.AccessKeyId == "" {
+		return "", ErrNoProvider
+	}
+	templateCode := me.cfg.Templates[msg.Region]
+	param, _ := json.Marshal(map[string]string{"name": msg.NickName, "msg": msg.Text})
+	if code := me.cfg.CodeTemplates[msg.Region]; msg.Code != "" && code != "" {
+		templateCode = code
+		param, _ = json.Marshal(map[string]string{"code": msg.Code})
+	}
+	if templateCode == "" {
+		return "", ErrNoTemplate
+	}
+	request := &dysmsapi20170525.SendSmsRequest{
+		PhoneNumbers:  tea.String(msg.Phone),
+		SignName:      tea.String(me.cfg.SignName),
+		TemplateCode:  tea.String(templateCode),
+		TemplateParam: tea.String(string(param)),
+	}
+	// sdk中的异常以panic抛出
+	defer func() {
+		if r := tea.Recover(recover()); r != nil {
+			err = r
+		}
+	}()
+	resp, err := me.client.SendSmsWithOptions(request, &util.RuntimeOptions{})
+	if err != nil {
+		if e, ok := err.(*tea.SDKError); ok {
+			return "", errors.New(tea.StringValue(e.Message))
+		}
+		return "", err
+	}
+	if resp.Body == nil || tea.StringValue(resp.Body.Code) != "OK" {
+		return "", errors.New(tea.StringValue(util.ToJSONString(resp.Body)))
+	}
+	return tea.StringValue(resp.Body.BizId), nil
+}
+
+// ParseReport 阿里云的回执是json数组, 推送地址中的token需要与配置相同
+func (me *aliyunProvider) ParseReport(r *http.Request) ([]Report, error) {
+	token := r.URL.Query().Get("token")
+	if me.cfg.CallbackToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(me.cfg.CallbackToken)) != 1 {
+		return nil, ErrReportSign
+	}
+	var items []aliyunReport
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+	reports := make([]Report, 0, len(items))
+	for _, v := range items {
+		reports = append(reports, Report{BizId: v.BizId, Phone: v.PhoneNumber, Delivered: v.Success, ErrCode: v.ErrCode})
+	}
+	return reports, nil
+}
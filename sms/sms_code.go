@@ -0,0 +1,26 @@
+package sms
+
+// CodeSender 发送验证码短信的函数
+type CodeSender func(phone string, code string) error
+
+var codeSender CodeSender = sendCodeBySms
+
+func sendCodeBySms(phone string, code string) error {
+	return SendCode(phone, code)
+}
+
+/******************************************************************************
+ * function: SetCodeSender
+ * description: 替换发送验证码的函数, 返回原来的函数以便恢复
+ * param {CodeSender} sender
+ * return {*}
+********************************************************************************/
+func SetCodeSender(sender CodeSender) CodeSender {
+	old := codeSender
+	codeSender = sender
+	return old
+}
+
+func SendVerifyCode(phone string, code string) error {
+	return codeSender(phone, code)
+}
@@ -0,0 +1,18 @@
+package sms
+
+import "testing"
+
+func TestSetCodeSender(t *testing.T) {
+	sent := map[string]string{}
+	old := SetCodeSender(func(phone string, code string) error {
+		sent[phone] = code
+		return nil
+	})
+	defer SetCodeSender(old)
+	if err := SendVerifyCode("+85212345678", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	if sent["+85212345678"] != "123456" {
+		t.Errorf("mock sender not called: %v", sent)
+	}
+}
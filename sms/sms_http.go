@@ -0,0 +1,145 @@
+package sms
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"hjyserver/cfg"
+)
+
+// 缺省的请求超时, 单位秒
+const httpSmsTimeout = 10
+
+type httpProvider struct {
+	cfg    *cfg.HttpSmsCfg
+	client *http.Client
+}
+
+// httpSmsResp 发送接口的返回
+type httpSmsResp struct {
+	Sid     string `json:"sid"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func newHttpProvider(c *cfg.HttpSmsCfg) *httpProvider {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = httpSmsTimeout
+	}
+	return &httpProvider{
+		cfg:    c,
+		client: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+	}
+}
+
+func (me *httpProvider) Name() string {
+	return ProviderHttp
+}
+
+// e164Phone 转换为带国家码的号码, 如+8613800000000
+func e164Phone(phone string, region string) string {
+	if strings.HasPrefix(phone, "+") {
+		return phone
+	}
+	switch region {
+	case RegionCN:
+		return "+86" + phone
+	case RegionHK:
+		return "+852" + phone
+	}
+	return phone
+}
+
+func (me *httpProvider) Send(msg *Message) (string, error) {
+	text := msg.Text
+	if msg.NickName != "" {
+		text = msg.NickName + ", " + text
+	}
+	form := url.Values{}
+	form.Set("To", e164Phone(msg.Phone, msg.Region))
+	form.Set("From", me.cfg.From)
+	form.Set("Body", text)
+	if me.cfg.StatusCallback != "" {
+		form.Set("StatusCallback", me.cfg.StatusCallback)
+	}
+	apiUrl := strings.ReplaceAll(me.cfg.Url, "{sid}", me.cfg.AccountSid)
+	req, err := http.NewRequest(http.MethodPost, apiUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(me.cfg.AccountSid, me.cfg.AuthToken)
+	resp, err := me.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	result := &httpSmsResp{}
+	json.NewDecoder(resp.Body).Decode(result)
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("http status %d, %s", resp.StatusCode, result.Message)
+	}
+	return result.Sid, nil
+}
+
+/******************************************************************************
+ * function: signReport
+ * description: 回执的签名, 回调地址加上按名称排序的表单参数, 用AuthToken做HMAC-SHA1后base64
+ * param {string} token
+ * param {string} callback
+ * param {url.Values} form
+ * return {*}
+********************************************************************************/
+func signReport(token string, callback string, form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(callback)
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString(form.Get(k))
+	}
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ParseReport 每次回调一条短信的状态, 只统计送达、未送达和失败的最终状态
+func (me *httpProvider) ParseReport(r *http.Request) ([]Report, error) {
+	if me.cfg.StatusCallback == "" {
+		return nil, ErrReportSign
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	sign := signReport(me.cfg.AuthToken, me.cfg.StatusCallback, r.PostForm)
+	if !hmac.Equal([]byte(sign), []byte(r.Header.Get("X-Twilio-Signature"))) {
+		return nil, ErrReportSign
+	}
+	report := Report{
+		BizId:   r.PostForm.Get("MessageSid"),
+		Phone:   r.PostForm.Get("To"),
+		ErrCode: r.PostForm.Get("ErrorCode"),
+	}
+	switch r.PostForm.Get("MessageStatus") {
+	case "delivered":
+		report.Delivered = true
+	case "undelivered", "failed":
+		report.Delivered = false
+	default:
+		return []Report{}, nil
+	}
+	return []Report{report}, nil
+}
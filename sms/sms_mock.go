@@ -0,0 +1,56 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// MockProvider 保存发送的短信, 可以设置发送失败
+type MockProvider struct {
+	mu   sync.Mutex
+	sent []Message
+	err  error
+}
+
+func NewMockProvider() *MockProvider {
+	return &MockProvider{sent: make([]Message, 0)}
+}
+
+func (me *MockProvider) Name() string {
+	return ProviderMock
+}
+
+func (me *MockProvider) Send(msg *Message) (string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.err != nil {
+		return "", me.err
+	}
+	me.sent = append(me.sent, *msg)
+	return fmt.Sprintf("mock-%d", len(me.sent)), nil
+}
+
+// ParseReport 回执是Report的json数组
+func (me *MockProvider) ParseReport(r *http.Request) ([]Report, error) {
+	var reports []Report
+	if err := json.NewDecoder(r.Body).Decode(&reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// SetError 设置发送返回的错误, nil时恢复成功
+func (me *MockProvider) SetError(err error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.err = err
+}
+
+// Sent 返回已经发送的短信
+func (me *MockProvider) Sent() []Message {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return append([]Message{}, me.sent...)
+}
@@ -0,0 +1,329 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"hjyserver/cfg"
+	mylog "hjyserver/log"
+	"hjyserver/mdb/common"
+	"hjyserver/redis"
+)
+
+// define provider name
+const (
+	ProviderAliyun = "aliyun"
+	ProviderHttp   = "http"
+	ProviderMock   = "mock"
+)
+
+// define phone region
+const (
+	RegionCN = "cn"
+	RegionHK = "hk"
+)
+
+var (
+	ErrNoProvider   = errors.New("sms provider not configured")
+	ErrNoTemplate   = errors.New("sms template not configured")
+	ErrInvalidPhone = errors.New("phone is invalid")
+	// 回执的token或签名校验失败
+	ErrReportSign = errors.New("sms report signature error")
+)
+
+// Message 发送的一条短信
+type Message struct {
+	Phone string
+	// 手机号的地区 cn/hk
+	Region   string
+	NickName string
+	Text     string
+	// 验证码, 不为空时是验证码短信, 供应商有验证码模板时使用验证码模板发送
+	Code string
+}
+
+// Report 供应商推送的发送回执
+type Report struct {
+	// 供应商返回的短信id
+	BizId     string `json:"biz_id"`
+	Phone     string `json:"phone"`
+	Delivered bool   `json:"delivered"`
+	ErrCode   string `json:"err_code"`
+}
+
+// SmsProvider 短信供应商
+type SmsProvider interface {
+	Name() string
+	// Send 发送短信, 返回供应商的短信id, 用于对应回执
+	Send(msg *Message) (string, error)
+	// ParseReport 解析并校验供应商推送的回执
+	ParseReport(r *http.Request) ([]Report, error)
+}
+
+// ProviderStats 供应商的发送统计, 所有服务实例的合计
+type ProviderStats struct {
+	Provider string `json:"provider"`
+	// 发送请求成功的条数
+	Sent int64 `json:"sent"`
+	// 发送请求失败的条数
+	Failed int64 `json:"failed"`
+	// 回执为送达的条数
+	Delivered int64 `json:"delivered"`
+	// 回执为未送达的条数
+	Undelivered int64  `json:"undelivered"`
+	LastError   string `json:"last_error"`
+	LastSend    string `json:"last_send"`
+}
+
+// define stats field
+const (
+	statSent        = "sent"
+	statFailed      = "failed"
+	statDelivered   = "delivered"
+	statUndelivered = "undelivered"
+	statLastError   = "last_error"
+	statLastSend    = "last_send"
+)
+
+// statsStore 发送统计的存储, 字段为上面定义的统计项
+type statsStore interface {
+	Incr(provider string, field string, n int64)
+	Set(provider string, field string, value string)
+	Load(provider string) map[string]string
+}
+
+// redisStats 统计保存在redis的hash中, 每个供应商一个hash
+type redisStats struct {
+}
+
+func statsKey(provider string) string {
+	return "sms_stats_" + provider
+}
+
+func (me *redisStats) Incr(provider string, field string, n int64) {
+	if err := redis.IncrHashValue(statsKey(provider), field, n); err != nil {
+		mylog.Log.Errorln("update sms stats error:", err)
+	}
+}
+func (me *redisStats) Set(provider string, field string, value string) {
+	if err := redis.SetHashValue(statsKey(provider), field, value); err != nil {
+		mylog.Log.Errorln("update sms stats error:", err)
+	}
+}
+func (me *redisStats) Load(provider string) map[string]string {
+	values, err := redis.GetHashValues(statsKey(provider))
+	if err != nil {
+		mylog.Log.Errorln("query sms stats error:", err)
+	}
+	return values
+}
+
+var stats statsStore = &redisStats{}
+
+type registry struct {
+	mu        sync.RWMutex
+	providers map[string]SmsProvider
+	// 缺省的供应商
+	fallback string
+	regions  map[string]string
+}
+
+var providers = &registry{
+	providers: make(map[string]SmsProvider),
+	regions:   make(map[string]string),
+}
+
+/******************************************************************************
+ * function: Init
+ * description: 按配置创建短信供应商, 没有配置时使用阿里云
+ * return {*}
+********************************************************************************/
+func Init() {
+	c := cfg.This.Sms
+	Register(newAliyunProvider(&c.Aliyun))
+	if c.Http.Url != "" {
+		Register(newHttpProvider(&c.Http))
+	}
+	provider := c.Provider
+	if provider == "" {
+		provider = ProviderAliyun
+	}
+	// mock的回执没有校验, 只在配置使用时注册
+	useMock := provider == ProviderMock
+	for _, v := range c.Regions {
+		useMock = useMock || v == ProviderMock
+	}
+	if useMock {
+		Register(NewMockProvider())
+	}
+	SetRoutes(provider, c.Regions)
+	mylog.Log.Infof("sms provider %s, regions %v", provider, c.Regions)
+}
+
+// Register 注册供应商, 同名的替换
+func Register(p SmsProvider) {
+	providers.mu.Lock()
+	defer providers.mu.Unlock()
+	providers.providers[p.Name()] = p
+}
+
+// SetRoutes 设置缺省的供应商和按地区选择的供应商
+func SetRoutes(fallback string, regions map[string]string) {
+	providers.mu.Lock()
+	defer providers.mu.Unlock()
+	providers.fallback = fallback
+	providers.regions = make(map[string]string)
+	for k, v := range regions {
+		providers.regions[k] = v
+	}
+}
+
+// GetProvider 按名称查询供应商
+func GetProvider(name string) SmsProvider {
+	providers.mu.RLock()
+	defer providers.mu.RUnlock()
+	return providers.providers[name]
+}
+
+func (me *registry) route(region string) SmsProvider {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	name, ok := me.regions[region]
+	if !ok || name == "" {
+		name = me.fallback
+	}
+	return me.providers[name]
+}
+
+// Stats 查询已注册的每个供应商的发送统计
+func Stats() []ProviderStats {
+	providers.mu.RLock()
+	names := make([]string, 0, len(providers.providers))
+	for name := range providers.providers {
+		names = append(names, name)
+	}
+	providers.mu.RUnlock()
+	sort.Strings(names)
+	results := make([]ProviderStats, 0, len(names))
+	for _, name := range names {
+		values := stats.Load(name)
+		count := func(field string) int64 {
+			n, _ := strconv.ParseInt(values[field], 10, 64)
+			return n
+		}
+		results = append(results, ProviderStats{
+			Provider:    name,
+			Sent:        count(statSent),
+			Failed:      count(statFailed),
+			Delivered:   count(statDelivered),
+			Undelivered: count(statUndelivered),
+			LastError:   values[statLastError],
+			LastSend:    values[statLastSend],
+		})
+	}
+	return results
+}
+
+// PhoneRegion 手机号的地区, 不支持的地区返回空
+func PhoneRegion(phone string) string {
+	if common.IsCNPhone(phone) {
+		return RegionCN
+	} else if common.IsHKPhone(phone) {
+		return RegionHK
+	}
+	return ""
+}
+
+/******************************************************************************
+ * function: SendSms
+ * description: 按手机号的地区选择供应商发送短信
+ * param {string} phone
+ * param {string} nickName 用户昵称
+ * param {string} msg 短信内容
+ * return {*}
+********************************************************************************/
+func SendSms(phone string, nickName string, msg string) error {
+	return send(&Message{Phone: phone, NickName: nickName, Text: msg})
+}
+
+/******************************************************************************
+ * function: SendCode
+ * description: 发送验证码短信, 使用供应商的验证码模板
+ * param {string} phone
+ * param {string} code
+ * return {*}
+********************************************************************************/
+func SendCode(phone string, code string) error {
+	return send(&Message{Phone: phone, Code: code, Text: fmt.Sprintf("验证码%s, 5分钟内有效, 请勿告诉他人", code)})
+}
+
+func send(msg *Message) error {
+	phone := msg.Phone
+	if len(phone) <= 4 {
+		return ErrInvalidPhone
+	}
+	msg.Region = PhoneRegion(phone)
+	if msg.Region == "" {
+		return ErrInvalidPhone
+	}
+	p := providers.route(msg.Region)
+	if p == nil {
+		return ErrNoProvider
+	}
+	bizId, err := p.Send(msg)
+	stats.Set(p.Name(), statLastSend, common.GetNowTime())
+	if err != nil {
+		stats.Incr(p.Name(), statFailed, 1)
+		stats.Set(p.Name(), statLastError, err.Error())
+	} else {
+		stats.Incr(p.Name(), statSent, 1)
+	}
+	if err != nil {
+		mylog.Log.Errorf("send sms to %s by %s failed, %v", phone, p.Name(), err)
+		return err
+	}
+	mylog.Log.Infof("send sms to %s by %s, biz id: %s", phone, p.Name(), bizId)
+	return nil
+}
+
+/******************************************************************************
+ * function: HandleReport
+ * description: 处理供应商推送的发送回执, 更新供应商的送达统计
+ * param {string} name 供应商名称
+ * param {*http.Request} r
+ * return {*} 回执的条数
+********************************************************************************/
+func HandleReport(name string, r *http.Request) (int, error) {
+	p := GetProvider(name)
+	if p == nil {
+		return 0, ErrNoProvider
+	}
+	reports, err := p.ParseReport(r)
+	if err != nil {
+		return 0, err
+	}
+	var delivered, undelivered int64
+	for _, v := range reports {
+		if v.Delivered {
+			delivered++
+		} else {
+			undelivered++
+		}
+	}
+	if delivered > 0 {
+		stats.Incr(name, statDelivered, delivered)
+	}
+	if undelivered > 0 {
+		stats.Incr(name, statUndelivered, undelivered)
+	}
+	for _, v := range reports {
+		if !v.Delivered {
+			mylog.Log.Warnf("sms %s to %s not delivered by %s, %s", v.BizId, v.Phone, name, v.ErrCode)
+		}
+	}
+	return len(reports), nil
+}
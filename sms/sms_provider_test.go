@@ -0,0 +1,177 @@
+package sms
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"hjyserver/cfg"
+)
+
+// memStats 测试时代替redis保存统计
+type memStats struct {
+	mu     sync.Mutex
+	values map[string]map[string]string
+}
+
+func (me *memStats) Incr(provider string, field string, n int64) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	v, _ := strconv.ParseInt(me.values[provider][field], 10, 64)
+	me.set(provider, field, strconv.FormatInt(v+n, 10))
+}
+func (me *memStats) Set(provider string, field string, value string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.set(provider, field, value)
+}
+func (me *memStats) set(provider string, field string, value string) {
+	if me.values[provider] == nil {
+		me.values[provider] = make(map[string]string)
+	}
+	me.values[provider][field] = value
+}
+func (me *memStats) Load(provider string) map[string]string {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	values := make(map[string]string)
+	for k, v := range me.values[provider] {
+		values[k] = v
+	}
+	return values
+}
+
+func TestMain(m *testing.M) {
+	stats = &memStats{values: make(map[string]map[string]string)}
+	m.Run()
+}
+
+func statsOf(name string) ProviderStats {
+	for _, v := range Stats() {
+		if v.Provider == name {
+			return v
+		}
+	}
+	return ProviderStats{}
+}
+
+func TestSendSmsByRegion(t *testing.T) {
+	mock := NewMockProvider()
+	Register(mock)
+	SetRoutes(ProviderAliyun, map[string]string{RegionHK: ProviderMock})
+	defer SetRoutes("", nil)
+
+	if err := SendSms("+85212345678", "Tom", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	sent := mock.Sent()
+	if len(sent) != 1 || sent[0].Region != RegionHK || sent[0].NickName != "Tom" || sent[0].Text != "hello" {
+		t.Fatalf("sent %+v", sent)
+	}
+	if err := SendSms("12345", "", "hello"); err != ErrInvalidPhone {
+		t.Errorf("invalid phone error %v", err)
+	}
+	// cn没有注册阿里云时没有供应商
+	if err := SendSms("13800000000", "", "hello"); err != ErrNoProvider {
+		t.Errorf("no provider error %v", err)
+	}
+
+	mock.SetError(errors.New("quota exceeded"))
+	if err := SendSms("+85212345678", "", "hello"); err == nil {
+		t.Error("mock error should be returned")
+	}
+	s := statsOf(ProviderMock)
+	if s.Sent != 1 || s.Failed != 1 || s.LastError != "quota exceeded" {
+		t.Errorf("stats %+v", s)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/sms/report/mock",
+		strings.NewReader(`[{"biz_id":"mock-1","delivered":true},{"biz_id":"mock-2","delivered":false}]`))
+	if n, err := HandleReport(ProviderMock, r); err != nil || n != 2 {
+		t.Fatalf("report %d %v", n, err)
+	}
+	if s := statsOf(ProviderMock); s.Delivered != 1 || s.Undelivered != 1 {
+		t.Errorf("report stats %+v", s)
+	}
+}
+
+func TestHttpProvider(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "AC1" || pass != "secret" || r.URL.Path != "/Accounts/AC1/Messages.json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"auth error"}`))
+			return
+		}
+		r.ParseForm()
+		form = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"SM1","status":"queued"}`))
+	}))
+	defer server.Close()
+	callback := "https://example.com/v2/sms/report/http"
+	p := newHttpProvider(&cfg.HttpSmsCfg{
+		Url:            server.URL + "/Accounts/{sid}/Messages.json",
+		AccountSid:     "AC1",
+		AuthToken:      "secret",
+		From:           "+15550000000",
+		StatusCallback: callback,
+	})
+	sid, err := p.Send(&Message{Phone: "13800000000", Region: RegionCN, Text: "hello"})
+	if err != nil || sid != "SM1" {
+		t.Fatalf("send %s %v", sid, err)
+	}
+	if form.Get("To") != "+8613800000000" || form.Get("Body") != "hello" || form.Get("StatusCallback") != callback {
+		t.Errorf("form %v", form)
+	}
+
+	report := url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"undelivered"}, "To": {"+8613800000000"}, "ErrorCode": {"30003"}}
+	newReport := func(sign string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/sms/report/http", strings.NewReader(report.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Twilio-Signature", sign)
+		return r
+	}
+	if _, err := p.ParseReport(newReport("bad")); err != ErrReportSign {
+		t.Errorf("bad signature error %v", err)
+	}
+	reports, err := p.ParseReport(newReport(signReport("secret", callback, report)))
+	if err != nil || len(reports) != 1 || reports[0].Delivered || reports[0].ErrCode != "30003" {
+		t.Errorf("reports %+v %v", reports, err)
+	}
+}
+
+func TestAliyunReportToken(t *testing.T) {
+	p := newAliyunProvider(&cfg.AliyunSmsCfg{CallbackToken: "abc"})
+	body := `[{"phone_number":"13800000000","success":true,"err_code":"DELIVERED","biz_id":"900"}]`
+	r := httptest.NewRequest(http.MethodPost, "/sms/report/aliyun?token=xyz", strings.NewReader(body))
+	if _, err := p.ParseReport(r); err != ErrReportSign {
+		t.Errorf("token error %v", err)
+	}
+	r = httptest.NewRequest(http.MethodPost, "/sms/report/aliyun?token=abc", strings.NewReader(body))
+	reports, err := p.ParseReport(r)
+	if err != nil || len(reports) != 1 || !reports[0].Delivered || reports[0].BizId != "900" {
+		t.Errorf("reports %+v %v", reports, err)
+	}
+}
+
+func TestSendCode(t *testing.T) {
+	mock := NewMockProvider()
+	Register(mock)
+	SetRoutes(ProviderMock, nil)
+	defer SetRoutes("", nil)
+
+	if err := SendCode("13800000000", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	sent := mock.Sent()
+	if len(sent) != 1 || sent[0].Code != "123456" || sent[0].Region != RegionCN || !strings.Contains(sent[0].Text, "123456") {
+		t.Fatalf("sent %+v", sent)
+	}
+}
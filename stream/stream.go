@@ -0,0 +1,305 @@
+package stream
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	mylog "hjyserver/log"
+	"hjyserver/redis"
+
+	goredis "github.com/go-redis/redis"
+)
+
+// 每个连接缓存的消息数, 连接处理不过来时丢弃新消息
+const subscriberBuffer = 64
+
+// 观看者计数的过期时间, 有观看者的实例定时刷新, 实例异常退出后计数自动清除
+const viewerTtl = 180
+
+// 发布前查询的观看者计数在本实例缓存的时间, 减少设备上报时对redis的查询
+const viewerCacheTtl = 5 * time.Second
+
+// Message 推送给app的消息, payload与mqtt主题的内容相同
+type Message struct {
+	Mac     string          `json:"mac"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload" swaggertype:"object"`
+}
+
+// Subscriber 一个app连接
+type Subscriber struct {
+	Macs []string
+	C    chan *Message
+}
+
+type hub struct {
+	mu   sync.Mutex
+	subs map[string]map[*Subscriber]struct{}
+	ps   *goredis.PubSub
+	quit chan struct{}
+	// 设备是否有观看者的缓存, mac -> viewerState
+	viewers sync.Map
+}
+
+type viewerState struct {
+	has    bool
+	expire time.Time
+}
+
+var streamHub = newHub()
+
+// 第一个观看者订阅和最后一个观看者离开时调用, 用于开始和停止设备的实时数据推送
+var onFirstViewer, onLastViewer func(mac string)
+
+func newHub() *hub {
+	return &hub{subs: make(map[string]map[*Subscriber]struct{})}
+}
+
+func channelName(mac string) string {
+	return "stream_" + mac
+}
+
+func viewerKey(mac string) string {
+	return "stream_viewers_" + mac
+}
+
+func normalizeMac(mac string) string {
+	return strings.ToLower(strings.TrimSpace(mac))
+}
+
+// SetViewerHooks 设置观看者变化时的回调
+func SetViewerHooks(first func(mac string), last func(mac string)) {
+	onFirstViewer = first
+	onLastViewer = last
+}
+
+/******************************************************************************
+ * function: Start
+ * description: 创建redis订阅连接, 接收其他实例发布的设备数据, 必须在redis初始化之后调用
+ * return {*}
+********************************************************************************/
+func Start() {
+	streamHub.mu.Lock()
+	defer streamHub.mu.Unlock()
+	if streamHub.ps != nil {
+		return
+	}
+	streamHub.ps = redis.NewPubSub()
+	streamHub.quit = make(chan struct{})
+	go streamHub.receive(streamHub.ps.Channel())
+	go streamHub.keepAlive(streamHub.quit)
+	mylog.Log.Infoln("stream hub started")
+}
+
+// Stop 关闭redis订阅连接
+func Stop() {
+	streamHub.mu.Lock()
+	defer streamHub.mu.Unlock()
+	if streamHub.ps == nil {
+		return
+	}
+	close(streamHub.quit)
+	streamHub.ps.Close()
+	streamHub.ps = nil
+}
+
+// Running 是否已经启动
+func Running() bool {
+	return streamHub.pubSub() != nil
+}
+
+func (h *hub) pubSub() *goredis.PubSub {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ps
+}
+
+/******************************************************************************
+ * function: Publish
+ * description: 发布设备数据, 没有启动或者所有实例都没有该设备的观看者时直接返回
+ * param {string} mac
+ * param {string} topic 对应的mqtt主题
+ * param {interface{}} payload
+ * return {*}
+********************************************************************************/
+func Publish(mac string, topic string, payload interface{}) {
+	if !Running() {
+		return
+	}
+	mac = normalizeMac(mac)
+	if !streamHub.hasViewers(mac) {
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return
+	}
+	msg, err := json.Marshal(&Message{Mac: mac, Topic: topic, Payload: data})
+	if err != nil {
+		mylog.Log.Errorln(err)
+		return
+	}
+	if err := redis.Publish(channelName(mac), string(msg)); err != nil {
+		mylog.Log.Errorln("publish stream message error:", err)
+	}
+}
+
+/******************************************************************************
+ * function: Subscribe
+ * description: 新连接订阅设备, 调用前必须已经检查过权限
+ * param {[]string} macs
+ * return {*}
+********************************************************************************/
+func Subscribe(macs []string) *Subscriber {
+	sub := &Subscriber{C: make(chan *Message, subscriberBuffer)}
+	seen := make(map[string]bool)
+	for _, mac := range macs {
+		if mac = normalizeMac(mac); mac != "" && !seen[mac] {
+			seen[mac] = true
+			sub.Macs = append(sub.Macs, mac)
+		}
+	}
+	channels := streamHub.add(sub)
+	if ps := streamHub.pubSub(); ps != nil && len(channels) > 0 {
+		if err := ps.Subscribe(channels...); err != nil {
+			mylog.Log.Errorln("subscribe stream channel error:", err)
+		}
+	}
+	for _, mac := range sub.Macs {
+		n, err := redis.IncrValueEx(viewerKey(mac), viewerTtl)
+		if err != nil {
+			mylog.Log.Errorln(err)
+			continue
+		}
+		if n == 1 && onFirstViewer != nil {
+			go onFirstViewer(mac)
+		}
+	}
+	return sub
+}
+
+// Unsubscribe 连接关闭时退订, 之后不再向连接的通道写入
+func Unsubscribe(sub *Subscriber) {
+	channels := streamHub.remove(sub)
+	if ps := streamHub.pubSub(); ps != nil && len(channels) > 0 {
+		if err := ps.Unsubscribe(channels...); err != nil {
+			mylog.Log.Errorln("unsubscribe stream channel error:", err)
+		}
+	}
+	for _, mac := range sub.Macs {
+		n, err := redis.DecrValue(viewerKey(mac))
+		if err != nil {
+			mylog.Log.Errorln(err)
+			continue
+		}
+		if n <= 0 {
+			redis.DelValue(viewerKey(mac))
+			if onLastViewer != nil {
+				go onLastViewer(mac)
+			}
+		}
+	}
+}
+
+// hasViewers 所有实例中设备是否有观看者, 本实例有连接时不查询redis, 查询结果缓存viewerCacheTtl
+func (h *hub) hasViewers(mac string) bool {
+	h.mu.Lock()
+	_, local := h.subs[mac]
+	h.mu.Unlock()
+	if local {
+		return true
+	}
+	if v, ok := h.viewers.Load(mac); ok && time.Now().Before(v.(viewerState).expire) {
+		return v.(viewerState).has
+	}
+	n, _ := redis.GetValue(viewerKey(mac))
+	has := n != "" && n != "0"
+	h.viewers.Store(mac, viewerState{has: has, expire: time.Now().Add(viewerCacheTtl)})
+	return has
+}
+
+// add 加入连接, 返回本实例第一次关注的设备频道
+func (h *hub) add(sub *Subscriber) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var channels []string
+	for _, mac := range sub.Macs {
+		subs, ok := h.subs[mac]
+		if !ok {
+			subs = make(map[*Subscriber]struct{})
+			h.subs[mac] = subs
+			channels = append(channels, channelName(mac))
+		}
+		subs[sub] = struct{}{}
+	}
+	return channels
+}
+
+// remove 移除连接并关闭通道, 返回本实例不再关注的设备频道
+func (h *hub) remove(sub *Subscriber) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var channels []string
+	for _, mac := range sub.Macs {
+		subs, ok := h.subs[mac]
+		if !ok {
+			continue
+		}
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.subs, mac)
+			channels = append(channels, channelName(mac))
+		}
+	}
+	close(sub.C)
+	return channels
+}
+
+// dispatch 分发给本实例关注设备的连接, 连接缓存满时丢弃
+func (h *hub) dispatch(msg *Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[msg.Mac] {
+		select {
+		case sub.C <- msg:
+		default:
+			mylog.Log.Debugln("stream subscriber is slow, drop message of", msg.Mac)
+		}
+	}
+}
+
+func (h *hub) receive(ch <-chan *goredis.Message) {
+	for m := range ch {
+		msg := &Message{}
+		if err := json.Unmarshal([]byte(m.Payload), msg); err != nil {
+			mylog.Log.Errorln(err)
+			continue
+		}
+		h.dispatch(msg)
+	}
+}
+
+// keepAlive 刷新本实例关注设备的观看者计数过期时间
+func (h *hub) keepAlive(quit chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			macs := make([]string, 0, len(h.subs))
+			for mac := range h.subs {
+				macs = append(macs, mac)
+			}
+			h.mu.Unlock()
+			for _, mac := range macs {
+				redis.ExpireValue(viewerKey(mac), viewerTtl)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package stream
+
+import (
+	"testing"
+)
+
+func TestHubDispatch(t *testing.T) {
+	h := newHub()
+	a := &Subscriber{Macs: []string{"aa"}, C: make(chan *Message, 1)}
+	b := &Subscriber{Macs: []string{"aa", "bb"}, C: make(chan *Message, 1)}
+	if channels := h.add(a); len(channels) != 1 || channels[0] != "stream_aa" {
+		t.Fatalf("add a = %v", channels)
+	}
+	if channels := h.add(b); len(channels) != 1 || channels[0] != "stream_bb" {
+		t.Fatalf("add b = %v", channels)
+	}
+	h.dispatch(&Message{Mac: "bb", Topic: "t"})
+	if len(a.C) != 0 || len(b.C) != 1 {
+		t.Errorf("dispatch bb: a=%d b=%d", len(a.C), len(b.C))
+	}
+	// b的缓存已满, 丢弃而不是阻塞
+	h.dispatch(&Message{Mac: "aa", Topic: "t"})
+	if len(a.C) != 1 || len(b.C) != 1 {
+		t.Errorf("dispatch aa: a=%d b=%d", len(a.C), len(b.C))
+	}
+	if channels := h.remove(a); len(channels) != 0 {
+		t.Errorf("remove a = %v", channels)
+	}
+	if channels := h.remove(b); len(channels) != 2 {
+		t.Errorf("remove b = %v", channels)
+	}
+	if len(h.subs) != 0 {
+		t.Errorf("subs not empty: %v", h.subs)
+	}
+}
@@ -139,12 +139,16 @@ func respJSON(c *gin.Context, status int, msg interface{}) {
 	}
 }
 
-// 返回带页号的response 回应，格式为{code: 200, pageNo: 1, pageSize 20, data: {} }
+// 返回带页号的response 回应，格式为{code: 200, pageNo: 1, pageSize 20, totalPage: 2, totalCount: 30, next_cursor: "", data: {} }
+// page为nil时按普通response返回
 func respJSONWithPage(c *gin.Context, status int, page *common.PageDao, msg interface{}) {
 	if status != http.StatusOK {
 		c.JSON(status, gin.H{"code": status, "message": msg})
+	} else if page == nil {
+		c.JSON(status, gin.H{"code": status, "data": msg})
 	} else {
-		c.JSON(status, gin.H{"code": status, "pageNo": page.PageNo, "pageSize": page.PageSize, "totalPage": page.TotalPages, "data": msg})
+		c.JSON(status, gin.H{"code": status, "pageNo": page.PageNo, "pageSize": page.PageSize, "totalPage": page.TotalPages,
+			"totalCount": page.TotalCount, "next_cursor": page.NextCursor, "data": msg})
 	}
 }
 
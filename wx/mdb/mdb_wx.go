@@ -46,8 +46,21 @@ type WxMiniSession struct {
 //swagger:model WxMiniLoginResp
 type WxMiniLoginResp struct {
 	mysql.User
-	Gender int    `json:"gender"`
-	Token  string `json:"token"`
+	Gender       int    `json:"gender"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// access token有效期, 单位秒, 旧格式token为0
+	ExpiresIn int    `json:"expires_in,omitempty"`
+	SessionId string `json:"session_id,omitempty"`
+}
+
+func (me *WxMiniLoginResp) setToken(c *gin.Context) {
+	if tokens, ok := mysql.IssueUserToken(c, &me.User); ok {
+		me.Token = tokens.Token
+		me.RefreshToken = tokens.RefreshToken
+		me.ExpiresIn = tokens.ExpiresIn
+		me.SessionId = tokens.SessionId
+	}
 }
 
 /******************************************************************************
@@ -138,7 +151,7 @@ func WxMiniProgramLogin(c *gin.Context) (int, interface{}) {
 			resp := &WxMiniLoginResp{}
 			if resp.QueryByID(userId) {
 				if resp.Phone == phone {
-					resp.Token, _ = mysql.GetUserToken(&resp.User)
+					resp.setToken(c)
 					resp.IsLogin = 1
 					resp.LoginTime = common.GetNowTime()
 					resp.Update()
@@ -174,7 +187,7 @@ func WxMiniProgramLogin(c *gin.Context) (int, interface{}) {
 	resp := &WxMiniLoginResp{}
 	resp.User = *result.(*mysql.User)
 	resp.Gender = req.Gender
-	resp.Token, _ = mysql.GetUserToken(&resp.User)
+	resp.setToken(c)
 	return common.Success, resp
 }
 
@@ -288,7 +301,11 @@ func registerUserWithPhone(phone string, nickName string, gender int, avatarUrl
 	userObj.NickName = nickName
 	userObj.Gender = gender
 	userObj.Face = avatarUrl
-	userObj.Password = "888888"
+	hash, err := common.HashPassword("888888")
+	if err != nil {
+		return common.ParamError, "password format error"
+	}
+	userObj.Password = hash
 	userObj.IsLogin = 1
 	return mysql.RegisterWithUserObj(userObj)
 }
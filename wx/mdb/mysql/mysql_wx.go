@@ -80,6 +80,22 @@ func DeleteMiniProgramByUserId(userId int64) bool {
 	return mysql.DeleteDaoByFilter(NewWxMiniProgram().TableName(), filter)
 }
 
+/******************************************************************************
+ * function: DeleteMiniProgramByUserIdTx
+ * description: 在事务中删除用户绑定的小程序记录
+ * param {*sql.Tx} tx
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func DeleteMiniProgramByUserIdTx(tx *sql.Tx, userId int64) bool {
+	tblName := NewWxMiniProgram().TableName()
+	if !mysql.CheckTableExist(tblName) {
+		return true
+	}
+	filter := fmt.Sprintf("user_id = %d", userId)
+	return mysql.DeleteDaoByFilterTx(tx, tblName, filter)
+}
+
 /******************************************************************************
  * function: QueryWxMiniProgramByOpenId
  * description: 根据openId查询小程序用户信息
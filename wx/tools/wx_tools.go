@@ -196,6 +196,47 @@ func SendCustomerTextMsgToOfficalAccount(openId string, content string) (int, st
 	return common.Success, "success"
 }
 
+/******************************************************************************
+ * function: QueryOfficalAccountOpenId
+ * description: 通过小程序的unionId找到用户关注公众号的openId, 用户没有绑定小程序或没有关注公众号时返回false
+ * param {int64} userId
+ * return {*}
+********************************************************************************/
+func QueryOfficalAccountOpenId(userId int64) (string, bool) {
+	miniList := make([]mysqlwx.WxMiniProgram, 0)
+	mysqlwx.QueryWxMiniProgramByUserId(userId, &miniList)
+	if len(miniList) == 0 || miniList[0].UnionId == "" {
+		return "", false
+	}
+	officalList := make([]mysqlwx.WxOfficalAccount, 0)
+	mysqlwx.QueryWxOfficalAccountSubscribeByUnionId(miniList[0].UnionId, &officalList)
+	if len(officalList) == 0 {
+		return "", false
+	}
+	return officalList[0].FromOpenId, true
+}
+
+/******************************************************************************
+ * function: SendCustomerTextMsgToUser
+ * description: 通过小程序的unionId找到用户关注的公众号, 发送客服文本消息
+ * param {int64} userId
+ * param {string} content
+ * return {*}
+********************************************************************************/
+func SendCustomerTextMsgToUser(userId int64, content string) (int, string) {
+	miniList := make([]mysqlwx.WxMiniProgram, 0)
+	mysqlwx.QueryWxMiniProgramByUserId(userId, &miniList)
+	if len(miniList) == 0 || miniList[0].UnionId == "" {
+		return common.NoData, "can not find mini program user in datebase"
+	}
+	officalList := make([]mysqlwx.WxOfficalAccount, 0)
+	mysqlwx.QueryWxOfficalAccountSubscribeByUnionId(miniList[0].UnionId, &officalList)
+	if len(officalList) == 0 {
+		return common.NoData, "can not find offical account user in datebase"
+	}
+	return SendCustomerTextMsgToOfficalAccount(officalList[0].FromOpenId, content)
+}
+
 /******************************************************************************
  * function: SendCustomerWelcomeCardToOfficalAccount
  * description: 发送欢迎卡片到公众号
@@ -498,6 +539,24 @@ func SendT1DeviceStatusWarningMsgToOfficalAccount(userId int64, nickName string,
 	return SendTempMessageToOfficalAccount(openId, cfg.This.Wx.DeviceStatusOfficalTemplateId, "", data)
 }
 
+/******************************************************************************
+ * function: SendDeviceStatusWarningMsgToOpenId
+ * description: 发送设备状态告警消息到指定的公众号openId, 用于紧急联系人
+ * param {string} openId
+ * param {string} nickName
+ * param {string} msg
+ * param {string} tm
+ * return {*}
+********************************************************************************/
+func SendDeviceStatusWarningMsgToOpenId(openId string, nickName string, msg string, tm string) (int, string) {
+	data := map[string]interface{}{
+		"thing10": map[string]interface{}{"value": nickName},
+		"thing2":  map[string]interface{}{"value": msg},
+		"time4":   map[string]interface{}{"value": tm},
+	}
+	return SendTempMessageToOfficalAccount(openId, cfg.This.Wx.DeviceStatusOfficalTemplateId, "", data)
+}
+
 /******************************************************************************
  * function:
  * description: